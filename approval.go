@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// The environment --approve-cmd runs with, besides the plan on stdin.
+const (
+	approvalRunIDEnv     = "SSH_KEY_BOOTSTRAP_RUN_ID"
+	approvalHostCountEnv = "SSH_KEY_BOOTSTRAP_HOST_COUNT"
+)
+
+// approveRunPlan runs --approve-cmd with the JSON plan on stdin and lets the
+// run go on only when it exits 0, so a change-management system can gate
+// the run. The command runs through the shell (sh -c, or cmd /C on Windows);
+// the last line it prints is shown with the outcome.
+func approveRunPlan(command string, plan runPlan) error {
+	outputAnsibleTask("Request approval")
+	var planJSON bytes.Buffer
+	if err := writeRunPlanJSON(&planJSON, plan); err != nil {
+		return err
+	}
+	approval := approvalShellCommand(command)
+	approval.Stdin = &planJSON
+	approval.Env = append(os.Environ(),
+		approvalRunIDEnv+"="+plan.RunID,
+		approvalHostCountEnv+"="+strconv.Itoa(len(plan.Hosts)))
+	commandOutput, err := approval.CombinedOutput()
+	answer := lastOutputLine(commandOutput)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		message := fmt.Sprintf("declined (exit %d)", exitErr.ExitCode())
+		if answer != "" {
+			message += ": " + answer
+		}
+		outputAnsibleHostStatus("failed", "localhost", message)
+		return fmt.Errorf("run not approved: --approve-cmd exited with %d", exitErr.ExitCode())
+	}
+	if err != nil {
+		outputAnsibleHostStatus("failed", "localhost", err.Error())
+		return fmt.Errorf("run --approve-cmd: %w", err)
+	}
+	message := "approved"
+	if answer != "" {
+		message += ": " + answer
+	}
+	outputAnsibleHostStatus("ok", "localhost", message)
+	return nil
+}
+
+func approvalShellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command) // #nosec G204 -- the approval command is explicit operator input
+	}
+	return exec.Command("sh", "-c", command) // #nosec G204 -- the approval command is explicit operator input
+}
+
+func lastOutputLine(commandOutput []byte) string {
+	lines := strings.Split(strings.TrimSpace(normalizeLF(string(commandOutput))), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestApproveRunPlanPassesPlanAndHonorsExitStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	output, _ := captureWriters(t)
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	plan := runPlan{RunID: "run-7", Operations: []string{"install-key"}, Hosts: []hostPlanItem{{Host: "app01:22", User: "ops"}}}
+
+	command := `cat > "` + planPath + `" && echo "checking" && echo "CHG-1234 approved for $SSH_KEY_BOOTSTRAP_RUN_ID ($SSH_KEY_BOOTSTRAP_HOST_COUNT host)"`
+	if err := approveRunPlan(command, plan); err != nil {
+		t.Fatalf("approveRunPlan() error = %v", err)
+	}
+	planBytes, err := os.ReadFile(planPath)
+	if err != nil {
+		t.Fatalf("read plan given to the command: %v", err)
+	}
+	var got runPlan
+	if err := json.Unmarshal(planBytes, &got); err != nil || got.RunID != "run-7" || len(got.Hosts) != 1 || got.Hosts[0].Host != "app01:22" {
+		t.Fatalf("plan on stdin = %s (%v)", planBytes, err)
+	}
+	if !strings.Contains(output.String(), "TASK [Request approval]") || !strings.Contains(output.String(), "approved: CHG-1234 approved for run-7 (1 host)") {
+		t.Fatalf("output = %q", output.String())
+	}
+
+	err = approveRunPlan(`echo "outside the change window"; exit 3`, plan)
+	if err == nil || !strings.Contains(err.Error(), "exited with 3") {
+		t.Fatalf("approveRunPlan() of a declining command error = %v", err)
+	}
+	if !strings.Contains(output.String(), "declined (exit 3): outside the change window") {
+		t.Fatalf("output = %q", output.String())
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+const (
+	authKeySourceAgent        = "agent"
+	authKeySourceFIDOResident = "fido-resident"
+	authKeySourcePKCS11       = "pkcs11"
+)
+
+// authKeySource is where the publickey login key comes from (AUTH_KEY_SOURCE).
+// Every source ends up in ssh-agent, so the private key is never read from
+// disk by this tool.
+type authKeySource struct {
+	kind   string
+	module string // PKCS#11 module path for the pkcs11 source
+}
+
+// runSSHAdd runs ssh-add attached to the terminal so it can ask for a PIN or
+// a touch of the security key. Tests replace it.
+var runSSHAdd = func(args ...string) error {
+	sshAddPath, err := exec.LookPath("ssh-add")
+	if err != nil {
+		return fmt.Errorf("ssh-add is required to load hardware-backed keys: %w", err)
+	}
+	command := exec.Command(sshAddPath, args...) // #nosec G204 -- fixed binary; arguments come from AUTH_KEY_SOURCE
+	command.Stdin = os.Stdin
+	command.Stdout = getStandardErrorWriter()
+	command.Stderr = getStandardErrorWriter()
+	return command.Run()
+}
+
+// parseAuthKeySource accepts "agent" (the default), "fido-resident" and
+// "pkcs11:<module path>".
+func parseAuthKeySource(value string) (authKeySource, error) {
+	trimmedValue := strings.TrimSpace(value)
+	switch {
+	case trimmedValue == "" || strings.EqualFold(trimmedValue, authKeySourceAgent):
+		return authKeySource{kind: authKeySourceAgent}, nil
+	case strings.EqualFold(trimmedValue, authKeySourceFIDOResident):
+		return authKeySource{kind: authKeySourceFIDOResident}, nil
+	case strings.HasPrefix(strings.ToLower(trimmedValue), authKeySourcePKCS11+":"):
+		modulePath, err := expandHomePath(strings.TrimSpace(trimmedValue[len(authKeySourcePKCS11)+1:]))
+		if err != nil {
+			return authKeySource{}, fmt.Errorf("AUTH_KEY_SOURCE: %w", err)
+		}
+		if modulePath == "" {
+			return authKeySource{}, fmt.Errorf("AUTH_KEY_SOURCE %q is missing the PKCS#11 module path", value)
+		}
+		if _, err := os.Stat(modulePath); err != nil {
+			return authKeySource{}, fmt.Errorf("AUTH_KEY_SOURCE PKCS#11 module: %w", err)
+		}
+		return authKeySource{kind: authKeySourcePKCS11, module: modulePath}, nil
+	default:
+		return authKeySource{}, fmt.Errorf("unknown AUTH_KEY_SOURCE %q (valid: %s, %s, %s:<module>)", value, authKeySourceAgent, authKeySourceFIDOResident, authKeySourcePKCS11)
+	}
+}
+
+// loadAuthKeySource adds hardware-backed keys to ssh-agent before the first
+// connection: PKCS#11 keys with `ssh-add -s` and FIDO2 resident keys with
+// `ssh-add -K`. With --use-openssh the PKCS#11 module is handed to ssh
+// directly instead.
+func loadAuthKeySource(programOptions *options) error {
+	if !slices.Contains(authMethodOrder(programOptions), authMethodPublicKey) {
+		return nil
+	}
+	keySource, err := parseAuthKeySource(programOptions.AuthKeySource)
+	if err != nil {
+		return err
+	}
+
+	switch keySource.kind {
+	case authKeySourcePKCS11:
+		if programOptions.UseOpenSSH {
+			return nil
+		}
+		if err := runSSHAdd("-s", keySource.module); err != nil {
+			return fmt.Errorf("load PKCS#11 keys into ssh-agent: %w", err)
+		}
+	case authKeySourceFIDOResident:
+		if err := runSSHAdd("-K"); err != nil {
+			return fmt.Errorf("load FIDO2 resident keys into ssh-agent: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func stubSSHAdd(t *testing.T) *[][]string {
+	t.Helper()
+	original := runSSHAdd
+	var calls [][]string
+	runSSHAdd = func(args ...string) error {
+		calls = append(calls, args)
+		return nil
+	}
+	t.Cleanup(func() { runSSHAdd = original })
+	return &calls
+}
+
+func TestParseAuthKeySource(t *testing.T) {
+	modulePath := filepath.Join(t.TempDir(), "opensc-pkcs11.so")
+	if err := os.WriteFile(modulePath, nil, 0o600); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+
+	testCases := map[string]authKeySource{
+		"":                     {kind: authKeySourceAgent},
+		"Agent":                {kind: authKeySourceAgent},
+		"fido-resident":        {kind: authKeySourceFIDOResident},
+		"pkcs11:" + modulePath: {kind: authKeySourcePKCS11, module: modulePath},
+	}
+	for value, want := range testCases {
+		got, err := parseAuthKeySource(value)
+		if err != nil || got != want {
+			t.Fatalf("parseAuthKeySource(%q) = %+v, %v; want %+v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"pkcs11:", "pkcs11:/missing/module.so", "yubikey"} {
+		if _, err := parseAuthKeySource(value); err == nil {
+			t.Fatalf("parseAuthKeySource(%q) error = nil, want error", value)
+		}
+	}
+}
+
+func TestLoadAuthKeySourceAddsHardwareKeysToAgent(t *testing.T) {
+	calls := stubSSHAdd(t)
+	modulePath := filepath.Join(t.TempDir(), "libykcs11.so")
+	if err := os.WriteFile(modulePath, nil, 0o600); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+
+	if err := loadAuthKeySource(&options{AuthKeySource: "pkcs11:" + modulePath}); err != nil {
+		t.Fatalf("loadAuthKeySource(pkcs11) error = %v", err)
+	}
+	if err := loadAuthKeySource(&options{AuthKeySource: "fido-resident"}); err != nil {
+		t.Fatalf("loadAuthKeySource(fido-resident) error = %v", err)
+	}
+	if err := loadAuthKeySource(&options{AuthKeySource: "pkcs11:" + modulePath, UseOpenSSH: true}); err != nil {
+		t.Fatalf("loadAuthKeySource(pkcs11, openssh) error = %v", err)
+	}
+
+	want := [][]string{{"-s", modulePath}, {"-K"}}
+	if len(*calls) != len(want) || !slices.Equal((*calls)[0], want[0]) || !slices.Equal((*calls)[1], want[1]) {
+		t.Fatalf("ssh-add calls = %v, want %v", *calls, want)
+	}
+	if args := strings.Join(opensshAuthArgs(&options{AuthKeySource: "pkcs11:" + modulePath}), " "); !strings.Contains(args, "PKCS11Provider="+modulePath) || !strings.Contains(args, "PreferredAuthentications=publickey,") {
+		t.Fatalf("opensshAuthArgs(pkcs11) = %q", args)
+	}
+}
+
+func TestValidateAuthMethodsKeySourceNeedsPublicKey(t *testing.T) {
+	if err := validateAuthMethods(&options{AuthKeySource: "fido-resident"}); err != nil {
+		t.Fatalf("validateAuthMethods(default methods) error = %v", err)
+	}
+	if got := authMethodOrder(&options{AuthKeySource: "fido-resident"}); !slices.Equal(got, []string{authMethodPublicKey, authMethodPassword}) {
+		t.Fatalf("authMethodOrder() = %v, want publickey then password", got)
+	}
+	if err := validateAuthMethods(&options{AuthMethods: "password", AuthKeySource: "fido-resident"}); err == nil {
+		t.Fatalf("validateAuthMethods() error = nil, want publickey required")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	authMethodPassword  = "password"
+	authMethodGSSAPI    = "gssapi"
+	authMethodPublicKey = "publickey"
+)
+
+// errNativeGSSAPIUnavailable refuses gssapi for the built-in client, which
+// has no Kerberos implementation; only --use-openssh supports it.
+var errNativeGSSAPIUnavailable = errors.New("the built-in SSH client does not support Kerberos; use --use-openssh for gssapi authentication")
+
+// parseAuthMethods parses AUTH_METHODS, the comma-separated login methods in
+// the order they are tried. It defaults to password only.
+func parseAuthMethods(value string) ([]string, error) {
+	entries := splitServerEntries(value)
+	if len(entries) == 0 {
+		return []string{authMethodPassword}, nil
+	}
+
+	methods := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		method := strings.ToLower(entry)
+		switch method {
+		case authMethodPassword, authMethodGSSAPI, authMethodPublicKey:
+		default:
+			return nil, fmt.Errorf("unknown auth method %q (valid: %s, %s, %s)", entry, authMethodGSSAPI, authMethodPassword, authMethodPublicKey)
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods, nil
+}
+
+// resolveAuthMethods returns the login method order. Setting only
+// AUTH_KEY_SOURCE tries that key first and falls back to the password.
+func resolveAuthMethods(programOptions *options) ([]string, error) {
+	if strings.TrimSpace(programOptions.AuthMethods) == "" && strings.TrimSpace(programOptions.AuthKeySource) != "" {
+		return []string{authMethodPublicKey, authMethodPassword}, nil
+	}
+	return parseAuthMethods(programOptions.AuthMethods)
+}
+
+// validateAuthMethods checks AUTH_METHODS and AUTH_KEY_SOURCE and that every
+// method can be used by the selected SSH backend.
+func validateAuthMethods(programOptions *options) error {
+	methods, err := resolveAuthMethods(programOptions)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(methods, authMethodGSSAPI) && !programOptions.UseOpenSSH {
+		return fmt.Errorf("auth method gssapi: %w", errNativeGSSAPIUnavailable)
+	}
+	keySource, err := parseAuthKeySource(programOptions.AuthKeySource)
+	if err != nil {
+		return err
+	}
+	if keySource.kind != authKeySourceAgent && !slices.Contains(methods, authMethodPublicKey) {
+		return fmt.Errorf("AUTH_KEY_SOURCE needs %s in AUTH_METHODS", authMethodPublicKey)
+	}
+	return nil
+}
+
+// authMethodOrder returns the validated login method order.
+func authMethodOrder(programOptions *options) []string {
+	methods, err := resolveAuthMethods(programOptions)
+	if err != nil {
+		return []string{authMethodPassword}
+	}
+	return methods
+}
+
+// usesPasswordLogin reports whether the SSH password is needed to log in.
+func usesPasswordLogin(programOptions *options) bool {
+	return !programOptions.UseOpenSSH && slices.Contains(authMethodOrder(programOptions), authMethodPassword)
+}
+
+// loginAuthMethods builds the ssh.AuthMethod list for one host in the
+// configured order; the SSH client falls back to the next method whenever the
+// server rejects one. gssapi has no built-in method: validateAuthMethods
+// only allows it with --use-openssh, where ssh handles it.
+func loginAuthMethods(methods []string, password string) []ssh.AuthMethod {
+	authMethods := make([]ssh.AuthMethod, 0, len(methods))
+	for _, method := range methods {
+		switch method {
+		case authMethodPassword:
+			authMethods = append(authMethods, ssh.Password(password))
+		case authMethodPublicKey:
+			// Hardware-backed keys (PKCS#11, FIDO2) sign inside ssh-agent; the
+			// private key never touches the disk or this process.
+			authMethods = append(authMethods, ssh.PublicKeysCallback(agentSigners))
+		}
+	}
+	return authMethods
+}
+
+// opensshAuthArgs translates an explicit AUTH_METHODS order and a PKCS#11
+// AUTH_KEY_SOURCE into system ssh options; without them, ~/.ssh/config decides.
+func opensshAuthArgs(programOptions *options) []string {
+	var args []string
+	if keySource, err := parseAuthKeySource(programOptions.AuthKeySource); err == nil && keySource.kind == authKeySourcePKCS11 {
+		args = append(args, "-o", "PKCS11Provider="+keySource.module)
+	}
+	if strings.TrimSpace(programOptions.AuthMethods) == "" && strings.TrimSpace(programOptions.AuthKeySource) == "" {
+		return args
+	}
+	methods, err := resolveAuthMethods(programOptions)
+	if err != nil {
+		return args
+	}
+
+	preferred := make([]string, 0, len(methods))
+	for _, method := range methods {
+		switch method {
+		case authMethodGSSAPI:
+			args = append(args, "-o", "GSSAPIAuthentication=yes")
+			preferred = append(preferred, "gssapi-with-mic")
+		case authMethodPassword:
+			preferred = append(preferred, "keyboard-interactive", "password")
+		case authMethodPublicKey:
+			preferred = append(preferred, "publickey")
+		}
+	}
+	return append(args, "-o", "PreferredAuthentications="+strings.Join(preferred, ","))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseAuthMethods(t *testing.T) {
+	methods, err := parseAuthMethods("")
+	if err != nil || !slices.Equal(methods, []string{authMethodPassword}) {
+		t.Fatalf("parseAuthMethods(\"\") = %v, %v; want [password]", methods, err)
+	}
+	methods, err = parseAuthMethods(" GSSAPI, password,gssapi ")
+	if err != nil || !slices.Equal(methods, []string{authMethodGSSAPI, authMethodPassword}) {
+		t.Fatalf("parseAuthMethods() = %v, %v; want [gssapi password]", methods, err)
+	}
+	if _, err := parseAuthMethods("password,kerberos"); err == nil || !strings.Contains(err.Error(), "kerberos") {
+		t.Fatalf("parseAuthMethods(unknown) error = %v", err)
+	}
+}
+
+func TestValidateAuthMethodsRequiresGSSAPIBackend(t *testing.T) {
+	if err := validateAuthMethods(&options{AuthMethods: "gssapi,password"}); !errors.Is(err, errNativeGSSAPIUnavailable) {
+		t.Fatalf("validateAuthMethods() error = %v, want native gssapi unavailable", err)
+	}
+	if err := validateAuthMethods(&options{AuthMethods: "gssapi", UseOpenSSH: true}); err != nil {
+		t.Fatalf("validateAuthMethods(--use-openssh) error = %v", err)
+	}
+}
+
+func TestLoginAuthMethodsLeaveGSSAPIToOpenSSH(t *testing.T) {
+	clientConfig := clientConfigForLogin(&ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()}, // #nosec G106 -- in-memory test server
+		[]string{authMethodGSSAPI, authMethodPassword}, "deploy", "password")
+	if len(clientConfig.Auth) != 1 {
+		t.Fatalf("auth methods = %d, want password only", len(clientConfig.Auth))
+	}
+
+	client, cleanup := newInMemorySSHClient(t, clientConfig, func(string, string) (string, string, uint32) {
+		return "", "", 0
+	})
+	defer cleanup()
+	if client == nil {
+		t.Fatalf("expected a connected client")
+	}
+}
+
+func TestFillMissingPasswordSkipsWhenPasswordIsNotUsed(t *testing.T) {
+	programOptions := &options{AuthMethods: "gssapi"}
+	if err := fillMissingPassword(nil, programOptions); err != nil {
+		t.Fatalf("fillMissingPassword() error = %v", err)
+	}
+	if programOptions.Password != "" {
+		t.Fatalf("password unexpectedly set")
+	}
+}
+
+func TestOpenSSHAuthArgs(t *testing.T) {
+	if args := opensshAuthArgs(&options{}); args != nil {
+		t.Fatalf("opensshAuthArgs(defaults) = %v, want nil", args)
+	}
+	got := strings.Join(opensshAuthArgs(&options{AuthMethods: "gssapi,password"}), " ")
+	want := "-o GSSAPIAuthentication=yes -o PreferredAuthentications=gssapi-with-mic,keyboard-interactive,password"
+	if got != want {
+		t.Fatalf("opensshAuthArgs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// authValidationFirstHost is the --validate-auth value when the flag is given
+// without a host.
+const authValidationFirstHost = "true"
+
+// authValidationFlag is --validate-auth: alone it checks the first target
+// host, --validate-auth=<host> checks that host.
+type authValidationFlag struct {
+	target *string
+}
+
+func (validationFlag authValidationFlag) String() string {
+	if validationFlag.target == nil {
+		return ""
+	}
+	return *validationFlag.target
+}
+
+func (validationFlag authValidationFlag) Set(value string) error {
+	if enabled, err := strconv.ParseBool(value); err == nil && !enabled {
+		*validationFlag.target = ""
+		return nil
+	}
+	*validationFlag.target = strings.TrimSpace(value)
+	return nil
+}
+
+func (authValidationFlag) IsBoolFlag() bool {
+	return true
+}
+
+// selectAuthValidationHost returns the host --validate-auth logs in to, or ""
+// when the check is off. A named host must be one of the target hosts.
+func selectAuthValidationHost(target string, hosts []string, defaultPort int) (string, error) {
+	trimmedTarget := strings.TrimSpace(target)
+	if trimmedTarget == "" || len(hosts) == 0 {
+		return "", nil
+	}
+	if trimmedTarget == authValidationFirstHost {
+		return hosts[0], nil
+	}
+	host, err := normalizeHost(trimmedTarget, defaultPort)
+	if err != nil {
+		return "", fmt.Errorf("invalid --validate-auth host %q: %w", trimmedTarget, err)
+	}
+	if !slices.Contains(hosts, host) {
+		return "", fmt.Errorf("--validate-auth host %s is not one of the target hosts", host)
+	}
+	return host, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSelectAuthValidationHost(t *testing.T) {
+	hosts := []string{"app01:22", "app02:2222"}
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{target: "", want: ""},
+		{target: authValidationFirstHost, want: "app01:22"},
+		{target: "app02:2222", want: "app02:2222"},
+		{target: "app01", want: "app01:22"},
+		{target: "app03", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := selectAuthValidationHost(test.target, hosts, defaultSSHPort)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Fatalf("selectAuthValidationHost(%q) = %q, %v; want %q (error %t)", test.target, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestParseFlagsValidateAuthForms(t *testing.T) {
+	for args, want := range map[string]string{
+		"--validate-auth":       authValidationFirstHost,
+		"--validate-auth=app02": "app02",
+		"--validate-auth=false": "",
+		"--confirm-password":    "",
+	} {
+		setCommandLineForTest(t, []string{"ssh-key-bootstrap", args})
+		programOptions, err := parseFlags()
+		if err != nil {
+			t.Fatalf("parseFlags(%s) error = %v", args, err)
+		}
+		if programOptions.ValidateAuth != want {
+			t.Fatalf("parseFlags(%s) ValidateAuth = %q, want %q", args, programOptions.ValidateAuth, want)
+		}
+	}
+}
+
+func TestRunValidateAuthStopsBeforeOtherHosts(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVERS=app01,app02\nUSER=deploy\nPASSWORD=wrong\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	var dialedHosts []string
+	stubSSHDialHook(t, func(_, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedHosts = append(dialedHosts, address)
+		return nil, errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]")
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--validate-auth=app02"})
+	err := run(capturedRuntimeIO())
+	statusErr, ok := errors.AsType[*statusError](err)
+	if !ok || statusErr.code != exitAuthFailure {
+		t.Fatalf("run() error = %v, want auth failure exit code", err)
+	}
+	if strings.Join(dialedHosts, ",") != "app02:22" {
+		t.Fatalf("dialed hosts = %q, want only app02:22", dialedHosts)
+	}
+	if !strings.Contains(outputBuffer.String(), "TASK [Validate credentials]") {
+		t.Fatalf("output missing validation task: %q", outputBuffer.String())
+	}
+}
+
+func TestOpenSSHExecutorConnectStartsMasterWithoutCommand(t *testing.T) {
+	_, _ = captureWriters(t)
+	invocations := stubOpenSSH(t, func([]string) string { return "" })
+
+	executor, err := newOpenSSHExecutor(&options{TimeoutSec: 5})
+	if err != nil {
+		t.Fatalf("newOpenSSHExecutor() error = %v", err)
+	}
+	defer executor.closeAll()
+	for range 2 {
+		if err := executor.connect("app01:22", "deploy", nil); err != nil {
+			t.Fatalf("connect() error = %v", err)
+		}
+	}
+
+	if len(*invocations) != 1 {
+		t.Fatalf("ssh invocations = %d, want one master start", len(*invocations))
+	}
+	args := (*invocations)[0].args
+	if tail := strings.Join(args[len(args)-6:], " "); tail != "-N -f -l deploy -- app01" {
+		t.Fatalf("connect args end = %q", tail)
+	}
+}
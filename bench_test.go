@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchmarkInventorySize is the size of the inventories the host resolution
+// benchmarks load; large fleets keep server files of this order.
+const benchmarkInventorySize = 50_000
+
+// benchmarkInventory returns size server entries in the shapes real server
+// files mix: names, names with a port, IPv4 and bracketed IPv6 addresses,
+// stray whitespace, and one entry in twenty repeated.
+func benchmarkInventory(size int) []string {
+	entries := make([]string, 0, size)
+	for index := range size {
+		switch {
+		case index%20 == 19:
+			entries = append(entries, entries[index/2])
+		case index%4 == 0:
+			entries = append(entries, fmt.Sprintf("app%05d.example.com", index))
+		case index%4 == 1:
+			entries = append(entries, fmt.Sprintf(" db%05d.example.com:2222 ", index))
+		case index%4 == 2:
+			entries = append(entries, fmt.Sprintf("10.%d.%d.%d", index>>16&0xff, index>>8&0xff, index&0xff))
+		default:
+			entries = append(entries, fmt.Sprintf("[fd00::%x]:22", index))
+		}
+	}
+	return entries
+}
+
+func BenchmarkNormalizeHost(b *testing.B) {
+	for _, rawHost := range []string{"app01.example.com", "db01.example.com:2222", "[fd00::1]:22"} {
+		b.Run(rawHost, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := normalizeHost(rawHost, 22); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkResolveHosts50k(b *testing.B) {
+	servers := strings.Join(benchmarkInventory(benchmarkInventorySize), ",")
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := resolveHosts("", servers, 22); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolveTargetHostsServersFile50k(b *testing.B) {
+	entries := benchmarkInventory(benchmarkInventorySize)
+	programOptions := &options{Port: 22}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, _, err := resolveTargetHosts(programOptions, entries); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestResolveHostEntriesAllocationBudget keeps host resolution at one
+// allocation per entry without a port, plus the result slice. Bare names and
+// IPv4 addresses get the default port appended in a new string; entries
+// already in host:port form, bracketed IPv6 included, are kept as they are
+// and allocate nothing.
+func TestResolveHostEntriesAllocationBudget(t *testing.T) {
+	entries := benchmarkInventory(1_000)
+	withoutPort := 0
+	for _, entry := range entries {
+		if !strings.Contains(entry, ":") {
+			withoutPort++
+		}
+	}
+	allocations := testing.AllocsPerRun(20, func() {
+		if _, err := resolveHostEntries(entries, 22); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if budget := float64(withoutPort + 1); allocations > budget {
+		t.Fatalf("resolveHostEntries made %.0f allocations for %d entries (%d without a port), budget %.0f", allocations, len(entries), withoutPort, budget)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBoundaryConnectTimeout = 30 * time.Second
+
+var errBoundaryExited = errors.New("boundary connect: exited before the session started")
+
+var (
+	lookPathForBoundary   = exec.LookPath
+	boundaryTargetPattern = regexp.MustCompile(`^t[a-z]*_[0-9A-Za-z]+$`)
+)
+
+// boundaryTransport reaches hosts through HashiCorp Boundary. For each
+// connection it runs `boundary connect`, which authorizes a session and
+// opens a local proxy port, then connects to that port. Hosts are target IDs
+// (ttcp_...) or target names; names are looked up in the scope from
+// BOUNDARY_CONNECT_TARGET_SCOPE_ID or BOUNDARY_CONNECT_TARGET_SCOPE_NAME. The
+// SSH port is set on the target, so a port on the host is ignored. The
+// controller and token come from BOUNDARY_ADDR and `boundary authenticate`.
+type boundaryTransport struct{}
+
+// boundaryConnectInfo is the line `boundary connect -format json` prints
+// once the local proxy listens.
+type boundaryConnectInfo struct {
+	Address   string `json:"address"`
+	Port      int    `json:"port"`
+	SessionID string `json:"session_id"`
+}
+
+func (boundaryTransport) Name() string {
+	return "boundary"
+}
+
+func (boundaryTransport) Dial(_, address string, timeout time.Duration) (net.Conn, error) {
+	target, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	boundaryPath, err := lookPathForBoundary("boundary")
+	if err != nil {
+		return nil, errors.New("boundary CLI not found: install it and run boundary authenticate")
+	}
+	targetFlag := "-target-name"
+	if boundaryTargetPattern.MatchString(target) {
+		targetFlag = "-target-id"
+	}
+	if timeout <= 0 {
+		timeout = defaultBoundaryConnectTimeout
+	}
+
+	command := exec.Command(boundaryPath, "connect", targetFlag, target, "-format", "json") // #nosec G204 -- binary is resolved from PATH; arguments are not passed to a shell
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &lockedBuffer{}
+	command.Stderr = stderr
+	command.WaitDelay = helperWaitDelay
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("start boundary connect: %w", err)
+	}
+	stopHelper := func() {
+		_ = command.Process.Kill()
+		_ = command.Wait()
+	}
+
+	info, err := readBoundaryConnectInfo(stdout, timeout)
+	if err != nil {
+		stopHelper()
+		// Error output is complete once the helper has been waited for.
+		if errors.Is(err, errBoundaryExited) {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return nil, fmt.Errorf("boundary connect: %s", message)
+			}
+		}
+		return nil, err
+	}
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(info.Address, strconv.Itoa(info.Port)), timeout)
+	if err != nil {
+		stopHelper()
+		return nil, fmt.Errorf("boundary session %s: %w", info.SessionID, err)
+	}
+	return &helperConn{Conn: connection, stopHelper: stopHelper}, nil
+}
+
+// readBoundaryConnectInfo waits for the proxy address boundary connect
+// prints. Later output is discarded so the helper never blocks on a full pipe.
+func readBoundaryConnectInfo(stdout io.Reader, timeout time.Duration) (boundaryConnectInfo, error) {
+	type result struct {
+		info boundaryConnectInfo
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		reader := bufio.NewReader(stdout)
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) == "" && err != nil {
+			results <- result{err: errBoundaryExited}
+			return
+		}
+		var info boundaryConnectInfo
+		if err := json.Unmarshal([]byte(line), &info); err != nil || info.Address == "" || info.Port == 0 {
+			results <- result{err: fmt.Errorf("boundary connect: unexpected output %q", strings.TrimSpace(line))}
+			return
+		}
+		results <- result{info: info}
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+
+	select {
+	case result := <-results:
+		return result.info, result.err
+	case <-time.After(timeout):
+		return boundaryConnectInfo{}, fmt.Errorf("boundary connect: no session after %s", timeout)
+	}
+}
+
+// helperConn is a connection to a local proxy that lives as long as the
+// helper process serving it.
+type helperConn struct {
+	net.Conn
+	stopHelper func()
+	closing    sync.Once
+}
+
+func (connection *helperConn) Close() error {
+	err := connection.Conn.Close()
+	connection.closing.Do(connection.stopHelper)
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// acceptNewHostKeys trusts keys of hosts missing from known_hosts without the
+// trust prompt, like OpenSSH's StrictHostKeyChecking=accept-new. A changed key
+// is still refused.
+var acceptNewHostKeys atomic.Bool
+
+func configureAcceptNewHostKeys(enabled bool) func() {
+	acceptNewHostKeys.Store(enabled)
+	return func() { acceptNewHostKeys.Store(false) }
+}
+
+// cloudPreset holds the defaults for freshly provisioned images of one cloud
+// provider (--preset).
+type cloudPreset struct {
+	name string
+	// user is the image's default login user; empty means the local user,
+	// as the provider's own CLI does.
+	user          string
+	fallbackUsers []string
+}
+
+var cloudPresets = []cloudPreset{
+	// Amazon Linux, RHEL and SUSE use ec2-user; other AMIs ship a user named
+	// after the distribution.
+	{name: "aws", user: "ec2-user", fallbackUsers: []string{"ubuntu", "admin", "centos", "rocky", "fedora"}},
+	// Compute Engine creates the user from the SSH key metadata, named after
+	// the local user like `gcloud compute ssh`.
+	{name: "gcp"},
+	{name: "azure", user: "azureuser"},
+	{name: "hetzner", user: "root"},
+}
+
+func cloudPresetNames() []string {
+	names := make([]string, 0, len(cloudPresets))
+	for _, preset := range cloudPresets {
+		names = append(names, preset.name)
+	}
+	return names
+}
+
+// applyCloudPreset fills the login user, --fallback-users and
+// --accept-new-host-keys from --preset where neither the command line nor
+// the config set them. Port 22 is the default already.
+func applyCloudPreset(programOptions *options) error {
+	presetName := strings.ToLower(strings.TrimSpace(programOptions.Preset))
+	if presetName == "" {
+		return nil
+	}
+	index := slices.IndexFunc(cloudPresets, func(preset cloudPreset) bool { return preset.name == presetName })
+	if index < 0 {
+		return fmt.Errorf("unknown --preset %q (valid: %s)", programOptions.Preset, strings.Join(cloudPresetNames(), ", "))
+	}
+	preset := cloudPresets[index]
+
+	var applied []string
+	if strings.TrimSpace(programOptions.User) == "" {
+		programOptions.User = preset.user
+		if programOptions.User == "" {
+			programOptions.User = currentLocalUser()
+		}
+		applied = append(applied, "user "+programOptions.User)
+	}
+	if strings.TrimSpace(programOptions.FallbackUsers) == "" && len(preset.fallbackUsers) > 0 {
+		programOptions.FallbackUsers = strings.Join(preset.fallbackUsers, ",")
+		applied = append(applied, "fallback users "+programOptions.FallbackUsers)
+	}
+	// Pinned fingerprints are stricter than accept-new; keep them in charge.
+	if !programOptions.AcceptNewHostKeys && len(programOptions.ExpectFingerprints) == 0 && !programOptions.InsecureIgnoreHostKey {
+		programOptions.AcceptNewHostKeys = true
+		applied = append(applied, "accept new host keys")
+	}
+	if len(applied) == 0 {
+		applied = append(applied, "nothing to change")
+	}
+	outputPrintf("Preset %s: %s.\n", preset.name, strings.Join(applied, ", "))
+	return nil
+}
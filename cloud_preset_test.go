@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestApplyCloudPreset(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubKeyCommentContext(t, "alice", time.Now())
+
+	awsOptions := &options{Preset: "AWS"}
+	if err := applyCloudPreset(awsOptions); err != nil {
+		t.Fatalf("applyCloudPreset(aws) error = %v", err)
+	}
+	if awsOptions.User != "ec2-user" || !strings.HasPrefix(awsOptions.FallbackUsers, "ubuntu,") || !awsOptions.AcceptNewHostKeys {
+		t.Fatalf("aws preset = user %q, fallback %q, accept-new %v", awsOptions.User, awsOptions.FallbackUsers, awsOptions.AcceptNewHostKeys)
+	}
+	if !strings.Contains(outputBuffer.String(), "Preset aws: user ec2-user, fallback users ubuntu,") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+
+	// Settings from the config or command line win over the preset.
+	configured := &options{Preset: "azure", User: "ops", ExpectFingerprints: []string{"app01=SHA256:x"}}
+	if err := applyCloudPreset(configured); err != nil {
+		t.Fatalf("applyCloudPreset(azure) error = %v", err)
+	}
+	if configured.User != "ops" || configured.FallbackUsers != "" || configured.AcceptNewHostKeys {
+		t.Fatalf("azure preset overrode settings: %+v", configured)
+	}
+
+	gcpOptions := &options{Preset: "gcp"}
+	if err := applyCloudPreset(gcpOptions); err != nil || gcpOptions.User != "alice" {
+		t.Fatalf("gcp preset user = %q, %v; want the local user", gcpOptions.User, err)
+	}
+
+	if err := applyCloudPreset(&options{Preset: "openstack"}); err == nil || !strings.Contains(err.Error(), "valid: aws, gcp, azure, hetzner") {
+		t.Fatalf("unknown preset error = %v", err)
+	}
+}
+
+func TestBuildHostKeyCallbackAcceptsNewHostKeysWithoutPrompt(t *testing.T) {
+	captureWriters(t)
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	otherPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+
+	originalPrompter := confirmUnknownHost
+	confirmUnknownHost = func(string, string, ssh.PublicKey) (bool, error) {
+		t.Fatalf("trust prompt shown with --accept-new-host-keys")
+		return false, nil
+	}
+	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
+	defer configureAcceptNewHostKeys(true)()
+
+	hostKeyCallback, err := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
+	if err != nil {
+		t.Fatalf("build host key callback: %v", err)
+	}
+	remoteAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	if err := hostKeyCallback("new.example.com:22", remoteAddress, hostPublicKey); err != nil {
+		t.Fatalf("accept new host: %v", err)
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := hostKeyCallback("new.example.com:22", remoteAddress, otherPublicKey); !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		t.Fatalf("changed host key error = %v, want a known_hosts mismatch", err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func runApplyCommand(programOptions *options, args []string) error {
+	if len(args) != 1 {
+		return fail(2, "apply requires exactly one manifest path argument")
+	}
+	inputReader := newStandardInputReader()
+
+	outputAnsibleTask("Load configuration")
+	if err := applyConfigFiles(programOptions, inputReader); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkFilePermissions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	outputAnsibleTask("Load manifest")
+	manifest, err := loadKeyManifest(args[0])
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	states, err := manifest.desiredStates(programOptions.Port)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	hosts, err := applyHostLimit(desiredStateHosts(states), programOptions.Limit)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	selectedHosts := hostSet(hosts)
+	states = slices.DeleteFunc(states, func(state desiredHostState) bool { return !selectedHosts[state.Host] })
+	message := fmt.Sprintf("%d user(s) across %d host(s)", len(manifest.Users), len(hosts))
+	if manifest.RemoveExtraKeys {
+		message += ", removing extra keys"
+	}
+	outputAnsibleHostStatus("ok", "localhost", message)
+
+	outputAnsibleTask("Validate options")
+	if err := validateOptions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkNoFallbackUsers(programOptions, "apply"); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkDesiredStatesKeyPolicy(programOptions.KeyPolicy, states); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	hostPasswords := map[string]string{}
+	if hasHostPasswordSecretRefs(programOptions) {
+		outputAnsibleTask("Resolve host secrets")
+		hostPasswords, err = resolveHostPasswords(programOptions, hosts, nil)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host password(s) resolved", len(hostPasswords)))
+	}
+
+	outputAnsibleTask("Collect missing inputs")
+	if needsFallbackPassword(hosts, hostPasswords) {
+		if err := fillMissingPassword(inputReader, programOptions); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+	if err := checkSharedPasswordLimit(programOptions, hosts, hostPasswords); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	unlockRun, err := lockRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer unlockRun()
+
+	outputAnsibleTask("Build SSH client configuration")
+	clientConfig, err := buildSSHConfig(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	executor, err := newRemoteExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	inputs := make([]remoteOperationInput, 0, len(states))
+	for _, state := range states {
+		password := programOptions.Password
+		if hostPassword, ok := hostPasswords[state.Host]; ok {
+			password = hostPassword
+		}
+		inputs = append(inputs, remoteOperationInput{
+			Host:            state.Host,
+			User:            state.User,
+			Password:        password,
+			DesiredKeys:     state.Keys,
+			RemoveExtraKeys: manifest.RemoveExtraKeys,
+			CreateHome:      programOptions.CreateHome,
+		})
+	}
+	authMethods := authMethodOrder(programOptions)
+	clientConfigForInput := func(input remoteOperationInput) *ssh.ClientConfig {
+		return clientConfigForLogin(clientConfig, authMethods, input.User, input.Password)
+	}
+	stopStatusLine := startStatusLine(programOptions)
+	defer stopStatusLine()
+	stopRunControl := startRunControl(programOptions)
+	defer stopRunControl()
+	hostRecaps, failedInputs := executeUserOperation(executor, convergeKeysOperation{}, inputs, clientConfigForInput, nil)
+	failures := 0
+	for _, failed := range failedInputs {
+		if failed {
+			failures++
+		}
+	}
+
+	reportFailedHosts(programOptions, "", hosts, hostRecaps, nil)
+	outputAnsiblePlayRecap(hosts, hostRecaps)
+	if failures > 0 {
+		return fail(hostFailureExitCode(hosts, hostRecaps), "%d host/user pair(s) failed to converge", failures)
+	}
+	return nil
+}
+
+func desiredStateHosts(states []desiredHostState) []string {
+	var hosts []string
+	for _, state := range states {
+		if len(hosts) == 0 || hosts[len(hosts)-1] != state.Host {
+			hosts = append(hosts, state.Host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunApplyCommandConvergesEachHostUser(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	key := strings.TrimSpace(generateTestKey(t))
+	manifestPath := writeTestManifest(t, `{
+  "groups": {"web": ["web1", "web2"]},
+  "users": {"deploy": [{"key": "`+key+`", "groups": ["web"]}]}
+}`)
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("PASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+
+	var dialsMu sync.Mutex
+	dialedUsers := map[string]string{}
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialsMu.Lock()
+		dialedUsers[address] = config.User
+		dialsMu.Unlock()
+		if address == "web2:22" {
+			return nil, errors.New("connection refused")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
+			if !strings.Contains(command, "\nEXCLUSIVE=0\n") {
+				return "", "unexpected command", 1
+			}
+			return convergedKeysMarker + " added=1 removed=0\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "apply", "--env", dotEnvPath, manifestPath})
+	err := run(capturedRuntimeIO())
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != exitPartialFailure {
+		t.Fatalf("run(apply) error = %v, want partial failure status", err)
+	}
+	if dialedUsers["web1:22"] != "deploy" || dialedUsers["web2:22"] != "deploy" {
+		t.Fatalf("dialed users = %v", dialedUsers)
+	}
+
+	output := outputBuffer.String()
+	if !strings.Contains(output, "changed: [web1:22] => deploy: 1 key(s) added, 0 removed") {
+		t.Fatalf("apply output missing converged host: %q", output)
+	}
+	if !strings.Contains(output, "failed: [web2:22]") {
+		t.Fatalf("apply output missing failed host: %q", output)
+	}
+}
+
+func TestRunApplyCommandRequiresManifest(t *testing.T) {
+	captureWriters(t)
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "apply"})
+	err := run(capturedRuntimeIO())
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 2 {
+		t.Fatalf("run(apply) error = %v, want status 2", err)
+	}
+}
+
+func TestRunApplyCommandUsesOpenSSH(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	invocations := stubOpenSSH(t, func(args []string) string {
+		if strings.Contains(args[len(args)-1], "EXCLUSIVE=0") {
+			return convergedKeysMarker + " added=1 removed=0\n"
+		}
+		return ""
+	})
+	stubSSHDialHook(t, func(_, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("built-in client dialed %s under --use-openssh", address)
+		return nil, nil
+	})
+
+	key := strings.TrimSpace(generateTestKey(t))
+	manifestPath := writeTestManifest(t, `{
+  "groups": {"web": ["web1"]},
+  "users": {"deploy": [{"key": "`+key+`", "groups": ["web"]}]}
+}`)
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("INSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "apply", "--env", dotEnvPath, "--use-openssh", manifestPath})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(apply --use-openssh) error = %v", err)
+	}
+	if len(*invocations) == 0 {
+		t.Fatalf("system ssh was not used")
+	}
+	if !strings.Contains(outputBuffer.String(), "changed: [web1:22] => deploy: 1 key(s) added, 0 removed") {
+		t.Fatalf("apply output missing converged host: %q", outputBuffer.String())
+	}
+}
+
+func TestRunApplyCommandAllowsGSSAPIOnlyWithOpenSSH(t *testing.T) {
+	captureWriters(t)
+	invocations := stubOpenSSH(t, func(args []string) string {
+		if strings.Contains(args[len(args)-1], "EXCLUSIVE=0") {
+			return convergedKeysMarker + " added=0 removed=0\n"
+		}
+		return ""
+	})
+	stubSSHDialHook(t, func(_, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("built-in client dialed %s with AUTH_METHODS=gssapi", address)
+		return nil, nil
+	})
+
+	key := strings.TrimSpace(generateTestKey(t))
+	manifestPath := writeTestManifest(t, `{
+  "groups": {"web": ["web1"]},
+  "users": {"deploy": [{"key": "`+key+`", "groups": ["web"]}]}
+}`)
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("AUTH_METHODS=gssapi\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "apply", "--env", dotEnvPath, manifestPath})
+	err := run(capturedRuntimeIO())
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 2 || !strings.Contains(err.Error(), errNativeGSSAPIUnavailable.Error()) {
+		t.Fatalf("run(apply) error = %v, want gssapi refused with status 2", err)
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "apply", "--env", dotEnvPath, "--use-openssh", manifestPath})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(apply --use-openssh) error = %v", err)
+	}
+	if len(*invocations) == 0 || !slices.Contains((*invocations)[0].args, "GSSAPIAuthentication=yes") {
+		t.Fatalf("ssh invocations = %v, want GSSAPIAuthentication=yes", *invocations)
+	}
+}
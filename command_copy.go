@@ -0,0 +1,8 @@
+package main
+
+// runCopyCommand pushes one file to every target host with the copy-file
+// operation, using the hosts, credentials and host key policy of a normal
+// run. OPERATIONS from the config is ignored; no key is needed.
+func runCopyCommand(programOptions *options, _ []string) error {
+	return runOperations(programOptions, copyFileOperationName)
+}
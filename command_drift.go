@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// expectedKeyState is the recorded or declared key set for one login user on
+// one host. Exclusive states also flag keys that are not expected.
+type expectedKeyState struct {
+	Host         string
+	User         string
+	Fingerprints []string
+	Exclusive    bool
+}
+
+func runDriftCommand(programOptions *options, args []string) error {
+	if len(args) > 1 {
+		return fail(2, "drift accepts at most one manifest path argument")
+	}
+	inputReader := newStandardInputReader()
+
+	outputAnsibleTask("Load configuration")
+	if err := applyConfigFiles(programOptions, inputReader); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkFilePermissions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	outputAnsibleTask("Load expected state")
+	var expectedStates []expectedKeyState
+	var source string
+	if len(args) == 1 {
+		manifest, err := loadKeyManifest(args[0])
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		desiredStates, err := manifest.desiredStates(programOptions.Port)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		expectedStates, err = expectedStatesFromManifest(desiredStates, manifest.RemoveExtraKeys)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		source = args[0]
+	} else {
+		ledgerPath, err := resolveLedgerPath(programOptions.LedgerFile)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		ledger, err := loadLedger(ledgerPath)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		expectedStates = expectedStatesFromLedger(ledger)
+		source = ledgerPath
+	}
+	hosts, err := applyHostLimit(expectedStateHosts(expectedStates), programOptions.Limit)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	selectedHosts := hostSet(hosts)
+	expectedStates = slices.DeleteFunc(expectedStates, func(state expectedKeyState) bool { return !selectedHosts[state.Host] })
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) from %s", len(hosts), source))
+	if len(expectedStates) == 0 {
+		return nil
+	}
+
+	outputAnsibleTask("Validate options")
+	if err := validateOptions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkNoFallbackUsers(programOptions, "drift"); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	hostPasswords := map[string]string{}
+	if hasHostPasswordSecretRefs(programOptions) {
+		outputAnsibleTask("Resolve host secrets")
+		hostPasswords, err = resolveHostPasswords(programOptions, hosts, nil)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host password(s) resolved", len(hostPasswords)))
+	}
+
+	outputAnsibleTask("Collect missing inputs")
+	if needsFallbackPassword(hosts, hostPasswords) {
+		if err := fillMissingPassword(inputReader, programOptions); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+	if err := checkSharedPasswordLimit(programOptions, hosts, hostPasswords); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	unlockRun, err := lockRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer unlockRun()
+
+	outputAnsibleTask("Build SSH client configuration")
+	clientConfig, err := buildSSHConfig(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	executor, err := newRemoteExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	type loginTarget struct{ host, user string }
+	inputs := make([]remoteOperationInput, 0, len(expectedStates))
+	expectedByTarget := make(map[loginTarget]expectedKeyState, len(expectedStates))
+	for _, expected := range expectedStates {
+		password := programOptions.Password
+		if hostPassword, ok := hostPasswords[expected.Host]; ok {
+			password = hostPassword
+		}
+		inputs = append(inputs, remoteOperationInput{Host: expected.Host, User: expected.User, Password: password})
+		expectedByTarget[loginTarget{host: expected.Host, user: expected.User}] = expected
+	}
+	authMethods := authMethodOrder(programOptions)
+	clientConfigForInput := func(input remoteOperationInput) *ssh.ClientConfig {
+		return clientConfigForLogin(clientConfig, authMethods, input.User, input.Password)
+	}
+	// A drifted host/user pair is reported as changed.
+	compare := func(input remoteOperationInput, result remoteOperationResult) remoteOperationResult {
+		missing, unexpected := compareKeyFingerprints(expectedByTarget[loginTarget{host: input.Host, user: input.User}], authorizedKeyFingerprints(result.Output))
+		if len(missing) == 0 && len(unexpected) == 0 {
+			result.Message = "in sync"
+			return result
+		}
+		result.Changed = true
+		result.Message = describeKeyDrift(missing, unexpected)
+		return result
+	}
+	stopStatusLine := startStatusLine(programOptions)
+	defer stopStatusLine()
+	stopRunControl := startRunControl(programOptions)
+	defer stopRunControl()
+	hostRecaps, failedInputs := executeUserOperation(executor, compareKeysOperation{}, inputs, clientConfigForInput, compare)
+
+	failures := 0
+	for _, failed := range failedInputs {
+		if failed {
+			failures++
+		}
+	}
+	driftedHosts := 0
+	for _, host := range hosts {
+		if hostRecaps[host].changed > 0 {
+			driftedHosts++
+		}
+	}
+
+	reportFailedHosts(programOptions, "", hosts, hostRecaps, nil)
+	outputAnsiblePlayRecap(hosts, hostRecaps)
+	if failures > 0 {
+		return fail(hostFailureExitCode(hosts, hostRecaps), "%d host/user pair(s) could not be checked", failures)
+	}
+	if driftedHosts > 0 {
+		return fail(exitHostFailure, "%d host(s) drifted", driftedHosts)
+	}
+	return nil
+}
+
+// expectedStatesFromLedger expects every currently recorded key to still be
+// present; keys installed by other means are not flagged.
+func expectedStatesFromLedger(ledger *installationLedger) []expectedKeyState {
+	type stateKey struct{ host, user string }
+	states := map[stateKey]*expectedKeyState{}
+	for _, index := range ledger.currentEntryIndexes() {
+		entry := ledger.Entries[index]
+		key := stateKey{host: entry.Host, user: entry.User}
+		if states[key] == nil {
+			states[key] = &expectedKeyState{Host: entry.Host, User: entry.User}
+		}
+		states[key].Fingerprints = append(states[key].Fingerprints, entry.Fingerprint)
+	}
+
+	result := make([]expectedKeyState, 0, len(states))
+	for _, state := range states {
+		sort.Strings(state.Fingerprints)
+		result = append(result, *state)
+	}
+	sortExpectedStates(result)
+	return result
+}
+
+func expectedStatesFromManifest(desiredStates []desiredHostState, exclusive bool) ([]expectedKeyState, error) {
+	result := make([]expectedKeyState, 0, len(desiredStates))
+	for _, desired := range desiredStates {
+		state := expectedKeyState{Host: desired.Host, User: desired.User, Exclusive: exclusive}
+		for _, desiredKey := range desired.Keys {
+			parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(desiredKey))
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key format: %w", err)
+			}
+			state.Fingerprints = append(state.Fingerprints, ssh.FingerprintSHA256(parsedKey))
+		}
+		sort.Strings(state.Fingerprints)
+		result = append(result, state)
+	}
+	sortExpectedStates(result)
+	return result, nil
+}
+
+func sortExpectedStates(states []expectedKeyState) {
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Host != states[j].Host {
+			return states[i].Host < states[j].Host
+		}
+		return states[i].User < states[j].User
+	})
+}
+
+func expectedStateHosts(states []expectedKeyState) []string {
+	var hosts []string
+	for _, state := range states {
+		if len(hosts) == 0 || hosts[len(hosts)-1] != state.Host {
+			hosts = append(hosts, state.Host)
+		}
+	}
+	return hosts
+}
+
+// compareKeysOperation is read-keys shown under the task title of drift.
+type compareKeysOperation struct{ readAuthorizedKeysOperation }
+
+func (compareKeysOperation) Title() string {
+	return "Compare authorized keys"
+}
+
+// compareKeyFingerprints returns expected fingerprints that are absent and,
+// for exclusive states, present fingerprints that are not expected.
+func compareKeyFingerprints(expected expectedKeyState, actualFingerprints []string) ([]string, []string) {
+	actualSet := make(map[string]bool, len(actualFingerprints))
+	for _, fingerprint := range actualFingerprints {
+		actualSet[fingerprint] = true
+	}
+	expectedSet := make(map[string]bool, len(expected.Fingerprints))
+	var missing []string
+	for _, fingerprint := range expected.Fingerprints {
+		expectedSet[fingerprint] = true
+		if !actualSet[fingerprint] {
+			missing = append(missing, fingerprint)
+		}
+	}
+
+	var unexpected []string
+	if expected.Exclusive {
+		for _, fingerprint := range actualFingerprints {
+			if !expectedSet[fingerprint] {
+				unexpected = append(unexpected, fingerprint)
+			}
+		}
+	}
+	return missing, unexpected
+}
+
+func describeKeyDrift(missing, unexpected []string) string {
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		parts = append(parts, "unexpected "+strings.Join(unexpected, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAuthorizedKeyFingerprintsSkipsCommentsAndInvalidLines(t *testing.T) {
+	key := strings.TrimSpace(generateTestKey(t))
+	listing := "# managed\n\r\nnot a key\nno-pty " + key + " laptop\n" + key + "\n"
+
+	fingerprints := authorizedKeyFingerprints(listing)
+	want := ssh.FingerprintSHA256(parsePublicKeyFromAuthorizedLine(t, key))
+	if len(fingerprints) != 1 || fingerprints[0] != want {
+		t.Fatalf("fingerprints = %v, want [%s]", fingerprints, want)
+	}
+}
+
+func TestCompareKeyFingerprints(t *testing.T) {
+	expected := expectedKeyState{Fingerprints: []string{"SHA256:a", "SHA256:b"}}
+	actual := []string{"SHA256:b", "SHA256:c"}
+
+	missing, unexpected := compareKeyFingerprints(expected, actual)
+	if strings.Join(missing, ",") != "SHA256:a" || len(unexpected) != 0 {
+		t.Fatalf("non-exclusive diff = %v / %v", missing, unexpected)
+	}
+
+	expected.Exclusive = true
+	missing, unexpected = compareKeyFingerprints(expected, actual)
+	if strings.Join(missing, ",") != "SHA256:a" || strings.Join(unexpected, ",") != "SHA256:c" {
+		t.Fatalf("exclusive diff = %v / %v", missing, unexpected)
+	}
+}
+
+func TestRunDriftCommandReportsKeysRemovedOutOfBand(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	presentKey := strings.TrimSpace(generateTestKey(t))
+	removedKey := strings.TrimSpace(generateTestKey(t))
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	var entries []ledgerEntry
+	for _, seed := range []struct{ host, key string }{{"web1:22", presentKey}, {"web2:22", presentKey}, {"web2:22", removedKey}} {
+		entry, err := newLedgerEntry("run-1", seed.host, "deploy", seed.key, "")
+		if err != nil {
+			t.Fatalf("newLedgerEntry() error = %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := saveLedger(ledgerPath, &installationLedger{Entries: entries}); err != nil {
+		t.Fatalf("seed ledger: %v", err)
+	}
+
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("PASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			return authorizedKeysListingMarker + "\n" + presentKey + " deploy@laptop\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "drift", "--env", dotEnvPath, "--ledger", ledgerPath})
+	err := run(capturedRuntimeIO())
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 1 || !strings.Contains(err.Error(), "1 host(s) drifted") {
+		t.Fatalf("run(drift) error = %v, want one drifted host", err)
+	}
+	output := outputBuffer.String()
+	if !strings.Contains(output, "ok: [web1:22] => deploy: in sync") {
+		t.Fatalf("drift output missing in-sync host: %q", output)
+	}
+	if !strings.Contains(output, "changed: [web2:22] => deploy: missing "+entries[2].Fingerprint) {
+		t.Fatalf("drift output missing drifted host: %q", output)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+// runExecCommand runs --cmd on every target host with the run-command
+// operation, using the hosts, credentials, pacing and recap of a normal run.
+// OPERATIONS from the config is ignored; no key is needed.
+func runExecCommand(programOptions *options, _ []string) error {
+	return runOperations(programOptions, runCommandOperationName)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func runExpireCommand(programOptions *options, _ []string) error {
+	inputReader := newStandardInputReader()
+
+	outputAnsibleTask("Load configuration")
+	if err := applyConfigFiles(programOptions, inputReader); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkFilePermissions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	outputAnsibleTask("Load ledger")
+	ledgerPath, err := resolveLedgerPath(programOptions.LedgerFile)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	limit, err := parseHostLimit(programOptions.Limit)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	now := ledgerNow()
+	var expiredIndexes []int
+	for _, index := range ledger.currentEntryIndexes() {
+		if ledger.Entries[index].isExpired(now) && limit.allows(ledger.Entries[index].Host) {
+			expiredIndexes = append(expiredIndexes, index)
+		}
+	}
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d expired key(s) in %s", len(expiredIndexes), ledgerPath))
+	if len(expiredIndexes) == 0 {
+		return nil
+	}
+
+	outputAnsibleTask("Validate options")
+	if err := validateOptions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := checkNoFallbackUsers(programOptions, "expire"); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	outputAnsibleTask("Collect missing inputs")
+	if err := fillMissingCredentials(inputReader, programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	unlockRun, err := lockRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer unlockRun()
+
+	outputAnsibleTask("Build SSH client configuration")
+	clientConfig, err := buildSSHConfig(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	executor, err := newRemoteExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	// One removal per host and login user covers all of its expired keys.
+	type loginTarget struct{ host, user string }
+	var hosts []string
+	seenHosts := map[string]struct{}{}
+	var inputs []remoteOperationInput
+	var inputEntries [][]int
+	inputIndexes := map[loginTarget]int{}
+	for _, index := range expiredIndexes {
+		entry := ledger.Entries[index]
+		userName := clientConfig.User
+		if entry.User != "" {
+			userName = entry.User
+		}
+		target := loginTarget{host: entry.Host, user: userName}
+		inputIndex, seen := inputIndexes[target]
+		if !seen {
+			if _, seenHost := seenHosts[entry.Host]; !seenHost {
+				seenHosts[entry.Host] = struct{}{}
+				hosts = append(hosts, entry.Host)
+			}
+			inputIndex = len(inputs)
+			inputIndexes[target] = inputIndex
+			inputs = append(inputs, remoteOperationInput{Host: entry.Host, User: userName, PublicKey: entry.PublicKey})
+			inputEntries = append(inputEntries, nil)
+		} else {
+			inputs[inputIndex].ExtraPublicKeys = append(inputs[inputIndex].ExtraPublicKeys, entry.PublicKey)
+		}
+		inputEntries[inputIndex] = append(inputEntries[inputIndex], index)
+	}
+
+	authMethods := authMethodOrder(programOptions)
+	clientConfigForInput := func(input remoteOperationInput) *ssh.ClientConfig {
+		return clientConfigForLogin(clientConfig, authMethods, input.User, programOptions.Password)
+	}
+	stopStatusLine := startStatusLine(programOptions)
+	defer stopStatusLine()
+	stopRunControl := startRunControl(programOptions)
+	defer stopRunControl()
+	hostRecaps, failedInputs := executeUserOperation(executor, expireKeysOperation{}, inputs, clientConfigForInput, nil)
+
+	failures := 0
+	removedAt := now.UTC().Format(time.RFC3339)
+	for inputIndex, entryIndexes := range inputEntries {
+		if failedInputs[inputIndex] {
+			failures += len(entryIndexes)
+			continue
+		}
+		for _, index := range entryIndexes {
+			ledger.markRemoved(ledger.Entries[index].identity(), removedAt)
+		}
+	}
+
+	reportFailedHosts(programOptions, "", hosts, hostRecaps, nil)
+	if err := saveLedger(ledgerPath, ledger); err != nil {
+		outputAnsiblePlayRecap(hosts, hostRecaps)
+		return fail(exitHostFailure, "update ledger: %w", err)
+	}
+
+	outputAnsiblePlayRecap(hosts, hostRecaps)
+	if failures > 0 {
+		return fail(hostFailureExitCode(hosts, hostRecaps), "%d expired key(s) could not be removed", failures)
+	}
+	return nil
+}
+
+// expireKeysOperation is remove-key shown under the task title of expire.
+type expireKeysOperation struct{ removeKeyOperation }
+
+func (expireKeysOperation) Title() string {
+	return "Remove expired keys"
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunExpireCommandRemovesExpiredKeys(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubLedgerNow(t, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+
+	expiredKey := strings.TrimSpace(generateTestKey(t))
+	activeKey := strings.TrimSpace(generateTestKey(t))
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	if err := saveLedger(ledgerPath, &installationLedger{Entries: []ledgerEntry{
+		{Host: "in-memory:22", User: "ops", Fingerprint: "SHA256:expired", PublicKey: expiredKey, ExpiresAt: "2025-12-31"},
+		{Host: "in-memory:22", User: "ops", Fingerprint: "SHA256:active", PublicKey: activeKey, ExpiresAt: "2026-12-31"},
+	}}); err != nil {
+		t.Fatalf("seed ledger: %v", err)
+	}
+
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("USER=deploy\nPASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	var dialedUser, capturedStdin string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedUser = config.User
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
+			capturedStdin = stdin
+			return authorizedKeyRemovedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "expire", "--env", dotEnvPath, "--ledger", ledgerPath})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(expire) error = %v", err)
+	}
+
+	if dialedUser != "ops" {
+		t.Fatalf("dialed as %q, want ledger user %q", dialedUser, "ops")
+	}
+	if capturedStdin != strings.Fields(expiredKey)[1]+"\n" {
+		t.Fatalf("stdin = %q, want expired key blob", capturedStdin)
+	}
+
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil {
+		t.Fatalf("loadLedger() error = %v", err)
+	}
+	if ledger.Entries[0].RemovedAt == "" {
+		t.Fatalf("expired entry was not marked removed: %+v", ledger.Entries[0])
+	}
+	if ledger.Entries[1].RemovedAt != "" {
+		t.Fatalf("active entry was marked removed: %+v", ledger.Entries[1])
+	}
+	if !strings.Contains(outputBuffer.String(), "TASK [Remove expired keys]") {
+		t.Fatalf("output missing removal task: %q", outputBuffer.String())
+	}
+}
+
+func TestExtractSubcommand(t *testing.T) {
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "expire", "--env", "x.env"})
+
+	command, ok := extractSubcommand()
+	if !ok || command.name != "expire" {
+		t.Fatalf("extractSubcommand() = %v, %v; want expire", command.name, ok)
+	}
+	if strings.Join(os.Args, " ") != "ssh-key-bootstrap --env x.env" {
+		t.Fatalf("os.Args = %v, want subcommand removed", os.Args)
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", "x.env"})
+	if _, ok := extractSubcommand(); ok {
+		t.Fatalf("flags must not be treated as a subcommand")
+	}
+}
+
+func TestRunExpireCommandLogsInAsEachLedgerUser(t *testing.T) {
+	captureWriters(t)
+	stubLedgerNow(t, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+
+	opsKeys := []string{strings.TrimSpace(generateTestKey(t)), strings.TrimSpace(generateTestKey(t))}
+	rootKey := strings.TrimSpace(generateTestKey(t))
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	if err := saveLedger(ledgerPath, &installationLedger{Entries: []ledgerEntry{
+		{Host: "in-memory:22", User: "ops", Fingerprint: "SHA256:ops1", PublicKey: opsKeys[0], ExpiresAt: "2025-12-31"},
+		{Host: "in-memory:22", User: "root", Fingerprint: "SHA256:root", PublicKey: rootKey, ExpiresAt: "2025-12-31"},
+		{Host: "in-memory:22", User: "ops", Fingerprint: "SHA256:ops2", PublicKey: opsKeys[1], ExpiresAt: "2025-12-31"},
+	}}); err != nil {
+		t.Fatalf("seed ledger: %v", err)
+	}
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("USER=deploy\nPASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	var dialedUsers, removedBlobs []string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedUsers = append(dialedUsers, config.User)
+		client, cleanupClient := newInMemorySSHClient(t, config, func(_, stdin string) (string, string, uint32) {
+			removedBlobs = append(removedBlobs, stdin)
+			return authorizedKeyRemovedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "expire", "--env", dotEnvPath, "--ledger", ledgerPath})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(expire) error = %v", err)
+	}
+
+	if strings.Join(dialedUsers, ",") != "ops,root" {
+		t.Fatalf("dialed as %v, want one login per ledger user", dialedUsers)
+	}
+	if len(removedBlobs) != 2 || removedBlobs[0] != strings.Fields(opsKeys[0])[1]+"\n" {
+		t.Fatalf("removal stdin = %q, want one removal session per user", removedBlobs)
+	}
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil {
+		t.Fatalf("loadLedger() error = %v", err)
+	}
+	for _, entry := range ledger.Entries {
+		if entry.RemovedAt == "" {
+			t.Fatalf("entry %s was not marked removed", entry.Fingerprint)
+		}
+	}
+}
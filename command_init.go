@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/messages"
+	"ssh-key-bootstrap/providers"
+)
+
+const (
+	defaultInitConfigPath = ".env"
+	initPasswordPrompt    = "prompt"
+	initPasswordStore     = "store"
+	initHostKeyKnownHosts = "known-hosts"
+	initHostKeyInsecure   = "insecure"
+	initEncryptNone       = "none"
+	initEncryptPassphrase = "passphrase"
+	initEncryptAge        = "age"
+)
+
+// initEncryption selects how init stores the file: a passphrase, an age
+// recipient, or neither (plaintext).
+type initEncryption struct {
+	passphrase   string
+	ageRecipient string
+}
+
+func (encryption initEncryption) enabled() bool {
+	return encryption.passphrase != "" || encryption.ageRecipient != ""
+}
+
+func runInitCommand(programOptions *options, args []string) error {
+	if len(args) > 1 {
+		return fail(2, "init accepts at most one output path argument")
+	}
+	configPath := defaultInitConfigPath
+	if context := strings.TrimSpace(programOptions.Context); context != "" {
+		if len(args) == 1 {
+			return fail(2, "init writes the config of --context %s itself; drop the path argument", context)
+		}
+		contextDir, err := appconfig.ContextDir(context)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		if err := os.MkdirAll(contextDir, 0o700); err != nil {
+			return fail(2, "create context directory: %w", err)
+		}
+		configPath = filepath.Join(contextDir, defaultInitConfigPath)
+	}
+	if len(args) == 1 {
+		configPath = args[0]
+	}
+	return runInitWizard(newStandardInputReader(), configPath)
+}
+
+// runInitWizard asks for the settings a first run needs and writes them to
+// configPath as .env, or as JSON when the path ends in .json. The file is
+// loaded back through the regular config loader before it replaces anything.
+func runInitWizard(inputReader *bufio.Reader, configPath string) error {
+	configPath, err := expandHomePath(strings.TrimSpace(configPath))
+	if err != nil {
+		return fail(2, "resolve config path: %w", err)
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		overwrite, err := promptInitChoice(inputReader, fmt.Sprintf("%s already exists. Overwrite? [y/n]: ", configPath), []string{"y", "n"}, "")
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		if overwrite != "y" {
+			return fail(2, "init cancelled; %s left unchanged", configPath)
+		}
+	}
+
+	answers, encryption, err := collectInitAnswers(inputReader)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+
+	outputAnsibleTask("Write configuration")
+	if err := writeInitConfig(configPath, answers, encryption); err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("changed", "localhost", configPath)
+
+	configFlag := "--env"
+	if isJSONConfigPath(configPath) {
+		configFlag = "--config"
+	}
+	switch {
+	case encryption.ageRecipient != "":
+		outputPrintf("Next: %s %s %s --age-identity <identity file> --plan\n", appName, configFlag, configPath)
+	case encryption.passphrase != "":
+		outputPrintf("Next: %s %s %s --plan (asks for the passphrase, or set %s)\n", appName, configFlag, configPath, configPassphraseEnv)
+	default:
+		outputPrintf("Next: %s %s %s --plan\n", appName, configFlag, configPath)
+	}
+	return nil
+}
+
+func collectInitAnswers(inputReader *bufio.Reader) (*options, initEncryption, error) {
+	answers := &options{}
+
+	outputAnsibleTask("Target hosts")
+	for {
+		servers, err := promptRequired(inputReader, messages.Get(messages.PromptServers))
+		if err != nil {
+			return nil, initEncryption{}, wrapMissingInputError("Servers", err)
+		}
+		if _, err := resolveHosts("", servers, defaultSSHPort); err != nil {
+			outputPrintf("Invalid servers: %v\n", err)
+			continue
+		}
+		answers.Servers = servers
+		break
+	}
+
+	var err error
+	answers.User, err = promptRequired(inputReader, messages.Get(messages.PromptSSHUsername))
+	if err != nil {
+		return nil, initEncryption{}, wrapMissingInputError("SSH username", err)
+	}
+
+	outputAnsibleTask("Public key")
+	for {
+		keyInput, err := promptRequired(inputReader, messages.Get(messages.PromptPublicKey))
+		if err != nil {
+			return nil, initEncryption{}, wrapMissingInputError("Public key", err)
+		}
+		if _, err := resolvePublicKey(keyInput); err != nil {
+			outputPrintf("Invalid public key: %v\n", err)
+			continue
+		}
+		answers.KeyInput = keyInput
+		break
+	}
+
+	outputAnsibleTask("Password source")
+	passwordSources := append([]string{initPasswordPrompt, initPasswordStore}, providers.ProviderNames(providers.DefaultProviders())...)
+	passwordSource, err := promptInitChoice(inputReader,
+		messages.Get(messages.PromptPasswordSource, strings.Join(passwordSources, "/"), initPasswordPrompt),
+		passwordSources, initPasswordPrompt)
+	if err != nil {
+		return nil, initEncryption{}, wrapMissingInputError("Password source", err)
+	}
+	switch passwordSource {
+	case initPasswordPrompt:
+	case initPasswordStore:
+		outputPrintln("The password is only stored in an encrypted file.")
+		answers.Password, err = promptPassword(inputReader, standardInputFile(), messages.Get(messages.PromptStoredSSHPassword))
+		if err != nil {
+			return nil, initEncryption{}, wrapMissingInputError("SSH password", err)
+		}
+	default:
+		answers.PasswordProvider = passwordSource
+		if !strings.EqualFold(passwordSource, "local") {
+			answers.PasswordSecretRef, err = promptRequired(inputReader, messages.Get(messages.PromptPasswordSecretRef))
+			if err != nil {
+				return nil, initEncryption{}, wrapMissingInputError("Password secret reference", err)
+			}
+		}
+	}
+
+	outputAnsibleTask("Host key policy")
+	hostKeyPolicy, err := promptInitChoice(inputReader,
+		messages.Get(messages.PromptHostKeyPolicy, initHostKeyKnownHosts, initHostKeyInsecure, initHostKeyKnownHosts),
+		[]string{initHostKeyKnownHosts, initHostKeyInsecure}, initHostKeyKnownHosts)
+	if err != nil {
+		return nil, initEncryption{}, wrapMissingInputError("Host key policy", err)
+	}
+	if hostKeyPolicy == initHostKeyInsecure {
+		outputPrintln("Warning: host keys will not be verified (MITM risk). Use only in lab environments.")
+		answers.InsecureIgnoreHostKey = true
+	} else {
+		knownHostsPath, err := promptLine(inputReader, messages.Get(messages.PromptKnownHostsPath, defaultKnownHostsPath))
+		if err != nil {
+			return nil, initEncryption{}, wrapMissingInputError("known_hosts path", err)
+		}
+		if knownHostsPath != "" && knownHostsPath != defaultKnownHostsPath {
+			answers.KnownHosts = knownHostsPath
+		}
+	}
+
+	encryption, err := collectInitEncryption(inputReader, answers.Password != "")
+	if err != nil {
+		return nil, initEncryption{}, err
+	}
+	return answers, encryption, nil
+}
+
+// collectInitEncryption asks how to protect the file. A stored password
+// always requires encryption.
+func collectInitEncryption(inputReader *bufio.Reader, storesPassword bool) (initEncryption, error) {
+	outputAnsibleTask("File encryption")
+	choices := []string{initEncryptNone, initEncryptPassphrase, initEncryptAge}
+	defaultChoice := initEncryptNone
+	if storesPassword {
+		choices = choices[1:]
+		defaultChoice = initEncryptPassphrase
+	}
+	method, err := promptInitChoice(inputReader,
+		messages.Get(messages.PromptEncryptFile, strings.Join(choices, "/"), defaultChoice),
+		choices, defaultChoice)
+	if err != nil {
+		return initEncryption{}, wrapMissingInputError("File encryption", err)
+	}
+
+	switch method {
+	case initEncryptPassphrase:
+		for {
+			passphrase, err := promptPassword(inputReader, standardInputFile(), messages.Get(messages.PromptPassphrase))
+			if err != nil {
+				return initEncryption{}, wrapMissingInputError("Passphrase", err)
+			}
+			confirmation, err := promptPassword(inputReader, standardInputFile(), messages.Get(messages.PromptRepeatPassphrase))
+			if err != nil {
+				return initEncryption{}, wrapMissingInputError("Passphrase", err)
+			}
+			if passphrase == confirmation {
+				return initEncryption{passphrase: passphrase}, nil
+			}
+			outputPrintln(messages.Get(messages.PassphrasesMismatch))
+		}
+	case initEncryptAge:
+		recipient, err := promptRequired(inputReader, messages.Get(messages.PromptAgeRecipient))
+		if err != nil {
+			return initEncryption{}, wrapMissingInputError("age recipient", err)
+		}
+		return initEncryption{ageRecipient: recipient}, nil
+	}
+	return initEncryption{}, nil
+}
+
+// promptInitChoice reads one of choices (case-insensitive). An empty answer
+// selects defaultChoice when one is given.
+func promptInitChoice(inputReader *bufio.Reader, label string, choices []string, defaultChoice string) (string, error) {
+	for {
+		answer, err := promptLine(inputReader, label)
+		if err != nil {
+			return "", err
+		}
+		answer = strings.ToLower(answer)
+		if answer == "" && defaultChoice != "" {
+			return defaultChoice, nil
+		}
+		if slices.Contains(choices, answer) {
+			return answer, nil
+		}
+		outputPrintf("Please answer with one of: %s.\n", strings.Join(choices, ", "))
+	}
+}
+
+// writeInitConfig renders (and optionally encrypts) answers, checks that the
+// written file loads back to the same settings, and only then moves it into
+// place with mode 0600. Plaintext never reaches disk when encrypting.
+func writeInitConfig(configPath string, answers *options, encryption initEncryption) error {
+	var content []byte
+	if isJSONConfigPath(configPath) {
+		var err error
+		if content, err = appconfig.RenderJSON(answers); err != nil {
+			return fmt.Errorf("render config: %w", err)
+		}
+	} else {
+		content = []byte(appconfig.RenderDotEnv(answers))
+	}
+	plaintext := content
+	if encryption.enabled() {
+		var err error
+		if content, err = encryptConfigContent(plaintext, encryption.passphrase, encryption.ageRecipient); err != nil {
+			return fmt.Errorf("encrypt config: %w", err)
+		}
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(configPath), filepath.Base(configPath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create config file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+	if _, err := tempFile.Write(content); err != nil {
+		_ = tempFile.Close()
+		return fmt.Errorf("write config file: %w", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	// Load the file back with the answers already at hand instead of asking
+	// for the passphrase again; age output cannot be opened without the
+	// identity, so its plaintext is checked instead.
+	previousDecryptFile := appconfig.DecryptFile
+	appconfig.DecryptFile = func(_ string, fileContent []byte) ([]byte, error) {
+		if encryption.passphrase != "" {
+			return appconfig.DecryptWithPassphrase(fileContent, encryption.passphrase)
+		}
+		return plaintext, nil
+	}
+	defer func() { appconfig.DecryptFile = previousDecryptFile }()
+	if err := verifyInitConfig(tempPath, isJSONConfigPath(configPath), answers); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, configPath); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+	return nil
+}
+
+func verifyInitConfig(path string, isJSON bool, answers *options) error {
+	loaded := &options{}
+	var err error
+	if isJSON {
+		loaded.ConfigFile = path
+		_, err = appconfig.ApplyJSONWithMetadata(loaded)
+	} else {
+		loaded.EnvFile = path
+		_, err = appconfig.ApplyDotEnvWithMetadata(loaded)
+	}
+	if err != nil {
+		return fmt.Errorf("validate generated config: %w", err)
+	}
+	if loaded.Servers != answers.Servers || loaded.User != answers.User || loaded.Password != answers.Password || loaded.KeyInput != answers.KeyInput ||
+		loaded.PasswordProvider != answers.PasswordProvider || loaded.PasswordSecretRef != answers.PasswordSecretRef ||
+		loaded.KnownHosts != answers.KnownHosts || loaded.InsecureIgnoreHostKey != answers.InsecureIgnoreHostKey {
+		return errors.New("validate generated config: settings did not load back unchanged")
+	}
+	return nil
+}
+
+func isJSONConfigPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+func TestRunInitWizardWritesDotEnv(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	key := strings.TrimSpace(generateTestKey(t))
+	configPath := filepath.Join(t.TempDir(), ".env")
+
+	answers := strings.Join([]string{
+		"app01:99999", // rejected, asked again
+		"app01,app02:2222",
+		"deploy",
+		"not-a-key", // rejected, asked again
+		key,
+		"", // password source: prompt at run time
+		"", // host key policy: known-hosts
+		"~/.ssh/lab_known_hosts",
+		"", // encryption: none
+	}, "\n") + "\n"
+	if err := runInitWizard(bufio.NewReader(strings.NewReader(answers)), configPath); err != nil {
+		t.Fatalf("runInitWizard() error = %v\noutput: %s", err, outputBuffer.String())
+	}
+
+	fileInfo, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatalf("stat config: %v", err)
+	}
+	if fileInfo.Mode().Perm() != 0o600 {
+		t.Fatalf("config mode = %v, want 0600", fileInfo.Mode().Perm())
+	}
+	loaded := &options{EnvFile: configPath}
+	if _, err := appconfig.ApplyDotEnvWithMetadata(loaded); err != nil {
+		t.Fatalf("load written config: %v", err)
+	}
+	if loaded.Servers != "app01,app02:2222" || loaded.User != "deploy" || loaded.KeyInput != key || loaded.KnownHosts != "~/.ssh/lab_known_hosts" {
+		t.Fatalf("written config = %+v", loaded)
+	}
+	if loaded.PasswordProvider != "" || loaded.InsecureIgnoreHostKey {
+		t.Fatalf("written config set unexpected settings: %+v", loaded)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "Invalid servers") || !strings.Contains(output, "Invalid public key") || !strings.Contains(output, "--env "+configPath) {
+		t.Fatalf("init output missing retries or next step: %q", output)
+	}
+}
+
+func TestRunInitWizardWritesJSONWithInsecureHostKeys(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	key := strings.TrimSpace(generateTestKey(t))
+	configPath := filepath.Join(t.TempDir(), "bootstrap.json")
+
+	answers := strings.Join([]string{"app01", "deploy", key, "prompt", "insecure", "none"}, "\n") + "\n"
+	if err := runInitWizard(bufio.NewReader(strings.NewReader(answers)), configPath); err != nil {
+		t.Fatalf("runInitWizard() error = %v", err)
+	}
+
+	loaded := &options{ConfigFile: configPath}
+	if _, err := appconfig.ApplyJSONWithMetadata(loaded); err != nil {
+		t.Fatalf("load written config: %v", err)
+	}
+	if loaded.Servers != "app01" || !loaded.InsecureIgnoreHostKey || loaded.KnownHosts != "" {
+		t.Fatalf("written config = %+v", loaded)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "MITM") || !strings.Contains(output, "--config "+configPath) {
+		t.Fatalf("init output missing warning or next step: %q", output)
+	}
+}
+
+func TestRunInitWizardKeepsExistingFileWhenDeclined(t *testing.T) {
+	captureWriters(t)
+	configPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(configPath, []byte("USER=keep\n"), 0o600); err != nil {
+		t.Fatalf("seed config: %v", err)
+	}
+
+	err := runInitWizard(bufio.NewReader(strings.NewReader("n\n")), configPath)
+	if err == nil || !strings.Contains(err.Error(), "left unchanged") {
+		t.Fatalf("runInitWizard() error = %v, want cancellation", err)
+	}
+	content, readErr := os.ReadFile(configPath)
+	if readErr != nil || string(content) != "USER=keep\n" {
+		t.Fatalf("existing config changed: %q (%v)", content, readErr)
+	}
+}
+
+func TestRunInitWizardStoresPasswordEncrypted(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	key := strings.TrimSpace(generateTestKey(t))
+	configPath := filepath.Join(t.TempDir(), ".env")
+
+	answers := strings.Join([]string{
+		"app01", "deploy", key,
+		"store", "s3cret pass",
+		"", "",
+		"none",                 // rejected: a stored password must be encrypted
+		"",                     // default: passphrase
+		"pass-one", "pass-two", // mismatch, asked again
+		"pass-one", "pass-one",
+	}, "\n") + "\n"
+	if err := runInitWizard(bufio.NewReader(strings.NewReader(answers)), configPath); err != nil {
+		t.Fatalf("runInitWizard() error = %v\noutput: %s", err, outputBuffer.String())
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if !appconfig.IsEncrypted(content) || strings.Contains(string(content), "s3cret") {
+		t.Fatalf("stored config is not encrypted: %q", content)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "Passphrases do not match") || !strings.Contains(output, configPassphraseEnv) {
+		t.Fatalf("init output missing mismatch notice or passphrase hint: %q", output)
+	}
+
+	t.Setenv(configPassphraseEnv, "pass-one")
+	restore := configureConfigDecryption("")
+	defer restore()
+	loaded := &options{EnvFile: configPath}
+	if _, err := appconfig.ApplyDotEnvWithMetadata(loaded); err != nil {
+		t.Fatalf("load encrypted config: %v", err)
+	}
+	if loaded.Password != "s3cret pass" || loaded.User != "deploy" {
+		t.Fatalf("decrypted config = %+v", loaded)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	serviceModeCheck       = "check"
+	serviceModeApply       = "apply"
+	defaultServiceSchedule = "daily"
+)
+
+// cronScheduleShorthands are the systemd calendar shorthands that cron has a
+// matching @ form for.
+var cronScheduleShorthands = map[string]string{
+	"hourly":  "@hourly",
+	"daily":   "@daily",
+	"weekly":  "@weekly",
+	"monthly": "@monthly",
+	"yearly":  "@yearly",
+}
+
+// scheduledService is one scheduled run: the unit name and the command line
+// it starts.
+type scheduledService struct {
+	name        string
+	description string
+	command     []string
+	schedule    string
+}
+
+func runInstallServiceCommand(programOptions *options, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fail(2, "install-service takes a mode (check or apply) and a manifest path for apply")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fail(2, "resolve executable path: %w", err)
+	}
+	service, err := buildScheduledService(programOptions, executable, args[0], args[1:])
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+
+	if programOptions.ServiceCron {
+		entry, err := cronEntry(service)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		// Only the entry goes to stdout, so it can be appended to a crontab.
+		outputPrintln(entry)
+		return nil
+	}
+
+	outputAnsibleTask("Write systemd units")
+	serviceDir, userUnits, err := systemdUnitDir(programOptions.ServiceDir)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := os.MkdirAll(serviceDir, 0o755); err != nil { // #nosec G301 -- systemd unit directories are world-readable
+		return fail(2, "create unit directory: %w", err)
+	}
+	units := []struct {
+		filename string
+		content  string
+	}{
+		{service.name + ".service", systemdServiceUnit(service)},
+		{service.name + ".timer", systemdTimerUnit(service)},
+	}
+	for _, unit := range units {
+		path := filepath.Join(serviceDir, unit.filename)
+		changed, err := writeUnitFile(path, unit.content)
+		if err != nil {
+			outputAnsibleHostStatus("failed", "localhost", err.Error())
+			return fail(2, "%w", err)
+		}
+		status := "ok"
+		if changed {
+			status = "changed"
+		}
+		outputAnsibleHostStatus(status, "localhost", path)
+	}
+
+	systemctl := "systemctl"
+	if userUnits {
+		systemctl += " --user"
+	}
+	outputPrintf("Enable with: %s daemon-reload && %s enable --now %s.timer\n", systemctl, systemctl, service.name)
+	return nil
+}
+
+// buildScheduledService turns the install-service arguments and the config
+// flags of this invocation into the command a timer runs. Paths are made
+// absolute, since the service does not start in the current directory, and
+// a config source is required because a scheduled run cannot answer prompts.
+func buildScheduledService(programOptions *options, executable, mode string, manifestArgs []string) (scheduledService, error) {
+	service := scheduledService{name: appName + "-" + strings.TrimSpace(mode)}
+	var command []string
+	switch strings.TrimSpace(mode) {
+	case serviceModeCheck:
+		command = []string{"drift"}
+		service.description = "authorized_keys drift check"
+	case serviceModeApply:
+		if len(manifestArgs) == 0 {
+			return scheduledService{}, errors.New("install-service apply needs a manifest path")
+		}
+		command = []string{"apply"}
+		service.description = "authorized_keys convergence"
+	default:
+		return scheduledService{}, fmt.Errorf("unsupported install-service mode %q (supported: %s, %s)", mode, serviceModeCheck, serviceModeApply)
+	}
+
+	var manifestPath string
+	if len(manifestArgs) == 1 {
+		path, err := absoluteServicePath(manifestArgs[0])
+		if err != nil {
+			return scheduledService{}, fmt.Errorf("resolve manifest path: %w", err)
+		}
+		if _, err := loadKeyManifest(path); err != nil {
+			return scheduledService{}, err
+		}
+		manifestPath = path
+		service.description += " against " + filepath.Base(path)
+	}
+
+	if strings.TrimSpace(programOptions.EnvFile) == "" && strings.TrimSpace(programOptions.ConfigFile) == "" && strings.TrimSpace(programOptions.ConfigDir) == "" && strings.TrimSpace(programOptions.Context) == "" {
+		return scheduledService{}, errors.New("install-service needs --env, --config, --config-dir or --context; a scheduled run cannot answer prompts")
+	}
+	if context := strings.TrimSpace(programOptions.Context); context != "" {
+		command = append(command, "--context", context)
+		service.name += "-" + context
+	}
+	pathFlags := []struct {
+		flag  string
+		value string
+	}{
+		{"--env", programOptions.EnvFile},
+		{"--config", programOptions.ConfigFile},
+		{"--config-dir", programOptions.ConfigDir},
+		{"--age-identity", programOptions.AgeIdentity},
+		{"--servers-file", programOptions.ServersFile},
+		{"--ledger", programOptions.LedgerFile},
+		{"--lock-file", programOptions.LockFile},
+	}
+	for _, pathFlag := range pathFlags {
+		if strings.TrimSpace(pathFlag.value) == "" {
+			continue
+		}
+		if strings.TrimSpace(pathFlag.value) == "-" {
+			return scheduledService{}, fmt.Errorf("%s - reads stdin, which a scheduled run does not have", pathFlag.flag)
+		}
+		path, err := absoluteServicePath(pathFlag.value)
+		if err != nil {
+			return scheduledService{}, fmt.Errorf("resolve %s path: %w", pathFlag.flag, err)
+		}
+		command = append(command, pathFlag.flag, path)
+	}
+	if limit := strings.TrimSpace(programOptions.Limit); limit != "" {
+		command = append(command, "--limit", limit)
+	}
+	if manifestPath != "" {
+		command = append(command, manifestPath)
+	}
+
+	service.schedule = strings.TrimSpace(programOptions.ServiceSchedule)
+	if service.schedule == "" {
+		service.schedule = defaultServiceSchedule
+	}
+	if strings.ContainsAny(service.schedule, "\r\n") {
+		return scheduledService{}, errors.New("--schedule must be a single line")
+	}
+	service.command = append([]string{executable}, command...)
+	return service, nil
+}
+
+func absoluteServicePath(path string) (string, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(expandedPath)
+}
+
+// systemdUnitDir is --service-dir, or the system unit directory for root and
+// the user unit directory otherwise. The second result reports user units,
+// which are managed with systemctl --user.
+func systemdUnitDir(serviceDir string) (string, bool, error) {
+	userUnits := os.Geteuid() != 0
+	if dir := strings.TrimSpace(serviceDir); dir != "" {
+		path, err := absoluteServicePath(dir)
+		if err != nil {
+			return "", false, fmt.Errorf("resolve --service-dir: %w", err)
+		}
+		return path, userUnits, nil
+	}
+	if !userUnits {
+		return "/etc/systemd/system", false, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false, fmt.Errorf("resolve user unit directory: %w", err)
+	}
+	return filepath.Join(configDir, "systemd", "user"), true, nil
+}
+
+// systemdServiceUnit is the oneshot unit the timer starts. A drift check that
+// finds changes exits 1, so the unit shows up in systemctl --failed.
+func systemdServiceUnit(service scheduledService) string {
+	quotedCommand := make([]string, 0, len(service.command))
+	for _, argument := range service.command {
+		quotedCommand = append(quotedCommand, systemdQuote(argument))
+	}
+	var unit strings.Builder
+	unit.WriteString("[Unit]\n")
+	fmt.Fprintf(&unit, "Description=%s %s\n", appName, service.description)
+	unit.WriteString("Wants=network-online.target\n")
+	unit.WriteString("After=network-online.target\n\n")
+	unit.WriteString("[Service]\n")
+	unit.WriteString("Type=oneshot\n")
+	fmt.Fprintf(&unit, "ExecStart=%s\n", strings.Join(quotedCommand, " "))
+	return unit.String()
+}
+
+// systemdTimerUnit runs the service on the --schedule calendar. Persistent
+// catches up on a run missed while the machine was off, and the random delay
+// keeps a fleet of jump hosts from connecting at the same second.
+func systemdTimerUnit(service scheduledService) string {
+	var unit strings.Builder
+	unit.WriteString("[Unit]\n")
+	fmt.Fprintf(&unit, "Description=Scheduled %s %s\n\n", appName, service.description)
+	unit.WriteString("[Timer]\n")
+	fmt.Fprintf(&unit, "OnCalendar=%s\n", service.schedule)
+	unit.WriteString("RandomizedDelaySec=15m\n")
+	unit.WriteString("Persistent=true\n\n")
+	unit.WriteString("[Install]\n")
+	unit.WriteString("WantedBy=timers.target\n")
+	return unit.String()
+}
+
+// cronEntry is the crontab line for the service. The schedule is a
+// five-field cron expression, an @ form, or one of the systemd shorthands
+// that cron also knows.
+func cronEntry(service scheduledService) (string, error) {
+	schedule := service.schedule
+	if shorthand, ok := cronScheduleShorthands[strings.ToLower(schedule)]; ok {
+		schedule = shorthand
+	}
+	if !strings.HasPrefix(schedule, "@") && len(strings.Fields(schedule)) != 5 {
+		return "", fmt.Errorf("--schedule %q is not a cron schedule; use five fields such as \"0 3 * * *\" or hourly, daily, weekly, monthly", service.schedule)
+	}
+	quotedCommand := make([]string, 0, len(service.command))
+	for _, argument := range service.command {
+		// cron turns an unescaped % into a newline.
+		quotedCommand = append(quotedCommand, strings.ReplaceAll(shellQuote(argument), "%", `\%`))
+	}
+	return schedule + " " + strings.Join(quotedCommand, " "), nil
+}
+
+// systemdQuote quotes one ExecStart argument. systemd expands % specifiers
+// and $ variables even inside quotes, so both are doubled.
+func systemdQuote(argument string) string {
+	escaped := strings.NewReplacer("%", "%%", "$", "$$").Replace(argument)
+	if escaped != "" && !strings.ContainsAny(escaped, " \t\"'\\;") {
+		return escaped
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(escaped) + `"`
+}
+
+// writeUnitFile writes content to path unless it already holds exactly that,
+// and reports whether the file changed.
+func writeUnitFile(path, content string) (bool, error) {
+	existing, err := os.ReadFile(path) // #nosec G304 -- unit path is built from the user's --service-dir
+	if err == nil && bytes.Equal(existing, []byte(content)) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil { // #nosec G306 -- unit files hold no secrets and systemd reads them as another user
+		return false, fmt.Errorf("write %s: %w", path, err)
+	}
+	return true, nil
+}
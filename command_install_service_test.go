@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildScheduledServiceUnits(t *testing.T) {
+	directory := t.TempDir()
+	t.Chdir(directory)
+	manifestPath := filepath.Join(directory, "keys.json")
+	if err := os.WriteFile(manifestPath, []byte(`{"groups": {"web": ["web01"]}, "users": {"deploy": []}}`), 0o600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+
+	service, err := buildScheduledService(&options{EnvFile: "prod.env", Limit: "web*", ServiceSchedule: "*-*-* 03:00"}, "/opt/ssh key/ssh-key-bootstrap", "apply", []string{"keys.json"})
+	if err != nil {
+		t.Fatalf("buildScheduledService() error = %v", err)
+	}
+	if service.name != "ssh-key-bootstrap-apply" {
+		t.Fatalf("service name = %q", service.name)
+	}
+	wantExec := `ExecStart="/opt/ssh key/ssh-key-bootstrap" apply --env ` + filepath.Join(directory, "prod.env") + " --limit web* " + manifestPath + "\n"
+	if unit := systemdServiceUnit(service); !strings.Contains(unit, "Type=oneshot\n") || !strings.HasSuffix(unit, wantExec) {
+		t.Fatalf("service unit = %q, want it to end with %q", unit, wantExec)
+	}
+	if timer := systemdTimerUnit(service); !strings.Contains(timer, "OnCalendar=*-*-* 03:00\n") || !strings.Contains(timer, "WantedBy=timers.target\n") {
+		t.Fatalf("timer unit = %q", timer)
+	}
+
+	if _, err := buildScheduledService(&options{}, "/usr/bin/ssh-key-bootstrap", "check", nil); err == nil || !strings.Contains(err.Error(), "cannot answer prompts") {
+		t.Fatalf("buildScheduledService() without a config error = %v", err)
+	}
+	if _, err := buildScheduledService(&options{EnvFile: "prod.env"}, "/usr/bin/ssh-key-bootstrap", "apply", nil); err == nil || !strings.Contains(err.Error(), "needs a manifest") {
+		t.Fatalf("buildScheduledService(apply) without a manifest error = %v", err)
+	}
+}
+
+func TestCronEntryForScheduledService(t *testing.T) {
+	service := scheduledService{command: []string{"/usr/bin/ssh-key-bootstrap", "drift", "--context", "prod", "--limit", "db%"}, schedule: "daily"}
+	entry, err := cronEntry(service)
+	if err != nil {
+		t.Fatalf("cronEntry() error = %v", err)
+	}
+	if want := `@daily '/usr/bin/ssh-key-bootstrap' 'drift' '--context' 'prod' '--limit' 'db\%'`; entry != want {
+		t.Fatalf("cronEntry() = %q, want %q", entry, want)
+	}
+
+	service.schedule = "Mon *-*-* 03:00"
+	if _, err := cronEntry(service); err == nil || !strings.Contains(err.Error(), "not a cron schedule") {
+		t.Fatalf("cronEntry(systemd calendar) error = %v", err)
+	}
+}
+
+func TestSystemdQuoteEscapesSpecifiers(t *testing.T) {
+	testCases := map[string]string{
+		"/usr/bin/tool": "/usr/bin/tool",
+		"50%":           "50%%",
+		"$HOME/x":       "$$HOME/x",
+		`a "b"`:         `"a \"b\""`,
+		"":              `""`,
+	}
+	for argument, want := range testCases {
+		if got := systemdQuote(argument); got != want {
+			t.Fatalf("systemdQuote(%q) = %q, want %q", argument, got, want)
+		}
+	}
+}
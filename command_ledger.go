@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+)
+
+func runHistoryCommand(programOptions *options, args []string) error {
+	if len(args) > 1 {
+		return fail(2, "history accepts at most one host argument")
+	}
+
+	ledger, err := loadLedgerForQuery(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+
+	hostFilter := ""
+	if len(args) == 1 {
+		if hostFilter, err = normalizeHost(args[0], programOptions.Port); err != nil {
+			return fail(2, "invalid host %q: %w", args[0], err)
+		}
+	}
+
+	table := tabwriter.NewWriter(getStandardOutputWriter(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "INSTALLED\tRUN\tHOST\tUSER\tFINGERPRINT\tEXPIRES\tREMOVED")
+	for _, entry := range ledger.Entries {
+		if hostFilter != "" && entry.Host != hostFilter {
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.InstalledAt, valueOrDash(entry.RunID), entry.Host, entry.User, entry.Fingerprint,
+			valueOrDash(entry.ExpiresAt), valueOrDash(entry.RemovedAt))
+	}
+	return table.Flush()
+}
+
+func runWhereIsKeyCommand(programOptions *options, args []string) error {
+	if len(args) != 1 {
+		return fail(2, "where-is-key requires exactly one fingerprint argument")
+	}
+	fingerprint := normalizeFingerprint(args[0])
+
+	ledger, err := loadLedgerForQuery(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+
+	table := tabwriter.NewWriter(getStandardOutputWriter(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "HOST\tUSER\tINSTALLED\tRUN\tEXPIRES")
+	matches := 0
+	for _, index := range ledger.currentEntryIndexes() {
+		entry := ledger.Entries[index]
+		if entry.Fingerprint != fingerprint {
+			continue
+		}
+		matches++
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", entry.Host, entry.User, entry.InstalledAt, valueOrDash(entry.RunID), valueOrDash(entry.ExpiresAt))
+	}
+	if matches == 0 {
+		return fail(1, "%w", fmt.Errorf("key %s is not recorded on any host", fingerprint))
+	}
+	return table.Flush()
+}
+
+func loadLedgerForQuery(programOptions *options) (*installationLedger, error) {
+	if programOptions == nil {
+		return nil, errors.New("program options are required")
+	}
+	ledgerPath, err := resolveLedgerPath(programOptions.LedgerFile)
+	if err != nil {
+		return nil, err
+	}
+	return loadLedger(ledgerPath)
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func seedQueryLedger(t *testing.T) string {
+	t.Helper()
+
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	if err := saveLedger(ledgerPath, &installationLedger{Entries: []ledgerEntry{
+		{RunID: "run-1", Host: "app01:22", User: "deploy", Fingerprint: "SHA256:aaa", InstalledAt: "2025-01-01T00:00:00Z"},
+		{RunID: "run-1", Host: "app02:22", User: "deploy", Fingerprint: "SHA256:aaa", InstalledAt: "2025-01-01T00:00:00Z", RemovedAt: "2025-02-01T00:00:00Z"},
+		{RunID: "run-2", Host: "app02:22", User: "deploy", Fingerprint: "SHA256:bbb", InstalledAt: "2025-03-01T00:00:00Z"},
+	}}); err != nil {
+		t.Fatalf("seed ledger: %v", err)
+	}
+	return ledgerPath
+}
+
+func TestRunHistoryCommandFiltersByHost(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	ledgerPath := seedQueryLedger(t)
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "history", "--ledger", ledgerPath, "app02"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(history) error = %v", err)
+	}
+
+	output := outputBuffer.String()
+	if strings.Contains(output, "app01:22") {
+		t.Fatalf("history output not filtered by host: %q", output)
+	}
+	if strings.Count(output, "app02:22") != 2 || !strings.Contains(output, "run-2") {
+		t.Fatalf("history output missing app02 entries: %q", output)
+	}
+}
+
+func TestRunWhereIsKeyCommandListsCurrentHosts(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	ledgerPath := seedQueryLedger(t)
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "where-is-key", "--ledger", ledgerPath, "aaa"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(where-is-key) error = %v", err)
+	}
+
+	output := outputBuffer.String()
+	if !strings.Contains(output, "app01:22") {
+		t.Fatalf("where-is-key output missing app01: %q", output)
+	}
+	if strings.Contains(output, "app02:22") {
+		t.Fatalf("where-is-key listed a removed installation: %q", output)
+	}
+}
+
+func TestRunWhereIsKeyCommandUnknownKey(t *testing.T) {
+	captureWriters(t)
+	ledgerPath := seedQueryLedger(t)
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "where-is-key", "--ledger", ledgerPath, "SHA256:zzz"})
+	err := run(capturedRuntimeIO())
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 1 {
+		t.Fatalf("run(where-is-key unknown) error = %v, want status 1", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const defaultShellTerm = "xterm-256color"
+
+var (
+	// runInteractiveOpenSSH runs the system ssh client on the operator's
+	// terminal. Tests replace it to avoid spawning processes.
+	runInteractiveOpenSSH = func(binaryPath string, args []string) error {
+		command := exec.Command(binaryPath, args...) // #nosec G204 -- binary is resolved from PATH and arguments are built by this tool
+		command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+		return command.Run()
+	}
+	runInteractiveSession = defaultRunInteractiveSession
+)
+
+// runShellCommand opens an interactive shell on one host with the same
+// config as a run. It is meant for manual follow-up on a host that failed.
+func runShellCommand(programOptions *options, args []string) error {
+	if len(args) != 1 {
+		return fail(2, "shell takes exactly one host, e.g. %s shell app01:22", appName)
+	}
+	host, setting, err := resolveSingleHost(programOptions, args[0])
+	if err != nil {
+		return err
+	}
+
+	outputAnsibleTask("Open shell")
+	if programOptions.UseOpenSSH {
+		return runOpenSSHShell(programOptions, host, setting.User)
+	}
+	client, err := dialSingleHost(programOptions, host, setting)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := runInteractiveSession(client); err != nil {
+		return fail(exitHostFailure, "shell on %s: %w", host, err)
+	}
+	return nil
+}
+
+// runOpenSSHShell hands the terminal to the system ssh client with the
+// options a --use-openssh run uses. Unlike a run, ssh may prompt and does not
+// share a control connection.
+func runOpenSSHShell(programOptions *options, host, userName string) error {
+	executor, err := newOpenSSHExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	// ssh uses the first value given for an option, so these override the
+	// batch settings in baseArgs.
+	args := []string{"-o", "BatchMode=no", "-o", "ControlMaster=no", "-o", "ControlPath=none", "-t"}
+	args = append(args, executor.baseArgs...)
+	args = append(args, executor.targetArgs(host, userName)...)
+	outputAnsibleHostStatus("ok", host, "handing over to "+executor.binaryPath)
+	err = runInteractiveOpenSSH(executor.binaryPath, args)
+	if exitErr, ok := errors.AsType[*exec.ExitError](err); ok && exitErr.ExitCode() == opensshConnectionErrorCode {
+		return fail(exitHostFailure, "ssh could not open a shell on %s", host)
+	}
+	return nil
+}
+
+// defaultRunInteractiveSession runs a login shell on the operator's terminal.
+// With a terminal it requests a pty of the same size, switches the local
+// terminal to raw mode and forwards size changes.
+func defaultRunInteractiveSession(client *ssh.Client) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return &sessionError{op: "create session", err: err}
+	}
+	defer session.Close()
+	session.Stdin, session.Stdout, session.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	if fileDescriptor, ok := terminalFD(os.Stdin); ok && term.IsTerminal(fileDescriptor) {
+		width, height, err := term.GetSize(fileDescriptor)
+		if err != nil {
+			width, height = 80, 24
+		}
+		termType := strings.TrimSpace(os.Getenv("TERM"))
+		if termType == "" {
+			termType = defaultShellTerm
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("request pty: %w", err)
+		}
+		previousState, err := term.MakeRaw(fileDescriptor)
+		if err != nil {
+			return fmt.Errorf("switch terminal to raw mode: %w", err)
+		}
+		defer func() { _ = term.Restore(fileDescriptor, previousState) }()
+		stopResize := forwardTerminalResize(fileDescriptor, session)
+		defer stopResize()
+	}
+
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("start shell: %w", err)
+	}
+	err = session.Wait()
+	if _, exited := errors.AsType[*ssh.ExitError](err); exited {
+		// The exit status of the last command typed is not a failure of the tool.
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writeShellTestConfig(t *testing.T, extra map[string]any) string {
+	t.Helper()
+	content := map[string]any{
+		"user":                  "deploy",
+		"password":              "password",
+		"insecureIgnoreHostKey": true,
+		"hosts":                 []any{map[string]any{"address": "app01", "port": 2222, "user": "ops"}},
+	}
+	for key, value := range extra {
+		content[key] = value
+	}
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, encoded, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return configPath
+}
+
+func TestRunShellCommandRequiresOneHost(t *testing.T) {
+	captureWriters(t)
+	for _, args := range [][]string{nil, {"app01", "app02"}} {
+		var statusErr *statusError
+		if err := runShellCommand(&options{}, args); !errors.As(err, &statusErr) || statusErr.code != 2 {
+			t.Fatalf("runShellCommand(%v) error = %v, want usage status", args, err)
+		}
+	}
+}
+
+func TestRunShellCommandUsesHostUserFromConfig(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	configPath := writeShellTestConfig(t, nil)
+
+	var dialedAddress, dialedUser string
+	stubSSHDialHook(t, func(_ string, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedAddress, dialedUser = address, config.User
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) { return "", "", 0 })
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+	originalSession := runInteractiveSession
+	sessionOpened := false
+	runInteractiveSession = func(*ssh.Client) error {
+		sessionOpened = true
+		return nil
+	}
+	t.Cleanup(func() { runInteractiveSession = originalSession })
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "shell", "--config", configPath, "app01:2222"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(shell) error = %v", err)
+	}
+	if dialedAddress != "app01:2222" || dialedUser != "ops" || !sessionOpened {
+		t.Fatalf("dialed %s as %q, session opened = %v", dialedAddress, dialedUser, sessionOpened)
+	}
+	if !strings.Contains(outputBuffer.String(), "connected as ops") {
+		t.Fatalf("output missing connection line: %q", outputBuffer.String())
+	}
+}
+
+func TestRunShellCommandHandsOverToOpenSSH(t *testing.T) {
+	captureWriters(t)
+	configPath := writeShellTestConfig(t, nil)
+
+	originalLookPath, originalRun := lookPathForOpenSSH, runInteractiveOpenSSH
+	lookPathForOpenSSH = func(string) (string, error) { return "/usr/bin/ssh", nil }
+	var capturedArgs []string
+	runInteractiveOpenSSH = func(_ string, args []string) error {
+		capturedArgs = args
+		return nil
+	}
+	t.Cleanup(func() { lookPathForOpenSSH, runInteractiveOpenSSH = originalLookPath, originalRun })
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "shell", "--config", configPath, "--use-openssh", "app01:2222"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(shell) error = %v", err)
+	}
+	if !slices.Contains(capturedArgs, "-t") || capturedArgs[1] != "BatchMode=no" || !slices.Contains(capturedArgs, "StrictHostKeyChecking=no") {
+		t.Fatalf("ssh args = %v", capturedArgs)
+	}
+	if target := capturedArgs[len(capturedArgs)-6:]; !slices.Equal(target, []string{"-p", "2222", "-l", "ops", "--", "app01"}) {
+		t.Fatalf("ssh target args = %v", capturedArgs)
+	}
+}
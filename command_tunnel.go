@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const defaultTunnelBindHost = "127.0.0.1"
+
+// tunnelStopContext is cancelled when the operator stops the tunnel. Tests
+// replace it to stop a tunnel without signals.
+var tunnelStopContext = func() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// tunnelForward is one local forward like ssh -L: connections to bindAddress
+// on this machine are carried over SSH to targetAddress as seen from the host.
+type tunnelForward struct {
+	bindAddress   string
+	targetAddress string
+}
+
+// openSSHArg returns the forward in the form ssh -L expects.
+func (forward tunnelForward) openSSHArg() string {
+	return forward.bindAddress + ":" + forward.targetAddress
+}
+
+// parseTunnelForward accepts [bind_address:]port:target:target_port like
+// ssh -L, and port:target_port as a shorthand for a service listening on the
+// host's own loopback. IPv6 addresses go in brackets.
+func parseTunnelForward(spec string) (tunnelForward, error) {
+	fields, err := splitTunnelForward(strings.TrimSpace(spec))
+	if err != nil {
+		return tunnelForward{}, err
+	}
+	bindHost := defaultTunnelBindHost
+	switch len(fields) {
+	case 2:
+		fields = []string{fields[0], "localhost", fields[1]}
+	case 3:
+	case 4:
+		bindHost, fields = fields[0], fields[1:]
+	default:
+		return tunnelForward{}, fmt.Errorf("invalid forward %q: want [bind_address:]port:target:target_port or port:target_port", spec)
+	}
+	if bindHost == "" || fields[1] == "" {
+		return tunnelForward{}, fmt.Errorf("invalid forward %q: empty address", spec)
+	}
+	for _, port := range []string{fields[0], fields[2]} {
+		if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+			return tunnelForward{}, fmt.Errorf("invalid forward %q: port %q must be 1-65535", spec, port)
+		}
+	}
+	return tunnelForward{
+		bindAddress:   net.JoinHostPort(bindHost, fields[0]),
+		targetAddress: net.JoinHostPort(fields[1], fields[2]),
+	}, nil
+}
+
+// splitTunnelForward splits spec on colons outside brackets and strips the
+// brackets.
+func splitTunnelForward(spec string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	inBrackets := false
+	for _, character := range spec {
+		switch {
+		case character == '[' && !inBrackets && current.Len() == 0:
+			inBrackets = true
+		case character == ']' && inBrackets:
+			inBrackets = false
+		case character == ':' && !inBrackets:
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(character)
+		}
+	}
+	if inBrackets {
+		return nil, fmt.Errorf("invalid forward %q: unclosed bracket", spec)
+	}
+	return append(fields, current.String()), nil
+}
+
+// runTunnelCommand forwards a local port to a service reachable from one host
+// with the credentials and host key policy of a run, until Ctrl-C or until
+// the SSH connection drops.
+func runTunnelCommand(programOptions *options, args []string) error {
+	if len(args) != 2 {
+		return fail(2, "tunnel takes a host and a forward, e.g. %s tunnel db01:22 5432:localhost:5432", appName)
+	}
+	forward, err := parseTunnelForward(args[1])
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	host, setting, err := resolveSingleHost(programOptions, args[0])
+	if err != nil {
+		return err
+	}
+
+	outputAnsibleTask("Open tunnel")
+	if programOptions.UseOpenSSH {
+		return runOpenSSHTunnel(programOptions, host, setting.User, forward)
+	}
+	listener, err := net.Listen("tcp", forward.bindAddress)
+	if err != nil {
+		return fail(2, "listen on %s: %w", forward.bindAddress, err)
+	}
+	defer listener.Close()
+	client, err := dialSingleHost(programOptions, host, setting)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, stop := tunnelStopContext()
+	defer stop()
+	connectionLost := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(connectionLost)
+		stop()
+	}()
+
+	outputAnsibleHostStatus("ok", host, fmt.Sprintf("forwarding %s -> %s; press Ctrl-C to stop", listener.Addr(), forward.targetAddress))
+	if err := forwardTunnel(ctx, listener, client.Dial, forward.targetAddress); err != nil {
+		return fail(exitHostFailure, "tunnel: %w", err)
+	}
+	select {
+	case <-connectionLost:
+		return fail(exitNetworkFailure, "connection to %s closed", host)
+	default:
+		return nil
+	}
+}
+
+// forwardTunnel accepts connections on listener until ctx is done and pipes
+// each one to target through dial. A connection the host cannot open is
+// reported and closed; the tunnel stays up.
+func forwardTunnel(ctx context.Context, listener net.Listener, dial func(network, address string) (net.Conn, error), target string) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	var connections sync.WaitGroup
+	defer connections.Wait()
+	for {
+		localConn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		connections.Go(func() {
+			defer localConn.Close()
+			remoteConn, err := dial("tcp", target)
+			if err != nil {
+				outputPrintf("  forward from %s to %s failed: %v\n", localConn.RemoteAddr(), target, err)
+				return
+			}
+			defer remoteConn.Close()
+			pipeConnections(ctx, localConn, remoteConn)
+		})
+	}
+}
+
+// pipeConnections copies both ways until either side is done or ctx ends.
+func pipeConnections(ctx context.Context, left, right net.Conn) {
+	done := make(chan struct{}, 2)
+	copyHalf := func(destination, source net.Conn) {
+		_, _ = io.Copy(destination, source)
+		done <- struct{}{}
+	}
+	go copyHalf(left, right)
+	go copyHalf(right, left)
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	_ = left.Close()
+	_ = right.Close()
+	<-done
+}
+
+// runOpenSSHTunnel lets the system ssh client hold the forward with the
+// options a --use-openssh run uses. ssh exits on Ctrl-C itself.
+func runOpenSSHTunnel(programOptions *options, host, userName string, forward tunnelForward) error {
+	executor, err := newOpenSSHExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	// Ignore the signal here so ssh, which gets it too, decides when to stop.
+	_, stop := tunnelStopContext()
+	defer stop()
+
+	args := []string{"-o", "BatchMode=no", "-o", "ControlMaster=no", "-o", "ControlPath=none", "-o", "ExitOnForwardFailure=yes", "-N", "-L", forward.openSSHArg()}
+	args = append(args, executor.baseArgs...)
+	args = append(args, executor.targetArgs(host, userName)...)
+	outputAnsibleHostStatus("ok", host, fmt.Sprintf("forwarding %s -> %s through %s; press Ctrl-C to stop", forward.bindAddress, forward.targetAddress, executor.binaryPath))
+	err = runInteractiveOpenSSH(executor.binaryPath, args)
+	if exitErr, ok := errors.AsType[*exec.ExitError](err); ok && exitErr.ExitCode() == opensshConnectionErrorCode {
+		return fail(exitHostFailure, "ssh could not open the tunnel on %s", host)
+	}
+	return nil
+}
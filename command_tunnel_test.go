@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTunnelForward(t *testing.T) {
+	for spec, want := range map[string]tunnelForward{
+		"5432:5432":                      {bindAddress: "127.0.0.1:5432", targetAddress: "localhost:5432"},
+		"8080:intranet:80":               {bindAddress: "127.0.0.1:8080", targetAddress: "intranet:80"},
+		"0.0.0.0:8080:10.0.0.5:80":       {bindAddress: "0.0.0.0:8080", targetAddress: "10.0.0.5:80"},
+		"[::1]:8080:[fd00::5]:80":        {bindAddress: "[::1]:8080", targetAddress: "[fd00::5]:80"},
+		" 3306:db.internal.example:3306": {bindAddress: "127.0.0.1:3306", targetAddress: "db.internal.example:3306"},
+	} {
+		forward, err := parseTunnelForward(spec)
+		if err != nil || forward != want {
+			t.Fatalf("parseTunnelForward(%q) = %+v, %v; want %+v", spec, forward, err, want)
+		}
+	}
+	for _, spec := range []string{"", "5432", "0:db:5432", "5432:db:http", "a:b:c:d:e", "5432:[::1:5432", "5432::5432"} {
+		if _, err := parseTunnelForward(spec); err == nil {
+			t.Fatalf("parseTunnelForward(%q) accepted", spec)
+		}
+	}
+}
+
+func TestForwardTunnelPipesConnectionsToTarget(t *testing.T) {
+	captureWriters(t)
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen target: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				_, _ = conn.Write([]byte("echo " + line))
+			}()
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tunnel: %v", err)
+	}
+	var dialedTargets []string
+	dial := func(network, address string) (net.Conn, error) {
+		dialedTargets = append(dialedTargets, address)
+		return net.Dial(network, target.Addr().String())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- forwardTunnel(ctx, listener, dial, "db.internal:5432") }()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial tunnel: %v", err)
+	}
+	_, _ = conn.Write([]byte("ping\n"))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	_ = conn.Close()
+	if err != nil || reply != "echo ping\n" {
+		t.Fatalf("reply = %q, %v", reply, err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("forwardTunnel() error = %v", err)
+	}
+	if !slices.Equal(dialedTargets, []string{"db.internal:5432"}) {
+		t.Fatalf("dialed %v", dialedTargets)
+	}
+}
+
+func TestForwardTunnelReportsRefusedTarget(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tunnel: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- forwardTunnel(ctx, listener, func(string, string) (net.Conn, error) {
+			return nil, errors.New("ssh: rejected: connect failed (Connection refused)")
+		}, "localhost:5432")
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial tunnel: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("connection stayed open after a refused forward")
+	}
+	_ = conn.Close()
+	cancel()
+	<-done
+	if !strings.Contains(outputBuffer.String(), "to localhost:5432 failed: ssh: rejected") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+}
+
+func TestRunTunnelCommandHandsOverToOpenSSH(t *testing.T) {
+	captureWriters(t)
+	configPath := writeShellTestConfig(t, nil)
+
+	originalLookPath, originalRun := lookPathForOpenSSH, runInteractiveOpenSSH
+	lookPathForOpenSSH = func(string) (string, error) { return "/usr/bin/ssh", nil }
+	var capturedArgs []string
+	runInteractiveOpenSSH = func(_ string, args []string) error {
+		capturedArgs = args
+		return nil
+	}
+	t.Cleanup(func() { lookPathForOpenSSH, runInteractiveOpenSSH = originalLookPath, originalRun })
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "tunnel", "--config", configPath, "--use-openssh", "app01:2222", "5432:db:5432"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(tunnel) error = %v", err)
+	}
+	forwardIndex := slices.Index(capturedArgs, "-L")
+	if forwardIndex < 0 || capturedArgs[forwardIndex+1] != "127.0.0.1:5432:db:5432" || !slices.Contains(capturedArgs, "-N") || !slices.Contains(capturedArgs, "ExitOnForwardFailure=yes") {
+		t.Fatalf("ssh args = %v", capturedArgs)
+	}
+	if target := capturedArgs[len(capturedArgs)-6:]; !slices.Equal(target, []string{"-p", "2222", "-l", "ops", "--", "app01"}) {
+		t.Fatalf("ssh target args = %v", capturedArgs)
+	}
+}
+
+func TestRunTunnelCommandRejectsBadForward(t *testing.T) {
+	captureWriters(t)
+	var statusErr *statusError
+	if err := runTunnelCommand(&options{}, []string{"app01", "5432"}); !errors.As(err, &statusErr) || statusErr.code != 2 {
+		t.Fatalf("runTunnelCommand() error = %v, want usage status", err)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const contextsDirName = "contexts"
+
+// contextNamePattern keeps a context name usable as one directory name.
+var contextNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateContextName checks a --context name.
+func ValidateContextName(name string) error {
+	if !contextNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid context name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// ContextDir is the directory holding the config set of the named context,
+// UserConfigDir()/contexts/<name>.
+func ContextDir(name string) (string, error) {
+	if err := ValidateContextName(name); err != nil {
+		return "", err
+	}
+	configDir, err := UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, contextsDirName, name), nil
+}
+
+// ContextNames lists the contexts that have a directory, sorted.
+func ContextNames() ([]string, error) {
+	configDir, err := UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(configDir, contextsDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list contexts: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && contextNamePattern.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// selectContextConfig points EnvFile or ConfigFile at the .env or
+// config.json of --context. A context replaces --env and --config, so the
+// credentials of two contexts never end up in one run.
+func selectContextConfig(programOptions *Options) error {
+	name := strings.TrimSpace(programOptions.Context)
+	if strings.TrimSpace(programOptions.EnvFile) != "" || strings.TrimSpace(programOptions.ConfigFile) != "" {
+		return errors.New("use either --context or --env/--config, not both")
+	}
+	contextDir, err := ContextDir(name)
+	if err != nil {
+		return err
+	}
+	dotEnvPath := filepath.Join(contextDir, userConfigDotEnvFilename)
+	jsonPath := filepath.Join(contextDir, userConfigJSONFilename)
+	switch hasDotEnv, hasJSON := fileExists(dotEnvPath), fileExists(jsonPath); {
+	case hasDotEnv && hasJSON:
+		return fmt.Errorf("context %q has both %s and %s; remove one", name, userConfigDotEnvFilename, userConfigJSONFilename)
+	case hasDotEnv:
+		programOptions.EnvFile = dotEnvPath
+		return nil
+	case hasJSON:
+		programOptions.ConfigFile = jsonPath
+		return nil
+	}
+
+	names, err := ContextNames()
+	if err != nil {
+		return err
+	}
+	available := "none yet; create one with init --context " + name
+	if len(names) > 0 {
+		available = strings.Join(names, ", ")
+	}
+	return fmt.Errorf("context %q has no %s or %s in %s (available: %s)", name, userConfigDotEnvFilename, userConfigJSONFilename, contextDir, available)
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeContextFile(t *testing.T, configHome, context, name, content string) string {
+	t.Helper()
+
+	contextDir := filepath.Join(configHome, userConfigDirName, contextsDirName, context)
+	if err := os.MkdirAll(contextDir, 0o700); err != nil {
+		t.Fatalf("create context dir: %v", err)
+	}
+	path := filepath.Join(contextDir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestApplyFilesLoadsContextConfig(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	writeContextFile(t, configHome, "acme", userConfigDotEnvFilename, "USER=acme-ops\n")
+	jsonPath := writeContextFile(t, configHome, "globex", userConfigJSONFilename, `{"user":"globex-ops"}`)
+
+	opts := &Options{Context: "globex"}
+	if err := ApplyFiles(opts, &scriptedRuntimeIO{}); err != nil {
+		t.Fatalf("ApplyFiles() error = %v", err)
+	}
+	if opts.ConfigFile != jsonPath || opts.User != "globex-ops" {
+		t.Fatalf("ConfigFile = %q, User = %q; want the globex context", opts.ConfigFile, opts.User)
+	}
+}
+
+func TestSelectContextConfigErrors(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	writeContextFile(t, configHome, "acme", userConfigDotEnvFilename, "USER=a\n")
+	writeContextFile(t, configHome, "both", userConfigDotEnvFilename, "USER=b\n")
+	writeContextFile(t, configHome, "both", userConfigJSONFilename, `{}`)
+
+	testCases := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"unknown context lists the others", Options{Context: "initech"}, "available: acme, both"},
+		{"both files", Options{Context: "both"}, "has both"},
+		{"explicit env file", Options{Context: "acme", EnvFile: "/tmp/other.env"}, "not both"},
+		{"path in name", Options{Context: "../acme"}, "invalid context name"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			opts := testCase.opts
+			if err := selectContextConfig(&opts); err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("selectContextConfig() error = %v, want %q", err, testCase.want)
+			}
+		})
+	}
+}
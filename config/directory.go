@@ -0,0 +1,82 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// readConfigDir reads a directory that holds one file per .env key, the
+// layout of a mounted Kubernetes Secret or ConfigMap: the file SERVERS holds
+// the SERVERS value. Files with other names, such as the kubelet's ..data
+// link or a mounted known_hosts, are not read. A trailing line break is
+// dropped from each value, since kubectl create secret --from-file keeps it.
+func readConfigDir(dir string) (map[string]string, error) {
+	dirPath, err := expandHomePath(strings.TrimSpace(dir))
+	if err != nil {
+		return nil, fmt.Errorf("resolve config directory: %w", err)
+	}
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("read config directory: %w", err)
+	}
+	values := map[string]string{}
+	for _, entry := range entries {
+		key := entry.Name()
+		if !slices.Contains(dotEnvKeys, key) && !strings.HasPrefix(key, dotEnvMessagePrefix) {
+			continue
+		}
+		// Mounted keys are symlinks into the current ..data snapshot.
+		content, err := os.ReadFile(filepath.Join(dirPath, key)) // #nosec G304 -- key file in the explicit config directory
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read config key %s: %w", key, err)
+		}
+		values[key] = strings.TrimRight(string(content), "\r\n")
+	}
+	return values, nil
+}
+
+// ApplyDirWithMetadata loads the .env keys from the files of ConfigDir.
+// Values are taken literally; ${NAME} is not expanded.
+func ApplyDirWithMetadata(programOptions *Options) (map[string]bool, error) {
+	if programOptions == nil {
+		return nil, errors.New("program options are required")
+	}
+	values, err := readConfigDir(programOptions.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+	loadedFieldNames, err := applyDotEnvValues(programOptions, values)
+	if err != nil {
+		return nil, fmt.Errorf("config directory %s: %w", programOptions.ConfigDir, err)
+	}
+	return loadedFieldNames, nil
+}
+
+// ConfigDirFingerprint identifies the current content of a config
+// directory, so a run can tell when the kubelet swapped in an updated Secret.
+func ConfigDirFingerprint(dir string) (string, error) {
+	values, err := readConfigDir(dir)
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	digest := sha256.New()
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(digest, "%s=%d:%s\n", key, len(values[key]), values[key])
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
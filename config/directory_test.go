@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigDirKeys(t *testing.T, dir string, keys map[string]string) {
+	t.Helper()
+	for key, value := range keys {
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(value), 0o600); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+	}
+}
+
+func TestApplyDirWithMetadataReadsOneFilePerKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0o700); err != nil {
+		t.Fatalf("create ..data: %v", err)
+	}
+	writeConfigDirKeys(t, dir, map[string]string{
+		"SERVERS":                     "app01,app02\n",
+		"USER":                        "deploy",
+		"PASSWORD":                    "s3cret\r\n",
+		"KEY":                         "${NOT_EXPANDED}",
+		"MESSAGE_PROMPT_SSH_USERNAME": "Login: ",
+		"known_hosts":                 "app01 ssh-ed25519 AAAA\n",
+	})
+
+	opts := &Options{ConfigDir: dir}
+	loaded, err := ApplyDirWithMetadata(opts)
+	if err != nil {
+		t.Fatalf("ApplyDirWithMetadata() error = %v", err)
+	}
+	if opts.Servers != "app01,app02" || opts.User != "deploy" || opts.Password != "s3cret" || opts.KeyInput != "${NOT_EXPANDED}" {
+		t.Fatalf("options = %+v", opts)
+	}
+	if opts.Messages["prompt_ssh_username"] != "Login: " || !loaded["servers"] || loaded["knownHosts"] {
+		t.Fatalf("Messages = %v, loaded = %v", opts.Messages, loaded)
+	}
+
+	writeConfigDirKeys(t, dir, map[string]string{"PORT": "ssh"})
+	if _, err := ApplyDirWithMetadata(&Options{ConfigDir: dir}); err == nil || !strings.Contains(err.Error(), "PORT must be an integer") {
+		t.Fatalf("ApplyDirWithMetadata() with PORT=ssh error = %v", err)
+	}
+	if err := ApplyFiles(&Options{ConfigDir: dir, EnvFile: ".env"}, &scriptedRuntimeIO{}); err == nil || !strings.Contains(err.Error(), "use --config-dir without --env") {
+		t.Fatalf("ApplyFiles(--config-dir --env) error = %v", err)
+	}
+}
+
+func TestConfigDirFingerprintFollowsKeyChanges(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeConfigDirKeys(t, dir, map[string]string{"USER": "deploy", "PASSWORD": "old"})
+	before, err := ConfigDirFingerprint(dir)
+	if err != nil {
+		t.Fatalf("ConfigDirFingerprint() error = %v", err)
+	}
+
+	writeConfigDirKeys(t, dir, map[string]string{"unrelated.txt": "ignored"})
+	if unchanged, _ := ConfigDirFingerprint(dir); unchanged != before {
+		t.Fatalf("fingerprint changed for a file that is not a config key")
+	}
+	writeConfigDirKeys(t, dir, map[string]string{"PASSWORD": "new"})
+	if after, _ := ConfigDirFingerprint(dir); after == before {
+		t.Fatalf("fingerprint did not change after PASSWORD was rotated")
+	}
+}
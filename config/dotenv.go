@@ -3,11 +3,14 @@ package config
 import (
 	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 )
 
+// dotEnvMessagePrefix marks .env keys that override a prompt or status
+// string: MESSAGE_PROMPT_SSH_USERNAME sets message prompt_ssh_username.
+const dotEnvMessagePrefix = "MESSAGE_"
+
 func ApplyDotEnvWithMetadata(programOptions *Options) (map[string]bool, error) {
 	if programOptions == nil {
 		return nil, errors.New("program options are required")
@@ -22,16 +25,26 @@ func ApplyDotEnvWithMetadata(programOptions *Options) (map[string]bool, error) {
 	if err != nil {
 		return nil, fmt.Errorf("resolve .env path: %w", err)
 	}
-	envBytes, err := os.ReadFile(envFilePath) // #nosec G304 -- dotenv path is explicit user input
+	envBytes, err := readConfigFile(envFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("read .env file: %w", err)
 	}
 
-	parsedEnvValues, err := parseDotEnvContent(string(envBytes))
+	return applyDotEnvContent(programOptions, envBytes)
+}
+
+func applyDotEnvContent(programOptions *Options, envBytes []byte) (map[string]bool, error) {
+	parsedEnvValues, err := parseDotEnvContentWithLookup(string(envBytes), interpolationLookup(programOptions))
 	if err != nil {
 		return nil, fmt.Errorf("parse .env file: %w", err)
 	}
+	return applyDotEnvValues(programOptions, parsedEnvValues)
+}
 
+// applyDotEnvValues sets the options named by .env keys in parsedEnvValues and
+// reports which fields it loaded.
+func applyDotEnvValues(programOptions *Options, parsedEnvValues map[string]string) (map[string]bool, error) {
+	loadedFieldNames := map[string]bool{}
 	setLoaded := func(fieldName string, apply func() error) error {
 		if err := apply(); err != nil {
 			return err
@@ -58,6 +71,9 @@ func ApplyDotEnvWithMetadata(programOptions *Options) (map[string]bool, error) {
 	setEnvOption("SERVERS", "servers", true, func(v string) {
 		programOptions.Servers = v
 	})
+	setEnvOption("SERVERS_FILE", "serversFile", true, func(v string) {
+		programOptions.ServersFile = v
+	})
 	setEnvOption("USER", "user", true, func(v string) {
 		programOptions.User = v
 	})
@@ -67,6 +83,12 @@ func ApplyDotEnvWithMetadata(programOptions *Options) (map[string]bool, error) {
 	setEnvOption("PASSWORD_SECRET_REF", "passwordSecretRef", true, func(v string) {
 		programOptions.PasswordSecretRef = v
 	})
+	setEnvOption("HOST_PASSWORD_SECRET_REFS", "hostPasswordSecretRefs", true, func(v string) {
+		programOptions.HostPasswordSecretRefs = v
+	})
+	setEnvOption("PASSWORD_SECRET_REF_TEMPLATE", "passwordSecretRefTemplate", true, func(v string) {
+		programOptions.PasswordSecretRefTemplate = v
+	})
 	setEnvOption("PASSWORD_PROVIDER", "passwordProvider", true, func(v string) {
 		programOptions.PasswordProvider = strings.ToLower(v)
 	})
@@ -119,6 +141,35 @@ func ApplyDotEnvWithMetadata(programOptions *Options) (map[string]bool, error) {
 			return nil, err
 		}
 	}
+	setEnvOption("IDENTITY_FILE", "identityFile", true, func(v string) {
+		programOptions.IdentityFile = v
+	})
+	setEnvOption("AUTH_METHODS", "authMethods", true, func(v string) {
+		programOptions.AuthMethods = v
+	})
+	setEnvOption("AUTH_KEY_SOURCE", "authKeySource", true, func(v string) {
+		programOptions.AuthKeySource = v
+	})
+	setEnvOption("KEY_POLICY", "keyPolicy", true, func(v string) {
+		programOptions.KeyPolicy = v
+	})
+	setEnvOption("OPERATIONS", "operations", true, func(v string) {
+		programOptions.Operations = v
+	})
+	setEnvOption("LOCALE", "locale", true, func(v string) {
+		programOptions.Locale = v
+	})
+	for envKey, value := range parsedEnvValues {
+		messageID, ok := strings.CutPrefix(envKey, dotEnvMessagePrefix)
+		if !ok || messageID == "" {
+			continue
+		}
+		if programOptions.Messages == nil {
+			programOptions.Messages = map[string]string{}
+		}
+		programOptions.Messages[strings.ToLower(messageID)] = value
+		loadedFieldNames["messages"] = true
+	}
 	if knownHostsValue, ok := parsedEnvValues["KNOWN_HOSTS"]; ok {
 		if err := setLoaded("knownHosts", func() error {
 			programOptions.KnownHosts = strings.TrimSpace(knownHostsValue)
@@ -189,3 +189,21 @@ func TestApplyDotEnvWithMetadataParseError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestApplyDotEnvWithMetadataLoadsLocaleAndMessages(t *testing.T) {
+	t.Parallel()
+
+	envPath := writeDotEnv(t, "LOCALE=de\nMESSAGE_PROMPT_SSH_USERNAME=\"Runbook step 3 - login user: \"\n")
+	opts := &Options{EnvFile: envPath}
+
+	loaded, err := ApplyDotEnvWithMetadata(opts)
+	if err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if !loaded["locale"] || !loaded["messages"] {
+		t.Fatalf("loaded = %v", loaded)
+	}
+	if opts.Locale != "de" || opts.Messages["prompt_ssh_username"] != "Runbook step 3 - login user: " {
+		t.Fatalf("locale = %q, messages = %v", opts.Locale, opts.Messages)
+	}
+}
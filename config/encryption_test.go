@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptWithPassphraseRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	plaintext := []byte("USER=deploy\nPASSWORD=\"s3cret value\"\n")
+	encrypted, err := EncryptWithPassphrase(plaintext, "correct horse")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(string(encrypted), "s3cret") {
+		t.Fatalf("encrypted content not recognised or leaks plaintext: %q", encrypted)
+	}
+
+	decrypted, err := DecryptWithPassphrase(encrypted, "correct horse")
+	if err != nil {
+		t.Fatalf("DecryptWithPassphrase() error = %v", err)
+	}
+	if string(decrypted) != string(plaintext) {
+		t.Fatalf("DecryptWithPassphrase() = %q, want %q", decrypted, plaintext)
+	}
+	if _, err := DecryptWithPassphrase(encrypted, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("DecryptWithPassphrase(wrong) error = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestIsAgeEncrypted(t *testing.T) {
+	t.Parallel()
+
+	if !IsAgeEncrypted([]byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n-----END AGE ENCRYPTED FILE-----\n")) {
+		t.Fatal("armored age file not recognised")
+	}
+	if !IsAgeEncrypted([]byte("age-encryption.org/v1\n-> X25519 abc\n")) {
+		t.Fatal("binary age file not recognised")
+	}
+	if IsEncrypted([]byte("USER=deploy\n")) {
+		t.Fatal("plaintext .env reported as encrypted")
+	}
+}
+
+func TestApplyDotEnvWithMetadataDecryptsThroughHook(t *testing.T) {
+	encrypted, err := EncryptWithPassphrase([]byte("USER=deploy\nPASSWORD=hunter2\n"), "pw")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error = %v", err)
+	}
+	path := writeDotEnv(t, string(encrypted))
+
+	originalDecryptFile := DecryptFile
+	t.Cleanup(func() { DecryptFile = originalDecryptFile })
+
+	opts := &Options{EnvFile: path}
+	if _, err := ApplyDotEnvWithMetadata(opts); err == nil || !strings.Contains(err.Error(), "no decryption is configured") {
+		t.Fatalf("ApplyDotEnvWithMetadata() without decrypter error = %v", err)
+	}
+
+	DecryptFile = func(decryptPath string, content []byte) ([]byte, error) {
+		if decryptPath != path {
+			t.Fatalf("DecryptFile path = %q, want %q", decryptPath, path)
+		}
+		return DecryptWithPassphrase(content, "pw")
+	}
+	if _, err := ApplyDotEnvWithMetadata(opts); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if opts.User != "deploy" || opts.Password != "hunter2" {
+		t.Fatalf("decrypted options = %+v", opts)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dotEnvKeys are the keys ApplyEnvironmentWithMetadata reads from the process
+// environment; MESSAGE_ keys are read as well.
+var dotEnvKeys = []string{
+	"SERVER", "SERVERS", "SERVERS_FILE", "USER", "PASSWORD",
+	"PASSWORD_SECRET_REF", "HOST_PASSWORD_SECRET_REFS", "PASSWORD_SECRET_REF_TEMPLATE", "PASSWORD_PROVIDER",
+	"KEY", "PUBKEY", "PUBKEY_FILE", "PORT", "TIMEOUT", "INSECURE_IGNORE_HOST_KEY",
+	"IDENTITY_FILE", "AUTH_METHODS", "AUTH_KEY_SOURCE", "KEY_POLICY", "OPERATIONS", "LOCALE", "KNOWN_HOSTS",
+}
+
+// ApplyEnvironmentWithMetadata loads the .env keys from the process
+// environment, for container mode where the environment is the config.
+// Values are taken literally; ${NAME} is not expanded.
+func ApplyEnvironmentWithMetadata(programOptions *Options) (map[string]bool, error) {
+	environmentValues := map[string]string{}
+	for _, key := range dotEnvKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			environmentValues[key] = value
+		}
+	}
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(key, dotEnvMessagePrefix) {
+			environmentValues[key] = value
+		}
+	}
+	loadedFieldNames, err := applyDotEnvValues(programOptions, environmentValues)
+	if err != nil {
+		return nil, fmt.Errorf("environment config: %w", err)
+	}
+	return loadedFieldNames, nil
+}
+
+// ApplyContentWithMetadata loads a config that was not read from a file, such
+// as one piped to --config-from-stdin: JSON when it starts with "{", .env
+// otherwise. Encrypted content is decrypted as for a file named name.
+func ApplyContentWithMetadata(programOptions *Options, name string, content []byte) (map[string]bool, error) {
+	if IsEncrypted(content) {
+		plaintext, err := DecryptFile(name, content)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", name, err)
+		}
+		content = plaintext
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), []byte("{")) {
+		return applyJSONContent(programOptions, content)
+	}
+	return applyDotEnvContent(programOptions, content)
+}
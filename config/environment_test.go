@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyFilesContainerReadsTheEnvironment(t *testing.T) {
+	t.Setenv("SERVERS", "app01,app02")
+	t.Setenv("USER", "deploy")
+	t.Setenv("PORT", "2222")
+	t.Setenv("MESSAGE_PROMPT_SSH_USERNAME", "Login: ")
+	t.Setenv("PASSWORD", "${NOT_EXPANDED}")
+
+	opts := &Options{Container: true}
+	runtimeIO := &scriptedRuntimeIO{interactive: true}
+	if err := ApplyFiles(opts, runtimeIO); err != nil {
+		t.Fatalf("ApplyFiles() error = %v", err)
+	}
+	if opts.Servers != "app01,app02" || opts.User != "deploy" || opts.Port != 2222 || opts.Password != "${NOT_EXPANDED}" {
+		t.Fatalf("options = %+v", opts)
+	}
+	if opts.Messages["prompt_ssh_username"] != "Login: " {
+		t.Fatalf("Messages = %v", opts.Messages)
+	}
+	if runtimeIO.promptCalls != 0 {
+		t.Fatalf("container mode prompted %d time(s), want no discovery prompt", runtimeIO.promptCalls)
+	}
+
+	t.Setenv("PORT", "ssh")
+	if err := ApplyFiles(&Options{Container: true}, runtimeIO); err == nil || !strings.Contains(err.Error(), "environment config: .env key PORT must be an integer") {
+		t.Fatalf("ApplyFiles() with PORT=ssh error = %v", err)
+	}
+}
+
+func TestApplyContentWithMetadataDetectsTheFormat(t *testing.T) {
+	t.Parallel()
+
+	dotEnvOptions := &Options{}
+	loaded, err := ApplyContentWithMetadata(dotEnvOptions, "stdin", []byte("SERVERS=app01\nUSER=deploy\n"))
+	if err != nil {
+		t.Fatalf("ApplyContentWithMetadata(.env) error = %v", err)
+	}
+	if dotEnvOptions.Servers != "app01" || dotEnvOptions.User != "deploy" || !loaded["servers"] {
+		t.Fatalf(".env options = %+v, loaded = %v", dotEnvOptions, loaded)
+	}
+
+	jsonOptions := &Options{}
+	if _, err := ApplyContentWithMetadata(jsonOptions, "stdin", []byte("\n  {\"servers\": \"db01\", \"port\": 2200}\n")); err != nil {
+		t.Fatalf("ApplyContentWithMetadata(JSON) error = %v", err)
+	}
+	if jsonOptions.Servers != "db01" || jsonOptions.Port != 2200 {
+		t.Fatalf("JSON options = %+v", jsonOptions)
+	}
+
+	if _, err := ApplyContentWithMetadata(&Options{}, "stdin", []byte(encryptedConfigHeader+"\nAAAA\n")); err == nil || !strings.Contains(err.Error(), "decrypt stdin") {
+		t.Fatalf("ApplyContentWithMetadata(encrypted) error = %v", err)
+	}
+}
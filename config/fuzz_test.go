@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParseDotEnvContent feeds arbitrary .env files to the parser. Whatever
+// it accepts must have valid keys and survive being written back the way
+// RenderDotEnv quotes values.
+func FuzzParseDotEnvContent(f *testing.F) {
+	for _, seed := range []string{
+		"SERVERS=app01,app02:2222\nUSER=deploy\n",
+		"export PASSWORD='p@ss # not a comment'\n# comment\n\nKEY=\"ssh-ed25519 AAAA\\tkey\"\n",
+		"PORT=22 # trailing comment\nKNOWN_HOSTS=~/.ssh/known_hosts\r\n",
+		"REGION=eu\nSERVERS=${REGION}-web01\n",
+		"=value\n",
+		"KEY=\"unterminated\n",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, content string) {
+		values, err := parseDotEnvContent(content)
+		if err != nil {
+			return
+		}
+		var rendered strings.Builder
+		for key, value := range values {
+			if !isValidDotEnvKey(key) || key != strings.ToUpper(key) {
+				t.Fatalf("parsed invalid key %q from %q", key, content)
+			}
+			rendered.WriteString(key + "=" + quoteDotEnvValue(value) + "\n")
+		}
+		reparsed, err := parseDotEnvContent(rendered.String())
+		if err != nil {
+			t.Fatalf("rendered values do not parse: %v\n%s", err, rendered.String())
+		}
+		for key, value := range values {
+			if reparsed[key] != value {
+				t.Fatalf("%s = %q after rendering, want %q\n%s", key, reparsed[key], value, rendered.String())
+			}
+		}
+	})
+}
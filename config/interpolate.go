@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lookupFunc resolves a variable referenced as ${NAME} in a config value.
+type lookupFunc func(name string) (string, bool)
+
+// interpolationLookup returns how ${NAME} references in config values are
+// resolved: from the environment, or not at all with --no-interpolate.
+func interpolationLookup(programOptions *Options) lookupFunc {
+	if programOptions.NoInterpolate {
+		return nil
+	}
+	return os.LookupEnv
+}
+
+// interpolateValue replaces ${NAME} and ${NAME:-default} with the value
+// lookup returns, so one config can serve several environments, e.g.
+// SERVERS=${REGION}-web01. $${ is a literal "${". A "$" that does not start a
+// reference is kept, so passwords containing "$" are unaffected. An unset
+// variable without a default is an error rather than an empty value, which
+// would silently change the meaning of the config.
+func interpolateValue(value string, lookup lookupFunc) (string, error) {
+	if lookup == nil || !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var builder strings.Builder
+	for remaining := value; remaining != ""; {
+		referenceIndex := strings.Index(remaining, "${")
+		if referenceIndex < 0 {
+			builder.WriteString(remaining)
+			break
+		}
+		if referenceIndex > 0 && remaining[referenceIndex-1] == '$' {
+			builder.WriteString(remaining[:referenceIndex-1] + "${")
+			remaining = remaining[referenceIndex+2:]
+			continue
+		}
+		builder.WriteString(remaining[:referenceIndex])
+
+		closingIndex := strings.IndexByte(remaining[referenceIndex:], '}')
+		if closingIndex < 0 {
+			return "", fmt.Errorf("unterminated variable reference %q (use $${ for a literal ${)", remaining[referenceIndex:])
+		}
+		reference := remaining[referenceIndex+2 : referenceIndex+closingIndex]
+		name, defaultValue, hasDefault := strings.Cut(reference, ":-")
+		if !isValidDotEnvKey(name) {
+			return "", fmt.Errorf("invalid variable reference ${%s}", reference)
+		}
+		resolvedValue, ok := lookup(name)
+		switch {
+		case ok && (resolvedValue != "" || !hasDefault):
+			builder.WriteString(resolvedValue)
+		case hasDefault:
+			builder.WriteString(defaultValue)
+		default:
+			return "", fmt.Errorf("variable %s is not set (use ${%s:-default} for a fallback or --no-interpolate)", name, name)
+		}
+		remaining = remaining[referenceIndex+closingIndex+1:]
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolateValue(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(name string) (string, bool) {
+		values := map[string]string{"REGION": "eu1", "EMPTY": ""}
+		value, ok := values[name]
+		return value, ok
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"${REGION}-web01,${REGION}-web02", "eu1-web01,eu1-web02"},
+		{"${MISSING:-us1}-web01", "us1-web01"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${EMPTY}", ""},
+		{"literal $${REGION}", "literal ${REGION}"},
+		{"pa$$word$", "pa$$word$"},
+		{"no references", "no references"},
+	}
+	for _, test := range tests {
+		got, err := interpolateValue(test.value, lookup)
+		if err != nil || got != test.want {
+			t.Fatalf("interpolateValue(%q) = %q, %v, want %q", test.value, got, err, test.want)
+		}
+	}
+
+	for value, wantErr := range map[string]string{
+		"${MISSING}-web01": "variable MISSING is not set",
+		"${REGION":         "unterminated variable reference",
+		"${1BAD}":          "invalid variable reference",
+	} {
+		if _, err := interpolateValue(value, lookup); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("interpolateValue(%q) error = %v, want %q", value, err, wantErr)
+		}
+	}
+	if got, err := interpolateValue("${MISSING}", nil); err != nil || got != "${MISSING}" {
+		t.Fatalf("interpolateValue() without lookup = %q, %v", got, err)
+	}
+}
+
+func TestApplyDotEnvInterpolatesFromEnvironment(t *testing.T) {
+	t.Setenv("REGION", "eu1")
+
+	path := writeDotEnv(t, "SERVERS=${REGION}-web01,${REGION}-web02\nUSER=deploy\nKNOWN_HOSTS=\"~/.ssh/known_hosts_${USER}\"\nPASSWORD='pa${REGION}'\n")
+	opts := &Options{EnvFile: path}
+	if _, err := ApplyDotEnvWithMetadata(opts); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if opts.Servers != "eu1-web01,eu1-web02" {
+		t.Fatalf("Servers = %q", opts.Servers)
+	}
+	// Single-quoted values stay literal, as in a shell.
+	if opts.Password != "pa${REGION}" {
+		t.Fatalf("Password = %q, want it literal", opts.Password)
+	}
+
+	optOut := &Options{EnvFile: path, NoInterpolate: true}
+	if _, err := ApplyDotEnvWithMetadata(optOut); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata(--no-interpolate) error = %v", err)
+	}
+	if optOut.Servers != "${REGION}-web01,${REGION}-web02" {
+		t.Fatalf("Servers with --no-interpolate = %q", optOut.Servers)
+	}
+}
+
+func TestApplyDotEnvInterpolatesEarlierKeys(t *testing.T) {
+	path := writeDotEnv(t, "SITE_PREFIX=lab\nSERVERS=${SITE_PREFIX}-web01\n")
+	opts := &Options{EnvFile: path}
+	if _, err := ApplyDotEnvWithMetadata(opts); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if opts.Servers != "lab-web01" {
+		t.Fatalf("Servers = %q, want lab-web01", opts.Servers)
+	}
+}
+
+func TestApplyJSONInterpolatesFromEnvironment(t *testing.T) {
+	t.Setenv("REGION", "eu1")
+
+	path := writeJSONConfig(t, `{"servers": "${REGION}-web01", "hosts": [{"address": "${REGION}-db01", "user": "${DB_USER:-postgres}"}]}`)
+	opts := &Options{ConfigFile: path}
+	if _, err := ApplyJSONWithMetadata(opts); err != nil {
+		t.Fatalf("ApplyJSONWithMetadata() error = %v", err)
+	}
+	if opts.Servers != "eu1-web01" || opts.Hosts[0].Address != "eu1-db01" || opts.Hosts[0].User != "postgres" {
+		t.Fatalf("loaded = %q, %+v", opts.Servers, opts.Hosts)
+	}
+
+	missing := writeJSONConfig(t, `{"hosts": ["${UNSET_REGION_FOR_TEST}-web01"]}`)
+	if _, err := ApplyJSONWithMetadata(&Options{ConfigFile: missing}); err == nil || !strings.Contains(err.Error(), "hosts[0].address: variable UNSET_REGION_FOR_TEST is not set") {
+		t.Fatalf("ApplyJSONWithMetadata() error = %v", err)
+	}
+}
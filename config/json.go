@@ -0,0 +1,238 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HostSpec is a host entry from the JSON config's hosts array. Empty fields
+// fall back to the top-level settings.
+type HostSpec struct {
+	Address           string `json:"address"`
+	Port              int    `json:"port,omitempty"`
+	User              string `json:"user,omitempty"`
+	Key               string `json:"key,omitempty"`
+	PasswordSecretRef string `json:"passwordSecretRef,omitempty"`
+	Group             string `json:"group,omitempty"`
+}
+
+// UnmarshalJSON accepts either a plain "host[:port]" string or a host object.
+func (hostSpec *HostSpec) UnmarshalJSON(data []byte) error {
+	trimmedData := bytes.TrimSpace(data)
+	if len(trimmedData) > 0 && trimmedData[0] == '"' {
+		var address string
+		if err := json.Unmarshal(trimmedData, &address); err != nil {
+			return err
+		}
+		*hostSpec = HostSpec{Address: address}
+		return nil
+	}
+
+	type hostSpecObject HostSpec
+	var decodedSpec hostSpecObject
+	if err := decodeStrictJSON(trimmedData, &decodedSpec); err != nil {
+		return err
+	}
+	*hostSpec = HostSpec(decodedSpec)
+	return nil
+}
+
+type jsonConfig struct {
+	Server                *string           `json:"server,omitempty"`
+	Servers               *string           `json:"servers,omitempty"`
+	ServersFile           *string           `json:"serversFile,omitempty"`
+	User                  *string           `json:"user,omitempty"`
+	Password              *string           `json:"password,omitempty"`
+	PasswordSecretRef     *string           `json:"passwordSecretRef,omitempty"`
+	PasswordRefTemplate   *string           `json:"passwordSecretRefTemplate,omitempty"`
+	PasswordProvider      *string           `json:"passwordProvider,omitempty"`
+	AuthMethods           *string           `json:"authMethods,omitempty"`
+	AuthKeySource         *string           `json:"authKeySource,omitempty"`
+	Key                   *string           `json:"key,omitempty"`
+	IdentityFile          *string           `json:"identityFile,omitempty"`
+	KeyPolicy             *string           `json:"keyPolicy,omitempty"`
+	Port                  *int              `json:"port,omitempty"`
+	Timeout               *int              `json:"timeout,omitempty"`
+	InsecureIgnoreHostKey *bool             `json:"insecureIgnoreHostKey,omitempty"`
+	KnownHosts            *string           `json:"knownHosts,omitempty"`
+	Operations            *string           `json:"operations,omitempty"`
+	Hosts                 []HostSpec        `json:"hosts,omitempty"`
+	Locale                *string           `json:"locale,omitempty"`
+	Messages              map[string]string `json:"messages,omitempty"`
+}
+
+func ApplyJSONWithMetadata(programOptions *Options) (map[string]bool, error) {
+	if programOptions == nil {
+		return nil, errors.New("program options are required")
+	}
+
+	loadedFieldNames := map[string]bool{}
+	if strings.TrimSpace(programOptions.ConfigFile) == "" {
+		return loadedFieldNames, nil
+	}
+
+	configFilePath, err := expandHomePath(strings.TrimSpace(programOptions.ConfigFile))
+	if err != nil {
+		return nil, fmt.Errorf("resolve config path: %w", err)
+	}
+	configBytes, err := readConfigFile(configFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	return applyJSONContent(programOptions, configBytes)
+}
+
+func applyJSONContent(programOptions *Options, configBytes []byte) (map[string]bool, error) {
+	loadedFieldNames := map[string]bool{}
+	var parsedConfig jsonConfig
+	if err := decodeStrictJSON(configBytes, &parsedConfig); err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+	if err := interpolateJSONConfig(&parsedConfig, interpolationLookup(programOptions)); err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+	if err := validateHostSpecs(parsedConfig.Hosts); err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+
+	setString := func(value *string, fieldName string, trim bool, target *string) {
+		if value == nil {
+			return
+		}
+		*target = *value
+		if trim {
+			*target = strings.TrimSpace(*value)
+		}
+		loadedFieldNames[fieldName] = true
+	}
+
+	setString(parsedConfig.Server, "server", true, &programOptions.Server)
+	setString(parsedConfig.Servers, "servers", true, &programOptions.Servers)
+	setString(parsedConfig.ServersFile, "serversFile", true, &programOptions.ServersFile)
+	setString(parsedConfig.User, "user", true, &programOptions.User)
+	setString(parsedConfig.Password, "password", false, &programOptions.Password)
+	setString(parsedConfig.PasswordSecretRef, "passwordSecretRef", true, &programOptions.PasswordSecretRef)
+	setString(parsedConfig.PasswordRefTemplate, "passwordSecretRefTemplate", true, &programOptions.PasswordSecretRefTemplate)
+	setString(parsedConfig.AuthMethods, "authMethods", true, &programOptions.AuthMethods)
+	setString(parsedConfig.AuthKeySource, "authKeySource", true, &programOptions.AuthKeySource)
+	setString(parsedConfig.Key, "keyInput", true, &programOptions.KeyInput)
+	setString(parsedConfig.IdentityFile, "identityFile", true, &programOptions.IdentityFile)
+	setString(parsedConfig.KeyPolicy, "keyPolicy", true, &programOptions.KeyPolicy)
+	setString(parsedConfig.KnownHosts, "knownHosts", true, &programOptions.KnownHosts)
+	setString(parsedConfig.Operations, "operations", true, &programOptions.Operations)
+	if parsedConfig.PasswordProvider != nil {
+		programOptions.PasswordProvider = strings.ToLower(strings.TrimSpace(*parsedConfig.PasswordProvider))
+		loadedFieldNames["passwordProvider"] = true
+	}
+	if parsedConfig.Port != nil {
+		programOptions.Port = *parsedConfig.Port
+		loadedFieldNames["port"] = true
+	}
+	if parsedConfig.Timeout != nil {
+		programOptions.TimeoutSec = *parsedConfig.Timeout
+		loadedFieldNames["timeoutSec"] = true
+	}
+	if parsedConfig.InsecureIgnoreHostKey != nil {
+		programOptions.InsecureIgnoreHostKey = *parsedConfig.InsecureIgnoreHostKey
+		loadedFieldNames["insecureIgnoreHostKey"] = true
+	}
+	if parsedConfig.Hosts != nil {
+		programOptions.Hosts = parsedConfig.Hosts
+		loadedFieldNames["hosts"] = true
+	}
+	setString(parsedConfig.Locale, "locale", true, &programOptions.Locale)
+	if parsedConfig.Messages != nil {
+		programOptions.Messages = parsedConfig.Messages
+		loadedFieldNames["messages"] = true
+	}
+
+	return loadedFieldNames, nil
+}
+
+// interpolateJSONConfig expands ${NAME} references in every string value,
+// including those of host entries.
+func interpolateJSONConfig(parsedConfig *jsonConfig, lookup lookupFunc) error {
+	if lookup == nil {
+		return nil
+	}
+	type stringField struct {
+		name  string
+		value *string
+	}
+	fields := []stringField{
+		{"server", parsedConfig.Server},
+		{"servers", parsedConfig.Servers},
+		{"serversFile", parsedConfig.ServersFile},
+		{"user", parsedConfig.User},
+		{"password", parsedConfig.Password},
+		{"passwordSecretRef", parsedConfig.PasswordSecretRef},
+		{"passwordSecretRefTemplate", parsedConfig.PasswordRefTemplate},
+		{"passwordProvider", parsedConfig.PasswordProvider},
+		{"authMethods", parsedConfig.AuthMethods},
+		{"authKeySource", parsedConfig.AuthKeySource},
+		{"key", parsedConfig.Key},
+		{"identityFile", parsedConfig.IdentityFile},
+		{"keyPolicy", parsedConfig.KeyPolicy},
+		{"knownHosts", parsedConfig.KnownHosts},
+		{"operations", parsedConfig.Operations},
+		{"locale", parsedConfig.Locale},
+	}
+	for index := range parsedConfig.Hosts {
+		hostSpec := &parsedConfig.Hosts[index]
+		prefix := fmt.Sprintf("hosts[%d].", index)
+		fields = append(fields,
+			stringField{prefix + "address", &hostSpec.Address},
+			stringField{prefix + "user", &hostSpec.User},
+			stringField{prefix + "key", &hostSpec.Key},
+			stringField{prefix + "passwordSecretRef", &hostSpec.PasswordSecretRef},
+			stringField{prefix + "group", &hostSpec.Group},
+		)
+	}
+
+	for id := range parsedConfig.Messages {
+		interpolatedValue, err := interpolateValue(parsedConfig.Messages[id], lookup)
+		if err != nil {
+			return fmt.Errorf("messages.%s: %w", id, err)
+		}
+		parsedConfig.Messages[id] = interpolatedValue
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		interpolatedValue, err := interpolateValue(*field.value, lookup)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.value = interpolatedValue
+	}
+	return nil
+}
+
+func validateHostSpecs(hostSpecs []HostSpec) error {
+	for index, hostSpec := range hostSpecs {
+		if strings.TrimSpace(hostSpec.Address) == "" {
+			return fmt.Errorf("hosts[%d]: address is required", index)
+		}
+		if hostSpec.Port < 0 || hostSpec.Port > 65535 {
+			return fmt.Errorf("hosts[%d]: port must be in range 1..65535", index)
+		}
+	}
+	return nil
+}
+
+func decodeStrictJSON(data []byte, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after top-level JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeJSONConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestApplyJSONWithMetadataLoadsFieldsAndHosts(t *testing.T) {
+	t.Parallel()
+
+	path := writeJSONConfig(t, `{
+  "user": " deploy ",
+  "passwordSecretRef": "bw://shared",
+  "key": "~/.ssh/id_ed25519.pub",
+  "port": 2200,
+  "insecureIgnoreHostKey": true,
+  "hosts": [
+    "app01",
+    {"address": "db01", "port": 2222, "user": "postgres", "key": "ssh-ed25519 AAAA db", "passwordSecretRef": "bw://db", "group": "dc1"}
+  ]
+}`)
+	opts := &Options{ConfigFile: path}
+
+	loaded, err := ApplyJSONWithMetadata(opts)
+	if err != nil {
+		t.Fatalf("ApplyJSONWithMetadata() error = %v", err)
+	}
+	for _, fieldName := range []string{"user", "passwordSecretRef", "keyInput", "port", "insecureIgnoreHostKey", "hosts"} {
+		if !loaded[fieldName] {
+			t.Fatalf("field %q not reported as loaded: %v", fieldName, loaded)
+		}
+	}
+	if opts.User != "deploy" || opts.Port != 2200 || !opts.InsecureIgnoreHostKey {
+		t.Fatalf("options = %+v", opts)
+	}
+	if len(opts.Hosts) != 2 || opts.Hosts[0].Address != "app01" {
+		t.Fatalf("hosts = %+v", opts.Hosts)
+	}
+	if want := (HostSpec{Address: "db01", Port: 2222, User: "postgres", Key: "ssh-ed25519 AAAA db", PasswordSecretRef: "bw://db", Group: "dc1"}); opts.Hosts[1] != want {
+		t.Fatalf("hosts[1] = %+v, want %+v", opts.Hosts[1], want)
+	}
+}
+
+func TestApplyJSONWithMetadataRejectsInvalidConfigs(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"unknown top-level field": `{"usr": "deploy"}`,
+		"unknown host field":      `{"hosts": [{"address": "a", "pass": "x"}]}`,
+		"missing host address":    `{"hosts": [{"port": 22}]}`,
+		"invalid host port":       `{"hosts": [{"address": "a", "port": 70000}]}`,
+		"trailing data":           `{"user": "a"} {"user": "b"}`,
+		"wrong type":              `{"port": "22"}`,
+	}
+	for name, content := range testCases {
+		opts := &Options{ConfigFile: writeJSONConfig(t, content)}
+		if _, err := ApplyJSONWithMetadata(opts); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), "parse config file") {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+func TestApplyFilesRejectsEnvAndConfigTogether(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{EnvFile: "/tmp/a.env", ConfigFile: "/tmp/a.json"}
+	err := ApplyFiles(opts, &scriptedRuntimeIO{interactive: false})
+	if err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Fatalf("ApplyFiles() error = %v, want conflict error", err)
+	}
+}
+
+func TestApplyJSONWithMetadataLoadsLocaleAndMessages(t *testing.T) {
+	t.Parallel()
+
+	path := writeJSONConfig(t, `{"locale": "de", "messages": {"prompt_ssh_username": "Runbook step 3 - login user: "}}`)
+	opts := &Options{ConfigFile: path}
+
+	loaded, err := ApplyJSONWithMetadata(opts)
+	if err != nil {
+		t.Fatalf("ApplyJSONWithMetadata() error = %v", err)
+	}
+	if !loaded["locale"] || !loaded["messages"] {
+		t.Fatalf("loaded = %v", loaded)
+	}
+	if opts.Locale != "de" || opts.Messages["prompt_ssh_username"] != "Runbook step 3 - login user: " {
+		t.Fatalf("locale = %q, messages = %v", opts.Locale, opts.Messages)
+	}
+}
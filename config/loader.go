@@ -6,9 +6,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"ssh-key-bootstrap/messages"
 )
 
-const defaultBinaryDotEnvFilename = ".env"
+const (
+	defaultBinaryDotEnvFilename = ".env"
+	userConfigDotEnvFilename    = ".env"
+	userConfigJSONFilename      = "config.json"
+	userConfigDirName           = "ssh-key-bootstrap"
+)
 
 type RuntimeIO interface {
 	PromptLine(label string) (string, error)
@@ -25,15 +32,47 @@ func ApplyFiles(programOptions *Options, runtimeIO RuntimeIO) error {
 		return errors.New("runtime IO is required")
 	}
 
-	selectedDotEnvPath, err := resolveDotEnvSource(programOptions, runtimeIO)
-	if err != nil {
+	if strings.TrimSpace(programOptions.ConfigDir) != "" {
+		if strings.TrimSpace(programOptions.EnvFile) != "" || strings.TrimSpace(programOptions.ConfigFile) != "" || strings.TrimSpace(programOptions.Context) != "" {
+			return errors.New("use --config-dir without --env, --config or --context")
+		}
+		_, err := ApplyDirWithMetadata(programOptions)
 		return err
 	}
-	if selectedDotEnvPath == "" {
+	if strings.TrimSpace(programOptions.Context) != "" {
+		if err := selectContextConfig(programOptions); err != nil {
+			return err
+		}
+	} else if strings.TrimSpace(programOptions.ConfigFile) == "" && strings.TrimSpace(programOptions.EnvFile) == "" {
+		// A container takes its config from the environment; a config file
+		// baked into the image or next to the binary is never picked up.
+		if programOptions.Container {
+			_, err := ApplyEnvironmentWithMetadata(programOptions)
+			return err
+		}
+		if err := selectDiscoveredConfig(programOptions, runtimeIO); err != nil {
+			return err
+		}
+	}
+
+	if strings.TrimSpace(programOptions.ConfigFile) != "" {
+		if strings.TrimSpace(programOptions.EnvFile) != "" {
+			return errors.New("use either --env or --config, not both")
+		}
+		loadedFieldNames, err := ApplyJSONWithMetadata(programOptions)
+		if err != nil {
+			return err
+		}
+		if runtimeIO.IsInteractive() {
+			confirmLoadedConfigFields(programOptions, loadedFieldNames, runtimeIO)
+		}
+		return nil
+	}
+	programOptions.EnvFile = strings.TrimSpace(programOptions.EnvFile)
+	if programOptions.EnvFile == "" {
 		return nil
 	}
 
-	programOptions.EnvFile = selectedDotEnvPath
 	loadedFieldNames, err := ApplyDotEnvWithMetadata(programOptions)
 	if err != nil {
 		return err
@@ -44,31 +83,70 @@ func ApplyFiles(programOptions *Options, runtimeIO RuntimeIO) error {
 	return nil
 }
 
-func resolveDotEnvSource(programOptions *Options, runtimeIO RuntimeIO) (string, error) {
-	explicitDotEnvPath := strings.TrimSpace(programOptions.EnvFile)
-	if explicitDotEnvPath != "" {
-		return explicitDotEnvPath, nil
-	}
+// selectDiscoveredConfig offers a config found without --env or --config and
+// sets EnvFile or ConfigFile when the operator accepts it. The user config
+// directory wins over a .env next to the binary, which is often in a shared
+// directory such as /usr/local/bin. Discovery only happens interactively.
+func selectDiscoveredConfig(programOptions *Options, runtimeIO RuntimeIO) error {
 	if !runtimeIO.IsInteractive() {
-		return "", nil
+		return nil
 	}
-
-	discoveredDotEnvPath, err := discoverConfigFileNearBinary()
+	discoveredPath, isJSON, err := discoverUserConfigFile()
 	if err != nil {
-		return "", err
+		return err
+	}
+	if discoveredPath == "" {
+		if discoveredPath, err = discoverConfigFileNearBinary(); err != nil {
+			return err
+		}
 	}
-	if discoveredDotEnvPath == "" {
-		return "", nil
+	if discoveredPath == "" {
+		return nil
 	}
 
-	useDotEnv, err := promptUseSingleConfigSource(runtimeIO, ".env", discoveredDotEnvPath)
-	if err != nil {
-		return "", err
+	useConfig, err := promptUseSingleConfigSource(runtimeIO, filepath.Base(discoveredPath), discoveredPath)
+	if err != nil || !useConfig {
+		return err
+	}
+	if isJSON {
+		programOptions.ConfigFile = discoveredPath
+	} else {
+		programOptions.EnvFile = discoveredPath
 	}
-	if !useDotEnv {
-		return "", nil
+	return nil
+}
+
+// UserConfigDir is $XDG_CONFIG_HOME/ssh-key-bootstrap, or
+// ~/.config/ssh-key-bootstrap when XDG_CONFIG_HOME is unset.
+func UserConfigDir() (string, error) {
+	if base := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); filepath.IsAbs(base) {
+		return filepath.Join(base, userConfigDirName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve config directory: %w", err)
 	}
-	return discoveredDotEnvPath, nil
+	return filepath.Join(home, ".config", userConfigDirName), nil
+}
+
+// discoverUserConfigFile returns the .env or config.json in UserConfigDir.
+// Having both is ambiguous and an error.
+func discoverUserConfigFile() (string, bool, error) {
+	configDir, err := UserConfigDir()
+	if err != nil {
+		return "", false, err
+	}
+	dotEnvPath := filepath.Join(configDir, userConfigDotEnvFilename)
+	jsonPath := filepath.Join(configDir, userConfigJSONFilename)
+	switch hasDotEnv, hasJSON := fileExists(dotEnvPath), fileExists(jsonPath); {
+	case hasDotEnv && hasJSON:
+		return "", false, fmt.Errorf("both %s and %s exist; remove one or pass --env or --config", dotEnvPath, jsonPath)
+	case hasDotEnv:
+		return dotEnvPath, false, nil
+	case hasJSON:
+		return jsonPath, true, nil
+	}
+	return "", false, nil
 }
 
 func discoverConfigFileNearBinary() (string, error) {
@@ -87,7 +165,7 @@ func discoverConfigFileNearBinary() (string, error) {
 
 func promptUseSingleConfigSource(runtimeIO RuntimeIO, displayName, sourcePath string) (bool, error) {
 	for {
-		answer, err := runtimeIO.PromptLine(fmt.Sprintf("Found %s next to the binary at %q. Use it? [y/n]: ", displayName, sourcePath))
+		answer, err := runtimeIO.PromptLine(messages.Get(messages.PromptUseFoundConfig, displayName, sourcePath))
 		if err != nil {
 			return false, err
 		}
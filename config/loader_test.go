@@ -43,33 +43,34 @@ func (runtime *scriptedRuntimeIO) IsInteractive() bool {
 	return runtime.interactive
 }
 
-func TestResolveDotEnvSourceExplicitPath(t *testing.T) {
+func TestApplyFilesTrimsExplicitEnvPath(t *testing.T) {
 	t.Parallel()
 
-	runtime := &scriptedRuntimeIO{interactive: true}
-	opts := &Options{EnvFile: "  /tmp/custom.env  "}
+	dotEnvPath := filepath.Join(t.TempDir(), "custom.env")
+	if err := os.WriteFile(dotEnvPath, []byte("USER=explicit\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	opts := &Options{EnvFile: "  " + dotEnvPath + "  "}
 
-	path, err := resolveDotEnvSource(opts, runtime)
-	if err != nil {
-		t.Fatalf("resolveDotEnvSource() error = %v", err)
+	if err := ApplyFiles(opts, &scriptedRuntimeIO{interactive: false}); err != nil {
+		t.Fatalf("ApplyFiles() error = %v", err)
 	}
-	if path != "/tmp/custom.env" {
-		t.Fatalf("resolveDotEnvSource() = %q, want %q", path, "/tmp/custom.env")
+	if opts.EnvFile != dotEnvPath || opts.User != "explicit" {
+		t.Fatalf("EnvFile = %q, User = %q", opts.EnvFile, opts.User)
 	}
 }
 
-func TestResolveDotEnvSourceNonInteractiveWithoutExplicit(t *testing.T) {
+func TestSelectDiscoveredConfigNonInteractive(t *testing.T) {
 	t.Parallel()
 
 	runtime := &scriptedRuntimeIO{interactive: false}
 	opts := &Options{}
 
-	path, err := resolveDotEnvSource(opts, runtime)
-	if err != nil {
-		t.Fatalf("resolveDotEnvSource() error = %v", err)
+	if err := selectDiscoveredConfig(opts, runtime); err != nil {
+		t.Fatalf("selectDiscoveredConfig() error = %v", err)
 	}
-	if path != "" {
-		t.Fatalf("resolveDotEnvSource() = %q, want empty", path)
+	if opts.EnvFile != "" || opts.ConfigFile != "" || runtime.promptCalls != 0 {
+		t.Fatalf("non-interactive discovery selected %q/%q after %d prompts", opts.EnvFile, opts.ConfigFile, runtime.promptCalls)
 	}
 }
 
@@ -249,19 +250,19 @@ func ensureDotEnvNearBinary(t *testing.T, content string) string {
 	return dotEnvPath
 }
 
-func TestResolveDotEnvSourceInteractiveDiscovery(t *testing.T) {
+func TestSelectDiscoveredConfigNearBinary(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	dotEnvPath := ensureDotEnvNearBinary(t, "USER=discover\n")
 
 	t.Run("accepts discovered dot env", func(t *testing.T) {
 		runtime := &scriptedRuntimeIO{interactive: true, answers: []string{"y"}}
 		opts := &Options{}
 
-		path, err := resolveDotEnvSource(opts, runtime)
-		if err != nil {
-			t.Fatalf("resolveDotEnvSource() error = %v", err)
+		if err := selectDiscoveredConfig(opts, runtime); err != nil {
+			t.Fatalf("selectDiscoveredConfig() error = %v", err)
 		}
-		if path != dotEnvPath {
-			t.Fatalf("resolveDotEnvSource() = %q, want %q", path, dotEnvPath)
+		if opts.EnvFile != dotEnvPath {
+			t.Fatalf("EnvFile = %q, want %q", opts.EnvFile, dotEnvPath)
 		}
 		if runtime.promptCalls != 1 {
 			t.Fatalf("prompt calls = %d, want 1", runtime.promptCalls)
@@ -272,15 +273,43 @@ func TestResolveDotEnvSourceInteractiveDiscovery(t *testing.T) {
 		runtime := &scriptedRuntimeIO{interactive: true, answers: []string{"n"}}
 		opts := &Options{}
 
-		path, err := resolveDotEnvSource(opts, runtime)
-		if err != nil {
-			t.Fatalf("resolveDotEnvSource() error = %v", err)
+		if err := selectDiscoveredConfig(opts, runtime); err != nil {
+			t.Fatalf("selectDiscoveredConfig() error = %v", err)
 		}
-		if path != "" {
-			t.Fatalf("resolveDotEnvSource() = %q, want empty", path)
+		if opts.EnvFile != "" {
+			t.Fatalf("EnvFile = %q, want empty", opts.EnvFile)
 		}
 		if runtime.promptCalls != 1 {
 			t.Fatalf("prompt calls = %d, want 1", runtime.promptCalls)
 		}
 	})
 }
+
+func TestSelectDiscoveredConfigPrefersUserConfigDir(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	ensureDotEnvNearBinary(t, "USER=binary\n")
+	configDir := filepath.Join(configHome, userConfigDirName)
+	if err := os.MkdirAll(configDir, 0o700); err != nil {
+		t.Fatalf("create config dir: %v", err)
+	}
+	jsonPath := filepath.Join(configDir, userConfigJSONFilename)
+	if err := os.WriteFile(jsonPath, []byte(`{"user":"xdg"}`), 0o600); err != nil {
+		t.Fatalf("write config.json: %v", err)
+	}
+
+	opts := &Options{}
+	if err := selectDiscoveredConfig(opts, &scriptedRuntimeIO{interactive: true, answers: []string{"y"}}); err != nil {
+		t.Fatalf("selectDiscoveredConfig() error = %v", err)
+	}
+	if opts.ConfigFile != jsonPath || opts.EnvFile != "" {
+		t.Fatalf("ConfigFile = %q, EnvFile = %q; want the user config", opts.ConfigFile, opts.EnvFile)
+	}
+
+	if err := os.WriteFile(filepath.Join(configDir, userConfigDotEnvFilename), []byte("USER=xdg\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	if err := selectDiscoveredConfig(&Options{}, &scriptedRuntimeIO{interactive: true}); err == nil || !strings.Contains(err.Error(), "both") {
+		t.Fatalf("selectDiscoveredConfig() error = %v, want ambiguity error", err)
+	}
+}
@@ -1,17 +1,133 @@
 package config
 
+import "time"
+
 type Options struct {
 	Server            string // Single host input (host or host:port).
 	Servers           string // Comma-separated host list input.
+	ServersFile       string // File with one host per line; "-" reads stdin.
+	HostsFile         string // CLI-only /etc/hosts style file whose names are targeted.
+	Discover          string // CLI-only host discovery method ("mdns"); the operator picks from the hosts found.
+	NmapXML           string // CLI-only nmap/masscan XML report; hosts with the SSH port open are targeted.
+	NetBoxURL         string // CLI-only NetBox base URL; the primary IPs of its active devices are targeted.
+	NetBoxTokenRef    string // CLI-only secret ref of the NetBox API token; NETBOX_TOKEN when empty.
+	NetBoxSite        string // CLI-only comma-separated NetBox site slugs the devices must be in.
+	NetBoxRole        string // CLI-only comma-separated NetBox device role slugs.
+	ZabbixURL         string // CLI-only Zabbix frontend URL; the agent interfaces of its monitored hosts are targeted.
+	ZabbixTokenRef    string // CLI-only secret ref of the Zabbix API token; ZABBIX_TOKEN when empty.
+	NagiosCfg         string // CLI-only Nagios object config file or directory; its hosts are targeted.
+	LDAPURL           string // CLI-only LDAP server URL; the dNSHostName of its enabled computer objects is targeted.
+	LDAPBase          string // CLI-only LDAP search base (domain or OU) of the computer objects.
+	LDAPFilter        string // CLI-only LDAP filter the computer objects must match as well.
+	LDAPBindDN        string // CLI-only LDAP bind DN (or user@domain); anonymous when empty.
+	LDAPPasswordRef   string // CLI-only secret ref of the LDAP bind password; LDAP_PASSWORD when empty.
+	KeyLDAPURL        string // CLI-only LDAP server URL ldap:<filter> key inputs are looked up in.
+	KeyLDAPBase       string // CLI-only LDAP search base of the user entries ldap: key inputs match.
+	IPAURL            string // CLI-only FreeIPA server URL ipa:<user> key inputs are looked up in.
+	IPAUser           string // CLI-only FreeIPA account that reads the keys.
+	IPAPasswordRef    string // CLI-only secret ref of the FreeIPA password; IPA_PASSWORD when empty.
+	KeycloakURL       string // CLI-only Keycloak URL keycloak:<user> key inputs are looked up in.
+	KeycloakRealm     string // CLI-only Keycloak realm of the users.
+	KeycloakClientID  string // CLI-only Keycloak client whose service account reads the users.
+	KeycloakSecretRef string // CLI-only secret ref of the Keycloak client secret; KEYCLOAK_CLIENT_SECRET when empty.
 	User              string
 	Password          string // #nosec G117 -- runtime-only credential container for user input and secret resolution
 	PasswordSecretRef string
-	PasswordProvider  string
-	KeyInput          string
-	EnvFile           string
-	Port              int
-	TimeoutSec        int
+	// PasswordSecretRefTemplate derives a secret ref for every host without
+	// one, e.g. "infisical://hosts/{{.Host}}/root-password".
+	PasswordSecretRefTemplate string
+	PasswordProvider          string
+	// HostPasswordSecretRefs holds comma-separated host=secret-ref pairs that
+	// override the shared password for individual hosts.
+	HostPasswordSecretRefs string
+	AuthMethods            string // Login methods in the order tried (password, publickey; gssapi only with UseOpenSSH); empty means password only.
+	AuthKeySource          string // Publickey login key: agent (default), fido-resident or pkcs11:<module path>.
+	KeyInput               string
+	KeyInputs              []string      // CLI-only --key values installed in addition to KeyInput.
+	KeyFiles               []string      // CLI-only --key-file paths whose keys are installed in addition to KeyInput.
+	KeysDir                string        // CLI-only directory whose *.pub files are reviewed and installed.
+	KeyPolicy              string        // Rules the installed key must pass, e.g. "min-rsa-bits=3072,no-dsa".
+	IdentityFile           string        // Private key matching KeyInput; used to verify key login before hardening.
+	KeyComment             string        // CLI-only comment template stamped onto the installed key.
+	KeyExpires             string        // CLI-only expiry date (YYYY-MM-DD) recorded in the ledger.
+	LedgerFile             string        // CLI-only ledger path override.
+	RecordLedger           bool          // CLI-only; record every installation in the ledger.
+	Events                 string        // CLI-only event stream format ("ndjson").
+	RunID                  string        // CLI-only run ID for logs, events and the ledger; generated when empty.
+	ExplainExit            string        // CLI-only; print the meaning of an exit code and exit.
+	JSONOutput             bool          // CLI-only; commands that support it print JSON (version --json).
+	FailedHostsOut         string        // CLI-only file that receives failed hosts in servers-file format.
+	Report                 string        // CLI-only post-run report file; .md for Markdown, .html for HTML.
+	CSVFile                string        // CLI-only file that receives one CSV row per host.
+	Limit                  string        // CLI-only host filter: globs, ~regex and !exclusions.
+	LockFile               string        // CLI-only run lock path; run.lock in the state directory when empty.
+	IgnoreLock             bool          // CLI-only; run without taking the run lock.
+	Order                  string        // CLI-only host execution order: sorted (default), input, random or by-latency.
+	StreamHosts            bool          // CLI-only; run each servers-file host as it is read instead of loading the inventory first.
+	Sample                 string        // CLI-only random host subset: a count ("10") or a percentage ("5%").
+	DedupeIP               bool          // CLI-only; resolve host names and drop targets that reach the same addresses and port.
+	PlanFormat             string        // CLI-only; print the plan (text or json) and exit without connecting.
+	AssumeYes              bool          // CLI-only; skip the large-run confirmation.
+	ConfirmOver            int           // CLI-only host count above which the run asks for confirmation; 0 disables.
+	ApproveCmd             string        // CLI-only shell command that gets the JSON plan on stdin; the run goes on only when it exits 0.
+	MaxHostsPerPassword    int           // CLI-only --require-per-host-credentials limit on hosts sharing one password; 0 disables.
+	StrictPerms            bool          // CLI-only; fail instead of warn when config or key files are group/world accessible.
+	ConfirmPassword        bool          // CLI-only; ask for a prompted password twice and compare.
+	PromptTimeout          time.Duration // CLI-only limit on how long a password prompt waits for an answer; 0 waits forever.
+	ValidateAuth           string        // CLI-only host to log in to before the run; "true" means the first host.
+	FallbackUsers          string        // CLI-only comma-separated users tried when the server refuses the configured user.
+	Preset                 string        // CLI-only cloud defaults for fresh images: aws, gcp, azure or hetzner.
+	MinHostKeyStrength     string        // CLI-only weakest accepted host key: any, sha2 or ed25519.
+	PreferED25519          bool          // CLI-only; negotiate ed25519 host keys first when a server offers several.
+	ExpectFingerprints     []string      // CLI-only host=SHA256:... host keys trusted on first contact without a prompt.
+	AcceptNewHostKeys      bool          // CLI-only; trust unknown host keys without the prompt (changed keys are still refused).
+	CreateHome             bool          // CLI-only; create the login user's missing home directory instead of failing.
+	CopySource             string        // CLI-only local file the copy-file operation pushes.
+	CopyDest               string        // CLI-only remote path for copy-file: absolute, or ~/ for the login user's home.
+	CopyMode               string        // CLI-only octal mode of the copied file; defaults to the source file's mode.
+	RemoteCommand          string        // CLI-only command the run-command operation runs on every host.
+	ServiceSchedule        string        // CLI-only install-service schedule: a systemd calendar or, with ServiceCron, a cron schedule.
+	ServiceDir             string        // CLI-only directory install-service writes the systemd units to.
+	ServiceCron            bool          // CLI-only; install-service prints a crontab line instead of writing systemd units.
+	SSHDPolicy             string        // CLI-only directive=value rules audit-sshd checks; empty uses the default policy.
+	KnownHostsOut          string        // CLI-only file that receives newly trusted host keys instead of KnownHosts.
+	KnownHostsDir          string        // CLI-only directory with one known_hosts file per host, checked besides KnownHosts.
+	Verbose                bool          // CLI-only; print per-host connection details such as the SSH banner.
+	DebugSSH               bool          // CLI-only; log SSH handshake details per host to the run log.
+	UseOpenSSH             bool          // CLI-only; execute through the system ssh client instead of the Go client.
+	Transport              string        // CLI-only byte stream SSH runs over: tcp (default), ssm, teleport or boundary.
+	Jump                   string        // CLI-only [user@]host[:port] the built-in client reaches hosts through.
+	JumpConnections        int           // CLI-only cap on SSH connections to the jump host, shared by all targets.
+	ConnectRate            int           // CLI-only cap on new SSH connections per second; 0 means unlimited.
+	HostDelay              time.Duration // CLI-only pause between consecutive hosts.
+	HostJitter             time.Duration // CLI-only upper bound of a random extra pause between hosts.
+	BanPause               time.Duration // CLI-only pause taken once when connection resets suggest an IPS ban; 0 disables.
+	WaitUp                 time.Duration // CLI-only time to wait for hosts' SSH ports to answer before the run; 0 disables.
+	CommandTimeout         time.Duration // CLI-only limit on how long one remote command may run; 0 disables.
+	MaxOutput              int           // CLI-only limit on the bytes one remote command may print; 0 disables.
+	Watch                  time.Duration // CLI-only time to keep retrying hosts that failed to connect; 0 disables.
+	WatchInterval          time.Duration // CLI-only pause between --watch retry rounds.
+	Again                  string        // CLI-only; repeat the last run on all its hosts ("all") or only the failed ones ("failed").
+	RepeatHosts            []string      // CLI-only hosts --again pins the run to; set from the saved run.
+	EnvFile                string
+	ConfigFile             string     // JSON config file (--config); alternative to EnvFile.
+	Context                string     // CLI-only named config set under the user config dir's contexts/; replaces EnvFile and ConfigFile.
+	AgeIdentity            string     // CLI-only age identity file used to decrypt an age-encrypted config.
+	ConfigFromStdin        bool       // CLI-only; read the .env or JSON config from stdin instead of a file.
+	ConfigDir              string     // CLI-only directory with one file per .env key, e.g. a mounted Kubernetes Secret.
+	Container              bool       // Container mode (SSH_KEY_BOOTSTRAP_CONTAINER): config from the environment, no config discovery, no log file.
+	RecordSecrets          string     // CLI-only fixture file that receives every secret provider answer.
+	ReplaySecrets          string     // CLI-only fixture file secret refs are answered from instead of the providers.
+	NoInterpolate          bool       // CLI-only; load ${VAR} in config values literally instead of from the environment.
+	Hosts                  []HostSpec // Per-host entries from the JSON config.
+	Port                   int
+	TimeoutSec             int
 	// InsecureIgnoreHostKey disables SSH host key verification; unsafe for production (MITM risk).
 	InsecureIgnoreHostKey bool
 	KnownHosts            string
+	Operations            string // Comma-separated remote operation names; defaults to install-key.
+	Locale                string // Prompt and status language (en, de); empty follows LC_ALL, LC_MESSAGES or LANG.
+	// Messages replaces individual prompt and status strings, keyed by
+	// message ID (see package messages).
+	Messages map[string]string
 }
@@ -13,7 +13,24 @@ import (
 const maxDotEnvLineBytes = 1024 * 1024
 
 func parseDotEnvContent(dotEnvContent string) (map[string]string, error) {
+	return parseDotEnvContentWithLookup(dotEnvContent, nil)
+}
+
+// parseDotEnvContentWithLookup parses like parseDotEnvContent and interpolates
+// ${NAME} references in unquoted and double-quoted values, as a shell would.
+// Names lookup does not know fall back to keys set earlier in the file.
+func parseDotEnvContentWithLookup(dotEnvContent string, lookup lookupFunc) (map[string]string, error) {
 	parsedValues := map[string]string{}
+	var valueLookup lookupFunc
+	if lookup != nil {
+		valueLookup = func(name string) (string, bool) {
+			if value, ok := lookup(name); ok {
+				return value, true
+			}
+			value, ok := parsedValues[strings.ToUpper(name)]
+			return value, ok
+		}
+	}
 	lineScanner := bufio.NewScanner(strings.NewReader(normalizeLF(dotEnvContent)))
 	lineScanner.Buffer(make([]byte, 0, 4096), maxDotEnvLineBytes)
 	lineNumber := 0
@@ -47,6 +64,11 @@ func parseDotEnvContent(dotEnvContent string) (map[string]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
 		}
+		if !strings.HasPrefix(rawValue, "'") {
+			if parsedValue, err = interpolateValue(parsedValue, valueLookup); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
 		parsedValues[strings.ToUpper(key)] = parsedValue
 	}
 
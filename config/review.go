@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"slices"
 	"strings"
+
+	"ssh-key-bootstrap/messages"
 )
 
 const maxDefaultPreviewLength = 80
@@ -19,7 +22,7 @@ func confirmLoadedConfigFields(programOptions *Options, loadedFieldNames map[str
 		return
 	}
 
-	runtimeIO.Println("Loaded configuration values:")
+	runtimeIO.Println(messages.Get(messages.LoadedConfigValues))
 	for _, field := range configFields() {
 		if !loadedFieldNames[field.key] {
 			continue
@@ -32,15 +35,26 @@ func configFields() []configField {
 	return []configField{
 		{key: "server", label: "Server", kind: "text", get: func(optionsValue *Options) string { return optionsValue.Server }},
 		{key: "servers", label: "Servers", kind: "text", get: func(optionsValue *Options) string { return optionsValue.Servers }},
+		{key: "serversFile", label: "Servers File", kind: "text", get: func(optionsValue *Options) string { return optionsValue.ServersFile }},
 		{key: "user", label: "SSH User", kind: "text", get: func(optionsValue *Options) string { return optionsValue.User }},
 		{key: "password", label: "SSH Password", kind: "password", get: func(optionsValue *Options) string { return optionsValue.Password }},
 		{key: "passwordSecretRef", label: "Password Secret Ref", kind: "secretref", get: func(optionsValue *Options) string { return optionsValue.PasswordSecretRef }},
+		{key: "hostPasswordSecretRefs", label: "Host Password Secret Refs", kind: "secretref", get: func(optionsValue *Options) string { return optionsValue.HostPasswordSecretRefs }},
+		{key: "passwordSecretRefTemplate", label: "Password Secret Ref Template", kind: "text", get: func(optionsValue *Options) string { return optionsValue.PasswordSecretRefTemplate }},
 		{key: "passwordProvider", label: "Password Provider", kind: "text", get: func(optionsValue *Options) string { return optionsValue.PasswordProvider }},
+		{key: "authMethods", label: "Auth Methods", kind: "text", get: func(optionsValue *Options) string { return optionsValue.AuthMethods }},
+		{key: "authKeySource", label: "Auth Key Source", kind: "text", get: func(optionsValue *Options) string { return optionsValue.AuthKeySource }},
 		{key: "keyInput", label: "Public Key Input", kind: "publickey", get: func(optionsValue *Options) string { return optionsValue.KeyInput }},
+		{key: "identityFile", label: "Identity File", kind: "text", get: func(optionsValue *Options) string { return optionsValue.IdentityFile }},
+		{key: "keyPolicy", label: "Key Policy", kind: "text", get: func(optionsValue *Options) string { return optionsValue.KeyPolicy }},
 		{key: "port", label: "Default Port", kind: "text", get: func(optionsValue *Options) string { return fmt.Sprintf("%d", optionsValue.Port) }},
 		{key: "timeoutSec", label: "Timeout (Seconds)", kind: "text", get: func(optionsValue *Options) string { return fmt.Sprintf("%d", optionsValue.TimeoutSec) }},
 		{key: "insecureIgnoreHostKey", label: "Insecure Ignore Host Key", kind: "text", get: func(optionsValue *Options) string { return fmt.Sprintf("%t", optionsValue.InsecureIgnoreHostKey) }},
 		{key: "knownHosts", label: "Known Hosts Path", kind: "text", get: func(optionsValue *Options) string { return optionsValue.KnownHosts }},
+		{key: "hosts", label: "Hosts", kind: "text", get: func(optionsValue *Options) string { return formatHostSpecs(optionsValue.Hosts) }},
+		{key: "operations", label: "Operations", kind: "text", get: func(optionsValue *Options) string { return optionsValue.Operations }},
+		{key: "locale", label: "Locale", kind: "text", get: func(optionsValue *Options) string { return optionsValue.Locale }},
+		{key: "messages", label: "Custom Messages", kind: "text", get: func(optionsValue *Options) string { return formatMessageIDs(optionsValue.Messages) }},
 	}
 }
 
@@ -76,3 +90,20 @@ func maskSensitiveValue(value string) string {
 	}
 	return "<redacted>"
 }
+
+func formatHostSpecs(hostSpecs []HostSpec) string {
+	addresses := make([]string, 0, len(hostSpecs))
+	for _, hostSpec := range hostSpecs {
+		addresses = append(addresses, hostSpec.Address)
+	}
+	return strings.Join(addresses, ",")
+}
+
+func formatMessageIDs(messageTexts map[string]string) string {
+	ids := make([]string, 0, len(messageTexts))
+	for id := range messageTexts {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return strings.Join(ids, ",")
+}
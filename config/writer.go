@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RenderDotEnv renders the file-backed settings of programOptions as .env
+// content. Empty values are omitted; CLI-only fields are never written. A
+// PASSWORD is only rendered when set, so callers decide whether it belongs
+// in the file (for example only when the file is encrypted).
+func RenderDotEnv(programOptions *Options) string {
+	var builder strings.Builder
+	for _, entry := range renderedEntries(programOptions) {
+		builder.WriteString(entry.envKey)
+		builder.WriteString("=")
+		builder.WriteString(quoteDotEnvValue(entry.value))
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// RenderJSON renders the same settings as RenderDotEnv in the --config format.
+func RenderJSON(programOptions *Options) ([]byte, error) {
+	var rendered jsonConfig
+	stringFields := map[string]**string{
+		"SERVERS":                      &rendered.Servers,
+		"SERVERS_FILE":                 &rendered.ServersFile,
+		"USER":                         &rendered.User,
+		"PASSWORD":                     &rendered.Password,
+		"PASSWORD_PROVIDER":            &rendered.PasswordProvider,
+		"PASSWORD_SECRET_REF":          &rendered.PasswordSecretRef,
+		"PASSWORD_SECRET_REF_TEMPLATE": &rendered.PasswordRefTemplate,
+		"AUTH_METHODS":                 &rendered.AuthMethods,
+		"AUTH_KEY_SOURCE":              &rendered.AuthKeySource,
+		"KEY":                          &rendered.Key,
+		"IDENTITY_FILE":                &rendered.IdentityFile,
+		"KEY_POLICY":                   &rendered.KeyPolicy,
+		"KNOWN_HOSTS":                  &rendered.KnownHosts,
+		"OPERATIONS":                   &rendered.Operations,
+	}
+	for _, entry := range renderedEntries(programOptions) {
+		if target, ok := stringFields[entry.envKey]; ok {
+			value := entry.value
+			*target = &value
+		}
+	}
+	if programOptions.InsecureIgnoreHostKey {
+		insecure := true
+		rendered.InsecureIgnoreHostKey = &insecure
+	}
+
+	encoded, err := json.MarshalIndent(rendered, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, '\n'), nil
+}
+
+type renderedEntry struct {
+	envKey string
+	value  string
+}
+
+func renderedEntries(programOptions *Options) []renderedEntry {
+	candidates := []renderedEntry{
+		{"SERVERS", programOptions.Servers},
+		{"SERVERS_FILE", programOptions.ServersFile},
+		{"USER", programOptions.User},
+		{"PASSWORD", programOptions.Password},
+		{"KEY", programOptions.KeyInput},
+		{"IDENTITY_FILE", programOptions.IdentityFile},
+		{"KEY_POLICY", programOptions.KeyPolicy},
+		{"AUTH_METHODS", programOptions.AuthMethods},
+		{"AUTH_KEY_SOURCE", programOptions.AuthKeySource},
+		{"PASSWORD_PROVIDER", programOptions.PasswordProvider},
+		{"PASSWORD_SECRET_REF", programOptions.PasswordSecretRef},
+		{"PASSWORD_SECRET_REF_TEMPLATE", programOptions.PasswordSecretRefTemplate},
+		{"KNOWN_HOSTS", programOptions.KnownHosts},
+		{"OPERATIONS", programOptions.Operations},
+	}
+	if programOptions.InsecureIgnoreHostKey {
+		candidates = append(candidates, renderedEntry{"INSECURE_IGNORE_HOST_KEY", "true"})
+	}
+
+	entries := make([]renderedEntry, 0, len(candidates))
+	for _, candidate := range candidates {
+		if strings.TrimSpace(candidate.value) == "" {
+			continue
+		}
+		value := candidate.value
+		if candidate.envKey != "PASSWORD" {
+			value = strings.TrimSpace(value)
+		}
+		// Rendered values are literal; keep ${ from being interpolated on load.
+		value = strings.ReplaceAll(value, "${", "$${")
+		entries = append(entries, renderedEntry{envKey: candidate.envKey, value: value})
+	}
+	return entries
+}
+
+// quoteDotEnvValue double-quotes values that parseDotEnvValue would otherwise
+// cut at whitespace, a comment marker or a quote, or that hold a line break
+// or another control character.
+func quoteDotEnvValue(value string) string {
+	if strings.ContainsFunc(value, func(character rune) bool {
+		return unicode.IsSpace(character) || unicode.IsControl(character) || strings.ContainsRune("#\"'\\", character)
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
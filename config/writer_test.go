@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func renderTestOptions() *Options {
+	return &Options{
+		Servers:               "app01, app02:2222",
+		User:                  "deploy",
+		KeyInput:              "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBase64 ops key #1",
+		PasswordProvider:      "bitwarden",
+		PasswordSecretRef:     "bw://item",
+		InsecureIgnoreHostKey: true,
+	}
+}
+
+func TestRenderDotEnvRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	original := renderTestOptions()
+	content := RenderDotEnv(original)
+	if strings.Contains(content, "PASSWORD=") || strings.Contains(content, "KNOWN_HOSTS") {
+		t.Fatalf("RenderDotEnv() wrote empty settings: %q", content)
+	}
+
+	loaded := &Options{EnvFile: writeDotEnv(t, content)}
+	if _, err := ApplyDotEnvWithMetadata(loaded); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v\n%s", err, content)
+	}
+	if loaded.Servers != original.Servers || loaded.User != original.User || loaded.KeyInput != original.KeyInput ||
+		loaded.PasswordProvider != original.PasswordProvider || loaded.PasswordSecretRef != original.PasswordSecretRef ||
+		!loaded.InsecureIgnoreHostKey {
+		t.Fatalf("round-tripped options = %+v, want %+v", loaded, original)
+	}
+}
+
+func TestRenderJSONRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	original := renderTestOptions()
+	content, err := RenderJSON(original)
+	if err != nil {
+		t.Fatalf("RenderJSON() error = %v", err)
+	}
+	if strings.Contains(string(content), "null") {
+		t.Fatalf("RenderJSON() wrote empty settings: %s", content)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	loaded := &Options{ConfigFile: path}
+	if _, err := ApplyJSONWithMetadata(loaded); err != nil {
+		t.Fatalf("ApplyJSONWithMetadata() error = %v\n%s", err, content)
+	}
+	if loaded.Servers != original.Servers || loaded.KeyInput != original.KeyInput || loaded.PasswordSecretRef != original.PasswordSecretRef || !loaded.InsecureIgnoreHostKey {
+		t.Fatalf("round-tripped options = %+v, want %+v", loaded, original)
+	}
+}
+
+func TestRenderDotEnvEscapesInterpolation(t *testing.T) {
+	t.Parallel()
+
+	original := &Options{Servers: "app01", Password: "pa${ss}word"}
+	loaded := &Options{EnvFile: writeDotEnv(t, RenderDotEnv(original))}
+	if _, err := ApplyDotEnvWithMetadata(loaded); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if loaded.Password != original.Password {
+		t.Fatalf("Password = %q, want %q", loaded.Password, original.Password)
+	}
+}
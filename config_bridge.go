@@ -2,9 +2,10 @@ package main
 
 import (
 	"bufio"
-	"os"
+	"strings"
 
 	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/messages"
 )
 
 // configRuntimeIO adapts CLI I/O primitives (stdin/stdout) to the appconfig
@@ -28,7 +29,8 @@ func (configRuntimeIO) Printf(format string, arguments ...any) {
 }
 
 func (configRuntimeIO) IsInteractive() bool {
-	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+	activePrompter := currentPrompter()
+	return activePrompter.Interactive(standardInputFile()) && activePrompter.Interactive(standardOutputFile())
 }
 
 // applyConfigFiles applies file-backed configuration values to programOptions
@@ -37,7 +39,29 @@ func (configRuntimeIO) IsInteractive() bool {
 
 func applyConfigFiles(programOptions *options, inputReader *bufio.Reader) error {
 	runtimeIO := configRuntimeIO{inputReader: inputReader}
-	return appconfig.ApplyFiles(programOptions, runtimeIO)
+	cliLocale := programOptions.Locale
+	if programOptions.ConfigFromStdin {
+		if err := applyConfigFromStdin(programOptions, inputReader); err != nil {
+			return err
+		}
+	} else if err := appconfig.ApplyFiles(programOptions, runtimeIO); err != nil {
+		return err
+	}
+	// --locale wins over the config file's LOCALE.
+	if strings.TrimSpace(cliLocale) != "" {
+		programOptions.Locale = cliLocale
+	}
+	return configureMessagesFromConfig(programOptions)
+}
+
+// configureMessagesFromConfig switches prompts to the config file's locale
+// and message overrides. run restores the previous selection on return.
+func configureMessagesFromConfig(programOptions *options) error {
+	if strings.TrimSpace(programOptions.Locale) == "" && len(programOptions.Messages) == 0 {
+		return nil
+	}
+	_, err := messages.Configure(programOptions.Locale, programOptions.Messages)
+	return err
 }
 
 // applyDotEnvConfigFileWithMetadata applies configuration values from a .env file
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"maps"
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+// configDirWatch re-reads --config-dir before every --watch retry round, so a
+// Secret the kubelet updated during the run (a rotated password, a new key)
+// applies to the hosts still being retried.
+type configDirWatch struct {
+	configured  options // the options as loaded, before secret refs were resolved
+	fingerprint string
+}
+
+// newConfigDirWatch starts watching the config directory of programOptions;
+// it returns nil without --config-dir.
+func newConfigDirWatch(programOptions *options) *configDirWatch {
+	if strings.TrimSpace(programOptions.ConfigDir) == "" {
+		return nil
+	}
+	fingerprint, err := appconfig.ConfigDirFingerprint(programOptions.ConfigDir)
+	if err != nil {
+		return nil
+	}
+	configured := *programOptions
+	configured.Messages = maps.Clone(programOptions.Messages)
+	return &configDirWatch{configured: configured, fingerprint: fingerprint}
+}
+
+// reload returns the options with the config directory read again, or nil
+// when its content did not change since the last check. A key removed from
+// the directory keeps its earlier value.
+func (watch *configDirWatch) reload() (*options, error) {
+	if watch == nil {
+		return nil, nil
+	}
+	fingerprint, err := appconfig.ConfigDirFingerprint(watch.configured.ConfigDir)
+	if err != nil || fingerprint == watch.fingerprint {
+		return nil, err
+	}
+	watch.fingerprint = fingerprint
+	reloaded := watch.configured
+	reloaded.Messages = maps.Clone(watch.configured.Messages)
+	if _, err := appconfig.ApplyDirWithMetadata(&reloaded); err != nil {
+		return nil, err
+	}
+	if err := validateOptions(&reloaded); err != nil {
+		return nil, err
+	}
+	return &reloaded, nil
+}
+
+// reloadHostSettings replaces the settings of hosts with ones built from the
+// reloaded config directory, when it changed. A prompted password is kept,
+// since nobody answers prompts between watch rounds. When the new config does
+// not load, the run goes on with the settings it has.
+func reloadHostSettings(watch *configDirWatch, programOptions *options, hosts []string, hostSpecs map[string]appconfig.HostSpec, usesPublicKey bool, settings map[string]hostSettings) {
+	reloaded, err := watch.reload()
+	if reloaded == nil && err == nil {
+		return
+	}
+	outputAnsibleTask("Reload config directory")
+	if err != nil {
+		outputAnsibleHostStatus("failed", "localhost", err.Error()+"; keeping the loaded config")
+		return
+	}
+	if strings.TrimSpace(reloaded.Password) == "" && strings.TrimSpace(reloaded.PasswordSecretRef) == "" {
+		reloaded.Password = programOptions.Password
+	}
+
+	hostPasswords := map[string]string{}
+	if hasHostPasswordSecretRefs(reloaded) {
+		if hostPasswords, err = resolveHostPasswords(reloaded, hosts, hostSpecs); err != nil {
+			outputAnsibleHostStatus("failed", "localhost", err.Error()+"; keeping the loaded config")
+			return
+		}
+	}
+	var publicKeys map[string][]string
+	var keyInputs map[string]string
+	if usesPublicKey {
+		if publicKeys, keyInputs, err = resolveHostPublicKeys(reloaded, hosts, hostSpecs); err != nil {
+			outputAnsibleHostStatus("failed", "localhost", err.Error()+"; keeping the loaded config")
+			return
+		}
+	}
+	maps.Copy(settings, buildHostSettings(reloaded, hosts, hostSpecs, hostPasswords, publicKeys, keyInputs))
+	outputAnsibleHostStatus("changed", "localhost", "config directory "+reloaded.ConfigDir+" changed")
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadHostSettingsAppliesAChangedConfigDir(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	dir := t.TempDir()
+	writeKey := func(key, value string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(value+"\n"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", key, err)
+		}
+	}
+	writeKey("USER", "deploy")
+	writeKey("PASSWORD", "old")
+
+	programOptions := &options{ConfigDir: dir, Port: 22, TimeoutSec: 1, User: "deploy", Password: "old"}
+	watch := newConfigDirWatch(programOptions)
+	settings := map[string]hostSettings{
+		"app01:22": {User: "deploy", Password: "old"},
+		"web01:22": {User: "deploy", Password: "old"},
+	}
+
+	reloadHostSettings(watch, programOptions, []string{"app01:22"}, nil, false, settings)
+	if outputBuffer.Len() != 0 || settings["app01:22"].Password != "old" {
+		t.Fatalf("reload of an unchanged directory printed %q, settings = %v", outputBuffer.String(), settings)
+	}
+
+	writeKey("PASSWORD", "rotated")
+	writeKey("USER", "admin")
+	reloadHostSettings(watch, programOptions, []string{"app01:22"}, nil, false, settings)
+	if got := settings["app01:22"]; got.User != "admin" || got.Password != "rotated" {
+		t.Fatalf("app01 settings after reload = %+v", got)
+	}
+	if got := settings["web01:22"]; got.Password != "old" {
+		t.Fatalf("web01 settings = %+v, want it untouched since it was not retried", got)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/messages"
+)
+
+// configPassphraseEnv supplies the passphrase of an encrypted config in
+// non-interactive runs (CI, containers) instead of prompting.
+const configPassphraseEnv = "SSH_KEY_BOOTSTRAP_CONFIG_PASSPHRASE"
+
+// runAgeCommand runs the age binary with stdin as input and returns its
+// stdout. Tests replace it.
+var runAgeCommand = func(stdin []byte, args ...string) ([]byte, error) {
+	agePath, err := exec.LookPath("age")
+	if err != nil {
+		return nil, fmt.Errorf("age is required for age-encrypted configs: %w", err)
+	}
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(agePath, args...) // #nosec G204 -- fixed binary; arguments are an identity path or recipient
+	command.Stdin = bytes.NewReader(stdin)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("age: %s", message)
+		}
+		return nil, fmt.Errorf("age: %w", err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// configureConfigDecryption lets the config loader open encrypted .env/JSON
+// files: age files through `age --decrypt -i <identity>`, passphrase files with
+// the passphrase from configPassphraseEnv or a terminal prompt.
+func configureConfigDecryption(ageIdentity string) func() {
+	previousDecryptFile := appconfig.DecryptFile
+	appconfig.DecryptFile = func(path string, content []byte) ([]byte, error) {
+		if appconfig.IsAgeEncrypted(content) {
+			return decryptAgeConfig(content, ageIdentity)
+		}
+		passphrase, err := readConfigPassphrase(path)
+		if err != nil {
+			return nil, err
+		}
+		return appconfig.DecryptWithPassphrase(content, passphrase)
+	}
+	return func() {
+		appconfig.DecryptFile = previousDecryptFile
+	}
+}
+
+func decryptAgeConfig(content []byte, ageIdentity string) ([]byte, error) {
+	if strings.TrimSpace(ageIdentity) == "" {
+		return nil, errors.New("config is age-encrypted; pass --age-identity <path>")
+	}
+	identityPath, err := expandHomePath(strings.TrimSpace(ageIdentity))
+	if err != nil {
+		return nil, fmt.Errorf("resolve age identity path: %w", err)
+	}
+	return runAgeCommand(content, "--decrypt", "-i", identityPath)
+}
+
+func readConfigPassphrase(path string) (string, error) {
+	if passphrase := os.Getenv(configPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !currentPrompter().Interactive(standardInputFile()) {
+		return "", fmt.Errorf("config is encrypted; set %s in non-interactive mode", configPassphraseEnv)
+	}
+	return promptPassword(nil, standardInputFile(), messages.Get(messages.PromptConfigPassphrase, path))
+}
+
+// encryptConfigContent encrypts rendered config content for init: with a
+// passphrase natively, or for an age recipient through the age binary.
+func encryptConfigContent(content []byte, passphrase, ageRecipient string) ([]byte, error) {
+	if ageRecipient != "" {
+		return runAgeCommand(content, "--encrypt", "--armor", "-r", ageRecipient)
+	}
+	return appconfig.EncryptWithPassphrase(content, passphrase)
+}
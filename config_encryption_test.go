@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+func TestConfigureConfigDecryptionRunsAgeWithIdentity(t *testing.T) {
+	originalRunAgeCommand := runAgeCommand
+	t.Cleanup(func() { runAgeCommand = originalRunAgeCommand })
+	var ageArgs []string
+	runAgeCommand = func(stdin []byte, args ...string) ([]byte, error) {
+		ageArgs = args
+		return []byte("USER=deploy\n"), nil
+	}
+
+	configPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(configPath, []byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n-----END AGE ENCRYPTED FILE-----\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	restore := configureConfigDecryption("")
+	loaded := &options{EnvFile: configPath}
+	_, err := appconfig.ApplyDotEnvWithMetadata(loaded)
+	restore()
+	if err == nil || !strings.Contains(err.Error(), "--age-identity") {
+		t.Fatalf("ApplyDotEnvWithMetadata() without identity error = %v", err)
+	}
+
+	restore = configureConfigDecryption("/keys/age.txt")
+	defer restore()
+	if _, err := appconfig.ApplyDotEnvWithMetadata(loaded); err != nil {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v", err)
+	}
+	if loaded.User != "deploy" || !slices.Equal(ageArgs, []string{"--decrypt", "-i", "/keys/age.txt"}) {
+		t.Fatalf("user = %q, age args = %q", loaded.User, ageArgs)
+	}
+}
+
+func TestConfigureConfigDecryptionRequiresPassphraseWhenNonInteractive(t *testing.T) {
+	stubPrompter(t, &scriptedPrompter{err: errors.New("unexpected prompt")})
+	t.Setenv(configPassphraseEnv, "")
+	encrypted, err := appconfig.EncryptWithPassphrase([]byte("USER=deploy\n"), "pw")
+	if err != nil {
+		t.Fatalf("EncryptWithPassphrase() error = %v", err)
+	}
+	configPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(configPath, encrypted, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	restore := configureConfigDecryption("")
+	defer restore()
+	_, err = appconfig.ApplyDotEnvWithMetadata(&options{EnvFile: configPath})
+	if err == nil || !strings.Contains(err.Error(), configPassphraseEnv) {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v, want passphrase hint", err)
+	}
+
+	t.Setenv(configPassphraseEnv, "wrong")
+	_, err = appconfig.ApplyDotEnvWithMetadata(&options{EnvFile: configPath})
+	if !errors.Is(err, appconfig.ErrWrongPassphrase) {
+		t.Fatalf("ApplyDotEnvWithMetadata() error = %v, want ErrWrongPassphrase", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	connectionRateNow   = time.Now
+	connectionRateSleep = time.Sleep
+)
+
+// connectionRateLimiter spaces out new SSH connections so that no more than
+// the configured number start per second. It is shared by every dial site and
+// safe for concurrent use.
+type connectionRateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+var (
+	connectionLimiterMu sync.Mutex
+	connectionLimiter   *connectionRateLimiter
+)
+
+// configureConnectionRate installs a process-wide limit of perSecond new SSH
+// connections (0 disables it). The returned function removes the limit.
+func configureConnectionRate(perSecond int) (func(), error) {
+	if perSecond < 0 {
+		return nil, fmt.Errorf("rate must be zero (unlimited) or a positive number of connections per second, got %d", perSecond)
+	}
+	if perSecond == 0 {
+		return func() {}, nil
+	}
+
+	connectionLimiterMu.Lock()
+	connectionLimiter = &connectionRateLimiter{interval: time.Second / time.Duration(perSecond)}
+	connectionLimiterMu.Unlock()
+	return func() {
+		connectionLimiterMu.Lock()
+		connectionLimiter = nil
+		connectionLimiterMu.Unlock()
+	}, nil
+}
+
+// wait blocks until the caller may open a connection. Slots are reserved
+// under the lock and slept on outside it, so concurrent callers queue up one
+// interval apart instead of all waking at once.
+func (limiter *connectionRateLimiter) wait() {
+	limiter.mu.Lock()
+	now := connectionRateNow()
+	slot := limiter.next
+	if slot.Before(now) {
+		slot = now
+	}
+	limiter.next = slot.Add(limiter.interval)
+	limiter.mu.Unlock()
+
+	if delay := slot.Sub(now); delay > 0 {
+		connectionRateSleep(delay)
+	}
+}
+
+// waitForConnectionSlot blocks until a new connection may be opened under the
+// configured rate limit; it returns immediately when no limit is set.
+func waitForConnectionSlot() {
+	connectionLimiterMu.Lock()
+	limiter := connectionLimiter
+	connectionLimiterMu.Unlock()
+	if limiter != nil {
+		limiter.wait()
+	}
+}
+
+// dialSSH opens an SSH connection over the configured transport after
+// waiting for the connection rate limit, if one is configured, and for the
+// slowdown of a suspected IPS ban (see ipsGuard). A host that turns the
+// connection away like sshd over MaxStartups is dialed again. The server
+// version and any pre-auth banner are reported per host; with --debug-ssh the
+// handshake is logged too.
+func dialSSH(network, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	reportHostPhase(address, "dialing")
+	guard := currentIPSGuard()
+	clientConfig = withPhaseReport(address, withBannerCapture(address, clientConfig))
+	dial := dialSSHOverTransport
+	if sshDebugEnabled() {
+		dial = dialSSHWithDebug
+	}
+	client, err := retryMaxStartups(address, guard, func() (*ssh.Client, error) {
+		waitForConnectionSlot()
+		guard.wait()
+		client, err := dial(network, address, clientConfig)
+		if typeErr, ok := errors.AsType[*knownHostKeyTypeError](err); ok {
+			// known_hosts pins another key type for this host; ask for that one
+			// instead of reporting a changed key.
+			if pinnedAlgorithms := hostKeyAlgorithmsForKeyTypes(typeErr.knownTypes, clientConfig.HostKeyAlgorithms); len(pinnedAlgorithms) > 0 {
+				pinnedConfig := *clientConfig
+				pinnedConfig.HostKeyAlgorithms = pinnedAlgorithms
+				waitForConnectionSlot()
+				client, err = dial(network, address, &pinnedConfig)
+			}
+		}
+		guard.record(address, err)
+		return client, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	reportSSHBanner(address, "server version", string(client.ServerVersion()))
+	reportHostPhase(address, "applying")
+	return client, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestConfigureConnectionRateRejectsNegative(t *testing.T) {
+	if _, err := configureConnectionRate(-1); err == nil {
+		t.Fatalf("configureConnectionRate(-1) error = nil, want error")
+	}
+}
+
+func TestDialSSHSpacesConnectionsByRate(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+	originalNow, originalSleep := connectionRateNow, connectionRateSleep
+	connectionRateNow = func() time.Time { return clock }
+	connectionRateSleep = func(delay time.Duration) {
+		sleeps = append(sleeps, delay)
+		clock = clock.Add(delay)
+	}
+	t.Cleanup(func() { connectionRateNow, connectionRateSleep = originalNow, originalSleep })
+
+	dialCount := 0
+	stubSSHDialHook(t, func(_, _ string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		dialCount++
+		return nil, errors.New("unreachable")
+	})
+
+	restore, err := configureConnectionRate(4)
+	if err != nil {
+		t.Fatalf("configureConnectionRate(4) error = %v", err)
+	}
+	t.Cleanup(restore)
+
+	for range 3 {
+		_, _ = dialSSH("tcp", "app01:22", &ssh.ClientConfig{})
+	}
+	if dialCount != 3 {
+		t.Fatalf("dialCount = %d, want 3", dialCount)
+	}
+	want := []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}
+	if len(sleeps) != len(want) || sleeps[0] != want[0] || sleeps[1] != want[1] {
+		t.Fatalf("sleeps = %v, want %v", sleeps, want)
+	}
+
+	restore()
+	sleeps = nil
+	_, _ = dialSSH("tcp", "app01:22", &ssh.ClientConfig{})
+	if len(sleeps) != 0 {
+		t.Fatalf("sleeps after restore = %v, want none", sleeps)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+// containerModeEnv switches on container mode, for images whose entrypoint is
+// the tool (for example a Kubernetes Job): the config comes from the
+// environment (or --config-from-stdin), no config file is discovered in the
+// user config directory or next to the binary, no run log file is kept since
+// the container runtime collects stdout, and secrets can be mounted files.
+const containerModeEnv = "SSH_KEY_BOOTSTRAP_CONTAINER"
+
+// secretFileSuffix marks an environment variable that names a mounted file
+// holding the value of the variable without the suffix, as in
+// PASSWORD_FILE=/run/secrets/password.
+const secretFileSuffix = "_FILE"
+
+// secretFileVariables are the variables container mode fills from a
+// NAME_FILE mount: the password, the config passphrase and the secret
+// provider credentials, which the providers read from the environment.
+var secretFileVariables = []string{
+	"PASSWORD",
+	configPassphraseEnv,
+	"BWS_ACCESS_TOKEN",
+	"BW_SESSION",
+	"INFISICAL_UNIVERSAL_AUTH_CLIENT_ID",
+	"INFISICAL_UNIVERSAL_AUTH_CLIENT_SECRET",
+}
+
+// containerModeEnabled reports whether containerModeEnv is set to a true
+// value.
+func containerModeEnabled() bool {
+	enabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(containerModeEnv)))
+	return err == nil && enabled
+}
+
+// loadSecretFiles sets each secretFileVariables entry whose NAME_FILE is set
+// from the file it names, with the trailing line break removed. Setting both
+// NAME and NAME_FILE is an error, since it is unclear which one is meant.
+func loadSecretFiles() error {
+	for _, name := range secretFileVariables {
+		path := strings.TrimSpace(os.Getenv(name + secretFileSuffix))
+		if path == "" {
+			continue
+		}
+		if _, set := os.LookupEnv(name); set {
+			return fmt.Errorf("both %s and %s%s are set; use one", name, name, secretFileSuffix)
+		}
+		content, err := os.ReadFile(path) // #nosec G304 -- secret file path is explicit user input
+		if err != nil {
+			return fmt.Errorf("read %s%s: %w", name, secretFileSuffix, err)
+		}
+		if err := os.Setenv(name, strings.TrimRight(string(content), "\r\n")); err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyConfigFromStdin loads the .env or JSON config piped to
+// --config-from-stdin, so a Job can pass a config from a secret without
+// writing it to disk. Stdin then holds nothing for prompts or a servers file.
+func applyConfigFromStdin(programOptions *options, inputReader *bufio.Reader) error {
+	if strings.TrimSpace(programOptions.EnvFile) != "" || strings.TrimSpace(programOptions.ConfigFile) != "" || strings.TrimSpace(programOptions.Context) != "" || strings.TrimSpace(programOptions.ConfigDir) != "" {
+		return errors.New("--config-from-stdin replaces --env, --config, --config-dir and --context; pass only one")
+	}
+	if strings.TrimSpace(programOptions.ServersFile) == "-" {
+		return errors.New("--servers-file - cannot read stdin when it holds the config")
+	}
+	content, err := io.ReadAll(inputReader)
+	if err != nil {
+		return fmt.Errorf("read config from stdin: %w", err)
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return errors.New("--config-from-stdin got an empty config")
+	}
+	if _, err := appconfig.ApplyContentWithMetadata(programOptions, "stdin", content); err != nil {
+		return err
+	}
+	if strings.TrimSpace(programOptions.ServersFile) == "-" {
+		return errors.New("SERVERS_FILE=- cannot read stdin when it holds the config")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unsetEnvForTest removes name for the test and puts its value back after.
+func unsetEnvForTest(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	if err := os.Unsetenv(name); err != nil {
+		t.Fatalf("unset %s: %v", name, err)
+	}
+}
+
+func TestLoadSecretFilesReadsMountedSecrets(t *testing.T) {
+	secretPath := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secretPath, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+	unsetEnvForTest(t, "PASSWORD")
+	t.Setenv("PASSWORD_FILE", secretPath)
+
+	if err := loadSecretFiles(); err != nil {
+		t.Fatalf("loadSecretFiles() error = %v", err)
+	}
+	if got := os.Getenv("PASSWORD"); got != "s3cret" {
+		t.Fatalf("PASSWORD = %q, want the file content without the line break", got)
+	}
+	if err := loadSecretFiles(); err == nil || !strings.Contains(err.Error(), "both PASSWORD and PASSWORD_FILE are set") {
+		t.Fatalf("loadSecretFiles() with both set error = %v", err)
+	}
+}
+
+func TestApplyConfigFromStdin(t *testing.T) {
+	captureWriters(t)
+	programOptions := &options{ConfigFromStdin: true}
+	inputReader := bufio.NewReader(strings.NewReader("SERVERS=app01\nUSER=deploy\n"))
+	if err := applyConfigFiles(programOptions, inputReader); err != nil {
+		t.Fatalf("applyConfigFiles() error = %v", err)
+	}
+	if programOptions.Servers != "app01" || programOptions.User != "deploy" {
+		t.Fatalf("options = %+v", programOptions)
+	}
+
+	testCases := map[string]struct {
+		programOptions *options
+		config         string
+		wantErr        string
+	}{
+		"with --env":          {&options{ConfigFromStdin: true, EnvFile: ".env"}, "USER=deploy\n", "replaces --env, --config, --config-dir"},
+		"servers file stdin":  {&options{ConfigFromStdin: true}, "SERVERS_FILE=-\n", "SERVERS_FILE=- cannot read stdin"},
+		"empty config":        {&options{ConfigFromStdin: true}, "\n", "empty config"},
+		"--servers-file flag": {&options{ConfigFromStdin: true, ServersFile: "-"}, "USER=deploy\n", "--servers-file - cannot read stdin"},
+	}
+	for name, testCase := range testCases {
+		err := applyConfigFiles(testCase.programOptions, bufio.NewReader(strings.NewReader(testCase.config)))
+		if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+			t.Fatalf("%s: applyConfigFiles() error = %v, want %q", name, err, testCase.wantErr)
+		}
+	}
+}
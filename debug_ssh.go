@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	debugSSHMu     sync.Mutex
+	debugSSHOutput io.Writer
+)
+
+// sshAuthMethodNames maps the x/crypto auth method types to the method names
+// used on the wire, so the debug log reads like OpenSSH's.
+var sshAuthMethodNames = map[string]string{
+	"ssh.passwordCallback":             "password",
+	"ssh.publicKeyCallback":            "publickey",
+	"*ssh.gssAPIWithMICCallback":       "gssapi-with-mic",
+	"ssh.KeyboardInteractiveChallenge": "keyboard-interactive",
+}
+
+// configureSSHDebug turns on handshake logging for every built-in SSH dial.
+// Lines go to the run log, or to stderr when no run log is open. The returned
+// function turns it off again.
+func configureSSHDebug(enabled bool) func() {
+	if !enabled {
+		return func() {}
+	}
+	output := runLogWriter
+	if output == nil {
+		output = commandOutputWriter()
+	}
+	debugSSHMu.Lock()
+	debugSSHOutput = output
+	debugSSHMu.Unlock()
+	return func() {
+		debugSSHMu.Lock()
+		debugSSHOutput = nil
+		debugSSHMu.Unlock()
+	}
+}
+
+func sshDebugEnabled() bool {
+	debugSSHMu.Lock()
+	defer debugSSHMu.Unlock()
+	return debugSSHOutput != nil
+}
+
+func debugSSHLogf(hostAddress, format string, args ...any) {
+	debugSSHMu.Lock()
+	defer debugSSHMu.Unlock()
+	if debugSSHOutput == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(debugSSHOutput, "[debug-ssh] %s: %s\n", hostAddress, fmt.Sprintf(format, args...))
+}
+
+// dialSSHWithDebug dials like sshDial and logs what the handshake did: the
+// host key and its verdict, the auth methods offered, and, once connected,
+// the server version and the negotiated key exchange, ciphers and MACs.
+func dialSSHWithDebug(network, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	debugConfig := *clientConfig
+	if hostKeyCallback := clientConfig.HostKeyCallback; hostKeyCallback != nil {
+		debugConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := hostKeyCallback(hostname, remote, key)
+			verdict := "accepted"
+			if err != nil {
+				verdict = "rejected: " + err.Error()
+			}
+			debugSSHLogf(address, "host key %s %s %s", key.Type(), ssh.FingerprintSHA256(key), verdict)
+			return err
+		}
+	}
+	debugSSHLogf(address, "dialing as %q, auth methods offered: %s", clientConfig.User, describeSSHAuthMethods(clientConfig.Auth))
+
+	client, err := dialSSHOverTransport(network, address, &debugConfig)
+	if err != nil {
+		debugSSHLogf(address, "handshake failed: %v", err)
+		return nil, err
+	}
+	debugSSHLogf(address, "server version %q, client version %q", client.ServerVersion(), client.ClientVersion())
+	if metadata, ok := client.Conn.(ssh.AlgorithmsConnMetadata); ok {
+		algorithms := metadata.Algorithms()
+		debugSSHLogf(address, "kex %s, host key algorithm %s, cipher %s/%s, mac %s/%s",
+			algorithms.KeyExchange, algorithms.HostKey,
+			algorithms.Write.Cipher, algorithms.Read.Cipher,
+			describeSSHMAC(algorithms.Write.MAC), describeSSHMAC(algorithms.Read.MAC))
+	}
+	debugSSHLogf(address, "authenticated as %q", client.User())
+	return client, nil
+}
+
+func describeSSHAuthMethods(methods []ssh.AuthMethod) string {
+	if len(methods) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(methods))
+	for _, method := range methods {
+		typeName := fmt.Sprintf("%T", method)
+		if name, ok := sshAuthMethodNames[typeName]; ok {
+			names = append(names, name)
+			continue
+		}
+		names = append(names, typeName)
+	}
+	return strings.Join(names, ",")
+}
+
+// describeSSHMAC reports AEAD ciphers, which carry no separate MAC, as
+// "implicit" like ssh -v does.
+func describeSSHMAC(mac string) string {
+	if mac == "" {
+		return "<implicit>"
+	}
+	return mac
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func captureSSHDebug(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	debugBuffer := &bytes.Buffer{}
+	previousLogWriter := runLogWriter
+	runLogWriter = debugBuffer
+	restore := configureSSHDebug(true)
+	t.Cleanup(func() {
+		restore()
+		runLogWriter = previousLogWriter
+	})
+	return debugBuffer
+}
+
+func TestDialSSHLogsHandshakeDetailsWithDebug(t *testing.T) {
+	debugBuffer := captureSSHDebug(t)
+	stubSSHDialHook(t, func(_, _ string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanup := newInMemorySSHClient(t, clientConfig, func(string, string) (string, string, uint32) { return "", "", 0 })
+		t.Cleanup(cleanup)
+		return client, nil
+	})
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret"), ssh.PublicKeysCallback(func() ([]ssh.Signer, error) { return nil, nil })},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if _, err := dialSSH("tcp", "app01:22", clientConfig); err != nil {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+
+	debugOutput := debugBuffer.String()
+	for _, want := range []string{
+		`[debug-ssh] app01:22: dialing as "deploy", auth methods offered: password,publickey`,
+		"host key ssh-rsa SHA256:",
+		"accepted",
+		`server version "SSH-2.0-Go"`,
+		"kex ",
+		"cipher ",
+		`authenticated as "deploy"`,
+	} {
+		if !strings.Contains(debugOutput, want) {
+			t.Fatalf("debug output missing %q:\n%s", want, debugOutput)
+		}
+	}
+}
+
+func TestDialSSHLogsHandshakeFailureWithDebug(t *testing.T) {
+	debugBuffer := captureSSHDebug(t)
+	stubSSHDialHook(t, func(_, _ string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		return nil, errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]")
+	})
+
+	if _, err := dialSSH("tcp", "app01:22", &ssh.ClientConfig{User: "deploy"}); err == nil {
+		t.Fatal("dialSSH() error = nil, want handshake failure")
+	}
+	if !strings.Contains(debugBuffer.String(), "handshake failed: ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]") {
+		t.Fatalf("debug output = %q", debugBuffer.String())
+	}
+}
+
+func TestDialSSHWithoutDebugLogsNothing(t *testing.T) {
+	debugBuffer := &bytes.Buffer{}
+	previousLogWriter := runLogWriter
+	runLogWriter = debugBuffer
+	t.Cleanup(func() { runLogWriter = previousLogWriter })
+	configureSSHDebug(false)()
+	stubSSHDialHook(t, func(_, _ string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		return nil, errors.New("dial failed")
+	})
+
+	_, _ = dialSSH("tcp", "app01:22", &ssh.ClientConfig{})
+	if debugBuffer.Len() != 0 {
+		t.Fatalf("debug output without --debug-ssh = %q", debugBuffer.String())
+	}
+}
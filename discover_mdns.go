@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	discoverMDNS   = "mdns"
+	mdnsSSHService = "_ssh._tcp.local."
+	selectAllHosts = "all"
+)
+
+var (
+	mdnsIPv4Group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	// mdnsBrowseWindow is how long answers are collected after the query.
+	mdnsBrowseWindow = 3 * time.Second
+	browseMDNS       = defaultBrowseMDNS
+)
+
+// mdnsService is one SSH server announced over DNS-SD.
+type mdnsService struct {
+	instance string // e.g. "raspberrypi"
+	hostName string // SRV target without the trailing dot, e.g. "raspberrypi.local"
+	port     uint16
+	address  string // first usable announced address; empty when none was sent
+}
+
+// target is the host:port a run uses: the announced address when there is
+// one, since .local names only resolve where the system resolver does mDNS.
+func (service mdnsService) target() string {
+	host := service.address
+	if host == "" {
+		host = service.hostName
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(service.port)))
+}
+
+// discoverHosts runs --discover and returns the hosts the operator picked.
+func discoverHosts(inputReader *bufio.Reader, programOptions *options) ([]string, error) {
+	method := strings.ToLower(strings.TrimSpace(programOptions.Discover))
+	if method != discoverMDNS {
+		return nil, fmt.Errorf("unknown --discover method %q (supported: %s)", programOptions.Discover, discoverMDNS)
+	}
+	services, err := browseMDNS(mdnsBrowseWindow)
+	if err != nil {
+		return nil, fmt.Errorf("--discover %s: %w", discoverMDNS, err)
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("--discover %s: no %s services answered within %s", discoverMDNS, strings.TrimSuffix(mdnsSSHService, "."), mdnsBrowseWindow)
+	}
+	for index, service := range services {
+		outputPrintf("  %d) %s => %s (%s)\n", index+1, service.instance, service.target(), service.hostName)
+	}
+
+	targets := make([]string, len(services))
+	for index, service := range services {
+		targets[index] = service.target()
+	}
+	// A plan only shows what would happen, and --yes takes every host.
+	if programOptions.AssumeYes || strings.TrimSpace(programOptions.PlanFormat) != "" {
+		return targets, nil
+	}
+	if !currentPrompter().Interactive(standardInputFile()) {
+		return nil, fmt.Errorf("refusing to target %d discovered host(s) without --yes", len(services))
+	}
+	for {
+		answer, err := promptRequired(inputReader, fmt.Sprintf("Hosts to target (e.g. 1,3-4 or %s): ", selectAllHosts))
+		if err != nil {
+			return nil, wrapMissingInputError("host selection", err)
+		}
+		indexes, err := parseHostSelection(answer, len(targets))
+		if err != nil {
+			outputPrintf("Invalid selection: %v\n", err)
+			continue
+		}
+		selected := make([]string, 0, len(indexes))
+		for _, index := range indexes {
+			selected = append(selected, targets[index])
+		}
+		return selected, nil
+	}
+}
+
+// parseHostSelection reads "all" or a comma-separated list of 1-based
+// numbers and ranges ("1,3-4") and returns the 0-based indexes in order.
+func parseHostSelection(text string, count int) ([]int, error) {
+	if strings.EqualFold(strings.TrimSpace(text), selectAllHosts) {
+		indexes := make([]int, count)
+		for index := range indexes {
+			indexes[index] = index
+		}
+		return indexes, nil
+	}
+	var indexes []int
+	for part := range strings.SplitSeq(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		firstText, lastText, isRange := strings.Cut(part, "-")
+		if !isRange {
+			lastText = firstText
+		}
+		first, firstErr := strconv.Atoi(strings.TrimSpace(firstText))
+		last, lastErr := strconv.Atoi(strings.TrimSpace(lastText))
+		if firstErr != nil || lastErr != nil || first < 1 || last > count || first > last {
+			return nil, fmt.Errorf("%q is not a number or range between 1 and %d", part, count)
+		}
+		for number := first; number <= last; number++ {
+			if !slices.Contains(indexes, number-1) {
+				indexes = append(indexes, number-1)
+			}
+		}
+	}
+	if len(indexes) == 0 {
+		return nil, errors.New("no host selected")
+	}
+	slices.Sort(indexes)
+	return indexes, nil
+}
+
+// defaultBrowseMDNS sends one DNS-SD query for _ssh._tcp.local to the IPv4
+// mDNS group and collects answers until the window ends. The query comes
+// from an ephemeral port, so responders answer it directly (RFC 6762 6.7)
+// and no socket needs to join the group.
+func defaultBrowseMDNS(window time.Duration) ([]mdnsService, error) {
+	query, err := buildMDNSQuery()
+	if err != nil {
+		return nil, err
+	}
+	connection, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("open UDP socket: %w", err)
+	}
+	defer connection.Close()
+	if _, err := connection.WriteToUDP(query, mdnsIPv4Group); err != nil {
+		return nil, fmt.Errorf("send query: %w", err)
+	}
+	if err := connection.SetReadDeadline(time.Now().Add(window)); err != nil {
+		return nil, err
+	}
+
+	records := newMDNSRecords()
+	buffer := make([]byte, 9000)
+	for {
+		size, _, err := connection.ReadFromUDP(buffer)
+		if err != nil {
+			if netErr, ok := errors.AsType[net.Error](err); ok && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("read answers: %w", err)
+		}
+		// Packets that are not DNS answers are someone else's traffic.
+		_ = records.add(buffer[:size])
+	}
+	return records.services(), nil
+}
+
+func buildMDNSQuery() ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(mdnsSSHService),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// mdnsRecords gathers the records of every answer: PTR names the service
+// instances, SRV gives each its host name and port, A/AAAA the addresses.
+type mdnsRecords struct {
+	instances []string
+	srv       map[string]dnsmessage.SRVResource
+	addresses map[string][]net.IP
+}
+
+func newMDNSRecords() *mdnsRecords {
+	return &mdnsRecords{srv: map[string]dnsmessage.SRVResource{}, addresses: map[string][]net.IP{}}
+}
+
+func (records *mdnsRecords) add(packet []byte) error {
+	var message dnsmessage.Message
+	if err := message.Unpack(packet); err != nil {
+		return err
+	}
+	if !message.Header.Response {
+		return nil
+	}
+	for _, resource := range slices.Concat(message.Answers, message.Authorities, message.Additionals) {
+		name := strings.ToLower(resource.Header.Name.String())
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			instance := body.PTR.String()
+			if name == mdnsSSHService && !slices.Contains(records.instances, instance) {
+				records.instances = append(records.instances, instance)
+			}
+		case *dnsmessage.SRVResource:
+			records.srv[name] = *body
+		case *dnsmessage.AResource:
+			records.addresses[name] = append(records.addresses[name], net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			records.addresses[name] = append(records.addresses[name], net.IP(body.AAAA[:]))
+		}
+	}
+	return nil
+}
+
+// services returns the instances that announced an SRV record, sorted by
+// name. IPv4 addresses are preferred; link-local IPv6 addresses are skipped
+// because they need an interface zone.
+func (records *mdnsRecords) services() []mdnsService {
+	var services []mdnsService
+	for _, instance := range records.instances {
+		srv, ok := records.srv[strings.ToLower(instance)]
+		if !ok {
+			continue
+		}
+		target := strings.ToLower(srv.Target.String())
+		service := mdnsService{
+			instance: instance[:len(instance)-len(mdnsSSHService)-1],
+			hostName: strings.TrimSuffix(target, "."),
+			port:     srv.Port,
+		}
+		addresses := slices.Clone(records.addresses[target])
+		slices.SortStableFunc(addresses, func(left, right net.IP) int {
+			return boolOrder(left.To4() == nil) - boolOrder(right.To4() == nil)
+		})
+		for _, address := range addresses {
+			if !address.IsLinkLocalUnicast() {
+				service.address = address.String()
+				break
+			}
+		}
+		services = append(services, service)
+	}
+	slices.SortFunc(services, func(left, right mdnsService) int {
+		return strings.Compare(left.instance, right.instance)
+	})
+	return services
+}
+
+func boolOrder(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func stubBrowseMDNS(t *testing.T, services []mdnsService) {
+	t.Helper()
+
+	original := browseMDNS
+	browseMDNS = func(time.Duration) ([]mdnsService, error) {
+		return slices.Clone(services), nil
+	}
+	t.Cleanup(func() { browseMDNS = original })
+}
+
+func buildMDNSAnswer(t *testing.T) []byte {
+	t.Helper()
+
+	header := func(name string, resourceType dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: resourceType, Class: dnsmessage.ClassINET, TTL: 120}
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	if err := builder.StartAnswers(); err != nil {
+		t.Fatalf("StartAnswers() error = %v", err)
+	}
+	for _, instance := range []string{"pi._ssh._tcp.local.", "nas._ssh._tcp.local.", "printer._ssh._tcp.local."} {
+		if err := builder.PTRResource(header(mdnsSSHService, dnsmessage.TypePTR), dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(instance)}); err != nil {
+			t.Fatalf("PTRResource() error = %v", err)
+		}
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		t.Fatalf("StartAdditionals() error = %v", err)
+	}
+	srvRecords := map[string]dnsmessage.SRVResource{
+		"pi._ssh._tcp.local.":  {Target: dnsmessage.MustNewName("raspberrypi.local."), Port: 22},
+		"nas._ssh._tcp.local.": {Target: dnsmessage.MustNewName("NAS.local."), Port: 2222},
+	}
+	for _, name := range []string{"pi._ssh._tcp.local.", "nas._ssh._tcp.local."} {
+		if err := builder.SRVResource(header(name, dnsmessage.TypeSRV), srvRecords[name]); err != nil {
+			t.Fatalf("SRVResource() error = %v", err)
+		}
+	}
+	if err := builder.AAAAResource(header("raspberrypi.local.", dnsmessage.TypeAAAA), dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 1}}); err != nil {
+		t.Fatalf("AAAAResource() error = %v", err)
+	}
+	if err := builder.AResource(header("raspberrypi.local.", dnsmessage.TypeA), dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}); err != nil {
+		t.Fatalf("AResource() error = %v", err)
+	}
+	if err := builder.AAAAResource(header("nas.local.", dnsmessage.TypeAAAA), dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 2}}); err != nil {
+		t.Fatalf("AAAAResource() error = %v", err)
+	}
+	packet, err := builder.Finish()
+	if err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	return packet
+}
+
+func TestMDNSRecordsServices(t *testing.T) {
+	records := newMDNSRecords()
+	if err := records.add(buildMDNSAnswer(t)); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+	query, err := buildMDNSQuery()
+	if err != nil {
+		t.Fatalf("buildMDNSQuery() error = %v", err)
+	}
+	if err := records.add(query); err != nil {
+		t.Fatalf("add(query) error = %v", err)
+	}
+
+	var targets []string
+	for _, service := range records.services() {
+		targets = append(targets, service.instance+"="+service.target())
+	}
+	// printer has no SRV record; nas only announced a link-local address.
+	if want := []string{"nas=nas.local:2222", "pi=192.168.1.20:22"}; !slices.Equal(targets, want) {
+		t.Fatalf("services = %q, want %q", targets, want)
+	}
+}
+
+func TestParseHostSelection(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{text: "all", want: []int{0, 1, 2, 3}},
+		{text: "3-4, 1", want: []int{0, 2, 3}},
+		{text: "2,2,1-2", want: []int{0, 1}},
+	}
+	for _, test := range tests {
+		got, err := parseHostSelection(test.text, 4)
+		if err != nil {
+			t.Fatalf("parseHostSelection(%q) error = %v", test.text, err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Fatalf("parseHostSelection(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+	for _, text := range []string{"0", "5", "4-2", "x", " , "} {
+		if _, err := parseHostSelection(text, 4); err == nil {
+			t.Fatalf("parseHostSelection(%q) error = nil, want error", text)
+		}
+	}
+}
+
+func TestDiscoverHostsWithYesTakesAll(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubBrowseMDNS(t, []mdnsService{
+		{instance: "nas", hostName: "nas.local", port: 22, address: "192.168.1.30"},
+		{instance: "pi", hostName: "raspberrypi.local", port: 22},
+	})
+
+	hosts, err := discoverHosts(bufio.NewReader(strings.NewReader("")), &options{Discover: "MDNS", AssumeYes: true})
+	if err != nil {
+		t.Fatalf("discoverHosts() error = %v", err)
+	}
+	if want := []string{"192.168.1.30:22", "raspberrypi.local:22"}; !slices.Equal(hosts, want) {
+		t.Fatalf("hosts = %q, want %q", hosts, want)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "1) nas => 192.168.1.30:22 (nas.local)") {
+		t.Fatalf("output missing discovered host: %q", output)
+	}
+}
+
+func TestDiscoverHostsRejectsUnknownMethod(t *testing.T) {
+	_, err := discoverHosts(bufio.NewReader(strings.NewReader("")), &options{Discover: "consul", AssumeYes: true})
+	if err == nil || !strings.Contains(err.Error(), `unknown --discover method "consul"`) {
+		t.Fatalf("discoverHosts() error = %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warning"
+	doctorFail = "failed"
+)
+
+var (
+	lookPathForDoctor  = exec.LookPath
+	dialAgentForDoctor = func(socketPath string) (net.Conn, error) {
+		return net.DialTimeout("unix", socketPath, 2*time.Second)
+	}
+)
+
+// doctorFinding is the result of one doctor check. fix tells the operator
+// what to do about a warning or failure.
+type doctorFinding struct {
+	status string
+	detail string
+	fix    string
+}
+
+type doctorCheck struct {
+	title string
+	run   func(programOptions *options) doctorFinding
+}
+
+func doctorChecks() []doctorCheck {
+	return []doctorCheck{
+		{title: "known_hosts", run: checkDoctorKnownHosts},
+		{title: "ssh-agent", run: checkDoctorAgent},
+		{title: "Bitwarden CLIs (bw, bws)", run: checkDoctorBitwarden},
+		{title: "Infisical", run: checkDoctorInfisical},
+		{title: "External commands", run: checkDoctorExternalCommands},
+		{title: "Terminal", run: checkDoctorTerminal},
+	}
+}
+
+// runDoctorCommand checks the local environment a run depends on and prints
+// a fix for every problem. Warnings leave the exit code at 0; any failure
+// exits with 1.
+func runDoctorCommand(programOptions *options, args []string) error {
+	if len(args) > 0 {
+		return fail(2, "doctor takes no arguments")
+	}
+
+	outputAnsibleTask("Config file")
+	if err := applyConfigFiles(programOptions, newStandardInputReader()); err != nil {
+		// The remaining checks still run with defaults and flags.
+		printDoctorFinding(doctorFinding{status: doctorFail, detail: err.Error(), fix: "fix the file named above, or run without --env/--config to check the defaults"})
+		return finishDoctor(1, 0, doctorRunChecks(programOptions))
+	}
+	switch {
+	case strings.TrimSpace(programOptions.ConfigFile) != "":
+		printDoctorFinding(doctorFinding{status: doctorOK, detail: "loaded " + programOptions.ConfigFile})
+	case strings.TrimSpace(programOptions.EnvFile) != "":
+		printDoctorFinding(doctorFinding{status: doctorOK, detail: "loaded " + programOptions.EnvFile})
+	default:
+		printDoctorFinding(doctorFinding{status: doctorOK, detail: "none; checking defaults and flags"})
+	}
+	return finishDoctor(0, 0, doctorRunChecks(programOptions))
+}
+
+func doctorRunChecks(programOptions *options) []doctorFinding {
+	findings := make([]doctorFinding, 0, len(doctorChecks()))
+	for _, check := range doctorChecks() {
+		outputAnsibleTask(check.title)
+		finding := check.run(programOptions)
+		printDoctorFinding(finding)
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+func finishDoctor(failures, warnings int, findings []doctorFinding) error {
+	for _, finding := range findings {
+		switch finding.status {
+		case doctorFail:
+			failures++
+		case doctorWarn:
+			warnings++
+		}
+	}
+	outputPrintln()
+	outputPrintf("Doctor: %d failure(s), %d warning(s).\n", failures, warnings)
+	if failures > 0 {
+		return fail(1, "doctor found %d problem(s) that will stop a run", failures)
+	}
+	return nil
+}
+
+func printDoctorFinding(finding doctorFinding) {
+	switch finding.status {
+	case doctorWarn:
+		outputAnsibleHostStatus("ok", "localhost", finding.detail)
+		outputPrintf("[WARNING]: %s\n", finding.fix)
+	case doctorFail:
+		outputAnsibleHostStatus("failed", "localhost", finding.detail)
+		outputPrintf("  fix: %s\n", finding.fix)
+	default:
+		outputAnsibleHostStatus("ok", "localhost", finding.detail)
+	}
+}
+
+func checkDoctorKnownHosts(programOptions *options) doctorFinding {
+	if programOptions.InsecureIgnoreHostKey {
+		return doctorFinding{status: doctorWarn, detail: "host key verification is disabled (INSECURE_IGNORE_HOST_KEY=true)", fix: "set INSECURE_IGNORE_HOST_KEY=false outside lab environments; use --accept-new-host-keys for fresh hosts"}
+	}
+	knownHostsPath := strings.TrimSpace(programOptions.KnownHosts)
+	if knownHostsPath == "" {
+		knownHostsPath = defaultKnownHostsPath
+	}
+	expandedPath, err := expandHomePath(knownHostsPath)
+	if err != nil {
+		return doctorFinding{status: doctorFail, detail: err.Error(), fix: "set KNOWN_HOSTS to a path you can read"}
+	}
+
+	file, err := os.Open(expandedPath) // #nosec G304 -- known_hosts path is user-configurable by design
+	if errors.Is(err, fs.ErrNotExist) {
+		return doctorFinding{status: doctorWarn, detail: expandedPath + " does not exist yet", fix: "it is created when the first host is trusted; copy your team's known_hosts there to skip the trust prompts"}
+	}
+	if err != nil {
+		return doctorFinding{status: doctorFail, detail: err.Error(), fix: "chmod u+rw " + expandedPath}
+	}
+	_ = file.Close()
+	if _, err := knownhosts.New(expandedPath); err != nil {
+		return doctorFinding{status: doctorFail, detail: err.Error(), fix: "remove or repair the line named above, e.g. with ssh-keygen -R <host> -f " + expandedPath}
+	}
+	writable, err := os.OpenFile(expandedPath, os.O_WRONLY|os.O_APPEND, 0) // #nosec G304 -- known_hosts path is user-configurable by design
+	if err != nil {
+		return doctorFinding{status: doctorWarn, detail: expandedPath + " is read-only", fix: "newly trusted hosts cannot be saved; chmod u+w " + expandedPath + " or use --known-hosts-out <path>"}
+	}
+	_ = writable.Close()
+	return doctorFinding{status: doctorOK, detail: expandedPath + " is readable and writable"}
+}
+
+func checkDoctorAgent(programOptions *options) doctorFinding {
+	// The agent only matters for publickey logins; report it either way.
+	needsAgent := false
+	if methods, err := resolveAuthMethods(programOptions); err == nil {
+		needsAgent = slices.Contains(methods, authMethodPublicKey)
+	}
+	problem := func(detail, fix string) doctorFinding {
+		if needsAgent {
+			return doctorFinding{status: doctorFail, detail: detail, fix: fix}
+		}
+		return doctorFinding{status: doctorWarn, detail: detail + " (not needed for AUTH_METHODS without publickey)", fix: fix}
+	}
+
+	socketPath := strings.TrimSpace(os.Getenv("SSH_AUTH_SOCK"))
+	if socketPath == "" {
+		return problem("SSH_AUTH_SOCK is not set", "start an agent with eval \"$(ssh-agent)\" and load a key with ssh-add")
+	}
+	connection, err := dialAgentForDoctor(socketPath)
+	if err != nil {
+		return problem("cannot connect to ssh-agent: "+err.Error(), "the agent at SSH_AUTH_SOCK is gone; start a new one with eval \"$(ssh-agent)\"")
+	}
+	defer connection.Close()
+	keys, err := agent.NewClient(connection).List()
+	if err != nil {
+		return problem("ssh-agent did not list its keys: "+err.Error(), "restart the agent")
+	}
+	if len(keys) == 0 {
+		return problem("ssh-agent is running but holds no keys", "load your key with ssh-add")
+	}
+	return doctorFinding{status: doctorOK, detail: fmt.Sprintf("ssh-agent holds %d key(s)", len(keys))}
+}
+
+func checkDoctorBitwarden(programOptions *options) doctorFinding {
+	var found, missing []string
+	for _, name := range []string{"bw", "bws"} {
+		if path, err := lookPathForDoctor(name); err == nil {
+			found = append(found, name+" ("+path+")")
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return doctorFinding{status: doctorOK, detail: strings.Join(found, ", ")}
+	}
+	fix := "install the Bitwarden CLI (bw) or Secrets Manager CLI (bws) if you use bw:// secret references"
+	if len(found) == 0 && usesDoctorProvider(programOptions, "bitwarden", "bw://", "bitwarden://") {
+		return doctorFinding{status: doctorFail, detail: "neither bw nor bws is on PATH, but the config uses Bitwarden", fix: fix}
+	}
+	if len(found) == 0 {
+		return doctorFinding{status: doctorOK, detail: "not installed (only needed for bw:// secret references)"}
+	}
+	return doctorFinding{status: doctorOK, detail: strings.Join(found, ", ") + "; " + strings.Join(missing, ", ") + " not on PATH"}
+}
+
+func checkDoctorInfisical(programOptions *options) doctorFinding {
+	// The provider talks to the Infisical API directly; the infisical CLI is
+	// not used.
+	var missing []string
+	for _, name := range []string{"INFISICAL_UNIVERSAL_AUTH_CLIENT_ID", "INFISICAL_UNIVERSAL_AUTH_CLIENT_SECRET"} {
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return doctorFinding{status: doctorOK, detail: "universal auth credentials are set"}
+	}
+	if usesDoctorProvider(programOptions, "infisical", "infisical://", "inf://") {
+		return doctorFinding{status: doctorFail, detail: strings.Join(missing, ", ") + " not set, but the config uses Infisical", fix: "export the machine identity's universal auth client ID and secret"}
+	}
+	return doctorFinding{status: doctorOK, detail: "not configured (only needed for infisical:// secret references)"}
+}
+
+// usesDoctorProvider reports whether the loaded settings point at a secret
+// provider, by PASSWORD_PROVIDER or by the scheme of a secret reference.
+func usesDoctorProvider(programOptions *options, providerName string, schemes ...string) bool {
+	if strings.EqualFold(strings.TrimSpace(readPasswordProviderSelection(programOptions)), providerName) {
+		return true
+	}
+	references := []string{programOptions.PasswordSecretRef, programOptions.HostPasswordSecretRefs, programOptions.PasswordSecretRefTemplate}
+	for _, hostSpec := range programOptions.Hosts {
+		references = append(references, hostSpec.PasswordSecretRef)
+	}
+	for _, reference := range references {
+		for _, scheme := range schemes {
+			if strings.Contains(strings.ToLower(reference), scheme) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkDoctorExternalCommands looks for the programs the selected options
+// run: ssh for --use-openssh and the helper of a --transport.
+func checkDoctorExternalCommands(programOptions *options) doctorFinding {
+	required := map[string]string{}
+	if programOptions.UseOpenSSH {
+		required["ssh"] = "--use-openssh"
+	}
+	switch strings.ToLower(strings.TrimSpace(programOptions.Transport)) {
+	case "ssm":
+		required["aws"] = "--transport ssm"
+	case "teleport":
+		required["tsh"] = "--transport teleport"
+	case "boundary":
+		required["boundary"] = "--transport boundary"
+	}
+	if len(required) == 0 {
+		return doctorFinding{status: doctorOK, detail: "none needed by the selected options"}
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var found []string
+	for _, name := range names {
+		if _, err := lookPathForDoctor(name); err != nil {
+			return doctorFinding{status: doctorFail, detail: fmt.Sprintf("%s is not on PATH (needed for %s)", name, required[name]), fix: "install " + name + " or add its directory to PATH"}
+		}
+		found = append(found, name)
+	}
+	return doctorFinding{status: doctorOK, detail: strings.Join(found, ", ") + " found"}
+}
+
+func checkDoctorTerminal(*options) doctorFinding {
+	if !currentPrompter().Interactive(standardInputFile()) {
+		return doctorFinding{status: doctorWarn, detail: "stdin is not a terminal", fix: "prompts cannot be answered; set USER, PASSWORD or a secret reference and the hosts in the config, and pass --yes for large runs"}
+	}
+	if !currentPrompter().Interactive(standardOutputFile()) {
+		return doctorFinding{status: doctorWarn, detail: "stdout is not a terminal", fix: "the loaded-config preview is skipped; output is plain text and safe to log"}
+	}
+	return doctorFinding{status: doctorOK, detail: "stdin and stdout are terminals; prompts can be answered"}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func stubDoctorEnvironment(t *testing.T, terminal bool, lookPath func(string) (string, error)) {
+	t.Helper()
+
+	originalLookPath, originalDialAgent := lookPathForDoctor, dialAgentForDoctor
+	t.Cleanup(func() {
+		lookPathForDoctor, dialAgentForDoctor = originalLookPath, originalDialAgent
+	})
+	lookPathForDoctor = lookPath
+	stubPrompter(t, &scriptedPrompter{interactive: terminal})
+
+	keyring := agent.NewKeyring()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+	dialAgentForDoctor = func(string) (net.Conn, error) {
+		clientConn, serverConn := net.Pipe()
+		go func() {
+			_ = agent.ServeAgent(keyring, serverConn)
+			_ = serverConn.Close()
+		}()
+		return clientConn, nil
+	}
+}
+
+func TestDoctorPassesOnHealthyEnvironment(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubDoctorEnvironment(t, true, func(name string) (string, error) { return "/usr/bin/" + name, nil })
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	t.Setenv("INFISICAL_UNIVERSAL_AUTH_CLIENT_ID", "id")
+	t.Setenv("INFISICAL_UNIVERSAL_AUTH_CLIENT_SECRET", "secret")
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsPath, []byte("app01 "+generateTestKey(t)+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+
+	if err := runDoctorCommand(&options{KnownHosts: knownHostsPath, UseOpenSSH: true}, nil); err != nil {
+		t.Fatalf("runDoctorCommand() error = %v\n%s", err, outputBuffer.String())
+	}
+	output := outputBuffer.String()
+	for _, want := range []string{"is readable and writable", "ssh-agent holds 1 key(s)", "bw (/usr/bin/bw), bws (/usr/bin/bws)", "ssh found", "Doctor: 0 failure(s), 0 warning(s)."} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestDoctorReportsProblemsWithFixes(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubDoctorEnvironment(t, false, func(name string) (string, error) { return "", errors.New("not found") })
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("INFISICAL_UNIVERSAL_AUTH_CLIENT_ID", "")
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsPath, []byte("app01 ssh-ed25519 not-base64\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+
+	err := runDoctorCommand(&options{
+		KnownHosts:        knownHostsPath,
+		AuthMethods:       "publickey",
+		PasswordSecretRef: "bw://ssh-root",
+		Transport:         "ssm",
+	}, nil)
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 1 {
+		t.Fatalf("runDoctorCommand() error = %v, want exit 1", err)
+	}
+	output := outputBuffer.String()
+	for _, want := range []string{
+		"failed: [localhost] => knownhosts: " + knownHostsPath + ":1: ",
+		"  fix: remove or repair the line named above",
+		"failed: [localhost] => SSH_AUTH_SOCK is not set\n  fix: start an agent",
+		"neither bw nor bws is on PATH, but the config uses Bitwarden",
+		"aws is not on PATH (needed for --transport ssm)",
+		"[WARNING]: prompts cannot be answered",
+		"Doctor: 4 failure(s), 1 warning(s).",
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("output missing %q:\n%s", want, output)
+		}
+	}
+}
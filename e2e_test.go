@@ -0,0 +1,270 @@
+//go:build e2e
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The end-to-end tests run the whole program in-process against a real SSH
+// server on a loopback port: run() dials it over TCP, checks its host key
+// against a known_hosts file and runs the operations' shell scripts, which
+// the server executes with sh in a sandbox home directory. Run them with
+// make e2e (go test -tags e2e).
+
+// e2eSSHServer is a throwaway sshd. It accepts one user and password, and
+// runs exec requests with sh, HOME set to its home directory and a getent
+// shim that reports that directory, so scripts never touch the real home.
+type e2eSSHServer struct {
+	address  string
+	hostKey  ssh.Signer
+	home     string
+	user     string
+	password string
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func startE2ESSHServer(t *testing.T, hostKey ssh.Signer) *e2eSSHServer {
+	t.Helper()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skipf("the end-to-end server needs sh: %v", err)
+	}
+	server := &e2eSSHServer{hostKey: hostKey, home: t.TempDir(), user: "deploy", password: "e2e-password"}
+	shimDirectory := t.TempDir()
+	getentShim := "#!/bin/sh\necho \"" + server.user + ":x:1000:1000::" + server.home + ":/bin/sh\"\n"
+	if err := os.WriteFile(filepath.Join(shimDirectory, "getent"), []byte(getentShim), 0o700); err != nil { // #nosec G306 -- the shim must be executable
+		t.Fatalf("write getent shim: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("loopback TCP is unavailable in this environment: %v", err)
+	}
+	server.address = listener.Addr().String()
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(metadata ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if metadata.User() == server.user && string(password) == server.password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong user or password")
+		},
+	}
+	serverConfig.AddHostKey(hostKey)
+
+	var connections sync.WaitGroup
+	connections.Go(func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connections.Go(func() { server.serve(connection, serverConfig, shimDirectory) })
+		}
+	})
+	t.Cleanup(func() {
+		_ = listener.Close()
+		connections.Wait()
+	})
+	return server
+}
+
+func (server *e2eSSHServer) serve(connection net.Conn, serverConfig *ssh.ServerConfig, shimDirectory string) {
+	defer connection.Close()
+
+	sshConnection, channels, requests, err := ssh.NewServerConn(connection, serverConfig)
+	if err != nil {
+		return
+	}
+	defer sshConnection.Close()
+	go ssh.DiscardRequests(requests)
+
+	var sessions sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		sessions.Go(func() { server.runSession(channel, channelRequests, shimDirectory) })
+	}
+	sessions.Wait()
+}
+
+func (server *e2eSSHServer) runSession(channel ssh.Channel, requests <-chan *ssh.Request, shimDirectory string) {
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type != "exec" {
+			if request.WantReply {
+				_ = request.Reply(false, nil)
+			}
+			continue
+		}
+		var execRequest struct{ Command string }
+		if err := ssh.Unmarshal(request.Payload, &execRequest); err != nil {
+			_ = request.Reply(false, nil)
+			return
+		}
+		_ = request.Reply(true, nil)
+		server.mu.Lock()
+		server.commands = append(server.commands, execRequest.Command)
+		server.mu.Unlock()
+
+		command := exec.Command("sh", "-c", execRequest.Command) // #nosec G204 -- the test server runs the program's own scripts
+		command.Dir = server.home
+		command.Env = []string{"HOME=" + server.home, "PATH=" + shimDirectory + string(os.PathListSeparator) + os.Getenv("PATH")}
+		command.Stdin = channel
+		command.Stdout = channel
+		command.Stderr = channel.Stderr()
+		exitStatus := uint32(0)
+		if err := command.Run(); err != nil {
+			exitStatus = 1
+			if exitErr, ok := errors.AsType[*exec.ExitError](err); ok {
+				exitStatus = uint32(exitErr.ExitCode()) // #nosec G115 -- exit codes are small
+			}
+		}
+		_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{exitStatus}))
+		return
+	}
+}
+
+func (server *e2eSSHServer) authorizedKeys(t *testing.T) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(server.home, ".ssh", "authorized_keys"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("read authorized_keys: %v", err)
+	}
+	return string(content)
+}
+
+// e2eRun runs the program in-process with args, answering prompts from
+// answers, and returns its stdout and stderr.
+func e2eRun(t *testing.T, answers []string, args ...string) (string, string, error) {
+	t.Helper()
+
+	var outputBuffer, errorBuffer bytes.Buffer
+	setCommandLineForTest(t, append([]string{"ssh-key-bootstrap"}, args...))
+	err := run(runtimeIO{
+		Stdin:    strings.NewReader(""),
+		Stdout:   &outputBuffer,
+		Stderr:   &errorBuffer,
+		Prompter: &scriptedPrompter{interactive: true, answers: answers},
+	})
+	return outputBuffer.String(), errorBuffer.String(), err
+}
+
+// setUpE2EWorkstation isolates the operator side: its home, state directory
+// and agent, so a run reads nothing from the machine running the tests.
+func setUpE2EWorkstation(t *testing.T, server *e2eSSHServer, publicKey string) (string, string) {
+	t.Helper()
+
+	workstation := t.TempDir()
+	t.Setenv("HOME", workstation)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(workstation, "state"))
+	t.Setenv("SSH_AUTH_SOCK", "")
+	knownHostsPath := filepath.Join(workstation, "known_hosts")
+	dotEnvPath := filepath.Join(workstation, ".env")
+	dotEnvContent := "SERVERS=" + server.address + "\nUSER=" + server.user + "\nPASSWORD=" + server.password +
+		"\nKEY='" + publicKey + "'\nKNOWN_HOSTS=" + knownHostsPath + "\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	return dotEnvPath, knownHostsPath
+}
+
+func TestE2EInstallKeyTrustsHostOnFirstUseAndIsIdempotent(t *testing.T) {
+	server := startE2ESSHServer(t, newTestHostSigner(t))
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath, knownHostsPath := setUpE2EWorkstation(t, server, publicKey)
+
+	stdout, stderr, err := e2eRun(t, []string{"yes"}, "--env", dotEnvPath)
+	if err != nil {
+		t.Fatalf("first run error = %v\nstdout:\n%s\nstderr:\n%s", err, stdout, stderr)
+	}
+	if !strings.Contains(stdout, "can't be established") || !strings.Contains(stdout, "changed: ["+server.address+"]") {
+		t.Fatalf("first run did not ask to trust the host and add the key:\n%s", stdout)
+	}
+	knownHosts, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatalf("read known_hosts: %v", err)
+	}
+	if !strings.Contains(string(knownHosts), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(server.hostKey.PublicKey())))) {
+		t.Fatalf("known_hosts is missing the trusted host key:\n%s", knownHosts)
+	}
+	if got := strings.Count(server.authorizedKeys(t), publicKey); got != 1 {
+		t.Fatalf("authorized_keys holds the key %d times after the first run, want 1:\n%s", got, server.authorizedKeys(t))
+	}
+
+	stdout, stderr, err = e2eRun(t, nil, "--env", dotEnvPath)
+	if err != nil {
+		t.Fatalf("second run error = %v\nstdout:\n%s\nstderr:\n%s", err, stdout, stderr)
+	}
+	if strings.Contains(stdout, "can't be established") || !strings.Contains(stdout, "ok: ["+server.address+"]") {
+		t.Fatalf("second run asked again or changed the host:\n%s", stdout)
+	}
+	if got := strings.Count(server.authorizedKeys(t), publicKey); got != 1 {
+		t.Fatalf("authorized_keys holds the key %d times after the second run, want 1", got)
+	}
+}
+
+func TestE2EDeclinedHostIsNotContacted(t *testing.T) {
+	server := startE2ESSHServer(t, newTestHostSigner(t))
+	dotEnvPath, knownHostsPath := setUpE2EWorkstation(t, server, strings.TrimSpace(generateTestKey(t)))
+
+	stdout, stderr, err := e2eRun(t, []string{"no"}, "--env", dotEnvPath)
+	if err == nil || exitCodeOf(err) != exitHostKeyRejected {
+		t.Fatalf("run with the host declined error = %v, want a rejected host key\nstdout:\n%s\nstderr:\n%s", err, stdout, stderr)
+	}
+	if knownHosts, _ := os.ReadFile(knownHostsPath); len(bytes.TrimSpace(knownHosts)) > 0 {
+		t.Fatalf("declined host was written to known_hosts:\n%s", knownHosts)
+	}
+	if server.authorizedKeys(t) != "" {
+		t.Fatalf("declined host was changed")
+	}
+}
+
+func TestE2EChangedHostKeyFailsTheRun(t *testing.T) {
+	server := startE2ESSHServer(t, newTestHostSigner(t))
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath, knownHostsPath := setUpE2EWorkstation(t, server, publicKey)
+
+	otherKey := ssh.MarshalAuthorizedKey(newTestHostSigner(t).PublicKey())
+	knownHostsLine := "[127.0.0.1]:" + server.address[strings.LastIndex(server.address, ":")+1:] + " " + string(otherKey)
+	if err := os.WriteFile(knownHostsPath, []byte(knownHostsLine), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+
+	stdout, stderr, err := e2eRun(t, nil, "--env", dotEnvPath)
+	if err == nil || exitCodeOf(err) != exitHostKeyRejected {
+		t.Fatalf("run against a changed host key error = %v, want a rejected host key\nstdout:\n%s", err, stdout)
+	}
+	if output := stdout + stderr; !strings.Contains(strings.ToLower(output), "host key") {
+		t.Fatalf("failure does not mention the host key:\n%s", output)
+	}
+	if server.authorizedKeys(t) != "" {
+		t.Fatalf("host with a changed key was changed")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != 0 {
+		t.Fatalf("commands ran on a host with a changed key: %q", server.commands)
+	}
+}
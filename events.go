@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventsFormatNDJSON = "ndjson"
+
+// runEvent is one line of the --events ndjson stream. Fields that do not apply
+// to an event type are omitted.
+type runEvent struct {
+	Time      string `json:"time"`
+	Event     string `json:"event"`
+	RunID     string `json:"runId,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Changed   *bool  `json:"changed,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Hosts     int    `json:"hosts,omitempty"`
+	Failed    int    `json:"failed,omitempty"`
+	// Done, Remaining and ETASeconds count host tasks in progress events.
+	Done       *int `json:"done,omitempty"`
+	Remaining  *int `json:"remaining,omitempty"`
+	ETASeconds *int `json:"etaSeconds,omitempty"`
+}
+
+var (
+	eventSinkMu sync.Mutex
+	eventSink   io.Writer
+	eventNow    = time.Now
+)
+
+// configureEventStream routes lifecycle events to stdout as NDJSON and moves
+// the human-readable output to stderr so stdout stays machine-readable. The
+// returned function restores the previous writers.
+func configureEventStream(format string) (func(), error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "":
+		return func() {}, nil
+	case eventsFormatNDJSON:
+	default:
+		return nil, fmt.Errorf("unsupported events format %q (valid: %s)", format, eventsFormatNDJSON)
+	}
+
+	outputWriter, restoreOutput := moveHumanOutputToStderr()
+	eventSinkMu.Lock()
+	eventSink = outputWriter
+	eventSinkMu.Unlock()
+
+	return func() {
+		eventSinkMu.Lock()
+		eventSink = nil
+		eventSinkMu.Unlock()
+		restoreOutput()
+	}, nil
+}
+
+// moveHumanOutputToStderr sends the human-readable output to stderr so that
+// stdout can carry machine-readable data. It returns the previous stdout
+// writer and a function that restores both writers.
+func moveHumanOutputToStderr() (io.Writer, func()) {
+	outputWriter := getStandardOutputWriter()
+	errorWriter := getStandardErrorWriter()
+	setStandardWriters(errorWriter, errorWriter)
+	return outputWriter, func() {
+		setStandardWriters(outputWriter, errorWriter)
+	}
+}
+
+func emitEvent(event runEvent) {
+	eventSinkMu.Lock()
+	defer eventSinkMu.Unlock()
+	if eventSink == nil {
+		return
+	}
+
+	event.Time = eventNow().UTC().Format(time.RFC3339Nano)
+	if event.RunID == "" {
+		event.RunID = currentRunID()
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = eventSink.Write(append(eventBytes, '\n'))
+}
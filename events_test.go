@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunEmitsNDJSONEventsOnStdout(t *testing.T) {
+	outputBuffer, errorBuffer := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVERS=ok-host,bad-host\nUSER=deploy\nPASSWORD=password\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		if address == "bad-host:22" {
+			return nil, errors.New("connection refused")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			return "", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--events", "ndjson"})
+	if err := run(capturedRuntimeIO()); err == nil {
+		t.Fatalf("expected run() error for the failed host")
+	}
+
+	var eventNames []string
+	var lastProgress runEvent
+	for _, line := range strings.Split(strings.TrimSpace(outputBuffer.String()), "\n") {
+		var event runEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("stdout line is not a JSON event: %q (%v)", line, err)
+		}
+		eventNames = append(eventNames, event.Event+"@"+event.Host)
+		if event.Event == "progress" {
+			lastProgress = event
+		}
+	}
+	want := "run_started@,host_started@bad-host:22,host_failed@bad-host:22,progress@,host_started@ok-host:22,connected@ok-host:22,key_added@ok-host:22,progress@,run_finished@"
+	if strings.Join(eventNames, ",") != want {
+		t.Fatalf("events = %s, want %s", strings.Join(eventNames, ","), want)
+	}
+	if lastProgress.Done == nil || *lastProgress.Done != 2 || lastProgress.Remaining == nil || *lastProgress.Remaining != 0 ||
+		lastProgress.ETASeconds == nil || *lastProgress.ETASeconds != 0 {
+		t.Fatalf("last progress event = %+v, want 2 done, 0 remaining and 0s left", lastProgress)
+	}
+	if !strings.Contains(errorBuffer.String(), "PLAY RECAP") {
+		t.Fatalf("human-readable output was not moved to stderr: %q", errorBuffer.String())
+	}
+}
+
+func TestRunTagsEveryEventWithTheRunID(t *testing.T) {
+	outputBuffer, errorBuffer := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVERS=ok-host\nUSER=deploy\nPASSWORD=password\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			return "", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--events", "ndjson", "--run-id", "CHG-1234"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(outputBuffer.String()), "\n") {
+		var event runEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("stdout line is not a JSON event: %q (%v)", line, err)
+		}
+		if event.RunID != "CHG-1234" {
+			t.Fatalf("event %s runId = %q, want CHG-1234", event.Event, event.RunID)
+		}
+	}
+	if !strings.Contains(errorBuffer.String(), "CHG-1234") {
+		t.Fatalf("recap does not name the run: %q", errorBuffer.String())
+	}
+	if runID := currentRunID(); runID != "" {
+		t.Fatalf("run ID %q still active after the run", runID)
+	}
+}
+
+func TestConfigureEventStreamRejectsUnknownFormat(t *testing.T) {
+	if _, err := configureEventStream("xml"); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+	restore, err := configureEventStream("")
+	if err != nil {
+		t.Fatalf("configureEventStream(\"\") error = %v", err)
+	}
+	restore()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Exit codes are part of the CLI contract; orchestration scripts branch on
+// them, so existing values must never be renumbered.
+const (
+	exitOK              = 0
+	exitHostFailure     = 1
+	exitConfigError     = 2
+	exitAuthFailure     = 3
+	exitNetworkFailure  = 4
+	exitHostKeyRejected = 5
+	exitPartialFailure  = 6
+)
+
+type exitCodeInfo struct {
+	code        int
+	name        string
+	description string
+}
+
+func exitCodeTable() []exitCodeInfo {
+	return []exitCodeInfo{
+		{exitOK, "ok", "All hosts succeeded (or there was nothing to do)."},
+		{exitHostFailure, "host-failure", "Hosts failed for mixed or remote-side reasons (script error, sudo failure, failed preflight), drift was detected, or a local step after the SSH phase failed."},
+		{exitConfigError, "config-error", "Invalid flags, configuration, inputs or secrets; nothing was changed on any host."},
+		{exitAuthFailure, "auth-failure", "Every failed host rejected the SSH credentials."},
+		{exitNetworkFailure, "network-failure", "Every failed host was unreachable (DNS, refused, timeout, connection dropped)."},
+		{exitHostKeyRejected, "host-key-rejected", "Every failed host presented a host key that did not match known_hosts or was rejected at the trust prompt."},
+		{exitPartialFailure, "partial", "Some hosts succeeded and others failed."},
+	}
+}
+
+func explainExitCode(code int) (exitCodeInfo, bool) {
+	for _, info := range exitCodeTable() {
+		if info.code == code {
+			return info, true
+		}
+	}
+	return exitCodeInfo{}, false
+}
+
+// runExplainExit prints the meaning of one exit code, or of all codes for
+// "all", for --explain-exit.
+func runExplainExit(value string) error {
+	trimmedValue := strings.ToLower(strings.TrimSpace(value))
+	if trimmedValue == "all" {
+		for _, info := range exitCodeTable() {
+			outputPrintf("%d %-18s %s\n", info.code, info.name, info.description)
+		}
+		return nil
+	}
+
+	code, err := strconv.Atoi(trimmedValue)
+	if err != nil {
+		return fail(exitConfigError, "--explain-exit expects an exit code or \"all\", got %q", value)
+	}
+	info, ok := explainExitCode(code)
+	if !ok {
+		return fail(exitConfigError, "exit code %d is not used by %s", code, appName)
+	}
+	outputPrintf("%d %s: %s\n", info.code, info.name, info.description)
+	return nil
+}
+
+// hostErrorCategory buckets a host failure for the PLAY RECAP breakdown and
+// the exit code.
+type hostErrorCategory string
+
+const (
+	hostErrorDNS            hostErrorCategory = "dns"
+	hostErrorConnectTimeout hostErrorCategory = "connect-timeout"
+	hostErrorConnect        hostErrorCategory = "connect"
+	hostErrorAuth           hostErrorCategory = "auth"
+	hostErrorHostKey        hostErrorCategory = "host-key"
+	hostErrorSession        hostErrorCategory = "session"
+	hostErrorRemoteScript   hostErrorCategory = "remote-script"
+	hostErrorStopped        hostErrorCategory = "stopped"
+)
+
+// hostErrorCategories lists every category in the order the recap shows them.
+var hostErrorCategories = []hostErrorCategory{
+	hostErrorDNS, hostErrorConnectTimeout, hostErrorConnect, hostErrorAuth,
+	hostErrorHostKey, hostErrorSession, hostErrorRemoteScript, hostErrorStopped,
+}
+
+// hostKeyRejectedError is returned when the operator declines an unknown host.
+type hostKeyRejectedError struct {
+	hostname string
+}
+
+func (rejectedErr *hostKeyRejectedError) Error() string {
+	return fmt.Sprintf("host key for %s rejected by user", rejectedErr.hostname)
+}
+
+// sessionError is a failure of the SSH session itself (opening a channel)
+// rather than of the remote script.
+type sessionError struct {
+	op  string
+	err error
+}
+
+func (sessionErr *sessionError) Error() string {
+	return sessionErr.op + ": " + sessionErr.err.Error()
+}
+
+func (sessionErr *sessionError) Unwrap() error {
+	return sessionErr.err
+}
+
+// opensshErrorCategories maps messages of the system ssh client (exit 255)
+// to categories, since --use-openssh only reports text.
+var opensshErrorCategories = []struct {
+	fragment string
+	category hostErrorCategory
+}{
+	{"Could not resolve hostname", hostErrorDNS},
+	{"Connection timed out", hostErrorConnectTimeout},
+	{"Operation timed out", hostErrorConnectTimeout},
+	{"Permission denied", hostErrorAuth},
+	{"Host key verification failed", hostErrorHostKey},
+	{"REMOTE HOST IDENTIFICATION HAS CHANGED", hostErrorHostKey},
+	{"Connection refused", hostErrorConnect},
+	{"No route to host", hostErrorConnect},
+	{"Network is unreachable", hostErrorConnect},
+	{"Connection closed by", hostErrorSession},
+	{"Connection reset by", hostErrorSession},
+}
+
+func classifyHostError(err error) hostErrorCategory {
+	if err == nil {
+		return hostErrorRemoteScript
+	}
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+	var rejectedErr *hostKeyRejectedError
+	var weakErr *weakHostKeyError
+	var unexpectedErr *unexpectedHostKeyError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var sessionErr *sessionError
+	var exitMissingErr *ssh.ExitMissingError
+	switch {
+	case errors.Is(err, errRunStopped):
+		return hostErrorStopped
+	case errors.As(err, &keyErr), errors.As(err, &revokedErr), errors.As(err, &rejectedErr), errors.As(err, &weakErr), errors.As(err, &unexpectedErr),
+		strings.Contains(err.Error(), "no common algorithm for host key"):
+		return hostErrorHostKey
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return hostErrorAuth
+	case errors.As(err, &dnsErr):
+		return hostErrorDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return hostErrorConnectTimeout
+	case errors.As(err, &netErr):
+		return hostErrorConnect
+	case errors.As(err, &sessionErr), errors.As(err, &exitMissingErr), errors.Is(err, io.EOF),
+		strings.Contains(err.Error(), "ssh: handshake failed"):
+		return hostErrorSession
+	}
+	if strings.HasPrefix(err.Error(), "ssh: ") {
+		for _, mapping := range opensshErrorCategories {
+			if strings.Contains(err.Error(), mapping.fragment) {
+				return mapping.category
+			}
+		}
+	}
+	return hostErrorRemoteScript
+}
+
+// exitCode is the exit code for a run whose failed hosts all fall into this
+// category.
+func (category hostErrorCategory) exitCode() int {
+	switch category {
+	case hostErrorAuth:
+		return exitAuthFailure
+	case hostErrorDNS, hostErrorConnectTimeout, hostErrorConnect, hostErrorSession:
+		return exitNetworkFailure
+	case hostErrorHostKey:
+		return exitHostKeyRejected
+	default:
+		return exitHostFailure
+	}
+}
+
+// hostFailureCategoryCounts counts failed hosts per category.
+func hostFailureCategoryCounts(hosts []string, hostRecaps map[string]hostRunRecap) map[hostErrorCategory]int {
+	counts := map[hostErrorCategory]int{}
+	for _, host := range hosts {
+		if recap := hostRecaps[host]; recap.failed > 0 {
+			counts[classifyHostError(recap.lastErr)]++
+		}
+	}
+	return counts
+}
+
+// describeHostFailureCategories renders counts as "auth: 2, dns: 1" in recap
+// order.
+func describeHostFailureCategories(counts map[hostErrorCategory]int) string {
+	var parts []string
+	for _, category := range hostErrorCategories {
+		if counts[category] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", category, counts[category]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// hostFailureExitCode picks the exit code for a run in which at least one
+// host failed: failures that all map to one code return it, a mix of
+// successes and failures is partial, anything else is a host failure.
+func hostFailureExitCode(hosts []string, hostRecaps map[string]hostRunRecap) int {
+	anySucceeded := false
+	for _, host := range hosts {
+		if hostRecaps[host].failed == 0 {
+			anySucceeded = true
+			break
+		}
+	}
+	exitCodes := map[int]bool{}
+	for category := range hostFailureCategoryCounts(hosts, hostRecaps) {
+		exitCodes[category.exitCode()] = true
+	}
+
+	switch {
+	case len(exitCodes) == 0:
+		return exitOK
+	case anySucceeded:
+		return exitPartialFailure
+	case len(exitCodes) > 1:
+		return exitHostFailure
+	}
+	for code := range exitCodes {
+		return code
+	}
+	return exitHostFailure
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestClassifyHostError(t *testing.T) {
+	testCases := map[hostErrorCategory]error{
+		hostErrorHostKey:        fmt.Errorf("ssh dial: ssh: handshake failed: %w", &knownhosts.KeyError{Want: []knownhosts.KnownKey{{}}}),
+		hostErrorAuth:           errors.New("ssh dial: ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]"),
+		hostErrorConnect:        fmt.Errorf("ssh dial: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+		hostErrorDNS:            fmt.Errorf("ssh dial: %w", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "app01"}}),
+		hostErrorConnectTimeout: fmt.Errorf("ssh dial: %w", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}),
+		hostErrorSession:        &sessionError{op: "create session", err: errors.New("ssh: rejected: administratively prohibited")},
+		hostErrorRemoteScript:   errors.New("Process exited with status 1: permission denied"),
+		hostErrorStopped:        errRunStopped,
+	}
+	for want, err := range testCases {
+		if got := classifyHostError(err); got != want {
+			t.Fatalf("classifyHostError(%v) = %q, want %q", err, got, want)
+		}
+	}
+	if got := classifyHostError(fmt.Errorf("ssh dial: %w", &hostKeyRejectedError{hostname: "a"})); got != hostErrorHostKey {
+		t.Fatalf("rejected host key classified as %q", got)
+	}
+
+	opensshCases := map[string]hostErrorCategory{
+		"ssh: Could not resolve hostname app01: Name or service not known": hostErrorDNS,
+		"ssh: connect to host app01 port 22: Connection timed out":         hostErrorConnectTimeout,
+		"ssh: deploy@app01: Permission denied (publickey,password).":       hostErrorAuth,
+		"ssh: Host key verification failed.":                               hostErrorHostKey,
+		"Process exited with status 1: sudo: a password is required":       hostErrorRemoteScript,
+	}
+	for message, want := range opensshCases {
+		if got := classifyHostError(errors.New(message)); got != want {
+			t.Fatalf("classifyHostError(%q) = %q, want %q", message, got, want)
+		}
+	}
+}
+
+func TestPlayRecapShowsFailureCategories(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	hosts := []string{"a", "b", "c", "d"}
+	outputAnsiblePlayRecap(hosts, map[string]hostRunRecap{
+		"a": {ok: 1},
+		"b": {failed: 1, lastErr: errors.New("ssh: unable to authenticate")},
+		"c": {failed: 1, lastErr: errors.New("ssh: unable to authenticate")},
+		"d": {failed: 1, lastErr: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}},
+	})
+
+	output := outputBuffer.String()
+	categories := output[strings.Index(output, "FAILURE CATEGORIES"):]
+	if !strings.Contains(categories, "dns                      : 1 host(s)") || !strings.Contains(categories, "auth                     : 2 host(s)") {
+		t.Fatalf("recap missing category breakdown: %q", output)
+	}
+	if strings.Index(categories, "dns") > strings.Index(categories, "auth") {
+		t.Fatalf("categories not in recap order: %q", categories)
+	}
+	if got := describeHostFailureCategories(hostFailureCategoryCounts(hosts, map[string]hostRunRecap{"b": {failed: 1, lastErr: errors.New("x")}})); got != "remote-script: 1" {
+		t.Fatalf("describeHostFailureCategories() = %q", got)
+	}
+}
+
+func TestHostFailureExitCode(t *testing.T) {
+	authErr := errors.New("ssh: unable to authenticate")
+	networkErr := &net.OpError{Op: "dial", Err: errors.New("timeout")}
+	hosts := []string{"a", "b"}
+
+	testCases := []struct {
+		name   string
+		recaps map[string]hostRunRecap
+		want   int
+	}{
+		{"all ok", map[string]hostRunRecap{"a": {ok: 1}, "b": {ok: 1}}, exitOK},
+		{"all auth", map[string]hostRunRecap{"a": {failed: 1, lastErr: authErr}, "b": {failed: 1, lastErr: authErr}}, exitAuthFailure},
+		{"all network", map[string]hostRunRecap{"a": {failed: 1, lastErr: networkErr}, "b": {failed: 1, lastErr: networkErr}}, exitNetworkFailure},
+		{"mixed causes", map[string]hostRunRecap{"a": {failed: 1, lastErr: authErr}, "b": {failed: 1, lastErr: networkErr}}, exitHostFailure},
+		{"dns and timeout are both network", map[string]hostRunRecap{"a": {failed: 1, lastErr: &net.DNSError{Err: "no such host"}}, "b": {failed: 1, lastErr: networkErr}}, exitNetworkFailure},
+		{"partial", map[string]hostRunRecap{"a": {ok: 1}, "b": {failed: 1, lastErr: authErr}}, exitPartialFailure},
+	}
+	for _, testCase := range testCases {
+		if got := hostFailureExitCode(hosts, testCase.recaps); got != testCase.want {
+			t.Fatalf("%s: hostFailureExitCode() = %d, want %d", testCase.name, got, testCase.want)
+		}
+	}
+}
+
+func TestRunExplainExit(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--explain-exit", "4"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(--explain-exit 4) error = %v", err)
+	}
+	if !strings.HasPrefix(outputBuffer.String(), "4 network-failure: ") {
+		t.Fatalf("explain output = %q", outputBuffer.String())
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--explain-exit", "42"})
+	var statusErr *statusError
+	if err := run(capturedRuntimeIO()); !errors.As(err, &statusErr) || statusErr.code != exitConfigError {
+		t.Fatalf("run(--explain-exit 42) error = %v, want config error", err)
+	}
+}
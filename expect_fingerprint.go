@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// expectedFingerprints holds the host keys CI may trust on first contact
+// without a prompt (--expect-fingerprint host=SHA256:...), keyed by the
+// known_hosts form of the host so "app01" and "app01:22" are the same entry.
+type expectedFingerprints map[string][]string
+
+// parseExpectedFingerprints parses host=SHA256:<base64> values. A host may be
+// given more than once to accept any of several keys.
+func parseExpectedFingerprints(values []string) (expectedFingerprints, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	expected := expectedFingerprints{}
+	for _, value := range values {
+		host, fingerprint, ok := strings.Cut(strings.TrimSpace(value), "=")
+		host = strings.TrimSpace(host)
+		fingerprint = strings.TrimSpace(fingerprint)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid --expect-fingerprint %q: want host=SHA256:<fingerprint>", value)
+		}
+		encodedHash, isSHA256 := strings.CutPrefix(fingerprint, "SHA256:")
+		if decodedHash, err := base64.RawStdEncoding.DecodeString(encodedHash); !isSHA256 || err != nil || len(decodedHash) != 32 {
+			return nil, fmt.Errorf("invalid --expect-fingerprint %q: fingerprint must be SHA256:<base64> as printed by ssh-keygen -lf", value)
+		}
+		normalizedHost := knownhosts.Normalize(host)
+		if !slices.Contains(expected[normalizedHost], fingerprint) {
+			expected[normalizedHost] = append(expected[normalizedHost], fingerprint)
+		}
+	}
+	return expected, nil
+}
+
+// unexpectedHostKeyError is returned when an unknown host cannot be trusted
+// through --expect-fingerprint: its key differs from the expected one, or it
+// has no expectation and there is no terminal to ask on.
+type unexpectedHostKeyError struct {
+	hostname string
+	got      string
+	want     []string
+}
+
+func (unexpectedErr *unexpectedHostKeyError) Error() string {
+	if len(unexpectedErr.want) == 0 {
+		return fmt.Sprintf("host key for %s (%s) is unknown and no --expect-fingerprint was given for it", unexpectedErr.hostname, unexpectedErr.got)
+	}
+	return fmt.Sprintf("host key for %s is %s, --expect-fingerprint wants %s", unexpectedErr.hostname, unexpectedErr.got, strings.Join(unexpectedErr.want, " or "))
+}
+
+// trustsUnknownHost reports whether key is an expected key for hostname. It
+// returns an error when the host has expectations the key does not meet.
+func (expected expectedFingerprints) trustsUnknownHost(hostname string, key ssh.PublicKey) (bool, error) {
+	fingerprints, ok := expected[knownhosts.Normalize(hostname)]
+	if !ok {
+		return false, nil
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+	if slices.Contains(fingerprints, fingerprint) {
+		return true, nil
+	}
+	return false, &unexpectedHostKeyError{hostname: hostname, got: fingerprint, want: fingerprints}
+}
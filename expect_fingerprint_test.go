@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseExpectedFingerprints(t *testing.T) {
+	hostKey := newTestHostKey(t, "ed25519")
+	fingerprint := ssh.FingerprintSHA256(hostKey)
+	expected, err := parseExpectedFingerprints([]string{"app01=" + fingerprint, "app01:22=" + fingerprint, "[db01]:2222=" + fingerprint, "db01:2222=" + fingerprint})
+	if err != nil {
+		t.Fatalf("parseExpectedFingerprints() error = %v", err)
+	}
+	if len(expected) != 2 || len(expected["app01"]) != 1 || len(expected["[db01]:2222"]) != 1 {
+		t.Fatalf("expected = %v", expected)
+	}
+
+	for _, value := range []string{"app01", "=" + fingerprint, "app01=MD5:aa:bb", "app01=SHA256:short"} {
+		if _, err := parseExpectedFingerprints([]string{value}); err == nil {
+			t.Fatalf("parseExpectedFingerprints(%q) error = nil", value)
+		}
+	}
+}
+
+func TestBuildHostKeyCallbackTrustsExpectedFingerprintWithoutPrompt(t *testing.T) {
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	hostKey := newTestHostKey(t, "ed25519")
+	otherKey := newTestHostKey(t, "ed25519")
+	stubPrompter(t, &scriptedPrompter{})
+	originalPrompter := confirmUnknownHost
+	confirmUnknownHost = func(string, string, ssh.PublicKey) (bool, error) {
+		t.Fatalf("expected hosts must not be prompted for")
+		return false, nil
+	}
+	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
+
+	expected, err := parseExpectedFingerprints([]string{"app01=" + ssh.FingerprintSHA256(hostKey)})
+	if err != nil {
+		t.Fatalf("parseExpectedFingerprints() error = %v", err)
+	}
+	hostKeyCallback, err := buildHostKeyCallback(false, knownHostsPath, "", "", expected)
+	if err != nil {
+		t.Fatalf("buildHostKeyCallback() error = %v", err)
+	}
+	remoteAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	if err := hostKeyCallback("app01:22", remoteAddress, hostKey); err != nil {
+		t.Fatalf("expected key error = %v", err)
+	}
+	knownHostsContent, err := os.ReadFile(knownHostsPath)
+	if err != nil || !strings.Contains(string(knownHostsContent), "app01 ") {
+		t.Fatalf("known_hosts = %q, %v; want the trusted key stored", knownHostsContent, err)
+	}
+
+	var unexpectedErr *unexpectedHostKeyError
+	err = hostKeyCallback("app02:22", remoteAddress, hostKey)
+	if !errors.As(err, &unexpectedErr) || !strings.Contains(err.Error(), "no --expect-fingerprint") {
+		t.Fatalf("unlisted host error = %v, want refusal without a terminal", err)
+	}
+	if classifyHostError(err) != hostErrorHostKey {
+		t.Fatalf("classifyHostError() = %v, want host-key", classifyHostError(err))
+	}
+
+	mismatchCallback, err := buildHostKeyCallback(false, filepath.Join(t.TempDir(), "known_hosts"), "", "", expected)
+	if err != nil {
+		t.Fatalf("buildHostKeyCallback() error = %v", err)
+	}
+	err = mismatchCallback("app01:22", remoteAddress, otherKey)
+	if !errors.As(err, &unexpectedErr) || !strings.Contains(err.Error(), "--expect-fingerprint wants "+ssh.FingerprintSHA256(hostKey)) {
+		t.Fatalf("mismatched key error = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// writeFailedHostsFile writes the hosts that failed in servers-file format so
+// a follow-up run can retry them with --servers-file. Comments the servers
+// file gave a host (hostNotes) are written with it, so context such as the
+// rack, owner or #group carries over to the retry. The file is rewritten on every
+// run, so an empty list means nothing failed.
+func writeFailedHostsFile(path, runID string, hosts []string, hostRecaps map[string]hostRunRecap, hostNotes map[string]serverEntryNotes) (int, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return 0, fmt.Errorf("resolve failed hosts path: %w", err)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("# Hosts that failed")
+	if runID != "" {
+		builder.WriteString(" in run " + runID)
+	}
+	// The blank line keeps the header from becoming the first host's section.
+	builder.WriteString("; retry with --servers-file " + path + "\n\n")
+	failedCount := 0
+	var previousSection []string
+	previousGroup := ""
+	for _, host := range hosts {
+		if hostRecaps[host].failed == 0 {
+			continue
+		}
+		failedCount++
+		notes := hostNotes[host]
+		groupChanged := notes.group != previousGroup
+		if groupChanged || !slices.Equal(notes.section, previousSection) {
+			if failedCount > 1 {
+				builder.WriteString("\n")
+			}
+			if groupChanged {
+				builder.WriteString(strings.TrimSpace(serversFileGroup+" "+notes.group) + "\n")
+				previousGroup = notes.group
+			}
+			for _, commentLine := range notes.section {
+				builder.WriteString(commentLine + "\n")
+			}
+			previousSection = notes.section
+		}
+		builder.WriteString(host)
+		if notes.inline != "" {
+			builder.WriteString("  " + notes.inline)
+		}
+		builder.WriteString("\n")
+	}
+
+	if err := os.WriteFile(expandedPath, []byte(builder.String()), 0o600); err != nil {
+		return 0, fmt.Errorf("write failed hosts file: %w", err)
+	}
+	return failedCount, nil
+}
+
+// reportFailedHosts runs writeFailedHostsFile as its own task when
+// --failed-hosts-out is set. A write error is reported but does not change
+// the outcome of the run.
+func reportFailedHosts(programOptions *options, runID string, hosts []string, hostRecaps map[string]hostRunRecap, hostNotes map[string]serverEntryNotes) {
+	if strings.TrimSpace(programOptions.FailedHostsOut) == "" {
+		return
+	}
+	outputAnsibleTask("Write failed hosts")
+	failedCount, err := writeFailedHostsFile(programOptions.FailedHostsOut, runID, hosts, hostRecaps, hostNotes)
+	if err != nil {
+		outputAnsibleHostStatus("failed", "localhost", err.Error())
+		return
+	}
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) written to %s", failedCount, programOptions.FailedHostsOut))
+}
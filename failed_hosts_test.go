@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestWriteFailedHostsFileRoundTripsThroughServersFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.txt")
+	hosts := []string{"app01:22", "app02:2222", "app03:22"}
+	hostRecaps := map[string]hostRunRecap{
+		"app01:22":   {ok: 1},
+		"app02:2222": {failed: 1, lastErr: errors.New("boom")},
+		"app03:22":   {ok: 1, failed: 1},
+	}
+
+	count, err := writeFailedHostsFile(path, "run-1", hosts, hostRecaps, nil)
+	if err != nil || count != 2 {
+		t.Fatalf("writeFailedHostsFile() = %d, %v; want 2 hosts", count, err)
+	}
+	entries, err := readServersFile(path, nil)
+	if err != nil {
+		t.Fatalf("readServersFile() error = %v", err)
+	}
+	if !slices.Equal(entries, []string{"app02:2222", "app03:22"}) {
+		t.Fatalf("failed hosts = %q", entries)
+	}
+	content, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(content), "# Hosts that failed in run run-1;") {
+		t.Fatalf("missing header: %q", content)
+	}
+}
+
+func TestRunWritesFailedHostsOut(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dir := t.TempDir()
+	dotEnvPath := filepath.Join(dir, ".env")
+	failedPath := filepath.Join(dir, "failed.txt")
+	dotEnvContent := "SERVERS=ok-host,bad-host\nUSER=deploy\nPASSWORD=password\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		if address == "bad-host:22" {
+			return nil, errors.New("connection refused")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			return "", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--failed-hosts-out", failedPath})
+	if err := run(capturedRuntimeIO()); err == nil {
+		t.Fatalf("expected run() error for the failed host")
+	}
+
+	entries, err := readServersFile(failedPath, nil)
+	if err != nil {
+		t.Fatalf("readServersFile() error = %v", err)
+	}
+	if !slices.Equal(entries, []string{"bad-host:22"}) {
+		t.Fatalf("failed hosts = %q", entries)
+	}
+	if !strings.Contains(outputBuffer.String(), "1 host(s) written to "+failedPath) {
+		t.Fatalf("output missing failed hosts task: %q", outputBuffer.String())
+	}
+}
+
+func TestWriteFailedHostsFileKeepsServersFileComments(t *testing.T) {
+	directory := t.TempDir()
+	serversPath := filepath.Join(directory, "servers.txt")
+	serversContent := "# inventory for the payments fleet\n\n# rack A12\n# owner: payments\napp01\napp02  # spare PSU\n# rack A13\napp03\n\napp04\n"
+	if err := os.WriteFile(serversPath, []byte(serversContent), 0o600); err != nil {
+		t.Fatalf("write servers file: %v", err)
+	}
+	entries, notes, err := readServersFileWithNotes(serversPath, nil)
+	if err != nil {
+		t.Fatalf("readServersFileWithNotes() error = %v", err)
+	}
+	if !slices.Equal(entries, []string{"app01", "app02", "app03", "app04"}) {
+		t.Fatalf("entries = %q", entries)
+	}
+
+	hosts := []string{"app01:22", "app02:22", "app03:22", "app04:22"}
+	hostRecaps := map[string]hostRunRecap{
+		"app01:22": {ok: 1},
+		"app02:22": {failed: 1},
+		"app03:22": {failed: 1},
+		"app04:22": {failed: 1},
+	}
+	failedPath := filepath.Join(directory, "failed.txt")
+	if _, err := writeFailedHostsFile(failedPath, "run-1", hosts, hostRecaps, serverNotesByHost(notes, 22)); err != nil {
+		t.Fatalf("writeFailedHostsFile() error = %v", err)
+	}
+	content, _ := os.ReadFile(failedPath)
+	want := "# Hosts that failed in run run-1; retry with --servers-file " + failedPath + "\n\n" +
+		"# rack A12\n# owner: payments\napp02:22  # spare PSU\n\n# rack A13\napp03:22\n\napp04:22\n"
+	if string(content) != want {
+		t.Fatalf("failed hosts file = %q, want %q", content, want)
+	}
+
+	// A retry that fails again carries the same comments forward.
+	_, retryNotes, err := readServersFileWithNotes(failedPath, nil)
+	if err != nil {
+		t.Fatalf("read failed hosts file: %v", err)
+	}
+	if _, err := writeFailedHostsFile(failedPath, "run-1", hosts, hostRecaps, serverNotesByHost(retryNotes, 22)); err != nil {
+		t.Fatalf("rewrite failed hosts file: %v", err)
+	}
+	if rewritten, _ := os.ReadFile(failedPath); string(rewritten) != want {
+		t.Fatalf("rewritten file = %q, want %q", rewritten, want)
+	}
+}
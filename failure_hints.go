@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// failureHint maps a fragment of a common SSH or remote error to what the
+// operator can do about it. The first matching fragment wins, so more specific
+// fragments come first.
+type failureHint struct {
+	fragment string
+	hint     string
+}
+
+var failureHints = []failureHint{
+	{"no supported methods remain", "the server accepted none of the offered auth methods; compare AUTH_METHODS with the server's PasswordAuthentication/AuthenticationMethods and check that the user exists"},
+	{"unable to authenticate", "wrong password or key for this user; check USER and the password or secret reference, and whether the account is locked (faillock, pam_tally2)"},
+	{"knownhosts: key mismatch", "the host key differs from the one in known_hosts; confirm the new key with the host owner before removing the old entry with ssh-keygen -R"},
+	{"no common algorithm", "the server only offers algorithms this client does not accept; compare with ssh -vvv and update sshd on the host"},
+	{"connection reset by peer", "the server dropped the connection; sshd MaxStartups, fail2ban/sshguard or a firewall rate limit are common causes; retry with --rate or --delay"},
+	{"handshake failed: eof", "the server closed the connection before login; check hosts.deny/tcp wrappers, MaxStartups, and that the port runs sshd"},
+	{"connection refused", "nothing accepts connections on that port; check the port and that sshd is running"},
+	{"no route to host", "the host is unreachable; check the address, routing and any firewall in between"},
+	{"i/o timeout", "no answer from the host; check the address and firewall, or raise TIMEOUT for slow links"},
+	{"connection timed out", "no answer from the host; check the address and firewall, or raise TIMEOUT for slow links"},
+	{"no such host", "the name does not resolve; check the spelling and your DNS search domain"},
+	{"is not in the sudoers file", "the user may not use sudo on this host; add it to sudoers or run the operation as a user that can"},
+	{"a password is required", "sudo needs a password it did not get; set the SSH password, or allow NOPASSWD for this user"},
+	{"read-only file system", "the home directory is on a read-only file system; the key cannot be written there"},
+	{"permission denied (", "ssh refused the login (OpenSSH lists the methods it tried); check USER, the password or key, and the server's allowed auth methods"},
+	{"permission denied", "the user cannot write its ~/.ssh; check the ownership and modes of the home directory and ~/.ssh"},
+}
+
+// failureHintFor returns the hint for err, or "" when none applies.
+func failureHintFor(err error) string {
+	if err == nil {
+		return ""
+	}
+	message := strings.ToLower(err.Error())
+	for _, entry := range failureHints {
+		if strings.Contains(message, entry.fragment) {
+			return entry.hint
+		}
+	}
+	return ""
+}
+
+// outputFailureHint prints the hint for err under a failed host line.
+func outputFailureHint(err error) {
+	if hint := failureHintFor(err); hint != "" {
+		outputPrintf("  hint: %s\n", hint)
+	}
+}
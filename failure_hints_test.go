@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFailureHintForCommonErrors(t *testing.T) {
+	for message, want := range map[string]string{
+		"ssh dial: ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain": "none of the offered auth methods",
+		"ssh dial: ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey]":                             "wrong password or key",
+		"ssh dial: read tcp 10.0.0.5:50022->10.0.0.9:22: read: connection reset by peer":                                               "MaxStartups",
+		"ssh dial: dial tcp 10.0.0.9:22: connect: Connection refused":                                                                  "nothing accepts connections",
+		"ssh: deploy@app01: Permission denied (publickey,password).":                                                                   "ssh refused the login",
+		"Process exited with status 1: mkdir: cannot create directory '/home/deploy/.ssh': Permission denied":                          "ownership and modes",
+	} {
+		if hint := failureHintFor(errors.New(message)); !strings.Contains(hint, want) {
+			t.Fatalf("failureHintFor(%q) = %q, want it to mention %q", message, hint, want)
+		}
+	}
+	if hint := failureHintFor(errors.New("Process exited with status 3")); hint != "" {
+		t.Fatalf("failureHintFor(unknown) = %q, want none", hint)
+	}
+}
+
+func TestOutputFailureHintPrintsUnderFailureLine(t *testing.T) {
+	stdout, _ := captureWriters(t)
+	outputAnsibleHostStatus("failed", "app01:22", "ssh dial: dial tcp: lookup app01: no such host")
+	outputFailureHint(errors.New("ssh dial: dial tcp: lookup app01: no such host"))
+	outputFailureHint(errors.New("Process exited with status 3"))
+	want := "failed: [app01:22] => ssh dial: dial tcp: lookup app01: no such host\n  hint: the name does not resolve; check the spelling and your DNS search domain\n"
+	if stdout.String() != want {
+		t.Fatalf("output = %q, want %q", stdout.String(), want)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var loginUserPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// parseFallbackUsers parses --fallback-users, e.g. "ubuntu,ec2-user,debian".
+func parseFallbackUsers(value string) ([]string, error) {
+	var users []string
+	for _, user := range splitServerEntries(value) {
+		if !loginUserPattern.MatchString(user) {
+			return nil, fmt.Errorf("invalid --fallback-users entry %q", user)
+		}
+		if !slices.Contains(users, user) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// fallbackUserExecutor retries a login the server refused for the configured
+// user with each --fallback-users entry, for images that disable root login
+// and ship a default user such as ubuntu or ec2-user. Once a user logs in,
+// every operation on that host runs as that user.
+type fallbackUserExecutor struct {
+	remoteExecutor
+	fallbackUsers []string
+	// loginUsers holds the user that logged in to each host.
+	loginUsers map[string]string
+}
+
+func newFallbackUserExecutor(executor remoteExecutor, fallbackUsers []string) *fallbackUserExecutor {
+	return &fallbackUserExecutor{remoteExecutor: executor, fallbackUsers: fallbackUsers, loginUsers: map[string]string{}}
+}
+
+func (executor *fallbackUserExecutor) connect(hostAddress, userName string, clientConfig *ssh.ClientConfig) error {
+	_, err := executor.login(hostAddress, userName, clientConfig)
+	return err
+}
+
+func (executor *fallbackUserExecutor) runOperation(hostAddress string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig) (remoteOperationResult, error) {
+	loginUser, err := executor.login(hostAddress, input.User, clientConfig)
+	if err != nil {
+		return remoteOperationResult{}, err
+	}
+	input.User = loginUser
+	return executor.remoteExecutor.runOperation(hostAddress, operation, input, clientConfigForUser(clientConfig, loginUser))
+}
+
+// login connects as userName and, when the server refuses that login, as
+// each fallback user in turn. It returns the user that logged in.
+func (executor *fallbackUserExecutor) login(hostAddress, userName string, clientConfig *ssh.ClientConfig) (string, error) {
+	if loginUser, ok := executor.loginUsers[hostAddress]; ok {
+		return loginUser, nil
+	}
+	err := executor.remoteExecutor.connect(hostAddress, userName, clientConfig)
+	if err == nil {
+		executor.loginUsers[hostAddress] = userName
+		return userName, nil
+	}
+	if classifyHostError(err) != hostErrorAuth {
+		return "", err
+	}
+	if !serverOfferedAuthMethods(err) {
+		return "", fmt.Errorf("%w (server offers none of the configured auth methods; --fallback-users not tried)", err)
+	}
+
+	var triedUsers []string
+	for _, fallbackUser := range executor.fallbackUsers {
+		if fallbackUser == userName {
+			continue
+		}
+		triedUsers = append(triedUsers, fallbackUser)
+		fallbackErr := executor.remoteExecutor.connect(hostAddress, fallbackUser, clientConfigForUser(clientConfig, fallbackUser))
+		if fallbackErr == nil {
+			outputPrintf("[WARNING]: %s refused login as %s; logged in as %s instead\n", hostAddress, userName, fallbackUser)
+			emitEvent(runEvent{Event: "fallback_user", Host: hostAddress, Message: fallbackUser})
+			executor.loginUsers[hostAddress] = fallbackUser
+			return fallbackUser, nil
+		}
+		if classifyHostError(fallbackErr) != hostErrorAuth {
+			return "", fallbackErr
+		}
+	}
+	if len(triedUsers) == 0 {
+		return "", err
+	}
+	return "", fmt.Errorf("%w (also refused: %s)", err, strings.Join(triedUsers, ", "))
+}
+
+// checkNoFallbackUsers refuses --fallback-users for subcommands that manage
+// the authorized_keys of the users they name: a fallback login would read or
+// change another user's keys.
+func checkNoFallbackUsers(programOptions *options, command string) error {
+	if strings.TrimSpace(programOptions.FallbackUsers) != "" {
+		return fmt.Errorf("--fallback-users is not supported by %s, which manages the keys of the users it names", command)
+	}
+	return nil
+}
+
+// loginUser returns the user operations on hostAddress ran as: a fallback
+// user that logged in instead of configuredUser, or configuredUser.
+func loginUser(executor remoteExecutor, hostAddress, configuredUser string) string {
+	if fallbackExecutor, ok := executor.(*fallbackUserExecutor); ok {
+		if userName, ok := fallbackExecutor.loginUsers[hostAddress]; ok {
+			return userName
+		}
+	}
+	return configuredUser
+}
+
+func clientConfigForUser(clientConfig *ssh.ClientConfig, userName string) *ssh.ClientConfig {
+	if clientConfig == nil {
+		return nil
+	}
+	userConfig := *clientConfig
+	userConfig.User = userName
+	return &userConfig
+}
+
+// serverOfferedAuthMethods reports whether a refused login got as far as
+// trying a configured method. The built-in client lists the methods it
+// attempted; when that is only "none", the server allows none of the
+// configured methods for anyone and other users would fail the same way.
+func serverOfferedAuthMethods(err error) bool {
+	_, attempted, found := strings.Cut(err.Error(), "attempted methods [")
+	if !found {
+		return true
+	}
+	attempted, _, _ = strings.Cut(attempted, "]")
+	for _, method := range strings.Fields(attempted) {
+		if method != "none" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseFallbackUsers(t *testing.T) {
+	users, err := parseFallbackUsers(" ubuntu, ec2-user,,ubuntu,debian ")
+	if err != nil || !slices.Equal(users, []string{"ubuntu", "ec2-user", "debian"}) {
+		t.Fatalf("parseFallbackUsers() = %q, %v", users, err)
+	}
+	if _, err := parseFallbackUsers("ubuntu,bad user"); err == nil {
+		t.Fatalf("expected invalid user error")
+	}
+}
+
+func TestRunFallsBackToAnotherUserWhenRootIsRefused(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dir := t.TempDir()
+	dotEnvPath := filepath.Join(dir, ".env")
+	ledgerPath := filepath.Join(dir, "ledger.json")
+	dotEnvContent := "SERVERS=app01\nUSER=root\nPASSWORD=password\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	var attemptedUsers, scriptUsers []string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		attemptedUsers = append(attemptedUsers, config.User)
+		if config.User != "ubuntu" {
+			return nil, errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password], no supported methods remain")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			scriptUsers = append(scriptUsers, config.User)
+			return "", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--fallback-users", "ec2-user,ubuntu", "--ledger", ledgerPath})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run() error = %v\n%s", err, outputBuffer.String())
+	}
+	if !slices.Equal(attemptedUsers, []string{"root", "ec2-user", "ubuntu"}) {
+		t.Fatalf("attempted users = %q", attemptedUsers)
+	}
+	if len(scriptUsers) == 0 || !strings.Contains(outputBuffer.String(), "app01:22 refused login as root; logged in as ubuntu instead") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil || len(ledger.Entries) != 1 || ledger.Entries[0].User != "ubuntu" {
+		t.Fatalf("ledger = %+v, %v; want the key recorded for ubuntu", ledger, err)
+	}
+}
+
+func TestFallbackUserExecutorOnlyRetriesRefusedLogins(t *testing.T) {
+	for name, test := range map[string]struct {
+		err       error
+		wantCalls int
+		wantText  string
+	}{
+		"connection error": {errors.New("ssh dial: dial tcp: connect: connection refused"), 1, "connection refused"},
+		"method not offered": {
+			errors.New("ssh: unable to authenticate, attempted methods [none], no supported methods remain"), 1,
+			"server offers none of the configured auth methods",
+		},
+		"every user refused": {
+			errors.New("ssh: unable to authenticate, attempted methods [none password], no supported methods remain"), 3,
+			"also refused: ubuntu, ec2-user",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			captureWriters(t)
+			calls := 0
+			stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+				calls++
+				return nil, test.err
+			})
+
+			executor := newFallbackUserExecutor(newHostConnections(), []string{"ubuntu", "ec2-user"})
+			err := executor.connect("app01:22", "root", &ssh.ClientConfig{User: "root"})
+			if err == nil || !strings.Contains(err.Error(), test.wantText) || calls != test.wantCalls {
+				t.Fatalf("connect() error = %v after %d dial(s), want %q after %d", err, calls, test.wantText, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestKeySubcommandsRefuseFallbackUsers(t *testing.T) {
+	stubLedgerNow(t, time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+	key := strings.TrimSpace(generateTestKey(t))
+	manifestPath := writeTestManifest(t, `{
+  "groups": {"web": ["web1"]},
+  "users": {"root": [{"key": "`+key+`", "groups": ["web"]}]}
+}`)
+	dir := t.TempDir()
+	ledgerPath := filepath.Join(dir, "ledger.json")
+	if err := saveLedger(ledgerPath, &installationLedger{Entries: []ledgerEntry{
+		{Host: "web1:22", User: "root", Fingerprint: "SHA256:expired", PublicKey: key, ExpiresAt: "2025-12-31"},
+	}}); err != nil {
+		t.Fatalf("seed ledger: %v", err)
+	}
+	dotEnvPath := filepath.Join(dir, ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("PASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	stubSSHDialHook(t, func(_, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("dialed %s despite --fallback-users", address)
+		return nil, nil
+	})
+
+	for _, args := range [][]string{
+		{"apply", manifestPath},
+		{"drift", manifestPath},
+		{"expire", "--ledger", ledgerPath},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			captureWriters(t)
+			setCommandLineForTest(t, append([]string{"ssh-key-bootstrap", args[0], "--env", dotEnvPath, "--fallback-users", "ubuntu"}, args[1:]...))
+			err := run(capturedRuntimeIO())
+
+			var statusErr *statusError
+			if !errors.As(err, &statusErr) || statusErr.code != 2 || !strings.Contains(err.Error(), "--fallback-users is not supported by "+args[0]) {
+				t.Fatalf("run(%s) error = %v, want --fallback-users refused with status 2", args[0], err)
+			}
+		})
+	}
+}
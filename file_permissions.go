@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+const (
+	// Files that may hold credentials must not be accessible to group/others.
+	secretFilePermissionMask fs.FileMode = 0o077
+	// Public files may be readable, but a writable one lets others swap the
+	// key or the trusted host keys.
+	publicFilePermissionMask fs.FileMode = 0o022
+)
+
+// permissionChecksSupported is false where POSIX mode bits carry no meaning.
+var permissionChecksSupported = runtime.GOOS != "windows"
+
+type permissionCheck struct {
+	kind string
+	path string
+	mask fs.FileMode
+}
+
+// checkFilePermissions warns about loaded config, key and known_hosts files
+// that group/others can access; with --strict-perms it fails instead.
+func checkFilePermissions(programOptions *options) error {
+	issues := findPermissionIssues(programOptions)
+	if len(issues) == 0 {
+		return nil
+	}
+	if programOptions.StrictPerms {
+		return fmt.Errorf("insecure file permissions (--strict-perms):\n  %s", strings.Join(issues, "\n  "))
+	}
+	for _, issue := range issues {
+		outputPrintf("[WARNING]: %s\n", issue)
+	}
+	return nil
+}
+
+func findPermissionIssues(programOptions *options) []string {
+	if !permissionChecksSupported {
+		return nil
+	}
+
+	checks := []permissionCheck{
+		{kind: "config file", path: programOptions.EnvFile, mask: secretFilePermissionMask},
+		{kind: "config file", path: programOptions.ConfigFile, mask: secretFilePermissionMask},
+		{kind: "identity file", path: programOptions.IdentityFile, mask: secretFilePermissionMask},
+	}
+	if _, err := parsePublicKeyFromRawInput(programOptions.KeyInput); err != nil && !isDirectoryKeyInput(programOptions.KeyInput) {
+		checks = append(checks, permissionCheck{kind: "public key file", path: programOptions.KeyInput, mask: publicFilePermissionMask})
+	}
+	for _, keyInput := range programOptions.KeyInputs {
+		if _, err := parsePublicKeyFromRawInput(keyInput); err != nil && !isDirectoryKeyInput(keyInput) {
+			checks = append(checks, permissionCheck{kind: "public key file", path: keyInput, mask: publicFilePermissionMask})
+		}
+	}
+	keyFiles := programOptions.KeyFiles
+	if strings.TrimSpace(programOptions.KeysDir) != "" {
+		// An unreadable directory is reported when the keys are reviewed.
+		if dirFiles, err := keysDirFiles(programOptions.KeysDir); err == nil {
+			keyFiles = append(slices.Clone(keyFiles), dirFiles...)
+		}
+	}
+	for _, keyFile := range keyFiles {
+		checks = append(checks, permissionCheck{kind: "public key file", path: keyFile, mask: publicFilePermissionMask})
+	}
+	if !programOptions.InsecureIgnoreHostKey {
+		checks = append(checks, permissionCheck{kind: "known_hosts file", path: programOptions.KnownHosts, mask: publicFilePermissionMask})
+		checks = append(checks, permissionCheck{kind: "known_hosts file", path: programOptions.KnownHostsOut, mask: publicFilePermissionMask})
+	}
+
+	var issues []string
+	for _, check := range checks {
+		if issue := checkFileMode(check); issue != "" {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func checkFileMode(check permissionCheck) string {
+	trimmedPath := strings.TrimSpace(check.path)
+	if trimmedPath == "" {
+		return ""
+	}
+	path, err := expandHomePath(trimmedPath)
+	if err != nil {
+		return ""
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("%s %s: %v", check.kind, path, err)
+		}
+		return ""
+	}
+	if fileInfo.IsDir() {
+		return ""
+	}
+
+	mode := fileInfo.Mode().Perm()
+	if mode&check.mask == 0 {
+		return ""
+	}
+	access := "writable"
+	if check.mask&0o044 != 0 && mode&0o044 != 0 {
+		access = "readable"
+	}
+	return fmt.Sprintf("%s %s is %s by group/others (mode %04o); run: chmod %04o %s", check.kind, path, access, mode, mode&^check.mask, path)
+}
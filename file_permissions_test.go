@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFileWithMode(t *testing.T, path, content string, mode os.FileMode) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("chmod %s: %v", path, err)
+	}
+}
+
+func TestFindPermissionIssues(t *testing.T) {
+	if !permissionChecksSupported {
+		t.Skip("file modes are not enforced on this platform")
+	}
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	keyPath := filepath.Join(dir, "id_ed25519.pub")
+	knownHostsPath := filepath.Join(dir, "known_hosts")
+	writeFileWithMode(t, envPath, "PASSWORD=x\n", 0o640)
+	writeFileWithMode(t, keyPath, generateTestKey(t), 0o644)
+	writeFileWithMode(t, knownHostsPath, "", 0o666)
+
+	issues := findPermissionIssues(&options{EnvFile: envPath, KeyInput: keyPath, KnownHosts: knownHostsPath})
+	if len(issues) != 2 {
+		t.Fatalf("findPermissionIssues() = %q, want .env and known_hosts", issues)
+	}
+	if !strings.Contains(issues[0], "config file "+envPath+" is readable") || !strings.Contains(issues[0], "chmod 0600") {
+		t.Fatalf("config issue = %q", issues[0])
+	}
+	if !strings.Contains(issues[1], "known_hosts file "+knownHostsPath+" is writable") || !strings.Contains(issues[1], "chmod 0644") {
+		t.Fatalf("known_hosts issue = %q", issues[1])
+	}
+
+	if issues := findPermissionIssues(&options{KnownHosts: knownHostsPath, InsecureIgnoreHostKey: true, KeyInput: generateTestKey(t)}); len(issues) != 0 {
+		t.Fatalf("findPermissionIssues() with inline key and insecure host keys = %q, want none", issues)
+	}
+}
+
+func TestCheckFilePermissionsWarnsOrFails(t *testing.T) {
+	if !permissionChecksSupported {
+		t.Skip("file modes are not enforced on this platform")
+	}
+	outputBuffer, _ := captureWriters(t)
+	envPath := filepath.Join(t.TempDir(), ".env")
+	writeFileWithMode(t, envPath, "PASSWORD=x\n", 0o604)
+
+	if err := checkFilePermissions(&options{EnvFile: envPath}); err != nil {
+		t.Fatalf("checkFilePermissions() error = %v", err)
+	}
+	if !strings.Contains(outputBuffer.String(), "[WARNING]: config file "+envPath) {
+		t.Fatalf("output missing warning: %q", outputBuffer.String())
+	}
+
+	err := checkFilePermissions(&options{EnvFile: envPath, StrictPerms: true})
+	if err == nil || !strings.Contains(err.Error(), "--strict-perms") {
+		t.Fatalf("checkFilePermissions(strict) error = %v", err)
+	}
+}
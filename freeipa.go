@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ipaKeyPrefix marks a key input that names a FreeIPA user, e.g.
+	// ipa:alice: the SSH public keys registered for the user are installed.
+	ipaKeyPrefix      = "ipa:"
+	ipaPasswordEnv    = "IPA_PASSWORD"
+	ipaErrorBodySize  = 512
+	ipaLoginPath      = "/ipa/session/login_password"
+	ipaJSONPath       = "/ipa/session/json"
+	ipaRefererPath    = "/ipa"
+	ipaPublicKeyField = "ipasshpubkey"
+)
+
+// ipaHTTPClient talks to the FreeIPA API; tests point it at a local server.
+var ipaHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+type ipaUserShowResponse struct {
+	Result *struct {
+		Result map[string]json.RawMessage `json:"result"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+		Name    string `json:"name"`
+	} `json:"error"`
+}
+
+// lookupIPAPublicKeys returns the SSH public keys registered for a FreeIPA
+// user, logging in to --ipa-url as --ipa-user. A user without keys is an
+// error.
+func lookupIPAPublicKeys(programOptions *options, userName string) ([]string, error) {
+	if userName == "" {
+		return nil, errors.New("ipa: key input needs a user name, e.g. ipa:alice")
+	}
+	if strings.TrimSpace(programOptions.IPAURL) == "" {
+		return nil, errors.New("ipa: key inputs need --ipa-url and --ipa-user")
+	}
+	baseURL, err := ipaBaseURL(programOptions.IPAURL)
+	if err != nil {
+		return nil, err
+	}
+	password, err := serviceCredential("FreeIPA", "password", programOptions.IPAPasswordRef, "--ipa-password-ref", ipaPasswordEnv)
+	if err != nil {
+		return nil, err
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *ipaHTTPClient
+	client.Jar = jar
+	if err := ipaLogin(&client, baseURL, strings.TrimSpace(programOptions.IPAUser), password); err != nil {
+		return nil, err
+	}
+
+	user, err := ipaUserShow(&client, baseURL, userName)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	if rawKeys, ok := user[ipaPublicKeyField]; ok {
+		if err := json.Unmarshal(rawKeys, &values); err != nil {
+			return nil, fmt.Errorf("parse SSH keys of FreeIPA user %s: %w", userName, err)
+		}
+	}
+	publicKeys, err := parseDirectoryPublicKeys(values)
+	if err != nil {
+		return nil, fmt.Errorf("SSH key of FreeIPA user %s: %w", userName, err)
+	}
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("FreeIPA user %s has no SSH public key", userName)
+	}
+	return publicKeys, nil
+}
+
+// ipaBaseURL is the server part of --ipa-url; a path such as /ipa/ui is
+// dropped, since the API lives at fixed paths.
+func ipaBaseURL(serverURL string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return "", fmt.Errorf("--ipa-url %q must be an http(s) URL such as https://ipa.example.com", serverURL)
+	}
+	return parsedURL.Scheme + "://" + parsedURL.Host, nil
+}
+
+// ipaLogin opens an API session; the session cookie lands in the client's jar.
+func ipaLogin(client *http.Client, baseURL, userName, password string) error {
+	form := url.Values{"user": {userName}, "password": {password}}
+	request, err := http.NewRequest(http.MethodPost, baseURL+ipaLoginPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("build FreeIPA login request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "text/plain")
+	request.Header.Set("Referer", baseURL+ipaRefererPath)
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("log in to FreeIPA: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, ipaErrorBodySize))
+		return fmt.Errorf("FreeIPA login as %s returned %s: %s", userName, response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func ipaUserShow(client *http.Client, baseURL, userName string) (map[string]json.RawMessage, error) {
+	requestBody, err := json.Marshal(map[string]any{
+		"method": "user_show",
+		"params": []any{[]string{userName}, map[string]any{}},
+		"id":     0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build FreeIPA request: %w", err)
+	}
+	request, err := http.NewRequest(http.MethodPost, baseURL+ipaJSONPath, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("build FreeIPA request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Referer", baseURL+ipaRefererPath)
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("query FreeIPA: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, ipaErrorBodySize))
+		return nil, fmt.Errorf("FreeIPA returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	var result ipaUserShowResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parse FreeIPA user: %w", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("FreeIPA user_show %s: %s", userName, result.Error.Message)
+	}
+	if result.Result == nil {
+		return nil, fmt.Errorf("FreeIPA user_show %s returned no result", userName)
+	}
+	return result.Result.Result, nil
+}
+
+// validateIPAOptions rejects --ipa-user and --ipa-password-ref without
+// --ipa-url, and --ipa-url without a user to log in as.
+func validateIPAOptions(programOptions *options) error {
+	if strings.TrimSpace(programOptions.IPAURL) == "" {
+		if strings.TrimSpace(programOptions.IPAUser) != "" || strings.TrimSpace(programOptions.IPAPasswordRef) != "" {
+			return errors.New("--ipa-user and --ipa-password-ref need --ipa-url")
+		}
+		return nil
+	}
+	if strings.TrimSpace(programOptions.IPAUser) == "" {
+		return errors.New("--ipa-url needs --ipa-user, the account that reads the keys")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookupIPAPublicKeysLogsInAndReadsUser(t *testing.T) {
+	userKey := strings.TrimSpace(generateTestKey(t)) + " alice@laptop"
+	t.Setenv(ipaPasswordEnv, "reader-password")
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Referer") == "" {
+			http.Error(writer, "missing Referer", http.StatusBadRequest)
+			return
+		}
+		switch request.URL.Path {
+		case ipaLoginPath:
+			if request.FormValue("user") != "svc-keys" || request.FormValue("password") != "reader-password" {
+				http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(writer, &http.Cookie{Name: "ipa_session", Value: "session-1", Path: "/ipa"})
+		case ipaJSONPath:
+			if cookie, err := request.Cookie("ipa_session"); err != nil || cookie.Value != "session-1" {
+				http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var call struct {
+				Method string `json:"method"`
+				Params []any  `json:"params"`
+			}
+			if err := json.NewDecoder(request.Body).Decode(&call); err != nil || call.Method != "user_show" {
+				http.Error(writer, "unexpected call", http.StatusBadRequest)
+				return
+			}
+			if userName := call.Params[0].([]any)[0]; userName != "alice" {
+				fmt.Fprintf(writer, `{"result": null, "error": {"code": 4001, "name": "NotFound", "message": "%s: user not found"}}`, userName)
+				return
+			}
+			fmt.Fprintf(writer, `{"error": null, "result": {"result": {"uid": ["alice"], "ipasshpubkey": [%q]}, "value": "alice"}}`, userKey)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	programOptions := &options{IPAURL: server.URL + "/ipa/ui/", IPAUser: "svc-keys"}
+	publicKeys, err := lookupIPAPublicKeys(programOptions, "alice")
+	if err != nil {
+		t.Fatalf("lookupIPAPublicKeys() error = %v", err)
+	}
+	if !slices.Equal(publicKeys, []string{userKey}) {
+		t.Fatalf("keys = %q, want %q", publicKeys, userKey)
+	}
+	if _, err := lookupIPAPublicKeys(programOptions, "bob"); err == nil || !strings.Contains(err.Error(), "bob: user not found") {
+		t.Fatalf("lookupIPAPublicKeys(bob) error = %v", err)
+	}
+	programOptions.IPAUser = "intruder"
+	if _, err := lookupIPAPublicKeys(programOptions, "alice"); err == nil || !strings.Contains(err.Error(), "login as intruder returned 401") {
+		t.Fatalf("lookupIPAPublicKeys() with a wrong login error = %v", err)
+	}
+}
+
+func TestValidateIPAOptions(t *testing.T) {
+	if err := validateIPAOptions(&options{IPAUser: "svc-keys"}); err == nil || !strings.Contains(err.Error(), "need --ipa-url") {
+		t.Fatalf("validateIPAOptions() without --ipa-url error = %v", err)
+	}
+	if err := validateIPAOptions(&options{IPAURL: "https://ipa.example.com"}); err == nil || !strings.Contains(err.Error(), "needs --ipa-user") {
+		t.Fatalf("validateIPAOptions() without --ipa-user error = %v", err)
+	}
+}
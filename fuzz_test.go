@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets cover the parsers that read user files and config values.
+// go test runs their seeds; make fuzz explores each for $(FUZZTIME).
+
+func FuzzNormalizeHost(f *testing.F) {
+	for _, seed := range []string{"app01", "app01:2222", "[2001:db8::1]", "[2001:db8::1]:2022", "10.0.0.1:ssh", "  ", "host:", ":22", "[app01"} {
+		f.Add(seed, 22)
+	}
+
+	f.Fuzz(func(t *testing.T, rawHost string, defaultPort int) {
+		if defaultPort < 1 || defaultPort > 65535 {
+			return
+		}
+		host, err := normalizeHost(rawHost, defaultPort)
+		if err != nil {
+			return
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			t.Fatalf("normalizeHost(%q) = %q, which is not host:port: %v", rawHost, host, err)
+		}
+		again, err := normalizeHost(host, defaultPort)
+		if err != nil || again != host {
+			t.Fatalf("normalizeHost(%q) = %q, %v; want it unchanged", host, again, err)
+		}
+	})
+}
+
+func FuzzExtractSingleKey(f *testing.F) {
+	for _, seed := range []string{
+		"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl ops@example\n",
+		"# deploy key\n\nssh-rsa AAAAB3NzaC1yc2E ops\r\n",
+		"ssh-ed25519 AAAA one\nssh-ed25519 AAAA two\n",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, rawKeyInput string) {
+		key, err := extractSingleKey(rawKeyInput)
+		if err != nil {
+			return
+		}
+		if key == "" || key != strings.TrimSpace(key) || strings.ContainsAny(key, "\r\n") || strings.HasPrefix(key, "#") {
+			t.Fatalf("extractSingleKey(%q) = %q", rawKeyInput, key)
+		}
+		if !strings.Contains(rawKeyInput, key) {
+			t.Fatalf("extractSingleKey(%q) = %q, which is not in the input", rawKeyInput, key)
+		}
+	})
+}
+
+func FuzzParseHostPasswordSecretRefs(f *testing.F) {
+	for _, seed := range []string{
+		"app01=bw://id-1,app02:2222=inf://db?env=prod",
+		"app01 = bw://a\napp01:22=bw://b",
+		"[2001:db8::1]=bw://v6",
+		"app01",
+		"=bw://x",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		secretRefsByHost, err := parseHostPasswordSecretRefs(value, 22)
+		if err != nil {
+			return
+		}
+		for host, secretRef := range secretRefsByHost {
+			if _, _, err := net.SplitHostPort(host); err != nil {
+				t.Fatalf("parseHostPasswordSecretRefs(%q) host %q is not host:port", value, host)
+			}
+			if secretRef == "" || secretRef != strings.TrimSpace(secretRef) {
+				t.Fatalf("parseHostPasswordSecretRefs(%q) ref for %s = %q", value, host, secretRef)
+			}
+		}
+	})
+}
+
+func FuzzParseSecretRefTemplate(f *testing.F) {
+	for _, seed := range []string{"infisical://hosts/{{.Host}}/root-password", "bw://{{.User}}@{{.Address}}", "{{.Nope}}", "{{", ""} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		refTemplate, err := parseSecretRefTemplate(value)
+		if err != nil || refTemplate == nil {
+			return
+		}
+		secretRef, err := renderSecretRef(refTemplate, "[2001:db8::1]:2022", "deploy")
+		if err == nil && (secretRef == "" || secretRef != strings.TrimSpace(secretRef)) {
+			t.Fatalf("renderSecretRef(%q) = %q", value, secretRef)
+		}
+	})
+}
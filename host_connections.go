@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// hostConnections keeps one SSH connection per host open for the whole run so
+// that every requested operation runs as a new session on the same connection
+// instead of reconnecting and re-authenticating for each task.
+type hostConnections struct {
+	clients map[string]*ssh.Client
+}
+
+func newHostConnections() *hostConnections {
+	return &hostConnections{clients: map[string]*ssh.Client{}}
+}
+
+// client returns the open connection to hostAddress, dialing it on first use.
+func (connections *hostConnections) client(hostAddress string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	if client, ok := connections.clients[hostAddress]; ok {
+		return client, nil
+	}
+	client, err := dialSSH("tcp", hostAddress, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("ssh dial: %w", err)
+	}
+	emitEvent(runEvent{Event: "connected", Host: hostAddress})
+	connections.clients[hostAddress] = client
+	return client, nil
+}
+
+// release closes the connection to hostAddress, if one is open.
+func (connections *hostConnections) release(hostAddress string) {
+	if client, ok := connections.clients[hostAddress]; ok {
+		_ = client.Close()
+		delete(connections.clients, hostAddress)
+	}
+}
+
+func (connections *hostConnections) closeAll() {
+	for hostAddress := range connections.clients {
+		connections.release(hostAddress)
+	}
+}
+
+func (connections *hostConnections) connect(hostAddress, _ string, clientConfig *ssh.ClientConfig) error {
+	_, err := connections.client(hostAddress, clientConfig)
+	return err
+}
+
+// runOperation runs operation's preflight, if any, and then its script in a
+// new session on the shared connection to hostAddress.
+func (connections *hostConnections) runOperation(hostAddress string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig) (remoteOperationResult, error) {
+	if preflight, ok := operation.(remoteOperationPreflight); ok {
+		if err := preflight.Preflight(hostAddress, input, clientConfig); err != nil {
+			return remoteOperationResult{}, err
+		}
+	}
+	client, err := connections.client(hostAddress, clientConfig)
+	if err != nil {
+		return remoteOperationResult{}, err
+	}
+	return runRemoteOperation(client, operation, input, nil)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestExecuteRemoteOperationsReusesOneConnectionPerHost(t *testing.T) {
+	_, _ = captureWriters(t)
+
+	var mu sync.Mutex
+	dials := map[string]int{}
+	var commands []string
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		mu.Lock()
+		dials[address]++
+		mu.Unlock()
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, _ string) (string, string, uint32) {
+			mu.Lock()
+			commands = append(commands, command)
+			mu.Unlock()
+			if command == withRemoteHome(removeAuthorizedKeyScript, false) {
+				return authorizedKeyRemovedMarker + "\n", "", 0
+			}
+			return authorizedKeyAddedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	hosts := []string{"app01:22", "app02:22"}
+	operations := []remoteOperation{installKeyOperation{}, removeKeyOperation{}}
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("password")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- in-memory test server
+	hostRecaps, failedHosts := executeRemoteOperations(newHostConnections(), hosts, operations,
+		func(string) *ssh.ClientConfig { return clientConfig },
+		func(host string) remoteOperationInput {
+			return remoteOperationInput{Host: host, User: "deploy", PublicKey: publicKey}
+		},
+	)
+
+	if len(failedHosts) != 0 {
+		t.Fatalf("failedHosts = %v, want none", failedHosts)
+	}
+	for _, host := range hosts {
+		if dials[host] != 1 {
+			t.Fatalf("dials[%s] = %d, want 1", host, dials[host])
+		}
+		if hostRecaps[host].ok != 2 {
+			t.Fatalf("recap[%s].ok = %d, want 2", host, hostRecaps[host].ok)
+		}
+	}
+	if len(commands) != 4 {
+		t.Fatalf("remote commands = %d, want one session per operation per host (4)", len(commands))
+	}
+}
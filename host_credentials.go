@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+
+	"golang.org/x/crypto/ssh"
+
+	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/providers"
+)
+
+// parseHostPasswordSecretRefs parses comma-separated host=secret-ref pairs
+// into a map keyed by normalized host:port.
+func parseHostPasswordSecretRefs(value string, defaultPort int) (map[string]string, error) {
+	secretRefsByHost := map[string]string{}
+	for _, entry := range splitServerEntries(value) {
+		rawHost, secretRef, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(rawHost) == "" || strings.TrimSpace(secretRef) == "" {
+			return nil, fmt.Errorf("invalid HOST_PASSWORD_SECRET_REFS entry %q: expected host=secret-ref", entry)
+		}
+		host, err := normalizeHost(strings.TrimSpace(rawHost), defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HOST_PASSWORD_SECRET_REFS host %q: %w", rawHost, err)
+		}
+		if _, exists := secretRefsByHost[host]; exists {
+			return nil, fmt.Errorf("duplicate HOST_PASSWORD_SECRET_REFS entry for %s", host)
+		}
+		secretRefsByHost[host] = strings.TrimSpace(secretRef)
+	}
+	return secretRefsByHost, nil
+}
+
+// secretRefTemplateData is what PASSWORD_SECRET_REF_TEMPLATE can refer to:
+// {{.Host}} (name without port), {{.Port}}, {{.Address}} (host:port) and
+// {{.User}} (the host's login user).
+type secretRefTemplateData struct {
+	Host    string
+	Port    string
+	Address string
+	User    string
+}
+
+// parseSecretRefTemplate parses PASSWORD_SECRET_REF_TEMPLATE and renders it
+// once against sample data, so a misspelled field fails before any lookup.
+func parseSecretRefTemplate(value string) (*template.Template, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	refTemplate, err := template.New("PASSWORD_SECRET_REF_TEMPLATE").Parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PASSWORD_SECRET_REF_TEMPLATE: %w", err)
+	}
+	if _, err := renderSecretRef(refTemplate, "app01:22", "deploy"); err != nil {
+		return nil, err
+	}
+	return refTemplate, nil
+}
+
+func renderSecretRef(refTemplate *template.Template, host, userName string) (string, error) {
+	hostName, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostName = host
+	}
+	var rendered strings.Builder
+	if err := refTemplate.Execute(&rendered, secretRefTemplateData{Host: hostName, Port: port, Address: host, User: userName}); err != nil {
+		return "", fmt.Errorf("invalid PASSWORD_SECRET_REF_TEMPLATE: %w", err)
+	}
+	secretRef := strings.TrimSpace(rendered.String())
+	if secretRef == "" {
+		return "", fmt.Errorf("PASSWORD_SECRET_REF_TEMPLATE renders an empty secret ref for %s", host)
+	}
+	return secretRef, nil
+}
+
+// resolveHostPasswords resolves the per-host password refs of the target hosts
+// before any SSH connection is made. Lookups run concurrently and identical
+// refs are fetched once, so large inventories do not serialize on slow
+// providers.
+func resolveHostPasswords(programOptions *options, hosts []string, hostSpecs map[string]appconfig.HostSpec) (map[string]string, error) {
+	secretRefsByHost, err := parseHostPasswordSecretRefs(programOptions.HostPasswordSecretRefs, programOptions.Port)
+	if err != nil {
+		return nil, err
+	}
+	for host, hostSpec := range hostSpecs {
+		secretRef := strings.TrimSpace(hostSpec.PasswordSecretRef)
+		if secretRef == "" {
+			continue
+		}
+		if _, exists := secretRefsByHost[host]; exists {
+			return nil, fmt.Errorf("%s has a password secret ref in both HOST_PASSWORD_SECRET_REFS and hosts", host)
+		}
+		secretRefsByHost[host] = secretRef
+	}
+
+	// Hosts without an explicit ref get one from the template.
+	refTemplate, err := parseSecretRefTemplate(programOptions.PasswordSecretRefTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if refTemplate != nil {
+		for _, host := range hosts {
+			if _, exists := secretRefsByHost[host]; exists {
+				continue
+			}
+			userName := programOptions.User
+			if hostUser := strings.TrimSpace(hostSpecs[host].User); hostUser != "" {
+				userName = hostUser
+			}
+			secretRef, err := renderSecretRef(refTemplate, host, userName)
+			if err != nil {
+				return nil, err
+			}
+			secretRefsByHost[host] = secretRef
+		}
+	}
+
+	targetRefs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if secretRef, ok := secretRefsByHost[host]; ok {
+			targetRefs = append(targetRefs, secretRef)
+		}
+	}
+	if len(targetRefs) == 0 {
+		return map[string]string{}, nil
+	}
+
+	providerName := strings.TrimSpace(programOptions.PasswordProvider)
+	resolvedByRef, err := providers.ResolveSecretReferences(targetRefs, providers.DefaultResolveWorkers, func(secretRef string) (string, error) {
+		if providerName != "" {
+			return resolvePasswordFromNamedProvider(providerName, secretRef)
+		}
+		return resolvePasswordFromSecretRef(secretRef)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resolve host password secret references: %w", err)
+	}
+
+	hostPasswords := make(map[string]string, len(targetRefs))
+	for _, host := range hosts {
+		if secretRef, ok := secretRefsByHost[host]; ok {
+			hostPasswords[host] = resolvedByRef[secretRef]
+		}
+	}
+	return hostPasswords, nil
+}
+
+func needsFallbackPassword(hosts []string, hostPasswords map[string]string) bool {
+	for _, host := range hosts {
+		if _, ok := hostPasswords[host]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSharedPasswordLimit enforces --require-per-host-credentials: no
+// password may be tried against more than limit hosts, so one wrong or
+// leaked credential cannot lock out or open the whole fleet. Hosts are
+// grouped by the password they will use, whatever its source, so two refs
+// that resolve to the same secret count as one shared password.
+func checkSharedPasswordLimit(programOptions *options, hosts []string, hostPasswords map[string]string) error {
+	limit := programOptions.MaxHostsPerPassword
+	if limit <= 0 || !usesPasswordLogin(programOptions) {
+		return nil
+	}
+	hostsByPassword := map[string]int{}
+	largestGroup := 0
+	for _, host := range hosts {
+		password, ok := hostPasswords[host]
+		if !ok {
+			password = programOptions.Password
+		}
+		if password == "" {
+			continue
+		}
+		hostsByPassword[password]++
+		largestGroup = max(largestGroup, hostsByPassword[password])
+	}
+	if largestGroup > limit {
+		return fmt.Errorf("%d hosts would share one password, more than --require-per-host-credentials %d allows; give hosts their own password with PASSWORD_SECRET_REF_TEMPLATE, HOST_PASSWORD_SECRET_REFS or hosts entries", largestGroup, limit)
+	}
+	return nil
+}
+
+func clientConfigForLogin(clientConfig *ssh.ClientConfig, authMethods []string, userName, password string) *ssh.ClientConfig {
+	hostConfig := *clientConfig
+	hostConfig.User = userName
+	hostConfig.Auth = loginAuthMethods(authMethods, password)
+	return &hostConfig
+}
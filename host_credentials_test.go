@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+func TestParseHostPasswordSecretRefs(t *testing.T) {
+	secretRefs, err := parseHostPasswordSecretRefs("app01=bw://app01, app02:2222 = inf://db?env=prod", 22)
+	if err != nil {
+		t.Fatalf("parseHostPasswordSecretRefs() error = %v", err)
+	}
+	if secretRefs["app01:22"] != "bw://app01" || secretRefs["app02:2222"] != "inf://db?env=prod" {
+		t.Fatalf("secret refs = %v", secretRefs)
+	}
+
+	for _, invalid := range []string{"app01", "app01=", "=bw://x", "app01=bw://a,app01:22=bw://b"} {
+		if _, err := parseHostPasswordSecretRefs(invalid, 22); err == nil {
+			t.Fatalf("parseHostPasswordSecretRefs(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestResolveHostPasswordsSharesLookupsAcrossHosts(t *testing.T) {
+	var lookupsMu sync.Mutex
+	lookups := map[string]int{}
+	originalResolve := resolvePasswordFromSecretRef
+	resolvePasswordFromSecretRef = func(secretRef string) (string, error) {
+		lookupsMu.Lock()
+		lookups[secretRef]++
+		lookupsMu.Unlock()
+		return "pw-" + strings.TrimPrefix(secretRef, "bw://"), nil
+	}
+	t.Cleanup(func() { resolvePasswordFromSecretRef = originalResolve })
+
+	programOptions := &options{
+		Port:                   22,
+		HostPasswordSecretRefs: "web1=bw://web,web2=bw://web,db1=bw://db,unused=bw://unused",
+	}
+	hosts := []string{"web1:22", "web2:22", "db1:22", "other:22"}
+	hostPasswords, err := resolveHostPasswords(programOptions, hosts, nil)
+	if err != nil {
+		t.Fatalf("resolveHostPasswords() error = %v", err)
+	}
+
+	if hostPasswords["web1:22"] != "pw-web" || hostPasswords["web2:22"] != "pw-web" || hostPasswords["db1:22"] != "pw-db" {
+		t.Fatalf("host passwords = %v", hostPasswords)
+	}
+	if _, ok := hostPasswords["other:22"]; ok {
+		t.Fatalf("host without a ref should fall back to the shared password")
+	}
+	if lookups["bw://web"] != 1 || lookups["bw://unused"] != 0 {
+		t.Fatalf("lookups = %v, want shared refs resolved once and non-target refs skipped", lookups)
+	}
+	if !needsFallbackPassword(hosts, hostPasswords) || needsFallbackPassword(hosts[:3], hostPasswords) {
+		t.Fatalf("needsFallbackPassword mismatch")
+	}
+}
+
+func TestResolveHostPasswordsFromSecretRefTemplate(t *testing.T) {
+	var lookupsMu sync.Mutex
+	var lookups []string
+	originalResolve := resolvePasswordFromSecretRef
+	resolvePasswordFromSecretRef = func(secretRef string) (string, error) {
+		lookupsMu.Lock()
+		lookups = append(lookups, secretRef)
+		lookupsMu.Unlock()
+		return "pw:" + secretRef, nil
+	}
+	t.Cleanup(func() { resolvePasswordFromSecretRef = originalResolve })
+
+	programOptions := &options{
+		Port:                      22,
+		User:                      "root",
+		HostPasswordSecretRefs:    "db1=bw://db",
+		PasswordSecretRefTemplate: "infisical://hosts/{{.Host}}/{{.User}}-password?port={{.Port}}",
+	}
+	hostSpecs := map[string]appconfig.HostSpec{"web2:2222": {Address: "web2", Port: 2222, User: "deploy"}}
+	hosts := []string{"web1:22", "web2:2222", "db1:22"}
+	hostPasswords, err := resolveHostPasswords(programOptions, hosts, hostSpecs)
+	if err != nil {
+		t.Fatalf("resolveHostPasswords() error = %v", err)
+	}
+
+	want := map[string]string{
+		"web1:22":   "pw:infisical://hosts/web1/root-password?port=22",
+		"web2:2222": "pw:infisical://hosts/web2/deploy-password?port=2222",
+		"db1:22":    "pw:bw://db",
+	}
+	for host, password := range want {
+		if hostPasswords[host] != password {
+			t.Fatalf("password for %s = %q, want %q", host, hostPasswords[host], password)
+		}
+	}
+	if needsFallbackPassword(hosts, hostPasswords) || !hasHostPasswordSecretRefs(&options{PasswordSecretRefTemplate: "bw://{{.Host}}"}) {
+		t.Fatalf("a template covers every host, so no shared password is needed")
+	}
+}
+
+func TestParseSecretRefTemplateRejectsUnknownFields(t *testing.T) {
+	for _, value := range []string{"bw://{{.Hostname}}", "bw://{{.Host", "{{if false}}x{{end}}"} {
+		if _, err := parseSecretRefTemplate(value); err == nil {
+			t.Fatalf("parseSecretRefTemplate(%q) error = nil", value)
+		}
+	}
+}
+
+func TestClientConfigForLoginCopiesConfig(t *testing.T) {
+	baseConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("shared")}}
+	hostConfig := clientConfigForLogin(baseConfig, []string{authMethodPassword}, "root", "host-specific")
+
+	if hostConfig == baseConfig || hostConfig.User != "root" || len(hostConfig.Auth) != 1 {
+		t.Fatalf("host config = %+v", hostConfig)
+	}
+	if baseConfig.User != "deploy" || len(baseConfig.Auth) != 1 {
+		t.Fatalf("base config modified")
+	}
+}
+
+func TestCheckSharedPasswordLimit(t *testing.T) {
+	hosts := []string{"app01:22", "app02:22", "app03:22", "db01:22"}
+	hostPasswords := map[string]string{"app01:22": "a1", "app02:22": "a2", "db01:22": "shared"}
+
+	programOptions := &options{Password: "shared", MaxHostsPerPassword: 1}
+	err := checkSharedPasswordLimit(programOptions, hosts, hostPasswords)
+	if err == nil || !strings.Contains(err.Error(), "2 hosts would share one password") {
+		t.Fatalf("a secret that resolves to the shared password must count as shared, error = %v", err)
+	}
+	if strings.Contains(err.Error(), programOptions.Password) {
+		t.Fatalf("error leaks the password: %v", err)
+	}
+
+	for _, allowed := range []*options{
+		{Password: "shared", MaxHostsPerPassword: 2},
+		{Password: "shared"},
+		{Password: "shared", MaxHostsPerPassword: 1, AuthMethods: authMethodPublicKey},
+	} {
+		if err := checkSharedPasswordLimit(allowed, hosts, hostPasswords); err != nil {
+			t.Fatalf("checkSharedPasswordLimit(%+v) error = %v", allowed, err)
+		}
+	}
+}
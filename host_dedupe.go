@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dedupeLookupWorkers = 16
+
+var lookupHostAddresses = net.DefaultResolver.LookupHost
+
+// hostDuplicate is a target dropped by --dedupe-ip because it resolves to
+// the same addresses and port as an earlier one.
+type hostDuplicate struct {
+	host      string
+	sameAs    string
+	addresses []string
+}
+
+// dedupeHostsByAddress resolves every target and keeps only the first of
+// those that reach the same addresses on the same port, such as a short name
+// and its FQDN or a CNAME and its target. Two names count as the same host
+// when they resolve to the same set of addresses. Hosts that do not resolve
+// are kept, so they fail in the run as before.
+func dedupeHostsByAddress(hosts []string, timeout time.Duration) ([]string, []hostDuplicate) {
+	addresses := make([][]string, len(hosts))
+	workerSlots := make(chan struct{}, dedupeLookupWorkers)
+	var waitGroup sync.WaitGroup
+	for index, host := range hosts {
+		waitGroup.Go(func() {
+			workerSlots <- struct{}{}
+			defer func() { <-workerSlots }()
+
+			hostName, _, err := net.SplitHostPort(host)
+			if err != nil {
+				return
+			}
+			lookupContext, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			resolved, err := lookupHostAddresses(lookupContext, hostName)
+			if err != nil || len(resolved) == 0 {
+				return
+			}
+			slices.Sort(resolved)
+			addresses[index] = slices.Compact(resolved)
+		})
+	}
+	waitGroup.Wait()
+
+	kept := make([]string, 0, len(hosts))
+	var duplicates []hostDuplicate
+	firstByTarget := map[string]string{}
+	for index, host := range hosts {
+		if addresses[index] == nil {
+			kept = append(kept, host)
+			continue
+		}
+		_, port, _ := net.SplitHostPort(host)
+		target := strings.Join(addresses[index], ",") + "|" + port
+		if sameAs, seen := firstByTarget[target]; seen {
+			duplicates = append(duplicates, hostDuplicate{host: host, sameAs: sameAs, addresses: addresses[index]})
+			continue
+		}
+		firstByTarget[target] = host
+		kept = append(kept, host)
+	}
+	return kept, duplicates
+}
+
+// reportHostDuplicates runs dedupeHostsByAddress as its own task when
+// --dedupe-ip is set and returns the remaining targets.
+func reportHostDuplicates(programOptions *options, hosts []string) []string {
+	if !programOptions.DedupeIP {
+		return hosts
+	}
+	outputAnsibleTask("Deduplicate hosts by address")
+	kept, duplicates := dedupeHostsByAddress(hosts, time.Duration(programOptions.TimeoutSec)*time.Second)
+	for _, duplicate := range duplicates {
+		outputAnsibleHostStatus("skipping", duplicate.host, fmt.Sprintf("same host as %s (%s)", duplicate.sameAs, strings.Join(duplicate.addresses, ", ")))
+	}
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d duplicate(s) dropped, %d host(s) left", len(duplicates), len(kept)))
+	return kept
+}
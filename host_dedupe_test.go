@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stubHostLookup(t *testing.T, records map[string][]string) {
+	t.Helper()
+
+	original := lookupHostAddresses
+	lookupHostAddresses = func(_ context.Context, host string) ([]string, error) {
+		if addresses, ok := records[host]; ok {
+			return slices.Clone(addresses), nil
+		}
+		return nil, errors.New("no such host")
+	}
+	t.Cleanup(func() { lookupHostAddresses = original })
+}
+
+func TestDedupeHostsByAddress(t *testing.T) {
+	stubHostLookup(t, map[string][]string{
+		"app01":             {"10.0.0.5"},
+		"app01.example.com": {"10.0.0.5"},
+		"10.0.0.5":          {"10.0.0.5"},
+		"www":               {"10.0.0.7", "10.0.0.6"},
+		"www-alias":         {"10.0.0.6", "10.0.0.7"},
+		"db":                {"10.0.0.6"},
+	})
+	hosts := []string{"app01:22", "app01.example.com:22", "10.0.0.5:2222", "10.0.0.5:22", "www:22", "www-alias:22", "db:22", "unresolved:22"}
+
+	kept, duplicates := dedupeHostsByAddress(hosts, time.Second)
+	if want := []string{"app01:22", "10.0.0.5:2222", "www:22", "db:22", "unresolved:22"}; !slices.Equal(kept, want) {
+		t.Fatalf("kept = %q, want %q", kept, want)
+	}
+	var described []string
+	for _, duplicate := range duplicates {
+		described = append(described, duplicate.host+"="+duplicate.sameAs)
+	}
+	if want := []string{"app01.example.com:22=app01:22", "10.0.0.5:22=app01:22", "www-alias:22=www:22"}; !slices.Equal(described, want) {
+		t.Fatalf("duplicates = %q, want %q", described, want)
+	}
+}
+
+func TestReportHostDuplicatesOnlyWithFlag(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubHostLookup(t, map[string][]string{"a": {"10.0.0.1"}, "a.example.com": {"10.0.0.1"}})
+	hosts := []string{"a:22", "a.example.com:22"}
+
+	if kept := reportHostDuplicates(&options{TimeoutSec: 1}, slices.Clone(hosts)); len(kept) != 2 {
+		t.Fatalf("without --dedupe-ip kept = %q", kept)
+	}
+	kept := reportHostDuplicates(&options{TimeoutSec: 1, DedupeIP: true}, slices.Clone(hosts))
+	if !slices.Equal(kept, []string{"a:22"}) {
+		t.Fatalf("kept = %q", kept)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "skipping: [a.example.com:22] => same host as a:22 (10.0.0.1)") {
+		t.Fatalf("output missing duplicate: %q", output)
+	}
+}
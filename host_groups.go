@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+const ungroupedHostsLabel = "(ungrouped)"
+
+// hostGroupsFor maps each target host to its group, such as a datacenter:
+// the group of its JSON hosts entry, or else the #group of the servers file
+// line that first named it. Hosts without a group are left out.
+func hostGroupsFor(hosts []string, hostSpecs map[string]appconfig.HostSpec, notesByHost map[string]serverEntryNotes) map[string]string {
+	groups := map[string]string{}
+	for _, host := range hosts {
+		group := strings.TrimSpace(hostSpecs[host].Group)
+		if group == "" {
+			group = notesByHost[host].group
+		}
+		if group != "" {
+			groups[host] = group
+		}
+	}
+	return groups
+}
+
+// outputGroupRecap prints host subtotals per group after the play recap, so
+// the datacenter that had the failures stands out in a large run. Groups are
+// listed in the order their first host ran, ungrouped hosts last. Nothing is
+// printed when no host has a group.
+func outputGroupRecap(hosts []string, hostRecaps map[string]hostRunRecap, groups map[string]string) {
+	if len(groups) == 0 {
+		return
+	}
+	type groupTotals struct {
+		hosts, ok, changed, failed int
+	}
+
+	var groupOrder []string
+	totalsByGroup := map[string]*groupTotals{}
+	for _, host := range hosts {
+		group, grouped := groups[host]
+		if !grouped {
+			group = ungroupedHostsLabel
+		}
+		totals, seen := totalsByGroup[group]
+		if !seen {
+			totals = &groupTotals{}
+			totalsByGroup[group] = totals
+			if grouped {
+				groupOrder = append(groupOrder, group)
+			}
+		}
+		recap := hostRecaps[host]
+		totals.hosts++
+		if recap.failed > 0 {
+			totals.failed++
+		} else {
+			totals.ok++
+		}
+		if recap.changed > 0 {
+			totals.changed++
+		}
+	}
+	if _, seen := totalsByGroup[ungroupedHostsLabel]; seen {
+		groupOrder = append(groupOrder, ungroupedHostsLabel)
+	}
+
+	outputPrintln()
+	outputPrintln("GROUP RECAP ********************************************************************")
+	for _, group := range groupOrder {
+		totals := totalsByGroup[group]
+		outputPrintf("%-24s : hosts=%d ok=%d changed=%d failed=%d\n", group, totals.hosts, totals.ok, totals.changed, totals.failed)
+	}
+}
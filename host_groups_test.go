@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+func TestReadServersFileGroups(t *testing.T) {
+	directory := t.TempDir()
+	writeServersFiles(t, directory, map[string]string{
+		"all.txt": "bastion01\n#group dc1\napp01\n#include dc1.txt\n#group\tdc2\napp02\n#group\napp03\n#groups is a comment\napp04\n",
+		"dc1.txt": "db01\n#group dc1-edge\nedge01\n",
+	})
+
+	_, notes, err := readServersFileWithNotes(filepath.Join(directory, "all.txt"), nil)
+	if err != nil {
+		t.Fatalf("readServersFileWithNotes() error = %v", err)
+	}
+	want := map[string]string{"bastion01": "", "app01": "dc1", "db01": "dc1", "edge01": "dc1-edge", "app02": "dc2", "app03": "", "app04": ""}
+	for entry, wantGroup := range want {
+		if got := notes[entry].group; got != wantGroup {
+			t.Fatalf("group of %s = %q, want %q", entry, got, wantGroup)
+		}
+	}
+}
+
+func TestHostGroupsForPrefersTheHostsEntry(t *testing.T) {
+	hostSpecs := map[string]appconfig.HostSpec{"db01:22": {Address: "db01", Group: " dc2 "}}
+	notesByHost := map[string]serverEntryNotes{"db01:22": {group: "dc1"}, "app01:22": {group: "dc1"}}
+
+	groups := hostGroupsFor([]string{"app01:22", "db01:22", "web01:22"}, hostSpecs, notesByHost)
+	if len(groups) != 2 || groups["app01:22"] != "dc1" || groups["db01:22"] != "dc2" {
+		t.Fatalf("hostGroupsFor() = %v", groups)
+	}
+}
+
+func TestOutputGroupRecapSubtotalsByGroup(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	hosts := []string{"web01:22", "app01:22", "app02:22", "db01:22"}
+	hostRecaps := map[string]hostRunRecap{
+		"web01:22": {ok: 1},
+		"app01:22": {ok: 1, changed: 1},
+		"app02:22": {failed: 1},
+		"db01:22":  {ok: 1},
+	}
+
+	outputGroupRecap(hosts, hostRecaps, map[string]string{"app01:22": "dc1", "app02:22": "dc1", "db01:22": "dc2"})
+	want := "\nGROUP RECAP ********************************************************************\n" +
+		"dc1                      : hosts=2 ok=1 changed=1 failed=1\n" +
+		"dc2                      : hosts=1 ok=1 changed=0 failed=0\n" +
+		"(ungrouped)              : hosts=1 ok=1 changed=0 failed=0\n"
+	if outputBuffer.String() != want {
+		t.Fatalf("group recap = %q, want %q", outputBuffer.String(), want)
+	}
+
+	outputBuffer.Reset()
+	outputGroupRecap(hosts, hostRecaps, nil)
+	if outputBuffer.Len() != 0 {
+		t.Fatalf("group recap without groups = %q, want nothing", outputBuffer.String())
+	}
+}
+
+func TestWriteFailedHostsFileKeepsGroups(t *testing.T) {
+	directory := t.TempDir()
+	serversPath := filepath.Join(directory, "servers.txt")
+	if err := os.WriteFile(serversPath, []byte("#group dc1\napp01\napp02\n#group dc2\ndb01\n#group\nweb01\n"), 0o600); err != nil {
+		t.Fatalf("write servers file: %v", err)
+	}
+	_, notes, err := readServersFileWithNotes(serversPath, nil)
+	if err != nil {
+		t.Fatalf("readServersFileWithNotes() error = %v", err)
+	}
+
+	hosts := []string{"app01:22", "app02:22", "db01:22", "web01:22"}
+	hostRecaps := map[string]hostRunRecap{"app01:22": {failed: 1}, "app02:22": {ok: 1}, "db01:22": {failed: 1}, "web01:22": {failed: 1}}
+	failedPath := filepath.Join(directory, "failed.txt")
+	if _, err := writeFailedHostsFile(failedPath, "", hosts, hostRecaps, serverNotesByHost(notes, 22)); err != nil {
+		t.Fatalf("writeFailedHostsFile() error = %v", err)
+	}
+	content, _ := os.ReadFile(failedPath)
+	if want := "#group dc1\napp01:22\n\n#group dc2\ndb01:22\n\n#group\nweb01:22\n"; !strings.HasSuffix(string(content), want) {
+		t.Fatalf("failed hosts file = %q, want it to end with %q", content, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// --min-host-key-strength levels, weakest first.
+const (
+	hostKeyStrengthAny     = "any"
+	hostKeyStrengthSHA2    = "sha2"
+	hostKeyStrengthED25519 = "ed25519"
+)
+
+// minRSAHostKeyBits is the smallest RSA host key accepted from sha2 up.
+const minRSAHostKeyBits = 2048
+
+func validateHostKeyStrength(strength string) error {
+	switch strings.TrimSpace(strength) {
+	case "", hostKeyStrengthAny, hostKeyStrengthSHA2, hostKeyStrengthED25519:
+		return nil
+	}
+	return fmt.Errorf("invalid --min-host-key-strength %q (want %s, %s or %s)", strength, hostKeyStrengthAny, hostKeyStrengthSHA2, hostKeyStrengthED25519)
+}
+
+// allowedHostKeyAlgorithm reports whether algorithm may be negotiated under
+// strength: sha2 drops DSA and SHA-1 signed RSA, ed25519 keeps only ed25519.
+func allowedHostKeyAlgorithm(strength, algorithm string) bool {
+	switch strings.TrimSpace(strength) {
+	case hostKeyStrengthSHA2:
+		return algorithm != ssh.KeyAlgoRSA && algorithm != ssh.CertAlgoRSAv01 &&
+			algorithm != ssh.InsecureKeyAlgoDSA && algorithm != ssh.InsecureCertAlgoDSAv01
+	case hostKeyStrengthED25519:
+		return algorithm == ssh.KeyAlgoED25519 || algorithm == ssh.CertAlgoED25519v01
+	}
+	return true
+}
+
+// hostKeyAlgorithms returns the host key algorithms to offer, or nil to keep
+// the library default when no policy is set.
+func hostKeyAlgorithms(strength string, preferED25519 bool) []string {
+	if !preferED25519 && (strings.TrimSpace(strength) == "" || strength == hostKeyStrengthAny) {
+		return nil
+	}
+	algorithms := make([]string, 0)
+	for _, algorithm := range ssh.SupportedAlgorithms().HostKeys {
+		if allowedHostKeyAlgorithm(strength, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	if preferED25519 {
+		ed25519First := []string{ssh.KeyAlgoED25519, ssh.CertAlgoED25519v01}
+		algorithms = slices.DeleteFunc(algorithms, func(algorithm string) bool { return slices.Contains(ed25519First, algorithm) })
+		if allowedHostKeyAlgorithm(strength, ssh.KeyAlgoED25519) {
+			algorithms = append(ed25519First, algorithms...)
+		}
+	}
+	return algorithms
+}
+
+// weakHostKeyError is returned when a host presents a key below
+// --min-host-key-strength.
+type weakHostKeyError struct {
+	hostname string
+	reason   string
+}
+
+func (weakErr *weakHostKeyError) Error() string {
+	return fmt.Sprintf("host key for %s refused by --min-host-key-strength: %s", weakErr.hostname, weakErr.reason)
+}
+
+// checkHostKeyStrength refuses keys the negotiated algorithm alone does not
+// rule out, such as short RSA keys. SHA-1 RSA signatures are never offered
+// under sha2, see hostKeyAlgorithms.
+func checkHostKeyStrength(strength, hostname string, key ssh.PublicKey) error {
+	keyType := key.Type()
+	switch strength {
+	case hostKeyStrengthED25519:
+		if keyType != ssh.KeyAlgoED25519 && keyType != ssh.CertAlgoED25519v01 {
+			return &weakHostKeyError{hostname: hostname, reason: keyType + " keys are not allowed"}
+		}
+	case hostKeyStrengthSHA2:
+		if keyType == ssh.InsecureKeyAlgoDSA || keyType == ssh.InsecureCertAlgoDSAv01 {
+			return &weakHostKeyError{hostname: hostname, reason: keyType + " keys are not allowed"}
+		}
+		if cryptoKey, ok := key.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAHostKeyBits {
+				return &weakHostKeyError{hostname: hostname, reason: fmt.Sprintf("%d-bit RSA key is shorter than %d bits", rsaKey.N.BitLen(), minRSAHostKeyBits)}
+			}
+		}
+	}
+	return nil
+}
+
+// knownHostKeyTypeError is returned with --prefer-ed25519 when a host
+// presents a key of a type that known_hosts has no entry for, while it does
+// pin keys of other types. dialSSH then retries with only the pinned types.
+type knownHostKeyTypeError struct {
+	knownTypes []string
+	err        *knownhosts.KeyError
+}
+
+func (typeErr *knownHostKeyTypeError) Error() string {
+	return typeErr.err.Error()
+}
+
+func (typeErr *knownHostKeyTypeError) Unwrap() error {
+	return typeErr.err
+}
+
+// withHostKeyPolicy wraps hostKeyCallback to enforce strength and, when
+// ed25519 is preferred, to report known_hosts type mismatches as
+// knownHostKeyTypeError instead of a changed key.
+func withHostKeyPolicy(hostKeyCallback ssh.HostKeyCallback, strength string, preferED25519 bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := checkHostKeyStrength(strings.TrimSpace(strength), hostname, key); err != nil {
+			return err
+		}
+		err := hostKeyCallback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if err == nil || !preferED25519 || !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+			return err
+		}
+		knownTypes := make([]string, 0, len(keyErr.Want))
+		for _, known := range keyErr.Want {
+			if known.Key.Type() == key.Type() {
+				return err
+			}
+			if !slices.Contains(knownTypes, known.Key.Type()) {
+				knownTypes = append(knownTypes, known.Key.Type())
+			}
+		}
+		return &knownHostKeyTypeError{knownTypes: knownTypes, err: keyErr}
+	}
+}
+
+// hostKeyAlgorithmsForKeyTypes lists the algorithms that can verify the given
+// key types, keeping only those still allowed by the offered list.
+func hostKeyAlgorithmsForKeyTypes(keyTypes, offered []string) []string {
+	var algorithms []string
+	for _, keyType := range keyTypes {
+		candidates := []string{keyType}
+		if keyType == ssh.KeyAlgoRSA {
+			candidates = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, candidate := range candidates {
+			if len(offered) == 0 || slices.Contains(offered, candidate) {
+				algorithms = append(algorithms, candidate)
+			}
+		}
+	}
+	return algorithms
+}
+
+// opensshHostKeyArgs translates the host key policy into a HostKeyAlgorithms
+// option for the system ssh client, which already prefers known key types.
+func opensshHostKeyArgs(strength string, preferED25519 bool) []string {
+	algorithms := hostKeyAlgorithms(strength, preferED25519)
+	if algorithms == nil {
+		return nil
+	}
+	return []string{"-o", "HostKeyAlgorithms=" + strings.Join(algorithms, ",")}
+}
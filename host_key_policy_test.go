@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T, keyType string) ssh.PublicKey {
+	t.Helper()
+
+	var rawKey any
+	switch keyType {
+	case "ed25519":
+		publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("generate ed25519 key: %v", err)
+		}
+		rawKey = publicKey
+	case "rsa1024", "rsa2048":
+		bits := 2048
+		if keyType == "rsa1024" {
+			bits = 1024
+		}
+		privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatalf("generate rsa key: %v", err)
+		}
+		rawKey = &privateKey.PublicKey
+	}
+	publicKey, err := ssh.NewPublicKey(rawKey)
+	if err != nil {
+		t.Fatalf("convert %s key: %v", keyType, err)
+	}
+	return publicKey
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	if got := hostKeyAlgorithms(hostKeyStrengthAny, false); got != nil {
+		t.Fatalf("hostKeyAlgorithms(any) = %q, want library default", got)
+	}
+
+	sha2 := hostKeyAlgorithms(hostKeyStrengthSHA2, false)
+	for _, refused := range []string{ssh.KeyAlgoRSA, ssh.InsecureKeyAlgoDSA, ssh.CertAlgoRSAv01} {
+		if slices.Contains(sha2, refused) {
+			t.Fatalf("hostKeyAlgorithms(sha2) offers %s: %q", refused, sha2)
+		}
+	}
+	if !slices.Contains(sha2, ssh.KeyAlgoRSASHA256) {
+		t.Fatalf("hostKeyAlgorithms(sha2) = %q, want rsa-sha2-256 kept", sha2)
+	}
+
+	if got := hostKeyAlgorithms(hostKeyStrengthED25519, false); !slices.Equal(got, []string{ssh.CertAlgoED25519v01, ssh.KeyAlgoED25519}) {
+		t.Fatalf("hostKeyAlgorithms(ed25519) = %q", got)
+	}
+	if got := hostKeyAlgorithms(hostKeyStrengthSHA2, true); got[0] != ssh.KeyAlgoED25519 || len(got) != len(sha2) {
+		t.Fatalf("hostKeyAlgorithms(sha2, prefer) = %q, want ed25519 first", got)
+	}
+}
+
+func TestCheckHostKeyStrength(t *testing.T) {
+	shortRSA := newTestHostKey(t, "rsa1024")
+	rsaKey := newTestHostKey(t, "rsa2048")
+	ed25519Key := newTestHostKey(t, "ed25519")
+
+	tests := []struct {
+		strength string
+		key      ssh.PublicKey
+		wantErr  bool
+	}{
+		{strength: hostKeyStrengthAny, key: shortRSA},
+		{strength: hostKeyStrengthSHA2, key: shortRSA, wantErr: true},
+		{strength: hostKeyStrengthSHA2, key: rsaKey},
+		{strength: hostKeyStrengthED25519, key: rsaKey, wantErr: true},
+		{strength: hostKeyStrengthED25519, key: ed25519Key},
+	}
+	for _, test := range tests {
+		err := checkHostKeyStrength(test.strength, "app01:22", test.key)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("checkHostKeyStrength(%s, %s) error = %v, want error %t", test.strength, test.key.Type(), err, test.wantErr)
+		}
+		if err != nil && classifyHostError(fmt.Errorf("ssh: handshake failed: %w", err)) != hostErrorHostKey {
+			t.Fatalf("weak host key error classified as %s", classifyHostError(err))
+		}
+	}
+	if err := validateHostKeyStrength("sha1"); err == nil {
+		t.Fatal("validateHostKeyStrength(sha1) error = nil")
+	}
+}
+
+func TestDialSSHRetriesWithPinnedKeyTypeWhenPreferringED25519(t *testing.T) {
+	pinnedKey := newTestHostKey(t, "rsa2048")
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{"app01"}, pinnedKey)+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	knownHostsCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		t.Fatalf("load known_hosts: %v", err)
+	}
+
+	serverKeys := map[bool]ssh.PublicKey{true: newTestHostKey(t, "ed25519"), false: pinnedKey}
+	var offered [][]string
+	stubSSHDialHook(t, func(_, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+		offered = append(offered, clientConfig.HostKeyAlgorithms)
+		remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 22}
+		serverKey := serverKeys[clientConfig.HostKeyAlgorithms[0] == ssh.KeyAlgoED25519]
+		if err := clientConfig.HostKeyCallback(address, remote, serverKey); err != nil {
+			return nil, fmt.Errorf("ssh: handshake failed: %w", err)
+		}
+		return nil, errors.New("accepted")
+	})
+
+	clientConfig := &ssh.ClientConfig{
+		HostKeyCallback:   withHostKeyPolicy(knownHostsCallback, hostKeyStrengthSHA2, true),
+		HostKeyAlgorithms: hostKeyAlgorithms(hostKeyStrengthSHA2, true),
+	}
+	_, err = dialSSH("tcp", "app01:22", clientConfig)
+	if err == nil || err.Error() != "accepted" {
+		t.Fatalf("dialSSH() error = %v, want the pinned RSA key to be accepted on retry", err)
+	}
+	if len(offered) != 2 || !slices.Equal(offered[1], []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256}) {
+		t.Fatalf("offered host key algorithms = %q, want a retry with rsa-sha2 only", offered)
+	}
+}
+
+func TestWithHostKeyPolicyKeepsChangedKeyErrorWithoutPreference(t *testing.T) {
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHostsPath, []byte(knownhosts.Line([]string{"app01"}, newTestHostKey(t, "rsa2048"))+"\n"), 0o600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	knownHostsCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		t.Fatalf("load known_hosts: %v", err)
+	}
+
+	err = withHostKeyPolicy(knownHostsCallback, hostKeyStrengthAny, false)("app01:22", &net.TCPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 22}, newTestHostKey(t, "ed25519"))
+	if _, ok := errors.AsType[*knownHostKeyTypeError](err); ok {
+		t.Fatalf("withHostKeyPolicy() error = %v, want a plain known_hosts mismatch", err)
+	}
+	if _, ok := errors.AsType[*knownhosts.KeyError](err); !ok {
+		t.Fatalf("withHostKeyPolicy() error = %v, want known_hosts mismatch", err)
+	}
+}
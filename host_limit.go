@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// hostLimit narrows a resolved host list like Ansible's --limit: a
+// comma-separated list of glob patterns, "~regex" entries and "!pattern"
+// exclusions. Patterns match the host name or the full host:port address,
+// case-insensitively.
+type hostLimit struct {
+	include []hostPattern
+	exclude []hostPattern
+}
+
+type hostPattern struct {
+	glob  string
+	regex *regexp.Regexp
+}
+
+// parseHostLimit returns nil for an empty limit, which matches every host.
+func parseHostLimit(value string) (*hostLimit, error) {
+	entries := splitServerEntries(value)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	limit := &hostLimit{}
+	for _, entry := range entries {
+		exclude := strings.HasPrefix(entry, "!")
+		entry = strings.TrimSpace(strings.TrimPrefix(entry, "!"))
+		if entry == "" {
+			return nil, fmt.Errorf("invalid --limit entry %q", "!")
+		}
+
+		var pattern hostPattern
+		if strings.HasPrefix(entry, "~") {
+			compiledRegex, err := regexp.Compile("(?i)" + entry[1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid --limit regex %q: %w", entry[1:], err)
+			}
+			pattern.regex = compiledRegex
+		} else {
+			pattern.glob = strings.ToLower(entry)
+			if _, err := path.Match(pattern.glob, ""); err != nil {
+				return nil, fmt.Errorf("invalid --limit pattern %q: %w", entry, err)
+			}
+		}
+
+		if exclude {
+			limit.exclude = append(limit.exclude, pattern)
+		} else {
+			limit.include = append(limit.include, pattern)
+		}
+	}
+	return limit, nil
+}
+
+func (pattern hostPattern) matches(hostAddress string) bool {
+	candidates := []string{strings.ToLower(hostAddress)}
+	if hostName, _, err := net.SplitHostPort(hostAddress); err == nil {
+		candidates = append(candidates, strings.ToLower(hostName))
+	}
+	for _, candidate := range candidates {
+		if pattern.regex != nil && pattern.regex.MatchString(candidate) {
+			return true
+		}
+		if pattern.regex == nil {
+			if matched, _ := path.Match(pattern.glob, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether hostAddress is selected. With only exclusions, every
+// other host is selected.
+func (limit *hostLimit) allows(hostAddress string) bool {
+	if limit == nil {
+		return true
+	}
+	for _, pattern := range limit.exclude {
+		if pattern.matches(hostAddress) {
+			return false
+		}
+	}
+	if len(limit.include) == 0 {
+		return true
+	}
+	for _, pattern := range limit.include {
+		if pattern.matches(hostAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyHostLimit filters hosts, keeping their order, and fails when a limit is
+// set but selects nothing so a typo does not silently turn into a no-op run.
+func applyHostLimit(hosts []string, limitValue string) ([]string, error) {
+	limit, err := parseHostLimit(limitValue)
+	if err != nil || limit == nil {
+		return hosts, err
+	}
+
+	var selectedHosts []string
+	for _, host := range hosts {
+		if limit.allows(host) {
+			selectedHosts = append(selectedHosts, host)
+		}
+	}
+	if len(selectedHosts) == 0 && len(hosts) > 0 {
+		return nil, fmt.Errorf("--limit %q matched none of %d host(s)", limitValue, len(hosts))
+	}
+	return selectedHosts, nil
+}
+
+func hostSet(hosts []string) map[string]bool {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		set[host] = true
+	}
+	return set
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyHostLimit(t *testing.T) {
+	hosts := []string{"web01.prod.example.com:22", "web02.prod.example.com:22", "web01.stage.example.com:22", "db01.prod.example.com:2222"}
+
+	testCases := []struct {
+		limit string
+		want  []string
+	}{
+		{"", hosts},
+		{"web*.prod.example.com", hosts[:2]},
+		{"WEB*.PROD.example.com", hosts[:2]},
+		{"~^(web|db)01\\.prod", []string{hosts[0], hosts[3]}},
+		{"*.prod.example.com,!web02*", []string{hosts[0], hosts[3]}},
+		{"!*.stage.example.com", []string{hosts[0], hosts[1], hosts[3]}},
+		{"db01.prod.example.com:2222", hosts[3:]},
+	}
+	for _, testCase := range testCases {
+		got, err := applyHostLimit(hosts, testCase.limit)
+		if err != nil {
+			t.Fatalf("applyHostLimit(%q) error = %v", testCase.limit, err)
+		}
+		if !slices.Equal(got, testCase.want) {
+			t.Fatalf("applyHostLimit(%q) = %v, want %v", testCase.limit, got, testCase.want)
+		}
+	}
+}
+
+func TestApplyHostLimitErrors(t *testing.T) {
+	hosts := []string{"web01:22"}
+	if _, err := applyHostLimit(hosts, "db*"); err == nil || !strings.Contains(err.Error(), "matched none") {
+		t.Fatalf("applyHostLimit(no match) error = %v", err)
+	}
+	for _, limit := range []string{"~web(", "web[", "!"} {
+		if _, err := applyHostLimit(hosts, limit); err == nil {
+			t.Fatalf("applyHostLimit(%q) error = nil, want invalid pattern", limit)
+		}
+	}
+}
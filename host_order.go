@@ -0,0 +1,115 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --order picks the order hosts run in. Rollouts often follow the inventory
+// (rack by rack) or spread load at random instead of going alphabetically.
+const (
+	hostOrderSorted    = "sorted"
+	hostOrderInput     = "input"
+	hostOrderRandom    = "random"
+	hostOrderByLatency = "by-latency"
+)
+
+const hostLatencyWorkers = 16
+
+var hostOrders = []string{hostOrderSorted, hostOrderInput, hostOrderRandom, hostOrderByLatency}
+
+var (
+	// shuffleHosts puts hosts in random order. Tests replace it to make the
+	// order deterministic.
+	shuffleHosts = func(hosts []string) {
+		rand.Shuffle(len(hosts), func(i, j int) { hosts[i], hosts[j] = hosts[j], hosts[i] }) // #nosec G404 -- host order is not security sensitive
+	}
+	// measureHostLatency times a TCP connect to host's SSH port.
+	measureHostLatency = func(host string, timeout time.Duration) (time.Duration, error) {
+		startedAt := time.Now()
+		connection, err := dialWaitUpProbe("tcp", host, timeout)
+		if err != nil {
+			return 0, err
+		}
+		latency := time.Since(startedAt)
+		_ = connection.Close()
+		return latency, nil
+	}
+)
+
+// parseHostOrder returns the --order value, sorted when it is empty.
+func parseHostOrder(value string) (string, error) {
+	order := strings.ToLower(strings.TrimSpace(value))
+	if order == "" {
+		return hostOrderSorted, nil
+	}
+	if !slices.Contains(hostOrders, order) {
+		return "", fmt.Errorf("--order must be one of %s, got %q", strings.Join(hostOrders, ", "), value)
+	}
+	return order, nil
+}
+
+// orderHostsByLatency probes every host concurrently and returns them fastest
+// first, and how many did not answer. Those keep their relative order at the
+// end, where they fail in the run as usual.
+func orderHostsByLatency(hosts []string, timeout time.Duration) ([]string, int) {
+	type latencyResult struct {
+		host    string
+		latency time.Duration
+		err     error
+	}
+
+	results := make([]latencyResult, len(hosts))
+	workerSlots := make(chan struct{}, hostLatencyWorkers)
+	var waitGroup sync.WaitGroup
+	for index, host := range hosts {
+		waitGroup.Go(func() {
+			workerSlots <- struct{}{}
+			defer func() { <-workerSlots }()
+
+			latency, err := measureHostLatency(host, timeout)
+			results[index] = latencyResult{host: host, latency: latency, err: err}
+		})
+	}
+	waitGroup.Wait()
+
+	slices.SortStableFunc(results, func(left, right latencyResult) int {
+		if (left.err == nil) != (right.err == nil) {
+			if left.err == nil {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(left.latency, right.latency)
+	})
+	ordered := make([]string, len(results))
+	unreachable := 0
+	for index, result := range results {
+		ordered[index] = result.host
+		if result.err != nil {
+			unreachable++
+		}
+	}
+	return ordered, unreachable
+}
+
+// reportHostLatencyOrder runs orderHostsByLatency as its own task when
+// --order by-latency is set and returns the reordered targets.
+func reportHostLatencyOrder(programOptions *options, hosts []string) []string {
+	if order, _ := parseHostOrder(programOptions.Order); order != hostOrderByLatency || len(hosts) < 2 {
+		return hosts
+	}
+	outputAnsibleTask("Order hosts by latency")
+	ordered, unreachable := orderHostsByLatency(hosts, time.Duration(programOptions.TimeoutSec)*time.Second)
+	message := fmt.Sprintf("%d host(s) ordered by connect time", len(ordered)-unreachable)
+	if unreachable > 0 {
+		message += fmt.Sprintf(", %d without an answer last", unreachable)
+	}
+	outputAnsibleHostStatus("ok", "localhost", message)
+	return ordered
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveTargetHostsOrder(t *testing.T) {
+	original := shuffleHosts
+	shuffleHosts = slices.Reverse[[]string]
+	t.Cleanup(func() { shuffleHosts = original })
+
+	entries := []string{"rack2-app01", "rack1-app02", "rack2-app01", "rack1-app01"}
+	testCases := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"rack1-app01:22", "rack1-app02:22", "rack2-app01:22"}},
+		{"sorted", []string{"rack1-app01:22", "rack1-app02:22", "rack2-app01:22"}},
+		{"input", []string{"rack2-app01:22", "rack1-app02:22", "rack1-app01:22"}},
+		{"Random", []string{"rack1-app01:22", "rack1-app02:22", "rack2-app01:22"}},
+	}
+	for _, testCase := range testCases {
+		hosts, _, err := resolveTargetHosts(&options{Port: 22, Order: testCase.order}, entries)
+		if err != nil {
+			t.Fatalf("resolveTargetHosts(--order %q) error = %v", testCase.order, err)
+		}
+		if !slices.Equal(hosts, testCase.want) {
+			t.Fatalf("resolveTargetHosts(--order %q) = %v, want %v", testCase.order, hosts, testCase.want)
+		}
+	}
+
+	if _, err := parseHostOrder("fastest"); err == nil || !strings.Contains(err.Error(), "sorted, input, random, by-latency") {
+		t.Fatalf("parseHostOrder(fastest) error = %v", err)
+	}
+}
+
+func TestOrderHostsByLatency(t *testing.T) {
+	original := measureHostLatency
+	latencies := map[string]time.Duration{"a:22": 30 * time.Millisecond, "c:22": 10 * time.Millisecond, "e:22": 20 * time.Millisecond}
+	measureHostLatency = func(host string, _ time.Duration) (time.Duration, error) {
+		if latency, ok := latencies[host]; ok {
+			return latency, nil
+		}
+		return 0, errors.New("connection refused")
+	}
+	t.Cleanup(func() { measureHostLatency = original })
+
+	ordered, unreachable := orderHostsByLatency([]string{"a:22", "b:22", "c:22", "d:22", "e:22"}, time.Second)
+	if want := []string{"c:22", "e:22", "a:22", "b:22", "d:22"}; !slices.Equal(ordered, want) {
+		t.Fatalf("orderHostsByLatency() = %v, want %v", ordered, want)
+	}
+	if unreachable != 2 {
+		t.Fatalf("unreachable = %d, want 2", unreachable)
+	}
+}
+
+func TestValidateOptionsRejectsLatencyOrderOverTransport(t *testing.T) {
+	err := validateOptions(&options{Port: 22, TimeoutSec: 1, Transport: "ssm", Order: "by-latency"})
+	if err == nil || !strings.Contains(err.Error(), "--order by-latency probes hosts over TCP") {
+		t.Fatalf("validateOptions() error = %v", err)
+	}
+}
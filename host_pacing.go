@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	hostPacingSleep  = time.Sleep
+	hostPacingJitter = func(maxJitter time.Duration) time.Duration {
+		return time.Duration(rand.Int64N(int64(maxJitter) + 1)) // #nosec G404 -- jitter only smooths traffic, it is not security sensitive
+	}
+)
+
+var (
+	hostPacingMu        sync.Mutex
+	hostPacingDelay     time.Duration
+	hostPacingMaxJitter time.Duration
+)
+
+// configureHostPacing sets the pause taken between consecutive hosts (--delay)
+// and the random extra pause of up to maxJitter (--jitter) added to it. The
+// returned function clears both.
+func configureHostPacing(delay, maxJitter time.Duration) (func(), error) {
+	if delay < 0 {
+		return nil, fmt.Errorf("delay must not be negative, got %s", delay)
+	}
+	if maxJitter < 0 {
+		return nil, fmt.Errorf("jitter must not be negative, got %s", maxJitter)
+	}
+
+	hostPacingMu.Lock()
+	hostPacingDelay, hostPacingMaxJitter = delay, maxJitter
+	hostPacingMu.Unlock()
+	return func() {
+		hostPacingMu.Lock()
+		hostPacingDelay, hostPacingMaxJitter = 0, 0
+		hostPacingMu.Unlock()
+	}, nil
+}
+
+// hostPacer pauses between the hosts of one sequential pass. The first host
+// of a pass starts immediately.
+type hostPacer struct {
+	started bool
+}
+
+func (pacer *hostPacer) pause() {
+	if !pacer.started {
+		pacer.started = true
+		return
+	}
+
+	hostPacingMu.Lock()
+	pause, maxJitter := hostPacingDelay, hostPacingMaxJitter
+	hostPacingMu.Unlock()
+	if maxJitter > 0 {
+		pause += hostPacingJitter(maxJitter)
+	}
+	if pause > 0 {
+		hostPacingSleep(pause)
+	}
+}
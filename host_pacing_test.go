@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHostPacerPausesBetweenHostsWithJitter(t *testing.T) {
+	var sleeps []time.Duration
+	originalSleep, originalJitter := hostPacingSleep, hostPacingJitter
+	hostPacingSleep = func(delay time.Duration) { sleeps = append(sleeps, delay) }
+	hostPacingJitter = func(maxJitter time.Duration) time.Duration { return maxJitter / 2 }
+	t.Cleanup(func() { hostPacingSleep, hostPacingJitter = originalSleep, originalJitter })
+
+	restore, err := configureHostPacing(time.Second, 400*time.Millisecond)
+	if err != nil {
+		t.Fatalf("configureHostPacing() error = %v", err)
+	}
+	t.Cleanup(restore)
+
+	pacer := &hostPacer{}
+	for range 3 {
+		pacer.pause()
+	}
+	if len(sleeps) != 2 || sleeps[0] != 1200*time.Millisecond || sleeps[1] != 1200*time.Millisecond {
+		t.Fatalf("sleeps = %v, want two pauses of 1.2s", sleeps)
+	}
+
+	restore()
+	sleeps = nil
+	pacer.pause()
+	if len(sleeps) != 0 {
+		t.Fatalf("sleeps after restore = %v, want none", sleeps)
+	}
+}
+
+func TestConfigureHostPacingRejectsNegativeDurations(t *testing.T) {
+	if _, err := configureHostPacing(-time.Second, 0); err == nil {
+		t.Fatalf("configureHostPacing(negative delay) error = nil, want error")
+	}
+	if _, err := configureHostPacing(0, -time.Second); err == nil {
+		t.Fatalf("configureHostPacing(negative jitter) error = nil, want error")
+	}
+}
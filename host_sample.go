@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sampleHostIndexes picks count distinct indexes out of total. Tests replace
+// it to make the sample deterministic.
+var sampleHostIndexes = func(total, count int) []int {
+	return rand.Perm(total)[:count] // #nosec G404 -- sampling hosts is not security sensitive
+}
+
+// parseHostSampleSize turns --sample ("10" or "5%") into a host count for a
+// list of total hosts. Percentages round up so a sample is never empty.
+func parseHostSampleSize(value string, total int) (int, error) {
+	trimmedValue := strings.TrimSpace(value)
+	if percentValue, isPercent := strings.CutSuffix(trimmedValue, "%"); isPercent {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(percentValue), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, fmt.Errorf("--sample percentage must be greater than 0 and at most 100, got %q", value)
+		}
+		count := int(math.Ceil(float64(total) * percent / 100))
+		return max(count, 1), nil
+	}
+
+	count, err := strconv.Atoi(trimmedValue)
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("--sample must be a positive host count or a percentage, got %q", value)
+	}
+	return count, nil
+}
+
+// sampleHosts returns a random subset of hosts in their original order, or
+// all hosts when no sample is requested or the sample covers every host.
+func sampleHosts(hosts []string, value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" || len(hosts) == 0 {
+		return hosts, nil
+	}
+	count, err := parseHostSampleSize(value, len(hosts))
+	if err != nil {
+		return nil, err
+	}
+	if count >= len(hosts) {
+		return hosts, nil
+	}
+
+	indexes := sampleHostIndexes(len(hosts), count)
+	slices.Sort(indexes)
+	sampledHosts := make([]string, 0, count)
+	for _, index := range indexes {
+		sampledHosts = append(sampledHosts, hosts[index])
+	}
+	return sampledHosts, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSampleHosts(t *testing.T) {
+	original := sampleHostIndexes
+	sampleHostIndexes = func(total, count int) []int {
+		indexes := make([]int, 0, count)
+		for index := total - 1; len(indexes) < count; index-- {
+			indexes = append(indexes, index)
+		}
+		return indexes
+	}
+	t.Cleanup(func() { sampleHostIndexes = original })
+
+	hosts := []string{"a:22", "b:22", "c:22", "d:22", "e:22"}
+	testCases := []struct {
+		sample string
+		want   []string
+	}{
+		{"", hosts},
+		{"2", []string{"d:22", "e:22"}},
+		{"10", hosts},
+		{"40%", []string{"d:22", "e:22"}},
+		{"1%", []string{"e:22"}},
+		{"100%", hosts},
+	}
+	for _, testCase := range testCases {
+		got, err := sampleHosts(hosts, testCase.sample)
+		if err != nil {
+			t.Fatalf("sampleHosts(%q) error = %v", testCase.sample, err)
+		}
+		if !slices.Equal(got, testCase.want) {
+			t.Fatalf("sampleHosts(%q) = %v, want %v", testCase.sample, got, testCase.want)
+		}
+	}
+
+	for _, sample := range []string{"0", "-1", "abc", "0%", "150%"} {
+		if _, err := sampleHosts(hosts, sample); err == nil {
+			t.Fatalf("sampleHosts(%q) error = nil, want error", sample)
+		}
+	}
+}
+
+func TestSampleHostsPicksDistinctHosts(t *testing.T) {
+	hosts := []string{"a:22", "b:22", "c:22", "d:22", "e:22", "f:22"}
+	got, err := sampleHosts(hosts, "3")
+	if err != nil {
+		t.Fatalf("sampleHosts() error = %v", err)
+	}
+	if len(got) != 3 || len(hostSet(got)) != 3 {
+		t.Fatalf("sampleHosts() = %v, want 3 distinct hosts", got)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+// hostSettings are the effective login and key for one host after applying
+// JSON config host entries on top of the shared settings.
+type hostSettings struct {
+	User      string
+	Password  string // #nosec G117 -- runtime-only credential container
+	KeyInput  string
+	PublicKey string
+	// ExtraPublicKeys are installed alongside PublicKey (--key, --key-file).
+	ExtraPublicKeys []string
+}
+
+// resolveTargetHosts merges SERVER/SERVERS, the servers file entries and the
+// JSON config's hosts array and returns the sorted targets plus the host
+// entries keyed by host:port.
+func resolveTargetHosts(programOptions *options, serversFileEntries []string) ([]string, map[string]appconfig.HostSpec, error) {
+	hostSpecs := make(map[string]appconfig.HostSpec, len(programOptions.Hosts))
+	serverEntries := slices.Concat(splitServerEntries(programOptions.Server), splitServerEntries(programOptions.Servers), serversFileEntries)
+	serverEntries = slices.Grow(serverEntries, len(programOptions.Hosts))
+	for _, hostSpec := range programOptions.Hosts {
+		port := hostSpec.Port
+		if port == 0 {
+			port = programOptions.Port
+		}
+		host, err := normalizeHost(strings.TrimSpace(hostSpec.Address), port)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid host %q: %w", hostSpec.Address, err)
+		}
+		if _, exists := hostSpecs[host]; exists {
+			return nil, nil, fmt.Errorf("duplicate hosts entry for %s", host)
+		}
+		hostSpecs[host] = hostSpec
+		serverEntries = append(serverEntries, host)
+	}
+
+	order, err := parseHostOrder(programOptions.Order)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolveEntries := resolveHostEntriesInOrder
+	if order == hostOrderSorted {
+		resolveEntries = resolveHostEntries
+	}
+	hosts, err := resolveEntries(serverEntries, programOptions.Port)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts = keepRepeatHosts(hosts, programOptions.RepeatHosts)
+	hosts, err = applyHostLimit(hosts, programOptions.Limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	hosts, err = sampleHosts(hosts, programOptions.Sample)
+	if err != nil {
+		return nil, nil, err
+	}
+	// by-latency is applied later, as its own task, since it probes the hosts.
+	if order == hostOrderRandom {
+		shuffleHosts(hosts)
+	}
+	return hosts, hostSpecs, nil
+}
+
+// hostSpecsCover reports whether every target comes from the hosts array and
+// sets the given field, so the shared value does not need to be prompted for.
+func hostSpecsCover(programOptions *options, field func(appconfig.HostSpec) string) bool {
+	if len(programOptions.Hosts) == 0 ||
+		strings.TrimSpace(programOptions.Server) != "" ||
+		strings.TrimSpace(programOptions.Servers) != "" ||
+		strings.TrimSpace(programOptions.ServersFile) != "" ||
+		strings.TrimSpace(programOptions.HostsFile) != "" ||
+		strings.TrimSpace(programOptions.Discover) != "" ||
+		strings.TrimSpace(programOptions.NmapXML) != "" ||
+		strings.TrimSpace(programOptions.NetBoxURL) != "" ||
+		strings.TrimSpace(programOptions.ZabbixURL) != "" ||
+		strings.TrimSpace(programOptions.NagiosCfg) != "" ||
+		strings.TrimSpace(programOptions.LDAPURL) != "" {
+		return false
+	}
+	for _, hostSpec := range programOptions.Hosts {
+		if strings.TrimSpace(field(hostSpec)) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func hasHostPasswordSecretRefs(programOptions *options) bool {
+	if strings.TrimSpace(programOptions.HostPasswordSecretRefs) != "" || strings.TrimSpace(programOptions.PasswordSecretRefTemplate) != "" {
+		return true
+	}
+	for _, hostSpec := range programOptions.Hosts {
+		if strings.TrimSpace(hostSpec.PasswordSecretRef) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHostPublicKeys resolves each distinct key input once and returns the
+// (comment-stamped) public keys for every host: the host's own key first,
+// then the --key/--key-file keys, without duplicates.
+func resolveHostPublicKeys(programOptions *options, hosts []string, hostSpecs map[string]appconfig.HostSpec) (map[string][]string, map[string]string, error) {
+	policy, err := parseKeyPolicy(programOptions.KeyPolicy)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraKeys, err := resolveExtraPublicKeys(programOptions, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKeysByInput := map[string]string{}
+	keyInputs := make(map[string]string, len(hosts))
+	publicKeys := make(map[string][]string, len(hosts))
+	for _, host := range hosts {
+		keyInput := strings.TrimSpace(hostSpecs[host].Key)
+		if keyInput == "" {
+			keyInput = strings.TrimSpace(programOptions.KeyInput)
+		}
+		if keyInput == "" {
+			if len(extraKeys) == 0 {
+				return nil, nil, fmt.Errorf("no public key configured for %s", host)
+			}
+			keyInputs[host] = firstExtraKeyInput(programOptions)
+			publicKeys[host] = mergePublicKeys(extraKeys)
+			continue
+		}
+
+		publicKey, resolved := publicKeysByInput[keyInput]
+		if !resolved {
+			var err error
+			if publicKey, err = resolvePublicKey(keyInput); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", host, err)
+			}
+			if err = policy.check(publicKey); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", host, err)
+			}
+			if publicKey, err = stampPublicKeyComment(publicKey, programOptions.KeyComment); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", host, err)
+			}
+			publicKeysByInput[keyInput] = publicKey
+		}
+		keyInputs[host] = keyInput
+		publicKeys[host] = mergePublicKeys([]string{publicKey}, extraKeys)
+	}
+	return publicKeys, keyInputs, nil
+}
+
+func buildHostSettings(programOptions *options, hosts []string, hostSpecs map[string]appconfig.HostSpec, hostPasswords map[string]string, publicKeys map[string][]string, keyInputs map[string]string) map[string]hostSettings {
+	settings := make(map[string]hostSettings, len(hosts))
+	for _, host := range hosts {
+		hostSetting := hostSettings{
+			User:     programOptions.User,
+			Password: programOptions.Password,
+			KeyInput: keyInputs[host],
+		}
+		if hostKeys := publicKeys[host]; len(hostKeys) > 0 {
+			hostSetting.PublicKey = hostKeys[0]
+			hostSetting.ExtraPublicKeys = hostKeys[1:]
+		}
+		if userName := strings.TrimSpace(hostSpecs[host].User); userName != "" {
+			hostSetting.User = userName
+		}
+		if hostPassword, ok := hostPasswords[host]; ok {
+			hostSetting.Password = hostPassword
+		}
+		settings[host] = hostSetting
+	}
+	return settings
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+func TestResolveTargetHostsMergesHostSpecs(t *testing.T) {
+	programOptions := &options{
+		Port:    22,
+		Servers: "web1,db1:2222",
+		Hosts: []appconfig.HostSpec{
+			{Address: "db1", Port: 2222, User: "postgres"},
+			{Address: "cache1"},
+		},
+	}
+
+	hosts, hostSpecs, err := resolveTargetHosts(programOptions, []string{"queue1"})
+	if err != nil {
+		t.Fatalf("resolveTargetHosts() error = %v", err)
+	}
+	if strings.Join(hosts, ",") != "cache1:22,db1:2222,queue1:22,web1:22" {
+		t.Fatalf("hosts = %v", hosts)
+	}
+	if hostSpecs["db1:2222"].User != "postgres" {
+		t.Fatalf("host specs = %+v", hostSpecs)
+	}
+
+	programOptions.Hosts = append(programOptions.Hosts, appconfig.HostSpec{Address: "cache1:22"})
+	if _, _, err := resolveTargetHosts(programOptions, nil); err == nil {
+		t.Fatalf("expected duplicate hosts entry error")
+	}
+}
+
+func TestHostSpecsCover(t *testing.T) {
+	userOf := func(hostSpec appconfig.HostSpec) string { return hostSpec.User }
+
+	programOptions := &options{Hosts: []appconfig.HostSpec{{Address: "a", User: "x"}, {Address: "b", User: "y"}}}
+	if !hostSpecsCover(programOptions, userOf) {
+		t.Fatalf("expected hosts to cover user")
+	}
+	programOptions.Hosts[1].User = ""
+	if hostSpecsCover(programOptions, userOf) {
+		t.Fatalf("host without user must not be covered")
+	}
+	programOptions.Hosts[1].User = "y"
+	programOptions.Servers = "c"
+	if hostSpecsCover(programOptions, userOf) {
+		t.Fatalf("flat servers must not be covered")
+	}
+}
+
+func TestRunUsesPerHostUserAndKeyFromJSONConfig(t *testing.T) {
+	captureWriters(t)
+
+	sharedKey := strings.TrimSpace(generateTestKey(t))
+	hostKey := strings.TrimSpace(generateTestKey(t))
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	configContent, err := json.Marshal(map[string]any{
+		"password":              "password",
+		"key":                   sharedKey,
+		"insecureIgnoreHostKey": true,
+		"timeout":               1,
+		"hosts": []any{
+			map[string]any{"address": "127.0.0.1", "port": 1, "user": "root", "key": hostKey},
+			map[string]any{"address": "127.0.0.2:1", "user": "deploy"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("encode config: %v", err)
+	}
+	if err := os.WriteFile(configPath, configContent, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	var dialsMu sync.Mutex
+	dialedUsers := map[string]string{}
+	stubSSHDialHook(t, func(_ string, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+		dialsMu.Lock()
+		dialedUsers[address] = clientConfig.User
+		dialsMu.Unlock()
+		return nil, errors.New("dial refused")
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--config", configPath})
+	err = run(capturedRuntimeIO())
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != 1 {
+		t.Fatalf("run() error = %v, want host failure status", err)
+	}
+	if dialedUsers["127.0.0.1:1"] != "root" || dialedUsers["127.0.0.2:1"] != "deploy" {
+		t.Fatalf("dialed users = %v", dialedUsers)
+	}
+}
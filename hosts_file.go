@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// hostsFileSkippedNames are the entries every /etc/hosts carries for the
+// machine itself and for IPv6 multicast groups.
+var hostsFileSkippedNames = []string{"localhost", "localhost.localdomain", "broadcasthost"}
+
+// readHostsFile reads an /etc/hosts style file (--hosts-file) and returns the
+// canonical name of every entry, so a jump box's name entries can serve as
+// the inventory.
+func readHostsFile(path string) ([]string, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolve hosts file path: %w", err)
+	}
+	hostsFile, err := os.Open(expandedPath) // #nosec G304 -- hosts file path is explicit user input
+	if err != nil {
+		return nil, fmt.Errorf("open hosts file: %w", err)
+	}
+	defer hostsFile.Close()
+
+	entries, err := parseHostsFile(hostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read hosts file %q: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseHostsFile returns the first name after the address on every line, in
+// file order and without repeats. Aliases are ignored, so a host listed with
+// its FQDN and short name is targeted once. Comments, lines without a valid
+// address, loopback, unspecified and multicast addresses, and the localhost
+// and ip6-* names are skipped.
+func parseHostsFile(reader io.Reader) ([]string, error) {
+	var entries []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		address, err := netip.ParseAddr(fields[0])
+		if err != nil || address.IsLoopback() || address.IsUnspecified() || address.IsMulticast() {
+			continue
+		}
+		name := fields[1]
+		if hostsFileNameSkipped(name) || slices.Contains(entries, name) {
+			continue
+		}
+		entries = append(entries, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func hostsFileNameSkipped(name string) bool {
+	lowerName := strings.ToLower(name)
+	return slices.Contains(hostsFileSkippedNames, lowerName) || strings.HasPrefix(lowerName, "ip6-")
+}
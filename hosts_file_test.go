@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseHostsFileSkipsLocalEntries(t *testing.T) {
+	content := `# Static table lookup for hostnames.
+127.0.0.1	localhost
+127.0.1.1	jumpbox.example.com jumpbox
+::1		localhost ip6-localhost ip6-loopback
+fe00::0		ip6-localnet
+ff02::1		ip6-allnodes
+0.0.0.0		blocked.example.com
+
+10.0.0.11	app01.example.com app01   # rack A12
+10.0.0.12	app02.example.com
+fd00::13	app03.example.com
+10.0.0.21	app01.example.com
+not-an-ip	bogus
+10.0.0.30
+`
+	entries, err := parseHostsFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseHostsFile() error = %v", err)
+	}
+	if want := []string{"app01.example.com", "app02.example.com", "app03.example.com"}; !slices.Equal(entries, want) {
+		t.Fatalf("entries = %q, want %q", entries, want)
+	}
+}
+
+func TestReadHostsFileTargetsResolveWithServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("10.0.0.11 app01\n10.0.0.12 app02\n"), 0o600); err != nil {
+		t.Fatalf("write hosts file: %v", err)
+	}
+	entries, err := readHostsFile(path)
+	if err != nil {
+		t.Fatalf("readHostsFile() error = %v", err)
+	}
+
+	programOptions := &options{Servers: "app02,db01", HostsFile: path, Port: 22}
+	hosts, _, err := resolveTargetHosts(programOptions, entries)
+	if err != nil {
+		t.Fatalf("resolveTargetHosts() error = %v", err)
+	}
+	if want := []string{"app01:22", "app02:22", "db01:22"}; !slices.Equal(hosts, want) {
+		t.Fatalf("hosts = %q, want %q", hosts, want)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ipsBlockThreshold is the number of suspicious dial failures in a row
+	// after which the run slows down.
+	ipsBlockThreshold  = 3
+	ipsInitialSlowdown = 2 * time.Second
+	ipsMaxSlowdown     = time.Minute
+)
+
+// ipsBlockFragments are dial errors that fail2ban, DenyHosts or sshguard
+// cause once they block the source address: the TCP connection is reset, or
+// sshd (tcp wrappers) closes it before the version exchange.
+var ipsBlockFragments = []string{
+	"connection reset by peer",
+	"handshake failed: eof",
+	"kex_exchange_identification",
+}
+
+var ipsGuardSleep = time.Sleep
+
+// ipsGuard watches dial failures for signs that an intrusion prevention
+// system is banning this machine. Once ipsBlockThreshold of them happen in a
+// row it warns and spaces out further connections, doubling the gap on each
+// further block; --ban-pause also pauses the run once so a ban can expire.
+type ipsGuard struct {
+	mu          sync.Mutex
+	consecutive int
+	slowdown    time.Duration
+	warned      bool
+	banPause    time.Duration
+	lastDial    time.Time
+}
+
+var (
+	ipsGuardMu     sync.Mutex
+	activeIPSGuard = &ipsGuard{}
+)
+
+// configureIPSGuard resets the guard for a run and sets the one-off pause
+// taken when a ban is first suspected (0 disables it). The returned function
+// resets it again.
+func configureIPSGuard(banPause time.Duration) (func(), error) {
+	if banPause < 0 {
+		return nil, fmt.Errorf("ban pause must not be negative, got %s", banPause)
+	}
+	ipsGuardMu.Lock()
+	activeIPSGuard = &ipsGuard{banPause: banPause}
+	ipsGuardMu.Unlock()
+	return func() {
+		ipsGuardMu.Lock()
+		activeIPSGuard = &ipsGuard{}
+		ipsGuardMu.Unlock()
+	}, nil
+}
+
+func currentIPSGuard() *ipsGuard {
+	ipsGuardMu.Lock()
+	defer ipsGuardMu.Unlock()
+	return activeIPSGuard
+}
+
+func looksLikeIPSBlock(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range ipsBlockFragments {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// suspectsBan reports whether a ban has been suspected during this run.
+func (guard *ipsGuard) suspectsBan() bool {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+	return guard.warned
+}
+
+// wait keeps the slowdown between consecutive connections once a block is
+// suspected.
+func (guard *ipsGuard) wait() {
+	guard.mu.Lock()
+	var delay time.Duration
+	if guard.slowdown > 0 && !guard.lastDial.IsZero() {
+		delay = guard.slowdown - connectionRateNow().Sub(guard.lastDial)
+	}
+	guard.mu.Unlock()
+	if delay > 0 {
+		ipsGuardSleep(delay)
+	}
+}
+
+// record counts the outcome of a dial to host. A successful dial ends the
+// streak but keeps the slowdown, since IPS ban counters outlive one success.
+func (guard *ipsGuard) record(host string, err error) {
+	guard.mu.Lock()
+	guard.lastDial = connectionRateNow()
+	if !looksLikeIPSBlock(err) {
+		guard.consecutive = 0
+		guard.mu.Unlock()
+		return
+	}
+	guard.consecutive++
+	if guard.consecutive < ipsBlockThreshold {
+		guard.mu.Unlock()
+		return
+	}
+	guard.slowdown = min(max(guard.slowdown*2, ipsInitialSlowdown), ipsMaxSlowdown)
+	slowdown, firstWarning, banPause := guard.slowdown, !guard.warned, guard.banPause
+	guard.warned = true
+	count := guard.consecutive
+	guard.mu.Unlock()
+
+	message := fmt.Sprintf("%d connections in a row were reset or closed during the handshake (last: %s); an IPS such as fail2ban, DenyHosts or sshguard may be banning your source IP. Slowing down to one connection every %s", count, host, slowdown)
+	emitEvent(runEvent{Event: "ips_block_suspected", Host: host, Message: message})
+	if !firstWarning {
+		outputPrintf("WARNING: connections still reset (last: %s); slowing down to one connection every %s.\n", host, slowdown)
+		return
+	}
+	outputPrintf("WARNING: %s.\n", message)
+	if banPause > 0 {
+		outputPrintf("WARNING: pausing the run for %s (--ban-pause) so a ban can expire.\n", banPause)
+		ipsGuardSleep(banPause)
+	}
+}
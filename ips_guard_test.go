@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDialSSHSlowsDownAfterRepeatedResets(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+	originalNow, originalSleep := connectionRateNow, ipsGuardSleep
+	connectionRateNow = func() time.Time { return clock }
+	ipsGuardSleep = func(delay time.Duration) {
+		sleeps = append(sleeps, delay)
+		clock = clock.Add(delay)
+	}
+	t.Cleanup(func() { connectionRateNow, ipsGuardSleep = originalNow, originalSleep })
+	restore, err := configureIPSGuard(10 * time.Minute)
+	if err != nil {
+		t.Fatalf("configureIPSGuard() error = %v", err)
+	}
+	t.Cleanup(restore)
+
+	dialErr := errors.New("read tcp 10.0.0.1:50000->10.0.0.9:22: read: connection reset by peer")
+	stubSSHDialHook(t, func(_, _ string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		return nil, dialErr
+	})
+
+	for range 2 {
+		_, _ = dialSSH("tcp", "app01:22", &ssh.ClientConfig{})
+	}
+	if len(sleeps) != 0 || strings.Contains(outputBuffer.String(), "WARNING") {
+		t.Fatalf("slowed down before the threshold: sleeps=%v output=%q", sleeps, outputBuffer.String())
+	}
+
+	_, _ = dialSSH("tcp", "app03:22", &ssh.ClientConfig{})
+	if len(sleeps) != 1 || sleeps[0] != 10*time.Minute {
+		t.Fatalf("sleeps after threshold = %v, want the ban pause", sleeps)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "3 connections in a row") || !strings.Contains(output, "fail2ban") || !strings.Contains(output, "every 2s") {
+		t.Fatalf("warning missing: %q", output)
+	}
+
+	// The ban pause already spaced this dial out.
+	_, _ = dialSSH("tcp", "app04:22", &ssh.ClientConfig{})
+	if len(sleeps) != 1 {
+		t.Fatalf("sleeps = %v, want no slowdown right after the ban pause", sleeps)
+	}
+	_, _ = dialSSH("tcp", "app05:22", &ssh.ClientConfig{})
+	if len(sleeps) != 2 || sleeps[1] != 4*time.Second {
+		t.Fatalf("sleeps = %v, want a 4s slowdown before the next dial", sleeps)
+	}
+	if !strings.Contains(outputBuffer.String(), "still reset (last: app04:22); slowing down to one connection every 4s") {
+		t.Fatalf("escalation missing: %q", outputBuffer.String())
+	}
+	if strings.Count(outputBuffer.String(), "--ban-pause") != 1 {
+		t.Fatalf("ban pause taken more than once: %q", outputBuffer.String())
+	}
+}
+
+func TestIPSGuardIgnoresOtherFailures(t *testing.T) {
+	guard := &ipsGuard{}
+	for _, err := range []error{errors.New("dial tcp: connection refused"), errors.New("ssh: handshake failed: EOF"), nil, errors.New("i/o timeout"), errors.New("ssh: handshake failed: EOF"), errors.New("ssh: handshake failed: EOF")} {
+		guard.record("app01:22", err)
+	}
+	if guard.slowdown != 0 || guard.consecutive != 2 {
+		t.Fatalf("guard = %+v, want the streak broken by other outcomes", guard)
+	}
+	if _, err := configureIPSGuard(-time.Second); err == nil {
+		t.Fatalf("negative ban pause accepted")
+	}
+}
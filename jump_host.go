@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultJumpConnections is how many SSH connections to the jump host a run
+// opens at most (--jump-connections).
+const defaultJumpConnections = 2
+
+// jumpPool carries the built-in client's connections through a jump host
+// (--jump). Targets are reached as forwarded channels over a few shared
+// bastion connections instead of one bastion login per target, which keeps
+// a large run under the bastion's MaxStartups limit.
+type jumpPool struct {
+	mu      sync.Mutex
+	address string
+	user    string
+	size    int
+	clients []*jumpClient
+}
+
+// jumpClient is one connection to the jump host and the number of target
+// connections open over it.
+type jumpClient struct {
+	client  *ssh.Client
+	streams int
+	closed  atomic.Bool
+}
+
+var (
+	activeJumpPoolMu sync.Mutex
+	// activeJumpPool is nil when hosts are dialed directly.
+	activeJumpPool *jumpPool
+)
+
+// configureJumpHost routes every built-in SSH connection through the jump
+// host spec, [user@]host[:port], over at most connections bastion
+// connections. The returned function closes them.
+func configureJumpHost(spec string, connections int) (func(), error) {
+	trimmedSpec := strings.TrimSpace(spec)
+	if trimmedSpec == "" {
+		return func() {}, nil
+	}
+	if connections < 1 {
+		return nil, fmt.Errorf("--jump-connections must be at least 1, got %d", connections)
+	}
+	user, host, hasUser := strings.Cut(trimmedSpec, "@")
+	if !hasUser {
+		user, host = "", trimmedSpec
+	}
+	if hasUser && strings.TrimSpace(user) == "" {
+		return nil, fmt.Errorf("--jump %q has an empty user", spec)
+	}
+	address, err := normalizeHost(host, defaultSSHPort)
+	if err != nil {
+		return nil, fmt.Errorf("--jump %q: %w", spec, err)
+	}
+
+	pool := &jumpPool{address: address, user: user, size: connections}
+	activeJumpPoolMu.Lock()
+	activeJumpPool = pool
+	activeJumpPoolMu.Unlock()
+	return func() {
+		activeJumpPoolMu.Lock()
+		activeJumpPool = nil
+		activeJumpPoolMu.Unlock()
+		pool.closeAll()
+	}, nil
+}
+
+func currentJumpPool() *jumpPool {
+	activeJumpPoolMu.Lock()
+	defer activeJumpPoolMu.Unlock()
+	return activeJumpPool
+}
+
+// Dial opens a connection to address through the jump host. It logs in to
+// the jump host with clientConfig, as the --jump user when one is given.
+// A bastion connection that dropped is replaced once.
+func (pool *jumpPool) Dial(address string, clientConfig *ssh.ClientConfig) (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		bastion, err := pool.acquire(clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.Background(), func() {}
+		if clientConfig.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, clientConfig.Timeout)
+		}
+		connection, err := bastion.client.DialContext(ctx, "tcp", address)
+		cancel()
+		if err == nil {
+			return &jumpConn{Conn: connection, release: func() { pool.release(bastion) }}, nil
+		}
+		pool.release(bastion)
+		// A refused forward leaves the bastion connection working; one that
+		// no longer answers a keepalive has dropped.
+		if _, _, keepaliveErr := bastion.client.SendRequest("keepalive@openssh.com", true, nil); keepaliveErr != nil {
+			bastion.closed.Store(true)
+		}
+		if !bastion.closed.Load() || attempt > 0 {
+			return nil, fmt.Errorf("jump host %s: %w", pool.address, err)
+		}
+	}
+}
+
+// acquire picks the open bastion connection with the fewest streams, and
+// opens another one while every open connection is in use and the pool has
+// room.
+func (pool *jumpPool) acquire(clientConfig *ssh.ClientConfig) (*jumpClient, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.clients = slices.DeleteFunc(pool.clients, func(bastion *jumpClient) bool { return bastion.closed.Load() })
+	var least *jumpClient
+	for _, bastion := range pool.clients {
+		if least == nil || bastion.streams < least.streams {
+			least = bastion
+		}
+	}
+	if least == nil || (least.streams > 0 && len(pool.clients) < pool.size) {
+		bastion, err := pool.dialBastion(clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		pool.clients = append(pool.clients, bastion)
+		least = bastion
+	}
+	least.streams++
+	return least, nil
+}
+
+func (pool *jumpPool) dialBastion(clientConfig *ssh.ClientConfig) (*jumpClient, error) {
+	bastionConfig := *clientConfig
+	if pool.user != "" {
+		bastionConfig.User = pool.user
+	}
+	// The bastion's banner is not the target's.
+	bastionConfig.BannerCallback = nil
+	waitForConnectionSlot()
+	client, err := sshDial("tcp", pool.address, &bastionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %w", pool.address, err)
+	}
+	bastion := &jumpClient{client: client}
+	go func() {
+		_ = client.Wait()
+		bastion.closed.Store(true)
+	}()
+	return bastion, nil
+}
+
+func (pool *jumpPool) release(bastion *jumpClient) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	bastion.streams--
+}
+
+func (pool *jumpPool) closeAll() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, bastion := range pool.clients {
+		_ = bastion.client.Close()
+	}
+	pool.clients = nil
+}
+
+// jumpConn is a target connection forwarded by the jump host; closing it
+// frees its place on the bastion connection.
+type jumpConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+func (connection *jumpConn) Close() error {
+	err := connection.Conn.Close()
+	connection.closeOnce.Do(connection.release)
+	return err
+}
+
+// validateJumpOptions rejects --jump where connections do not go through the
+// built-in client's dialer.
+func validateJumpOptions(programOptions *options) error {
+	if strings.TrimSpace(programOptions.Jump) == "" {
+		return nil
+	}
+	if programOptions.UseOpenSSH {
+		return errors.New("--jump is for the built-in client; with --use-openssh set ProxyJump in ~/.ssh/config instead")
+	}
+	if transport := strings.TrimSpace(programOptions.Transport); transport != "" && transport != defaultTransportName {
+		return errors.New("--jump cannot be combined with --transport " + transport)
+	}
+	if programOptions.WaitUp > 0 {
+		return errors.New("--wait-up probes hosts over TCP and cannot be combined with --jump")
+	}
+	if order, _ := parseHostOrder(programOptions.Order); order == hostOrderByLatency {
+		return errors.New("--order by-latency probes hosts over TCP and cannot be combined with --jump")
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newEchoBastionClient returns a client connected to an in-memory jump host
+// that records the destination of every forwarded channel and echoes what is
+// written to it.
+func newEchoBastionClient(t *testing.T, clientConfig *ssh.ClientConfig, record func(user, destination string)) *ssh.Client {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	clientConn, serverConn, closeSocketPair := newSocketPair(t)
+	t.Cleanup(closeSocketPair)
+	go func() {
+		serverConnection, channels, requests, err := ssh.NewServerConn(serverConn, serverConfig)
+		if err != nil {
+			return
+		}
+		defer serverConnection.Close()
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			if newChannel.ChannelType() != "direct-tcpip" {
+				_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+				continue
+			}
+			var destination struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err := ssh.Unmarshal(newChannel.ExtraData(), &destination); err != nil {
+				_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			record(serverConnection.User(), destination.Host)
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go ssh.DiscardRequests(channelRequests)
+			go func() {
+				defer channel.Close()
+				_, _ = io.Copy(channel, channel)
+			}()
+		}
+	}()
+
+	connection, channels, requests, err := ssh.NewClientConn(clientConn, "bastion", clientConfig)
+	if err != nil {
+		t.Fatalf("connect to bastion: %v", err)
+	}
+	client := ssh.NewClient(connection, channels, requests)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestJumpPoolSharesBastionConnectionsAcrossTargets(t *testing.T) {
+	var mu sync.Mutex
+	var bastionDials []string
+	var forwarded []string
+	var bastions []*ssh.Client
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client := newEchoBastionClient(t, config, func(user, destination string) {
+			mu.Lock()
+			forwarded = append(forwarded, user+"->"+destination)
+			mu.Unlock()
+		})
+		mu.Lock()
+		bastionDials = append(bastionDials, config.User+"@"+address)
+		bastions = append(bastions, client)
+		mu.Unlock()
+		return client, nil
+	})
+	restore, err := configureJumpHost("jump@bastion.example.com", 2)
+	if err != nil {
+		t.Fatalf("configureJumpHost() error = %v", err)
+	}
+	t.Cleanup(restore)
+	pool := currentJumpPool()
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("password")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- in-memory test server
+
+	var connections []io.ReadWriteCloser
+	for _, target := range []string{"app01:22", "app02:22", "app03:22", "app04:22"} {
+		connection, err := pool.Dial(target, clientConfig)
+		if err != nil {
+			t.Fatalf("Dial(%s) error = %v", target, err)
+		}
+		connections = append(connections, connection)
+	}
+	if _, err := connections[2].Write([]byte("ping")); err != nil {
+		t.Fatalf("write through bastion: %v", err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(connections[2], reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("read through bastion = %q, %v", reply, err)
+	}
+
+	mu.Lock()
+	if strings.Join(bastionDials, ",") != "jump@bastion.example.com:22,jump@bastion.example.com:22" {
+		t.Fatalf("bastion dials = %v, want two shared connections", bastionDials)
+	}
+	if len(forwarded) != 4 || forwarded[3] != "jump->app04" {
+		t.Fatalf("forwarded channels = %v", forwarded)
+	}
+	firstBastion := bastions[0]
+	mu.Unlock()
+
+	// A dropped bastion connection is replaced by the next dial.
+	_ = firstBastion.Close()
+	_ = firstBastion.Wait()
+	for _, connection := range connections {
+		_ = connection.Close()
+	}
+	if _, err := pool.Dial("app05:22", clientConfig); err != nil {
+		t.Fatalf("Dial after bastion drop error = %v", err)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, bastion := range pool.clients {
+		if bastion.client == firstBastion {
+			t.Fatal("closed bastion connection still in the pool")
+		}
+	}
+}
+
+func TestConfigureJumpHostRejectsBadSpecs(t *testing.T) {
+	for _, spec := range []string{"@bastion", "bastion:notaport"} {
+		if _, err := configureJumpHost(spec, 2); err == nil {
+			t.Fatalf("configureJumpHost(%q) error = nil", spec)
+		}
+	}
+	if _, err := configureJumpHost("bastion", 0); err == nil {
+		t.Fatal("configureJumpHost with 0 connections error = nil")
+	}
+}
+
+func TestValidateJumpOptions(t *testing.T) {
+	testCases := []struct {
+		programOptions options
+		wantErr        string
+	}{
+		{options{Jump: "bastion"}, ""},
+		{options{Jump: "bastion", UseOpenSSH: true}, "ProxyJump"},
+		{options{Jump: "bastion", Transport: "ssm"}, "--transport ssm"},
+		{options{Jump: "bastion", Order: "by-latency"}, "by-latency"},
+	}
+	for _, testCase := range testCases {
+		err := validateJumpOptions(&testCase.programOptions)
+		if testCase.wantErr == "" {
+			if err != nil {
+				t.Fatalf("validateJumpOptions(%+v) error = %v", testCase.programOptions, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), testCase.wantErr) {
+			t.Fatalf("validateJumpOptions(%+v) error = %v, want %q", testCase.programOptions, err, testCase.wantErr)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var currentLocalUser = defaultCurrentLocalUser
+var keyCommentNow = time.Now
+
+// stampPublicKeyComment rewrites the comment of an authorized_keys line using
+// commentTemplate. Supported placeholders: {user} (local operator), {date}
+// (UTC, YYYY-MM-DD), {run} (the run ID) and {comment} (the key's original
+// comment, for appending).
+func stampPublicKeyComment(publicKey, commentTemplate string) (string, error) {
+	if strings.TrimSpace(commentTemplate) == "" {
+		return publicKey, nil
+	}
+
+	parsedKey, originalComment, keyOptions, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", fmt.Errorf("invalid public key format: %w", err)
+	}
+
+	replacer := strings.NewReplacer(
+		"{user}", currentLocalUser(),
+		"{date}", keyCommentNow().UTC().Format(time.DateOnly),
+		"{run}", currentRunID(),
+		"{comment}", originalComment,
+	)
+	stampedComment := strings.Join(strings.Fields(replacer.Replace(commentTemplate)), " ")
+
+	lineParts := make([]string, 0, 4)
+	if len(keyOptions) > 0 {
+		lineParts = append(lineParts, strings.Join(keyOptions, ","))
+	}
+	lineParts = append(lineParts, parsedKey.Type(), publicKeyBlob(parsedKey))
+	if stampedComment != "" {
+		lineParts = append(lineParts, stampedComment)
+	}
+	return strings.Join(lineParts, " "), nil
+}
+
+func publicKeyBlob(publicKey ssh.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(publicKey.Marshal())
+}
+
+func defaultCurrentLocalUser() string {
+	if currentUser, err := user.Current(); err == nil && strings.TrimSpace(currentUser.Username) != "" {
+		return currentUser.Username
+	}
+	if userName := strings.TrimSpace(os.Getenv("USER")); userName != "" {
+		return userName
+	}
+	return "unknown"
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func stubKeyCommentContext(t *testing.T, userName string, now time.Time) {
+	t.Helper()
+
+	originalUser := currentLocalUser
+	originalNow := keyCommentNow
+	currentLocalUser = func() string { return userName }
+	keyCommentNow = func() time.Time { return now }
+	t.Cleanup(func() {
+		currentLocalUser = originalUser
+		keyCommentNow = originalNow
+	})
+}
+
+func TestStampPublicKeyCommentRewrite(t *testing.T) {
+	stubKeyCommentContext(t, "alice", time.Date(2025, 3, 14, 23, 0, 0, 0, time.UTC))
+
+	publicKey := strings.TrimSpace(generateTestKey(t)) + " old-comment"
+	stampedKey, err := stampPublicKeyComment(publicKey, "{user} CHG-1234 {date}")
+	if err != nil {
+		t.Fatalf("stampPublicKeyComment() error = %v", err)
+	}
+	if !strings.HasSuffix(stampedKey, " alice CHG-1234 2025-03-14") {
+		t.Fatalf("stamped key = %q, want rewritten comment", stampedKey)
+	}
+	if strings.Contains(stampedKey, "old-comment") {
+		t.Fatalf("stamped key kept original comment: %q", stampedKey)
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(stampedKey)); err != nil {
+		t.Fatalf("stamped key is not a valid authorized key: %v", err)
+	}
+}
+
+func TestStampPublicKeyCommentAppendKeepsOptions(t *testing.T) {
+	stubKeyCommentContext(t, "bob", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	publicKey := `no-pty,from="10.0.0.0/8" ` + strings.TrimSpace(generateTestKey(t)) + " laptop"
+	stampedKey, err := stampPublicKeyComment(publicKey, "{comment} added-by={user}")
+	if err != nil {
+		t.Fatalf("stampPublicKeyComment() error = %v", err)
+	}
+	if !strings.HasPrefix(stampedKey, `no-pty,from="10.0.0.0/8" ssh-ed25519 `) {
+		t.Fatalf("stamped key lost options: %q", stampedKey)
+	}
+	if !strings.HasSuffix(stampedKey, " laptop added-by=bob") {
+		t.Fatalf("stamped key = %q, want appended comment", stampedKey)
+	}
+}
+
+func TestStampPublicKeyCommentEmptyTemplateKeepsKey(t *testing.T) {
+	publicKey := strings.TrimSpace(generateTestKey(t)) + " keep-me"
+	stampedKey, err := stampPublicKeyComment(publicKey, "  ")
+	if err != nil {
+		t.Fatalf("stampPublicKeyComment() error = %v", err)
+	}
+	if stampedKey != publicKey {
+		t.Fatalf("stamped key = %q, want unchanged %q", stampedKey, publicKey)
+	}
+}
+
+func TestInstallKeyScriptSendsBlobWhenReplacingComment(t *testing.T) {
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	script, err := (installKeyOperation{}).Script(remoteOperationInput{PublicKey: publicKey, ReplaceKeyComment: true})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+
+	stdinLines := strings.Split(strings.TrimSuffix(script.Stdin, "\n"), "\n")
+	if len(stdinLines) != 2 || stdinLines[0] != publicKey || stdinLines[1] != strings.Fields(publicKey)[1] {
+		t.Fatalf("stdin = %q, want key line followed by key blob", script.Stdin)
+	}
+
+	result, err := (installKeyOperation{}).ParseResult(authorizedKeyCommentUpdatedMarker + "\n")
+	if err != nil || !result.Changed {
+		t.Fatalf("ParseResult(comment updated) = %+v, %v; want changed", result, err)
+	}
+}
+
+func TestStampPublicKeyCommentRunID(t *testing.T) {
+	stubKeyCommentContext(t, "alice", time.Date(2025, 3, 14, 23, 0, 0, 0, time.UTC))
+	defer setActiveRunID("20250314T230000Z-0a1b2c3d")()
+
+	stampedKey, err := stampPublicKeyComment(strings.TrimSpace(generateTestKey(t)), "{user} run {run}")
+	if err != nil {
+		t.Fatalf("stampPublicKeyComment() error = %v", err)
+	}
+	if !strings.HasSuffix(stampedKey, " alice run 20250314T230000Z-0a1b2c3d") {
+		t.Fatalf("stamped key = %q, want the run ID in the comment", stampedKey)
+	}
+}
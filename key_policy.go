@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keyPolicy restricts which public keys may be installed (--key-policy,
+// KEY_POLICY), so a weak key cannot be pushed to the whole fleet by mistake.
+type keyPolicy struct {
+	minRSABits       int
+	forbiddenFamily  []string // "dsa", "ecdsa", "rsa"
+	commentNewerThan time.Time
+}
+
+// keyFamilies maps key types to the family names used by no-<family> rules.
+var keyFamilies = map[string]string{
+	ssh.KeyAlgoRSA:         "rsa",
+	ssh.InsecureKeyAlgoDSA: "dsa",
+	ssh.KeyAlgoECDSA256:    "ecdsa",
+	ssh.KeyAlgoECDSA384:    "ecdsa",
+	ssh.KeyAlgoECDSA521:    "ecdsa",
+	ssh.KeyAlgoSKECDSA256:  "ecdsa",
+}
+
+var keyCommentDatePattern = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b`)
+
+// parseKeyPolicy parses comma-separated rules: min-rsa-bits=<n>, no-dsa,
+// no-ecdsa, no-rsa and comment-newer-than=<YYYY-MM-DD>. Empty means no policy.
+func parseKeyPolicy(value string) (keyPolicy, error) {
+	var policy keyPolicy
+	for rawRule := range strings.SplitSeq(value, ",") {
+		rule := strings.ToLower(strings.TrimSpace(rawRule))
+		if rule == "" {
+			continue
+		}
+		name, argument, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min-rsa-bits":
+			bits, err := strconv.Atoi(argument)
+			if err != nil || bits <= 0 {
+				return keyPolicy{}, fmt.Errorf("invalid key policy rule %q: want min-rsa-bits=<bits>", rawRule)
+			}
+			policy.minRSABits = bits
+		case "no-dsa", "no-ecdsa", "no-rsa":
+			family := strings.TrimPrefix(name, "no-")
+			if !slices.Contains(policy.forbiddenFamily, family) {
+				policy.forbiddenFamily = append(policy.forbiddenFamily, family)
+			}
+		case "comment-newer-than":
+			date, err := time.Parse(time.DateOnly, argument)
+			if err != nil {
+				return keyPolicy{}, fmt.Errorf("invalid key policy rule %q: want comment-newer-than=YYYY-MM-DD", rawRule)
+			}
+			policy.commentNewerThan = date
+		default:
+			return keyPolicy{}, fmt.Errorf("unknown key policy rule %q (valid: min-rsa-bits=<n>, no-dsa, no-ecdsa, no-rsa, comment-newer-than=<YYYY-MM-DD>)", rawRule)
+		}
+	}
+	return policy, nil
+}
+
+// check returns an error naming the first rule publicKey breaks.
+func (policy keyPolicy) check(publicKey string) error {
+	parsedKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return fmt.Errorf("invalid public key format: %w", err)
+	}
+	if family, ok := keyFamilies[parsedKey.Type()]; ok && slices.Contains(policy.forbiddenFamily, family) {
+		return fmt.Errorf("key policy forbids %s keys (no-%s)", parsedKey.Type(), family)
+	}
+	if policy.minRSABits > 0 {
+		if cryptoKey, ok := parsedKey.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < policy.minRSABits {
+				return fmt.Errorf("key policy requires RSA keys of at least %d bits, key has %d (min-rsa-bits)", policy.minRSABits, rsaKey.N.BitLen())
+			}
+		}
+	}
+	if !policy.commentNewerThan.IsZero() {
+		match := keyCommentDatePattern.FindStringSubmatch(comment)
+		if match == nil {
+			return fmt.Errorf("key policy requires a YYYY-MM-DD date after %s in the key comment, comment is %q (comment-newer-than)", policy.commentNewerThan.Format(time.DateOnly), comment)
+		}
+		date, err := time.Parse(time.DateOnly, match[1])
+		if err != nil || !date.After(policy.commentNewerThan) {
+			return fmt.Errorf("key policy requires a key comment dated after %s, comment has %s (comment-newer-than)", policy.commentNewerThan.Format(time.DateOnly), match[1])
+		}
+	}
+	return nil
+}
+
+// checkDesiredStatesKeyPolicy applies the key policy to every key an apply
+// manifest would install.
+func checkDesiredStatesKeyPolicy(policyValue string, states []desiredHostState) error {
+	policy, err := parseKeyPolicy(policyValue)
+	if err != nil {
+		return err
+	}
+	checkedKeys := map[string]bool{}
+	for _, state := range states {
+		for _, publicKey := range state.Keys {
+			if checkedKeys[publicKey] {
+				continue
+			}
+			checkedKeys[publicKey] = true
+			if err := policy.check(publicKey); err != nil {
+				return fmt.Errorf("user %q on %s: %w", state.User, state.Host, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func authorizedKeyLine(t *testing.T, publicKey ssh.PublicKey, comment string) string {
+	t.Helper()
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))) + " " + comment
+}
+
+func TestKeyPolicyCheck(t *testing.T) {
+	ecdsaPrivateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ecdsa key: %v", err)
+	}
+	ecdsaKey, err := ssh.NewPublicKey(&ecdsaPrivateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("convert ecdsa key: %v", err)
+	}
+	rsaKey := authorizedKeyLine(t, newTestHostKey(t, "rsa2048"), "ops@example 2025-03-01")
+	ed25519Key := authorizedKeyLine(t, newTestHostKey(t, "ed25519"), "ops@example rotated 2025-03-01")
+
+	tests := []struct {
+		policy  string
+		key     string
+		wantErr string
+	}{
+		{policy: "", key: rsaKey},
+		{policy: "min-rsa-bits=3072", key: rsaKey, wantErr: "at least 3072 bits, key has 2048"},
+		{policy: "min-rsa-bits=3072", key: ed25519Key},
+		{policy: "no-dsa,no-ecdsa", key: authorizedKeyLine(t, ecdsaKey, "ops"), wantErr: "forbids ecdsa-sha2-nistp256 keys"},
+		{policy: "no-dsa,no-ecdsa", key: rsaKey},
+		{policy: "comment-newer-than=2025-01-01", key: ed25519Key},
+		{policy: "comment-newer-than=2025-03-01", key: ed25519Key, wantErr: "dated after 2025-03-01, comment has 2025-03-01"},
+		{policy: "comment-newer-than=2025-01-01", key: authorizedKeyLine(t, newTestHostKey(t, "ed25519"), "ops"), wantErr: "requires a YYYY-MM-DD date"},
+	}
+	for _, test := range tests {
+		policy, err := parseKeyPolicy(test.policy)
+		if err != nil {
+			t.Fatalf("parseKeyPolicy(%q) error = %v", test.policy, err)
+		}
+		err = policy.check(test.key)
+		if test.wantErr == "" && err != nil {
+			t.Fatalf("check(%q) error = %v", test.policy, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Fatalf("check(%q) error = %v, want %q", test.policy, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseKeyPolicyRejectsUnknownRules(t *testing.T) {
+	for _, value := range []string{"min-rsa-bits=big", "no-ed25519", "comment-newer-than=yesterday"} {
+		if _, err := parseKeyPolicy(value); err == nil {
+			t.Fatalf("parseKeyPolicy(%q) error = nil", value)
+		}
+	}
+}
+
+func TestResolveHostPublicKeysAppliesKeyPolicy(t *testing.T) {
+	programOptions := &options{
+		KeyInput:  authorizedKeyLine(t, newTestHostKey(t, "rsa2048"), "ops"),
+		KeyPolicy: "min-rsa-bits=4096",
+	}
+	_, _, err := resolveHostPublicKeys(programOptions, []string{"app01:22"}, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "app01:22: key policy requires RSA keys of at least 4096 bits") {
+		t.Fatalf("resolveHostPublicKeys() error = %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// repeatedFlag collects every occurrence of a flag that may be given more
+// than once, such as --key.
+type repeatedFlag struct {
+	values *[]string
+}
+
+func (listFlag repeatedFlag) String() string {
+	if listFlag.values == nil {
+		return ""
+	}
+	return strings.Join(*listFlag.values, ",")
+}
+
+func (listFlag repeatedFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("value must not be empty")
+	}
+	*listFlag.values = append(*listFlag.values, strings.TrimSpace(value))
+	return nil
+}
+
+func hasExtraKeySources(programOptions *options) bool {
+	return len(programOptions.KeyInputs) > 0 || len(programOptions.KeyFiles) > 0
+}
+
+// firstExtraKeyInput is the key input that stands in for KEY when only
+// --key/--key-file are given, for example to derive the identity file.
+func firstExtraKeyInput(programOptions *options) string {
+	if len(programOptions.KeyInputs) > 0 {
+		return programOptions.KeyInputs[0]
+	}
+	if len(programOptions.KeyFiles) > 0 {
+		return programOptions.KeyFiles[0]
+	}
+	return ""
+}
+
+// directoryKeySource looks up the keys of a user in an identity system, for
+// key inputs such as ldap:uid=alice that start with prefix.
+type directoryKeySource struct {
+	prefix string
+	lookup func(programOptions *options, query string) ([]string, error)
+}
+
+var directoryKeySources = []directoryKeySource{
+	{prefix: ldapKeyPrefix, lookup: lookupLDAPPublicKeys},
+	{prefix: ipaKeyPrefix, lookup: lookupIPAPublicKeys},
+	{prefix: keycloakKeyPrefix, lookup: lookupKeycloakPublicKeys},
+}
+
+var (
+	directoryKeysMu sync.Mutex
+	// directoryKeysOptions holds the options the directories are reached
+	// with; nil outside a run.
+	directoryKeysOptions *options
+	// directoryKeysCache keeps the keys found for each input, so an input
+	// shared by many hosts costs one lookup.
+	directoryKeysCache map[string][]string
+)
+
+// configureDirectoryKeySources lets key inputs name a user in the directories
+// configured in programOptions. The returned function clears them.
+func configureDirectoryKeySources(programOptions *options) func() {
+	directoryKeysMu.Lock()
+	directoryKeysOptions, directoryKeysCache = programOptions, map[string][]string{}
+	directoryKeysMu.Unlock()
+	return func() {
+		directoryKeysMu.Lock()
+		directoryKeysOptions, directoryKeysCache = nil, nil
+		directoryKeysMu.Unlock()
+	}
+}
+
+func isDirectoryKeyInput(keyInput string) bool {
+	trimmedInput := strings.TrimSpace(keyInput)
+	for _, source := range directoryKeySources {
+		if strings.HasPrefix(trimmedInput, source.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDirectoryPublicKeys returns the keys of the user a directory key
+// input names. Each input is looked up once per run.
+func resolveDirectoryPublicKeys(keyInput string) ([]string, error) {
+	trimmedInput := strings.TrimSpace(keyInput)
+	for _, source := range directoryKeySources {
+		query, ok := strings.CutPrefix(trimmedInput, source.prefix)
+		if !ok {
+			continue
+		}
+		directoryKeysMu.Lock()
+		defer directoryKeysMu.Unlock()
+		if publicKeys, ok := directoryKeysCache[trimmedInput]; ok {
+			return publicKeys, nil
+		}
+		programOptions := directoryKeysOptions
+		if programOptions == nil {
+			programOptions = &options{}
+		}
+		publicKeys, err := source.lookup(programOptions, strings.TrimSpace(query))
+		if err != nil {
+			return nil, err
+		}
+		if directoryKeysCache != nil {
+			directoryKeysCache[trimmedInput] = publicKeys
+		}
+		return publicKeys, nil
+	}
+	return nil, fmt.Errorf("%q does not name a user in a directory", keyInput)
+}
+
+// parseDirectoryPublicKeys checks the keys a directory returned for a user.
+func parseDirectoryPublicKeys(values []string) ([]string, error) {
+	var publicKeys []string
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		publicKey, err := parsePublicKeyFromRawInput(value)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
+
+// resolveExtraPublicKeys reads the keys given with --key and --key-file, in
+// that order, checks them against policy and stamps their comments.
+func resolveExtraPublicKeys(programOptions *options, policy keyPolicy) ([]string, error) {
+	var publicKeys []string
+	for index, keyInput := range programOptions.KeyInputs {
+		if isDirectoryKeyInput(keyInput) {
+			directoryKeys, err := resolveDirectoryPublicKeys(keyInput)
+			if err != nil {
+				return nil, fmt.Errorf("--key #%d: %w", index+1, err)
+			}
+			publicKeys = append(publicKeys, directoryKeys...)
+			continue
+		}
+		publicKey, err := resolvePublicKey(keyInput)
+		if err != nil {
+			return nil, fmt.Errorf("--key #%d: %w", index+1, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	for _, keyFile := range programOptions.KeyFiles {
+		fileKeys, err := readPublicKeysFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("--key-file %s: %w", keyFile, err)
+		}
+		publicKeys = append(publicKeys, fileKeys...)
+	}
+
+	for index, publicKey := range publicKeys {
+		if err := policy.check(publicKey); err != nil {
+			return nil, err
+		}
+		stampedKey, err := stampPublicKeyComment(publicKey, programOptions.KeyComment)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys[index] = stampedKey
+	}
+	return publicKeys, nil
+}
+
+// readPublicKeysFile reads every key in an authorized_keys style file; blank
+// lines and # comments are skipped.
+func readPublicKeysFile(path string) ([]string, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, err
+	}
+	fileHandle, err := os.Open(expandedPath) // #nosec G304 -- key file path comes from user input
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+
+	var publicKeys []string
+	scanner := bufio.NewScanner(fileHandle)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		publicKey, err := parsePublicKeyFromRawInput(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(publicKeys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return publicKeys, nil
+}
+
+// mergePublicKeys concatenates key lists and drops later copies of a key
+// already present, comparing fingerprints so a differing comment does not
+// count as a new key.
+func mergePublicKeys(keyLists ...[]string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, keyList := range keyLists {
+		for _, publicKey := range keyList {
+			fingerprint := publicKey
+			if parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey)); err == nil {
+				fingerprint = ssh.FingerprintSHA256(parsedKey)
+			}
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			merged = append(merged, publicKey)
+		}
+	}
+	return merged
+}
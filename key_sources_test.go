@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFlagsRepeatedKeySources(t *testing.T) {
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--key", "~/.ssh/id_ed25519.pub", "--key", "ssh-ed25519 AAAA team", "--key-file", "break-glass.pub"})
+	programOptions, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if !slices.Equal(programOptions.KeyInputs, []string{"~/.ssh/id_ed25519.pub", "ssh-ed25519 AAAA team"}) || !slices.Equal(programOptions.KeyFiles, []string{"break-glass.pub"}) {
+		t.Fatalf("KeyInputs = %q, KeyFiles = %q", programOptions.KeyInputs, programOptions.KeyFiles)
+	}
+}
+
+func TestResolveHostPublicKeysMergesKeySourcesByFingerprint(t *testing.T) {
+	ownKey := strings.TrimSpace(generateTestKey(t)) + " me@laptop"
+	breakGlassKey := strings.TrimSpace(generateTestKey(t)) + " break-glass"
+	teamKey := strings.TrimSpace(generateTestKey(t)) + " team"
+	keyFilePath := filepath.Join(t.TempDir(), "team.pub")
+	keyFileContent := "# shared keys\n" + breakGlassKey + "\n\n" + teamKey + "\n"
+	if err := os.WriteFile(keyFilePath, []byte(keyFileContent), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+
+	programOptions := &options{
+		KeyInput: ownKey,
+		// The same key with another comment is not installed twice.
+		KeyInputs: []string{strings.TrimSuffix(ownKey, " me@laptop") + " duplicate"},
+		KeyFiles:  []string{keyFilePath},
+	}
+	publicKeys, _, err := resolveHostPublicKeys(programOptions, []string{"app01:22"}, nil)
+	if err != nil {
+		t.Fatalf("resolveHostPublicKeys() error = %v", err)
+	}
+	if want := []string{ownKey, breakGlassKey, teamKey}; !slices.Equal(publicKeys["app01:22"], want) {
+		t.Fatalf("keys = %q, want %q", publicKeys["app01:22"], want)
+	}
+
+	settings := buildHostSettings(programOptions, []string{"app01:22"}, nil, nil, publicKeys, nil)
+	if settings["app01:22"].PublicKey != ownKey || len(settings["app01:22"].ExtraPublicKeys) != 2 {
+		t.Fatalf("settings = %+v", settings["app01:22"])
+	}
+}
+
+func TestResolveHostPublicKeysUsesKeyFlagsWithoutConfiguredKey(t *testing.T) {
+	teamKey := strings.TrimSpace(generateTestKey(t)) + " team"
+	publicKeys, keyInputs, err := resolveHostPublicKeys(&options{KeyInputs: []string{teamKey}}, []string{"app01:22"}, nil)
+	if err != nil {
+		t.Fatalf("resolveHostPublicKeys() error = %v", err)
+	}
+	if !slices.Equal(publicKeys["app01:22"], []string{teamKey}) || keyInputs["app01:22"] != teamKey {
+		t.Fatalf("keys = %q, inputs = %q", publicKeys, keyInputs)
+	}
+}
+
+func TestInstallKeyOperationHandlesExtraKeys(t *testing.T) {
+	firstKey := strings.TrimSpace(generateTestKey(t))
+	secondKey := strings.TrimSpace(generateTestKey(t))
+	script, err := (installKeyOperation{}).Script(remoteOperationInput{PublicKey: firstKey, ExtraPublicKeys: []string{secondKey}})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	if want := firstKey + "\n\n" + secondKey + "\n\n"; script.Stdin != want {
+		t.Fatalf("stdin = %q, want key/blank pairs %q", script.Stdin, want)
+	}
+
+	result, err := (installKeyOperation{}).ParseResult(authorizedKeyAddedMarker + "\n" + authorizedKeyPresentMarker + "\n")
+	if err != nil || !result.Changed || result.Message != "1 key(s) added, 1 key(s) already present" {
+		t.Fatalf("ParseResult() = %+v, %v", result, err)
+	}
+	result, err = (installKeyOperation{}).ParseResult(authorizedKeyPresentMarker + "\n" + authorizedKeyPresentMarker + "\n")
+	if err != nil || result.Changed {
+		t.Fatalf("ParseResult(all present) = %+v, %v; want unchanged", result, err)
+	}
+
+	removeScript, err := (removeKeyOperation{}).Script(remoteOperationInput{PublicKey: firstKey, ExtraPublicKeys: []string{secondKey}})
+	if err != nil {
+		t.Fatalf("remove Script() error = %v", err)
+	}
+	if want := strings.Fields(firstKey)[1] + "\n" + strings.Fields(secondKey)[1] + "\n"; removeScript.Stdin != want {
+		t.Fatalf("remove stdin = %q, want %q", removeScript.Stdin, want)
+	}
+}
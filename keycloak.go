@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// keycloakKeyPrefix marks a key input that names a Keycloak user, e.g.
+	// keycloak:alice: the values of the user's sshPublicKey attribute are
+	// installed.
+	keycloakKeyPrefix     = "keycloak:"
+	keycloakSecretEnv     = "KEYCLOAK_CLIENT_SECRET"
+	keycloakKeyAttribute  = "sshPublicKey"
+	keycloakErrorBodySize = 512
+)
+
+// keycloakHTTPClient talks to the Keycloak API; tests point it at a local
+// server.
+var keycloakHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+type keycloakUser struct {
+	Username   string              `json:"username"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// lookupKeycloakPublicKeys returns the sshPublicKey attribute values of a
+// user in the --keycloak-realm realm, read with the client credentials of
+// --keycloak-client-id. A user without keys is an error.
+func lookupKeycloakPublicKeys(programOptions *options, userName string) ([]string, error) {
+	if userName == "" {
+		return nil, errors.New("keycloak: key input needs a user name, e.g. keycloak:alice")
+	}
+	if strings.TrimSpace(programOptions.KeycloakURL) == "" {
+		return nil, errors.New("keycloak: key inputs need --keycloak-url, --keycloak-realm and --keycloak-client-id")
+	}
+	parsedURL, err := url.Parse(strings.TrimSpace(programOptions.KeycloakURL))
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("--keycloak-url %q must be an http(s) URL such as https://sso.example.com", programOptions.KeycloakURL)
+	}
+	baseURL := strings.TrimRight(parsedURL.String(), "/")
+	realm := url.PathEscape(strings.TrimSpace(programOptions.KeycloakRealm))
+	clientSecret, err := serviceCredential("Keycloak", "client secret", programOptions.KeycloakSecretRef, "--keycloak-secret-ref", keycloakSecretEnv)
+	if err != nil {
+		return nil, err
+	}
+	token, err := keycloakAccessToken(baseURL+"/realms/"+realm+"/protocol/openid-connect/token", strings.TrimSpace(programOptions.KeycloakClientID), clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"username": {userName}, "exact": {"true"}, "briefRepresentation": {"false"}}
+	var users []keycloakUser
+	if err := keycloakGet(baseURL+"/admin/realms/"+realm+"/users?"+query.Encode(), token, &users); err != nil {
+		return nil, err
+	}
+	// Keycloak stores user names in lower case.
+	var user *keycloakUser
+	for index := range users {
+		if strings.EqualFold(users[index].Username, userName) {
+			user = &users[index]
+			break
+		}
+	}
+	if user == nil {
+		return nil, fmt.Errorf("Keycloak realm %s has no user %s", programOptions.KeycloakRealm, userName)
+	}
+	publicKeys, err := parseDirectoryPublicKeys(user.Attributes[keycloakKeyAttribute])
+	if err != nil {
+		return nil, fmt.Errorf("%s of Keycloak user %s: %w", keycloakKeyAttribute, userName, err)
+	}
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("Keycloak user %s has no %s attribute", userName, keycloakKeyAttribute)
+	}
+	return publicKeys, nil
+}
+
+// keycloakAccessToken runs the client credentials grant; the client's service
+// account needs the view-users role of realm-management.
+func keycloakAccessToken(tokenURL, clientID, clientSecret string) (string, error) {
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {clientID}, "client_secret": {clientSecret}}
+	response, err := keycloakHTTPClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("get Keycloak token: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, keycloakErrorBodySize))
+		return "", fmt.Errorf("Keycloak token request for %s returned %s: %s", clientID, response.Status, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("parse Keycloak token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("Keycloak token response has no access_token")
+	}
+	return token.AccessToken, nil
+}
+
+func keycloakGet(requestURL, token string, target any) error {
+	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return fmt.Errorf("build Keycloak request: %w", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+	response, err := keycloakHTTPClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("query Keycloak: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, keycloakErrorBodySize))
+		return fmt.Errorf("Keycloak returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(response.Body).Decode(target); err != nil {
+		return fmt.Errorf("parse Keycloak users: %w", err)
+	}
+	return nil
+}
+
+// validateKeycloakOptions rejects the --keycloak-* flags without
+// --keycloak-url, and --keycloak-url without a realm and client.
+func validateKeycloakOptions(programOptions *options) error {
+	if strings.TrimSpace(programOptions.KeycloakURL) == "" {
+		if strings.TrimSpace(programOptions.KeycloakRealm) != "" || strings.TrimSpace(programOptions.KeycloakClientID) != "" ||
+			strings.TrimSpace(programOptions.KeycloakSecretRef) != "" {
+			return errors.New("--keycloak-realm, --keycloak-client-id and --keycloak-secret-ref need --keycloak-url")
+		}
+		return nil
+	}
+	if strings.TrimSpace(programOptions.KeycloakRealm) == "" || strings.TrimSpace(programOptions.KeycloakClientID) == "" {
+		return errors.New("--keycloak-url needs --keycloak-realm and --keycloak-client-id")
+	}
+	return nil
+}
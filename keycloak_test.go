@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookupKeycloakPublicKeysReadsUserAttribute(t *testing.T) {
+	laptopKey := strings.TrimSpace(generateTestKey(t)) + " alice@laptop"
+	tokenKey := strings.TrimSpace(generateTestKey(t)) + " alice@yubikey"
+	t.Setenv(keycloakSecretEnv, "client-secret")
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/realms/corp/protocol/openid-connect/token":
+			if request.FormValue("grant_type") != "client_credentials" || request.FormValue("client_id") != "ssh-key-bootstrap" ||
+				request.FormValue("client_secret") != "client-secret" {
+				http.Error(writer, `{"error":"unauthorized_client"}`, http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(writer, `{"access_token": "access-1", "token_type": "Bearer"}`)
+		case "/admin/realms/corp/users":
+			if request.Header.Get("Authorization") != "Bearer access-1" || request.URL.Query().Get("exact") != "true" {
+				http.Error(writer, "forbidden", http.StatusForbidden)
+				return
+			}
+			if request.URL.Query().Get("username") != "Alice" {
+				fmt.Fprint(writer, `[]`)
+				return
+			}
+			fmt.Fprintf(writer, `[{"username": "alice", "attributes": {"sshPublicKey": [%q, %q]}}]`, laptopKey, tokenKey)
+		default:
+			http.NotFound(writer, request)
+		}
+	}))
+	defer server.Close()
+
+	programOptions := &options{KeycloakURL: server.URL + "/", KeycloakRealm: "corp", KeycloakClientID: "ssh-key-bootstrap"}
+	publicKeys, err := lookupKeycloakPublicKeys(programOptions, "Alice")
+	if err != nil {
+		t.Fatalf("lookupKeycloakPublicKeys() error = %v", err)
+	}
+	if want := []string{laptopKey, tokenKey}; !slices.Equal(publicKeys, want) {
+		t.Fatalf("keys = %q, want %q", publicKeys, want)
+	}
+	if _, err := lookupKeycloakPublicKeys(programOptions, "bob"); err == nil || !strings.Contains(err.Error(), "has no user bob") {
+		t.Fatalf("lookupKeycloakPublicKeys(bob) error = %v", err)
+	}
+	programOptions.KeycloakClientID = "other"
+	if _, err := lookupKeycloakPublicKeys(programOptions, "Alice"); err == nil || !strings.Contains(err.Error(), "unauthorized_client") {
+		t.Fatalf("lookupKeycloakPublicKeys() with another client error = %v", err)
+	}
+}
+
+func TestResolveDirectoryPublicKeysPicksSourceByPrefix(t *testing.T) {
+	if !isDirectoryKeyInput(" keycloak:alice") || isDirectoryKeyInput("~/.ssh/id_ed25519.pub") {
+		t.Fatal("isDirectoryKeyInput() does not match the key source prefixes")
+	}
+	if _, err := resolveDirectoryPublicKeys("ipa:alice"); err == nil || !strings.Contains(err.Error(), "need --ipa-url") {
+		t.Fatalf("resolveDirectoryPublicKeys(ipa:) without --ipa-url error = %v", err)
+	}
+	if _, err := resolveDirectoryPublicKeys("keycloak:"); err == nil || !strings.Contains(err.Error(), "needs a user name") {
+		t.Fatalf("resolveDirectoryPublicKeys(keycloak:) error = %v", err)
+	}
+}
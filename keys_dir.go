@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"ssh-key-bootstrap/messages"
+)
+
+// keysDirFiles lists the *.pub files in a --keys-dir directory, sorted by
+// name so the install order matches what the operator sees in Git.
+func keysDirFiles(dir string) ([]string, error) {
+	expandedDir, err := expandHomePath(strings.TrimSpace(dir))
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(expandedDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", expandedDir)
+	}
+	paths, err := filepath.Glob(filepath.Join(expandedDir, "*.pub"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// reviewKeysDir shows every key found in --keys-dir with its fingerprint,
+// comment and file, asks the operator to confirm the set and then adds the
+// files to KeyFiles so the keys are installed like --key-file keys.
+func reviewKeysDir(inputReader *bufio.Reader, programOptions *options) error {
+	paths, err := keysDirFiles(programOptions.KeysDir)
+	if err != nil {
+		return fmt.Errorf("--keys-dir: %w", err)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("--keys-dir: no *.pub files in %s", programOptions.KeysDir)
+	}
+
+	keyCount := 0
+	for _, path := range paths {
+		publicKeys, err := readPublicKeysFile(path)
+		if err != nil {
+			return fmt.Errorf("--keys-dir %s: %w", path, err)
+		}
+		for _, publicKey := range publicKeys {
+			parsedKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+			if err != nil {
+				return fmt.Errorf("--keys-dir %s: invalid public key format: %w", path, err)
+			}
+			if comment == "" {
+				comment = "<no comment>"
+			}
+			outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%s %s (%s)", ssh.FingerprintSHA256(parsedKey), comment, filepath.Base(path)))
+			keyCount++
+		}
+	}
+
+	// A plan only prints what would happen, so there is nothing to confirm.
+	if strings.TrimSpace(programOptions.PlanFormat) == "" {
+		if err := confirmKeysDir(inputReader, keyCount, programOptions.AssumeYes); err != nil {
+			return err
+		}
+	}
+	programOptions.KeyFiles = append(programOptions.KeyFiles, paths...)
+	return nil
+}
+
+// confirmKeysDir asks before installing the reviewed keys. --yes skips the
+// question; without a terminal to ask on, the run is refused.
+func confirmKeysDir(inputReader *bufio.Reader, keyCount int, assumeYes bool) error {
+	if assumeYes {
+		return nil
+	}
+	if !currentPrompter().Interactive(standardInputFile()) {
+		return fmt.Errorf("refusing to install %d key(s) from --keys-dir without --yes", keyCount)
+	}
+
+	answer, err := promptLine(inputReader, messages.Get(messages.PromptInstallKeys, keyCount))
+	if err != nil {
+		return wrapMissingInputError("keys-dir confirmation", err)
+	}
+	if !strings.EqualFold(answer, "yes") && !strings.EqualFold(answer, "y") {
+		return errors.New("run cancelled at key review: keys not confirmed")
+	}
+	return nil
+}
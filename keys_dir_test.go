@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTeamKeysDir(t *testing.T) (string, []string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	aliceKey := authorizedKeyLine(t, newTestHostKey(t, "ed25519"), "alice@example")
+	bobKey := authorizedKeyLine(t, newTestHostKey(t, "ed25519"), "bob@example")
+	files := map[string]string{
+		"bob.pub":   bobKey + "\n",
+		"alice.pub": aliceKey + "\n",
+		"README.md": "not a key\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir, []string{aliceKey, bobKey}
+}
+
+func TestReviewKeysDirListsKeysAndAddsFiles(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"yes"}})
+	dir, _ := writeTeamKeysDir(t)
+
+	programOptions := &options{KeysDir: dir}
+	if err := reviewKeysDir(bufio.NewReader(strings.NewReader("")), programOptions); err != nil {
+		t.Fatalf("reviewKeysDir() error = %v", err)
+	}
+	want := []string{filepath.Join(dir, "alice.pub"), filepath.Join(dir, "bob.pub")}
+	if !slices.Equal(programOptions.KeyFiles, want) {
+		t.Fatalf("KeyFiles = %q, want %q", programOptions.KeyFiles, want)
+	}
+	output := outputBuffer.String()
+	if !strings.Contains(output, "SHA256:") || !strings.Contains(output, "alice@example (alice.pub)") || !strings.Contains(output, "Install these 2 key(s)?") {
+		t.Fatalf("output = %q", output)
+	}
+	if strings.Index(output, "alice.pub") > strings.Index(output, "bob.pub") {
+		t.Fatalf("keys not listed in file name order: %q", output)
+	}
+}
+
+func TestReviewKeysDirRequiresConfirmation(t *testing.T) {
+	captureWriters(t)
+	dir, _ := writeTeamKeysDir(t)
+
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"no"}})
+	err := reviewKeysDir(bufio.NewReader(strings.NewReader("")), &options{KeysDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "keys not confirmed") {
+		t.Fatalf("reviewKeysDir(no) error = %v", err)
+	}
+
+	stubPrompter(t, &scriptedPrompter{})
+	err = reviewKeysDir(bufio.NewReader(strings.NewReader("")), &options{KeysDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "without --yes") {
+		t.Fatalf("reviewKeysDir(no terminal) error = %v", err)
+	}
+	if err := reviewKeysDir(bufio.NewReader(strings.NewReader("")), &options{KeysDir: dir, AssumeYes: true}); err != nil {
+		t.Fatalf("reviewKeysDir(--yes) error = %v", err)
+	}
+}
+
+func TestReviewKeysDirRejectsDirWithoutKeys(t *testing.T) {
+	captureWriters(t)
+	err := reviewKeysDir(bufio.NewReader(strings.NewReader("")), &options{KeysDir: t.TempDir(), AssumeYes: true})
+	if err == nil || !strings.Contains(err.Error(), "no *.pub files") {
+		t.Fatalf("reviewKeysDir(empty) error = %v", err)
+	}
+}
+
+func TestResolveHostPublicKeysIncludesKeysDir(t *testing.T) {
+	captureWriters(t)
+	dir, dirKeys := writeTeamKeysDir(t)
+	programOptions := &options{KeysDir: dir, AssumeYes: true}
+	if err := reviewKeysDir(bufio.NewReader(strings.NewReader("")), programOptions); err != nil {
+		t.Fatalf("reviewKeysDir() error = %v", err)
+	}
+	publicKeys, _, err := resolveHostPublicKeys(programOptions, []string{"app01:22"}, nil)
+	if err != nil {
+		t.Fatalf("resolveHostPublicKeys() error = %v", err)
+	}
+	if !slices.Equal(publicKeys["app01:22"], dirKeys) {
+		t.Fatalf("keys = %q, want %q", publicKeys["app01:22"], dirKeys)
+	}
+}
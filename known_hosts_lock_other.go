@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockKnownHostsFile is a no-op where flock is unavailable; appends from the
+// same process are still serialized by knownHostsFileLock.
+func lockKnownHostsFile(*os.File) error {
+	return nil
+}
+
+func unlockKnownHostsFile(*os.File) error {
+	return nil
+}
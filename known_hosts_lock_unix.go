@@ -0,0 +1,19 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockKnownHostsFile takes an exclusive advisory lock, waiting for other
+// bootstrap processes writing the same known_hosts file.
+func lockKnownHostsFile(fileHandle *os.File) error {
+	return unix.Flock(int(fileHandle.Fd()), unix.LOCK_EX)
+}
+
+func unlockKnownHostsFile(fileHandle *os.File) error {
+	return unix.Flock(int(fileHandle.Fd()), unix.LOCK_UN)
+}
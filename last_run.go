@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+const (
+	lastRunFilename = "last-run.json"
+	// againAllHosts is the --again value when the flag is given alone.
+	againAllHosts    = "all"
+	againFailedHosts = "failed"
+)
+
+// againHostFlags pick the target hosts; giving one with --again replaces the
+// saved host list instead of narrowing it.
+var againHostFlags = []string{"servers-file", "hosts-file", "discover", "nmap-xml", "netbox-url", "zabbix-url", "nagios-cfg", "ldap-url", "sample"}
+
+// againFlag is --again: alone it repeats the last run on the same hosts,
+// --again=failed only on the hosts that failed.
+type againFlag struct {
+	target *string
+}
+
+func (repeatFlag againFlag) String() string {
+	if repeatFlag.target == nil {
+		return ""
+	}
+	return *repeatFlag.target
+}
+
+func (repeatFlag againFlag) Set(value string) error {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", againAllHosts:
+		*repeatFlag.target = againAllHosts
+	case againFailedHosts:
+		*repeatFlag.target = againFailedHosts
+	case "false":
+		*repeatFlag.target = ""
+	default:
+		return fmt.Errorf("want --again or --again=failed, got %q", value)
+	}
+	return nil
+}
+
+func (againFlag) IsBoolFlag() bool {
+	return true
+}
+
+// lastRunState is what --again reads back: the effective options of the last
+// run without the password, and which hosts it targeted and which failed.
+type lastRunState struct {
+	RunID       string   `json:"runId,omitempty"`
+	FinishedAt  string   `json:"finishedAt"`
+	Hosts       []string `json:"hosts"`
+	FailedHosts []string `json:"failedHosts,omitempty"`
+	Options     options  `json:"options"`
+}
+
+// lastRunPath keeps the last run of each --context apart, so --again never
+// repeats another context's run.
+func lastRunPath(context string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	if context = strings.TrimSpace(context); context != "" {
+		if err := appconfig.ValidateContextName(context); err != nil {
+			return "", err
+		}
+		dir = filepath.Join(dir, "contexts", context)
+	}
+	return filepath.Join(dir, lastRunFilename), nil
+}
+
+// saveLastRun records the run for --again. operationList is the effective
+// operation list, so a repeated copy or exec runs the same operation.
+func saveLastRun(programOptions *options, operationList, runID string, hosts []string, failedHosts map[string]bool) error {
+	path, err := lastRunPath(programOptions.Context)
+	if err != nil {
+		return err
+	}
+	saved := *programOptions
+	if strings.TrimSpace(saved.Context) != "" {
+		// The context selects its config file again.
+		saved.EnvFile, saved.ConfigFile = "", ""
+	}
+	saved.Password = ""
+	// The loaded config is saved with the run; stdin is not read again.
+	saved.ConfigFromStdin = false
+	saved.Operations = operationList
+	saved.Again = ""
+	saved.RepeatHosts = nil
+	saved.RunID = ""
+	state := lastRunState{
+		RunID:      runID,
+		FinishedAt: time.Now().UTC().Format(time.RFC3339),
+		Hosts:      hosts,
+		Options:    saved,
+	}
+	for _, host := range hosts {
+		if failedHosts[host] {
+			state.FailedHosts = append(state.FailedHosts, host)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode last run: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(encoded, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write last run: %w", err)
+	}
+	return nil
+}
+
+// reportLastRun saves the run for --again. A write error is only a warning.
+func reportLastRun(programOptions *options, operationList, runID string, hosts []string, failedHosts map[string]bool) {
+	if err := saveLastRun(programOptions, operationList, runID, hosts, failedHosts); err != nil {
+		outputPrintf("WARNING: could not save this run for --again: %v\n", err)
+	}
+}
+
+func loadLastRun(context string) (lastRunState, error) {
+	path, err := lastRunPath(context)
+	if err != nil {
+		return lastRunState{}, err
+	}
+	stateBytes, err := os.ReadFile(path) // #nosec G304 -- path is fixed below the state directory
+	if errors.Is(err, fs.ErrNotExist) {
+		return lastRunState{}, fmt.Errorf("--again: no previous run recorded in %s", path)
+	}
+	if err != nil {
+		return lastRunState{}, fmt.Errorf("read last run: %w", err)
+	}
+	var state lastRunState
+	if err := json.Unmarshal(stateBytes, &state); err != nil {
+		return lastRunState{}, fmt.Errorf("parse last run %q: %w", path, err)
+	}
+	return state, nil
+}
+
+// applyLastRun replaces programOptions with the saved options of the last
+// run when --again is set, keeping every flag given on this command line.
+// The run targets the same hosts as before (or only those that failed), so
+// a --sample or a host list read from stdin is not drawn again.
+func applyLastRun(programOptions *options) (*lastRunState, error) {
+	mode := programOptions.Again
+	if mode == "" {
+		return nil, nil
+	}
+	state, err := loadLastRun(programOptions.Context)
+	if err != nil {
+		return nil, err
+	}
+	hosts := state.Hosts
+	if mode == againFailedHosts {
+		if len(state.FailedHosts) == 0 {
+			return nil, fmt.Errorf("--again=failed: no host failed in the last run (%s)", valueOrDash(state.RunID))
+		}
+		hosts = state.FailedHosts
+	}
+
+	type givenFlag struct {
+		value  flag.Value
+		text   string
+		values []string
+	}
+	var given []givenFlag
+	pinHosts := true
+	flag.Visit(func(setFlag *flag.Flag) {
+		entry := givenFlag{value: setFlag.Value, text: setFlag.Value.String()}
+		if listFlag, ok := setFlag.Value.(repeatedFlag); ok {
+			entry.values = slices.Clone(*listFlag.values)
+		}
+		given = append(given, entry)
+		if slices.Contains(againHostFlags, setFlag.Name) {
+			pinHosts = false
+		}
+	})
+
+	*programOptions = state.Options
+	if pinHosts {
+		programOptions.Server = ""
+		programOptions.Servers = strings.Join(hosts, ",")
+		programOptions.ServersFile = ""
+		programOptions.HostsFile = ""
+		programOptions.Discover = ""
+		programOptions.NmapXML = ""
+		programOptions.NetBoxURL = ""
+		programOptions.ZabbixURL = ""
+		programOptions.NagiosCfg = ""
+		programOptions.LDAPURL = ""
+		// The flags of a dropped source go too; without it they are rejected.
+		programOptions.NetBoxTokenRef, programOptions.NetBoxSite, programOptions.NetBoxRole = "", "", ""
+		programOptions.ZabbixTokenRef = ""
+		programOptions.LDAPBase, programOptions.LDAPFilter = "", ""
+		if strings.TrimSpace(programOptions.KeyLDAPURL) == "" {
+			programOptions.LDAPBindDN, programOptions.LDAPPasswordRef = "", ""
+		}
+		programOptions.Sample = ""
+		// The saved hosts are a list now, not a file to stream.
+		programOptions.StreamHosts = false
+		programOptions.RepeatHosts = hosts
+	}
+	for _, entry := range given {
+		if listFlag, ok := entry.value.(repeatedFlag); ok {
+			*listFlag.values = entry.values
+			continue
+		}
+		if err := entry.value.Set(entry.text); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+// describeLastRun is the status line --again prints for the loaded run.
+func describeLastRun(state *lastRunState, programOptions *options) string {
+	scope := fmt.Sprintf("%d host(s)", len(state.Hosts))
+	if programOptions.Again == againFailedHosts {
+		scope = fmt.Sprintf("%d failed host(s)", len(state.FailedHosts))
+	}
+	if len(programOptions.RepeatHosts) == 0 {
+		scope = "hosts from this command line"
+	}
+	return fmt.Sprintf("run %s finished %s; %s", valueOrDash(state.RunID), state.FinishedAt, scope)
+}
+
+// keepRepeatHosts narrows hosts to those --again repeats, in case a config
+// file loaded again brings back hosts the last run did not target.
+func keepRepeatHosts(hosts, repeatHosts []string) []string {
+	if len(repeatHosts) == 0 {
+		return hosts
+	}
+	return slices.DeleteFunc(hosts, func(host string) bool {
+		return !slices.Contains(repeatHosts, host)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunAgainRepeatsFailedHostsWithSavedOptions(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVERS=ok-host,bad-host\nUSER=deploy\nPASSWORD=hunter2-secret\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	var dialedMu sync.Mutex
+	var dialed []string
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedMu.Lock()
+		dialed = append(dialed, address)
+		dialedMu.Unlock()
+		if address == "bad-host:22" {
+			return nil, errors.New("connection refused")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			return "", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--delay", "1ms"})
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if err := run(capturedRuntimeIO()); err == nil {
+		t.Fatalf("expected run() error for the failed host")
+	}
+	saved, err := os.ReadFile(filepath.Join(stateHome, appName, lastRunFilename))
+	if err != nil {
+		t.Fatalf("read saved run: %v", err)
+	}
+	if strings.Contains(string(saved), "hunter2-secret") {
+		t.Fatalf("saved run contains the password: %s", saved)
+	}
+
+	dialed = nil
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--again=failed", "--run-id", "retry-1"})
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	if err := run(capturedRuntimeIO()); err == nil {
+		t.Fatalf("expected run() error for the host that still fails")
+	}
+	if !slices.Equal(dialed, []string{"bad-host:22"}) {
+		t.Fatalf("dialed = %q, want only the failed host", dialed)
+	}
+	output := outputBuffer.String()
+	if !strings.Contains(output, "TASK [Repeat last run]") || !strings.Contains(output, "1 failed host(s)") {
+		t.Fatalf("output missing repeat task: %q", output)
+	}
+	if !strings.Contains(output, "retry-1") {
+		t.Fatalf("--run-id given with --again was not applied: %q", output)
+	}
+}
+
+func TestApplyLastRunKeepsGivenFlagsAndPinsHosts(t *testing.T) {
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--again", "--delay", "2s", "--key", "extra.pub"})
+	saved := &options{User: "ops", Servers: "a,b,c", Sample: "2", KeyInputs: []string{"old.pub"}, Port: 22,
+		NetBoxURL: "https://netbox.example.com", NetBoxSite: "fra1"}
+	if err := saveLastRun(saved, "read-keys", "run-1", []string{"a:22", "c:22"}, map[string]bool{"c:22": true}); err != nil {
+		t.Fatalf("saveLastRun() error = %v", err)
+	}
+
+	programOptions, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	state, err := applyLastRun(programOptions)
+	if err != nil || state == nil {
+		t.Fatalf("applyLastRun() = %v, %v", state, err)
+	}
+	if programOptions.User != "ops" || programOptions.Operations != "read-keys" {
+		t.Fatalf("saved options not loaded: %+v", programOptions)
+	}
+	if programOptions.HostDelay.String() != "2s" || !slices.Equal(programOptions.KeyInputs, []string{"extra.pub"}) {
+		t.Fatalf("given flags lost: delay=%s keys=%q", programOptions.HostDelay, programOptions.KeyInputs)
+	}
+	if programOptions.Sample != "" || !slices.Equal(programOptions.RepeatHosts, []string{"a:22", "c:22"}) {
+		t.Fatalf("hosts not pinned: sample=%q repeat=%q", programOptions.Sample, programOptions.RepeatHosts)
+	}
+	if programOptions.NetBoxURL != "" || programOptions.NetBoxSite != "" {
+		t.Fatalf("NetBox source kept with pinned hosts: url=%q site=%q", programOptions.NetBoxURL, programOptions.NetBoxSite)
+	}
+}
+
+func TestApplyLastRunWithoutSavedRun(t *testing.T) {
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--again=failed"})
+	programOptions, err := parseFlags()
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if _, err := applyLastRun(programOptions); err == nil || !strings.Contains(err.Error(), "no previous run") {
+		t.Fatalf("applyLastRun() error = %v, want no previous run", err)
+	}
+}
+
+func TestAgainFlagRejectsUnknownScope(t *testing.T) {
+	var target string
+	if err := (againFlag{target: &target}).Set("broken"); err == nil {
+		t.Fatalf("Set(broken) succeeded")
+	}
+}
+
+func TestLastRunIsKeptPerContext(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	saved := &options{Context: "acme", EnvFile: "/home/ops/.config/ssh-key-bootstrap/contexts/acme/.env"}
+	if err := saveLastRun(saved, "install-key", "run-1", []string{"a:22"}, nil); err != nil {
+		t.Fatalf("saveLastRun() error = %v", err)
+	}
+
+	if _, err := loadLastRun(""); err == nil {
+		t.Fatalf("loadLastRun() without a context found the acme run")
+	}
+	state, err := loadLastRun("acme")
+	if err != nil {
+		t.Fatalf("loadLastRun(acme) error = %v", err)
+	}
+	if state.Options.Context != "acme" || state.Options.EnvFile != "" {
+		t.Fatalf("saved options = %+v, want the context without its config path", state.Options)
+	}
+}
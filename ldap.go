@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapPasswordEnv = "LDAP_PASSWORD"
+	ldapPageSize    = 500
+	ldapTimeout     = 30 * time.Second
+	// ldapComputerFilter matches the computer objects of Active Directory
+	// whose account is not disabled (userAccountControl bit 2).
+	ldapComputerFilter = "(objectClass=computer)(!(userAccountControl:1.2.840.113556.1.4.803:=2))"
+)
+
+// ldapDirectory is the part of an LDAP connection the inventory uses.
+type ldapDirectory interface {
+	SearchWithPaging(searchRequest *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// connectLDAP opens a connection to serverURL (given with urlFlag) and binds
+// as --ldap-bind-dn; tests replace it with an in-memory directory.
+var connectLDAP = func(programOptions *options, serverURL, urlFlag string) (ldapDirectory, error) {
+	serverURL = strings.TrimSpace(serverURL)
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil || (parsedURL.Scheme != "ldaps" && parsedURL.Scheme != "ldap") || parsedURL.Host == "" {
+		return nil, fmt.Errorf("%s %q must be an ldaps:// or ldap:// URL such as ldaps://dc01.example.com", urlFlag, serverURL)
+	}
+	tlsConfig := &tls.Config{ServerName: parsedURL.Hostname(), MinVersion: tls.VersionTLS12}
+	connection, err := ldap.DialURL(serverURL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}), ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", serverURL, err)
+	}
+	connection.SetTimeout(ldapTimeout)
+	// The bind password never crosses the network in the clear.
+	if parsedURL.Scheme == "ldap" {
+		if err := connection.StartTLS(tlsConfig); err != nil {
+			connection.Close()
+			return nil, fmt.Errorf("start TLS with %s: %w", serverURL, err)
+		}
+	}
+	if bindDN := strings.TrimSpace(programOptions.LDAPBindDN); bindDN != "" {
+		password, err := serviceCredential("LDAP", "bind password", programOptions.LDAPPasswordRef, "--ldap-password-ref", ldapPasswordEnv)
+		if err != nil {
+			connection.Close()
+			return nil, err
+		}
+		if err := connection.Bind(bindDN, password); err != nil {
+			connection.Close()
+			return nil, fmt.Errorf("bind to %s as %s: %w", serverURL, bindDN, err)
+		}
+	}
+	return connection, nil
+}
+
+// readLDAPInventory returns the dNSHostName of every enabled computer object
+// under --ldap-base that matches --ldap-filter, in directory order and
+// without repeats, plus how many matching objects had no dNSHostName and were
+// skipped.
+func readLDAPInventory(programOptions *options) ([]string, int, error) {
+	filter, err := ldapComputerSearchFilter(programOptions.LDAPFilter)
+	if err != nil {
+		return nil, 0, err
+	}
+	directory, err := connectLDAP(programOptions, programOptions.LDAPURL, "--ldap-url")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer directory.Close()
+
+	searchRequest := ldap.NewSearchRequest(strings.TrimSpace(programOptions.LDAPBase), ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, filter, []string{"dNSHostName"}, nil)
+	result, err := directory.SearchWithPaging(searchRequest, ldapPageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search %s for computers: %w", programOptions.LDAPBase, err)
+	}
+	var entries []string
+	seen := make(map[string]struct{}, len(result.Entries))
+	skipped := 0
+	for _, entry := range result.Entries {
+		hostName := strings.TrimSpace(entry.GetAttributeValue("dNSHostName"))
+		if hostName == "" {
+			skipped++
+			continue
+		}
+		if _, duplicate := seen[hostName]; !duplicate {
+			seen[hostName] = struct{}{}
+			entries = append(entries, hostName)
+		}
+	}
+	return entries, skipped, nil
+}
+
+// ldapComputerSearchFilter narrows ldapComputerFilter with the --ldap-filter
+// value, e.g. (operatingSystem=*Linux*); the outer parentheses are optional.
+func ldapComputerSearchFilter(extraFilter string) (string, error) {
+	extraFilter = strings.TrimSpace(extraFilter)
+	if extraFilter == "" {
+		return "(&" + ldapComputerFilter + ")", nil
+	}
+	if !strings.HasPrefix(extraFilter, "(") {
+		extraFilter = "(" + extraFilter + ")"
+	}
+	if _, err := ldap.CompileFilter(extraFilter); err != nil {
+		return "", fmt.Errorf("--ldap-filter %q: %w", extraFilter, err)
+	}
+	return "(&" + ldapComputerFilter + extraFilter + ")", nil
+}
+
+// validateLDAPOptions rejects --ldap-* flags that do nothing: the search
+// flags without --ldap-url, the key lookup base without --key-ldap-url, the
+// bind flags without either, and a bind password without a bind DN.
+func validateLDAPOptions(programOptions *options) error {
+	inventory := strings.TrimSpace(programOptions.LDAPURL) != ""
+	keyLookup := strings.TrimSpace(programOptions.KeyLDAPURL) != ""
+	if !inventory && (strings.TrimSpace(programOptions.LDAPBase) != "" || strings.TrimSpace(programOptions.LDAPFilter) != "") {
+		return errors.New("--ldap-base and --ldap-filter need --ldap-url")
+	}
+	if inventory && strings.TrimSpace(programOptions.LDAPBase) == "" {
+		return errors.New("--ldap-url needs --ldap-base, e.g. --ldap-base DC=example,DC=com")
+	}
+	if keyLookup != (strings.TrimSpace(programOptions.KeyLDAPBase) != "") {
+		return errors.New("--key-ldap-url and --key-ldap-base go together, e.g. --key-ldap-base ou=people,dc=example,dc=com")
+	}
+	if !inventory && !keyLookup && (strings.TrimSpace(programOptions.LDAPBindDN) != "" || strings.TrimSpace(programOptions.LDAPPasswordRef) != "") {
+		return errors.New("--ldap-bind-dn and --ldap-password-ref need --ldap-url or --key-ldap-url")
+	}
+	if strings.TrimSpace(programOptions.LDAPPasswordRef) != "" && strings.TrimSpace(programOptions.LDAPBindDN) == "" {
+		return errors.New("--ldap-password-ref needs --ldap-bind-dn")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapKeyPrefix marks a key input that is looked up in the directory, e.g.
+// ldap:uid=alice: the sshPublicKey values of the one entry matching the
+// filter are installed.
+const ldapKeyPrefix = "ldap:"
+
+const ldapPublicKeyAttribute = "sshPublicKey"
+
+// lookupLDAPPublicKeys returns the sshPublicKey values of the one entry under
+// --key-ldap-base that matches filter. No match, several matches and an entry
+// without keys are errors, so a typo never installs nothing or someone else's
+// key.
+func lookupLDAPPublicKeys(programOptions *options, filter string) ([]string, error) {
+	if filter == "" {
+		return nil, errors.New("ldap: key input needs a filter, e.g. ldap:uid=alice")
+	}
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	if _, err := ldap.CompileFilter(filter); err != nil {
+		return nil, fmt.Errorf("LDAP filter %q: %w", filter, err)
+	}
+	if strings.TrimSpace(programOptions.KeyLDAPURL) == "" {
+		return nil, errors.New("ldap: key inputs need --key-ldap-url and --key-ldap-base")
+	}
+	directory, err := connectLDAP(programOptions, programOptions.KeyLDAPURL, "--key-ldap-url")
+	if err != nil {
+		return nil, err
+	}
+	defer directory.Close()
+
+	base := strings.TrimSpace(programOptions.KeyLDAPBase)
+	searchRequest := ldap.NewSearchRequest(base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, filter, []string{ldapPublicKeyAttribute}, nil)
+	result, err := directory.SearchWithPaging(searchRequest, ldapPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("search %s for %s: %w", base, filter, err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, fmt.Errorf("no LDAP entry under %s matches %s", base, filter)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%d LDAP entries under %s match %s; narrow the filter to one user", len(result.Entries), base, filter)
+	}
+	entry := result.Entries[0]
+	publicKeys, err := parseDirectoryPublicKeys(entry.GetAttributeValues(ldapPublicKeyAttribute))
+	if err != nil {
+		return nil, fmt.Errorf("%s of %s: %w", ldapPublicKeyAttribute, entry.DN, err)
+	}
+	if len(publicKeys) == 0 {
+		return nil, fmt.Errorf("%s has no %s", entry.DN, ldapPublicKeyAttribute)
+	}
+	return publicKeys, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestResolveLDAPPublicKeysReadsTheMatchingUser(t *testing.T) {
+	laptopKey := strings.TrimSpace(generateTestKey(t)) + " alice@laptop"
+	tokenKey := strings.TrimSpace(generateTestKey(t)) + " alice@yubikey"
+	directory := &fakeLDAPDirectory{entries: []*ldap.Entry{
+		ldap.NewEntry("uid=alice,ou=people,dc=example,dc=com", map[string][]string{"sshPublicKey": {laptopKey, tokenKey}}),
+	}}
+	connects := 0
+	original := connectLDAP
+	connectLDAP = func(_ *options, serverURL, urlFlag string) (ldapDirectory, error) {
+		if serverURL != "ldaps://idm.example.com" || urlFlag != "--key-ldap-url" {
+			t.Fatalf("connectLDAP(%q, %q)", serverURL, urlFlag)
+		}
+		connects++
+		return directory, nil
+	}
+	t.Cleanup(func() { connectLDAP = original })
+
+	if _, err := resolveDirectoryPublicKeys("ldap:uid=alice"); err == nil || !strings.Contains(err.Error(), "need --key-ldap-url") {
+		t.Fatalf("resolveDirectoryPublicKeys() without --key-ldap-url error = %v", err)
+	}
+	programOptions := &options{KeyLDAPURL: "ldaps://idm.example.com", KeyLDAPBase: "ou=people,dc=example,dc=com", KeyInputs: []string{"ldap:uid=alice"}}
+	restore := configureDirectoryKeySources(programOptions)
+	t.Cleanup(restore)
+
+	publicKeys, err := resolveExtraPublicKeys(programOptions, keyPolicy{})
+	if err != nil {
+		t.Fatalf("resolveExtraPublicKeys() error = %v", err)
+	}
+	if want := []string{laptopKey, tokenKey}; !slices.Equal(publicKeys, want) {
+		t.Fatalf("keys = %q, want %q", publicKeys, want)
+	}
+	if directory.request.BaseDN != programOptions.KeyLDAPBase || directory.request.Filter != "(uid=alice)" {
+		t.Fatalf("search = %+v", directory.request)
+	}
+	// KEY takes one key, and the cached answer is reused.
+	if _, err := resolvePublicKey("ldap:uid=alice"); err == nil || !strings.Contains(err.Error(), "has 2 keys") || connects != 1 {
+		t.Fatalf("resolvePublicKey() error = %v after %d connect(s)", err, connects)
+	}
+}
+
+func TestResolveLDAPPublicKeysNeedsExactlyOneEntry(t *testing.T) {
+	directory := &fakeLDAPDirectory{}
+	original := connectLDAP
+	connectLDAP = func(*options, string, string) (ldapDirectory, error) { return directory, nil }
+	t.Cleanup(func() { connectLDAP = original })
+	t.Cleanup(configureDirectoryKeySources(&options{KeyLDAPURL: "ldaps://idm.example.com", KeyLDAPBase: "dc=example,dc=com"}))
+
+	if _, err := resolveDirectoryPublicKeys("ldap:uid=nobody"); err == nil || !strings.Contains(err.Error(), "no LDAP entry") {
+		t.Fatalf("resolveDirectoryPublicKeys() with no match error = %v", err)
+	}
+	directory.entries = []*ldap.Entry{ldap.NewEntry("uid=a,dc=example,dc=com", nil), ldap.NewEntry("uid=b,dc=example,dc=com", nil)}
+	if _, err := resolveDirectoryPublicKeys("ldap:(cn=*)"); err == nil || !strings.Contains(err.Error(), "2 LDAP entries") {
+		t.Fatalf("resolveDirectoryPublicKeys() with two matches error = %v", err)
+	}
+	directory.entries = directory.entries[:1]
+	if _, err := resolveDirectoryPublicKeys("ldap:uid=a"); err == nil || !strings.Contains(err.Error(), "has no sshPublicKey") {
+		t.Fatalf("resolveDirectoryPublicKeys() without keys error = %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type fakeLDAPDirectory struct {
+	request *ldap.SearchRequest
+	entries []*ldap.Entry
+	closed  bool
+}
+
+func (directory *fakeLDAPDirectory) SearchWithPaging(searchRequest *ldap.SearchRequest, _ uint32) (*ldap.SearchResult, error) {
+	directory.request = searchRequest
+	return &ldap.SearchResult{Entries: directory.entries}, nil
+}
+
+func (directory *fakeLDAPDirectory) Close() error {
+	directory.closed = true
+	return nil
+}
+
+func TestReadLDAPInventoryTargetsComputerHostNames(t *testing.T) {
+	directory := &fakeLDAPDirectory{entries: []*ldap.Entry{
+		ldap.NewEntry("CN=APP01,OU=Linux,DC=example,DC=com", map[string][]string{"dNSHostName": {"app01.example.com"}}),
+		ldap.NewEntry("CN=OLD01,OU=Linux,DC=example,DC=com", nil),
+		ldap.NewEntry("CN=APP02,OU=Linux,DC=example,DC=com", map[string][]string{"dNSHostName": {"app02.example.com"}}),
+	}}
+	original := connectLDAP
+	connectLDAP = func(*options, string, string) (ldapDirectory, error) { return directory, nil }
+	t.Cleanup(func() { connectLDAP = original })
+
+	programOptions := &options{LDAPURL: "ldaps://dc01.example.com", LDAPBase: "OU=Linux,DC=example,DC=com", LDAPFilter: "operatingSystem=*Linux*"}
+	entries, skipped, err := readLDAPInventory(programOptions)
+	if err != nil {
+		t.Fatalf("readLDAPInventory() error = %v", err)
+	}
+	if want := []string{"app01.example.com", "app02.example.com"}; !slices.Equal(entries, want) || skipped != 1 {
+		t.Fatalf("readLDAPInventory() = %v, skipped %d; want %v, skipped 1", entries, skipped, want)
+	}
+	if directory.request.BaseDN != programOptions.LDAPBase || !strings.HasSuffix(directory.request.Filter, "(operatingSystem=*Linux*))") ||
+		!strings.HasPrefix(directory.request.Filter, "(&(objectClass=computer)") || !directory.closed {
+		t.Fatalf("search = %+v, closed %v", directory.request, directory.closed)
+	}
+}
+
+func TestLDAPComputerSearchFilterRejectsInvalidFilter(t *testing.T) {
+	if _, err := ldapComputerSearchFilter("(operatingSystem=*Linux*"); err == nil || !strings.Contains(err.Error(), "--ldap-filter") {
+		t.Fatalf("ldapComputerSearchFilter() error = %v", err)
+	}
+}
+
+func TestConnectLDAPRejectsOtherSchemes(t *testing.T) {
+	if _, err := connectLDAP(&options{}, "https://dc01.example.com", "--ldap-url"); err == nil || !strings.Contains(err.Error(), "must be an ldaps:// or ldap:// URL") {
+		t.Fatalf("connectLDAP() error = %v", err)
+	}
+}
+
+func TestValidateLDAPOptions(t *testing.T) {
+	for _, test := range []struct {
+		programOptions options
+		wantErr        string
+	}{
+		{options{LDAPBase: "DC=example,DC=com"}, "need --ldap-url"},
+		{options{LDAPBindDN: "uid=svc,dc=example,dc=com"}, "need --ldap-url or --key-ldap-url"},
+		{options{KeyLDAPURL: "ldaps://idm.example.com"}, "go together"},
+		{options{KeyLDAPURL: "ldaps://idm.example.com", KeyLDAPBase: "ou=people,dc=example,dc=com", LDAPBindDN: "uid=svc,dc=example,dc=com"}, ""},
+		{options{LDAPURL: "ldaps://dc01.example.com"}, "needs --ldap-base"},
+		{options{LDAPURL: "ldaps://dc01.example.com", LDAPBase: "DC=example,DC=com", LDAPPasswordRef: "bw://ldap"}, "needs --ldap-bind-dn"},
+		{options{LDAPURL: "ldaps://dc01.example.com", LDAPBase: "DC=example,DC=com", LDAPBindDN: "svc-bootstrap@example.com"}, ""},
+	} {
+		err := validateLDAPOptions(&test.programOptions)
+		if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Fatalf("validateLDAPOptions(%+v) error = %v, want %q", test.programOptions, err, test.wantErr)
+		}
+	}
+}
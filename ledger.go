@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultLedgerFilename = appName + ".ledger.json"
+	ledgerDateLayout      = time.DateOnly
+)
+
+var ledgerNow = time.Now
+
+// installationLedger is the local record of keys installed by this tool.
+type installationLedger struct {
+	Entries []ledgerEntry `json:"entries"`
+}
+
+type ledgerEntry struct {
+	RunID       string `json:"runId,omitempty"`
+	Host        string `json:"host"`
+	User        string `json:"user"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"publicKey"`
+	InstalledAt string `json:"installedAt"`
+	ExpiresAt   string `json:"expiresAt,omitempty"`
+	RemovedAt   string `json:"removedAt,omitempty"`
+}
+
+func resolveLedgerPath(ledgerFile string) (string, error) {
+	if trimmedPath := strings.TrimSpace(ledgerFile); trimmedPath != "" {
+		return expandHomePath(trimmedPath)
+	}
+	return stateFilePath(defaultLedgerFilename)
+}
+
+func loadLedger(path string) (*installationLedger, error) {
+	ledgerBytes, err := os.ReadFile(path) // #nosec G304 -- ledger path is user-configurable by design
+	if errors.Is(err, os.ErrNotExist) {
+		return &installationLedger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ledger: %w", err)
+	}
+
+	ledger := &installationLedger{}
+	if len(strings.TrimSpace(string(ledgerBytes))) == 0 {
+		return ledger, nil
+	}
+	if err := json.Unmarshal(ledgerBytes, ledger); err != nil {
+		return nil, fmt.Errorf("parse ledger %q: %w", path, err)
+	}
+	return ledger, nil
+}
+
+// saveLedger writes to a temporary file first so an interrupted run never
+// leaves a truncated ledger behind.
+func saveLedger(path string, ledger *installationLedger) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create ledger directory: %w", err)
+	}
+
+	ledgerBytes, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode ledger: %w", err)
+	}
+
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, append(ledgerBytes, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		return fmt.Errorf("replace ledger: %w", err)
+	}
+	return nil
+}
+
+func newLedgerEntry(runID, host, userName, publicKey, expiresAt string) (ledgerEntry, error) {
+	parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return ledgerEntry{}, fmt.Errorf("invalid public key format: %w", err)
+	}
+	return ledgerEntry{
+		RunID:       runID,
+		Host:        host,
+		User:        userName,
+		Fingerprint: ssh.FingerprintSHA256(parsedKey),
+		PublicKey:   publicKey,
+		InstalledAt: ledgerNow().UTC().Format(time.RFC3339),
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+func parseKeyExpiry(value string) (string, error) {
+	trimmedValue := strings.TrimSpace(value)
+	if trimmedValue == "" {
+		return "", nil
+	}
+	expiryDate, err := time.Parse(ledgerDateLayout, trimmedValue)
+	if err != nil {
+		return "", fmt.Errorf("expires must be a date in YYYY-MM-DD format: %w", err)
+	}
+	if !expiryDate.AddDate(0, 0, 1).After(ledgerNow().UTC()) {
+		return "", fmt.Errorf("expires date %s is in the past", trimmedValue)
+	}
+	return expiryDate.Format(ledgerDateLayout), nil
+}
+
+// isExpired reports whether an active entry is past its expiry date; a key
+// stays valid through the whole expiry day.
+func (entry ledgerEntry) isExpired(now time.Time) bool {
+	if entry.RemovedAt != "" || entry.ExpiresAt == "" {
+		return false
+	}
+	expiryDate, err := time.Parse(ledgerDateLayout, entry.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	return !now.UTC().Before(expiryDate.AddDate(0, 0, 1))
+}
+
+// recordInstalledKey appends a ledger entry for every host that completed
+// successfully and returns how many hosts were recorded. installationForHost
+// returns the login user and installed key of a host.
+func recordInstalledKey(ledgerFile, runID string, hosts []string, failedHosts map[string]bool, installationForHost func(host string) (userName string, publicKeys []string), expiresAt string) (int, error) {
+	ledgerPath, err := resolveLedgerPath(ledgerFile)
+	if err != nil {
+		return 0, err
+	}
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil {
+		return 0, err
+	}
+
+	recordedHosts := 0
+	for _, host := range hosts {
+		if failedHosts[host] {
+			continue
+		}
+		userName, publicKeys := installationForHost(host)
+		for _, publicKey := range publicKeys {
+			entry, err := newLedgerEntry(runID, host, userName, publicKey, expiresAt)
+			if err != nil {
+				return 0, err
+			}
+			ledger.Entries = append(ledger.Entries, entry)
+		}
+		recordedHosts++
+	}
+
+	if err := saveLedger(ledgerPath, ledger); err != nil {
+		return 0, err
+	}
+	return recordedHosts, nil
+}
+
+func (entry ledgerEntry) identity() string {
+	return entry.Host + "\x00" + entry.User + "\x00" + entry.Fingerprint
+}
+
+// currentEntryIndexes returns, in ledger order, the index of the most recent
+// entry for each host/user/key combination that has not been removed. Later
+// installs of the same key supersede earlier ones (for example a new expiry).
+func (ledger *installationLedger) currentEntryIndexes() []int {
+	latestIndex := map[string]int{}
+	for index, entry := range ledger.Entries {
+		latestIndex[entry.identity()] = index
+	}
+
+	var indexes []int
+	for index, entry := range ledger.Entries {
+		if latestIndex[entry.identity()] == index && entry.RemovedAt == "" {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+func (ledger *installationLedger) markRemoved(identity, removedAt string) {
+	for index := range ledger.Entries {
+		if ledger.Entries[index].identity() == identity && ledger.Entries[index].RemovedAt == "" {
+			ledger.Entries[index].RemovedAt = removedAt
+		}
+	}
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	trimmedFingerprint := strings.TrimSpace(fingerprint)
+	if strings.HasPrefix(strings.ToUpper(trimmedFingerprint), "SHA256:") {
+		return "SHA256:" + trimmedFingerprint[len("SHA256:"):]
+	}
+	return "SHA256:" + trimmedFingerprint
+}
+
+func newRunID() string {
+	randomBytes := make([]byte, 4)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return ledgerNow().UTC().Format("20060102T150405Z")
+	}
+	return ledgerNow().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(randomBytes)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stubLedgerNow(t *testing.T, now time.Time) {
+	t.Helper()
+
+	originalNow := ledgerNow
+	ledgerNow = func() time.Time { return now }
+	t.Cleanup(func() { ledgerNow = originalNow })
+}
+
+func TestLoadLedgerMissingFileIsEmpty(t *testing.T) {
+	ledger, err := loadLedger(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("loadLedger() error = %v", err)
+	}
+	if len(ledger.Entries) != 0 {
+		t.Fatalf("expected empty ledger, got %d entries", len(ledger.Entries))
+	}
+}
+
+func TestSaveAndLoadLedgerRoundTrip(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "state", "ledger.json")
+	ledger := &installationLedger{Entries: []ledgerEntry{{Host: "app01:22", User: "deploy", Fingerprint: "SHA256:abc"}}}
+	if err := saveLedger(ledgerPath, ledger); err != nil {
+		t.Fatalf("saveLedger() error = %v", err)
+	}
+
+	fileInfo, err := os.Stat(ledgerPath)
+	if err != nil {
+		t.Fatalf("stat ledger: %v", err)
+	}
+	if fileInfo.Mode().Perm() != 0o600 {
+		t.Fatalf("ledger mode = %v, want 0600", fileInfo.Mode().Perm())
+	}
+
+	loadedLedger, err := loadLedger(ledgerPath)
+	if err != nil {
+		t.Fatalf("loadLedger() error = %v", err)
+	}
+	if len(loadedLedger.Entries) != 1 || loadedLedger.Entries[0].Host != "app01:22" {
+		t.Fatalf("loaded ledger = %+v", loadedLedger)
+	}
+}
+
+func TestLoadLedgerInvalidJSON(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	if err := os.WriteFile(ledgerPath, []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	if _, err := loadLedger(ledgerPath); err == nil || !strings.Contains(err.Error(), "parse ledger") {
+		t.Fatalf("loadLedger() error = %v, want parse error", err)
+	}
+}
+
+func TestParseKeyExpiry(t *testing.T) {
+	stubLedgerNow(t, time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	if expiry, err := parseKeyExpiry(""); err != nil || expiry != "" {
+		t.Fatalf("parseKeyExpiry(empty) = %q, %v", expiry, err)
+	}
+	if expiry, err := parseKeyExpiry(" 2025-12-31 "); err != nil || expiry != "2025-12-31" {
+		t.Fatalf("parseKeyExpiry(future) = %q, %v", expiry, err)
+	}
+	if _, err := parseKeyExpiry("2025-06-01"); err != nil {
+		t.Fatalf("parseKeyExpiry(today) error = %v, want accepted", err)
+	}
+	if _, err := parseKeyExpiry("2025-05-31"); err == nil {
+		t.Fatalf("expected past expiry to be rejected")
+	}
+	if _, err := parseKeyExpiry("31/12/2025"); err == nil {
+		t.Fatalf("expected invalid format to be rejected")
+	}
+}
+
+func TestLedgerEntryIsExpired(t *testing.T) {
+	entry := ledgerEntry{ExpiresAt: "2025-12-31"}
+
+	if entry.isExpired(time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC)) {
+		t.Fatalf("key should be valid through its expiry day")
+	}
+	if !entry.isExpired(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("key should be expired the day after its expiry")
+	}
+
+	entry.RemovedAt = "2026-01-01T00:00:00Z"
+	if entry.isExpired(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("removed entries must not be reported as expired")
+	}
+}
+
+func TestRecordInstalledKeyAppendsHistoryAndLatestEntryWins(t *testing.T) {
+	stubLedgerNow(t, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	installation := func(string) (string, []string) { return "deploy", []string{publicKey} }
+
+	recorded, err := recordInstalledKey(ledgerPath, "run-1", []string{"a:22", "b:22"}, map[string]bool{"b:22": true}, installation, "2025-12-31")
+	if err != nil {
+		t.Fatalf("recordInstalledKey() error = %v", err)
+	}
+	if recorded != 1 {
+		t.Fatalf("recorded = %d, want 1", recorded)
+	}
+
+	if _, err := recordInstalledKey(ledgerPath, "run-2", []string{"a:22"}, nil, installation, "2026-03-31"); err != nil {
+		t.Fatalf("recordInstalledKey() second run error = %v", err)
+	}
+
+	ledger, err := loadLedger(ledgerPath)
+	if err != nil {
+		t.Fatalf("loadLedger() error = %v", err)
+	}
+	if len(ledger.Entries) != 2 {
+		t.Fatalf("ledger entries = %d, want 2 (%+v)", len(ledger.Entries), ledger.Entries)
+	}
+	if ledger.Entries[0].RunID != "run-1" || ledger.Entries[1].RunID != "run-2" {
+		t.Fatalf("run ids = %q, %q", ledger.Entries[0].RunID, ledger.Entries[1].RunID)
+	}
+
+	current := ledger.currentEntryIndexes()
+	if len(current) != 1 || ledger.Entries[current[0]].ExpiresAt != "2026-03-31" {
+		t.Fatalf("current entries = %v, want only the latest install", current)
+	}
+
+	ledger.markRemoved(ledger.Entries[0].identity(), "2026-04-01T00:00:00Z")
+	if len(ledger.currentEntryIndexes()) != 0 {
+		t.Fatalf("expected no current entries after removal")
+	}
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	for _, input := range []string{"SHA256:abc", "sha256:abc", " abc "} {
+		if got := normalizeFingerprint(input); got != "SHA256:abc" {
+			t.Fatalf("normalizeFingerprint(%q) = %q, want %q", input, got, "SHA256:abc")
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
-	"bufio"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 
 	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/messages"
 )
 
 const (
@@ -19,14 +23,34 @@ const (
 	ansibleTaskPaddingWidth = 69
 )
 
-const addAuthorizedKeyScript = "set -eu\n" +
+// addAuthorizedKeyScriptTemplate reads, for each key, the key line and the
+// key blob whose existing entry should be replaced (used when the comment is
+// stamped; empty or missing otherwise). The replace branch is only rendered
+// when the comment is stamped.
+const addAuthorizedKeyScriptTemplate = "set -eu\n" +
 	"umask 077\n" +
 	"mkdir -p ~/.ssh\n" +
 	"touch ~/.ssh/authorized_keys\n" +
 	"chmod 700 ~/.ssh\n" +
 	"chmod 600 ~/.ssh/authorized_keys\n" +
-	"IFS= read -r KEY\n" +
-	"grep -qxF \"$KEY\" ~/.ssh/authorized_keys || printf '%s\\n' \"$KEY\" >> ~/.ssh/authorized_keys\n"
+	"while IFS= read -r KEY; do\n" +
+	"  IFS= read -r REPLACE_BLOB || REPLACE_BLOB=\n" +
+	"  if grep -qxF \"$KEY\" ~/.ssh/authorized_keys; then\n" +
+	"    echo {{ shquote .Vars.present }}\n" +
+	"{{- if .ReplaceKeyComment }}\n" +
+	"  elif [ -n \"$REPLACE_BLOB\" ] && grep -qF \" $REPLACE_BLOB\" ~/.ssh/authorized_keys; then\n" +
+	"    UPDATED=$(mktemp ~/.ssh/authorized_keys.XXXXXX)\n" +
+	"    grep -vF \" $REPLACE_BLOB\" ~/.ssh/authorized_keys > \"$UPDATED\" || true\n" +
+	"    printf '%s\\n' \"$KEY\" >> \"$UPDATED\"\n" +
+	"    cat \"$UPDATED\" > ~/.ssh/authorized_keys\n" +
+	"    rm -f \"$UPDATED\"\n" +
+	"    echo {{ shquote .Vars.updated }}\n" +
+	"{{- end }}\n" +
+	"  else\n" +
+	"    printf '%s\\n' \"$KEY\" >> ~/.ssh/authorized_keys\n" +
+	"    echo {{ shquote .Vars.added }}\n" +
+	"  fi\n" +
+	"done\n"
 
 type options = appconfig.Options
 
@@ -36,9 +60,11 @@ type statusError struct {
 }
 
 type hostRunRecap struct {
-	ok      int
-	changed int
-	failed  int
+	ok       int
+	changed  int
+	failed   int
+	lastErr  error         // most recent failure, used to pick the exit code
+	duration time.Duration // time spent running the host's operations
 }
 
 func (statusErr *statusError) Error() string {
@@ -49,100 +75,560 @@ func (statusErr *statusError) Error() string {
 }
 
 func main() {
-	closeRunLog, setupErr := setupRunLogFile(appName)
-	if setupErr != nil {
-		errorPrintln("Warning: could not initialize run log:", setupErr)
-	} else {
-		defer closeRunLog()
+	processIO := processRuntimeIO()
+	// In a container, stdout is the log.
+	if !containerModeEnabled() {
+		runLog, closeRunLog, setupErr := openRunLogFile(appName)
+		if setupErr != nil {
+			_, _ = fmt.Fprintln(processIO.Stderr, "Warning: could not initialize run log:", setupErr)
+		} else {
+			defer closeRunLog()
+			processIO.RunLog = runLog
+		}
+	}
+
+	if err := run(processIO); err != nil {
+		os.Exit(exitCodeOf(err))
 	}
+}
+
+// run runs the program with runtime as its I/O, as main does with the
+// process's own. A failure is printed as an "Error:" line before it is
+// returned; exitCodeOf gives the exit code for it.
+func run(runtime runtimeIO) error {
+	restoreRuntimeIO := configureRuntimeIO(runtime)
+	defer restoreRuntimeIO()
 
-	if err := run(); err != nil {
+	err := runCommandLine()
+	if err != nil {
 		if statusErr, ok := errors.AsType[*statusError](err); ok {
 			errorPrintln("Error:", statusErr.err)
-			os.Exit(statusErr.code)
+		} else {
+			errorPrintln("Error:", err)
 		}
-		errorPrintln("Error:", err)
-		os.Exit(2)
 	}
+	return err
+}
+
+func exitCodeOf(err error) int {
+	if statusErr, ok := errors.AsType[*statusError](err); ok {
+		return statusErr.code
+	}
+	return 2
+}
+
+func runCommandLine() error {
+	command, hasSubcommand := extractSubcommand()
+	programOptions, args, err := parseCommandLine(hasSubcommand && command.takesArgs)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	lastRun, err := applyLastRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	programOptions.Container = containerModeEnabled()
+	if programOptions.Container {
+		if err := loadSecretFiles(); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+	if strings.TrimSpace(programOptions.ExplainExit) != "" {
+		return runExplainExit(programOptions.ExplainExit)
+	}
+	restoreMessages, err := messages.Configure(programOptions.Locale, nil)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreMessages()
+	restoreConfigDecryption := configureConfigDecryption(programOptions.AgeIdentity)
+	defer restoreConfigDecryption()
+	restoreSecretFixture, err := configureSecretFixture(programOptions.RecordSecrets, programOptions.ReplaySecrets)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreSecretFixture()
+	restoreDirectoryKeySources := configureDirectoryKeySources(programOptions)
+	defer restoreDirectoryKeySources()
+	restorePromptTimeout, err := configurePromptTimeout(programOptions.PromptTimeout)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restorePromptTimeout()
+	restoreOutput, err := configureEventStream(programOptions.Events)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreOutput()
+	if lastRun != nil {
+		outputAnsibleTask("Repeat last run")
+		outputAnsibleHostStatus("ok", "localhost", describeLastRun(lastRun, programOptions))
+	}
+	restoreVerbose := configureVerbose(programOptions.Verbose)
+	defer restoreVerbose()
+	restoreSSHDebug := configureSSHDebug(programOptions.DebugSSH)
+	defer restoreSSHDebug()
+	restoreConnectionRate, err := configureConnectionRate(programOptions.ConnectRate)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreConnectionRate()
+	restoreHostPacing, err := configureHostPacing(programOptions.HostDelay, programOptions.HostJitter)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreHostPacing()
+	restoreIPSGuard, err := configureIPSGuard(programOptions.BanPause)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreIPSGuard()
+	restoreCommandLimits, err := configureRemoteCommandLimits(programOptions.CommandTimeout, programOptions.MaxOutput)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreCommandLimits()
+	restoreSSHDPolicy, err := configureSSHDPolicy(programOptions.SSHDPolicy)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreSSHDPolicy()
+	restoreTransport, err := configureTransport(programOptions.Transport)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreTransport()
+	restoreJumpHost, err := configureJumpHost(programOptions.Jump, programOptions.JumpConnections)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer restoreJumpHost()
+	if hasSubcommand {
+		return command.run(programOptions, args)
+	}
+	return runBootstrap(programOptions)
+}
+
+func runBootstrap(programOptions *options) error {
+	return runOperations(programOptions, "")
 }
 
-func run() error {
-	programOptions, err := parseFlags()
+// runOperations runs the remote operations on every target host. A non-empty
+// operationList replaces OPERATIONS, for subcommands that run one operation
+// over the hosts (copy, exec).
+func runOperations(programOptions *options, operationList string) error {
+	startedAt := time.Now()
+	inputReader := newStandardInputReader()
+	runID, err := resolveRunID(programOptions.RunID)
 	if err != nil {
 		return fail(2, "%w", err)
 	}
-	inputReader := bufio.NewReader(os.Stdin)
+	defer setActiveRunID(runID)()
+	if err := validatePlanFormat(programOptions.PlanFormat); err != nil {
+		return fail(2, "%w", err)
+	}
+	if strings.TrimSpace(programOptions.Report) != "" {
+		if _, err := reportFormatForPath(programOptions.Report); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+	// A JSON plan owns stdout; progress output moves to stderr.
+	var planOutput io.Writer
+	if strings.EqualFold(strings.TrimSpace(programOptions.PlanFormat), planFormatJSON) {
+		var restoreOutput func()
+		planOutput, restoreOutput = moveHumanOutputToStderr()
+		defer restoreOutput()
+	}
 
-	outputAnsibleTask("Load configuration")
+	outputAnsibleTask(messages.Get(messages.TaskLoadConfiguration))
 	if err := applyConfigFiles(programOptions, inputReader); err != nil {
 		return fail(2, "%w", err)
 	}
+	if err := checkFilePermissions(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	if err := applyCloudPreset(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	defer configureAcceptNewHostKeys(programOptions.AcceptNewHostKeys)()
 	outputAnsibleHostStatus("ok", "localhost", "")
+	var configWatch *configDirWatch
+	if programOptions.Watch > 0 {
+		configWatch = newConfigDirWatch(programOptions)
+	}
 
-	outputAnsibleTask("Validate options")
+	outputAnsibleTask(messages.Get(messages.TaskValidateOptions))
 	if err := validateOptions(programOptions); err != nil {
 		return fail(2, "%w", err)
 	}
+	if operationList == "" {
+		operationList = programOptions.Operations
+	}
+	remoteOperations, err := selectRemoteOperations(operationList)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	usesPublicKey := operationsUsePublicKey(remoteOperations)
+	fileCopy, err := loadRemoteFileCopy(programOptions, remoteOperations)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	remoteCommand, err := remoteCommandFor(programOptions, remoteOperations)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	keyExpiry, err := parseKeyExpiry(programOptions.KeyExpires)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
 	outputAnsibleHostStatus("ok", "localhost", "")
 
-	outputAnsibleTask("Collect missing inputs")
-	if err := fillMissingInputs(inputReader, programOptions); err != nil {
+	if programOptions.StreamHosts {
+		return runStreamedHosts(programOptions, streamedRun{
+			operationList: operationList,
+			runID:         runID,
+			startedAt:     startedAt,
+			inputReader:   inputReader,
+			operations:    remoteOperations,
+			usesPublicKey: usesPublicKey,
+			fileCopy:      fileCopy,
+			remoteCommand: remoteCommand,
+			keyExpiry:     keyExpiry,
+		})
+	}
+
+	// The servers file is read before any prompt so a host list piped on stdin
+	// is never mistaken for prompt answers.
+	var serversFileEntries []string
+	var serversFileNotes map[string]serverEntryNotes
+	if strings.TrimSpace(programOptions.ServersFile) != "" {
+		outputAnsibleTask(messages.Get(messages.TaskReadServersFile))
+		serversFileEntries, serversFileNotes, err = readServersFileWithNotes(programOptions.ServersFile, inputReader)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d entry(ies) from %s", len(serversFileEntries), serversFileLabel(programOptions.ServersFile)))
+	}
+	if strings.TrimSpace(programOptions.Discover) != "" {
+		outputAnsibleTask("Discover hosts")
+		discoveredHosts, err := discoverHosts(inputReader, programOptions)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, discoveredHosts...)
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d discovered host(s) selected", len(discoveredHosts)))
+	}
+	if strings.TrimSpace(programOptions.HostsFile) != "" {
+		outputAnsibleTask("Read hosts file")
+		hostsFileEntries, err := readHostsFile(programOptions.HostsFile)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, hostsFileEntries...)
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) from %s", len(hostsFileEntries), programOptions.HostsFile))
+	}
+	if strings.TrimSpace(programOptions.NmapXML) != "" {
+		outputAnsibleTask("Read scan report")
+		scanEntries, err := readScanXML(programOptions.NmapXML, programOptions.Port)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, scanEntries...)
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) with port %d open in %s", len(scanEntries), programOptions.Port, programOptions.NmapXML))
+	}
+	if strings.TrimSpace(programOptions.NetBoxURL) != "" {
+		outputAnsibleTask("Read NetBox inventory")
+		netboxEntries, skipped, err := readNetBoxInventory(programOptions)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, netboxEntries...)
+		message := fmt.Sprintf("%d device(s) from %s", len(netboxEntries), programOptions.NetBoxURL)
+		if skipped > 0 {
+			message += fmt.Sprintf(", %d without a primary IP skipped", skipped)
+		}
+		outputAnsibleHostStatus("ok", "localhost", message)
+	}
+	if strings.TrimSpace(programOptions.ZabbixURL) != "" {
+		outputAnsibleTask("Read Zabbix inventory")
+		zabbixEntries, skipped, err := readZabbixInventory(programOptions)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, zabbixEntries...)
+		message := fmt.Sprintf("%d monitored host(s) from %s", len(zabbixEntries), programOptions.ZabbixURL)
+		if skipped > 0 {
+			message += fmt.Sprintf(", %d without an agent interface skipped", skipped)
+		}
+		outputAnsibleHostStatus("ok", "localhost", message)
+	}
+	if strings.TrimSpace(programOptions.NagiosCfg) != "" {
+		outputAnsibleTask("Read Nagios config")
+		nagiosEntries, err := readNagiosConfig(programOptions.NagiosCfg)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, nagiosEntries...)
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d monitored host(s) from %s", len(nagiosEntries), programOptions.NagiosCfg))
+	}
+	if strings.TrimSpace(programOptions.LDAPURL) != "" {
+		outputAnsibleTask("Read LDAP computers")
+		ldapEntries, skipped, err := readLDAPInventory(programOptions)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		serversFileEntries = append(serversFileEntries, ldapEntries...)
+		message := fmt.Sprintf("%d computer(s) from %s", len(ldapEntries), programOptions.LDAPBase)
+		if skipped > 0 {
+			message += fmt.Sprintf(", %d without a dNSHostName skipped", skipped)
+		}
+		outputAnsibleHostStatus("ok", "localhost", message)
+	}
+
+	if strings.TrimSpace(programOptions.KeysDir) != "" {
+		outputAnsibleTask("Review team keys")
+		if err := reviewKeysDir(inputReader, programOptions); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+
+	outputAnsibleTask(messages.Get(messages.TaskCollectMissingInputs))
+	if strings.TrimSpace(programOptions.EnvFile) == "" && strings.TrimSpace(programOptions.ConfigFile) == "" && strings.TrimSpace(programOptions.ConfigDir) == "" && currentPrompter().Interactive(standardInputFile()) {
+		outputPrintln(messages.Get(messages.NoConfigLoaded, appName))
+	}
+	if err := fillMissingInputs(inputReader, programOptions, usesPublicKey); err != nil {
 		return fail(2, "%w", err)
 	}
 	outputAnsibleHostStatus("ok", "localhost", "")
 
-	outputAnsibleTask("Resolve target hosts")
-	hosts, err := resolveHosts(programOptions.Server, programOptions.Servers, programOptions.Port)
+	outputAnsibleTask(messages.Get(messages.TaskResolveTargetHosts))
+	hosts, hostSpecs, err := resolveTargetHosts(programOptions, serversFileEntries)
 	if err != nil {
 		return fail(2, "%w", err)
 	}
-	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) queued", len(hosts)))
+	outputAnsibleHostStatus("ok", "localhost", messages.Get(messages.StatusHostsQueued, len(hosts)))
+	hosts = reportHostDuplicates(programOptions, hosts)
+	hosts = reportHostLatencyOrder(programOptions, hosts)
+	emitEvent(runEvent{Event: "run_started", Hosts: len(hosts)})
+
+	hostPasswords := map[string]string{}
+	if hasHostPasswordSecretRefs(programOptions) {
+		outputAnsibleTask("Resolve host secrets")
+		hostPasswords, err = resolveHostPasswords(programOptions, hosts, hostSpecs)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		if needsFallbackPassword(hosts, hostPasswords) {
+			if err := fillMissingPassword(inputReader, programOptions); err != nil {
+				return fail(2, "%w", err)
+			}
+		}
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host password(s) resolved", len(hostPasswords)))
+	}
+	if err := checkSharedPasswordLimit(programOptions, hosts, hostPasswords); err != nil {
+		return fail(2, "%w", err)
+	}
 
-	outputAnsibleTask("Resolve public key")
-	publicKey, err := resolvePublicKey(programOptions.KeyInput)
+	var publicKeys map[string][]string
+	var keyInputs map[string]string
+	if usesPublicKey {
+		outputAnsibleTask(messages.Get(messages.TaskResolvePublicKey))
+		publicKeys, keyInputs, err = resolveHostPublicKeys(programOptions, hosts, hostSpecs)
+		if err != nil {
+			return fail(2, "%w", err)
+		}
+		outputAnsibleHostStatus("ok", "localhost", "")
+	}
+
+	settings := buildHostSettings(programOptions, hosts, hostSpecs, hostPasswords, publicKeys, keyInputs)
+	validationHost, err := selectAuthValidationHost(programOptions.ValidateAuth, hosts, programOptions.Port)
 	if err != nil {
 		return fail(2, "%w", err)
 	}
-	outputAnsibleHostStatus("ok", "localhost", "")
+	plan := buildRunPlan(programOptions, runID, hosts, remoteOperations, settings)
+	if planOutput != nil {
+		return writeRunPlanJSON(planOutput, plan)
+	}
+	printRunPlan(plan)
+	if strings.TrimSpace(programOptions.PlanFormat) != "" {
+		return nil
+	}
+	if err := confirmRunPlan(inputReader, len(hosts), programOptions.ConfirmOver, programOptions.AssumeYes); err != nil {
+		return fail(2, "%w", err)
+	}
+	if strings.TrimSpace(programOptions.ApproveCmd) != "" {
+		if err := approveRunPlan(programOptions.ApproveCmd, plan); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+
+	unlockRun, err := lockRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer unlockRun()
 
-	outputAnsibleTask("Build SSH client configuration")
+	outputAnsibleTask(messages.Get(messages.TaskBuildSSHConfiguration))
 	clientConfig, err := buildSSHConfig(programOptions)
 	if err != nil {
 		return fail(2, "%w", err)
 	}
 	outputAnsibleHostStatus("ok", "localhost", "")
 
-	outputAnsibleTask("Add authorized key")
-	failures := 0
-	hostRecaps := make(map[string]hostRunRecap, len(hosts))
-	for _, host := range hosts {
-		if err := addAuthorizedKeyWithStatus(host, publicKey, clientConfig, nil); err != nil {
-			failures++
-			hostRecaps[host] = hostRunRecap{
-				failed:  1,
-				ok:      0,
-				changed: 0,
+	executor, err := newRemoteExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+
+	authMethods := authMethodOrder(programOptions)
+	clientConfigForHost := func(host string) *ssh.ClientConfig {
+		return clientConfigForLogin(clientConfig, authMethods, settings[host].User, settings[host].Password)
+	}
+	upHosts := hosts
+	var notUpHosts map[string]error
+	if programOptions.WaitUp > 0 {
+		outputAnsibleTask("Wait for SSH")
+		notUpHosts = waitForSSH(hosts, programOptions.WaitUp, time.Duration(programOptions.TimeoutSec)*time.Second)
+		upHosts = make([]string, 0, len(hosts))
+		for _, host := range hosts {
+			if _, notUp := notUpHosts[host]; !notUp {
+				upHosts = append(upHosts, host)
 			}
-			outputAnsibleHostStatus("failed", host, err.Error())
-			continue
 		}
-		hostRecaps[host] = hostRunRecap{
-			ok:      1,
-			changed: 1,
-			failed:  0,
+		if err, notUp := notUpHosts[validationHost]; notUp {
+			exitCode := hostFailureExitCode([]string{validationHost}, map[string]hostRunRecap{validationHost: {failed: 1, lastErr: err}})
+			return fail(exitCode, "%s did not come up for the credential check; no other host was contacted", validationHost)
 		}
-		outputAnsibleHostStatus("changed", host, "")
+	}
+	if validationHost != "" {
+		outputAnsibleTask("Validate credentials")
+		if err := executor.connect(validationHost, settings[validationHost].User, clientConfigForHost(validationHost)); err != nil {
+			outputAnsibleHostStatus("failed", validationHost, err.Error())
+			outputFailureHint(err)
+			exitCode := hostFailureExitCode([]string{validationHost}, map[string]hostRunRecap{validationHost: {failed: 1, lastErr: err}})
+			return fail(exitCode, "credential check on %s failed; no other host was contacted", validationHost)
+		}
+		outputAnsibleHostStatus("ok", validationHost, "authenticated as "+loginUser(executor, validationHost, settings[validationHost].User))
+	}
+	inputForHost := func(host string) remoteOperationInput {
+		return remoteOperationInputFor(programOptions, host, settings[host], fileCopy, remoteCommand)
+	}
+	stopStatusLine := startStatusLine(programOptions)
+	defer stopStatusLine()
+	stopRunControl := startRunControl(programOptions)
+	defer stopRunControl()
+	hostRecaps, failedHosts := executeRemoteOperations(executor, upHosts, remoteOperations, clientConfigForHost, inputForHost)
+	for host, err := range notUpHosts {
+		hostRecaps[host] = hostRunRecap{failed: 1, lastErr: err}
+		failedHosts[host] = true
+	}
+	if programOptions.Watch > 0 && runMayDispatch() {
+		watchFailedHosts(programOptions.Watch, programOptions.WatchInterval, hosts, hostRecaps, failedHosts, func(retryHosts []string) (map[string]hostRunRecap, map[string]bool) {
+			reloadHostSettings(configWatch, programOptions, retryHosts, hostSpecs, usesPublicKey, settings)
+			return executeRemoteOperations(executor, retryHosts, remoteOperations, clientConfigForHost, inputForHost)
+		})
+	}
+
+	notesByHost := serverNotesByHost(serversFileNotes, programOptions.Port)
+	return finishRun(programOptions, runOutcome{
+		operationList: operationList,
+		runID:         runID,
+		startedAt:     startedAt,
+		operations:    remoteOperations,
+		keyExpiry:     keyExpiry,
+		hosts:         hosts,
+		hostRecaps:    hostRecaps,
+		failedHosts:   failedHosts,
+		notesByHost:   notesByHost,
+		hostGroups:    hostGroupsFor(hosts, hostSpecs, notesByHost),
+		installedKeys: func(host string) (string, []string) {
+			return loginUser(executor, host, settings[host].User), append([]string{settings[host].PublicKey}, settings[host].ExtraPublicKeys...)
+		},
+	})
+}
+
+// remoteOperationInputFor is what the operations get to work with on host.
+func remoteOperationInputFor(programOptions *options, host string, hostSetting hostSettings, fileCopy remoteFileCopy, remoteCommand string) remoteOperationInput {
+	identityFile := programOptions.IdentityFile
+	if strings.TrimSpace(identityFile) == "" {
+		identityFile = defaultIdentityFile(hostSetting.KeyInput)
+	}
+	return remoteOperationInput{
+		Host:            host,
+		User:            hostSetting.User,
+		PublicKey:       hostSetting.PublicKey,
+		ExtraPublicKeys: hostSetting.ExtraPublicKeys,
+		Password:        hostSetting.Password,
+		IdentityFile:    identityFile,
+		// A stamped comment replaces the comment of an already installed copy of the key.
+		ReplaceKeyComment: strings.TrimSpace(programOptions.KeyComment) != "",
+		CreateHome:        programOptions.CreateHome,
+		File:              fileCopy,
+		Command:           remoteCommand,
+	}
+}
+
+// runOutcome is what a finished run hands to finishRun.
+type runOutcome struct {
+	operationList string
+	runID         string
+	startedAt     time.Time
+	operations    []remoteOperation
+	keyExpiry     string
+	hosts         []string
+	hostRecaps    map[string]hostRunRecap
+	failedHosts   map[string]bool
+	notesByHost   map[string]serverEntryNotes
+	hostGroups    map[string]string
+	// installedKeys returns the login user and the keys installed on a host,
+	// for the ledger.
+	installedKeys func(host string) (string, []string)
+}
+
+// finishRun writes the post-run files and ledger, prints the recap and
+// returns the run's exit error.
+func finishRun(programOptions *options, outcome runOutcome) error {
+	runID, hosts, hostRecaps, failedHosts, keyExpiry := outcome.runID, outcome.hosts, outcome.hostRecaps, outcome.failedHosts, outcome.keyExpiry
+	reportFailedHosts(programOptions, runID, hosts, hostRecaps, outcome.notesByHost)
+	reportLastRun(programOptions, outcome.operationList, runID, hosts, failedHosts)
+	report := buildRunReport(runID, outcome.startedAt, time.Now(), outcome.operations, hosts, hostRecaps)
+	reportRun(programOptions, report)
+	reportResultsCSV(programOptions, report)
+
+	recordLedger := programOptions.RecordLedger || strings.TrimSpace(programOptions.LedgerFile) != "" || keyExpiry != ""
+	if recordLedger && containsRemoteOperation(outcome.operations, defaultRemoteOperationName) {
+		outputAnsibleTask("Record installation in ledger")
+		recordedHosts, err := recordInstalledKey(programOptions.LedgerFile, runID, hosts, failedHosts, outcome.installedKeys, keyExpiry)
+		if err != nil {
+			outputAnsibleHostStatus("failed", "localhost", err.Error())
+			outputAnsiblePlayRecap(hosts, hostRecaps)
+			outputGroupRecap(hosts, hostRecaps, outcome.hostGroups)
+			return fail(exitHostFailure, "record installation: %w", err)
+		}
+		message := fmt.Sprintf("%d host(s) recorded (run %s)", recordedHosts, runID)
+		if keyExpiry != "" {
+			message += ", expires " + keyExpiry
+		}
+		outputAnsibleHostStatus("ok", "localhost", message)
 	}
 
 	outputAnsiblePlayRecap(hosts, hostRecaps)
-	if failures > 0 {
-		return fail(1, "%d host(s) failed", failures)
+	outputGroupRecap(hosts, hostRecaps, outcome.hostGroups)
+	emitEvent(runEvent{Event: "run_finished", Hosts: len(hosts), Failed: len(failedHosts)})
+	if len(failedHosts) > 0 {
+		return fail(hostFailureExitCode(hosts, hostRecaps), "%d host(s) failed (%s)", len(failedHosts), describeHostFailureCategories(hostFailureCategoryCounts(hosts, hostRecaps)))
 	}
 
 	return nil
 }
 
 func parseFlags() (*options, error) {
+	programOptions, _, err := parseCommandLine(false)
+	return programOptions, err
+}
+
+func parseCommandLine(acceptsArgs bool) (*options, []string, error) {
 	programOptions := &options{
 		Port:                  defaultSSHPort,
 		TimeoutSec:            defaultTimeoutSeconds,
@@ -161,20 +647,240 @@ func parseFlags() (*options, error) {
 
 	flag.Usage = func() {
 		output := flag.CommandLine.Output()
-		fmt.Fprintf(output, "Usage: %s [--env <path>]\n\n", appName)
+		fmt.Fprintf(output, "Usage: %s [--env <path>] [options]\n\n", appName)
 		fmt.Fprintln(output, "Config:")
 		fmt.Fprintln(output, "  --env <path>               .env config file")
+		fmt.Fprintln(output, "  --config <path>            JSON config file (alternative to --env)")
+		fmt.Fprintln(output, "  --context <name>           Use the config set in ~/.config/ssh-key-bootstrap/contexts/<name>")
+		fmt.Fprintln(output, "  --age-identity <path>      age identity for an age-encrypted config")
+		fmt.Fprintln(output, "  --config-from-stdin        Read the .env or JSON config from stdin (e.g. a mounted secret piped in)")
+		fmt.Fprintln(output, "  --config-dir <dir>         Read one file per .env key, e.g. a mounted Kubernetes Secret or ConfigMap")
+		fmt.Fprintln(output, "  --record-secrets <path>    Save every secret provider answer to a fixture file")
+		fmt.Fprintln(output, "  --replay-secrets <path>    Answer secret refs from a recorded fixture instead of the providers")
+		fmt.Fprintln(output, "  --no-interpolate           Keep ${VAR} in config values instead of expanding it from the environment")
+		fmt.Fprintf(output, "  %-26s Language of prompts and task titles (default: from LANG)\n", "--locale <"+strings.Join(messages.Locales(), "|")+">")
+		fmt.Fprintln(output, "  --strict-perms             Fail when config, key or known_hosts files are group/world accessible")
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, "Options:")
+		fmt.Fprintln(output, "  --servers-file <path|->    Read hosts one per line from a file or stdin")
+		fmt.Fprintln(output, "  --lock-file <path>         Run lock shared by concurrent runs (default: run.lock in the state directory)")
+		fmt.Fprintln(output, "  --ignore-lock              Run even when another run holds the run lock")
+		fmt.Fprintln(output, "  --order <sorted|input|random|by-latency>")
+		fmt.Fprintln(output, "                             Order hosts run in (default: sorted); input keeps the inventory order")
+		fmt.Fprintln(output, "  --stream-hosts             Run each --servers-file host as it is read, for very large inventories")
+		fmt.Fprintln(output, "  --hosts-file <path>        Target every name in an /etc/hosts style file (localhost skipped)")
+		fmt.Fprintln(output, "  --discover mdns            Browse _ssh._tcp on the local network and pick hosts from the list")
+		fmt.Fprintln(output, "  --nmap-xml <path>          Target the hosts with the SSH port open in an nmap/masscan XML report")
+		fmt.Fprintln(output, "  --netbox-url <url>         Target the primary IPs of active NetBox devices (token: NETBOX_TOKEN)")
+		fmt.Fprintln(output, "  --netbox-token-ref <ref>   Secret reference of the NetBox API token")
+		fmt.Fprintln(output, "  --netbox-site <slugs>      Only NetBox devices in these sites (comma-separated)")
+		fmt.Fprintln(output, "  --netbox-role <slugs>      Only NetBox devices with these roles (comma-separated)")
+		fmt.Fprintln(output, "  --zabbix-url <url>         Target the agent interfaces of monitored Zabbix hosts (token: ZABBIX_TOKEN)")
+		fmt.Fprintln(output, "  --zabbix-token-ref <ref>   Secret reference of the Zabbix API token")
+		fmt.Fprintln(output, "  --nagios-cfg <path>        Target the hosts defined in a Nagios config file or directory")
+		fmt.Fprintln(output, "  --ldap-url <url>           Target the dNSHostName of enabled AD computer objects (ldaps:// or StartTLS)")
+		fmt.Fprintln(output, "  --ldap-base <dn>           Search base (domain or OU) of the computer objects")
+		fmt.Fprintln(output, "  --ldap-filter <filter>     Only computer objects matching this filter, e.g. (operatingSystem=*Linux*)")
+		fmt.Fprintln(output, "  --ldap-bind-dn <dn>        Bind DN or user@domain (password: LDAP_PASSWORD); anonymous when unset")
+		fmt.Fprintln(output, "  --ldap-password-ref <ref>  Secret reference of the LDAP bind password")
+		fmt.Fprintln(output, "  --key-ldap-url <url>       Directory that ldap:<filter> key inputs (e.g. --key ldap:uid=alice) are read from")
+		fmt.Fprintln(output, "  --key-ldap-base <dn>       Search base of the user entries ldap: key inputs match")
+		fmt.Fprintln(output, "  --ipa-url <url>            FreeIPA server ipa:<user> key inputs (e.g. --key ipa:alice) are read from")
+		fmt.Fprintln(output, "  --ipa-user <name>          FreeIPA account that reads the keys (password: IPA_PASSWORD)")
+		fmt.Fprintln(output, "  --ipa-password-ref <ref>   Secret reference of the FreeIPA password")
+		fmt.Fprintln(output, "  --keycloak-url <url>       Keycloak server keycloak:<user> key inputs are read from (sshPublicKey attribute)")
+		fmt.Fprintln(output, "  --keycloak-realm <realm>   Keycloak realm of the users")
+		fmt.Fprintln(output, "  --keycloak-client-id <id>  Keycloak client that reads the users (secret: KEYCLOAK_CLIENT_SECRET)")
+		fmt.Fprintln(output, "  --keycloak-secret-ref <ref>")
+		fmt.Fprintln(output, "                             Secret reference of the Keycloak client secret")
+		fmt.Fprintln(output, "  --failed-hosts-out <path>  Write failed hosts in --servers-file format")
+		fmt.Fprintln(output, "  --again[=failed]           Repeat the last run (or only its failed hosts); given flags still apply")
+		fmt.Fprintln(output, "  --report <path.md|.html>   Write a post-run report: summary, per-host table, durations, failures")
+		fmt.Fprintln(output, "  --csv <path>               Write host,status,changed,error,duration rows for spreadsheets")
+		fmt.Fprintln(output, "  --confirm-password         Ask for a prompted password twice and compare")
+		fmt.Fprintln(output, "  --prompt-timeout <duration>")
+		fmt.Fprintln(output, "                             Fail when a password prompt gets no answer in time (default 0 = wait)")
+		fmt.Fprintln(output, "  --validate-auth[=<host>]   Log in to the first (or given) host before touching the rest")
+		fmt.Fprintln(output, "  --fallback-users <list>    Users to try when a host refuses the configured user, e.g. ubuntu,ec2-user")
+		fmt.Fprintln(output, "  --preset <aws|gcp|azure|hetzner>")
+		fmt.Fprintln(output, "                             Defaults for fresh cloud images: login user, fallback users, accept new host keys")
+		fmt.Fprintln(output, "  --explain-exit <code|all>  Print what an exit code means")
+		fmt.Fprintln(output, "  --json                     Print JSON where a command supports it (version --json)")
+		fmt.Fprintln(output, "  --events ndjson            Stream lifecycle events as JSON lines on stdout")
+		fmt.Fprintln(output, "  --run-id <id>              Tag logs, events and the ledger with this ID (default: generated)")
+		fmt.Fprintln(output, "  --limit <patterns>         Only target hosts matching globs, ~regex or !exclusions")
+		fmt.Fprintln(output, "  --sample <n|n%>            Target a random subset of the resolved hosts")
+		fmt.Fprintln(output, "  --dedupe-ip                Resolve host names and target each address:port once")
+		fmt.Fprintln(output, "  --plan <text|json>         Print the run plan and exit without connecting")
+		fmt.Fprintln(output, "  --yes                      Skip the confirmation for runs over --confirm-over hosts")
+		fmt.Fprintln(output, "  --confirm-over <n>         Require typing the host count above n hosts (default 20, 0 = never)")
+		fmt.Fprintln(output, "  --approve-cmd <command>    Run only if this command, given the JSON plan on stdin, exits 0")
+		fmt.Fprintln(output, "  --require-per-host-credentials <n>")
+		fmt.Fprintln(output, "                             Refuse to try one password on more than n hosts (0 = no limit)")
+		fmt.Fprintln(output, "  --use-openssh              Run remote commands through the system ssh client")
+		fmt.Fprintln(output, "  --transport <tcp|ssm|teleport|boundary>")
+		fmt.Fprintln(output, "                             Reach hosts over TCP (default), AWS SSM, Teleport or Boundary")
+		fmt.Fprintln(output, "  --jump <[user@]host[:port]>")
+		fmt.Fprintln(output, "                             Reach hosts through this jump host with the built-in client")
+		fmt.Fprintln(output, "  --jump-connections <n>     SSH connections to the jump host shared by all targets (default: 2)")
+		fmt.Fprintln(output, "  --min-host-key-strength <any|sha2|ed25519>")
+		fmt.Fprintln(output, "                             Refuse weaker host keys (sha2: no DSA, SHA-1 RSA or RSA < 2048 bits)")
+		fmt.Fprintln(output, "  --prefer-ed25519           Negotiate ed25519 host keys first when a server offers several")
+		fmt.Fprintln(output, "  --accept-new-host-keys     Trust unknown host keys without asking; changed keys are still refused")
+		fmt.Fprintln(output, "  --expect-fingerprint <host=SHA256:...>")
+		fmt.Fprintln(output, "                             Trust this unknown host without a prompt if its key matches (repeatable)")
+		fmt.Fprintln(output, "  --known-hosts-out <path>   Write newly trusted host keys here instead of known_hosts")
+		fmt.Fprintln(output, "  --known-hosts-dir <dir>    Keep each host's key in its own file in this directory")
+		fmt.Fprintln(output, "  --verbose                  Print each host's SSH server version and login banner")
+		fmt.Fprintln(output, "  --debug-ssh                Log SSH handshake details per host to the run log")
+		fmt.Fprintln(output, "  --rate <n>                 Open at most n new SSH connections per second")
+		fmt.Fprintln(output, "  --delay <duration>         Pause between hosts (e.g. 500ms, 2s)")
+		fmt.Fprintln(output, "  --jitter <duration>        Add a random pause of up to this long between hosts")
+		fmt.Fprintln(output, "  --ban-pause <duration>     Pause once when connection resets suggest an IPS ban (e.g. 10m)")
+		fmt.Fprintln(output, "  --wait-up <duration>       Wait for SSH on hosts that are still booting (e.g. 5m)")
+		fmt.Fprintln(output, "  --command-timeout <duration>")
+		fmt.Fprintln(output, "                             Kill a remote command that runs longer (default 2m, 0 = no limit)")
+		fmt.Fprintln(output, "  --max-output <bytes>       Kill a remote command that prints more (default 1048576, 0 = no limit)")
+		fmt.Fprintln(output, "  --watch <duration>         Keep retrying unreachable hosts for this long (e.g. 1h)")
+		fmt.Fprintln(output, "  --watch-interval <duration>")
+		fmt.Fprintln(output, "                             Pause between --watch retry rounds (default 1m)")
+		fmt.Fprintln(output, "  --create-home              Create the login user's home directory when it is missing")
+		fmt.Fprintln(output, "  --src <path>               Local file for the copy-file operation (copy subcommand)")
+		fmt.Fprintln(output, "  --dest <path>              Remote path for copy-file: absolute (written as root) or ~/...")
+		fmt.Fprintln(output, "  --mode <octal>             Mode of the copied file, e.g. 0440 (default: the source file's)")
+		fmt.Fprintln(output, "  --cmd <command>            Command for the run-command operation (exec subcommand)")
+		fmt.Fprintln(output, "  --schedule <calendar>      When install-service runs: a systemd OnCalendar value or cron schedule (default daily)")
+		fmt.Fprintln(output, "  --service-dir <dir>        Where install-service writes its units (default: the systemd user or system dir)")
+		fmt.Fprintln(output, "  --cron                     Make install-service print a crontab line instead of systemd units")
+		fmt.Fprintln(output, "  --sshd-policy <rules>      Rules for the audit-sshd operation, e.g. passwordauthentication=no,permitrootlogin=no")
+		fmt.Fprintln(output, "  --key <key|path>           Also install this key (repeatable; merged with KEY by fingerprint)")
+		fmt.Fprintln(output, "  --key-file <path>          Also install every key in this file (repeatable)")
+		fmt.Fprintln(output, "  --keys-dir <dir>           Review and install every *.pub key in this directory")
+		fmt.Fprintln(output, "  --key-policy <rules>       Refuse weak keys: min-rsa-bits=<n>,no-dsa,no-ecdsa,no-rsa,comment-newer-than=<date>")
+		fmt.Fprintln(output, "  --comment <text>           Rewrite the installed key comment ({user}, {date}, {run}, {comment})")
+		fmt.Fprintln(output, "  --expires <YYYY-MM-DD>     Record an expiry for the installed key in the ledger")
+		fmt.Fprintln(output, "  --record                   Record installed keys in the local ledger")
+		fmt.Fprintln(output, "  --ledger <path>            Ledger file; implies --record (default: in $XDG_STATE_HOME/ssh-key-bootstrap,")
+		fmt.Fprintln(output, "                             or a legacy ledger already next to the binary)")
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, "Commands:")
+		for _, command := range registeredSubcommands() {
+			fmt.Fprintf(output, "  %-26s %s\n", command.usage, command.summary)
+		}
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, "Exit codes (see --explain-exit all):")
+		for _, info := range exitCodeTable() {
+			fmt.Fprintf(output, "  %d  %s\n", info.code, info.name)
+		}
 		fmt.Fprintln(output)
 		fmt.Fprintln(output, "Any missing values are prompted interactively.")
 	}
 
 	flag.StringVar(&programOptions.EnvFile, "env", "", "Path to .env config file")
+	flag.StringVar(&programOptions.ConfigFile, "config", "", "Path to JSON config file")
+	flag.StringVar(&programOptions.Context, "context", "", "Named config set in the user config dir's contexts/ (replaces --env/--config)")
+	flag.StringVar(&programOptions.AgeIdentity, "age-identity", "", "age identity file for decrypting an age-encrypted config")
+	flag.BoolVar(&programOptions.ConfigFromStdin, "config-from-stdin", false, "Read the .env or JSON config from stdin instead of a file")
+	flag.StringVar(&programOptions.ConfigDir, "config-dir", "", "Directory with one file per .env key, such as a mounted Kubernetes Secret")
+	flag.StringVar(&programOptions.RecordSecrets, "record-secrets", "", "Save every secret provider answer to this fixture file")
+	flag.StringVar(&programOptions.ReplaySecrets, "replay-secrets", "", "Answer secret refs from this fixture file instead of the providers")
+	flag.BoolVar(&programOptions.NoInterpolate, "no-interpolate", false, "Keep ${VAR} in config values literally")
+	flag.StringVar(&programOptions.Locale, "locale", "", "Language of prompts and task titles: "+strings.Join(messages.Locales(), ", "))
+	flag.BoolVar(&programOptions.StrictPerms, "strict-perms", false, "Fail instead of warn on group/world accessible config and key files")
+	flag.StringVar(&programOptions.Discover, "discover", "", "Find hosts on the local network (mdns) and choose which to target")
+	flag.StringVar(&programOptions.HostsFile, "hosts-file", "", "Target the names in an /etc/hosts style file")
+	flag.StringVar(&programOptions.NmapXML, "nmap-xml", "", "Target the hosts with the SSH port open in an nmap/masscan XML report")
+	flag.StringVar(&programOptions.NetBoxURL, "netbox-url", "", "NetBox base URL; target the primary IPs of its active devices")
+	flag.StringVar(&programOptions.NetBoxTokenRef, "netbox-token-ref", "", "Secret reference of the NetBox API token (default: NETBOX_TOKEN)")
+	flag.StringVar(&programOptions.NetBoxSite, "netbox-site", "", "Comma-separated NetBox site slugs to target")
+	flag.StringVar(&programOptions.NetBoxRole, "netbox-role", "", "Comma-separated NetBox device role slugs to target")
+	flag.StringVar(&programOptions.ZabbixURL, "zabbix-url", "", "Zabbix frontend URL; target the agent interfaces of its monitored hosts")
+	flag.StringVar(&programOptions.ZabbixTokenRef, "zabbix-token-ref", "", "Secret reference of the Zabbix API token (default: ZABBIX_TOKEN)")
+	flag.StringVar(&programOptions.NagiosCfg, "nagios-cfg", "", "Target the hosts defined in a Nagios object config file, directory or nagios.cfg")
+	flag.StringVar(&programOptions.LDAPURL, "ldap-url", "", "LDAP server URL; target the dNSHostName of its enabled computer objects")
+	flag.StringVar(&programOptions.LDAPBase, "ldap-base", "", "LDAP search base (domain or OU) of the computer objects")
+	flag.StringVar(&programOptions.LDAPFilter, "ldap-filter", "", "LDAP filter the computer objects must match as well")
+	flag.StringVar(&programOptions.LDAPBindDN, "ldap-bind-dn", "", "LDAP bind DN or user@domain (default: anonymous)")
+	flag.StringVar(&programOptions.LDAPPasswordRef, "ldap-password-ref", "", "Secret reference of the LDAP bind password (default: LDAP_PASSWORD)")
+	flag.StringVar(&programOptions.KeyLDAPURL, "key-ldap-url", "", "LDAP server URL ldap:<filter> key inputs read sshPublicKey values from")
+	flag.StringVar(&programOptions.KeyLDAPBase, "key-ldap-base", "", "LDAP search base of the user entries ldap: key inputs match")
+	flag.StringVar(&programOptions.IPAURL, "ipa-url", "", "FreeIPA server URL ipa:<user> key inputs read SSH keys from")
+	flag.StringVar(&programOptions.IPAUser, "ipa-user", "", "FreeIPA account that reads the keys (password: IPA_PASSWORD)")
+	flag.StringVar(&programOptions.IPAPasswordRef, "ipa-password-ref", "", "Secret reference of the FreeIPA password (default: IPA_PASSWORD)")
+	flag.StringVar(&programOptions.KeycloakURL, "keycloak-url", "", "Keycloak URL keycloak:<user> key inputs read the sshPublicKey attribute from")
+	flag.StringVar(&programOptions.KeycloakRealm, "keycloak-realm", "", "Keycloak realm of the users")
+	flag.StringVar(&programOptions.KeycloakClientID, "keycloak-client-id", "", "Keycloak client whose service account reads the users")
+	flag.StringVar(&programOptions.KeycloakSecretRef, "keycloak-secret-ref", "", "Secret reference of the Keycloak client secret (default: KEYCLOAK_CLIENT_SECRET)")
+	flag.StringVar(&programOptions.ServersFile, "servers-file", "", "Path to a file with one host per line (- for stdin)")
+	flag.StringVar(&programOptions.LockFile, "lock-file", "", "Advisory lock file that keeps concurrent runs apart (default: run.lock in the state directory)")
+	flag.BoolVar(&programOptions.IgnoreLock, "ignore-lock", false, "Run even when another run holds the run lock")
+	flag.StringVar(&programOptions.Order, "order", "", "Order hosts run in: sorted (default), input, random or by-latency")
+	flag.BoolVar(&programOptions.StreamHosts, "stream-hosts", false, "Run each servers-file host as soon as it is read instead of loading the whole file first")
+	flag.Var(againFlag{target: &programOptions.Again}, "again", "Repeat the last run with its saved options (--again=failed: only the hosts that failed)")
+	flag.StringVar(&programOptions.FailedHostsOut, "failed-hosts-out", "", "Write hosts that failed to this file (servers-file format)")
+	flag.StringVar(&programOptions.Report, "report", "", "Write a post-run report (.md or .html)")
+	flag.StringVar(&programOptions.CSVFile, "csv", "", "Write per-host results as CSV")
+	flag.BoolVar(&programOptions.ConfirmPassword, "confirm-password", false, "Ask for a prompted password twice and compare")
+	flag.DurationVar(&programOptions.PromptTimeout, "prompt-timeout", 0, "Fail when a password prompt gets no answer within this long (0 = wait)")
+	flag.Var(authValidationFlag{target: &programOptions.ValidateAuth}, "validate-auth", "Log in to the first host (or --validate-auth=<host>) before the rest")
+	flag.StringVar(&programOptions.FallbackUsers, "fallback-users", "", "Comma-separated users to try when a host refuses the configured user")
+	flag.StringVar(&programOptions.Preset, "preset", "", "Cloud defaults for fresh images: aws, gcp, azure or hetzner")
+	flag.StringVar(&programOptions.ExplainExit, "explain-exit", "", "Print the meaning of an exit code (or all) and exit")
+	flag.BoolVar(&programOptions.JSONOutput, "json", false, "Print JSON where the command supports it (version)")
+	flag.StringVar(&programOptions.Events, "events", "", "Event stream format on stdout (ndjson)")
+	flag.StringVar(&programOptions.RunID, "run-id", "", "Run ID for logs, events and the ledger (default: generated)")
+	flag.StringVar(&programOptions.Limit, "limit", "", "Comma-separated host globs, ~regex or !exclusions to target")
+	flag.BoolVar(&programOptions.DedupeIP, "dedupe-ip", false, "Resolve host names and drop targets that reach the same address and port as an earlier one")
+	flag.StringVar(&programOptions.Sample, "sample", "", "Random subset of hosts to target (count or percentage)")
+	flag.StringVar(&programOptions.PlanFormat, "plan", "", "Print the run plan (text or json) and exit")
+	flag.BoolVar(&programOptions.AssumeYes, "yes", false, "Skip the large-run confirmation")
+	flag.IntVar(&programOptions.ConfirmOver, "confirm-over", defaultConfirmHostsAbove, "Ask before running on more than this many hosts (0 = never)")
+	flag.StringVar(&programOptions.ApproveCmd, "approve-cmd", "", "Shell command that gets the JSON plan on stdin; the run goes on only when it exits 0")
+	flag.IntVar(&programOptions.MaxHostsPerPassword, "require-per-host-credentials", 0, "Refuse to try one password on more than this many hosts (0 = no limit)")
+	flag.BoolVar(&programOptions.UseOpenSSH, "use-openssh", false, "Run remote commands through the system ssh client")
+	flag.StringVar(&programOptions.Transport, "transport", defaultTransportName, "Connection transport for the built-in client: tcp, ssm, teleport or boundary")
+	flag.StringVar(&programOptions.Jump, "jump", "", "Jump host, [user@]host[:port], the built-in client reaches hosts through")
+	flag.IntVar(&programOptions.JumpConnections, "jump-connections", defaultJumpConnections, "SSH connections to the jump host shared by all targets")
+	flag.StringVar(&programOptions.MinHostKeyStrength, "min-host-key-strength", hostKeyStrengthAny, "Weakest accepted host key: any, sha2 or ed25519")
+	flag.BoolVar(&programOptions.PreferED25519, "prefer-ed25519", false, "Negotiate ed25519 host keys first when a server offers several")
+	flag.BoolVar(&programOptions.AcceptNewHostKeys, "accept-new-host-keys", false, "Trust unknown host keys without the prompt; changed keys are still refused")
+	flag.Var(repeatedFlag{values: &programOptions.ExpectFingerprints}, "expect-fingerprint", "Trust an unknown host whose key has this fingerprint (host=SHA256:..., repeatable)")
+	flag.StringVar(&programOptions.KnownHostsOut, "known-hosts-out", "", "Write newly trusted host keys to this file instead of known_hosts")
+	flag.StringVar(&programOptions.KnownHostsDir, "known-hosts-dir", "", "Directory with one known_hosts file per host; newly trusted keys are written there")
+	flag.BoolVar(&programOptions.Verbose, "verbose", false, "Print each host's SSH server version and pre-auth banner")
+	flag.BoolVar(&programOptions.DebugSSH, "debug-ssh", false, "Log SSH handshake details (version, kex, ciphers, auth methods) to the run log")
+	flag.BoolVar(&programOptions.CreateHome, "create-home", false, "Create the login user's home directory (from getent passwd) when it is missing")
+	flag.StringVar(&programOptions.CopySource, "src", "", "Local file the copy-file operation pushes")
+	flag.StringVar(&programOptions.CopyDest, "dest", "", "Remote path for copy-file: absolute, or ~/ for the login user's home")
+	flag.StringVar(&programOptions.CopyMode, "mode", "", "Octal mode of the copied file (default: the source file's mode)")
+	flag.StringVar(&programOptions.RemoteCommand, "cmd", "", "Command the run-command operation runs on every host")
+	flag.StringVar(&programOptions.ServiceSchedule, "schedule", "", "When install-service runs: a systemd OnCalendar value, or a cron schedule with --cron (default daily)")
+	flag.StringVar(&programOptions.ServiceDir, "service-dir", "", "Directory install-service writes its systemd units to")
+	flag.BoolVar(&programOptions.ServiceCron, "cron", false, "Make install-service print a crontab line instead of writing systemd units")
+	flag.StringVar(&programOptions.SSHDPolicy, "sshd-policy", "", "Comma-separated directive=value[|value] rules for audit-sshd (default: "+defaultSSHDPolicy+")")
+	flag.IntVar(&programOptions.ConnectRate, "rate", 0, "Maximum new SSH connections per second (0 = unlimited)")
+	flag.DurationVar(&programOptions.HostDelay, "delay", 0, "Pause between hosts")
+	flag.DurationVar(&programOptions.HostJitter, "jitter", 0, "Maximum random extra pause between hosts")
+	flag.DurationVar(&programOptions.BanPause, "ban-pause", 0, "Pause the run this long when connection resets suggest fail2ban/DenyHosts is banning this machine")
+	flag.DurationVar(&programOptions.WaitUp, "wait-up", 0, "Wait up to this long for each host's SSH port to answer before starting")
+	flag.DurationVar(&programOptions.CommandTimeout, "command-timeout", defaultCommandTimeout, "Kill a remote command that runs longer than this (0 = no limit)")
+	flag.IntVar(&programOptions.MaxOutput, "max-output", defaultMaxCommandOutput, "Kill a remote command that prints more than this many bytes (0 = no limit)")
+	flag.DurationVar(&programOptions.Watch, "watch", 0, "Keep retrying unreachable hosts for up to this long")
+	flag.DurationVar(&programOptions.WatchInterval, "watch-interval", defaultWatchInterval, "Pause between --watch retry rounds")
+	flag.Var(repeatedFlag{values: &programOptions.KeyInputs}, "key", "Public key text or path to install in addition to KEY (repeatable)")
+	flag.Var(repeatedFlag{values: &programOptions.KeyFiles}, "key-file", "File of public keys to install in addition to KEY (repeatable)")
+	flag.StringVar(&programOptions.KeysDir, "keys-dir", "", "Directory whose *.pub keys are reviewed and installed in addition to KEY")
+	flag.StringVar(&programOptions.KeyPolicy, "key-policy", "", "Rules the installed key must pass (min-rsa-bits=<n>, no-dsa, no-ecdsa, no-rsa, comment-newer-than=<date>)")
+	flag.StringVar(&programOptions.KeyComment, "comment", "", "Comment template for the installed key")
+	flag.StringVar(&programOptions.KeyExpires, "expires", "", "Expiry date (YYYY-MM-DD) recorded in the ledger")
+	flag.StringVar(&programOptions.LedgerFile, "ledger", "", "Path to the installation ledger")
+	flag.BoolVar(&programOptions.RecordLedger, "record", false, "Record installed keys in the ledger")
 
 	flag.Parse()
-	if flag.NArg() > 0 {
-		return nil, fmt.Errorf("unexpected positional arguments: %s", strings.Join(flag.Args(), ", "))
+	if flag.NArg() > 0 && !acceptsArgs {
+		return nil, nil, fmt.Errorf("unexpected positional arguments: %s", strings.Join(flag.Args(), ", "))
 	}
-	return programOptions, nil
+	return programOptions, flag.Args(), nil
 }
 
 func normalizeHelpArg() {
@@ -210,4 +916,18 @@ func outputAnsiblePlayRecap(hosts []string, hostRecaps map[string]hostRunRecap)
 		recap := hostRecaps[hostName]
 		outputPrintf("%-24s : ok=%d changed=%d unreachable=0 failed=%d\n", hostName, recap.ok, recap.changed, recap.failed)
 	}
+	if runID := currentRunID(); runID != "" {
+		outputPrintf("%-24s : %s\n", "run", runID)
+	}
+	categoryCounts := hostFailureCategoryCounts(hosts, hostRecaps)
+	if len(categoryCounts) == 0 {
+		return
+	}
+	outputPrintln()
+	outputPrintln("FAILURE CATEGORIES *************************************************************")
+	for _, category := range hostErrorCategories {
+		if count := categoryCounts[category]; count > 0 {
+			outputPrintf("%-24s : %d host(s)\n", category, count)
+		}
+	}
 }
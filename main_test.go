@@ -5,6 +5,7 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -12,10 +13,13 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"ssh-key-bootstrap/messages"
 	"ssh-key-bootstrap/providers"
 
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // TestNormalizeHost verifies ports/default handling across host inputs.
@@ -33,6 +37,7 @@ func TestNormalizeHost(t *testing.T) {
 		{"withPort", "host:2222", 22, "host:2222", false},
 		{"ipv6", "[2001:db8::1]", 2022, "[2001:db8::1]:2022", false},
 		{"empty", "   ", 22, "", true},
+		{"unbalancedBracket", "[app01", 22, "", true},
 	}
 
 	for _, testCase := range testCases {
@@ -408,7 +413,7 @@ func TestAppendKnownHost(t *testing.T) {
 func TestAddAuthorizedKeyScriptLFOnly(t *testing.T) {
 	t.Parallel()
 
-	if strings.Contains(normalizeLF(addAuthorizedKeyScript), "\r") {
+	if strings.Contains(normalizeLF(addAuthorizedKeyScriptTemplate), "\r") {
 		t.Fatalf("remote script contains carriage return")
 	}
 }
@@ -502,6 +507,38 @@ func TestApplyConfigFiles(t *testing.T) {
 	}
 }
 
+func TestApplyConfigFilesAppliesMessageOverrides(t *testing.T) {
+	restoreMessages, err := messages.Configure("en", nil)
+	if err != nil {
+		t.Fatalf("messages.Configure() error = %v", err)
+	}
+	t.Cleanup(restoreMessages)
+
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "LOCALE=de\nMESSAGE_PROMPT_SSH_USERNAME=\"Runbook step 3 - login user: \"\n"
+	if writeErr := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); writeErr != nil {
+		t.Fatalf("write .env config: %v", writeErr)
+	}
+	// --locale en wins over the file's LOCALE; the override still applies.
+	programOptions := &options{EnvFile: dotEnvPath, Locale: "en"}
+	if applyErr := applyConfigFiles(programOptions, bufio.NewReader(strings.NewReader(""))); applyErr != nil {
+		t.Fatalf("apply config files: %v", applyErr)
+	}
+	if got := messages.Get(messages.PromptSSHUsername); got != "Runbook step 3 - login user: " {
+		t.Fatalf("username prompt = %q", got)
+	}
+	if got := messages.Get(messages.PromptSSHPassword); got != "SSH password: " {
+		t.Fatalf("password prompt = %q, want English", got)
+	}
+
+	if writeErr := os.WriteFile(dotEnvPath, []byte("MESSAGE_PROMPT_SHOE_SIZE=\"Size: \"\n"), 0o600); writeErr != nil {
+		t.Fatalf("write .env config: %v", writeErr)
+	}
+	if applyErr := applyConfigFiles(&options{EnvFile: dotEnvPath}, bufio.NewReader(strings.NewReader(""))); applyErr == nil || !strings.Contains(applyErr.Error(), "unknown message") {
+		t.Fatalf("apply config files error = %v", applyErr)
+	}
+}
+
 // TestApplyDotEnvConfigFileInvalidPort validates numeric conversion errors in .env input.
 func TestApplyDotEnvConfigFileInvalidPort(t *testing.T) {
 	t.Parallel()
@@ -537,7 +574,7 @@ func TestBuildHostKeyCallbackUnknownHostAccepted(t *testing.T) {
 	}
 	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
 
-	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr != nil {
 		t.Fatalf("build host key callback: %v", callbackErr)
 	}
@@ -564,6 +601,221 @@ func TestBuildHostKeyCallbackUnknownHostAccepted(t *testing.T) {
 	}
 }
 
+// TestBuildHostKeyCallbackKnownHostsOut verifies new keys go to --known-hosts-out and both files are trusted.
+func TestBuildHostKeyCallbackKnownHostsOut(t *testing.T) {
+	tempDirectory := t.TempDir()
+	knownHostsPath := filepath.Join(tempDirectory, "known_hosts")
+	knownHostsOut := filepath.Join(tempDirectory, "run", "known_hosts.new")
+	knownHostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	newHostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	if err := appendKnownHost(knownHostsPath, "known.example.com:22", knownHostPublicKey); err != nil {
+		t.Fatalf("seed known_hosts: %v", err)
+	}
+	originalKnownHosts, err := os.ReadFile(knownHostsPath)
+	if err != nil {
+		t.Fatalf("read known_hosts: %v", err)
+	}
+
+	originalPrompter := confirmUnknownHost
+	confirmUnknownHost = func(hostname, path string, key ssh.PublicKey) (bool, error) {
+		if path != knownHostsOut {
+			t.Fatalf("trust prompt names %q, want %q", path, knownHostsOut)
+		}
+		return true, nil
+	}
+	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
+
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, knownHostsOut, "", nil)
+	if callbackErr != nil {
+		t.Fatalf("build host key callback: %v", callbackErr)
+	}
+	remoteAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	if callbackErr := hostKeyCallback("known.example.com:22", remoteAddress, knownHostPublicKey); callbackErr != nil {
+		t.Fatalf("host from known_hosts: %v", callbackErr)
+	}
+	if callbackErr := hostKeyCallback("new.example.com:22", remoteAddress, newHostPublicKey); callbackErr != nil {
+		t.Fatalf("accept unknown host: %v", callbackErr)
+	}
+
+	knownHostsBytes, readErr := os.ReadFile(knownHostsPath)
+	if readErr != nil || string(knownHostsBytes) != string(originalKnownHosts) {
+		t.Fatalf("known_hosts changed: %q, %v", knownHostsBytes, readErr)
+	}
+	outBytes, readErr := os.ReadFile(knownHostsOut)
+	if readErr != nil || !strings.Contains(string(outBytes), "new.example.com") || strings.Contains(string(outBytes), "known.example.com") {
+		t.Fatalf("--known-hosts-out = %q, %v; want only the new host", outBytes, readErr)
+	}
+
+	reloadedCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, knownHostsOut, "", nil)
+	if callbackErr != nil {
+		t.Fatalf("rebuild host key callback: %v", callbackErr)
+	}
+	confirmUnknownHost = func(string, string, ssh.PublicKey) (bool, error) {
+		t.Fatalf("host learned in an earlier run must not be prompted for again")
+		return false, nil
+	}
+	if callbackErr := reloadedCallback("new.example.com:22", remoteAddress, newHostPublicKey); callbackErr != nil {
+		t.Fatalf("host from --known-hosts-out: %v", callbackErr)
+	}
+}
+
+// TestBuildHostKeyCallbackKnownHostsDir verifies new keys go to the host's own file in --known-hosts-dir and a changed key there is refused.
+func TestBuildHostKeyCallbackKnownHostsDir(t *testing.T) {
+	tempDirectory := t.TempDir()
+	knownHostsPath := filepath.Join(tempDirectory, "known_hosts")
+	knownHostsDir := filepath.Join(tempDirectory, "hosts")
+	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	otherPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+
+	originalPrompter := confirmUnknownHost
+	confirmUnknownHost = func(hostname, path string, key ssh.PublicKey) (bool, error) {
+		if want := filepath.Join(knownHostsDir, "web.example.com_2222"); path != want {
+			t.Fatalf("trust prompt names %q, want %q", path, want)
+		}
+		return true, nil
+	}
+	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
+
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", knownHostsDir, nil)
+	if callbackErr != nil {
+		t.Fatalf("build host key callback: %v", callbackErr)
+	}
+	remoteAddress := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+	if callbackErr := hostKeyCallback("web.example.com:2222", remoteAddress, hostPublicKey); callbackErr != nil {
+		t.Fatalf("accept unknown host: %v", callbackErr)
+	}
+	if knownHostsBytes, readErr := os.ReadFile(knownHostsPath); readErr != nil || len(knownHostsBytes) != 0 {
+		t.Fatalf("known_hosts = %q, %v; want it untouched", knownHostsBytes, readErr)
+	}
+
+	reloadedCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", knownHostsDir, nil)
+	if callbackErr != nil {
+		t.Fatalf("rebuild host key callback: %v", callbackErr)
+	}
+	confirmUnknownHost = func(string, string, ssh.PublicKey) (bool, error) {
+		t.Fatalf("host learned in an earlier run must not be prompted for again")
+		return false, nil
+	}
+	if callbackErr := reloadedCallback("web.example.com:2222", remoteAddress, hostPublicKey); callbackErr != nil {
+		t.Fatalf("host from --known-hosts-dir: %v", callbackErr)
+	}
+	var keyErr *knownhosts.KeyError
+	if callbackErr := reloadedCallback("web.example.com:2222", remoteAddress, otherPublicKey); !errors.As(callbackErr, &keyErr) || len(keyErr.Want) == 0 {
+		t.Fatalf("changed host key error = %v, want a key mismatch", callbackErr)
+	}
+
+	// Removing the host's file is all a rebuilt host needs.
+	if err := os.Remove(filepath.Join(knownHostsDir, "web.example.com_2222")); err != nil {
+		t.Fatalf("remove host file: %v", err)
+	}
+	confirmUnknownHost = func(string, string, ssh.PublicKey) (bool, error) { return true, nil }
+	rebuiltCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", knownHostsDir, nil)
+	if callbackErr != nil {
+		t.Fatalf("rebuild host key callback: %v", callbackErr)
+	}
+	if callbackErr := rebuiltCallback("web.example.com:2222", remoteAddress, otherPublicKey); callbackErr != nil {
+		t.Fatalf("rebuilt host: %v", callbackErr)
+	}
+}
+
+func TestKnownHostsFileName(t *testing.T) {
+	testCases := map[string]string{
+		"Web.Example.com:22":   "web.example.com",
+		"10.0.0.5:2222":        "10.0.0.5_2222",
+		"[2001:db8::1]:22":     "2001%3Adb8%3A%3A1",
+		"[2001:DB8:0::1]:2222": "2001%3Adb8%3A%3A1_2222",
+		"foo_2222:22":          "foo%5F2222",
+		"host/../etc":          "host%2F..%2Fetc",
+		"..":                   "%2E.",
+		".:2222":               "%2E_2222",
+		".hidden":              "%2Ehidden",
+	}
+	for address, want := range testCases {
+		if got := knownHostsFileName(address); got != want {
+			t.Fatalf("knownHostsFileName(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
+
+func TestKnownHostsFileNameDoesNotCollide(t *testing.T) {
+	addresses := []string{
+		"foo:2222", "foo_2222:22", "foo%5F2222:22", "foo:22", "foo_:22",
+		"[2001:db8::1]:22", "2001_db8__1:22", "[2001:db8::1]:2222", "2001_db8__1_2222:22",
+		"a:b:22", "a_b:22", "a/b:22", ".:22", "_.:22", "%2E:22", "..:22",
+	}
+	owners := map[string]string{}
+	for _, address := range addresses {
+		name := knownHostsFileName(address)
+		if owner, taken := owners[name]; taken {
+			t.Fatalf("knownHostsFileName(%q) = %q, the same file as %q", address, name, owner)
+		}
+		owners[name] = address
+	}
+	if got, want := knownHostsFileName("[2001:0db8:0000::0001]:22"), knownHostsFileName("[2001:db8::1]:22"); got != want {
+		t.Fatalf("IPv6 spellings map to %q and %q, want one file", got, want)
+	}
+}
+
+// TestAppendKnownHostLocksPerFile verifies a write to one known_hosts file does not wait for another.
+func TestAppendKnownHostLocksPerFile(t *testing.T) {
+	directory := t.TempDir()
+	busyPath, otherPath := filepath.Join(directory, "app01"), filepath.Join(directory, "app02")
+	busyLock := knownHostsFileLock(busyPath)
+	busyLock.Lock()
+	defer busyLock.Unlock()
+
+	appended := make(chan error, 1)
+	go func() {
+		appended <- appendKnownHost(otherPath, "app02:22", parsePublicKeyFromAuthorizedLine(t, generateTestKey(t)))
+	}()
+	select {
+	case err := <-appended:
+		if err != nil {
+			t.Fatalf("appendKnownHost() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("append to one file waited for another file's lock")
+	}
+}
+
+// TestAppendKnownHostConcurrentWritesAreDeduplicated verifies parallel appends keep one intact line per key.
+func TestAppendKnownHostConcurrentWritesAreDeduplicated(t *testing.T) {
+	knownHostsPath := filepath.Join(t.TempDir(), "known_hosts")
+	// A last line without a trailing newline must not be glued to new entries.
+	if err := os.WriteFile(knownHostsPath, []byte("# managed by hand"), 0o600); err != nil {
+		t.Fatalf("seed known_hosts: %v", err)
+	}
+	hostPublicKeys := []ssh.PublicKey{
+		parsePublicKeyFromAuthorizedLine(t, generateTestKey(t)),
+		parsePublicKeyFromAuthorizedLine(t, generateTestKey(t)),
+	}
+
+	var waitGroup sync.WaitGroup
+	for index := range 16 {
+		waitGroup.Go(func() {
+			hostname := fmt.Sprintf("host%d.example.com:22", index%2)
+			if err := appendKnownHost(knownHostsPath, hostname, hostPublicKeys[index%2]); err != nil {
+				t.Errorf("appendKnownHost(%s) error = %v", hostname, err)
+			}
+		})
+	}
+	waitGroup.Wait()
+
+	knownHostsBytes, readErr := os.ReadFile(knownHostsPath)
+	if readErr != nil {
+		t.Fatalf("read known_hosts: %v", readErr)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(knownHostsBytes), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "# managed by hand" {
+		t.Fatalf("known_hosts = %q, want the comment and one line per host", knownHostsBytes)
+	}
+	for _, line := range lines[1:] {
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(line)); err != nil {
+			t.Fatalf("corrupted known_hosts line %q: %v", line, err)
+		}
+	}
+}
+
 // TestBuildHostKeyCallbackUnknownHostConcurrent verifies concurrent unknown-host checks prompt once and persist safely.
 func TestBuildHostKeyCallbackUnknownHostConcurrent(t *testing.T) {
 	tempDirectory := t.TempDir()
@@ -581,7 +833,7 @@ func TestBuildHostKeyCallbackUnknownHostConcurrent(t *testing.T) {
 	}
 	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
 
-	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr != nil {
 		t.Fatalf("build host key callback: %v", callbackErr)
 	}
@@ -633,7 +885,7 @@ func TestBuildHostKeyCallbackUnknownHostRejected(t *testing.T) {
 	}
 	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
 
-	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr != nil {
 		t.Fatalf("build host key callback: %v", callbackErr)
 	}
@@ -667,7 +919,7 @@ func TestBuildHostKeyCallbackMismatchSkipsPrompt(t *testing.T) {
 	}
 	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
 
-	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr != nil {
 		t.Fatalf("build host key callback: %v", callbackErr)
 	}
@@ -694,7 +946,7 @@ func TestBuildHostKeyCallbackUnknownHostPromptError(t *testing.T) {
 	}
 	t.Cleanup(func() { confirmUnknownHost = originalPrompter })
 
-	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	hostKeyCallback, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr != nil {
 		t.Fatalf("build host key callback: %v", callbackErr)
 	}
@@ -717,7 +969,7 @@ func TestBuildHostKeyCallbackInvalidKnownHostsFile(t *testing.T) {
 		t.Fatalf("seed malformed known_hosts file: %v", writeErr)
 	}
 
-	_, callbackErr := buildHostKeyCallback(false, knownHostsPath)
+	_, callbackErr := buildHostKeyCallback(false, knownHostsPath, "", "", nil)
 	if callbackErr == nil {
 		t.Fatalf("expected known_hosts parse error")
 	}
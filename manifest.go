@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keyManifest is the desired state consumed by `apply`: named host groups and,
+// per login user, which keys belong on which groups.
+type keyManifest struct {
+	Groups          map[string][]string     `json:"groups"`
+	Users           map[string][]keyBinding `json:"users"`
+	RemoveExtraKeys bool                    `json:"removeExtraKeys"`
+}
+
+type keyBinding struct {
+	Key    string   `json:"key"`
+	Groups []string `json:"groups"`
+}
+
+// desiredHostState is the converged authorized_keys content for one login
+// user on one host.
+type desiredHostState struct {
+	Host string
+	User string
+	Keys []string
+}
+
+func loadKeyManifest(path string) (*keyManifest, error) {
+	manifestPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolve manifest path: %w", err)
+	}
+	manifestBytes, err := os.ReadFile(manifestPath) // #nosec G304 -- manifest path is explicit user input
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(manifestBytes))
+	decoder.DisallowUnknownFields()
+	manifest := &keyManifest{}
+	if err := decoder.Decode(manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("parse manifest: unexpected data after top-level JSON value")
+	}
+	if len(manifest.Users) == 0 {
+		return nil, errors.New("manifest defines no users")
+	}
+	return manifest, nil
+}
+
+// desiredStates expands the manifest into one state per host and user, sorted
+// by host then user. Keys are resolved once and deduplicated by key blob.
+func (manifest *keyManifest) desiredStates(defaultPort int) ([]desiredHostState, error) {
+	groupHosts := make(map[string][]string, len(manifest.Groups))
+	for groupName, rawHosts := range manifest.Groups {
+		for _, rawHost := range rawHosts {
+			host, err := normalizeHost(strings.TrimSpace(rawHost), defaultPort)
+			if err != nil {
+				return nil, fmt.Errorf("group %q: invalid host %q: %w", groupName, rawHost, err)
+			}
+			groupHosts[groupName] = append(groupHosts[groupName], host)
+		}
+	}
+
+	type stateKey struct{ host, user string }
+	states := map[stateKey]*desiredHostState{}
+	seenBlobs := map[stateKey]map[string]bool{}
+	resolvedKeys := map[string]string{}
+	for userName, bindings := range manifest.Users {
+		if strings.TrimSpace(userName) == "" {
+			return nil, errors.New("manifest user name is empty")
+		}
+		for index, binding := range bindings {
+			publicKey, resolved := resolvedKeys[binding.Key]
+			if !resolved {
+				var err error
+				if publicKey, err = resolvePublicKey(binding.Key); err != nil {
+					return nil, fmt.Errorf("user %q key %d: %w", userName, index+1, err)
+				}
+				resolvedKeys[binding.Key] = publicKey
+			}
+			parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+			if err != nil {
+				return nil, fmt.Errorf("user %q key %d: invalid public key format: %w", userName, index+1, err)
+			}
+			blob := publicKeyBlob(parsedKey)
+
+			if len(binding.Groups) == 0 {
+				return nil, fmt.Errorf("user %q key %d: no groups", userName, index+1)
+			}
+			for _, groupName := range binding.Groups {
+				hosts, exists := groupHosts[groupName]
+				if !exists {
+					return nil, fmt.Errorf("user %q key %d: unknown group %q", userName, index+1, groupName)
+				}
+				for _, host := range hosts {
+					key := stateKey{host: host, user: userName}
+					if states[key] == nil {
+						states[key] = &desiredHostState{Host: host, User: userName}
+						seenBlobs[key] = map[string]bool{}
+					}
+					if seenBlobs[key][blob] {
+						continue
+					}
+					seenBlobs[key][blob] = true
+					states[key].Keys = append(states[key].Keys, publicKey)
+				}
+			}
+		}
+	}
+
+	result := make([]desiredHostState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		return result[i].User < result[j].User
+	})
+	return result, nil
+}
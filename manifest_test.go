@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestManifest(t *testing.T, content string) string {
+	t.Helper()
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(manifestPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	return manifestPath
+}
+
+func TestKeyManifestDesiredStatesExpandsGroups(t *testing.T) {
+	aliceKey := strings.TrimSpace(generateTestKey(t))
+	bobKey := strings.TrimSpace(generateTestKey(t))
+	manifestPath := writeTestManifest(t, `{
+  "groups": {"web": ["web1", "web2:2222"], "db": ["db1", "web1"]},
+  "users": {
+    "deploy": [
+      {"key": "`+aliceKey+` alice", "groups": ["web", "db"]},
+      {"key": "`+bobKey+`", "groups": ["web"]}
+    ],
+    "postgres": [{"key": "`+aliceKey+` alice", "groups": ["db"]}]
+  },
+  "removeExtraKeys": true
+}`)
+
+	manifest, err := loadKeyManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("loadKeyManifest() error = %v", err)
+	}
+	if !manifest.RemoveExtraKeys {
+		t.Fatalf("removeExtraKeys not loaded")
+	}
+	states, err := manifest.desiredStates(22)
+	if err != nil {
+		t.Fatalf("desiredStates() error = %v", err)
+	}
+
+	var summary []string
+	for _, state := range states {
+		summary = append(summary, state.Host+"/"+state.User+"="+strings.Repeat("k", len(state.Keys)))
+	}
+	want := "db1:22/deploy=k,db1:22/postgres=k,web1:22/deploy=kk,web1:22/postgres=k,web2:2222/deploy=kk"
+	if strings.Join(summary, ",") != want {
+		t.Fatalf("states = %s, want %s", strings.Join(summary, ","), want)
+	}
+	if got := desiredStateHosts(states); strings.Join(got, ",") != "db1:22,web1:22,web2:2222" {
+		t.Fatalf("desiredStateHosts() = %v", got)
+	}
+}
+
+func TestKeyManifestRejectsInvalidInput(t *testing.T) {
+	key := strings.TrimSpace(generateTestKey(t))
+	testCases := map[string]string{
+		"unknown field": `{"users": {"deploy": [{"key": "` + key + `", "groups": ["web"]}]}, "prune": true}`,
+		"no users":      `{"groups": {"web": ["web1"]}}`,
+	}
+	for name, content := range testCases {
+		if _, err := loadKeyManifest(writeTestManifest(t, content)); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	manifest := &keyManifest{
+		Groups: map[string][]string{"web": {"web1"}},
+		Users:  map[string][]keyBinding{"deploy": {{Key: key, Groups: []string{"db"}}}},
+	}
+	if _, err := manifest.desiredStates(22); err == nil || !strings.Contains(err.Error(), `unknown group "db"`) {
+		t.Fatalf("desiredStates() error = %v, want unknown group", err)
+	}
+}
+
+func TestConvergeKeysOperationScriptAndResult(t *testing.T) {
+	key := strings.TrimSpace(generateTestKey(t))
+	script, err := (convergeKeysOperation{}).Script(remoteOperationInput{DesiredKeys: []string{key + " alice"}, RemoveExtraKeys: true})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	if !strings.HasPrefix(script.Command, "EXCLUSIVE=1\n") {
+		t.Fatalf("command does not enable exclusive mode: %q", script.Command[:20])
+	}
+	if script.Stdin != strings.Fields(key)[1]+" "+key+" alice\n" {
+		t.Fatalf("stdin = %q", script.Stdin)
+	}
+
+	result, err := (convergeKeysOperation{}).ParseResult(convergedKeysMarker + " added=0 removed=2\n")
+	if err != nil || !result.Changed || result.Message != "0 key(s) added, 2 removed" {
+		t.Fatalf("ParseResult() = %+v, %v", result, err)
+	}
+	result, err = (convergeKeysOperation{}).ParseResult(convergedKeysMarker + " added=0 removed=0\n")
+	if err != nil || result.Changed {
+		t.Fatalf("ParseResult(no change) = %+v, %v", result, err)
+	}
+	if _, err := (convergeKeysOperation{}).ParseResult("boom"); err == nil {
+		t.Fatalf("expected error for missing marker")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// maxStartupsRetries is how many times a host whose sshd turned the
+	// connection away before the version exchange is dialed again.
+	maxStartupsRetries        = 4
+	maxStartupsInitialBackoff = 2 * time.Second
+	maxStartupsMaxJitter      = time.Second
+)
+
+var (
+	maxStartupsSleep  = time.Sleep
+	maxStartupsJitter = func(maxJitter time.Duration) time.Duration {
+		return time.Duration(rand.Int64N(int64(maxJitter) + 1)) // #nosec G404 -- jitter only spreads retries, it is not security sensitive
+	}
+)
+
+// looksLikeMaxStartups reports whether a dial failed the way sshd rejects a
+// connection over its MaxStartups limit: the identification exchange failed
+// because sshd closed the connection first, so nothing ran on the host and
+// dialing again is safe. A bare EOF or reset during the handshake is left to
+// the IPS guard, since a ban looks the same and more dials would prolong it.
+func looksLikeMaxStartups(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "kex_exchange_identification") || strings.Contains(message, "ssh_exchange_identification")
+}
+
+// retryMaxStartups runs dial and dials address again, with a doubling,
+// jittered backoff, while it fails like a MaxStartups rejection. A busy sshd
+// drops unauthenticated connections at random once it has MaxStartups of
+// them, so the host usually answers a moment later. Retries stop once guard
+// suspects an IPS ban, which the same rejections also count toward.
+func retryMaxStartups(address string, guard *ipsGuard, dial func() (*ssh.Client, error)) (*ssh.Client, error) {
+	client, err := dial()
+	backoff := maxStartupsInitialBackoff
+	for retry := 1; retry <= maxStartupsRetries && looksLikeMaxStartups(err) && !guard.suspectsBan(); retry++ {
+		wait := backoff + maxStartupsJitter(maxStartupsMaxJitter)
+		message := fmt.Sprintf("%s closed the connection before the SSH version exchange, as sshd does over its MaxStartups limit; retrying in %s (%d/%d)", address, wait.Round(100*time.Millisecond), retry, maxStartupsRetries)
+		outputPrintf("WARNING: %s.\n", message)
+		emitEvent(runEvent{Event: "host_retry", Host: address, Message: message})
+		maxStartupsSleep(wait)
+		backoff *= 2
+		client, err = dial()
+	}
+	return client, err
+}
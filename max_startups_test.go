@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLooksLikeMaxStartups(t *testing.T) {
+	testCases := map[string]bool{
+		// An IPS ban fails the same way; the IPS guard handles these.
+		"ssh: handshake failed: EOF": false,
+		"ssh: handshake failed: read tcp 10.0.0.5:50022->10.0.0.9:22: read: connection reset by peer": false,
+		"ssh: kex_exchange_identification: Connection closed by remote host":                          true,
+		"ssh_exchange_identification: Connection closed by remote host":                               true,
+		"ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]":       false,
+		"read tcp 10.0.0.5:50022->10.0.0.9:22: read: connection reset by peer":                        false,
+		"dial tcp 10.0.0.9:22: connect: connection refused":                                           false,
+	}
+	for message, want := range testCases {
+		if got := looksLikeMaxStartups(errors.New(message)); got != want {
+			t.Fatalf("looksLikeMaxStartups(%q) = %v, want %v", message, got, want)
+		}
+	}
+}
+
+func stubMaxStartupsBackoff(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	originalSleep, originalJitter := maxStartupsSleep, maxStartupsJitter
+	maxStartupsSleep = func(wait time.Duration) { waits = append(waits, wait) }
+	maxStartupsJitter = func(time.Duration) time.Duration { return 0 }
+	t.Cleanup(func() { maxStartupsSleep, maxStartupsJitter = originalSleep, originalJitter })
+	// Repeated rejections also look like an IPS ban; keep that slowdown out
+	// of the test and of the tests after it.
+	originalIPSSleep := ipsGuardSleep
+	ipsGuardSleep = func(time.Duration) {}
+	t.Cleanup(func() { ipsGuardSleep = originalIPSSleep })
+	restoreIPSGuard, err := configureIPSGuard(0)
+	if err != nil {
+		t.Fatalf("configureIPSGuard() error = %v", err)
+	}
+	t.Cleanup(restoreIPSGuard)
+	return &waits
+}
+
+func TestDialSSHRetriesMaxStartupsRejections(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	waits := stubMaxStartupsBackoff(t)
+	dials := 0
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		dials++
+		if dials <= 2 {
+			return nil, errors.New("ssh: kex_exchange_identification: Connection closed by remote host")
+		}
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) { return "", "", 0 })
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("password")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- in-memory test server
+	if _, err := dialSSH("tcp", "busy01:22", clientConfig); err != nil {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+	if dials != 3 {
+		t.Fatalf("dials = %d, want 3", dials)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 2*time.Second || (*waits)[1] != 4*time.Second {
+		t.Fatalf("backoff = %v, want [2s 4s]", *waits)
+	}
+	if !strings.Contains(outputBuffer.String(), "WARNING: busy01:22 closed the connection before the SSH version exchange") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+}
+
+func TestDialSSHDoesNotRetryHandshakeEOF(t *testing.T) {
+	_, _ = captureWriters(t)
+	waits := stubMaxStartupsBackoff(t)
+	dials := 0
+	stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+		dials++
+		return nil, errors.New("ssh: handshake failed: EOF")
+	})
+
+	clientConfig := &ssh.ClientConfig{User: "deploy", HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- the dial is stubbed
+	if _, err := dialSSH("tcp", "banned01:22", clientConfig); err == nil {
+		t.Fatal("dialSSH() error = nil")
+	}
+	if dials != 1 || len(*waits) != 0 {
+		t.Fatalf("dials = %d, waits = %v; want one dial", dials, *waits)
+	}
+}
+
+func TestDialSSHStopsMaxStartupsRetriesOnceABanIsSuspected(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	waits := stubMaxStartupsBackoff(t)
+	dials := 0
+	stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+		dials++
+		return nil, errors.New("ssh: kex_exchange_identification: Connection closed by remote host")
+	})
+
+	clientConfig := &ssh.ClientConfig{User: "deploy", HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- the dial is stubbed
+	if _, err := dialSSH("tcp", "busy01:22", clientConfig); err == nil || !strings.Contains(err.Error(), "kex_exchange_identification") {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+	if dials != ipsBlockThreshold || len(*waits) != ipsBlockThreshold-1 {
+		t.Fatalf("dials = %d, waits = %v; want retries to stop at the IPS threshold", dials, *waits)
+	}
+	if !strings.Contains(outputBuffer.String(), "may be banning your source IP") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+}
+
+func TestRetryMaxStartupsGivesUpAfterRetries(t *testing.T) {
+	_, _ = captureWriters(t)
+	waits := stubMaxStartupsBackoff(t)
+	dials := 0
+	_, err := retryMaxStartups("busy01:22", &ipsGuard{}, func() (*ssh.Client, error) {
+		dials++
+		return nil, errors.New("ssh: kex_exchange_identification: Connection closed by remote host")
+	})
+	if err == nil {
+		t.Fatal("retryMaxStartups() error = nil")
+	}
+	if dials != maxStartupsRetries+1 || len(*waits) != maxStartupsRetries {
+		t.Fatalf("dials = %d, waits = %v", dials, *waits)
+	}
+}
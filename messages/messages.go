@@ -0,0 +1,235 @@
+// Package messages holds the user-facing prompt and status strings in one
+// catalog per locale, so the tool can follow a localized runbook. Teams can
+// replace individual strings through the config file.
+package messages
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used when no locale is configured or the system locale
+// has no catalog.
+const DefaultLocale = "en"
+
+// Message IDs. An ID is also the config key that overrides the string:
+// MESSAGE_<ID in upper case> in .env files and "messages": {"<id>": ...} in
+// JSON configs.
+const (
+	PromptServers             = "prompt_servers"
+	PromptPublicKey           = "prompt_public_key"
+	PromptSSHUsername         = "prompt_ssh_username"
+	PromptSSHPassword         = "prompt_ssh_password"
+	PromptConfirmSSHPassword  = "prompt_confirm_ssh_password"
+	PromptStoredSSHPassword   = "prompt_stored_ssh_password"
+	PromptPasswordSource      = "prompt_password_source"
+	PromptPasswordSecretRef   = "prompt_password_secret_ref"
+	PromptHostKeyPolicy       = "prompt_host_key_policy"
+	PromptKnownHostsPath      = "prompt_known_hosts_path"
+	PromptEncryptFile         = "prompt_encrypt_file"
+	PromptPassphrase          = "prompt_passphrase"
+	PromptRepeatPassphrase    = "prompt_repeat_passphrase"
+	PromptAgeRecipient        = "prompt_age_recipient"
+	PromptConfigPassphrase    = "prompt_config_passphrase"
+	PromptUseFoundConfig      = "prompt_use_found_config"
+	PromptTrustHost           = "prompt_trust_host"
+	PromptInstallKeys         = "prompt_install_keys"
+	PromptConfirmHostCount    = "prompt_confirm_host_count"
+	ValueRequired             = "value_required"
+	PasswordsMismatch         = "passwords_mismatch"
+	PassphrasesMismatch       = "passphrases_mismatch"
+	LoadedConfigValues        = "loaded_config_values"
+	NoConfigLoaded            = "no_config_loaded"
+	TaskLoadConfiguration     = "task_load_configuration"
+	TaskValidateOptions       = "task_validate_options"
+	TaskReadServersFile       = "task_read_servers_file"
+	TaskCollectMissingInputs  = "task_collect_missing_inputs"
+	TaskResolveTargetHosts    = "task_resolve_target_hosts"
+	TaskResolvePublicKey      = "task_resolve_public_key"
+	TaskBuildSSHConfiguration = "task_build_ssh_configuration"
+	StatusHostsQueued         = "status_hosts_queued"
+)
+
+var catalogs = map[string]map[string]string{
+	"en": {
+		PromptServers:             "Servers (comma-separated, host or host:port): ",
+		PromptPublicKey:           "Public key text or path to public key file: ",
+		PromptSSHUsername:         "SSH username: ",
+		PromptSSHPassword:         "SSH password: ",
+		PromptConfirmSSHPassword:  "Confirm SSH password: ",
+		PromptStoredSSHPassword:   "SSH password to store: ",
+		PromptPasswordSource:      "Password source [%s] (default %s): ",
+		PromptPasswordSecretRef:   "Password secret reference: ",
+		PromptHostKeyPolicy:       "Host key policy [%s/%s] (default %s): ",
+		PromptKnownHostsPath:      "known_hosts path (default %s): ",
+		PromptEncryptFile:         "Encrypt the file [%s] (default %s): ",
+		PromptPassphrase:          "Passphrase: ",
+		PromptRepeatPassphrase:    "Repeat passphrase: ",
+		PromptAgeRecipient:        "age recipient (age1...): ",
+		PromptConfigPassphrase:    "Passphrase for %s: ",
+		PromptUseFoundConfig:      "Found %s at %q. Use it? [y/n]: ",
+		PromptTrustHost:           "Trust this host and add it to %s? (yes/no): ",
+		PromptInstallKeys:         "Install these %d key(s)? (yes/no): ",
+		PromptConfirmHostCount:    "Type the number of hosts to proceed: ",
+		ValueRequired:             "Value is required.",
+		PasswordsMismatch:         "Passwords do not match. Try again.",
+		PassphrasesMismatch:       "Passphrases do not match.",
+		LoadedConfigValues:        "Loaded configuration values:",
+		NoConfigLoaded:            "No config file loaded; run `%s init` once to save these answers.",
+		TaskLoadConfiguration:     "Load configuration",
+		TaskValidateOptions:       "Validate options",
+		TaskReadServersFile:       "Read servers file",
+		TaskCollectMissingInputs:  "Collect missing inputs",
+		TaskResolveTargetHosts:    "Resolve target hosts",
+		TaskResolvePublicKey:      "Resolve public key",
+		TaskBuildSSHConfiguration: "Build SSH client configuration",
+		StatusHostsQueued:         "%d host(s) queued",
+	},
+	"de": {
+		PromptServers:             "Server (kommagetrennt, Host oder Host:Port): ",
+		PromptPublicKey:           "Öffentlicher Schlüssel oder Pfad zur Schlüsseldatei: ",
+		PromptSSHUsername:         "SSH-Benutzername: ",
+		PromptSSHPassword:         "SSH-Passwort: ",
+		PromptConfirmSSHPassword:  "SSH-Passwort bestätigen: ",
+		PromptStoredSSHPassword:   "Zu speicherndes SSH-Passwort: ",
+		PromptPasswordSource:      "Passwortquelle [%s] (Standard %s): ",
+		PromptPasswordSecretRef:   "Secret-Referenz für das Passwort: ",
+		PromptHostKeyPolicy:       "Host-Key-Richtlinie [%s/%s] (Standard %s): ",
+		PromptKnownHostsPath:      "Pfad zu known_hosts (Standard %s): ",
+		PromptEncryptFile:         "Datei verschlüsseln [%s] (Standard %s): ",
+		PromptPassphrase:          "Passphrase: ",
+		PromptRepeatPassphrase:    "Passphrase wiederholen: ",
+		PromptAgeRecipient:        "age-Empfänger (age1...): ",
+		PromptConfigPassphrase:    "Passphrase für %s: ",
+		PromptUseFoundConfig:      "%s gefunden (%q). Verwenden? [y/n]: ",
+		PromptTrustHost:           "Diesem Host vertrauen und zu %s hinzufügen? (yes/no): ",
+		PromptInstallKeys:         "Diese %d Schlüssel installieren? (yes/no): ",
+		PromptConfirmHostCount:    "Zum Fortfahren die Anzahl der Hosts eingeben: ",
+		ValueRequired:             "Ein Wert ist erforderlich.",
+		PasswordsMismatch:         "Die Passwörter stimmen nicht überein. Bitte erneut eingeben.",
+		PassphrasesMismatch:       "Die Passphrasen stimmen nicht überein.",
+		LoadedConfigValues:        "Geladene Konfigurationswerte:",
+		NoConfigLoaded:            "Keine Konfigurationsdatei geladen; einmal `%s init` ausführen, um diese Antworten zu speichern.",
+		TaskLoadConfiguration:     "Konfiguration laden",
+		TaskValidateOptions:       "Optionen prüfen",
+		TaskReadServersFile:       "Serverdatei lesen",
+		TaskCollectMissingInputs:  "Fehlende Eingaben abfragen",
+		TaskResolveTargetHosts:    "Zielhosts ermitteln",
+		TaskResolvePublicKey:      "Öffentlichen Schlüssel ermitteln",
+		TaskBuildSSHConfiguration: "SSH-Client-Konfiguration erstellen",
+		StatusHostsQueued:         "%d Host(s) in der Warteschlange",
+	},
+}
+
+var (
+	activeMu        sync.RWMutex
+	activeLocale    = DefaultLocale
+	activeOverrides map[string]string
+
+	formatVerbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+)
+
+// Locales returns the locales that have a catalog.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// Get returns the message id in the active locale, formatted with arguments
+// like fmt.Sprintf. A configured override takes precedence.
+func Get(id string, arguments ...any) string {
+	activeMu.RLock()
+	text, ok := activeOverrides[id]
+	if !ok {
+		text, ok = catalogs[activeLocale][id]
+	}
+	activeMu.RUnlock()
+	if !ok {
+		text = catalogs[DefaultLocale][id]
+	}
+	if len(arguments) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, arguments...)
+}
+
+// Configure selects the locale and the strings that override it; an empty
+// locale detects it from the environment. Overrides must name a known
+// message and keep its formatting verbs, so a custom string cannot drop a
+// host name or garble a count. The returned function restores the previous
+// selection.
+func Configure(locale string, overrides map[string]string) (func(), error) {
+	resolvedLocale, err := resolveLocale(locale)
+	if err != nil {
+		return nil, err
+	}
+	for id, text := range overrides {
+		defaultText, known := catalogs[DefaultLocale][id]
+		if !known {
+			return nil, fmt.Errorf("unknown message %q in config", id)
+		}
+		if !slices.Equal(formatVerbs(text), formatVerbs(defaultText)) {
+			return nil, fmt.Errorf("message %q must keep the placeholders %s", id, strings.Join(formatVerbs(defaultText), " "))
+		}
+	}
+
+	activeMu.Lock()
+	previousLocale, previousOverrides := activeLocale, activeOverrides
+	activeLocale, activeOverrides = resolvedLocale, overrides
+	activeMu.Unlock()
+	return func() {
+		activeMu.Lock()
+		activeLocale, activeOverrides = previousLocale, previousOverrides
+		activeMu.Unlock()
+	}, nil
+}
+
+// resolveLocale accepts a locale such as "de" or "de_DE.UTF-8". Without one
+// it follows LC_ALL, LC_MESSAGES and LANG and falls back to English for
+// system locales without a catalog.
+func resolveLocale(locale string) (string, error) {
+	if strings.TrimSpace(locale) != "" {
+		language := localeLanguage(locale)
+		if _, ok := catalogs[language]; !ok {
+			return "", fmt.Errorf("unknown locale %q (valid: %s)", locale, strings.Join(Locales(), ", "))
+		}
+		return language, nil
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if language := localeLanguage(value); catalogs[language] != nil {
+			return language, nil
+		}
+		break
+	}
+	return DefaultLocale, nil
+}
+
+func localeLanguage(locale string) string {
+	language := strings.ToLower(strings.TrimSpace(locale))
+	if index := strings.IndexAny(language, "_-.@"); index >= 0 {
+		language = language[:index]
+	}
+	return language
+}
+
+func formatVerbs(text string) []string {
+	var verbs []string
+	for _, verb := range formatVerbPattern.FindAllString(text, -1) {
+		if verb != "%%" {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs
+}
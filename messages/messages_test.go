@@ -0,0 +1,70 @@
+package messages
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCatalogsCoverEveryMessageWithTheSamePlaceholders(t *testing.T) {
+	for _, locale := range Locales() {
+		if len(catalogs[locale]) != len(catalogs[DefaultLocale]) {
+			t.Fatalf("%s has %d messages, %s has %d", locale, len(catalogs[locale]), DefaultLocale, len(catalogs[DefaultLocale]))
+		}
+		for id, defaultText := range catalogs[DefaultLocale] {
+			text, ok := catalogs[locale][id]
+			if !ok || strings.TrimSpace(text) == "" {
+				t.Fatalf("%s is missing %s", locale, id)
+			}
+			if !slices.Equal(formatVerbs(text), formatVerbs(defaultText)) {
+				t.Fatalf("%s %s placeholders = %v, want %v", locale, id, formatVerbs(text), formatVerbs(defaultText))
+			}
+		}
+	}
+}
+
+func TestConfigureSelectsLocaleAndOverrides(t *testing.T) {
+	restore, err := Configure("de_DE.UTF-8", map[string]string{StatusHostsQueued: "%d Maschinen"})
+	if err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if got := Get(PromptSSHUsername); got != "SSH-Benutzername: " {
+		t.Fatalf("Get(PromptSSHUsername) = %q", got)
+	}
+	if got := Get(StatusHostsQueued, 3); got != "3 Maschinen" {
+		t.Fatalf("Get(StatusHostsQueued) = %q", got)
+	}
+	restore()
+	if got := Get(StatusHostsQueued, 3); got != "3 host(s) queued" {
+		t.Fatalf("after restore Get() = %q", got)
+	}
+}
+
+func TestConfigureDetectsSystemLocale(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "de_AT.UTF-8")
+	if locale, err := resolveLocale(""); err != nil || locale != "de" {
+		t.Fatalf("resolveLocale() = %q, %v", locale, err)
+	}
+	t.Setenv("LANG", "ja_JP.UTF-8")
+	if locale, err := resolveLocale(""); err != nil || locale != DefaultLocale {
+		t.Fatalf("resolveLocale(ja) = %q, %v, want the default", locale, err)
+	}
+}
+
+func TestConfigureRejectsBadInput(t *testing.T) {
+	for name, test := range map[string]struct {
+		locale    string
+		overrides map[string]string
+		want      string
+	}{
+		"unknown locale":      {locale: "tlh", want: "unknown locale"},
+		"unknown message":     {overrides: map[string]string{"prompt_shoe_size": "Size: "}, want: "unknown message"},
+		"dropped placeholder": {overrides: map[string]string{PromptTrustHost: "Trust? "}, want: "placeholders %s"},
+	} {
+		if _, err := Configure(test.locale, test.overrides); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%s: Configure() error = %v, want %q", name, err, test.want)
+		}
+	}
+}
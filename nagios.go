@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// readNagiosConfig reads the Nagios object config at path (--nagios-cfg) and
+// returns the address of every host defined in it, so the bootstrap list
+// matches what is monitored. path is an object file, a directory of *.cfg
+// files, or the main nagios.cfg, whose cfg_file and cfg_dir lines are
+// followed.
+func readNagiosConfig(path string) ([]string, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolve Nagios config path: %w", err)
+	}
+	reader := &nagiosConfigReader{read: map[string]bool{}}
+	if err := reader.readPath(expandedPath); err != nil {
+		return nil, err
+	}
+	return reader.entries, nil
+}
+
+type nagiosConfigReader struct {
+	read    map[string]bool
+	entries []string
+}
+
+func (reader *nagiosConfigReader) readPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("open Nagios config: %w", err)
+	}
+	if !info.IsDir() {
+		return reader.readFile(path)
+	}
+	return filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("read Nagios config directory: %w", err)
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".cfg") {
+			return nil
+		}
+		return reader.readFile(filePath)
+	})
+}
+
+func (reader *nagiosConfigReader) readFile(path string) error {
+	if reader.read[path] {
+		return nil
+	}
+	reader.read[path] = true
+	configFile, err := os.Open(path) // #nosec G304 -- Nagios config path is explicit user input or named by it
+	if err != nil {
+		return fmt.Errorf("open Nagios config: %w", err)
+	}
+	defer configFile.Close()
+
+	entries, includes, err := parseNagiosConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("read Nagios config %q: %w", path, err)
+	}
+	for _, entry := range entries {
+		if !slices.Contains(reader.entries, entry) {
+			reader.entries = append(reader.entries, entry)
+		}
+	}
+	// As in Nagios, relative cfg_file and cfg_dir paths start at the
+	// directory of the file naming them.
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := reader.readPath(include); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseNagiosConfig returns the target of every "define host" block in file
+// order, without repeats, and the cfg_file and cfg_dir paths named in a main
+// config. A host is targeted by its address, or its host_name when it has
+// none. Templates (register 0, or a name without a host_name) are skipped.
+func parseNagiosConfig(reader io.Reader) ([]string, []string, error) {
+	var entries, includes []string
+	var block map[string]string
+	blockType := ""
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), ";")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if block == nil {
+			if definition, ok := strings.CutPrefix(line, "define"); ok {
+				blockType, _, _ = strings.Cut(definition, "{")
+				blockType = strings.TrimSpace(blockType)
+				block = map[string]string{}
+				continue
+			}
+			if key, value, ok := strings.Cut(line, "="); ok && (key == "cfg_file" || key == "cfg_dir") {
+				includes = append(includes, strings.TrimSpace(value))
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "}") {
+			if target := nagiosHostTarget(blockType, block); target != "" && !slices.Contains(entries, target) {
+				entries = append(entries, target)
+			}
+			block = nil
+			continue
+		}
+		fields := strings.Fields(line)
+		block[fields[0]] = strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return entries, includes, nil
+}
+
+func nagiosHostTarget(blockType string, block map[string]string) string {
+	if blockType != "host" || block["register"] == "0" || block["host_name"] == "" {
+		return ""
+	}
+	if address := block["address"]; address != "" {
+		return address
+	}
+	return block["host_name"]
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseNagiosConfigSkipsTemplatesAndOtherObjects(t *testing.T) {
+	config := `# hosts.cfg
+define host {
+    name        linux-server ; template
+    register    0
+    address     10.9.9.9
+}
+define host{
+    use         linux-server
+    host_name   web01
+    address     10.0.0.11   ; public VIP is elsewhere
+}
+define service {
+    host_name   web01
+    check_command check_ssh
+}
+define host {
+    use         linux-server
+    host_name   db01.example.com
+}
+define host {
+    host_name   web01-again
+    address     10.0.0.11
+}
+`
+	entries, includes, err := parseNagiosConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("parseNagiosConfig() error = %v", err)
+	}
+	if want := []string{"10.0.0.11", "db01.example.com"}; !slices.Equal(entries, want) || len(includes) != 0 {
+		t.Fatalf("parseNagiosConfig() = %v, %v; want %v and no includes", entries, includes, want)
+	}
+}
+
+func TestReadNagiosConfigFollowsMainConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeServersFiles(t, dir, map[string]string{
+		"nagios.cfg":            "log_file=/var/log/nagios/nagios.log\ncfg_file=objects/localhost.cfg\ncfg_dir=" + filepath.Join(dir, "servers") + "\n",
+		"objects/localhost.cfg": "define host {\n host_name localhost\n address 127.0.0.1\n}\n",
+		"servers/app.cfg":       "define host {\n host_name app01\n address 10.0.0.5\n}\n",
+		"servers/old/db.cfg":    "define host {\n host_name db01\n}\n",
+		"servers/notes.txt":     "define host {\n host_name ignored\n}\n",
+	})
+
+	entries, err := readNagiosConfig(filepath.Join(dir, "nagios.cfg"))
+	if err != nil {
+		t.Fatalf("readNagiosConfig() error = %v", err)
+	}
+	if want := []string{"127.0.0.1", "10.0.0.5", "db01"}; !slices.Equal(entries, want) {
+		t.Fatalf("readNagiosConfig() = %v, want %v", entries, want)
+	}
+	if _, err := readNagiosConfig(filepath.Join(dir, "missing.cfg")); err == nil {
+		t.Fatal("readNagiosConfig() of a missing file succeeded")
+	}
+}
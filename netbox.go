@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	netboxTokenEnv      = "NETBOX_TOKEN"
+	netboxPageSize      = 1000
+	netboxDevicesPath   = "/api/dcim/devices/"
+	netboxErrorBodySize = 512
+)
+
+// netboxHTTPClient talks to the NetBox API; tests point it at a local server.
+var netboxHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// netboxDevice is the part of a NetBox device --netbox-url reads.
+type netboxDevice struct {
+	Name      string `json:"name"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip"`
+}
+
+type netboxDevicePage struct {
+	Next    *string        `json:"next"`
+	Results []netboxDevice `json:"results"`
+}
+
+// readNetBoxInventory returns the primary IP of every active NetBox device
+// that matches --netbox-site and --netbox-role, in NetBox's order and without
+// repeats, plus how many matching devices had no primary IP and were skipped.
+func readNetBoxInventory(programOptions *options) ([]string, int, error) {
+	pageURL, err := netboxDevicesURL(programOptions.NetBoxURL, splitNetBoxFilter(programOptions.NetBoxSite), splitNetBoxFilter(programOptions.NetBoxRole))
+	if err != nil {
+		return nil, 0, err
+	}
+	token, err := serviceCredential("NetBox", "API token", programOptions.NetBoxTokenRef, "--netbox-token-ref", netboxTokenEnv)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []string
+	seen := map[string]struct{}{}
+	skipped := 0
+	for pageURL != "" {
+		page, err := fetchNetBoxDevicePage(pageURL, token)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, device := range page.Results {
+			if device.PrimaryIP == nil || strings.TrimSpace(device.PrimaryIP.Address) == "" {
+				skipped++
+				continue
+			}
+			address, _, _ := strings.Cut(strings.TrimSpace(device.PrimaryIP.Address), "/")
+			if _, duplicate := seen[address]; !duplicate {
+				seen[address] = struct{}{}
+				entries = append(entries, address)
+			}
+		}
+		pageURL = ""
+		if page.Next != nil && *page.Next != "" {
+			if pageURL, err = sameOriginNetBoxURL(programOptions.NetBoxURL, *page.Next); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return entries, skipped, nil
+}
+
+// netboxDevicesURL is the first page of the device list, filtered to active
+// devices with a primary IP in the given sites and roles (slugs).
+func netboxDevicesURL(baseURL string, sites, roles []string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return "", fmt.Errorf("--netbox-url %q must be an http(s) URL such as https://netbox.example.com", baseURL)
+	}
+	parsedURL.Path = strings.TrimRight(parsedURL.Path, "/") + netboxDevicesPath
+	query := url.Values{}
+	query.Set("status", "active")
+	query.Set("has_primary_ip", "true")
+	query.Set("limit", strconv.Itoa(netboxPageSize))
+	for _, site := range sites {
+		query.Add("site", site)
+	}
+	for _, role := range roles {
+		query.Add("role", role)
+	}
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), nil
+}
+
+// sameOriginNetBoxURL checks that a "next" page link stays on the NetBox
+// server, so the token is never sent anywhere else.
+func sameOriginNetBoxURL(baseURL, nextURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return "", err
+	}
+	next, err := url.Parse(nextURL)
+	if err != nil {
+		return "", fmt.Errorf("NetBox returned an invalid next page link: %w", err)
+	}
+	if next.Scheme != base.Scheme || next.Host != base.Host {
+		return "", fmt.Errorf("NetBox next page link %s leaves %s://%s; set BASE_PATH and the proxy headers in NetBox so its links match --netbox-url", next.Redacted(), base.Scheme, base.Host)
+	}
+	return next.String(), nil
+}
+
+func fetchNetBoxDevicePage(pageURL, token string) (netboxDevicePage, error) {
+	request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return netboxDevicePage{}, fmt.Errorf("build NetBox request: %w", err)
+	}
+	request.Header.Set("Authorization", "Token "+token)
+	request.Header.Set("Accept", "application/json")
+	response, err := netboxHTTPClient.Do(request)
+	if err != nil {
+		return netboxDevicePage{}, fmt.Errorf("query NetBox: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, netboxErrorBodySize))
+		return netboxDevicePage{}, fmt.Errorf("NetBox returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	var page netboxDevicePage
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		return netboxDevicePage{}, fmt.Errorf("parse NetBox device list: %w", err)
+	}
+	return page, nil
+}
+
+func splitNetBoxFilter(value string) []string {
+	var slugs []string
+	for slug := range strings.SplitSeq(value, ",") {
+		if slug = strings.TrimSpace(slug); slug != "" {
+			slugs = append(slugs, slug)
+		}
+	}
+	return slugs
+}
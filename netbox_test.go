@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadNetBoxInventoryFollowsPagesAndFilters(t *testing.T) {
+	t.Setenv(netboxTokenEnv, "env-token")
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if got := request.Header.Get("Authorization"); got != "Token secret-token" {
+			http.Error(writer, `{"detail":"Invalid token"}`, http.StatusForbidden)
+			return
+		}
+		query := request.URL.Query()
+		if request.URL.Path != "/netbox/api/dcim/devices/" || !slices.Equal(query["site"], []string{"fra1", "ams1"}) ||
+			query.Get("role") != "server" || query.Get("status") != "active" {
+			http.Error(writer, "unexpected query "+request.URL.String(), http.StatusBadRequest)
+			return
+		}
+		if query.Get("offset") == "" {
+			fmt.Fprintf(writer, `{"count": 4, "next": "%s/netbox/api/dcim/devices/?offset=2&%s", "results": [
+				{"name": "app01", "primary_ip": {"address": "10.0.0.5/24"}},
+				{"name": "console01", "primary_ip": null}]}`, server.URL, request.URL.RawQuery)
+			return
+		}
+		fmt.Fprint(writer, `{"count": 4, "next": null, "results": [
+			{"name": "app02", "primary_ip": {"address": "2001:db8::7/64"}},
+			{"name": "app01-alias", "primary_ip": {"address": "10.0.0.5/24"}}]}`)
+	}))
+	defer server.Close()
+
+	original := resolvePasswordFromSecretRef
+	resolvePasswordFromSecretRef = func(secretRef string) (string, error) {
+		if secretRef != "bw://netbox-token" {
+			return "", fmt.Errorf("unexpected ref %q", secretRef)
+		}
+		return "secret-token\n", nil
+	}
+	t.Cleanup(func() { resolvePasswordFromSecretRef = original })
+
+	programOptions := &options{NetBoxURL: server.URL + "/netbox/", NetBoxTokenRef: "bw://netbox-token", NetBoxSite: "fra1, ams1", NetBoxRole: "server"}
+	entries, skipped, err := readNetBoxInventory(programOptions)
+	if err != nil {
+		t.Fatalf("readNetBoxInventory() error = %v", err)
+	}
+	if want := []string{"10.0.0.5", "2001:db8::7"}; !slices.Equal(entries, want) || skipped != 1 {
+		t.Fatalf("readNetBoxInventory() = %v, skipped %d; want %v, skipped 1", entries, skipped, want)
+	}
+
+	programOptions.NetBoxTokenRef = ""
+	if _, _, err := readNetBoxInventory(programOptions); err == nil || !strings.Contains(err.Error(), "NetBox returned 403 Forbidden: {\"detail\":\"Invalid token\"}") {
+		t.Fatalf("readNetBoxInventory() with NETBOX_TOKEN error = %v", err)
+	}
+}
+
+func TestSameOriginNetBoxURLRefusesOtherHosts(t *testing.T) {
+	if _, err := sameOriginNetBoxURL("https://netbox.example.com", "http://10.1.1.1:8080/api/dcim/devices/?offset=1000"); err == nil || !strings.Contains(err.Error(), "leaves https://netbox.example.com") {
+		t.Fatalf("sameOriginNetBoxURL() error = %v", err)
+	}
+	if _, err := netboxDevicesURL("netbox.example.com", nil, nil); err == nil || !strings.Contains(err.Error(), "must be an http(s) URL") {
+		t.Fatalf("netboxDevicesURL() without a scheme error = %v", err)
+	}
+}
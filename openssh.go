@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	opensshBinary              = "ssh"
+	opensshConnectionErrorCode = 255
+)
+
+var lookPathForOpenSSH = exec.LookPath
+
+// runOpenSSHCommand runs the system ssh client and returns its combined
+// output, within the remote command limits. Tests replace it to avoid
+// spawning processes.
+var runOpenSSHCommand = func(binaryPath string, args []string, stdin string) ([]byte, error) {
+	command := exec.Command(binaryPath, args...) // #nosec G204 -- binary is resolved from PATH and arguments are built by this tool
+	if stdin != "" {
+		command.Stdin = strings.NewReader(stdin)
+	}
+	timeout, maxOutput := currentRemoteCommandLimits()
+	output := newCappedOutput(maxOutput)
+	command.Stdout = output
+	command.Stderr = output
+	if err := command.Start(); err != nil {
+		return nil, err
+	}
+	err := waitWithinLimits(command.Wait, func() { _ = command.Process.Kill() }, output, timeout)
+	return output.Bytes(), err
+}
+
+// opensshExecutor runs operations through the system ssh client (--use-openssh)
+// so ~/.ssh/config, ProxyJump, certificates and agent forwarding behave exactly
+// as they do interactively. Operations on one host share a ControlMaster
+// connection that is closed when the run ends.
+type opensshExecutor struct {
+	binaryPath    string
+	controlDir    string
+	baseArgs      []string
+	masterStarted map[string]bool
+	// knownHostsDir and knownHostsFiles are set with --known-hosts-dir: each
+	// host reads its own file there first, then knownHostsFiles.
+	knownHostsDir   string
+	knownHostsFiles []string
+}
+
+func newOpenSSHExecutor(programOptions *options) (*opensshExecutor, error) {
+	binaryPath, err := lookPathForOpenSSH(opensshBinary)
+	if err != nil {
+		return nil, fmt.Errorf("--use-openssh needs the %s client on PATH: %w", opensshBinary, err)
+	}
+	controlDir, err := os.MkdirTemp("", "skb-ssh-")
+	if err != nil {
+		return nil, fmt.Errorf("create ssh control directory: %w", err)
+	}
+
+	executor := &opensshExecutor{masterStarted: map[string]bool{}}
+	baseArgs := []string{
+		// Stdin carries script data, so ssh must never stop to prompt.
+		"-o", "BatchMode=yes",
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(controlDir, "%C"),
+		"-o", "ControlPersist=yes",
+	}
+	baseArgs = append(baseArgs, opensshAuthArgs(programOptions)...)
+	baseArgs = append(baseArgs, opensshHostKeyArgs(strings.TrimSpace(programOptions.MinHostKeyStrength), programOptions.PreferED25519)...)
+	if programOptions.TimeoutSec > 0 {
+		baseArgs = append(baseArgs, "-o", "ConnectTimeout="+strconv.Itoa(programOptions.TimeoutSec))
+	}
+	if programOptions.InsecureIgnoreHostKey {
+		baseArgs = append(baseArgs, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	} else {
+		if programOptions.AcceptNewHostKeys {
+			baseArgs = append(baseArgs, "-o", "StrictHostKeyChecking=accept-new")
+		}
+		knownHostsFiles, err := opensshKnownHostsFiles(programOptions)
+		if err != nil {
+			_ = os.RemoveAll(controlDir)
+			return nil, err
+		}
+		if strings.TrimSpace(programOptions.KnownHostsDir) != "" {
+			// UserKnownHostsFile is passed per host by targetArgs instead, so
+			// ssh records a new key in that host's own file.
+			executor.knownHostsDir, executor.knownHostsFiles, err = opensshKnownHostsDir(programOptions, knownHostsFiles)
+			if err != nil {
+				_ = os.RemoveAll(controlDir)
+				return nil, err
+			}
+		} else if len(knownHostsFiles) > 0 {
+			baseArgs = append(baseArgs, "-o", "UserKnownHostsFile="+strings.Join(knownHostsFiles, " "))
+		}
+	}
+
+	executor.binaryPath, executor.controlDir, executor.baseArgs = binaryPath, controlDir, baseArgs
+	return executor, nil
+}
+
+// opensshKnownHostsDir prepares the --known-hosts-dir directory and returns
+// it with the known_hosts files each host reads after its own.
+func opensshKnownHostsDir(programOptions *options, knownHostsFiles []string) (string, []string, error) {
+	knownHostsDir, err := expandHomePath(strings.TrimSpace(programOptions.KnownHostsDir))
+	if err != nil {
+		return "", nil, fmt.Errorf("resolve --known-hosts-dir path: %w", err)
+	}
+	if err := os.MkdirAll(knownHostsDir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("prepare --known-hosts-dir: %w", err)
+	}
+	if len(knownHostsFiles) == 0 {
+		// Overriding UserKnownHostsFile drops ssh's default file, so it is
+		// listed explicitly.
+		defaultPath, err := expandHomePath(defaultKnownHostsPath)
+		if err != nil {
+			return "", nil, err
+		}
+		knownHostsFiles = []string{defaultPath}
+	}
+	return knownHostsDir, knownHostsFiles, nil
+}
+
+// opensshKnownHostsFiles lists the known_hosts files ssh should read when
+// they differ from its default. --known-hosts-out comes first because ssh
+// records new keys in the first file.
+func opensshKnownHostsFiles(programOptions *options) ([]string, error) {
+	knownHostsPath := strings.TrimSpace(programOptions.KnownHosts)
+	knownHostsOut := strings.TrimSpace(programOptions.KnownHostsOut)
+	if knownHostsOut == "" && (knownHostsPath == "" || knownHostsPath == defaultKnownHostsPath) {
+		return nil, nil
+	}
+
+	var files []string
+	for _, path := range []string{knownHostsOut, knownHostsPath} {
+		if path == "" {
+			continue
+		}
+		expandedPath, err := expandHomePath(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expandedPath)
+	}
+	return files, nil
+}
+
+// targetArgs returns the port, login and destination arguments for a host.
+// The default port is left out so a Port from ~/.ssh/config still applies.
+func (executor *opensshExecutor) targetArgs(hostAddress, userName string) []string {
+	hostName, port, err := net.SplitHostPort(hostAddress)
+	if err != nil {
+		hostName, port = hostAddress, ""
+	}
+
+	var args []string
+	if executor.knownHostsDir != "" {
+		hostFile := filepath.Join(executor.knownHostsDir, knownHostsFileName(hostAddress))
+		args = append(args, "-o", "UserKnownHostsFile="+strings.Join(append([]string{hostFile}, executor.knownHostsFiles...), " "))
+	}
+	if port != "" && port != strconv.Itoa(defaultSSHPort) {
+		args = append(args, "-p", port)
+	}
+	if strings.TrimSpace(userName) != "" {
+		args = append(args, "-l", userName)
+	}
+	return append(args, "--", hostName)
+}
+
+func (executor *opensshExecutor) runOperation(hostAddress string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig) (remoteOperationResult, error) {
+	if preflight, ok := operation.(remoteOperationOpenSSHPreflight); ok {
+		if err := preflight.OpenSSHPreflight(executor, hostAddress, input); err != nil {
+			return remoteOperationResult{}, err
+		}
+	} else if preflight, ok := operation.(remoteOperationPreflight); ok {
+		if err := preflight.Preflight(hostAddress, input, clientConfig); err != nil {
+			return remoteOperationResult{}, err
+		}
+	}
+	script, err := prepareRemoteScript(operation, input)
+	if err != nil {
+		return remoteOperationResult{}, err
+	}
+
+	target := hostAddress + "\x00" + input.User
+	newConnection := !executor.masterStarted[target]
+	if newConnection {
+		waitForConnectionSlot()
+	}
+	args := append(append([]string{}, executor.baseArgs...), executor.targetArgs(hostAddress, input.User)...)
+	args = append(args, script.Command)
+	commandOutput, err := runOpenSSHCommand(executor.binaryPath, args, script.Stdin)
+	if exitErr, ok := errors.AsType[*exec.ExitError](err); ok && exitErr.ExitCode() == opensshConnectionErrorCode {
+		return remoteOperationResult{}, fmt.Errorf("ssh: %s", strings.TrimSpace(string(commandOutput)))
+	}
+	executor.masterStarted[target] = true
+	if newConnection {
+		emitEvent(runEvent{Event: "connected", Host: hostAddress})
+	}
+	if err != nil {
+		return remoteOperationResult{}, remoteCommandError(err, commandOutput)
+	}
+	return operation.ParseResult(string(commandOutput))
+}
+
+// verifyKeyLogin logs in to hostAddress with only the key in input, through
+// the system ssh client so ~/.ssh/config and ProxyJump apply. It opens its
+// own connection, because the ControlMaster logged in with whatever ssh
+// chose. The key is offered from IdentityFile and, through its public half,
+// from ssh-agent; IdentityFile entries in ~/.ssh/config are still offered
+// too, since ssh adds them to the list.
+func (executor *opensshExecutor) verifyKeyLogin(hostAddress string, input remoteOperationInput) error {
+	publicKeyFile, err := os.CreateTemp(executor.controlDir, "login-check-*.pub")
+	if err != nil {
+		return fmt.Errorf("write public key for the login check: %w", err)
+	}
+	defer func() { _ = os.Remove(publicKeyFile.Name()) }()
+	_, err = publicKeyFile.WriteString(strings.TrimSpace(input.PublicKey) + "\n")
+	if closeErr := publicKeyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write public key for the login check: %w", err)
+	}
+
+	// ssh keeps the first value of an option, so these win over baseArgs.
+	args := []string{
+		"-o", "ControlMaster=no",
+		"-o", "ControlPath=none",
+		"-o", "IdentitiesOnly=yes",
+		"-o", "PKCS11Provider=none",
+		"-o", "PreferredAuthentications=publickey",
+	}
+	if identityFile := strings.TrimSpace(input.IdentityFile); identityFile != "" {
+		args = append(args, "-o", "IdentityFile="+identityFile)
+	}
+	args = append(args, "-o", "IdentityFile="+publicKeyFile.Name())
+	args = append(append(args, executor.baseArgs...), executor.targetArgs(hostAddress, input.User)...)
+	args = append(args, "true")
+	waitForConnectionSlot()
+	if commandOutput, err := runOpenSSHCommand(executor.binaryPath, args, ""); err != nil {
+		return fmt.Errorf("login with installed key failed: ssh: %s", strings.TrimSpace(string(commandOutput)))
+	}
+	return nil
+}
+
+// connect starts the ControlMaster for hostAddress with -N -f: ssh exits once
+// authentication succeeds and the master stays up for later operations.
+func (executor *opensshExecutor) connect(hostAddress, userName string, _ *ssh.ClientConfig) error {
+	target := hostAddress + "\x00" + userName
+	if executor.masterStarted[target] {
+		return nil
+	}
+	waitForConnectionSlot()
+	args := append(append([]string{}, executor.baseArgs...), "-N", "-f")
+	args = append(args, executor.targetArgs(hostAddress, userName)...)
+	commandOutput, err := runOpenSSHCommand(executor.binaryPath, args, "")
+	if err != nil {
+		return fmt.Errorf("ssh: %s", strings.TrimSpace(string(commandOutput)))
+	}
+	executor.masterStarted[target] = true
+	emitEvent(runEvent{Event: "connected", Host: hostAddress})
+	return nil
+}
+
+// release stops the ControlMaster connections opened for hostAddress.
+func (executor *opensshExecutor) release(hostAddress string) {
+	for target := range executor.masterStarted {
+		targetHost, userName, _ := strings.Cut(target, "\x00")
+		if targetHost != hostAddress {
+			continue
+		}
+		args := append(append([]string{}, executor.baseArgs...), "-O", "exit")
+		args = append(args, executor.targetArgs(targetHost, userName)...)
+		_, _ = runOpenSSHCommand(executor.binaryPath, args, "")
+		delete(executor.masterStarted, target)
+	}
+}
+
+func (executor *opensshExecutor) closeAll() {
+	for target := range executor.masterStarted {
+		targetHost, _, _ := strings.Cut(target, "\x00")
+		executor.release(targetHost)
+	}
+	_ = os.RemoveAll(executor.controlDir)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type openSSHInvocation struct {
+	args  []string
+	stdin string
+}
+
+func stubOpenSSH(t *testing.T, respond func(args []string) string) *[]openSSHInvocation {
+	t.Helper()
+
+	originalLookPath, originalRun := lookPathForOpenSSH, runOpenSSHCommand
+	var invocations []openSSHInvocation
+	lookPathForOpenSSH = func(string) (string, error) { return "/usr/bin/ssh", nil }
+	runOpenSSHCommand = func(_ string, args []string, stdin string) ([]byte, error) {
+		invocations = append(invocations, openSSHInvocation{args: args, stdin: stdin})
+		return []byte(respond(args)), nil
+	}
+	t.Cleanup(func() { lookPathForOpenSSH, runOpenSSHCommand = originalLookPath, originalRun })
+	return &invocations
+}
+
+func TestOpenSSHExecutorRunsOperationsThroughSystemSSH(t *testing.T) {
+	_, _ = captureWriters(t)
+	invocations := stubOpenSSH(t, func(args []string) string {
+		if args[len(args)-1] == withRemoteHome(removeAuthorizedKeyScript, false) {
+			return authorizedKeyRemovedMarker + "\n"
+		}
+		return ""
+	})
+
+	executor, err := newOpenSSHExecutor(&options{TimeoutSec: 5, InsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatalf("newOpenSSHExecutor() error = %v", err)
+	}
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	hostRecaps, failedHosts := executeRemoteOperations(executor, []string{"app01:2222", "app02:22"},
+		[]remoteOperation{installKeyOperation{}, removeKeyOperation{}},
+		func(string) *ssh.ClientConfig { return &ssh.ClientConfig{User: "deploy"} },
+		func(host string) remoteOperationInput {
+			return remoteOperationInput{Host: host, User: "deploy", PublicKey: publicKey}
+		},
+	)
+	executor.closeAll()
+
+	if len(failedHosts) != 0 || hostRecaps["app01:2222"].ok != 2 {
+		t.Fatalf("failedHosts = %v, recaps = %+v", failedHosts, hostRecaps)
+	}
+	if len(*invocations) != 6 {
+		t.Fatalf("ssh invocations = %d, want 4 operations + 2 master exits", len(*invocations))
+	}
+
+	first := (*invocations)[0]
+	for _, wantArg := range []string{"BatchMode=yes", "ControlMaster=auto", "ConnectTimeout=5", "StrictHostKeyChecking=no"} {
+		if !slices.Contains(first.args, wantArg) {
+			t.Fatalf("args %v missing %q", first.args, wantArg)
+		}
+	}
+	if tail := strings.Join(first.args[len(first.args)-7:len(first.args)-1], " "); tail != "-p 2222 -l deploy -- app01" {
+		t.Fatalf("target args = %q", tail)
+	}
+	if first.stdin != publicKey+"\n" {
+		t.Fatalf("stdin = %q, want the key line", first.stdin)
+	}
+	if slices.Contains((*invocations)[1].args, "-p") {
+		t.Fatalf("default port should be left to ssh config: %v", (*invocations)[1].args)
+	}
+	last := (*invocations)[5]
+	if !slices.Contains(last.args, "-O") || !slices.Contains(last.args, "exit") {
+		t.Fatalf("closeAll did not stop the control master: %v", last.args)
+	}
+}
+
+func TestRunWithUseOpenSSHSkipsPasswordPrompt(t *testing.T) {
+	_, _ = captureWriters(t)
+	stubOpenSSH(t, func([]string) string { return "" })
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVER=app01\nUSER=deploy\nKEY='" + publicKey + "'\nINSECURE_IGNORE_HOST_KEY=true\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--use-openssh"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(--use-openssh) error = %v", err)
+	}
+}
+
+func TestOpenSSHExecutorKnownHostsDirIsPerHost(t *testing.T) {
+	stubOpenSSH(t, func([]string) string { return "" })
+	tempDirectory := t.TempDir()
+	knownHostsPath := filepath.Join(tempDirectory, "known_hosts")
+	knownHostsDir := filepath.Join(tempDirectory, "hosts")
+
+	executor, err := newOpenSSHExecutor(&options{KnownHosts: knownHostsPath, KnownHostsDir: knownHostsDir})
+	if err != nil {
+		t.Fatalf("newOpenSSHExecutor() error = %v", err)
+	}
+	t.Cleanup(executor.closeAll)
+	for _, arg := range executor.baseArgs {
+		if strings.HasPrefix(arg, "UserKnownHostsFile=") {
+			t.Fatalf("base args %v set UserKnownHostsFile for every host", executor.baseArgs)
+		}
+	}
+	if info, err := os.Stat(knownHostsDir); err != nil || !info.IsDir() {
+		t.Fatalf("--known-hosts-dir not created: %v", err)
+	}
+	args := strings.Join(executor.targetArgs("app01:2222", "deploy"), " ")
+	want := "-o UserKnownHostsFile=" + filepath.Join(knownHostsDir, "app01_2222") + " " + knownHostsPath + " -p 2222"
+	if !strings.HasPrefix(args, want) {
+		t.Fatalf("target args = %q, want prefix %q", args, want)
+	}
+}
+
+func TestOpenSSHExecutorFailedConnectionStaysNew(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	restoreEvents, err := configureEventStream(eventsFormatNDJSON)
+	if err != nil {
+		t.Fatalf("configureEventStream() error = %v", err)
+	}
+	t.Cleanup(restoreEvents)
+	connectionErr := exec.Command("sh", "-c", "exit 255").Run()
+	originalLookPath, originalRun := lookPathForOpenSSH, runOpenSSHCommand
+	calls := 0
+	lookPathForOpenSSH = func(string) (string, error) { return "/usr/bin/ssh", nil }
+	runOpenSSHCommand = func(string, []string, string) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			return []byte("ssh: connect to host app01 port 22: Connection refused"), connectionErr
+		}
+		return []byte(authorizedKeyAddedMarker + "\n"), nil
+	}
+	t.Cleanup(func() { lookPathForOpenSSH, runOpenSSHCommand = originalLookPath, originalRun })
+
+	executor, err := newOpenSSHExecutor(&options{InsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatalf("newOpenSSHExecutor() error = %v", err)
+	}
+	t.Cleanup(executor.closeAll)
+	input := remoteOperationInput{Host: "app01:22", User: "deploy", PublicKey: strings.TrimSpace(generateTestKey(t))}
+	if _, err := executor.runOperation("app01:22", installKeyOperation{}, input, &ssh.ClientConfig{}); err == nil {
+		t.Fatal("runOperation() error = nil for a refused connection")
+	}
+	if executor.masterStarted["app01:22\x00deploy"] {
+		t.Fatal("a refused connection was recorded as a started master")
+	}
+	if strings.Contains(outputBuffer.String(), `"connected"`) {
+		t.Fatalf("connected event for a refused connection: %s", outputBuffer.String())
+	}
+	if _, err := executor.runOperation("app01:22", installKeyOperation{}, input, &ssh.ClientConfig{}); err != nil {
+		t.Fatalf("runOperation() retry error = %v", err)
+	}
+	if !strings.Contains(outputBuffer.String(), `"event":"connected"`) {
+		t.Fatalf("no connected event once the connection worked: %s", outputBuffer.String())
+	}
+}
+
+func TestOpenSSHExecutorHardenChecksKeyLoginThroughSSH(t *testing.T) {
+	_, _ = captureWriters(t)
+	invocations := stubOpenSSH(t, func(args []string) string {
+		if args[len(args)-1] == "true" {
+			return ""
+		}
+		return sshdHardenedMarker + "\n"
+	})
+	originalVerify := verifyKeyLoginForHardening
+	verifyKeyLoginForHardening = func(string, remoteOperationInput, *ssh.ClientConfig) error {
+		t.Fatal("the built-in client checked the key login under --use-openssh")
+		return nil
+	}
+	t.Cleanup(func() { verifyKeyLoginForHardening = originalVerify })
+
+	executor, err := newOpenSSHExecutor(&options{})
+	if err != nil {
+		t.Fatalf("newOpenSSHExecutor() error = %v", err)
+	}
+	t.Cleanup(executor.closeAll)
+	input := remoteOperationInput{Host: "app01:22", User: "deploy", PublicKey: strings.TrimSpace(generateTestKey(t)), IdentityFile: "~/.ssh/deploy"}
+	if _, err := executor.runOperation("app01:22", hardenSSHDOperation{}, input, &ssh.ClientConfig{}); err != nil {
+		t.Fatalf("runOperation() error = %v", err)
+	}
+	if len(*invocations) != 2 {
+		t.Fatalf("ssh invocations = %d, want the login check and the script", len(*invocations))
+	}
+	check := strings.Join((*invocations)[0].args, " ")
+	for _, want := range []string{"ControlMaster=no", "IdentitiesOnly=yes", "PreferredAuthentications=publickey", "IdentityFile=~/.ssh/deploy", "-- app01 true"} {
+		if !strings.Contains(check, want) {
+			t.Fatalf("login check args %q missing %q", check, want)
+		}
+	}
+	if strings.Index(check, "ControlMaster=no") > strings.Index(check, "ControlMaster=auto") {
+		t.Fatalf("login check would reuse the ControlMaster: %q", check)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	sshdAuditCompleteMarker = "sshd audit complete"
+	// defaultSSHDPolicy allows root login with keys only and no passwords.
+	defaultSSHDPolicy = "permitrootlogin=no|prohibit-password|without-password,passwordauthentication=no,pubkeyauthentication=yes"
+)
+
+// auditedSSHDDirectives are always fetched and shown, whether or not the
+// policy has a rule for them.
+var auditedSSHDDirectives = []string{"permitrootlogin", "passwordauthentication", "pubkeyauthentication", "authorizedkeysfile"}
+
+var sshdDirectivePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// auditSSHDScriptTemplate prints the effective settings (sshd -T, which
+// resolves includes and defaults) for the audited directives.
+const auditSSHDScriptTemplate = "set -eu\n" +
+	"SSHD=$(command -v sshd || echo /usr/sbin/sshd)\n" +
+	"if ! CONFIG=$(\"$SSHD\" -T 2>&1); then\n" +
+	"  printf '%s\\n' \"$CONFIG\" >&2\n" +
+	"  exit 1\n" +
+	"fi\n" +
+	"printf '%s\\n' \"$CONFIG\" | grep -E {{ shquote .Vars.pattern }} || true\n" +
+	"echo {{ shquote .Vars.complete }}\n"
+
+var auditSSHDTemplate = parseRemoteScriptTemplate("audit-sshd script", auditSSHDScriptTemplate)
+
+// sshdPolicyRule allows a directive one of several effective values.
+type sshdPolicyRule struct {
+	directive string
+	allowed   []string
+}
+
+var (
+	sshdPolicyMu     sync.Mutex
+	sshdPolicyRules  = mustParseSSHDPolicy(defaultSSHDPolicy)
+	defaultSSHDRules = sshdPolicyRules
+)
+
+// parseSSHDPolicy reads comma-separated directive=value rules, where
+// value may list alternatives separated by |. Directives are matched as
+// sshd -T prints them (lowercase); values compare case-insensitively, except
+// authorizedkeysfile, which holds paths.
+func parseSSHDPolicy(text string) ([]sshdPolicyRule, error) {
+	var rules []sshdPolicyRule
+	for entry := range strings.SplitSeq(text, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		directive, values, ok := strings.Cut(entry, "=")
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if !ok || !sshdDirectivePattern.MatchString(directive) {
+			return nil, fmt.Errorf("invalid sshd policy rule %q: want directive=value[|value...]", entry)
+		}
+		var allowed []string
+		for value := range strings.SplitSeq(values, "|") {
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				allowed = append(allowed, value)
+			}
+		}
+		if len(allowed) == 0 {
+			return nil, fmt.Errorf("invalid sshd policy rule %q: no allowed value", entry)
+		}
+		rules = append(rules, sshdPolicyRule{directive: directive, allowed: allowed})
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("sshd policy has no rules")
+	}
+	return rules, nil
+}
+
+func mustParseSSHDPolicy(text string) []sshdPolicyRule {
+	rules, err := parseSSHDPolicy(text)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// configureSSHDPolicy sets the policy audit-sshd checks hosts against
+// (--sshd-policy); empty keeps the default. The returned function restores
+// the default.
+func configureSSHDPolicy(text string) (func(), error) {
+	rules := defaultSSHDRules
+	if strings.TrimSpace(text) != "" {
+		var err error
+		if rules, err = parseSSHDPolicy(text); err != nil {
+			return nil, err
+		}
+	}
+	sshdPolicyMu.Lock()
+	sshdPolicyRules = rules
+	sshdPolicyMu.Unlock()
+	return func() {
+		sshdPolicyMu.Lock()
+		sshdPolicyRules = defaultSSHDRules
+		sshdPolicyMu.Unlock()
+	}, nil
+}
+
+func currentSSHDPolicy() []sshdPolicyRule {
+	sshdPolicyMu.Lock()
+	defer sshdPolicyMu.Unlock()
+	return sshdPolicyRules
+}
+
+// sshdPolicyError lists the directives of a host that break the policy.
+type sshdPolicyError struct {
+	violations []string
+}
+
+func (err *sshdPolicyError) Error() string {
+	return "sshd_config not compliant: " + strings.Join(err.violations, "; ")
+}
+
+type auditSSHDOperation struct{}
+
+func init() {
+	registerRemoteOperation(auditSSHDOperation{})
+}
+
+func (auditSSHDOperation) Name() string {
+	return "audit-sshd"
+}
+
+func (auditSSHDOperation) Title() string {
+	return "Audit sshd_config"
+}
+
+// WithoutPublicKey marks audit-sshd as not using the key.
+func (auditSSHDOperation) WithoutPublicKey() {}
+
+func (auditSSHDOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	directives := slices.Clone(auditedSSHDDirectives)
+	for _, rule := range currentSSHDPolicy() {
+		if !slices.Contains(directives, rule.directive) {
+			directives = append(directives, rule.directive)
+		}
+	}
+	command, err := renderRemoteScript(auditSSHDTemplate, remoteScriptDataFor(input, map[string]string{
+		"pattern":  "^(" + strings.Join(directives, "|") + ") ",
+		"complete": sshdAuditCompleteMarker,
+	}))
+	if err != nil {
+		return remoteScript{}, err
+	}
+	// sshd -T needs root to read the host keys.
+	return remoteScript{Command: command, Description: "sshd_config audit", Sudo: true}, nil
+}
+
+// ParseResult checks the effective settings against the policy. A
+// non-compliant host fails with the offending directives; a compliant one
+// shows the audited values.
+func (auditSSHDOperation) ParseResult(output string) (remoteOperationResult, error) {
+	if !strings.Contains(output, sshdAuditCompleteMarker) {
+		return remoteOperationResult{}, errors.New("sshd audit script did not report completion")
+	}
+	settings := map[string]string{}
+	var collected []string
+	for line := range strings.SplitSeq(normalizeLF(output), "\n") {
+		line = strings.TrimSpace(line)
+		directive, value, ok := strings.Cut(line, " ")
+		if !ok || line == sshdAuditCompleteMarker {
+			continue
+		}
+		directive = strings.ToLower(directive)
+		if _, seen := settings[directive]; !seen {
+			settings[directive] = strings.Join(strings.Fields(value), " ")
+			collected = append(collected, directive+" "+settings[directive])
+		}
+	}
+
+	var violations []string
+	for _, rule := range currentSSHDPolicy() {
+		value, reported := settings[rule.directive]
+		switch {
+		case !reported:
+			violations = append(violations, rule.directive+" not reported by sshd -T")
+		case !sshdValueAllowed(rule, value):
+			violations = append(violations, fmt.Sprintf("%s is %s, want %s", rule.directive, value, strings.Join(rule.allowed, " or ")))
+		}
+	}
+	if len(violations) > 0 {
+		return remoteOperationResult{}, &sshdPolicyError{violations: violations}
+	}
+
+	var shown []string
+	for _, directive := range auditedSSHDDirectives {
+		if value, reported := settings[directive]; reported {
+			shown = append(shown, directive+" "+value)
+		}
+	}
+	return remoteOperationResult{
+		Message: "compliant: " + strings.Join(shown, ", "),
+		Output:  strings.Join(collected, "\n"),
+	}, nil
+}
+
+func sshdValueAllowed(rule sshdPolicyRule, value string) bool {
+	for _, allowed := range rule.allowed {
+		if value == allowed || (rule.directive != "authorizedkeysfile" && strings.EqualFold(value, allowed)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const compliantSSHDOutput = "port 22\npermitrootlogin without-password\npubkeyauthentication yes\npasswordauthentication no\nauthorizedkeysfile .ssh/authorized_keys .ssh/authorized_keys2\n" + sshdAuditCompleteMarker + "\n"
+
+func setSSHDPolicyForTest(t *testing.T, policy string) {
+	t.Helper()
+	restore, err := configureSSHDPolicy(policy)
+	if err != nil {
+		t.Fatalf("configureSSHDPolicy() error = %v", err)
+	}
+	t.Cleanup(restore)
+}
+
+func TestParseSSHDPolicy(t *testing.T) {
+	rules, err := parseSSHDPolicy(" PasswordAuthentication=no , authorizedkeysfile=.ssh/authorized_keys|/etc/ssh/keys/%u ")
+	if err != nil || len(rules) != 2 || rules[0].directive != "passwordauthentication" || len(rules[1].allowed) != 2 {
+		t.Fatalf("parseSSHDPolicy() = %+v, %v", rules, err)
+	}
+	for _, policy := range []string{"", ",", "passwordauthentication", "password-auth=no", "permitrootlogin=|"} {
+		if _, err := parseSSHDPolicy(policy); err == nil {
+			t.Fatalf("parseSSHDPolicy(%q) accepted", policy)
+		}
+	}
+}
+
+func TestAuditSSHDParseResultReportsCompliantHost(t *testing.T) {
+	result, err := auditSSHDOperation{}.ParseResult(compliantSSHDOutput)
+	if err != nil || result.Changed {
+		t.Fatalf("ParseResult() = %+v, %v", result, err)
+	}
+	want := "compliant: permitrootlogin without-password, passwordauthentication no, pubkeyauthentication yes, authorizedkeysfile .ssh/authorized_keys .ssh/authorized_keys2"
+	if result.Message != want || !strings.Contains(result.Output, "authorizedkeysfile") {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestAuditSSHDParseResultListsViolations(t *testing.T) {
+	setSSHDPolicyForTest(t, defaultSSHDPolicy+",authorizedkeysfile=/etc/ssh/keys/%u,x11forwarding=no")
+	output := strings.Replace(compliantSSHDOutput, "passwordauthentication no", "passwordauthentication yes", 1)
+	_, err := auditSSHDOperation{}.ParseResult(output)
+	policyErr, ok := errors.AsType[*sshdPolicyError](err)
+	if !ok || len(policyErr.violations) != 3 {
+		t.Fatalf("ParseResult() error = %v", err)
+	}
+	for _, want := range []string{"passwordauthentication is yes, want no", "authorizedkeysfile is .ssh/authorized_keys .ssh/authorized_keys2, want /etc/ssh/keys/%u", "x11forwarding not reported by sshd -T"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q missing %q", err, want)
+		}
+	}
+	if _, err := (auditSSHDOperation{}).ParseResult("sudo: a password is required\n"); err == nil {
+		t.Fatalf("ParseResult() accepted output without the completion marker")
+	}
+}
+
+func TestAuditSSHDScriptRunsLocally(t *testing.T) {
+	setSSHDPolicyForTest(t, "passwordauthentication=no,x11forwarding=no")
+	binDir := t.TempDir()
+	fakeSSHD := "#!/bin/sh\n[ \"$1\" = -T ] || exit 2\nprintf 'port 22\\nx11forwarding no\\npasswordauthentication no\\npermitrootlogin no\\n'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "sshd"), []byte(fakeSSHD), 0o700); err != nil { // #nosec G306 -- test executable
+		t.Fatalf("write fake sshd: %v", err)
+	}
+	script, err := auditSSHDOperation{}.Script(remoteOperationInput{})
+	if err != nil || !script.Sudo {
+		t.Fatalf("Script() = %+v, %v", script, err)
+	}
+	command := exec.Command("sh", "-c", script.Command) // #nosec G204 -- test runs the rendered built-in script
+	command.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	output, err := command.CombinedOutput()
+	if err != nil {
+		t.Fatalf("script error = %v: %s", err, output)
+	}
+	if want := "x11forwarding no\npasswordauthentication no\npermitrootlogin no\n" + sshdAuditCompleteMarker + "\n"; string(output) != want {
+		t.Fatalf("script output = %q, want %q", output, want)
+	}
+	if _, err := (auditSSHDOperation{}).ParseResult(string(output)); err != nil {
+		t.Fatalf("ParseResult() error = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const convergedKeysMarker = "authorized keys converged"
+
+// convergeAuthorizedKeysScript reads "<blob> <key line>" pairs from stdin,
+// appends keys whose blob is missing and, when EXCLUSIVE=1, drops every key
+// line that carries none of the desired blobs. Comments and blank lines stay.
+const convergeAuthorizedKeysScript = "set -eu\n" +
+	"umask 077\n" +
+	"mkdir -p ~/.ssh\n" +
+	"touch ~/.ssh/authorized_keys\n" +
+	"chmod 700 ~/.ssh\n" +
+	"chmod 600 ~/.ssh/authorized_keys\n" +
+	"BLOBS=$(mktemp)\n" +
+	"trap 'rm -f \"$BLOBS\"' EXIT\n" +
+	"ADDED=0\n" +
+	"REMOVED=0\n" +
+	"while IFS=' ' read -r BLOB KEY; do\n" +
+	"  [ -n \"$BLOB\" ] || continue\n" +
+	"  printf '%s\\n' \"$BLOB\" >> \"$BLOBS\"\n" +
+	"  if ! grep -qF \" $BLOB\" ~/.ssh/authorized_keys; then\n" +
+	"    printf '%s\\n' \"$KEY\" >> ~/.ssh/authorized_keys\n" +
+	"    ADDED=$((ADDED + 1))\n" +
+	"  fi\n" +
+	"done\n" +
+	"if [ \"$EXCLUSIVE\" = 1 ] && [ -s \"$BLOBS\" ]; then\n" +
+	"  UPDATED=$(mktemp ~/.ssh/authorized_keys.XXXXXX)\n" +
+	"  while IFS= read -r LINE || [ -n \"$LINE\" ]; do\n" +
+	"    case \"$LINE\" in\n" +
+	"      ''|'#'*) printf '%s\\n' \"$LINE\" >> \"$UPDATED\" ;;\n" +
+	"      *) if printf '%s\\n' \"$LINE\" | grep -qF -f \"$BLOBS\"; then printf '%s\\n' \"$LINE\" >> \"$UPDATED\"; else REMOVED=$((REMOVED + 1)); fi ;;\n" +
+	"    esac\n" +
+	"  done < ~/.ssh/authorized_keys\n" +
+	"  cat \"$UPDATED\" > ~/.ssh/authorized_keys\n" +
+	"  rm -f \"$UPDATED\"\n" +
+	"fi\n" +
+	"echo \"" + convergedKeysMarker + " added=$ADDED removed=$REMOVED\"\n"
+
+// convergeKeysOperation makes authorized_keys match input.DesiredKeys. It is
+// driven by `apply` and not registered for OPERATIONS, since it needs a full
+// desired key set rather than a single key.
+type convergeKeysOperation struct{}
+
+func (convergeKeysOperation) Name() string {
+	return "converge-keys"
+}
+
+func (convergeKeysOperation) Title() string {
+	return "Converge authorized keys"
+}
+
+func (convergeKeysOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	if len(input.DesiredKeys) == 0 {
+		return remoteScript{}, errors.New("desired keys are required")
+	}
+
+	var stdin strings.Builder
+	for _, desiredKey := range input.DesiredKeys {
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(desiredKey))
+		if err != nil {
+			return remoteScript{}, fmt.Errorf("invalid public key format: %w", err)
+		}
+		stdin.WriteString(publicKeyBlob(parsedKey) + " " + strings.TrimSpace(desiredKey) + "\n")
+	}
+
+	exclusive := "0"
+	if input.RemoveExtraKeys {
+		exclusive = "1"
+	}
+	return remoteScript{
+		Command:     "EXCLUSIVE=" + exclusive + "\n" + convergeAuthorizedKeysScript,
+		Stdin:       stdin.String(),
+		Description: "authorized_keys convergence",
+		UsesHome:    true,
+	}, nil
+}
+
+func (convergeKeysOperation) ParseResult(output string) (remoteOperationResult, error) {
+	markerIndex := strings.LastIndex(output, convergedKeysMarker)
+	if markerIndex < 0 {
+		return remoteOperationResult{}, errors.New("convergence script did not report completion")
+	}
+
+	var added, removed int
+	summary := strings.TrimSpace(output[markerIndex+len(convergedKeysMarker):])
+	if _, err := fmt.Sscanf(summary, "added=%d removed=%d", &added, &removed); err != nil {
+		return remoteOperationResult{}, fmt.Errorf("parse convergence summary %q: %w", summary, err)
+	}
+	return remoteOperationResult{
+		Changed: added+removed > 0,
+		Message: fmt.Sprintf("%d key(s) added, %d removed", added, removed),
+	}, nil
+}
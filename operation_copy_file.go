@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	copyFileOperationName = "copy-file"
+	fileCopiedMarker      = "file copied"
+	fileUnchangedMarker   = "file unchanged"
+	// fileContentMarker precedes the file content on stdin. Everything before
+	// it is skipped, so a sudo password line that sudo did not read (NOPASSWD)
+	// never ends up in the file.
+	fileContentMarker = "ssh-key-bootstrap file content follows"
+)
+
+// copyFileScriptTemplate writes the content to a temporary file next to the
+// destination and moves it into place, so nothing ever reads a half-written
+// sudoers drop-in or sshd_config. An identical file with the same mode is
+// left alone.
+const copyFileScriptTemplate = "set -eu\n" +
+	"DEST={{ if .Vars.home }}\"$HOME\"/{{ end }}{{ shquote .Vars.path }}\n" +
+	"MODE={{ shquote .Vars.mode }}\n" +
+	"TMP=$(mktemp \"$(dirname \"$DEST\")/.ssh-key-bootstrap.XXXXXX\")\n" +
+	"trap 'rm -f \"$TMP\"' EXIT\n" +
+	"while IFS= read -r line; do [ \"$line\" = {{ shquote .Vars.content }} ] && break; done\n" +
+	"cat > \"$TMP\"\n" +
+	"chmod \"$MODE\" \"$TMP\"\n" +
+	"if [ -f \"$DEST\" ] && cmp -s \"$TMP\" \"$DEST\" && [ -n \"$(find \"$DEST\" -prune -perm \"$MODE\")\" ]; then\n" +
+	"  echo {{ shquote .Vars.unchanged }}\n" +
+	"  exit 0\n" +
+	"fi\n" +
+	"mv -f \"$TMP\" \"$DEST\"\n" +
+	"echo {{ shquote .Vars.copied }}\n"
+
+var copyFileTemplate = parseRemoteScriptTemplate("copy-file script", copyFileScriptTemplate)
+
+// remoteFileCopy is a local file pushed to the same path on every host
+// (--src, --dest, --mode). Dest is absolute, or starts with ~/ for a path in
+// the login user's home.
+type remoteFileCopy struct {
+	Content []byte
+	Dest    string
+	Mode    fs.FileMode
+}
+
+// loadRemoteFileCopy reads --src and checks --dest and --mode when the
+// copy-file operation is selected.
+func loadRemoteFileCopy(programOptions *options, operations []remoteOperation) (remoteFileCopy, error) {
+	source := strings.TrimSpace(programOptions.CopySource)
+	dest := strings.TrimSpace(programOptions.CopyDest)
+	modeText := strings.TrimSpace(programOptions.CopyMode)
+	if !containsRemoteOperation(operations, copyFileOperationName) {
+		if source != "" || dest != "" || modeText != "" {
+			return remoteFileCopy{}, fmt.Errorf("--src, --dest and --mode need the %s operation (use the copy subcommand or add it to OPERATIONS)", copyFileOperationName)
+		}
+		return remoteFileCopy{}, nil
+	}
+	if source == "" || dest == "" {
+		return remoteFileCopy{}, fmt.Errorf("%s needs --src and --dest", copyFileOperationName)
+	}
+
+	relative, inHome := strings.CutPrefix(dest, "~/")
+	if !inHome && !path.IsAbs(dest) {
+		return remoteFileCopy{}, fmt.Errorf("--dest %q must be an absolute path or start with ~/", dest)
+	}
+	if strings.HasSuffix(dest, "/") || path.Clean("/"+relative) == "/" {
+		return remoteFileCopy{}, fmt.Errorf("--dest %q must name a file, not a directory", dest)
+	}
+	if inHome {
+		dest = "~/" + strings.TrimPrefix(path.Clean("/"+relative), "/")
+	} else {
+		dest = path.Clean(dest)
+	}
+
+	sourcePath, err := expandHomePath(source)
+	if err != nil {
+		return remoteFileCopy{}, err
+	}
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return remoteFileCopy{}, fmt.Errorf("read --src: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return remoteFileCopy{}, fmt.Errorf("--src %s is not a regular file", source)
+	}
+	content, err := os.ReadFile(sourcePath) // #nosec G304 -- operator-selected file to copy
+	if err != nil {
+		return remoteFileCopy{}, fmt.Errorf("read --src: %w", err)
+	}
+
+	mode := info.Mode().Perm()
+	if modeText != "" {
+		parsedMode, err := strconv.ParseUint(modeText, 8, 32)
+		if err != nil || parsedMode > 0o777 {
+			return remoteFileCopy{}, fmt.Errorf("--mode %q must be octal permission bits like 0644", modeText)
+		}
+		mode = fs.FileMode(parsedMode)
+	}
+	return remoteFileCopy{Content: content, Dest: dest, Mode: mode}, nil
+}
+
+type copyFileOperation struct{}
+
+func init() {
+	registerRemoteOperation(copyFileOperation{})
+}
+
+func (copyFileOperation) Name() string {
+	return copyFileOperationName
+}
+
+func (copyFileOperation) Title() string {
+	return "Copy file"
+}
+
+// WithoutPublicKey marks copy-file as not using the key, so a copy on its
+// own does not ask for one.
+func (copyFileOperation) WithoutPublicKey() {}
+
+// Script writes files under ~/ as the login user and everything else as
+// root, since absolute destinations are system files such as sudoers
+// drop-ins.
+func (copyFileOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	if input.File.Dest == "" {
+		return remoteScript{}, fmt.Errorf("%s needs --src and --dest", copyFileOperationName)
+	}
+	relative, inHome := strings.CutPrefix(input.File.Dest, "~/")
+	home := ""
+	if inHome {
+		home = "1"
+	}
+	command, err := renderRemoteScript(copyFileTemplate, remoteScriptDataFor(input, map[string]string{
+		"path":      relative,
+		"home":      home,
+		"mode":      fmt.Sprintf("%04o", input.File.Mode),
+		"content":   fileContentMarker,
+		"copied":    fileCopiedMarker,
+		"unchanged": fileUnchangedMarker,
+	}))
+	if err != nil {
+		return remoteScript{}, err
+	}
+	return remoteScript{
+		Command:     command,
+		Stdin:       fileContentMarker + "\n" + string(input.File.Content),
+		Description: "copy to " + input.File.Dest,
+		Sudo:        !inHome,
+		UsesHome:    inHome,
+	}, nil
+}
+
+func (copyFileOperation) ParseResult(output string) (remoteOperationResult, error) {
+	switch {
+	case strings.Contains(output, fileUnchangedMarker):
+		return remoteOperationResult{Changed: false, Message: fileUnchangedMarker}, nil
+	case strings.Contains(output, fileCopiedMarker):
+		return remoteOperationResult{Changed: true}, nil
+	default:
+		return remoteOperationResult{}, errors.New("copy-file script did not report completion")
+	}
+}
+
+func (copyFileOperation) ScriptRan(output string) bool {
+	return strings.Contains(output, fileUnchangedMarker) || strings.Contains(output, fileCopiedMarker)
+}
+
+// RunSFTP writes the file over SFTP, with ~/ relative to the directory the
+// SFTP session starts in. It cannot become root, so absolute destinations
+// must be writable by the login user.
+func (copyFileOperation) RunSFTP(client *sftpClient, input remoteOperationInput) (remoteOperationResult, error) {
+	remotePath := input.File.Dest
+	if relative, inHome := strings.CutPrefix(remotePath, "~/"); inHome {
+		home, err := client.realPath(".")
+		if err != nil {
+			return remoteOperationResult{}, err
+		}
+		remotePath = path.Join(home, relative)
+	}
+	current, err := client.readFile(remotePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return remoteOperationResult{}, err
+	}
+	if err == nil && bytes.Equal(current, input.File.Content) {
+		if mode, err := client.stat(remotePath); err == nil && mode == input.File.Mode {
+			return remoteOperationResult{Changed: false, Message: fileUnchangedMarker}, nil
+		}
+	}
+	if err := client.writeFile(remotePath, input.File.Content, input.File.Mode); err != nil {
+		return remoteOperationResult{}, fmt.Errorf("write %s: %w", remotePath, err)
+	}
+	if err := client.chmod(remotePath, input.File.Mode); err != nil {
+		return remoteOperationResult{}, fmt.Errorf("chmod %s: %w", remotePath, err)
+	}
+	return remoteOperationResult{Changed: true}, nil
+}
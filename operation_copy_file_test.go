@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLoadRemoteFileCopy(t *testing.T) {
+	sourcePath := filepath.Join(t.TempDir(), "90-deploy")
+	if err := os.WriteFile(sourcePath, []byte("deploy ALL=(ALL) NOPASSWD: ALL\n"), 0o640); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	copyOperation := []remoteOperation{copyFileOperation{}}
+
+	fileCopy, err := loadRemoteFileCopy(&options{CopySource: sourcePath, CopyDest: "/etc/sudoers.d/90-deploy", CopyMode: "0440"}, copyOperation)
+	if err != nil || fileCopy.Dest != "/etc/sudoers.d/90-deploy" || fileCopy.Mode != 0o440 || !strings.HasPrefix(string(fileCopy.Content), "deploy ALL") {
+		t.Fatalf("loadRemoteFileCopy() = %+v, %v", fileCopy, err)
+	}
+	fileCopy, err = loadRemoteFileCopy(&options{CopySource: sourcePath, CopyDest: "~/bin//../.profile"}, copyOperation)
+	if err != nil || fileCopy.Dest != "~/.profile" || fileCopy.Mode != 0o640 {
+		t.Fatalf("loadRemoteFileCopy(home) = %+v, %v", fileCopy, err)
+	}
+
+	for name, programOptions := range map[string]*options{
+		"missing dest":  {CopySource: sourcePath},
+		"relative dest": {CopySource: sourcePath, CopyDest: "etc/motd"},
+		"directory":     {CopySource: sourcePath, CopyDest: "/etc/sudoers.d/"},
+		"home only":     {CopySource: sourcePath, CopyDest: "~/"},
+		"bad mode":      {CopySource: sourcePath, CopyDest: "/etc/motd", CopyMode: "rw-r--r--"},
+		"setuid mode":   {CopySource: sourcePath, CopyDest: "/etc/motd", CopyMode: "4755"},
+		"missing src":   {CopySource: sourcePath + ".missing", CopyDest: "/etc/motd"},
+		"src directory": {CopySource: filepath.Dir(sourcePath), CopyDest: "/etc/motd"},
+	} {
+		if _, err := loadRemoteFileCopy(programOptions, copyOperation); err == nil {
+			t.Fatalf("%s: loadRemoteFileCopy() accepted %+v", name, programOptions)
+		}
+	}
+	if _, err := loadRemoteFileCopy(&options{CopySource: sourcePath}, []remoteOperation{installKeyOperation{}}); err == nil {
+		t.Fatalf("--src accepted without the copy-file operation")
+	}
+}
+
+func TestCopyFileScriptRunsLocally(t *testing.T) {
+	home := t.TempDir()
+	input := remoteOperationInput{File: remoteFileCopy{Content: []byte("line one\nno newline"), Dest: "~/conf/app.conf", Mode: 0o640}}
+	if err := os.Mkdir(filepath.Join(home, "conf"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	script, err := copyFileOperation{}.Script(input)
+	if err != nil || script.Sudo || !script.UsesHome {
+		t.Fatalf("Script() = %+v, %v", script, err)
+	}
+
+	runScript := func() string {
+		t.Helper()
+		command := exec.Command("sh", "-c", script.Command) // #nosec G204 -- test runs the rendered built-in script
+		command.Env = append(os.Environ(), "HOME="+home)
+		// A password line that sudo did not read must not reach the file.
+		command.Stdin = strings.NewReader("secret\n" + script.Stdin)
+		output, err := command.CombinedOutput()
+		if err != nil {
+			t.Fatalf("script error = %v: %s", err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if output := runScript(); output != fileCopiedMarker {
+		t.Fatalf("first run output = %q", output)
+	}
+	destPath := filepath.Join(home, "conf", "app.conf")
+	content, err := os.ReadFile(destPath) // #nosec G304 -- test temp file
+	if err != nil || string(content) != "line one\nno newline" {
+		t.Fatalf("copied content = %q, %v", content, err)
+	}
+	if info, err := os.Stat(destPath); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("copied mode = %v, %v", info.Mode(), err)
+	}
+	if output := runScript(); output != fileUnchangedMarker {
+		t.Fatalf("second run output = %q", output)
+	}
+	if err := os.Chmod(destPath, 0o600); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	if output := runScript(); output != fileCopiedMarker {
+		t.Fatalf("run after mode change output = %q", output)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(home, "conf", ".ssh-key-bootstrap.*")); len(leftovers) > 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestCopyFileRunSFTPSkipsIdenticalFile(t *testing.T) {
+	entries := map[string]*fakeSFTPEntry{"/home/upload": {dir: true, mode: 0o755}}
+	client := newFakeSFTP(t, entries)
+	input := remoteOperationInput{File: remoteFileCopy{Content: []byte("export EDITOR=vi\n"), Dest: "~/.profile", Mode: 0o644}}
+
+	result, err := copyFileOperation{}.RunSFTP(client, input)
+	if err != nil || !result.Changed {
+		t.Fatalf("first RunSFTP() = %+v, %v", result, err)
+	}
+	if profile := entries["/home/upload/.profile"]; profile == nil || string(profile.data) != "export EDITOR=vi\n" || profile.mode != fs.FileMode(0o644) {
+		t.Fatalf("remote file = %+v", profile)
+	}
+	result, err = copyFileOperation{}.RunSFTP(client, input)
+	if err != nil || result.Changed || result.Message != fileUnchangedMarker {
+		t.Fatalf("second RunSFTP() = %+v, %v", result, err)
+	}
+}
+
+func TestRunCopyCommandPushesFileWithoutKey(t *testing.T) {
+	captureWriters(t)
+	sourcePath := filepath.Join(t.TempDir(), "90-deploy")
+	if err := os.WriteFile(sourcePath, []byte("deploy ALL=(ALL) NOPASSWD: ALL\n"), 0o600); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("SERVERS=in-memory\nUSER=deploy\nPASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\nOPERATIONS=harden-sshd\n"), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	var capturedCommand, capturedStdin string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
+			capturedCommand, capturedStdin = command, stdin
+			return fileCopiedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "copy", "--env", dotEnvPath, "--src", sourcePath, "--dest", "/etc/sudoers.d/90-deploy", "--mode", "0440"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(copy) error = %v", err)
+	}
+	if !strings.Contains(capturedCommand, "sudo -S") || !strings.Contains(capturedCommand, "0440") || !strings.Contains(capturedCommand, "/etc/sudoers.d/90-deploy") {
+		t.Fatalf("command = %q", capturedCommand)
+	}
+	// The fake server only reads the first stdin line: the sudo password.
+	if capturedStdin != "password\n" {
+		t.Fatalf("stdin = %q, want the sudo password line", capturedStdin)
+	}
+}
+
+func TestRunRejectsCopyFlagsWithoutCopyOperation(t *testing.T) {
+	captureWriters(t)
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--src", "/etc/hosts", "--dest", "/etc/hosts"})
+	var statusErr *statusError
+	if err := run(capturedRuntimeIO()); !errors.As(err, &statusErr) || statusErr.code != 2 {
+		t.Fatalf("run() error = %v, want config status", err)
+	}
+}
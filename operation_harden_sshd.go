@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshdAlreadyHardenedMarker = "sshd already hardened"
+	sshdHardenedMarker        = "sshd hardened"
+)
+
+// sshdGlobalAuthFilter is the awk program that drops the password and public
+// key directives from the global section of sshd_config, before the first
+// Match block. Directives inside Match blocks are per-user or per-address
+// policy the operator set on purpose and are kept.
+const sshdGlobalAuthFilter = `tolower($0) ~ /^[ \t]*match[ \t]/ { inMatch = 1 }
+inMatch || (tolower($0) !~ /^[ \t]*(passwordauthentication|pubkeyauthentication)[ \t]/ && $0 != "# Managed by ssh-key-bootstrap")`
+
+// hardenSSHDScript prepends the key-only directives to sshd_config so they win
+// over later (first-match) settings, validates the candidate file with
+// `sshd -t` before installing it, keeps a backup, and reloads sshd.
+const hardenSSHDScript = "set -eu\n" +
+	"CONFIG=/etc/ssh/sshd_config\n" +
+	"SSHD=$(command -v sshd || echo /usr/sbin/sshd)\n" +
+	"if [ \"$(\"$SSHD\" -T 2>/dev/null | grep -ciE '^(passwordauthentication no|pubkeyauthentication yes)$')\" = 2 ]; then\n" +
+	"  echo '" + sshdAlreadyHardenedMarker + "'\n" +
+	"  exit 0\n" +
+	"fi\n" +
+	"CANDIDATE=$(mktemp)\n" +
+	"trap 'rm -f \"$CANDIDATE\"' EXIT\n" +
+	"{\n" +
+	"  printf '%s\\n' '# Managed by ssh-key-bootstrap' 'PasswordAuthentication no' 'PubkeyAuthentication yes'\n" +
+	"  awk '" + sshdGlobalAuthFilter + "' \"$CONFIG\"\n" +
+	"} > \"$CANDIDATE\"\n" +
+	"\"$SSHD\" -t -f \"$CANDIDATE\"\n" +
+	"cp -p \"$CONFIG\" \"$CONFIG.ssh-key-bootstrap.bak\"\n" +
+	"cat \"$CANDIDATE\" > \"$CONFIG\"\n" +
+	"systemctl reload sshd 2>/dev/null || systemctl reload ssh 2>/dev/null || service sshd reload 2>/dev/null || service ssh reload\n" +
+	"echo '" + sshdHardenedMarker + "'\n"
+
+type hardenSSHDOperation struct{}
+
+var verifyKeyLoginForHardening = verifyPublicKeyLogin
+
+func init() {
+	registerRemoteOperation(hardenSSHDOperation{})
+}
+
+func (hardenSSHDOperation) Name() string {
+	return "harden-sshd"
+}
+
+func (hardenSSHDOperation) Title() string {
+	return "Harden sshd (key-only login)"
+}
+
+func (hardenSSHDOperation) Preflight(hostAddress string, input remoteOperationInput, clientConfig *ssh.ClientConfig) error {
+	if err := verifyKeyLoginForHardening(hostAddress, input, clientConfig); err != nil {
+		return fmt.Errorf("refusing to disable password login: %w", err)
+	}
+	return nil
+}
+
+func (hardenSSHDOperation) OpenSSHPreflight(executor *opensshExecutor, hostAddress string, input remoteOperationInput) error {
+	if err := executor.verifyKeyLogin(hostAddress, input); err != nil {
+		return fmt.Errorf("refusing to disable password login: %w", err)
+	}
+	return nil
+}
+
+func (hardenSSHDOperation) Script(remoteOperationInput) (remoteScript, error) {
+	return remoteScript{
+		Command:     hardenSSHDScript,
+		Description: "sshd_config hardening",
+		Sudo:        true,
+	}, nil
+}
+
+func (hardenSSHDOperation) ParseResult(output string) (remoteOperationResult, error) {
+	switch {
+	case strings.Contains(output, sshdAlreadyHardenedMarker):
+		return remoteOperationResult{Changed: false, Message: sshdAlreadyHardenedMarker}, nil
+	case strings.Contains(output, sshdHardenedMarker):
+		return remoteOperationResult{Changed: true}, nil
+	default:
+		return remoteOperationResult{}, errors.New("sshd hardening script did not report completion")
+	}
+}
+
+// verifyPublicKeyLogin opens a second connection that may only authenticate
+// with the private half of the installed key, proving key login works before
+// password login is turned off.
+func verifyPublicKeyLogin(hostAddress string, input remoteOperationInput, clientConfig *ssh.ClientConfig) error {
+	signer, err := findSignerForPublicKey(input.PublicKey, input.IdentityFile)
+	if err != nil {
+		return err
+	}
+
+	keyOnlyConfig := *clientConfig
+	keyOnlyConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	client, err := dialSSH("tcp", hostAddress, &keyOnlyConfig)
+	if err != nil {
+		return fmt.Errorf("login with installed key failed: %w", err)
+	}
+	return client.Close()
+}
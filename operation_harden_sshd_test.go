@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writeTestIdentity(t *testing.T) (string, string) {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pemBlock, err := ssh.MarshalPrivateKey(privateKey, "test")
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	identityPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(identityPath, pem.EncodeToMemory(pemBlock), 0o600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+	return identityPath, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+func stubAgentSigners(t *testing.T, signersStub func() ([]ssh.Signer, error)) {
+	t.Helper()
+
+	originalAgentSigners := agentSigners
+	agentSigners = signersStub
+	t.Cleanup(func() { agentSigners = originalAgentSigners })
+}
+
+func TestHardenSSHDParseResult(t *testing.T) {
+	operation := hardenSSHDOperation{}
+
+	result, err := operation.ParseResult(sshdHardenedMarker + "\n")
+	if err != nil || !result.Changed {
+		t.Fatalf("ParseResult(hardened) = %+v, %v; want changed", result, err)
+	}
+	result, err = operation.ParseResult(sshdAlreadyHardenedMarker + "\n")
+	if err != nil || result.Changed {
+		t.Fatalf("ParseResult(already hardened) = %+v, %v; want unchanged", result, err)
+	}
+	if _, err := operation.ParseResult("unexpected"); err == nil {
+		t.Fatalf("expected error for output without completion marker")
+	}
+}
+
+func TestHardenSSHDScriptRunsWithSudo(t *testing.T) {
+	script, err := (hardenSSHDOperation{}).Script(remoteOperationInput{})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	if !script.Sudo {
+		t.Fatalf("expected hardening script to require sudo")
+	}
+	if !strings.Contains(script.Command, "PasswordAuthentication no") || !strings.Contains(script.Command, "-t -f") {
+		t.Fatalf("hardening script missing directive or validation: %q", script.Command)
+	}
+}
+
+func TestHardenSSHDFilterKeepsMatchBlocks(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "sshd_config")
+	config := "# Managed by ssh-key-bootstrap\n" +
+		"PasswordAuthentication yes\n" +
+		"  pubkeyauthentication no\n" +
+		"X11Forwarding no\n" +
+		"Match User backup\n" +
+		"    PasswordAuthentication yes\n" +
+		"match Address 10.0.0.0/8\n" +
+		"    PubkeyAuthentication no\n"
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("write sshd_config: %v", err)
+	}
+	output, err := exec.Command("awk", sshdGlobalAuthFilter, configPath).CombinedOutput() // #nosec G204 -- test runs the built-in awk program
+	if err != nil {
+		t.Fatalf("awk error = %v: %s", err, output)
+	}
+	want := "X11Forwarding no\n" +
+		"Match User backup\n" +
+		"    PasswordAuthentication yes\n" +
+		"match Address 10.0.0.0/8\n" +
+		"    PubkeyAuthentication no\n"
+	if string(output) != want {
+		t.Fatalf("filtered sshd_config = %q, want %q", output, want)
+	}
+}
+
+func TestHardenSSHDPreflightRefusesWhenKeyLoginFails(t *testing.T) {
+	originalVerify := verifyKeyLoginForHardening
+	verifyKeyLoginForHardening = func(string, remoteOperationInput, *ssh.ClientConfig) error {
+		return errors.New("login with installed key failed")
+	}
+	t.Cleanup(func() { verifyKeyLoginForHardening = originalVerify })
+
+	err := (hardenSSHDOperation{}).Preflight("host:22", remoteOperationInput{}, &ssh.ClientConfig{})
+	if err == nil {
+		t.Fatalf("expected preflight error")
+	}
+	if !strings.Contains(err.Error(), "refusing to disable password login") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFindSignerForPublicKeyFromIdentityFile(t *testing.T) {
+	identityPath, publicKey := writeTestIdentity(t)
+	stubAgentSigners(t, func() ([]ssh.Signer, error) { return nil, errors.New("no agent") })
+
+	signer, err := findSignerForPublicKey(publicKey, identityPath)
+	if err != nil {
+		t.Fatalf("findSignerForPublicKey() error = %v", err)
+	}
+	if got := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))); got != publicKey {
+		t.Fatalf("signer public key = %q, want %q", got, publicKey)
+	}
+}
+
+func TestFindSignerForPublicKeyNoMatch(t *testing.T) {
+	identityPath, _ := writeTestIdentity(t)
+	_, otherPublicKey := writeTestIdentity(t)
+	stubAgentSigners(t, func() ([]ssh.Signer, error) { return nil, nil })
+
+	_, err := findSignerForPublicKey(otherPublicKey, identityPath)
+	if err == nil {
+		t.Fatalf("expected no matching signer error")
+	}
+	if !strings.Contains(err.Error(), "does not match the public key") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDefaultIdentityFile(t *testing.T) {
+	if got := defaultIdentityFile("~/.ssh/id_ed25519.pub"); got != "~/.ssh/id_ed25519" {
+		t.Fatalf("defaultIdentityFile() = %q, want %q", got, "~/.ssh/id_ed25519")
+	}
+	if got := defaultIdentityFile("ssh-ed25519 AAAA comment.pub"); got != "" {
+		t.Fatalf("defaultIdentityFile() for inline key = %q, want empty", got)
+	}
+}
+
+func TestRunRemoteOperationSudoSendsPasswordFirst(t *testing.T) {
+	clientConfig := &ssh.ClientConfig{
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("password")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         2 * time.Second,
+	}
+
+	var capturedCommand, capturedStdin string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
+			capturedCommand = command
+			capturedStdin = stdin
+			return sshdHardenedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	input := remoteOperationInput{Host: "in-memory:22", Password: "sudo-secret"}
+	result, err := runRemoteOperationWithStatus("in-memory:22", hardenSSHDOperation{}, input, clientConfig, nil)
+	if err != nil {
+		t.Fatalf("runRemoteOperationWithStatus() error = %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected changed result")
+	}
+	if !strings.Contains(capturedCommand, "sudo -S -p ''") {
+		t.Fatalf("command not wrapped with sudo: %q", capturedCommand)
+	}
+	if capturedStdin != "sudo-secret\n" {
+		t.Fatalf("stdin first line = %q, want sudo password", capturedStdin)
+	}
+}
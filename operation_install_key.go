@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	authorizedKeyPresentMarker        = "authorized key already present"
+	authorizedKeyCommentUpdatedMarker = "authorized key comment updated"
+	authorizedKeyAddedMarker          = "authorized key added"
+)
+
+var addAuthorizedKeyTemplate = parseRemoteScriptTemplate("install-key script", addAuthorizedKeyScriptTemplate)
+
+type installKeyOperation struct{}
+
+func init() {
+	registerRemoteOperation(installKeyOperation{})
+}
+
+func (installKeyOperation) Name() string {
+	return "install-key"
+}
+
+func (installKeyOperation) Title() string {
+	return "Add authorized key"
+}
+
+func (installKeyOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	if strings.TrimSpace(input.PublicKey) == "" {
+		return remoteScript{}, errors.New("public key is required")
+	}
+	publicKeys := append([]string{input.PublicKey}, input.ExtraPublicKeys...)
+	var stdin strings.Builder
+	for _, publicKey := range publicKeys {
+		stdin.WriteString(publicKey + "\n")
+		switch {
+		case input.ReplaceKeyComment:
+			parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+			if err != nil {
+				return remoteScript{}, fmt.Errorf("invalid public key format: %w", err)
+			}
+			stdin.WriteString(publicKeyBlob(parsedKey) + "\n")
+		case len(publicKeys) > 1:
+			// Keep the key/blob pairs aligned for the next key.
+			stdin.WriteString("\n")
+		}
+	}
+	command, err := renderRemoteScript(addAuthorizedKeyTemplate, remoteScriptDataFor(input, map[string]string{
+		"present": authorizedKeyPresentMarker,
+		"updated": authorizedKeyCommentUpdatedMarker,
+		"added":   authorizedKeyAddedMarker,
+	}))
+	if err != nil {
+		return remoteScript{}, err
+	}
+	return remoteScript{
+		Command:     command,
+		Stdin:       stdin.String(),
+		Description: "authorized_keys update",
+		UsesHome:    true,
+	}, nil
+}
+
+func (installKeyOperation) ParseResult(output string) (remoteOperationResult, error) {
+	present := strings.Count(output, authorizedKeyPresentMarker)
+	updated := strings.Count(output, authorizedKeyCommentUpdatedMarker)
+	added := strings.Count(output, authorizedKeyAddedMarker)
+	if present+updated+added > 1 {
+		return remoteOperationResult{
+			Changed: added+updated > 0,
+			Message: describeKeyCounts([]keyCount{{added, "added"}, {updated, "comment updated"}, {present, "already present"}}),
+		}, nil
+	}
+	if present > 0 {
+		return remoteOperationResult{Changed: false, Message: authorizedKeyPresentMarker}, nil
+	}
+	if updated > 0 {
+		return remoteOperationResult{Changed: true, Message: authorizedKeyCommentUpdatedMarker}, nil
+	}
+	return remoteOperationResult{Changed: true}, nil
+}
+
+func (installKeyOperation) ScriptRan(output string) bool {
+	return strings.Contains(output, authorizedKeyPresentMarker) ||
+		strings.Contains(output, authorizedKeyCommentUpdatedMarker) ||
+		strings.Contains(output, authorizedKeyAddedMarker)
+}
+
+// RunSFTP does what the install-key script does, through SFTP. The
+// authorized_keys file is the one under the directory the SFTP session
+// starts in, which for a chrooted account is its home inside the chroot.
+func (operation installKeyOperation) RunSFTP(client *sftpClient, input remoteOperationInput) (remoteOperationResult, error) {
+	if strings.TrimSpace(input.PublicKey) == "" {
+		return remoteOperationResult{}, errors.New("public key is required")
+	}
+	home, err := client.realPath(".")
+	if err != nil {
+		return remoteOperationResult{}, err
+	}
+	sshDir := path.Join(home, ".ssh")
+	keysPath := path.Join(sshDir, "authorized_keys")
+	if _, err := client.stat(sshDir); errors.Is(err, fs.ErrNotExist) {
+		if err := client.mkdir(sshDir, 0o700); err != nil {
+			return remoteOperationResult{}, fmt.Errorf("create %s: %w", sshDir, err)
+		}
+	} else if err != nil {
+		return remoteOperationResult{}, err
+	}
+	if err := client.chmod(sshDir, 0o700); err != nil {
+		return remoteOperationResult{}, fmt.Errorf("chmod %s: %w", sshDir, err)
+	}
+	content, err := client.readFile(keysPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return remoteOperationResult{}, err
+	}
+	fileExists := err == nil
+
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+	var output strings.Builder
+	changed := false
+	for _, publicKey := range append([]string{input.PublicKey}, input.ExtraPublicKeys...) {
+		replaceBlob := ""
+		if input.ReplaceKeyComment {
+			parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+			if err != nil {
+				return remoteOperationResult{}, fmt.Errorf("invalid public key format: %w", err)
+			}
+			replaceBlob = " " + publicKeyBlob(parsedKey)
+		}
+		switch {
+		case slices.Contains(lines, publicKey):
+			output.WriteString(authorizedKeyPresentMarker + "\n")
+		case replaceBlob != "" && slices.ContainsFunc(lines, func(line string) bool { return strings.Contains(line, replaceBlob) }):
+			lines = slices.DeleteFunc(lines, func(line string) bool { return strings.Contains(line, replaceBlob) })
+			lines = append(lines, publicKey)
+			output.WriteString(authorizedKeyCommentUpdatedMarker + "\n")
+			changed = true
+		default:
+			lines = append(lines, publicKey)
+			output.WriteString(authorizedKeyAddedMarker + "\n")
+			changed = true
+		}
+	}
+
+	if changed || !fileExists {
+		updated := ""
+		if len(lines) > 0 {
+			updated = strings.Join(lines, "\n") + "\n"
+		}
+		if err := client.writeFile(keysPath, []byte(updated), 0o600); err != nil {
+			return remoteOperationResult{}, fmt.Errorf("write %s: %w", keysPath, err)
+		}
+	}
+	if err := client.chmod(keysPath, 0o600); err != nil {
+		return remoteOperationResult{}, fmt.Errorf("chmod %s: %w", keysPath, err)
+	}
+	return operation.ParseResult(output.String())
+}
+
+type keyCount struct {
+	count int
+	label string
+}
+
+// describeKeyCounts summarizes a multi-key result, e.g. "1 key(s) added,
+// 1 key(s) already present".
+func describeKeyCounts(counts []keyCount) string {
+	var parts []string
+	for _, entry := range counts {
+		if entry.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d key(s) %s", entry.count, entry.label))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
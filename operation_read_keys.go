@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const authorizedKeysListingMarker = "authorized_keys listing"
+
+// readAuthorizedKeysScript prints the marker followed by the current
+// authorized_keys content (nothing when the file does not exist).
+const readAuthorizedKeysScript = "set -eu\n" +
+	"echo '" + authorizedKeysListingMarker + "'\n" +
+	"if [ -f ~/.ssh/authorized_keys ]; then cat ~/.ssh/authorized_keys; fi\n"
+
+// readAuthorizedKeysOperation collects authorized_keys without changing it;
+// the listing is returned in the result's Output. It is driven by `drift`.
+type readAuthorizedKeysOperation struct{}
+
+func (readAuthorizedKeysOperation) Name() string {
+	return "read-keys"
+}
+
+func (readAuthorizedKeysOperation) Title() string {
+	return "Read authorized keys"
+}
+
+func (readAuthorizedKeysOperation) Script(remoteOperationInput) (remoteScript, error) {
+	return remoteScript{
+		Command:     readAuthorizedKeysScript,
+		Description: "authorized_keys read",
+		UsesHome:    true,
+	}, nil
+}
+
+func (readAuthorizedKeysOperation) ParseResult(output string) (remoteOperationResult, error) {
+	markerIndex := strings.Index(output, authorizedKeysListingMarker)
+	if markerIndex < 0 {
+		return remoteOperationResult{}, errors.New("authorized_keys listing did not report completion")
+	}
+	return remoteOperationResult{Output: output[markerIndex+len(authorizedKeysListingMarker):]}, nil
+}
+
+// authorizedKeyFingerprints returns the sorted SHA256 fingerprints of every
+// parseable key line; comments, blank and malformed lines are skipped.
+func authorizedKeyFingerprints(authorizedKeys string) []string {
+	seenFingerprints := map[string]bool{}
+	for _, line := range strings.Split(normalizeLF(authorizedKeys), "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
+			continue
+		}
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(trimmedLine))
+		if err != nil {
+			continue
+		}
+		seenFingerprints[ssh.FingerprintSHA256(parsedKey)] = true
+	}
+
+	fingerprints := make([]string, 0, len(seenFingerprints))
+	for fingerprint := range seenFingerprints {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Strings(fingerprints)
+	return fingerprints
+}
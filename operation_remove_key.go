@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	authorizedKeyRemovedMarker    = "authorized key removed"
+	authorizedKeyNotPresentMarker = "authorized key not present"
+)
+
+// removeAuthorizedKeyScript deletes every authorized_keys line carrying one
+// of the key blobs read from stdin (one per line), regardless of options or
+// comment.
+const removeAuthorizedKeyScript = "set -eu\n" +
+	"while IFS= read -r BLOB; do\n" +
+	"  if [ -f ~/.ssh/authorized_keys ] && grep -qF \" $BLOB\" ~/.ssh/authorized_keys; then\n" +
+	"    UPDATED=$(mktemp ~/.ssh/authorized_keys.XXXXXX)\n" +
+	"    grep -vF \" $BLOB\" ~/.ssh/authorized_keys > \"$UPDATED\" || true\n" +
+	"    cat \"$UPDATED\" > ~/.ssh/authorized_keys\n" +
+	"    rm -f \"$UPDATED\"\n" +
+	"    echo '" + authorizedKeyRemovedMarker + "'\n" +
+	"  else\n" +
+	"    echo '" + authorizedKeyNotPresentMarker + "'\n" +
+	"  fi\n" +
+	"done\n"
+
+type removeKeyOperation struct{}
+
+func init() {
+	registerRemoteOperation(removeKeyOperation{})
+}
+
+func (removeKeyOperation) Name() string {
+	return "remove-key"
+}
+
+func (removeKeyOperation) Title() string {
+	return "Remove authorized key"
+}
+
+func (removeKeyOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	if strings.TrimSpace(input.PublicKey) == "" {
+		return remoteScript{}, errors.New("public key is required")
+	}
+	var stdin strings.Builder
+	for _, publicKey := range append([]string{input.PublicKey}, input.ExtraPublicKeys...) {
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+		if err != nil {
+			return remoteScript{}, fmt.Errorf("invalid public key format: %w", err)
+		}
+		stdin.WriteString(publicKeyBlob(parsedKey) + "\n")
+	}
+	return remoteScript{
+		Command:     removeAuthorizedKeyScript,
+		Stdin:       stdin.String(),
+		Description: "authorized_keys removal",
+		UsesHome:    true,
+	}, nil
+}
+
+func (removeKeyOperation) ParseResult(output string) (remoteOperationResult, error) {
+	removed := strings.Count(output, authorizedKeyRemovedMarker)
+	notPresent := strings.Count(output, authorizedKeyNotPresentMarker)
+	switch {
+	case removed+notPresent > 1:
+		return remoteOperationResult{
+			Changed: removed > 0,
+			Message: describeKeyCounts([]keyCount{{removed, "removed"}, {notPresent, "not present"}}),
+		}, nil
+	case removed > 0:
+		return remoteOperationResult{Changed: true}, nil
+	case notPresent > 0:
+		return remoteOperationResult{Changed: false, Message: authorizedKeyNotPresentMarker}, nil
+	default:
+		return remoteOperationResult{}, errors.New("key removal script did not report completion")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const runCommandOperationName = "run-command"
+
+// remoteCommandFor returns --cmd when the run-command operation is selected.
+func remoteCommandFor(programOptions *options, operations []remoteOperation) (string, error) {
+	command := strings.TrimSpace(programOptions.RemoteCommand)
+	if !containsRemoteOperation(operations, runCommandOperationName) {
+		if command != "" {
+			return "", fmt.Errorf("--cmd needs the %s operation (use the exec subcommand or add it to OPERATIONS)", runCommandOperationName)
+		}
+		return "", nil
+	}
+	if command == "" {
+		return "", fmt.Errorf("%s needs --cmd", runCommandOperationName)
+	}
+	return command, nil
+}
+
+// runCommandOperation runs an ad-hoc command as the login user and shows
+// its output. A non-zero exit status fails the host.
+type runCommandOperation struct{}
+
+func init() {
+	registerRemoteOperation(runCommandOperation{})
+}
+
+func (runCommandOperation) Name() string {
+	return runCommandOperationName
+}
+
+func (runCommandOperation) Title() string {
+	return "Run command"
+}
+
+// WithoutPublicKey marks run-command as not using the key.
+func (runCommandOperation) WithoutPublicKey() {}
+
+func (runCommandOperation) Script(input remoteOperationInput) (remoteScript, error) {
+	if strings.TrimSpace(input.Command) == "" {
+		return remoteScript{}, errors.New("command is required")
+	}
+	return remoteScript{
+		Command:     input.Command,
+		Description: "command",
+	}, nil
+}
+
+// ParseResult reports the output as the host's message, continuation lines
+// indented under the status line. A command is never reported as a change,
+// since nothing tells whether it changed the host.
+func (runCommandOperation) ParseResult(output string) (remoteOperationResult, error) {
+	lines := strings.Split(strings.TrimSpace(normalizeLF(output)), "\n")
+	return remoteOperationResult{
+		Message: strings.Join(lines, "\n    "),
+		Output:  output,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunCommandParseResultIndentsOutput(t *testing.T) {
+	result, err := runCommandOperation{}.ParseResult(" 10:00:01 up 3 days\r\nload average: 0.01\n")
+	if err != nil || result.Changed {
+		t.Fatalf("ParseResult() = %+v, %v", result, err)
+	}
+	if want := "10:00:01 up 3 days\n    load average: 0.01"; result.Message != want {
+		t.Fatalf("message = %q, want %q", result.Message, want)
+	}
+}
+
+func TestRunExecCommandRunsCommandOnEveryHost(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(dotEnvPath, []byte("SERVERS=app01,app02\nUSER=deploy\nPASSWORD=password\nINSECURE_IGNORE_HOST_KEY=true\n"), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	var commands []string
+	stubSSHDialHook(t, func(_, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, _ string) (string, string, uint32) {
+			commands = append(commands, command)
+			if address == "app02:22" {
+				return "", "uptime: not found\n", 127
+			}
+			return "up 3 days\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "exec", "--env", dotEnvPath, "--cmd", "uptime"})
+	err := run(capturedRuntimeIO())
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.code != exitPartialFailure {
+		t.Fatalf("run(exec) error = %v, want partial failure status", err)
+	}
+	if len(commands) != 2 || commands[0] != "uptime" || commands[1] != "uptime" {
+		t.Fatalf("commands = %q", commands)
+	}
+	output := outputBuffer.String()
+	for _, want := range []string{"TASK [Run command]", "ok: [app01:22] => up 3 days", "failed: [app02:22]", "uptime: not found"} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunRejectsCmdWithoutRunCommandOperation(t *testing.T) {
+	captureWriters(t)
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--cmd", "uptime"})
+	var statusErr *statusError
+	if err := run(capturedRuntimeIO()); !errors.As(err, &statusErr) || statusErr.code != 2 {
+		t.Fatalf("run() error = %v, want config status", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"ssh-key-bootstrap/messages"
+)
+
+const (
+	planFormatText           = "text"
+	planFormatJSON           = "json"
+	defaultConfirmHostsAbove = 20
+)
+
+// runPlan is what a bootstrap run is about to do, shown before any host is
+// contacted so a wrong host list or key is caught before it is pushed.
+type runPlan struct {
+	RunID      string         `json:"runId"`
+	Operations []string       `json:"operations"`
+	Hosts      []hostPlanItem `json:"hosts"`
+}
+
+type hostPlanItem struct {
+	Host           string   `json:"host"`
+	User           string   `json:"user"`
+	Auth           []string `json:"auth"`
+	KeyFingerprint string   `json:"keyFingerprint"`
+	// ExtraKeyFingerprints lists keys installed alongside the main one.
+	ExtraKeyFingerprints []string `json:"extraKeyFingerprints,omitempty"`
+}
+
+func buildRunPlan(programOptions *options, runID string, hosts []string, operations []remoteOperation, settings map[string]hostSettings) runPlan {
+	plan := runPlan{RunID: runID}
+	for _, operation := range operations {
+		plan.Operations = append(plan.Operations, operation.Name())
+	}
+
+	authMethods := authMethodOrder(programOptions)
+	if programOptions.UseOpenSSH {
+		authMethods = []string{"openssh"}
+	}
+	for _, host := range hosts {
+		hostSetting := settings[host]
+		fingerprint := ""
+		if parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostSetting.PublicKey)); err == nil {
+			fingerprint = ssh.FingerprintSHA256(parsedKey)
+		}
+		var extraFingerprints []string
+		for _, publicKey := range hostSetting.ExtraPublicKeys {
+			if parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey)); err == nil {
+				extraFingerprints = append(extraFingerprints, ssh.FingerprintSHA256(parsedKey))
+			}
+		}
+		plan.Hosts = append(plan.Hosts, hostPlanItem{
+			Host:                 host,
+			User:                 hostSetting.User,
+			Auth:                 authMethods,
+			KeyFingerprint:       fingerprint,
+			ExtraKeyFingerprints: extraFingerprints,
+		})
+	}
+	return plan
+}
+
+func validatePlanFormat(format string) error {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", planFormatText, planFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported plan format %q (valid: %s, %s)", format, planFormatText, planFormatJSON)
+	}
+}
+
+// printRunPlan shows the plan as an Ansible-style task, one line per host.
+func printRunPlan(plan runPlan) {
+	outputAnsibleTask("Review plan")
+	for _, item := range plan.Hosts {
+		keys := strings.Join(append([]string{item.KeyFingerprint}, item.ExtraKeyFingerprints...), ",")
+		outputAnsibleHostStatus("ok", item.Host, fmt.Sprintf("user %s, auth %s, key %s, operations %s",
+			item.User, strings.Join(item.Auth, ","), keys, strings.Join(plan.Operations, ",")))
+	}
+}
+
+func writeRunPlanJSON(output io.Writer, plan runPlan) error {
+	planBytes, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode plan: %w", err)
+	}
+	if _, err := output.Write(append(planBytes, '\n')); err != nil {
+		return fmt.Errorf("write plan: %w", err)
+	}
+	return nil
+}
+
+// confirmRunPlan guards runs on more than confirmAbove hosts (--confirm-over):
+// the operator has to type the host count, so a reflexive "yes" cannot push a
+// key to a whole fleet from a stale servers file. --yes skips the question;
+// without a terminal to ask on, the run is refused.
+func confirmRunPlan(inputReader *bufio.Reader, hostCount, confirmAbove int, assumeYes bool) error {
+	if assumeYes || confirmAbove <= 0 || hostCount <= confirmAbove {
+		return nil
+	}
+	if !currentPrompter().Interactive(standardInputFile()) {
+		return fmt.Errorf("refusing to run on %d hosts (more than %d) without --yes", hostCount, confirmAbove)
+	}
+
+	outputPrintf("This run targets %d hosts, more than --confirm-over %d.\n", hostCount, confirmAbove)
+	answer, err := promptLine(inputReader, messages.Get(messages.PromptConfirmHostCount))
+	if err != nil {
+		return wrapMissingInputError("plan confirmation", err)
+	}
+	if answer != strconv.Itoa(hostCount) {
+		return errors.New("run cancelled at plan review: host count not confirmed")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunPlanJSONPrintsPlanWithoutConnecting(t *testing.T) {
+	outputBuffer, errorBuffer := captureWriters(t)
+	stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("--plan must not connect to any host")
+		return nil, nil
+	})
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "SERVERS=app01,app02:2222,app01\nUSER=deploy\nPASSWORD=password\nKEY='" + publicKey + "'\nOPERATIONS=install-key,harden-sshd\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--plan", "json"})
+	if err := run(capturedRuntimeIO()); err != nil {
+		t.Fatalf("run(--plan json) error = %v", err)
+	}
+
+	var plan runPlan
+	if err := json.Unmarshal(outputBuffer.Bytes(), &plan); err != nil {
+		t.Fatalf("stdout is not a JSON plan: %v\n%s", err, outputBuffer.String())
+	}
+	if len(plan.Hosts) != 2 || plan.Hosts[0].Host != "app01:22" || plan.Hosts[1].Host != "app02:2222" {
+		t.Fatalf("plan hosts = %+v, want deduplicated app01:22 and app02:2222", plan.Hosts)
+	}
+	wantFingerprint := ssh.FingerprintSHA256(parsePublicKeyFromAuthorizedLine(t, publicKey))
+	if plan.Hosts[0].User != "deploy" || plan.Hosts[0].KeyFingerprint != wantFingerprint || strings.Join(plan.Hosts[0].Auth, ",") != "password" {
+		t.Fatalf("plan host = %+v", plan.Hosts[0])
+	}
+	if strings.Join(plan.Operations, ",") != "install-key,harden-sshd" {
+		t.Fatalf("plan operations = %v", plan.Operations)
+	}
+	if !strings.Contains(errorBuffer.String(), "TASK [Resolve target hosts]") {
+		t.Fatalf("progress output was not moved to stderr: %q", errorBuffer.String())
+	}
+}
+
+func TestConfirmRunPlan(t *testing.T) {
+	_, _ = captureWriters(t)
+
+	stubPrompter(t, &scriptedPrompter{})
+	if err := confirmRunPlan(nil, 5, 20, false); err != nil {
+		t.Fatalf("small run should not ask: %v", err)
+	}
+	if err := confirmRunPlan(nil, 25, 20, true); err != nil {
+		t.Fatalf("--yes should skip confirmation: %v", err)
+	}
+	if err := confirmRunPlan(nil, 25, 20, false); err == nil || !strings.Contains(err.Error(), "without --yes") {
+		t.Fatalf("non-interactive large run error = %v, want refusal", err)
+	}
+
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"25"}})
+	if err := confirmRunPlan(bufio.NewReader(strings.NewReader("")), 25, 20, false); err != nil {
+		t.Fatalf("confirmRunPlan(25) error = %v", err)
+	}
+	for _, answers := range [][]string{{"yes"}, {"24"}, nil} {
+		stubPrompter(t, &scriptedPrompter{interactive: true, answers: answers})
+		if err := confirmRunPlan(bufio.NewReader(strings.NewReader("")), 25, 20, false); err == nil {
+			t.Fatalf("confirmRunPlan(%q) error = nil, want cancellation", answers)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"sync"
+)
+
+// promptQueueMu lets one prompt at a time own the terminal. A prompt holds it
+// from its first line of context to the answer, so a trust prompt from one
+// connection never interleaves with another host's prompt or a password
+// prompt; the others wait their turn.
+var promptQueueMu sync.Mutex
+
+// lockPrompt queues the caller behind any prompt already on screen and
+// returns the function that hands the terminal to the next one.
+func lockPrompt() func() {
+	promptQueueMu.Lock()
+	return promptQueueMu.Unlock
+}
+
+type promptResult struct {
+	answer string
+	err    error
+}
+
+var (
+	trustPromptReaderMu sync.Mutex
+	// trustPromptInput is the single buffered reader trust prompts share,
+	// so input buffered for one prompt is not lost to the next.
+	trustPromptInput *bufio.Reader
+
+	pendingPromptMu sync.Mutex
+	// pendingPromptLine is a read that is still waiting for input after its
+	// prompt timed out. The next prompt takes it over instead of starting a
+	// second reader, which would race it for the operator's answer.
+	pendingPromptLine chan promptResult
+	// pendingPromptTaken, when set by offerPromptLine, is closed once a
+	// prompt takes pendingPromptLine over.
+	pendingPromptTaken chan struct{}
+)
+
+// trustPromptReader returns the trust prompts' reader over the run's stdin.
+func trustPromptReader() *bufio.Reader {
+	trustPromptReaderMu.Lock()
+	defer trustPromptReaderMu.Unlock()
+
+	if trustPromptInput == nil {
+		trustPromptInput = newStandardInputReader()
+	}
+	return trustPromptInput
+}
+
+// resetTrustPromptReader drops the reader when the run's stdin changes,
+// along with a read still pending on the old stdin.
+func resetTrustPromptReader() {
+	trustPromptReaderMu.Lock()
+	trustPromptInput = nil
+	trustPromptReaderMu.Unlock()
+
+	setPendingPromptLine(nil)
+}
+
+func takePendingPromptLine() chan promptResult {
+	pendingPromptMu.Lock()
+	defer pendingPromptMu.Unlock()
+
+	resultChannel := pendingPromptLine
+	if resultChannel != nil && pendingPromptTaken != nil {
+		close(pendingPromptTaken)
+	}
+	pendingPromptLine, pendingPromptTaken = nil, nil
+	return resultChannel
+}
+
+func setPendingPromptLine(resultChannel chan promptResult) {
+	pendingPromptMu.Lock()
+	defer pendingPromptMu.Unlock()
+
+	pendingPromptLine, pendingPromptTaken = resultChannel, nil
+}
+
+// offerPromptLine makes resultChannel the pending prompt line and returns a
+// channel that is closed once a prompt takes it over.
+func offerPromptLine(resultChannel chan promptResult) <-chan struct{} {
+	pendingPromptMu.Lock()
+	defer pendingPromptMu.Unlock()
+
+	taken := make(chan struct{})
+	pendingPromptLine, pendingPromptTaken = resultChannel, taken
+	return taken
+}
+
+// claimPendingPromptLine clears resultChannel as the pending prompt line and
+// reports whether it still was; false means a prompt took it over.
+func claimPendingPromptLine(resultChannel chan promptResult) bool {
+	pendingPromptMu.Lock()
+	defer pendingPromptMu.Unlock()
+
+	if pendingPromptLine != resultChannel {
+		return false
+	}
+	pendingPromptLine, pendingPromptTaken = nil, nil
+	return true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTrustPromptTimeoutHandsPendingReadToNextPrompt(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	t.Cleanup(func() { setPendingPromptLine(nil) })
+
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+	reader := bufio.NewReader(pipeReader)
+
+	_, timedOut, err := terminalPrompter{}.LineWithTimeout(reader, "first? ", 10*time.Millisecond)
+	if err != nil || !timedOut {
+		t.Fatalf("first prompt = timedOut %v, err %v; want timeout", timedOut, err)
+	}
+
+	go func() { _, _ = pipeWriter.Write([]byte("no\n")) }()
+	answer, timedOut, err := terminalPrompter{}.LineWithTimeout(reader, "second? ", time.Second)
+	if err != nil || timedOut || answer != "no" {
+		t.Fatalf("second prompt = %q, timedOut %v, err %v; want the answer typed after the timeout", answer, timedOut, err)
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "second? ") {
+		t.Fatalf("second prompt label not shown: %q", output)
+	}
+}
+
+// slowTrustPrompter answers every trust prompt with "yes" after a pause and
+// counts prompts that were on screen at the same time.
+type slowTrustPrompter struct {
+	*scriptedPrompter
+	active, overlaps *atomic.Int32
+}
+
+func (slow slowTrustPrompter) LineWithTimeout(*bufio.Reader, string, time.Duration) (string, bool, error) {
+	if slow.active.Add(1) > 1 {
+		slow.overlaps.Add(1)
+	}
+	time.Sleep(5 * time.Millisecond)
+	slow.active.Add(-1)
+	return "yes", false, nil
+}
+
+func TestTrustPromptsFromConcurrentConnectionsDoNotInterleave(t *testing.T) {
+	captureWriters(t)
+	var active, overlaps atomic.Int32
+	stubPrompter(t, slowTrustPrompter{scriptedPrompter: &scriptedPrompter{interactive: true}, active: &active, overlaps: &overlaps})
+
+	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	var waitGroup sync.WaitGroup
+	for _, host := range []string{"app01:22", "app02:22", "app03:22"} {
+		waitGroup.Go(func() {
+			if _, err := promptTrustUnknownHost(host, "/tmp/known_hosts", hostPublicKey); err != nil {
+				t.Errorf("promptTrustUnknownHost(%s) error = %v", host, err)
+			}
+		})
+	}
+	waitGroup.Wait()
+	if overlaps.Load() != 0 {
+		t.Fatalf("%d trust prompts were on screen at the same time", overlaps.Load())
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+)
+
+// configurePromptTimeout wraps the active prompter for --prompt-timeout.
+func configurePromptTimeout(timeout time.Duration) (func(), error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("prompt timeout must not be negative, got %s", timeout)
+	}
+	if timeout == 0 {
+		return func() {}, nil
+	}
+	return usePrompter(timeoutPrompter{prompter: currentPrompter(), timeout: timeout}), nil
+}
+
+// timeoutPrompter is --prompt-timeout: it fails a Secret read that gets no
+// answer in time and otherwise asks like the prompter it wraps. The abandoned
+// read keeps waiting on stdin, but the run ends with the error, so nothing
+// reads after it. A terminal the read left without echo is put back into its
+// previous mode first.
+type timeoutPrompter struct {
+	prompter
+	timeout time.Duration
+	// saveTerminal defaults to saveTerminalState.
+	saveTerminal func(*os.File) func()
+}
+
+func (wrapped timeoutPrompter) Secret(reader *bufio.Reader, file *os.File) (string, error) {
+	var restoreTerminal func()
+	if wrapped.Interactive(file) {
+		saveTerminal := wrapped.saveTerminal
+		if saveTerminal == nil {
+			saveTerminal = saveTerminalState
+		}
+		restoreTerminal = saveTerminal(file)
+	}
+
+	resultChannel := make(chan promptResult, 1)
+	go func() {
+		answer, err := wrapped.prompter.Secret(reader, file)
+		resultChannel <- promptResult{answer: answer, err: err}
+	}()
+
+	timer := time.NewTimer(wrapped.timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-resultChannel:
+		return result.answer, result.err
+	case <-timer.C:
+		if restoreTerminal != nil {
+			restoreTerminal()
+		}
+		outputPrintln()
+		return "", fmt.Errorf("no answer within %s (--prompt-timeout); set the password in the config or a secret ref for unattended runs", wrapped.timeout)
+	}
+}
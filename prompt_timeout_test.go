@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unansweredPrompter is a terminal nobody types on: Secret never returns.
+type unansweredPrompter struct {
+	*scriptedPrompter
+}
+
+func (unansweredPrompter) Secret(*bufio.Reader, *os.File) (string, error) {
+	select {}
+}
+
+func TestPromptPasswordTimesOutAndRestoresTerminal(t *testing.T) {
+	captureWriters(t)
+	restored := false
+	stubPrompter(t, timeoutPrompter{
+		prompter:     unansweredPrompter{&scriptedPrompter{interactive: true}},
+		timeout:      20 * time.Millisecond,
+		saveTerminal: func(*os.File) func() { return func() { restored = true } },
+	})
+
+	_, err := promptPassword(nil, os.Stdin, "SSH password: ")
+	if err == nil || !strings.Contains(err.Error(), "no answer within 20ms (--prompt-timeout)") {
+		t.Fatalf("promptPassword() error = %v", err)
+	}
+	if !restored {
+		t.Fatalf("terminal state was not restored after the timeout")
+	}
+}
+
+func TestConfigurePromptTimeoutWrapsActivePrompter(t *testing.T) {
+	captureWriters(t)
+	script := &scriptedPrompter{answers: []string{"", "secret"}}
+	stubPrompter(t, script)
+
+	restorePromptTimeout, err := configurePromptTimeout(time.Minute)
+	if err != nil {
+		t.Fatalf("configurePromptTimeout() error = %v", err)
+	}
+	if _, ok := currentPrompter().(timeoutPrompter); !ok {
+		t.Fatalf("active prompter = %T, want timeoutPrompter", currentPrompter())
+	}
+	password, err := promptPassword(bufio.NewReader(strings.NewReader("")), os.Stdin, "SSH password: ")
+	if err != nil || password != "secret" {
+		t.Fatalf("promptPassword() = %q, %v", password, err)
+	}
+	restorePromptTimeout()
+	if currentPrompter() != prompter(script) {
+		t.Fatalf("active prompter after restore = %T, want the scripted one", currentPrompter())
+	}
+
+	if _, err := configurePromptTimeout(-time.Second); err == nil {
+		t.Fatalf("configurePromptTimeout(-1s) error = nil")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prompter is how the program asks the operator. Password, host trust, plan
+// confirmation and plain line prompts all go through the active prompter, so
+// an interactive feature takes its terminal check and its input from one
+// place, and a test swaps one value instead of a hook per prompt.
+type prompter interface {
+	// Interactive reports whether someone can answer prompts on file.
+	Interactive(file *os.File) bool
+	// Line prints label and reads one trimmed line from reader.
+	Line(reader *bufio.Reader, label string) (string, error)
+	// LineWithTimeout is Line that gives up after timeout and reports
+	// timedOut instead of an answer.
+	LineWithTimeout(reader *bufio.Reader, label string, timeout time.Duration) (answer string, timedOut bool, err error)
+	// Secret reads one trimmed answer after the caller printed its label:
+	// without echo when file is a terminal, as a line from reader otherwise.
+	Secret(reader *bufio.Reader, file *os.File) (string, error)
+}
+
+var (
+	activePrompterMu sync.Mutex
+	activePrompter   prompter = terminalPrompter{}
+)
+
+func currentPrompter() prompter {
+	activePrompterMu.Lock()
+	defer activePrompterMu.Unlock()
+	return activePrompter
+}
+
+// usePrompter makes next the active prompter and returns the function that
+// puts the previous one back.
+func usePrompter(next prompter) func() {
+	activePrompterMu.Lock()
+	previous := activePrompter
+	activePrompter = next
+	activePrompterMu.Unlock()
+	return func() {
+		activePrompterMu.Lock()
+		activePrompter = previous
+		activePrompterMu.Unlock()
+	}
+}
+
+// terminalPrompter asks on the process's terminal; it is the default.
+type terminalPrompter struct{}
+
+func (terminalPrompter) Interactive(file *os.File) bool {
+	return isTerminal(file)
+}
+
+func (terminalPrompter) Line(reader *bufio.Reader, label string) (string, error) {
+	outputPrint(label)
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	trimmedLine := strings.TrimSpace(line)
+	if errors.Is(err, io.EOF) && trimmedLine == "" {
+		return "", io.EOF
+	}
+	return trimmedLine, nil
+}
+
+// LineWithTimeout keeps a read that outlives its prompt, and the next prompt
+// takes it over, so stdin only ever has one reader and an answer typed late
+// is not lost.
+func (terminal terminalPrompter) LineWithTimeout(reader *bufio.Reader, label string, timeout time.Duration) (string, bool, error) {
+	promptResultChannel := takePendingPromptLine()
+	if promptResultChannel != nil {
+		outputPrint(label)
+	} else {
+		promptResultChannel = make(chan promptResult, 1)
+		go func() {
+			answer, err := terminal.Line(reader, label)
+			promptResultChannel <- promptResult{answer: answer, err: err}
+		}()
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-promptResultChannel:
+		return result.answer, false, result.err
+	case <-timer.C:
+		setPendingPromptLine(promptResultChannel)
+		return "", true, nil
+	}
+}
+
+func (terminalPrompter) Secret(reader *bufio.Reader, file *os.File) (string, error) {
+	if isTerminal(file) {
+		passwordBytes, err := readPassword(file)
+		outputPrintln()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(passwordBytes)), nil
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	passwordInput := strings.TrimSpace(line)
+	if errors.Is(err, io.EOF) && passwordInput == "" {
+		return "", io.EOF
+	}
+	return passwordInput, nil
+}
+
+// scriptedPrompter answers every prompt from a fixed list, in order, and
+// records the line prompt labels it was shown. When the list runs out, Line and Secret
+// fail with err (io.EOF when nil) and LineWithTimeout times out, as if
+// nobody were typing.
+type scriptedPrompter struct {
+	interactive bool
+	err         error
+
+	mu      sync.Mutex
+	answers []string
+	labels  []string
+}
+
+func (script *scriptedPrompter) Interactive(*os.File) bool {
+	return script.interactive
+}
+
+func (script *scriptedPrompter) next(label string) (string, bool) {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+
+	if label != "" {
+		script.labels = append(script.labels, label)
+	}
+	if len(script.answers) == 0 {
+		return "", false
+	}
+	answer := script.answers[0]
+	script.answers = script.answers[1:]
+	return answer, true
+}
+
+func (script *scriptedPrompter) exhausted() error {
+	if script.err != nil {
+		return script.err
+	}
+	return io.EOF
+}
+
+func (script *scriptedPrompter) Line(_ *bufio.Reader, label string) (string, error) {
+	outputPrint(label)
+	answer, ok := script.next(label)
+	if !ok {
+		return "", script.exhausted()
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// LineWithTimeout takes over a pending read like the terminal prompter, so a
+// line the run keys listener read from the script still answers the prompt.
+func (script *scriptedPrompter) LineWithTimeout(_ *bufio.Reader, label string, _ time.Duration) (string, bool, error) {
+	outputPrint(label)
+	if pending := takePendingPromptLine(); pending != nil {
+		script.mu.Lock()
+		script.labels = append(script.labels, label)
+		script.mu.Unlock()
+		result := <-pending
+		if errors.Is(result.err, io.EOF) && script.err == nil {
+			return "", true, nil
+		}
+		return result.answer, false, result.err
+	}
+	answer, ok := script.next(label)
+	if !ok {
+		if script.err != nil {
+			return "", false, script.err
+		}
+		return "", true, nil
+	}
+	return strings.TrimSpace(answer), false, nil
+}
+
+func (script *scriptedPrompter) Secret(*bufio.Reader, *os.File) (string, error) {
+	answer, ok := script.next("")
+	if script.interactive {
+		// A terminal read without echo leaves the cursor after the label.
+		outputPrintln()
+	}
+	if !ok {
+		return "", script.exhausted()
+	}
+	return strings.TrimSpace(answer), nil
+}
@@ -8,14 +8,16 @@ import (
 	"os"
 	"strings"
 
+	appconfig "ssh-key-bootstrap/config"
+	"ssh-key-bootstrap/messages"
 	"ssh-key-bootstrap/providers"
 )
 
 var resolvePasswordFromSecretRef = func(secretRef string) (string, error) {
-	return providers.ResolveSecretReference(secretRef, providers.DefaultProviders())
+	return providers.ResolveSecretReference(secretRef, secretProviders())
 }
 var resolvePasswordFromNamedProvider = func(providerName, secretRef string) (string, error) {
-	return providers.ResolveSecretReferenceWithProvider(secretRef, providerName, providers.DefaultProviders())
+	return providers.ResolveSecretReferenceWithProvider(secretRef, providerName, secretProviders())
 }
 var readPasswordProviderSelection = func(programOptions *options) string {
 	if strings.TrimSpace(programOptions.PasswordProvider) != "" {
@@ -24,9 +26,6 @@ var readPasswordProviderSelection = func(programOptions *options) string {
 	return strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_PROVIDER")))
 }
 
-var isTerminalForPasswordPrompt = isTerminal
-var readPasswordForPrompt = readPassword
-
 func validateOptions(programOptions *options) error {
 	if programOptions.Port < 1 || programOptions.Port > 65535 {
 		return errors.New("port must be in range 1..65535")
@@ -34,6 +33,63 @@ func validateOptions(programOptions *options) error {
 	if programOptions.TimeoutSec <= 0 {
 		return errors.New("timeout must be greater than zero")
 	}
+	if programOptions.Watch > 0 && programOptions.WatchInterval <= 0 {
+		return errors.New("--watch-interval must be greater than zero")
+	}
+	if transport := strings.TrimSpace(programOptions.Transport); transport != "" && transport != defaultTransportName {
+		if programOptions.UseOpenSSH {
+			return errors.New("--transport is for the built-in client; with --use-openssh set ProxyCommand in ~/.ssh/config instead")
+		}
+		if programOptions.WaitUp > 0 {
+			return errors.New("--wait-up probes hosts over TCP and cannot be combined with --transport " + transport)
+		}
+		if order, _ := parseHostOrder(programOptions.Order); order == hostOrderByLatency {
+			return errors.New("--order by-latency probes hosts over TCP and cannot be combined with --transport " + transport)
+		}
+	}
+	if _, err := parseHostOrder(programOptions.Order); err != nil {
+		return err
+	}
+	if err := validateJumpOptions(programOptions); err != nil {
+		return err
+	}
+	if strings.TrimSpace(programOptions.KnownHostsDir) != "" && strings.TrimSpace(programOptions.KnownHostsOut) != "" {
+		return errors.New("--known-hosts-dir and --known-hosts-out both choose where trusted keys are written; use one")
+	}
+	if strings.TrimSpace(programOptions.NetBoxURL) == "" &&
+		(strings.TrimSpace(programOptions.NetBoxSite) != "" || strings.TrimSpace(programOptions.NetBoxRole) != "" || strings.TrimSpace(programOptions.NetBoxTokenRef) != "") {
+		return errors.New("--netbox-site, --netbox-role and --netbox-token-ref need --netbox-url")
+	}
+	if strings.TrimSpace(programOptions.ZabbixURL) == "" && strings.TrimSpace(programOptions.ZabbixTokenRef) != "" {
+		return errors.New("--zabbix-token-ref needs --zabbix-url")
+	}
+	if err := validateLDAPOptions(programOptions); err != nil {
+		return err
+	}
+	if err := validateIPAOptions(programOptions); err != nil {
+		return err
+	}
+	if err := validateKeycloakOptions(programOptions); err != nil {
+		return err
+	}
+	if _, err := parseFallbackUsers(programOptions.FallbackUsers); err != nil {
+		return err
+	}
+	if err := validateAuthMethods(programOptions); err != nil {
+		return err
+	}
+	if _, err := parseKeyPolicy(programOptions.KeyPolicy); err != nil {
+		return err
+	}
+	if _, err := parseSecretRefTemplate(programOptions.PasswordSecretRefTemplate); err != nil {
+		return err
+	}
+	if _, err := parseExpectedFingerprints(programOptions.ExpectFingerprints); err != nil {
+		return err
+	}
+	if len(programOptions.ExpectFingerprints) > 0 && (programOptions.UseOpenSSH || programOptions.InsecureIgnoreHostKey) {
+		return errors.New("--expect-fingerprint needs host key verification by the built-in client; it cannot be combined with --use-openssh or INSECURE_IGNORE_HOST_KEY")
+	}
 	if strings.TrimSpace(programOptions.Password) != "" && strings.TrimSpace(programOptions.PasswordSecretRef) != "" {
 		return errors.New("use either PASSWORD/password or PASSWORD_SECRET_REF/password_secret_ref, not both")
 	}
@@ -41,7 +97,7 @@ func validateOptions(programOptions *options) error {
 	selectedProvider := readPasswordProviderSelection(programOptions)
 	if selectedProvider != "" {
 		programOptions.PasswordProvider = selectedProvider
-		defaultProviders := providers.DefaultProviders()
+		defaultProviders := secretProviders()
 		if _, ok := providers.ProviderByName(selectedProvider, defaultProviders); !ok {
 			validProviderNames := providers.ProviderNames(defaultProviders)
 			if len(validProviderNames) == 0 {
@@ -60,13 +116,16 @@ func validateOptions(programOptions *options) error {
 				return nil
 			}
 
-			if !isTerminalForPasswordPrompt(os.Stdin) {
+			if !currentPrompter().Interactive(standardInputFile()) {
 				return errors.New("PASSWORD is required when PASSWORD_PROVIDER=local in non-interactive mode")
 			}
 			return nil
 		}
 
 		if strings.TrimSpace(programOptions.PasswordSecretRef) == "" {
+			if strings.TrimSpace(programOptions.HostPasswordSecretRefs) != "" || strings.TrimSpace(programOptions.PasswordSecretRefTemplate) != "" {
+				return nil
+			}
 			return fmt.Errorf("PASSWORD_SECRET_REF is required when PASSWORD_PROVIDER=%s", selectedProvider)
 		}
 
@@ -88,37 +147,48 @@ func validateOptions(programOptions *options) error {
 	return nil
 }
 
-func fillMissingInputs(inputReader *bufio.Reader, programOptions *options) error {
+// fillMissingInputs prompts for the login, the hosts and, when needsKey is
+// set, the public key.
+func fillMissingInputs(inputReader *bufio.Reader, programOptions *options, needsKey bool) error {
 	if inputReader == nil {
-		inputReader = bufio.NewReader(os.Stdin)
+		inputReader = newStandardInputReader()
 	}
 
-	var err error
-
-	if strings.TrimSpace(programOptions.User) == "" {
-		programOptions.User, err = promptRequired(inputReader, "SSH username: ")
-		if err != nil {
-			return wrapMissingInputError("SSH username", err)
+	if !hostSpecsCover(programOptions, func(hostSpec appconfig.HostSpec) string { return hostSpec.User }) {
+		if err := fillMissingUser(inputReader, programOptions); err != nil {
+			return err
 		}
 	}
-
-	if strings.TrimSpace(programOptions.Password) == "" {
-		programOptions.Password, err = promptPassword(inputReader, os.Stdin, "SSH password: ")
-		if err != nil {
-			return wrapMissingInputError("SSH password", err)
+	// With per-host secret refs the shared password is only prompted for later,
+	// and only if some target host has no ref of its own.
+	if !hasHostPasswordSecretRefs(programOptions) {
+		if err := fillMissingPassword(inputReader, programOptions); err != nil {
+			return err
 		}
 	}
 
+	var err error
+
 	if strings.TrimSpace(programOptions.Server) == "" &&
-		strings.TrimSpace(programOptions.Servers) == "" {
-		programOptions.Servers, err = promptRequired(inputReader, "Servers (comma-separated, host or host:port): ")
+		strings.TrimSpace(programOptions.Servers) == "" &&
+		strings.TrimSpace(programOptions.ServersFile) == "" &&
+		strings.TrimSpace(programOptions.HostsFile) == "" &&
+		strings.TrimSpace(programOptions.Discover) == "" &&
+		strings.TrimSpace(programOptions.NmapXML) == "" &&
+		strings.TrimSpace(programOptions.NetBoxURL) == "" &&
+		strings.TrimSpace(programOptions.ZabbixURL) == "" &&
+		strings.TrimSpace(programOptions.NagiosCfg) == "" &&
+		strings.TrimSpace(programOptions.LDAPURL) == "" &&
+		len(programOptions.Hosts) == 0 {
+		programOptions.Servers, err = promptRequired(inputReader, messages.Get(messages.PromptServers))
 		if err != nil {
 			return wrapMissingInputError("Servers", err)
 		}
 	}
 
-	if strings.TrimSpace(programOptions.KeyInput) == "" {
-		programOptions.KeyInput, err = promptRequired(inputReader, "Public key text or path to public key file: ")
+	if needsKey && strings.TrimSpace(programOptions.KeyInput) == "" && !hasExtraKeySources(programOptions) &&
+		!hostSpecsCover(programOptions, func(hostSpec appconfig.HostSpec) string { return hostSpec.Key }) {
+		programOptions.KeyInput, err = promptRequired(inputReader, messages.Get(messages.PromptPublicKey))
 		if err != nil {
 			return wrapMissingInputError("Public key", err)
 		}
@@ -127,6 +197,63 @@ func fillMissingInputs(inputReader *bufio.Reader, programOptions *options) error
 	return nil
 }
 
+// fillMissingCredentials prompts only for the SSH login, for subcommands that
+// take their hosts and keys from somewhere other than the config.
+func fillMissingCredentials(inputReader *bufio.Reader, programOptions *options) error {
+	if err := fillMissingUser(inputReader, programOptions); err != nil {
+		return err
+	}
+	return fillMissingPassword(inputReader, programOptions)
+}
+
+func fillMissingUser(inputReader *bufio.Reader, programOptions *options) error {
+	if strings.TrimSpace(programOptions.User) != "" {
+		return nil
+	}
+	if inputReader == nil {
+		inputReader = newStandardInputReader()
+	}
+
+	var err error
+	programOptions.User, err = promptRequired(inputReader, messages.Get(messages.PromptSSHUsername))
+	if err != nil {
+		return wrapMissingInputError("SSH username", err)
+	}
+	return nil
+}
+
+// fillMissingPassword prompts for the SSH password unless it is already set
+// or not used to log in (AUTH_METHODS without password, or --use-openssh).
+// With --confirm-password it is entered twice so a typo cannot lock out a run.
+func fillMissingPassword(inputReader *bufio.Reader, programOptions *options) error {
+	if strings.TrimSpace(programOptions.Password) != "" || !usesPasswordLogin(programOptions) {
+		return nil
+	}
+	if inputReader == nil {
+		inputReader = newStandardInputReader()
+	}
+
+	for {
+		password, err := promptPassword(inputReader, standardInputFile(), messages.Get(messages.PromptSSHPassword))
+		if err != nil {
+			return wrapMissingInputError("SSH password", err)
+		}
+		if !programOptions.ConfirmPassword {
+			programOptions.Password = password
+			return nil
+		}
+		confirmation, err := promptPassword(inputReader, standardInputFile(), messages.Get(messages.PromptConfirmSSHPassword))
+		if err != nil {
+			return wrapMissingInputError("SSH password confirmation", err)
+		}
+		if password == confirmation {
+			programOptions.Password = password
+			return nil
+		}
+		outputPrintln(messages.Get(messages.PasswordsMismatch))
+	}
+}
+
 func wrapMissingInputError(fieldName string, err error) error {
 	if errors.Is(err, io.EOF) {
 		return fmt.Errorf("%s is required but input ended (EOF)", fieldName)
@@ -143,43 +270,30 @@ func promptRequired(reader *bufio.Reader, label string) (string, error) {
 		if value != "" {
 			return value, nil
 		}
-		outputPrintln("Value is required.")
+		outputPrintln(messages.Get(messages.ValueRequired))
 	}
 }
 
 func promptPassword(reader *bufio.Reader, terminalInput *os.File, label string) (string, error) {
 	if terminalInput == nil {
-		terminalInput = os.Stdin
+		terminalInput = standardInputFile()
 	}
 	if reader == nil {
-		reader = bufio.NewReader(terminalInput)
+		reader = newStandardInputReader()
 	}
+	unlockPrompt := lockPrompt()
+	defer unlockPrompt()
 
 	for {
 		outputPrint(label)
 
-		var passwordInput string
-		if isTerminalForPasswordPrompt(terminalInput) {
-			passwordBytes, err := readPasswordForPrompt(terminalInput)
-			outputPrintln()
-			if err != nil {
-				return "", err
-			}
-			passwordInput = strings.TrimSpace(string(passwordBytes))
-		} else {
-			line, err := reader.ReadString('\n')
-			if err != nil && !errors.Is(err, io.EOF) {
-				return "", err
-			}
-			passwordInput = strings.TrimSpace(line)
-			if errors.Is(err, io.EOF) && passwordInput == "" {
-				return "", io.EOF
-			}
+		passwordInput, err := currentPrompter().Secret(reader, terminalInput)
+		if err != nil {
+			return "", err
 		}
-
 		if passwordInput != "" {
 			return passwordInput, nil
 		}
-		outputPrintln("Value is required.")
+		outputPrintln(messages.Get(messages.ValueRequired))
 	}
 }
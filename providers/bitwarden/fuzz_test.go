@@ -0,0 +1,22 @@
+package bitwarden
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseSecretID(f *testing.F) {
+	for _, seed := range []string{"bw://prod-ssh", "bitwarden://0f4c5b4e-8f3a-4bde-9d57-1c2e3a4b5c6d", "BW://  spaced  ", "bw://", "inf://other"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, secretRef string) {
+		secretID, err := parseSecretID(secretRef)
+		if err != nil {
+			return
+		}
+		if secretID == "" || secretID != strings.TrimSpace(secretID) || !strings.Contains(secretRef, secretID) {
+			t.Fatalf("parseSecretID(%q) = %q", secretRef, secretID)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const fixtureVersion = 1
+
+// Fixture holds recorded provider answers. RecordingProviders adds every
+// lookup to it, and ReplayProviders answers from it instead of the real
+// backends, so runs and tests work without Bitwarden or Infisical access.
+// The values are the secrets themselves; keep fixture files out of version
+// control unless they hold throwaway test credentials.
+type Fixture struct {
+	Version int             `json:"version"`
+	Answers []FixtureAnswer `json:"answers"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// FixtureAnswer is one recorded lookup: the value, or the error text when
+// the provider failed.
+type FixtureAnswer struct {
+	Provider string `json:"provider"`
+	Ref      string `json:"ref"`
+	Value    string `json:"value,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// LoadFixture reads the fixture at path. With allowMissing, a file that does
+// not exist yet is an empty fixture, which recording then creates.
+func LoadFixture(path string, allowMissing bool) (*Fixture, error) {
+	fixture := &Fixture{Version: fixtureVersion, path: path}
+	content, err := os.ReadFile(path) // #nosec G304 -- fixture path is explicit user input
+	if errors.Is(err, os.ErrNotExist) && allowMissing {
+		return fixture, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read secret fixture: %w", err)
+	}
+	if err := json.Unmarshal(content, fixture); err != nil {
+		return nil, fmt.Errorf("parse secret fixture %q: %w", path, err)
+	}
+	if fixture.Version != fixtureVersion {
+		return nil, fmt.Errorf("secret fixture %q has version %d, want %d", path, fixture.Version, fixtureVersion)
+	}
+	return fixture, nil
+}
+
+func (fixture *Fixture) answer(providerName, ref string) (FixtureAnswer, bool) {
+	fixture.mu.Lock()
+	defer fixture.mu.Unlock()
+
+	index := fixture.answerIndex(providerName, ref)
+	if index < 0 {
+		return FixtureAnswer{}, false
+	}
+	return fixture.Answers[index], true
+}
+
+func (fixture *Fixture) answerIndex(providerName, ref string) int {
+	return slices.IndexFunc(fixture.Answers, func(answer FixtureAnswer) bool {
+		return strings.EqualFold(answer.Provider, providerName) && answer.Ref == ref
+	})
+}
+
+// record adds or replaces the answer for its provider and ref and rewrites
+// the fixture file, so a run that stops early keeps what it looked up.
+func (fixture *Fixture) record(answer FixtureAnswer) error {
+	fixture.mu.Lock()
+	defer fixture.mu.Unlock()
+
+	if index := fixture.answerIndex(answer.Provider, answer.Ref); index >= 0 {
+		fixture.Answers[index] = answer
+	} else {
+		fixture.Answers = append(fixture.Answers, answer)
+	}
+	if fixture.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Dir(fixture.path), ".secret-fixture-*")
+	if err != nil {
+		return fmt.Errorf("write secret fixture: %w", err)
+	}
+	defer os.Remove(temporaryFile.Name())
+	if _, err := temporaryFile.Write(append(content, '\n')); err != nil {
+		_ = temporaryFile.Close()
+		return fmt.Errorf("write secret fixture: %w", err)
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("write secret fixture: %w", err)
+	}
+	if err := os.Rename(temporaryFile.Name(), fixture.path); err != nil {
+		return fmt.Errorf("write secret fixture: %w", err)
+	}
+	return nil
+}
+
+type recordingProvider struct {
+	Provider
+	fixture *Fixture
+}
+
+// RecordingProviders wraps providers so every lookup is also recorded in
+// fixture. A failed lookup is recorded too, so a replay fails the same way.
+func RecordingProviders(providers []Provider, fixture *Fixture) []Provider {
+	recording := make([]Provider, 0, len(providers))
+	for _, provider := range providers {
+		if provider == nil {
+			continue
+		}
+		recording = append(recording, recordingProvider{Provider: provider, fixture: fixture})
+	}
+	return recording
+}
+
+func (provider recordingProvider) Resolve(ref string) (string, error) {
+	value, err := provider.Provider.Resolve(ref)
+	answer := FixtureAnswer{Provider: provider.Name(), Ref: ref, Value: value}
+	if err != nil {
+		answer = FixtureAnswer{Provider: provider.Name(), Ref: ref, Error: err.Error()}
+	}
+	if recordErr := provider.fixture.record(answer); recordErr != nil {
+		return "", recordErr
+	}
+	return value, err
+}
+
+type replayProvider struct {
+	Provider
+	fixture *Fixture
+}
+
+// ReplayProviders wraps providers so lookups are answered from fixture and
+// never reach a backend. Each provider still decides which refs it supports;
+// a ref without a recorded answer fails.
+func ReplayProviders(providers []Provider, fixture *Fixture) []Provider {
+	replaying := make([]Provider, 0, len(providers))
+	for _, provider := range providers {
+		if provider == nil {
+			continue
+		}
+		replaying = append(replaying, replayProvider{Provider: provider, fixture: fixture})
+	}
+	return replaying
+}
+
+func (provider replayProvider) Resolve(ref string) (string, error) {
+	answer, ok := provider.fixture.answer(provider.Name(), ref)
+	if !ok {
+		return "", errors.New("no recorded answer for this reference in the secret fixture")
+	}
+	if answer.Error != "" {
+		return "", errors.New(answer.Error)
+	}
+	return answer.Value, nil
+}
@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type countingProvider struct {
+	fakeProvider
+	calls *int
+}
+
+func (provider countingProvider) Resolve(ref string) (string, error) {
+	*provider.calls++
+	return provider.fakeProvider.Resolve(ref)
+}
+
+func TestRecordedAnswersReplayWithoutTheBackend(t *testing.T) {
+	t.Parallel()
+
+	fixturePath := filepath.Join(t.TempDir(), "secrets.json")
+	fixture, err := LoadFixture(fixturePath, true)
+	if err != nil {
+		t.Fatalf("LoadFixture(missing) error = %v", err)
+	}
+	calls := 0
+	backends := []Provider{
+		countingProvider{fakeProvider{name: "vault", supports: true, value: "s3cret"}, &calls},
+		fakeProvider{name: "broken", supports: true, resolveErr: errors.New("token expired")},
+	}
+	recording := RecordingProviders(backends, fixture)
+	if value, err := ResolveSecretReferenceWithProvider("vault://db", "vault", recording); err != nil || value != "s3cret" {
+		t.Fatalf("recorded lookup = %q, %v", value, err)
+	}
+	if _, err := ResolveSecretReferenceWithProvider("broken://db", "broken", recording); err == nil {
+		t.Fatalf("recorded failing lookup error = nil")
+	}
+	info, err := os.Stat(fixturePath)
+	if err != nil {
+		t.Fatalf("fixture was not written: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("fixture mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	replayFixture, err := LoadFixture(fixturePath, false)
+	if err != nil {
+		t.Fatalf("LoadFixture() error = %v", err)
+	}
+	replaying := ReplayProviders(backends, replayFixture)
+	if value, err := ResolveSecretReference("vault://db", replaying); err != nil || value != "s3cret" {
+		t.Fatalf("replayed lookup = %q, %v", value, err)
+	}
+	if calls != 1 {
+		t.Fatalf("backend was called %d times, want only the recorded lookup", calls)
+	}
+	if _, err := ResolveSecretReferenceWithProvider("broken://db", "broken", replaying); err == nil || !strings.Contains(err.Error(), "token expired") {
+		t.Fatalf("replayed failure error = %v, want the recorded error", err)
+	}
+	if _, err := ResolveSecretReferenceWithProvider("vault://other", "vault", replaying); err == nil || !strings.Contains(err.Error(), "no recorded answer") {
+		t.Fatalf("unrecorded lookup error = %v", err)
+	}
+}
+
+func TestLoadFixtureRejectsBadFiles(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+	if _, err := LoadFixture(filepath.Join(directory, "missing.json"), false); err == nil {
+		t.Fatalf("LoadFixture(missing, replay) error = nil")
+	}
+	for name, content := range map[string]string{"broken.json": "{", "future.json": `{"version": 2, "answers": []}`} {
+		path := filepath.Join(directory, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if _, err := LoadFixture(path, true); err == nil {
+			t.Fatalf("LoadFixture(%s) error = nil", name)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package infisical
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzParseSecretRef(f *testing.F) {
+	for _, seed := range []string{"infisical://db-password?projectId=p1&env=prod", "inf://ssh", "INF://name?workspaceID=w&environment=dev", "inf://?env=prod", "inf://name?%zz", "bw://other"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, secretRef string) {
+		spec, err := parseSecretRef(secretRef)
+		if err != nil {
+			return
+		}
+		if spec.secretName == "" || spec.secretName != strings.TrimSpace(spec.secretName) || strings.Contains(spec.secretName, "?") {
+			t.Fatalf("parseSecretRef(%q) secret name = %q", secretRef, spec.secretName)
+		}
+		if !strings.Contains(secretRef, spec.secretName) {
+			t.Fatalf("parseSecretRef(%q) secret name %q is not in the ref", secretRef, spec.secretName)
+		}
+	})
+}
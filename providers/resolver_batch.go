@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const DefaultResolveWorkers = 8
+
+// ResolveSecretReferences resolves every distinct reference with at most
+// workers lookups in flight. Each reference is resolved once, however many
+// times it appears, and failures are reported together in input order.
+func ResolveSecretReferences(secretRefs []string, workers int, resolve func(secretRef string) (string, error)) (map[string]string, error) {
+	if resolve == nil {
+		return nil, errors.New("secret resolver is required")
+	}
+	if workers <= 0 {
+		workers = DefaultResolveWorkers
+	}
+
+	uniqueRefs := make([]string, 0, len(secretRefs))
+	seenRefs := make(map[string]struct{}, len(secretRefs))
+	for _, secretRef := range secretRefs {
+		trimmedRef := strings.TrimSpace(secretRef)
+		if trimmedRef == "" {
+			return nil, ErrEmptySecretReference
+		}
+		if _, exists := seenRefs[trimmedRef]; exists {
+			continue
+		}
+		seenRefs[trimmedRef] = struct{}{}
+		uniqueRefs = append(uniqueRefs, trimmedRef)
+	}
+
+	resolvedValues := make([]string, len(uniqueRefs))
+	resolveErrors := make([]error, len(uniqueRefs))
+	slots := make(chan struct{}, workers)
+	var waitGroup sync.WaitGroup
+	for index, secretRef := range uniqueRefs {
+		waitGroup.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer waitGroup.Done()
+			defer func() { <-slots }()
+			resolvedValues[index], resolveErrors[index] = resolve(secretRef)
+		}()
+	}
+	waitGroup.Wait()
+
+	resolvedByRef := make(map[string]string, len(uniqueRefs))
+	var failures []error
+	for index, secretRef := range uniqueRefs {
+		if resolveErrors[index] != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", secretRef, resolveErrors[index]))
+			continue
+		}
+		resolvedByRef[secretRef] = resolvedValues[index]
+	}
+	if len(failures) > 0 {
+		return nil, errors.Join(failures...)
+	}
+	return resolvedByRef, nil
+}
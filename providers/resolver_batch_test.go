@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolveSecretReferencesDeduplicatesAndBoundsConcurrency(t *testing.T) {
+	t.Parallel()
+
+	var inFlight, maxInFlight atomic.Int32
+	var callsMu sync.Mutex
+	calls := map[string]int{}
+	resolve := func(secretRef string) (string, error) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			observed := maxInFlight.Load()
+			if current <= observed || maxInFlight.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		callsMu.Lock()
+		calls[secretRef]++
+		callsMu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return "value-of-" + secretRef, nil
+	}
+
+	refs := []string{"bw://a", "bw://b", "bw://a", "bw://c", " bw://b ", "bw://d", "bw://e"}
+	resolved, err := ResolveSecretReferences(refs, 2, resolve)
+	if err != nil {
+		t.Fatalf("ResolveSecretReferences() error = %v", err)
+	}
+	if len(resolved) != 5 || resolved["bw://b"] != "value-of-bw://b" {
+		t.Fatalf("resolved = %v", resolved)
+	}
+	for secretRef, count := range calls {
+		if count != 1 {
+			t.Fatalf("%s resolved %d times, want once", secretRef, count)
+		}
+	}
+	if maxInFlight.Load() > 2 {
+		t.Fatalf("max concurrent lookups = %d, want <= 2", maxInFlight.Load())
+	}
+}
+
+func TestResolveSecretReferencesReportsEveryFailure(t *testing.T) {
+	t.Parallel()
+
+	lookupErr := errors.New("lookup failed")
+	_, err := ResolveSecretReferences([]string{"bw://ok", "bw://bad-1", "bw://bad-2"}, 0, func(secretRef string) (string, error) {
+		if strings.HasPrefix(secretRef, "bw://bad") {
+			return "", lookupErr
+		}
+		return "ok", nil
+	})
+	if !errors.Is(err, lookupErr) {
+		t.Fatalf("expected lookup error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "bw://bad-1") || !strings.Contains(err.Error(), "bw://bad-2") {
+		t.Fatalf("error does not name both failing refs: %v", err)
+	}
+}
+
+func TestResolveSecretReferencesRejectsEmptyRef(t *testing.T) {
+	t.Parallel()
+
+	_, err := ResolveSecretReferences([]string{"bw://a", " "}, 1, func(string) (string, error) { return "x", nil })
+	if !errors.Is(err, ErrEmptySecretReference) {
+		t.Fatalf("expected ErrEmptySecretReference, got %v", err)
+	}
+}
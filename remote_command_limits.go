@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultCommandTimeout   = 2 * time.Minute
+	defaultMaxCommandOutput = 1 << 20
+)
+
+var (
+	remoteCommandLimitsMu  sync.Mutex
+	remoteCommandTimeout   = defaultCommandTimeout
+	remoteCommandMaxOutput = defaultMaxCommandOutput
+)
+
+// configureRemoteCommandLimits bounds every remote command: it is killed
+// after timeout (--command-timeout) or once it has printed more than
+// maxOutput bytes (--max-output), so a hung PAM module or an endless MOTD
+// cannot stall a worker or fill memory. Zero disables a limit. The returned
+// function restores the defaults.
+func configureRemoteCommandLimits(timeout time.Duration, maxOutput int) (func(), error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("command timeout must not be negative, got %s", timeout)
+	}
+	if maxOutput < 0 {
+		return nil, fmt.Errorf("max output must not be negative, got %d", maxOutput)
+	}
+
+	remoteCommandLimitsMu.Lock()
+	remoteCommandTimeout, remoteCommandMaxOutput = timeout, maxOutput
+	remoteCommandLimitsMu.Unlock()
+	return func() {
+		remoteCommandLimitsMu.Lock()
+		remoteCommandTimeout, remoteCommandMaxOutput = defaultCommandTimeout, defaultMaxCommandOutput
+		remoteCommandLimitsMu.Unlock()
+	}, nil
+}
+
+func currentRemoteCommandLimits() (time.Duration, int) {
+	remoteCommandLimitsMu.Lock()
+	defer remoteCommandLimitsMu.Unlock()
+	return remoteCommandTimeout, remoteCommandMaxOutput
+}
+
+// remoteCommandLimitError reports a command that was killed for running too
+// long or printing too much.
+type remoteCommandLimitError struct {
+	timeout   time.Duration
+	maxOutput int
+}
+
+func (err *remoteCommandLimitError) Error() string {
+	if err.timeout > 0 {
+		return fmt.Sprintf("remote command did not finish within %s (raise --command-timeout)", err.timeout)
+	}
+	return fmt.Sprintf("remote command printed more than %d bytes (raise --max-output)", err.maxOutput)
+}
+
+// cappedOutput collects stdout and stderr of one command up to limit bytes
+// and closes exceeded when more arrives.
+type cappedOutput struct {
+	mu       sync.Mutex
+	buffer   bytes.Buffer
+	limit    int
+	exceeded chan struct{}
+	once     sync.Once
+}
+
+func newCappedOutput(limit int) *cappedOutput {
+	return &cappedOutput{limit: limit, exceeded: make(chan struct{})}
+}
+
+func (output *cappedOutput) Write(data []byte) (int, error) {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	if output.limit > 0 && output.buffer.Len()+len(data) > output.limit {
+		output.buffer.Write(data[:max(output.limit-output.buffer.Len(), 0)])
+		output.once.Do(func() { close(output.exceeded) })
+		return len(data), nil
+	}
+	return output.buffer.Write(data)
+}
+
+func (output *cappedOutput) Bytes() []byte {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	return bytes.Clone(output.buffer.Bytes())
+}
+
+// runLimitedSession runs command in session like CombinedOutput, within the
+// configured limits.
+func runLimitedSession(session *ssh.Session, command string) ([]byte, error) {
+	timeout, maxOutput := currentRemoteCommandLimits()
+	output := newCappedOutput(maxOutput)
+	session.Stdout = output
+	session.Stderr = output
+	if err := session.Start(command); err != nil {
+		return nil, err
+	}
+	err := waitWithinLimits(session.Wait, func() {
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+	}, output, timeout)
+	return output.Bytes(), err
+}
+
+// waitWithinLimits waits for a started command and kills it when it runs
+// longer than timeout or overflows output.
+func waitWithinLimits(wait func() error, kill func(), output *cappedOutput, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- wait() }()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		kill()
+		return &remoteCommandLimitError{timeout: timeout}
+	case <-output.exceeded:
+		kill()
+		return &remoteCommandLimitError{maxOutput: output.limit}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func setRemoteCommandLimitsForTest(t *testing.T, timeout time.Duration, maxOutput int) {
+	t.Helper()
+	restore, err := configureRemoteCommandLimits(timeout, maxOutput)
+	if err != nil {
+		t.Fatalf("configureRemoteCommandLimits() error = %v", err)
+	}
+	t.Cleanup(restore)
+}
+
+func TestConfigureRemoteCommandLimitsRejectsNegativeValues(t *testing.T) {
+	if _, err := configureRemoteCommandLimits(-time.Second, 0); err == nil {
+		t.Fatalf("negative timeout accepted")
+	}
+	if _, err := configureRemoteCommandLimits(0, -1); err == nil {
+		t.Fatalf("negative max output accepted")
+	}
+}
+
+func TestRunLimitedSessionStopsOversizedOutput(t *testing.T) {
+	setRemoteCommandLimitsForTest(t, time.Minute, 64)
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("password")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- in-memory test server
+	client, cleanupClient := newInMemorySSHClient(t, clientConfig, func(string, string) (string, string, uint32) {
+		return strings.Repeat("Welcome to the jungle\n", 100), "", 0
+	})
+	defer cleanupClient()
+
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	defer session.Close()
+	output, err := runLimitedSession(session, "true")
+	if _, limited := errors.AsType[*remoteCommandLimitError](err); !limited || !strings.Contains(err.Error(), "more than 64 bytes") {
+		t.Fatalf("runLimitedSession() error = %v", err)
+	}
+	if len(output) != 64 {
+		t.Fatalf("captured %d bytes, want 64", len(output))
+	}
+}
+
+func TestRunOpenSSHCommandKillsHungCommand(t *testing.T) {
+	setRemoteCommandLimitsForTest(t, 100*time.Millisecond, 0)
+	started := time.Now()
+	_, err := runOpenSSHCommand("sh", []string{"-c", "sleep 5"}, "")
+	if _, limited := errors.AsType[*remoteCommandLimitError](err); !limited || !strings.Contains(err.Error(), "did not finish within 100ms") {
+		t.Fatalf("runOpenSSHCommand() error = %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Fatalf("command ran for %s after the timeout", elapsed)
+	}
+}
+
+func TestRunOpenSSHCommandWithinLimitsReturnsOutput(t *testing.T) {
+	setRemoteCommandLimitsForTest(t, 5*time.Second, 1024)
+	output, err := runOpenSSHCommand("sh", []string{"-c", "echo out; echo err >&2"}, "")
+	if err != nil || !strings.Contains(string(output), "out\n") || !strings.Contains(string(output), "err\n") {
+		t.Fatalf("runOpenSSHCommand() = %q, %v", output, err)
+	}
+}
+
+func TestRemoteCommandErrorKeepsLimitErrorsShort(t *testing.T) {
+	limitErr := &remoteCommandLimitError{maxOutput: 10}
+	if err := remoteCommandError(limitErr, []byte("endless motd")); err != limitErr {
+		t.Fatalf("remoteCommandError() = %v", err)
+	}
+}
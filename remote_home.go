@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// remoteHomePrelude resolves the login user's home directory from the passwd
+// database instead of trusting $HOME, which is empty or wrong for some
+// service accounts and forced commands. It exports the result as HOME so the
+// operation's ~/.ssh paths point at it, and stops with a clear message when
+// the account has no usable home. CREATE_HOME=1 creates a missing directory,
+// through sudo -n when the user cannot create it.
+const remoteHomePrelude = "set -eu\n" +
+	"USER_NAME=$(id -un)\n" +
+	"RESOLVED_HOME=\n" +
+	"if command -v getent >/dev/null 2>&1; then\n" +
+	"  RESOLVED_HOME=$(getent passwd \"$USER_NAME\" | cut -d: -f6)\n" +
+	"fi\n" +
+	"if [ -z \"$RESOLVED_HOME\" ]; then RESOLVED_HOME=${HOME:-}; fi\n" +
+	"case \"$RESOLVED_HOME\" in\n" +
+	"  ''|/nonexistent|/dev/null)\n" +
+	"    echo \"" + appName + ": user $USER_NAME has no home directory (passwd home: '$RESOLVED_HOME'); assign one with usermod -d\" >&2\n" +
+	"    exit 1\n" +
+	"    ;;\n" +
+	"esac\n" +
+	"if [ ! -d \"$RESOLVED_HOME\" ]; then\n" +
+	"  if [ \"$CREATE_HOME\" != 1 ]; then\n" +
+	"    echo \"" + appName + ": home directory $RESOLVED_HOME of user $USER_NAME does not exist; create it or rerun with --create-home\" >&2\n" +
+	"    exit 1\n" +
+	"  fi\n" +
+	"  if ! mkdir -p -m 700 \"$RESOLVED_HOME\" 2>/dev/null; then\n" +
+	"    if ! sudo -n install -d -m 700 -o \"$USER_NAME\" -g \"$(id -gn)\" \"$RESOLVED_HOME\"; then\n" +
+	"      echo \"" + appName + ": cannot create home directory $RESOLVED_HOME for user $USER_NAME\" >&2\n" +
+	"      exit 1\n" +
+	"    fi\n" +
+	"  fi\n" +
+	"fi\n" +
+	"HOME=$RESOLVED_HOME\n" +
+	"export HOME\n"
+
+// withRemoteHome prefixes command with the home resolution prelude.
+func withRemoteHome(command string, createHome bool) string {
+	createHomeValue := "0"
+	if createHome {
+		createHomeValue = "1"
+	}
+	return "CREATE_HOME=" + createHomeValue + "\n" + remoteHomePrelude + strings.TrimPrefix(command, "set -eu\n")
+}
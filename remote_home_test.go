@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runRemoteHomePrelude runs the prelude locally with a fake getent that
+// reports passwdHome as the user's home directory.
+func runRemoteHomePrelude(t *testing.T, passwdHome string, createHome bool) (string, error) {
+	t.Helper()
+	binDir := t.TempDir()
+	fakeGetent := "#!/bin/sh\necho \"$2:x:1000:1000::" + passwdHome + ":/bin/sh\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "getent"), []byte(fakeGetent), 0o700); err != nil { // #nosec G306 -- test helper script
+		t.Fatalf("write fake getent: %v", err)
+	}
+	command := exec.Command("sh", "-c", withRemoteHome("set -eu\necho \"HOME=$HOME\"\n", createHome)) // #nosec G204 -- test runs a fixed script
+	command.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"), "HOME=/wrong")
+	output, err := command.CombinedOutput()
+	return string(output), err
+}
+
+func TestRemoteHomePreludeExportsPasswdHome(t *testing.T) {
+	home := t.TempDir()
+	output, err := runRemoteHomePrelude(t, home, false)
+	if err != nil || output != "HOME="+home+"\n" {
+		t.Fatalf("prelude = %q, %v", output, err)
+	}
+}
+
+func TestRemoteHomePreludeRequiresCreateHomeForMissingDirectory(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "svc-backup")
+	output, err := runRemoteHomePrelude(t, home, false)
+	if err == nil || !strings.Contains(output, "home directory "+home+" of user") || !strings.Contains(output, "--create-home") {
+		t.Fatalf("prelude = %q, %v", output, err)
+	}
+
+	output, err = runRemoteHomePrelude(t, home, true)
+	if err != nil || output != "HOME="+home+"\n" {
+		t.Fatalf("prelude with CREATE_HOME = %q, %v", output, err)
+	}
+	info, err := os.Stat(home)
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0o700 {
+		t.Fatalf("created home = %v, %v", info, err)
+	}
+}
+
+func TestRemoteHomePreludeRejectsAccountsWithoutHome(t *testing.T) {
+	output, err := runRemoteHomePrelude(t, "/nonexistent", true)
+	if err == nil || !strings.Contains(output, "has no home directory (passwd home: '/nonexistent')") {
+		t.Fatalf("prelude = %q, %v", output, err)
+	}
+}
+
+func TestPrepareRemoteScriptAddsHomePreludeOnlyWhenRequested(t *testing.T) {
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	script, err := prepareRemoteScript(installKeyOperation{}, remoteOperationInput{PublicKey: publicKey, CreateHome: true})
+	if err != nil {
+		t.Fatalf("prepareRemoteScript() error = %v", err)
+	}
+	if !strings.HasPrefix(script.Command, "CREATE_HOME=1\n") || strings.Count(script.Command, "set -eu\n") != 1 {
+		t.Fatalf("install-key command =\n%s", script.Command)
+	}
+
+	script, err = prepareRemoteScript(hardenSSHDOperation{}, remoteOperationInput{})
+	if err != nil {
+		t.Fatalf("prepareRemoteScript(harden-sshd) error = %v", err)
+	}
+	if strings.Contains(script.Command, "CREATE_HOME") {
+		t.Fatalf("harden-sshd command has the home prelude")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultRemoteOperationName = "install-key"
+
+// remoteOperation is a unit of remote work executed over an SSH session.
+// Operations register themselves from init() so run() can execute them by
+// name without knowing their scripts or how their output is interpreted.
+type remoteOperation interface {
+	Name() string
+	Title() string
+	Script(input remoteOperationInput) (remoteScript, error)
+	ParseResult(output string) (remoteOperationResult, error)
+}
+
+// remoteOperationPreflight is implemented by operations that must verify a
+// precondition (for example, that key-based login works) before their script
+// is allowed to run on a host.
+type remoteOperationPreflight interface {
+	Preflight(hostAddress string, input remoteOperationInput, clientConfig *ssh.ClientConfig) error
+}
+
+// remoteOperationOpenSSHPreflight is implemented by preflight operations
+// whose check runs through the system ssh client under --use-openssh.
+type remoteOperationOpenSSHPreflight interface {
+	OpenSSHPreflight(executor *opensshExecutor, hostAddress string, input remoteOperationInput) error
+}
+
+// remoteOperationWithoutKey is implemented by operations that do not use the
+// public key, so a run of only such operations does not ask for one.
+type remoteOperationWithoutKey interface {
+	WithoutPublicKey()
+}
+
+type remoteOperationInput struct {
+	Host      string
+	User      string
+	PublicKey string
+	// ExtraPublicKeys are handled like PublicKey by install-key and
+	// remove-key (--key, --key-file).
+	ExtraPublicKeys []string
+	Password        string // #nosec G117 -- forwarded to sudo on stdin only for operations that request it
+	IdentityFile    string
+	// ReplaceKeyComment replaces an installed entry with the same key blob
+	// instead of appending a second line that only differs by comment.
+	ReplaceKeyComment bool
+	// DesiredKeys and RemoveExtraKeys describe the full key set for
+	// operations that converge authorized_keys to a desired state.
+	DesiredKeys     []string
+	RemoveExtraKeys bool
+	// CreateHome lets operations that work in the user's home directory
+	// create it when the passwd entry names a directory that is missing.
+	CreateHome bool
+	// File is the file copy-file pushes (--src, --dest, --mode).
+	File remoteFileCopy
+	// Command is the command run-command runs (--cmd).
+	Command string
+}
+
+type remoteScript struct {
+	Command     string
+	Stdin       string
+	Description string
+	Sudo        bool
+	// UsesHome resolves the login user's home directory with getent before
+	// the command runs, for scripts that work under ~/.ssh.
+	UsesHome bool
+}
+
+type remoteOperationResult struct {
+	Changed bool
+	Message string
+	// Output carries collected remote state for read-only operations.
+	Output string
+}
+
+var (
+	remoteOperationRegistryMu sync.RWMutex
+	remoteOperationRegistry   []remoteOperation
+)
+
+func registerRemoteOperation(operation remoteOperation) {
+	if operation == nil {
+		return
+	}
+
+	operationName := strings.TrimSpace(operation.Name())
+	if operationName == "" {
+		return
+	}
+
+	remoteOperationRegistryMu.Lock()
+	defer remoteOperationRegistryMu.Unlock()
+
+	for _, registeredOperation := range remoteOperationRegistry {
+		if strings.EqualFold(strings.TrimSpace(registeredOperation.Name()), operationName) {
+			return
+		}
+	}
+	remoteOperationRegistry = append(remoteOperationRegistry, operation)
+}
+
+func remoteOperationByName(operationName string) (remoteOperation, bool) {
+	trimmedName := strings.TrimSpace(operationName)
+	if trimmedName == "" {
+		return nil, false
+	}
+
+	remoteOperationRegistryMu.RLock()
+	defer remoteOperationRegistryMu.RUnlock()
+
+	for _, operation := range remoteOperationRegistry {
+		if strings.EqualFold(strings.TrimSpace(operation.Name()), trimmedName) {
+			return operation, true
+		}
+	}
+	return nil, false
+}
+
+func remoteOperationNames() []string {
+	remoteOperationRegistryMu.RLock()
+	defer remoteOperationRegistryMu.RUnlock()
+
+	operationNames := make([]string, 0, len(remoteOperationRegistry))
+	for _, operation := range remoteOperationRegistry {
+		operationNames = append(operationNames, strings.TrimSpace(operation.Name()))
+	}
+	slices.Sort(operationNames)
+	return operationNames
+}
+
+func selectRemoteOperations(operationList string) ([]remoteOperation, error) {
+	operationNames := splitServerEntries(operationList)
+	if len(operationNames) == 0 {
+		operationNames = []string{defaultRemoteOperationName}
+	}
+
+	selectedOperations := make([]remoteOperation, 0, len(operationNames))
+	seenNames := make(map[string]struct{}, len(operationNames))
+	for _, operationName := range operationNames {
+		operation, ok := remoteOperationByName(operationName)
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %q (valid: %s)", operationName, strings.Join(remoteOperationNames(), ", "))
+		}
+
+		key := strings.ToLower(operation.Name())
+		if _, exists := seenNames[key]; exists {
+			continue
+		}
+		seenNames[key] = struct{}{}
+		selectedOperations = append(selectedOperations, operation)
+	}
+	return selectedOperations, nil
+}
+
+// operationsUsePublicKey reports whether any of operations needs the key.
+func operationsUsePublicKey(operations []remoteOperation) bool {
+	for _, operation := range operations {
+		if _, withoutKey := operation.(remoteOperationWithoutKey); !withoutKey {
+			return true
+		}
+	}
+	return false
+}
+
+func runRemoteOperation(client *ssh.Client, operation remoteOperation, input remoteOperationInput, logf func(format string, args ...any)) (remoteOperationResult, error) {
+	if client == nil {
+		return remoteOperationResult{}, errors.New("ssh client is nil")
+	}
+
+	script, err := prepareRemoteScript(operation, input)
+	if err != nil {
+		return remoteOperationResult{}, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return remoteOperationResult{}, &sessionError{op: "create session", err: err}
+	}
+	defer session.Close()
+
+	if logf != nil {
+		logf("Applying %s...", script.Description)
+	}
+	if script.Stdin != "" {
+		session.Stdin = strings.NewReader(script.Stdin)
+	}
+	commandOutput, err := runLimitedSession(session, script.Command)
+	if _, limited := errors.AsType[*remoteCommandLimitError](err); limited {
+		return remoteOperationResult{}, err
+	}
+	if fallback, ok := operation.(remoteOperationSFTPFallback); ok && (err != nil || !fallback.ScriptRan(string(commandOutput))) {
+		if result, handled, sftpErr := runWithoutShell(client, fallback, input, logf); handled {
+			return result, sftpErr
+		}
+	}
+	if err != nil {
+		return remoteOperationResult{}, remoteCommandError(err, commandOutput)
+	}
+	if logf != nil {
+		logf("Remote command completed.")
+	}
+	return operation.ParseResult(string(commandOutput))
+}
+
+// prepareRemoteScript builds the operation's script and returns the exact
+// command line and stdin to send, with the home directory prelude and sudo
+// wrapping already applied.
+func prepareRemoteScript(operation remoteOperation, input remoteOperationInput) (remoteScript, error) {
+	script, err := operation.Script(input)
+	if err != nil {
+		return remoteScript{}, fmt.Errorf("build %s script: %w", operation.Name(), err)
+	}
+
+	script.Description = strings.TrimSpace(script.Description)
+	if script.Description == "" {
+		script.Description = operation.Name()
+	}
+	script.Command = normalizeLF(script.Command)
+	if script.UsesHome {
+		script.Command = withRemoteHome(script.Command, input.CreateHome)
+	}
+	if script.Sudo {
+		script.Command = wrapWithSudo(script.Command)
+		script.Stdin = input.Password + "\n" + script.Stdin
+	}
+	return script, nil
+}
+
+func remoteCommandError(err error, commandOutput []byte) error {
+	outputMessage := strings.TrimSpace(string(commandOutput))
+	if _, limited := errors.AsType[*remoteCommandLimitError](err); limited || outputMessage == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, outputMessage)
+}
+
+// wrapWithSudo runs command as root. Non-root users go through sudo, which
+// reads the password from the first stdin line; root ignores that line.
+func wrapWithSudo(command string) string {
+	quotedCommand := shellQuote(command)
+	return "if [ \"$(id -u)\" -eq 0 ]; then IFS= read -r _ || true; exec sh -c " + quotedCommand + "; " +
+		"else exec sudo -S -p '' sh -c " + quotedCommand + "; fi"
+}
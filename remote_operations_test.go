@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type fakeRemoteOperation struct {
+	name    string
+	command string
+}
+
+func (operation fakeRemoteOperation) Name() string  { return operation.name }
+func (operation fakeRemoteOperation) Title() string { return "Fake " + operation.name }
+func (operation fakeRemoteOperation) Script(remoteOperationInput) (remoteScript, error) {
+	return remoteScript{Command: operation.command}, nil
+}
+func (fakeRemoteOperation) ParseResult(output string) (remoteOperationResult, error) {
+	return remoteOperationResult{Changed: strings.Contains(output, "changed"), Message: strings.TrimSpace(output)}, nil
+}
+
+func TestRegisterRemoteOperationIgnoresDuplicatesAndBlankNames(t *testing.T) {
+	registerRemoteOperation(nil)
+	registerRemoteOperation(fakeRemoteOperation{name: "  "})
+	registerRemoteOperation(fakeRemoteOperation{name: "INSTALL-KEY"})
+
+	operation, ok := remoteOperationByName("install-key")
+	if !ok {
+		t.Fatalf("expected install-key operation to be registered")
+	}
+	if _, isInstallKey := operation.(installKeyOperation); !isInstallKey {
+		t.Fatalf("install-key was replaced by %T", operation)
+	}
+	for _, operationName := range remoteOperationNames() {
+		if strings.TrimSpace(operationName) == "" {
+			t.Fatalf("blank operation name registered: %v", remoteOperationNames())
+		}
+	}
+}
+
+func TestSelectRemoteOperationsDefaultsToInstallKey(t *testing.T) {
+	operations, err := selectRemoteOperations("")
+	if err != nil {
+		t.Fatalf("selectRemoteOperations() error = %v", err)
+	}
+	if len(operations) != 1 || operations[0].Name() != defaultRemoteOperationName {
+		t.Fatalf("selectRemoteOperations() = %v, want [%s]", operations, defaultRemoteOperationName)
+	}
+}
+
+func TestSelectRemoteOperationsDeduplicatesAndRejectsUnknown(t *testing.T) {
+	operations, err := selectRemoteOperations("install-key, INSTALL-KEY")
+	if err != nil {
+		t.Fatalf("selectRemoteOperations() error = %v", err)
+	}
+	if len(operations) != 1 {
+		t.Fatalf("len(operations) = %d, want 1", len(operations))
+	}
+
+	_, err = selectRemoteOperations("install-key,missing-op")
+	if err == nil {
+		t.Fatalf("expected unknown operation error")
+	}
+	if !strings.Contains(err.Error(), `unknown operation "missing-op"`) || !strings.Contains(err.Error(), "valid:") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestInstallKeyOperationParseResult(t *testing.T) {
+	operation := installKeyOperation{}
+
+	result, err := operation.ParseResult("")
+	if err != nil {
+		t.Fatalf("ParseResult() error = %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected empty output to report a change")
+	}
+
+	result, err = operation.ParseResult(authorizedKeyPresentMarker + "\n")
+	if err != nil {
+		t.Fatalf("ParseResult() error = %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected existing key to report no change")
+	}
+}
+
+func TestInstallKeyOperationScriptRequiresKey(t *testing.T) {
+	if _, err := (installKeyOperation{}).Script(remoteOperationInput{}); err == nil {
+		t.Fatalf("expected missing public key error")
+	}
+}
+
+func TestRunRemoteOperationWithStatusUsesOperationScript(t *testing.T) {
+	clientConfig := &ssh.ClientConfig{
+		User:            "deploy",
+		Auth:            []ssh.AuthMethod{ssh.Password("password")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         2 * time.Second,
+	}
+
+	var capturedCommand string
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
+			capturedCommand = command
+			return "changed\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	operation := fakeRemoteOperation{name: "fake", command: "echo changed"}
+	result, err := runRemoteOperationWithStatus("in-memory:22", operation, remoteOperationInput{Host: "in-memory:22"}, clientConfig, nil)
+	if err != nil {
+		t.Fatalf("runRemoteOperationWithStatus() error = %v", err)
+	}
+	if capturedCommand != "echo changed" {
+		t.Fatalf("remote command = %q, want %q", capturedCommand, "echo changed")
+	}
+	if !result.Changed || result.Message != "changed" {
+		t.Fatalf("result = %+v, want changed result", result)
+	}
+}
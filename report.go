@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatHTML     = "html"
+)
+
+// runReport is the post-run summary --report writes for change tickets.
+type runReport struct {
+	RunID      string
+	Started    time.Time
+	Finished   time.Time
+	Operations []string
+	Hosts      []runReportHost
+	Categories []runReportCategory
+	OK         int // hosts that succeeded without a change
+	Changed    int
+	Failed     int
+}
+
+type runReportHost struct {
+	Host     string
+	Status   string // ok, changed or failed
+	OK       int
+	Changed  int
+	Failed   int
+	Duration time.Duration
+	Category hostErrorCategory
+	Error    string
+}
+
+type runReportCategory struct {
+	Name  hostErrorCategory
+	Count int
+}
+
+// reportFormatForPath picks the report format from the file extension.
+func reportFormatForPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(strings.TrimSpace(path))) {
+	case ".md", ".markdown":
+		return reportFormatMarkdown, nil
+	case ".html", ".htm":
+		return reportFormatHTML, nil
+	default:
+		return "", fmt.Errorf("--report %q: use a .md or .html file name", path)
+	}
+}
+
+func buildRunReport(runID string, started, finished time.Time, operations []remoteOperation, hosts []string, hostRecaps map[string]hostRunRecap) runReport {
+	report := runReport{RunID: runID, Started: started, Finished: finished}
+	for _, operation := range operations {
+		report.Operations = append(report.Operations, operation.Name())
+	}
+	for _, host := range hosts {
+		recap := hostRecaps[host]
+		reportHost := runReportHost{Host: host, Status: "ok", OK: recap.ok, Changed: recap.changed, Failed: recap.failed, Duration: recap.duration}
+		switch {
+		case recap.failed > 0:
+			reportHost.Status = "failed"
+			reportHost.Category = classifyHostError(recap.lastErr)
+			if recap.lastErr != nil {
+				reportHost.Error = recap.lastErr.Error()
+			}
+			report.Failed++
+		case recap.changed > 0:
+			reportHost.Status = "changed"
+			report.Changed++
+		default:
+			report.OK++
+		}
+		report.Hosts = append(report.Hosts, reportHost)
+	}
+	categoryCounts := hostFailureCategoryCounts(hosts, hostRecaps)
+	for _, category := range hostErrorCategories {
+		if count := categoryCounts[category]; count > 0 {
+			report.Categories = append(report.Categories, runReportCategory{Name: category, Count: count})
+		}
+	}
+	return report
+}
+
+func (report runReport) Duration() time.Duration {
+	return report.Finished.Sub(report.Started)
+}
+
+func (report runReport) FailedHosts() []runReportHost {
+	var failedHosts []runReportHost
+	for _, host := range report.Hosts {
+		if host.Status == "failed" {
+			failedHosts = append(failedHosts, host)
+		}
+	}
+	return failedHosts
+}
+
+// formatReportDuration shows durations at a precision a reader cares about;
+// hosts that never ran an operation show a dash.
+func formatReportDuration(duration time.Duration) string {
+	if duration <= 0 {
+		return "-"
+	}
+	if duration < time.Second {
+		return duration.Round(time.Millisecond).String()
+	}
+	return duration.Round(100 * time.Millisecond).String()
+}
+
+func formatReportTime(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.RFC3339)
+}
+
+func renderRunReportMarkdown(writer io.Writer, report runReport) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# %s run %s\n\n", appName, report.RunID)
+	builder.WriteString("| | |\n| --- | --- |\n")
+	fmt.Fprintf(&builder, "| Run ID | `%s` |\n", report.RunID)
+	fmt.Fprintf(&builder, "| Started | %s |\n", formatReportTime(report.Started))
+	fmt.Fprintf(&builder, "| Finished | %s |\n", formatReportTime(report.Finished))
+	fmt.Fprintf(&builder, "| Duration | %s |\n", formatReportDuration(report.Duration()))
+	fmt.Fprintf(&builder, "| Operations | %s |\n", strings.Join(report.Operations, ", "))
+	fmt.Fprintf(&builder, "| Hosts | %d (%d ok, %d changed, %d failed) |\n", len(report.Hosts), report.OK, report.Changed, report.Failed)
+
+	if len(report.Categories) > 0 {
+		builder.WriteString("\n## Failure categories\n\n")
+		for _, category := range report.Categories {
+			fmt.Fprintf(&builder, "- `%s`: %d host(s)\n", category.Name, category.Count)
+		}
+	}
+
+	builder.WriteString("\n## Hosts\n\n")
+	builder.WriteString("| Host | Status | ok | changed | failed | Duration |\n")
+	builder.WriteString("| --- | --- | ---: | ---: | ---: | ---: |\n")
+	for _, host := range report.Hosts {
+		fmt.Fprintf(&builder, "| %s | %s | %d | %d | %d | %s |\n",
+			markdownTableCell(host.Host), host.Status, host.OK, host.Changed, host.Failed, formatReportDuration(host.Duration))
+	}
+
+	builder.WriteString("\n## Failures\n\n")
+	failedHosts := report.FailedHosts()
+	if len(failedHosts) == 0 {
+		builder.WriteString("No host failed.\n")
+	}
+	for index, host := range failedHosts {
+		if index > 0 {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(&builder, "### %s\n\nCategory: `%s`\n\n```\n%s\n```\n", host.Host, host.Category, host.Error)
+	}
+
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+// markdownTableCell keeps a value from breaking out of its table cell.
+func markdownTableCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+var runReportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": formatReportDuration,
+	"time":     formatReportTime,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.AppName}} run {{.Report.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.number { text-align: right; }
+tr.failed td { background: #fdecea; }
+tr.changed td { background: #fff8e1; }
+pre { background: #f5f5f5; padding: 0.6em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.AppName}} run {{.Report.RunID}}</h1>
+<table>
+<tr><th>Run ID</th><td><code>{{.Report.RunID}}</code></td></tr>
+<tr><th>Started</th><td>{{time .Report.Started}}</td></tr>
+<tr><th>Finished</th><td>{{time .Report.Finished}}</td></tr>
+<tr><th>Duration</th><td>{{duration .Report.Duration}}</td></tr>
+<tr><th>Operations</th><td>{{range $index, $name := .Report.Operations}}{{if $index}}, {{end}}{{$name}}{{end}}</td></tr>
+<tr><th>Hosts</th><td>{{len .Report.Hosts}} ({{.Report.OK}} ok, {{.Report.Changed}} changed, {{.Report.Failed}} failed)</td></tr>
+</table>
+{{- if .Report.Categories}}
+<h2>Failure categories</h2>
+<ul>
+{{- range .Report.Categories}}
+<li><code>{{.Name}}</code>: {{.Count}} host(s)</li>
+{{- end}}
+</ul>
+{{- end}}
+<h2>Hosts</h2>
+<table>
+<tr><th>Host</th><th>Status</th><th>ok</th><th>changed</th><th>failed</th><th>Duration</th></tr>
+{{- range .Report.Hosts}}
+<tr class="{{.Status}}"><td>{{.Host}}</td><td>{{.Status}}</td><td class="number">{{.OK}}</td><td class="number">{{.Changed}}</td><td class="number">{{.Failed}}</td><td class="number">{{duration .Duration}}</td></tr>
+{{- end}}
+</table>
+<h2>Failures</h2>
+{{- range .Report.FailedHosts}}
+<h3>{{.Host}}</h3>
+<p>Category: <code>{{.Category}}</code></p>
+<pre>{{.Error}}</pre>
+{{- else}}
+<p>No host failed.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+func renderRunReportHTML(writer io.Writer, report runReport) error {
+	return runReportHTMLTemplate.Execute(writer, struct {
+		AppName string
+		Report  runReport
+	}{AppName: appName, Report: report})
+}
+
+// writeRunReport writes report to path in the format its extension names.
+func writeRunReport(path string, report runReport) error {
+	format, err := reportFormatForPath(path)
+	if err != nil {
+		return err
+	}
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return fmt.Errorf("resolve report path: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	if format == reportFormatHTML {
+		err = renderRunReportHTML(&buffer, report)
+	} else {
+		err = renderRunReportMarkdown(&buffer, report)
+	}
+	if err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	if err := os.WriteFile(expandedPath, buffer.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
+
+// reportRun writes the --report file as its own task. Like
+// --failed-hosts-out, a write error is reported but does not change the
+// outcome of the run.
+func reportRun(programOptions *options, report runReport) {
+	if strings.TrimSpace(programOptions.Report) == "" {
+		return
+	}
+	outputAnsibleTask("Write run report")
+	if err := writeRunReport(programOptions.Report, report); err != nil {
+		outputAnsibleHostStatus("failed", "localhost", err.Error())
+		return
+	}
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) reported to %s", len(report.Hosts), programOptions.Report))
+}
+
+// writeResultsCSV writes one row per host for spreadsheets that track a
+// rollout (--csv). duration is in seconds so it can be summed and sorted.
+func writeResultsCSV(path string, report runReport) error {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return fmt.Errorf("resolve CSV path: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	_ = writer.Write([]string{"host", "status", "changed", "error", "duration"})
+	for _, host := range report.Hosts {
+		_ = writer.Write([]string{
+			host.Host,
+			host.Status,
+			strconv.FormatBool(host.Changed > 0),
+			host.Error,
+			strconv.FormatFloat(host.Duration.Seconds(), 'f', 3, 64),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("render CSV: %w", err)
+	}
+	if err := os.WriteFile(expandedPath, buffer.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("write CSV: %w", err)
+	}
+	return nil
+}
+
+// reportResultsCSV writes the --csv file as its own task; a write error is
+// reported but does not change the outcome of the run.
+func reportResultsCSV(programOptions *options, report runReport) {
+	if strings.TrimSpace(programOptions.CSVFile) == "" {
+		return
+	}
+	outputAnsibleTask("Write results CSV")
+	if err := writeResultsCSV(programOptions.CSVFile, report); err != nil {
+		outputAnsibleHostStatus("failed", "localhost", err.Error())
+		return
+	}
+	outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) written to %s", len(report.Hosts), programOptions.CSVFile))
+}
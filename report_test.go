@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRunReport() runReport {
+	started := time.Date(2026, 5, 4, 9, 30, 0, 0, time.UTC)
+	return buildRunReport("20260504-0930-ab12", started, started.Add(42*time.Second), []remoteOperation{installKeyOperation{}}, []string{"app01:22", "app02:22", "db|01:22"}, map[string]hostRunRecap{
+		"app01:22": {ok: 1, changed: 1, duration: 1200 * time.Millisecond},
+		"app02:22": {ok: 1, duration: 350 * time.Millisecond},
+		"db|01:22": {failed: 1, lastErr: errors.New(`ssh: handshake failed: ssh: unable to authenticate <script>`)},
+	})
+}
+
+func TestBuildRunReportSummarizesHosts(t *testing.T) {
+	report := testRunReport()
+	if report.OK != 1 || report.Changed != 1 || report.Failed != 1 {
+		t.Fatalf("ok/changed/failed = %d/%d/%d", report.OK, report.Changed, report.Failed)
+	}
+	if len(report.Categories) != 1 || report.Categories[0].Name != hostErrorAuth {
+		t.Fatalf("categories = %+v", report.Categories)
+	}
+	if failedHosts := report.FailedHosts(); len(failedHosts) != 1 || failedHosts[0].Host != "db|01:22" || failedHosts[0].Category != hostErrorAuth {
+		t.Fatalf("failed hosts = %+v", failedHosts)
+	}
+}
+
+func TestWriteRunReportMarkdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md")
+	if err := writeRunReport(path, testRunReport()); err != nil {
+		t.Fatalf("writeRunReport() error = %v", err)
+	}
+	content, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	for _, want := range []string{
+		"# ssh-key-bootstrap run 20260504-0930-ab12\n",
+		"| Started | 2026-05-04T09:30:00Z |\n",
+		"| Duration | 42s |\n",
+		"| Operations | install-key |\n",
+		"| Hosts | 3 (1 ok, 1 changed, 1 failed) |\n",
+		"- `auth`: 1 host(s)\n",
+		"| app01:22 | changed | 1 | 1 | 0 | 1.2s |\n",
+		"| app02:22 | ok | 1 | 0 | 0 | 350ms |\n",
+		"| db\\|01:22 | failed | 0 | 0 | 1 | - |\n",
+		"### db|01:22\n\nCategory: `auth`\n\n```\nssh: handshake failed: ssh: unable to authenticate <script>\n```\n",
+	} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("report missing %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestWriteRunReportHTMLEscapesErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := writeRunReport(path, testRunReport()); err != nil {
+		t.Fatalf("writeRunReport() error = %v", err)
+	}
+	content, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("read report: %v", err)
+	}
+	html := string(content)
+	if strings.Contains(html, "<script>") || !strings.Contains(html, "unable to authenticate &lt;script&gt;") {
+		t.Fatalf("error output not escaped:\n%s", html)
+	}
+	if !strings.Contains(html, `<tr class="failed"><td>db|01:22</td><td>failed</td>`) {
+		t.Fatalf("host row missing:\n%s", html)
+	}
+}
+
+func TestReportFormatForPathRejectsUnknownExtension(t *testing.T) {
+	if _, err := reportFormatForPath("report.txt"); err == nil || !strings.Contains(err.Error(), ".md or .html") {
+		t.Fatalf("reportFormatForPath() error = %v", err)
+	}
+	if format, err := reportFormatForPath("CHANGE-1234.HTML"); err != nil || format != reportFormatHTML {
+		t.Fatalf("reportFormatForPath() = %q, %v", format, err)
+	}
+}
+
+func TestWriteResultsCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	if err := writeResultsCSV(path, testRunReport()); err != nil {
+		t.Fatalf("writeResultsCSV() error = %v", err)
+	}
+	content, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := "host,status,changed,error,duration\n" +
+		"app01:22,changed,true,,1.200\n" +
+		"app02:22,ok,false,,0.350\n" +
+		"db|01:22,failed,false,ssh: handshake failed: ssh: unable to authenticate <script>,0.000\n"
+	if string(content) != want {
+		t.Fatalf("CSV =\n%s\nwant\n%s", content, want)
+	}
+}
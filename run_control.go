@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// errRunStopped is the failure of a host that was never started because the
+// operator stopped the run; it keeps the host in the failed-hosts file, so
+// --again picks up where the run left off.
+var errRunStopped = errors.New("not run: the run was stopped with q")
+
+// runControl lets the operator steer a run from the terminal: p pauses
+// dispatching new hosts, r resumes and q stops. A host already running
+// always finishes.
+type runControl struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	paused  bool
+	stopped bool
+	done    chan struct{}
+}
+
+var (
+	activeRunControlMu sync.Mutex
+	activeRunControl   *runControl
+)
+
+// startRunControl listens for run keys while the operations run, when
+// someone is at the terminal. The returned function stops listening.
+func startRunControl(programOptions *options) func() {
+	if programOptions.StreamHosts || !currentPrompter().Interactive(standardInputFile()) {
+		return func() {}
+	}
+	control := &runControl{changed: make(chan struct{}), done: make(chan struct{})}
+	activeRunControlMu.Lock()
+	activeRunControl = control
+	activeRunControlMu.Unlock()
+	outputPrintln("Type p and Enter to pause after the running host, r to resume, q to stop.")
+	go control.listen()
+	return func() {
+		activeRunControlMu.Lock()
+		activeRunControl = nil
+		activeRunControlMu.Unlock()
+		close(control.done)
+	}
+}
+
+// listen reads run keys from stdin. Trust prompts read the same stdin during
+// the run, so every read is offered to them as the pending prompt line: a
+// line typed while a prompt waits answers the prompt. A line that is not a
+// run key, such as an answer typed before its prompt came up, is kept for the
+// next prompt, and listening holds off until a prompt took it. When the run
+// ends, the read still waiting on stdin is handed back to the prompts, so
+// stdin only ever has one reader.
+func (control *runControl) listen() {
+	reader := trustPromptReader()
+	// A trust prompt that timed out before the run left its read waiting.
+	readChannel := takePendingPromptLine()
+	for {
+		if readChannel == nil {
+			readChannel = make(chan promptResult, 1)
+			go func(resultChannel chan promptResult) {
+				answer, err := currentPrompter().Line(reader, "")
+				resultChannel <- promptResult{answer: answer, err: err}
+			}(readChannel)
+		}
+		offeredLine := make(chan promptResult, 1)
+		setPendingPromptLine(offeredLine)
+
+		var result promptResult
+		select {
+		case result = <-readChannel:
+		case <-control.done:
+			claimPendingPromptLine(offeredLine)
+			setPendingPromptLine(readChannel)
+			return
+		}
+		readChannel = nil
+		if !claimPendingPromptLine(offeredLine) {
+			offeredLine <- result
+			continue
+		}
+		if result.err == nil {
+			noteEchoedLine()
+			if control.handleKey(result.answer) {
+				continue
+			}
+		}
+
+		// The line, or the end of input, belongs to the next prompt.
+		heldLine := make(chan promptResult, 1)
+		heldLine <- result
+		taken := offerPromptLine(heldLine)
+		if result.err != nil {
+			return
+		}
+		select {
+		case <-taken:
+		case <-control.done:
+			return
+		}
+	}
+}
+
+// handleKey acts on a run key and reports whether key was one.
+func (control *runControl) handleKey(key string) bool {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+
+	switch strings.ToLower(key) {
+	case "p":
+		if control.paused || control.stopped {
+			return true
+		}
+		control.paused = true
+		outputPrintln("Paused: running hosts finish, no new host starts. Type r to resume or q to stop.")
+	case "r":
+		if !control.paused || control.stopped {
+			return true
+		}
+		control.paused = false
+		outputPrintln("Resumed.")
+	case "q":
+		if control.stopped {
+			return true
+		}
+		control.stopped = true
+		outputPrintln("Stopping: running hosts finish, no new host starts.")
+	default:
+		return false
+	}
+	close(control.changed)
+	control.changed = make(chan struct{})
+	return true
+}
+
+// waitTurn blocks while the run is paused and reports whether the next host
+// may start.
+func (control *runControl) waitTurn() bool {
+	for {
+		control.mu.Lock()
+		paused, stopped, changed := control.paused, control.stopped, control.changed
+		control.mu.Unlock()
+		if stopped {
+			return false
+		}
+		if !paused {
+			return true
+		}
+		<-changed
+	}
+}
+
+// runMayDispatch reports whether executeRemoteOperations may start the next
+// host; without a run control it always may.
+func runMayDispatch() bool {
+	activeRunControlMu.Lock()
+	control := activeRunControl
+	activeRunControlMu.Unlock()
+	if control == nil {
+		return true
+	}
+	return control.waitTurn()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func useRunControlForTest(t *testing.T) *runControl {
+	t.Helper()
+	control := &runControl{changed: make(chan struct{}), done: make(chan struct{})}
+	activeRunControlMu.Lock()
+	activeRunControl = control
+	activeRunControlMu.Unlock()
+	t.Cleanup(func() {
+		activeRunControlMu.Lock()
+		activeRunControl = nil
+		activeRunControlMu.Unlock()
+	})
+	return control
+}
+
+func TestRunControlPauseBlocksDispatchUntilResumed(t *testing.T) {
+	_, _ = captureWriters(t)
+	control := useRunControlForTest(t)
+	control.handleKey("p")
+
+	dispatched := make(chan bool, 1)
+	go func() { dispatched <- runMayDispatch() }()
+	select {
+	case <-dispatched:
+		t.Fatal("next host dispatched while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	control.handleKey("r")
+	select {
+	case mayDispatch := <-dispatched:
+		if !mayDispatch {
+			t.Fatal("runMayDispatch() = false after resume")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch still blocked after resume")
+	}
+}
+
+func TestRunControlStopReleasesPausedDispatch(t *testing.T) {
+	_, _ = captureWriters(t)
+	control := useRunControlForTest(t)
+	control.handleKey("p")
+
+	dispatched := make(chan bool, 1)
+	go func() { dispatched <- runMayDispatch() }()
+	control.handleKey("q")
+	select {
+	case mayDispatch := <-dispatched:
+		if mayDispatch {
+			t.Fatal("runMayDispatch() = true after stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch still blocked after stop")
+	}
+	control.handleKey("r")
+	if runMayDispatch() {
+		t.Fatal("r resumed a stopped run")
+	}
+}
+
+func TestRunControlListenReadsKeys(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	t.Cleanup(usePrompter(&scriptedPrompter{interactive: true, answers: []string{"P", "q"}}))
+	t.Cleanup(func() { setPendingPromptLine(nil) })
+	control := useRunControlForTest(t)
+
+	// The script runs out after q, which ends the listener like end of input.
+	control.listen()
+
+	if !control.paused || !control.stopped {
+		t.Fatalf("paused=%v stopped=%v, want both", control.paused, control.stopped)
+	}
+	if !strings.Contains(outputBuffer.String(), "Paused:") || !strings.Contains(outputBuffer.String(), "Stopping:") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+}
+
+func TestRunControlKeepsOtherLinesForTheTrustPrompt(t *testing.T) {
+	_, _ = captureWriters(t)
+	script := &scriptedPrompter{interactive: true, answers: []string{"no"}}
+	t.Cleanup(usePrompter(script))
+	t.Cleanup(func() { setPendingPromptLine(nil) })
+	originalTimeout := trustPromptTimeout
+	trustPromptTimeout = time.Millisecond
+	t.Cleanup(func() { trustPromptTimeout = originalTimeout })
+	control := useRunControlForTest(t)
+	listening := make(chan struct{})
+	go func() {
+		defer close(listening)
+		control.listen()
+	}()
+	t.Cleanup(func() {
+		close(control.done)
+		<-listening
+	})
+
+	// The operator answers before the prompt is up, so the listener reads it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		script.mu.Lock()
+		answered := len(script.answers) == 0
+		script.mu.Unlock()
+		if answered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not read the answer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	hostKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
+	trusted, err := promptTrustUnknownHost("app01:22", "known_hosts", hostKey)
+	if err != nil || trusted {
+		t.Fatalf("promptTrustUnknownHost() = %v, %v; want the host declined", trusted, err)
+	}
+	if control.paused || control.stopped {
+		t.Fatalf("the answer was taken as a run key: paused=%v stopped=%v", control.paused, control.stopped)
+	}
+}
+
+func TestExecuteRemoteOperationsSkipsHostsAfterStop(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	control := useRunControlForTest(t)
+	stubSSHDialHook(t, func(_, _ string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		client, cleanupClient := newInMemorySSHClient(t, config, func(string, string) (string, string, uint32) {
+			// The operator stops the run while the first host is running.
+			control.handleKey("q")
+			return authorizedKeyAddedMarker + "\n", "", 0
+		})
+		t.Cleanup(cleanupClient)
+		return client, nil
+	})
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	hosts := []string{"app01:22", "app02:22", "app03:22"}
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("password")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()} // #nosec G106 -- in-memory test server
+	hostRecaps, failedHosts := executeRemoteOperations(newHostConnections(), hosts, []remoteOperation{installKeyOperation{}},
+		func(string) *ssh.ClientConfig { return clientConfig },
+		func(host string) remoteOperationInput {
+			return remoteOperationInput{Host: host, User: "deploy", PublicKey: publicKey}
+		},
+	)
+
+	if failedHosts["app01:22"] || hostRecaps["app01:22"].changed != 1 {
+		t.Fatalf("running host did not finish: %+v", hostRecaps["app01:22"])
+	}
+	for _, host := range hosts[1:] {
+		if !failedHosts[host] || !errors.Is(hostRecaps[host].lastErr, errRunStopped) {
+			t.Fatalf("%s not stopped: %+v", host, hostRecaps[host])
+		}
+	}
+	if !strings.Contains(outputBuffer.String(), "skipping: [app03:22] => run stopped") {
+		t.Fatalf("output = %q", outputBuffer.String())
+	}
+	if exitCode := hostFailureExitCode(hosts, hostRecaps); exitCode != exitPartialFailure {
+		t.Fatalf("exit code = %d, want %d", exitCode, exitPartialFailure)
+	}
+}
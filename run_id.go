@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	activeRunIDMu sync.RWMutex
+	// activeRunID tags log lines, events and key comments with the run they
+	// belong to, so one fleet change can be traced across outputs.
+	activeRunID string
+
+	runIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,63}$`)
+)
+
+// setActiveRunID makes id the run ID of everything logged from now on. The
+// returned function clears it.
+func setActiveRunID(id string) func() {
+	activeRunIDMu.Lock()
+	activeRunID = id
+	activeRunIDMu.Unlock()
+	return func() {
+		activeRunIDMu.Lock()
+		activeRunID = ""
+		activeRunIDMu.Unlock()
+	}
+}
+
+func currentRunID() string {
+	activeRunIDMu.RLock()
+	defer activeRunIDMu.RUnlock()
+	return activeRunID
+}
+
+// resolveRunID returns the --run-id given by the caller, for example a CI job
+// ID, or a newly generated one.
+func resolveRunID(requestedID string) (string, error) {
+	trimmedID := strings.TrimSpace(requestedID)
+	if trimmedID == "" {
+		return newRunID(), nil
+	}
+	if !runIDPattern.MatchString(trimmedID) {
+		return "", fmt.Errorf("invalid --run-id %q: use up to 64 letters, digits, '.', '_', ':' or '-'", requestedID)
+	}
+	return trimmedID, nil
+}
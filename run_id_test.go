@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveRunID(t *testing.T) {
+	if runID, err := resolveRunID("  CHG-1234  "); err != nil || runID != "CHG-1234" {
+		t.Fatalf("resolveRunID(CHG-1234) = %q, %v", runID, err)
+	}
+	if runID, err := resolveRunID(""); err != nil || !strings.Contains(runID, "-") {
+		t.Fatalf("resolveRunID(\"\") = %q, %v, want a generated ID", runID, err)
+	}
+	for _, invalidID := range []string{"run id", "-leading-dash", "a;b", strings.Repeat("a", 65)} {
+		if _, err := resolveRunID(invalidID); err == nil {
+			t.Fatalf("resolveRunID(%q) error = nil", invalidID)
+		}
+	}
+}
+
+func TestTimestampedLineWriterTagsRunID(t *testing.T) {
+	var outputBuffer bytes.Buffer
+	timestampWriter := newTimestampedLineWriter(&outputBuffer)
+	timestampWriter.nowFunc = func() time.Time {
+		return time.Date(2026, time.February, 19, 9, 10, 11, 0, time.UTC)
+	}
+
+	restoreRunID := setActiveRunID("CHG-1234")
+	_, _ = timestampWriter.Write([]byte("during run\n"))
+	restoreRunID()
+	_, _ = timestampWriter.Write([]byte("after run\n"))
+
+	want := "[2026-02-19T09:10:11Z] [run CHG-1234] during run\n[2026-02-19T09:10:11Z] after run\n"
+	if got := outputBuffer.String(); got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+}
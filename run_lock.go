@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const runLockFilename = "run.lock"
+
+// runLockPath is --lock-file, or run.lock in the state directory, which
+// operators sharing an account on a jump host share too.
+func runLockPath(programOptions *options) (string, error) {
+	if path := strings.TrimSpace(programOptions.LockFile); path != "" {
+		expandedPath, err := expandHomePath(path)
+		if err != nil {
+			return "", fmt.Errorf("resolve lock file path: %w", err)
+		}
+		return expandedPath, nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create state directory: %w", err)
+	}
+	return filepath.Join(dir, runLockFilename), nil
+}
+
+// acquireRunLock takes the advisory lock on path without waiting, so a second
+// run fails at once instead of interleaving its known_hosts and log writes
+// with the first. The holder's pid, user, run ID and start time are written
+// into the file for the error the next run shows. The returned function
+// releases the lock; the file itself stays, since removing a lock file
+// races with a run that just opened it.
+func acquireRunLock(path string) (func(), error) {
+	// The file only names the holder, so it may be readable by others; a
+	// shared --lock-file of another account is locked read-only.
+	lockFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644) // #nosec G302 G304 -- lock path is explicit user input and holds no secrets
+	if errors.Is(err, fs.ErrPermission) {
+		lockFile, err = os.Open(path) // #nosec G304 -- lock path is explicit user input
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open run lock: %w", err)
+	}
+	locked, err := tryLockRunFile(lockFile)
+	if err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	if !locked {
+		holder, _ := io.ReadAll(io.LimitReader(lockFile, 512))
+		_ = lockFile.Close()
+		description := strings.TrimSpace(string(holder))
+		if description == "" {
+			description = "holder unknown"
+		}
+		return nil, fmt.Errorf("another run holds %s (%s); wait for it to finish or pass --ignore-lock", path, description)
+	}
+
+	holder := fmt.Sprintf("pid %d, user %s, run %s, since %s\n", os.Getpid(), currentLocalUser(), valueOrDash(currentRunID()), time.Now().UTC().Format(time.RFC3339))
+	if err := lockFile.Truncate(0); err == nil {
+		_, _ = lockFile.WriteAt([]byte(holder), 0)
+	}
+	return func() {
+		_ = lockFile.Truncate(0)
+		_ = unlockRunFile(lockFile)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// lockRun takes the run lock as its own task before the first connection,
+// unless --ignore-lock is set.
+func lockRun(programOptions *options) (func(), error) {
+	outputAnsibleTask("Acquire run lock")
+	if programOptions.IgnoreLock {
+		outputAnsibleHostStatus("skipping", "localhost", "--ignore-lock")
+		return func() {}, nil
+	}
+	path, err := runLockPath(programOptions)
+	if err != nil {
+		return nil, err
+	}
+	release, err := acquireRunLock(path)
+	if err != nil {
+		return nil, err
+	}
+	outputAnsibleHostStatus("ok", "localhost", path)
+	return release, nil
+}
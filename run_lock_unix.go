@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// tryLockRunFile takes an exclusive advisory lock without waiting and reports
+// false when another process holds it.
+func tryLockRunFile(fileHandle *os.File) (bool, error) {
+	err := unix.Flock(int(fileHandle.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockRunFile(fileHandle *os.File) error {
+	return unix.Flock(int(fileHandle.Fd()), unix.LOCK_UN)
+}
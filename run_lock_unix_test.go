@@ -0,0 +1,55 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquireRunLockRefusesASecondRun(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "run.lock")
+	defer setActiveRunID("run-1")()
+
+	release, err := acquireRunLock(lockPath)
+	if err != nil {
+		t.Fatalf("acquireRunLock() error = %v", err)
+	}
+	_, err = acquireRunLock(lockPath)
+	if err == nil || !strings.Contains(err.Error(), "another run holds "+lockPath) ||
+		!strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) || !strings.Contains(err.Error(), "run run-1") {
+		t.Fatalf("second acquireRunLock() error = %v, want the holder named", err)
+	}
+
+	release()
+	if content, _ := os.ReadFile(lockPath); len(content) != 0 {
+		t.Fatalf("lock file after release = %q, want it emptied", content)
+	}
+	releaseAgain, err := acquireRunLock(lockPath)
+	if err != nil {
+		t.Fatalf("acquireRunLock() after release error = %v", err)
+	}
+	releaseAgain()
+}
+
+func TestLockRunIgnoreLock(t *testing.T) {
+	captureWriters(t)
+	lockPath := filepath.Join(t.TempDir(), "run.lock")
+	release, err := acquireRunLock(lockPath)
+	if err != nil {
+		t.Fatalf("acquireRunLock() error = %v", err)
+	}
+	defer release()
+
+	if _, err := lockRun(&options{LockFile: lockPath}); err == nil || !strings.Contains(err.Error(), "--ignore-lock") {
+		t.Fatalf("lockRun() with the lock held error = %v", err)
+	}
+	unlock, err := lockRun(&options{LockFile: lockPath, IgnoreLock: true})
+	if err != nil {
+		t.Fatalf("lockRun(--ignore-lock) error = %v", err)
+	}
+	unlock()
+}
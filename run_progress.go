@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// etaWindow is how many of the latest host tasks the ETA averages over, so
+// it follows a run that speeds up or slows down.
+const etaWindow = 20
+
+// runProgress counts the host tasks (one operation on one host) of a run and
+// estimates the time left from the average duration of the latest ones.
+type runProgress struct {
+	total     int
+	done      int
+	durations []time.Duration
+}
+
+func newRunProgress(hosts, operations int) *runProgress {
+	return &runProgress{total: hosts * operations}
+}
+
+// finish counts one host task that took duration.
+func (progress *runProgress) finish(duration time.Duration) {
+	progress.done++
+	progress.durations = append(progress.durations, duration)
+	if len(progress.durations) > etaWindow {
+		progress.durations = progress.durations[1:]
+	}
+}
+
+// drop takes count host tasks out of the run, for a host that failed before
+// its remaining operations.
+func (progress *runProgress) drop(count int) {
+	progress.total -= count
+}
+
+func (progress *runProgress) remaining() int {
+	return progress.total - progress.done
+}
+
+// eta is the rolling average task duration times the tasks left; it is not
+// known before the first task finished.
+func (progress *runProgress) eta() (time.Duration, bool) {
+	if len(progress.durations) == 0 {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, duration := range progress.durations {
+		sum += duration
+	}
+	average := sum / time.Duration(len(progress.durations))
+	return average * time.Duration(progress.remaining()), true
+}
+
+// report shows the progress in the status area and emits a progress event.
+func (progress *runProgress) report() {
+	done, remaining := progress.done, progress.remaining()
+	event := runEvent{Event: "progress", Hosts: progress.total, Done: &done, Remaining: &remaining}
+	text := fmt.Sprintf("%d/%d host tasks done", progress.done, progress.total)
+	if eta, ok := progress.eta(); ok {
+		etaSeconds := int(eta.Round(time.Second).Seconds())
+		event.ETASeconds = &etaSeconds
+		text += fmt.Sprintf(", about %s left", eta.Round(time.Second))
+	}
+	reportStatusProgress(text)
+	emitEvent(event)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunProgressETAAveragesLatestTasks(t *testing.T) {
+	progress := newRunProgress(30, 2)
+	if _, ok := progress.eta(); ok {
+		t.Fatal("eta known before the first task finished")
+	}
+	for range etaWindow {
+		progress.finish(time.Minute)
+	}
+	// A host that fails its first operation skips the second one.
+	progress.drop(1)
+	for range 10 {
+		progress.finish(10 * time.Second)
+	}
+
+	if progress.remaining() != 29 {
+		t.Fatalf("remaining() = %d, want 29", progress.remaining())
+	}
+	// The window holds 10 one-minute tasks and 10 ten-second ones: 35s each.
+	if eta, _ := progress.eta(); eta != 29*35*time.Second {
+		t.Fatalf("eta() = %s, want %s", eta, 29*35*time.Second)
+	}
+}
+
+func TestRunProgressShowsETAInStatusArea(t *testing.T) {
+	line, _ := useStatusLineForTest(t)
+	progress := newRunProgress(3, 1)
+	progress.finish(90 * time.Second)
+	progress.report()
+
+	if line.progress != "1/3 host tasks done, about 3m0s left" {
+		t.Fatalf("progress = %q", line.progress)
+	}
+}
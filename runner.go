@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteExecutor runs operations on hosts and owns the connections it opens:
+// the built-in Go client (hostConnections) or the system ssh (opensshExecutor).
+type remoteExecutor interface {
+	runOperation(hostAddress string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig) (remoteOperationResult, error)
+	// connect logs in to hostAddress without running a command; later
+	// operations reuse the connection.
+	connect(hostAddress, userName string, clientConfig *ssh.ClientConfig) error
+	release(hostAddress string)
+	closeAll()
+}
+
+func newRemoteExecutor(programOptions *options) (remoteExecutor, error) {
+	var executor remoteExecutor
+	if programOptions.UseOpenSSH {
+		opensshExecutor, err := newOpenSSHExecutor(programOptions)
+		if err != nil {
+			return nil, err
+		}
+		executor = opensshExecutor
+	} else {
+		executor = newHostConnections()
+	}
+	fallbackUsers, err := parseFallbackUsers(programOptions.FallbackUsers)
+	if err != nil {
+		return nil, err
+	}
+	if len(fallbackUsers) > 0 {
+		executor = newFallbackUserExecutor(executor, fallbackUsers)
+	}
+	return executor, nil
+}
+
+// executeRemoteOperations runs each operation as an Ansible-style task across
+// hosts. A host that fails one operation is skipped for the remaining ones.
+// Each host is connected once; later operations reuse the connection. Once
+// the operator stops the run, hosts that have not started fail with
+// errRunStopped. Progress and the time left are reported after every host.
+func executeRemoteOperations(
+	executor remoteExecutor,
+	hosts []string,
+	operations []remoteOperation,
+	clientConfigForHost func(host string) *ssh.ClientConfig,
+	inputForHost func(host string) remoteOperationInput,
+) (map[string]hostRunRecap, map[string]bool) {
+	hostRecaps := make(map[string]hostRunRecap, len(hosts))
+	failedHosts := make(map[string]bool, len(hosts))
+	progress := newRunProgress(len(hosts), len(operations))
+	defer reportStatusProgress("")
+	for operationIndex, operation := range operations {
+		outputAnsibleTask(operation.Title())
+		pacer := &hostPacer{}
+		// Operations after this one that a failing host no longer runs.
+		laterOperations := len(operations) - operationIndex - 1
+		for _, host := range hosts {
+			if failedHosts[host] {
+				continue
+			}
+			if !runMayDispatch() {
+				outputAnsibleHostStatus("skipping", host, "run stopped")
+				recap := hostRecaps[host]
+				recap.failed++
+				recap.lastErr = errRunStopped
+				hostRecaps[host] = recap
+				failedHosts[host] = true
+				progress.drop(laterOperations + 1)
+				continue
+			}
+			startedAt := time.Now()
+			pacer.pause()
+
+			recap := hostRecaps[host]
+			if !runOperationOnHost(executor, host, operation, inputForHost(host), clientConfigForHost(host), &recap) {
+				failedHosts[host] = true
+				progress.drop(laterOperations)
+			}
+			hostRecaps[host] = recap
+			progress.finish(time.Since(startedAt))
+			progress.report()
+		}
+	}
+	return hostRecaps, failedHosts
+}
+
+// executeUserOperation runs operation once for each input, logging in to
+// input.Host as input.User, for the subcommands that work on host/user pairs
+// (apply, drift, expire). A host with several users runs them in rounds of
+// one user per host and is reconnected between rounds. Status lines name the
+// user, and inspect, when set, may rewrite a result before it is reported.
+// It returns the recap of every host and whether each input failed.
+func executeUserOperation(
+	executor remoteExecutor,
+	operation remoteOperation,
+	inputs []remoteOperationInput,
+	clientConfigForInput func(input remoteOperationInput) *ssh.ClientConfig,
+	inspect func(input remoteOperationInput, result remoteOperationResult) remoteOperationResult,
+) (map[string]hostRunRecap, []bool) {
+	hostRecaps := map[string]hostRunRecap{}
+	failedInputs := make([]bool, len(inputs))
+	labelled := &userLabelExecutor{remoteExecutor: executor, inspect: inspect}
+	ranOn := map[string]bool{}
+	remaining := make([]int, len(inputs))
+	for index := range inputs {
+		remaining[index] = index
+	}
+	for len(remaining) > 0 {
+		round := map[string]int{}
+		var roundHosts []string
+		var later []int
+		for _, index := range remaining {
+			host := inputs[index].Host
+			if _, taken := round[host]; taken {
+				later = append(later, index)
+				continue
+			}
+			round[host] = index
+			roundHosts = append(roundHosts, host)
+			if ranOn[host] {
+				// The open connection is logged in as the previous user.
+				executor.release(host)
+			}
+		}
+		roundRecaps, failedHosts := executeRemoteOperations(labelled, roundHosts, []remoteOperation{operation},
+			func(host string) *ssh.ClientConfig { return clientConfigForInput(inputs[round[host]]) },
+			func(host string) remoteOperationInput { return inputs[round[host]] },
+		)
+		for _, host := range roundHosts {
+			ranOn[host] = true
+			failedInputs[round[host]] = failedHosts[host]
+			recap, roundRecap := hostRecaps[host], roundRecaps[host]
+			recap.ok += roundRecap.ok
+			recap.changed += roundRecap.changed
+			recap.failed += roundRecap.failed
+			recap.duration += roundRecap.duration
+			if roundRecap.lastErr != nil {
+				recap.lastErr = roundRecap.lastErr
+			}
+			hostRecaps[host] = recap
+		}
+		remaining = later
+	}
+	return hostRecaps, failedInputs
+}
+
+// userLabelExecutor prefixes results and errors with input.User, since one
+// host may run an operation for several users, and lets the caller inspect
+// each result before it is reported.
+type userLabelExecutor struct {
+	remoteExecutor
+	inspect func(input remoteOperationInput, result remoteOperationResult) remoteOperationResult
+}
+
+func (executor *userLabelExecutor) runOperation(hostAddress string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig) (remoteOperationResult, error) {
+	result, err := executor.remoteExecutor.runOperation(hostAddress, operation, input, clientConfig)
+	if err != nil {
+		return remoteOperationResult{}, fmt.Errorf("%s: %w", input.User, err)
+	}
+	if executor.inspect != nil {
+		result = executor.inspect(input, result)
+	}
+	if result.Message == "" {
+		result.Message = input.User
+	} else {
+		result.Message = input.User + ": " + result.Message
+	}
+	return result, nil
+}
+
+// runOperationOnHost runs one operation on host, prints its status and adds
+// the outcome to recap. It reports whether the host succeeded; a failed host
+// has its connection released.
+func runOperationOnHost(executor remoteExecutor, host string, operation remoteOperation, input remoteOperationInput, clientConfig *ssh.ClientConfig, recap *hostRunRecap) bool {
+	emitEvent(runEvent{Event: "host_started", Host: host, Operation: operation.Name()})
+	endHostStatus := beginHostStatus(host, operation.Name())
+	startedAt := time.Now()
+	result, err := executor.runOperation(host, operation, input, clientConfig)
+	endHostStatus()
+	recap.duration += time.Since(startedAt)
+	if err != nil {
+		executor.release(host)
+		recap.failed++
+		recap.lastErr = err
+		outputAnsibleHostStatus("failed", host, err.Error())
+		outputFailureHint(err)
+		emitEvent(runEvent{Event: "host_failed", Host: host, Operation: operation.Name(), Error: err.Error()})
+		return false
+	}
+	emitOperationCompleted(host, operation, result)
+
+	recap.ok++
+	status := "ok"
+	if result.Changed {
+		recap.changed++
+		status = "changed"
+	}
+	outputAnsibleHostStatus(status, host, result.Message)
+	return true
+}
+
+func containsRemoteOperation(operations []remoteOperation, operationName string) bool {
+	for _, operation := range operations {
+		if operation.Name() == operationName {
+			return true
+		}
+	}
+	return false
+}
+
+func emitOperationCompleted(host string, operation remoteOperation, result remoteOperationResult) {
+	eventName := "operation_completed"
+	if operation.Name() == defaultRemoteOperationName && result.Changed {
+		eventName = "key_added"
+	}
+	changed := result.Changed
+	emitEvent(runEvent{Event: eventName, Host: host, Operation: operation.Name(), Changed: &changed, Message: result.Message})
+}
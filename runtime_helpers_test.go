@@ -31,6 +31,8 @@ func setCommandLineForTest(t *testing.T, args []string) {
 	os.Args = append([]string(nil), args...)
 	flag.CommandLine = flag.NewFlagSet(args[0], flag.ContinueOnError)
 	flag.CommandLine.SetOutput(io.Discard)
+	// Runs save themselves for --again; keep that out of the real state dir.
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
 
 	t.Cleanup(func() {
 		os.Args = originalArgs
@@ -56,44 +58,16 @@ func captureWriters(t *testing.T) (*bytes.Buffer, *bytes.Buffer) {
 	return outputBuffer, errorBuffer
 }
 
-func stubPromptPasswordHooks(
-	t *testing.T,
-	isTerminalStub func(*os.File) bool,
-	readPasswordStub func(*os.File) ([]byte, error),
-) {
-	t.Helper()
-
-	originalIsTerminal := isTerminalForPasswordPrompt
-	originalReadPassword := readPasswordForPrompt
-	isTerminalForPasswordPrompt = isTerminalStub
-	readPasswordForPrompt = readPasswordStub
-
-	t.Cleanup(func() {
-		isTerminalForPasswordPrompt = originalIsTerminal
-		readPasswordForPrompt = originalReadPassword
-	})
+// capturedRuntimeIO runs the program against the writers captureWriters
+// installed, so run's output lands in the test's buffers.
+func capturedRuntimeIO() runtimeIO {
+	return runtimeIO{Stdin: os.Stdin, Stdout: getStandardOutputWriter(), Stderr: getStandardErrorWriter()}
 }
 
-func stubTrustPromptHooks(
-	t *testing.T,
-	isTerminalStub func(*os.File) bool,
-	promptLineStub func(*bufio.Reader, string) (string, error),
-	promptWithTimeoutStub func(*bufio.Reader, string, time.Duration) (string, bool, error),
-) {
+// stubPrompter makes next the active prompter for the rest of the test.
+func stubPrompter(t *testing.T, next prompter) {
 	t.Helper()
-
-	originalIsTerminal := isTerminalForTrustPrompt
-	originalPromptLine := promptLineForTrustPrompt
-	originalPromptLineWithTimeout := promptLineForTrustPromptWithTimeout
-	isTerminalForTrustPrompt = isTerminalStub
-	promptLineForTrustPrompt = promptLineStub
-	promptLineForTrustPromptWithTimeout = promptWithTimeoutStub
-
-	t.Cleanup(func() {
-		isTerminalForTrustPrompt = originalIsTerminal
-		promptLineForTrustPrompt = originalPromptLine
-		promptLineForTrustPromptWithTimeout = originalPromptLineWithTimeout
-	})
+	t.Cleanup(usePrompter(next))
 }
 
 func stubSSHDialHook(
@@ -290,7 +264,7 @@ func TestNormalizeHelpArg(t *testing.T) {
 func TestRunReturnsStatusErrorForParseFailure(t *testing.T) {
 	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "extra"})
 
-	err := run()
+	err := run(capturedRuntimeIO())
 	if err == nil {
 		t.Fatalf("expected run() error")
 	}
@@ -327,7 +301,7 @@ func TestRunReturnsHostFailureWhenSSHDialFails(t *testing.T) {
 
 	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath})
 
-	err := run()
+	err := run(capturedRuntimeIO())
 	if err == nil {
 		t.Fatalf("expected run() error")
 	}
@@ -336,8 +310,8 @@ func TestRunReturnsHostFailureWhenSSHDialFails(t *testing.T) {
 	if !errors.As(err, &statusErr) {
 		t.Fatalf("run() error type = %T, want *statusError", err)
 	}
-	if statusErr.code != 1 {
-		t.Fatalf("statusErr.code = %d, want %d", statusErr.code, 1)
+	if statusErr.code != exitNetworkFailure {
+		t.Fatalf("statusErr.code = %d, want %d", statusErr.code, exitNetworkFailure)
 	}
 	if !strings.Contains(statusErr.Error(), "1 host(s) failed") {
 		t.Fatalf("unexpected run() error: %v", statusErr)
@@ -491,11 +465,7 @@ func TestPromptPasswordReadsFromReaderWhenNotTerminal(t *testing.T) {
 
 func TestPromptPasswordUsesTerminalReadPasswordWhenAvailable(t *testing.T) {
 	outputBuffer, _ := captureWriters(t)
-	stubPromptPasswordHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(*os.File) ([]byte, error) { return []byte("terminal-secret"), nil },
-	)
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"terminal-secret"}})
 
 	value, err := promptPassword(bufio.NewReader(strings.NewReader("unused")), os.Stdin, "SSH password: ")
 	if err != nil {
@@ -510,13 +480,27 @@ func TestPromptPasswordUsesTerminalReadPasswordWhenAvailable(t *testing.T) {
 	}
 }
 
+func TestFillMissingPasswordConfirmRetriesOnMismatch(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"first-try", "first-tyr", "second", "second"}})
+
+	programOptions := &options{ConfirmPassword: true}
+	if err := fillMissingPassword(bufio.NewReader(strings.NewReader("")), programOptions); err != nil {
+		t.Fatalf("fillMissingPassword() error = %v", err)
+	}
+	if programOptions.Password != "second" {
+		t.Fatalf("password = %q, want %q", programOptions.Password, "second")
+	}
+
+	output := outputBuffer.String()
+	if strings.Count(output, "Confirm SSH password: ") != 2 || strings.Count(output, "Passwords do not match.") != 1 {
+		t.Fatalf("unexpected confirmation output: %q", output)
+	}
+}
+
 func TestPromptPasswordTerminalReadError(t *testing.T) {
 	outputBuffer, _ := captureWriters(t)
-	stubPromptPasswordHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(*os.File) ([]byte, error) { return nil, errors.New("terminal read failed") },
-	)
+	stubPrompter(t, &scriptedPrompter{interactive: true, err: errors.New("terminal read failed")})
 
 	_, err := promptPassword(bufio.NewReader(strings.NewReader("unused")), os.Stdin, "SSH password: ")
 	if err == nil {
@@ -550,11 +534,7 @@ func TestPromptPasswordReturnsReaderErrorWhenNotTerminal(t *testing.T) {
 
 func TestPromptPasswordReturnsEOFWhenNotTerminalAndNoInput(t *testing.T) {
 	captureWriters(t)
-	stubPromptPasswordHooks(
-		t,
-		func(*os.File) bool { return false },
-		func(*os.File) ([]byte, error) { return nil, nil },
-	)
+	stubPrompter(t, &scriptedPrompter{})
 
 	reader := bufio.NewReader(strings.NewReader(""))
 	_, err := promptPassword(reader, os.Stdin, "SSH password: ")
@@ -572,7 +552,7 @@ func TestFillMissingInputsPopulatesEmptyFields(t *testing.T) {
 	reader := bufio.NewReader(strings.NewReader("deploy\nssh-pass\nhost1,host2\nssh-ed25519 AAAATEST\n"))
 	programOptions := &options{}
 
-	if err := fillMissingInputs(reader, programOptions); err != nil {
+	if err := fillMissingInputs(reader, programOptions, true); err != nil {
 		t.Fatalf("fillMissingInputs() error = %v", err)
 	}
 	if programOptions.User != "deploy" {
@@ -593,7 +573,7 @@ func TestFillMissingInputsPropagatesPromptError(t *testing.T) {
 	captureWriters(t)
 	reader := bufio.NewReader(errReader{})
 
-	err := fillMissingInputs(reader, &options{})
+	err := fillMissingInputs(reader, &options{}, true)
 	if err == nil {
 		t.Fatalf("expected fillMissingInputs() error")
 	}
@@ -609,7 +589,7 @@ func TestFillMissingInputsReturnsEOFForMissingRequiredInput(t *testing.T) {
 	captureWriters(t)
 	reader := bufio.NewReader(strings.NewReader(""))
 
-	err := fillMissingInputs(reader, &options{})
+	err := fillMissingInputs(reader, &options{}, true)
 	if err == nil {
 		t.Fatalf("expected fillMissingInputs() EOF-derived error")
 	}
@@ -629,7 +609,7 @@ func TestFillMissingInputsSkipsAlreadySetFields(t *testing.T) {
 		KeyInput: "ssh-ed25519 AAAAEXISTING",
 	}
 
-	if err := fillMissingInputs(reader, programOptions); err != nil {
+	if err := fillMissingInputs(reader, programOptions, true); err != nil {
 		t.Fatalf("fillMissingInputs() error = %v", err)
 	}
 	if outputBuffer.Len() != 0 {
@@ -669,11 +649,7 @@ func TestValidateOptionsAdditionalErrorPaths(t *testing.T) {
 	})
 
 	t.Run("local provider requires password in non-interactive mode", func(t *testing.T) {
-		stubPromptPasswordHooks(
-			t,
-			func(*os.File) bool { return false },
-			func(*os.File) ([]byte, error) { return nil, errors.New("unexpected password read") },
-		)
+		stubPrompter(t, &scriptedPrompter{err: errors.New("unexpected password read")})
 		t.Setenv("PASSWORD", "")
 
 		opts := &options{Port: 22, TimeoutSec: 10, PasswordProvider: "local"}
@@ -851,13 +827,8 @@ func TestOutputWritersAndCommandOutputWriter(t *testing.T) {
 	}
 }
 
-func TestSetupRunLogFileCreatesLogAndRestoresWriters(t *testing.T) {
-	originalOutput := standardOutputWriter
-	originalError := standardErrorWriter
-	t.Cleanup(func() {
-		standardOutputWriter = originalOutput
-		standardErrorWriter = originalError
-	})
+func TestOpenRunLogFileReceivesTimestampedRunOutput(t *testing.T) {
+	outputBuffer, errorBuffer := captureWriters(t)
 
 	executablePath, err := os.Executable()
 	if err != nil {
@@ -865,24 +836,30 @@ func TestSetupRunLogFileCreatesLogAndRestoresWriters(t *testing.T) {
 	}
 
 	logName := "ssh-key-bootstrap-test-" + strings.ReplaceAll(t.Name(), "/", "-")
-	logPath := filepath.Join(filepath.Dir(executablePath), logName+".log")
-	_ = os.Remove(logPath)
-	t.Cleanup(func() { _ = os.Remove(logPath) })
+	_ = os.Remove(filepath.Join(filepath.Dir(executablePath), logName+".log"))
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	logPath := filepath.Join(stateHome, appName, logName+".log")
 
-	cleanupRunLog, err := setupRunLogFile(logName)
+	runLog, closeRunLog, err := openRunLogFile(logName)
 	if err != nil {
-		t.Skipf("setupRunLogFile() could not create log in this environment: %v", err)
+		t.Skipf("openRunLogFile() could not create log in this environment: %v", err)
 	}
 
+	restoreRuntimeIO := configureRuntimeIO(runtimeIO{Stdin: os.Stdin, Stdout: outputBuffer, Stderr: errorBuffer, RunLog: runLog})
 	outputPrintln("log-line-out")
 	errorPrintln("log-line-err")
-	cleanupRunLog()
+	restoreRuntimeIO()
+	closeRunLog()
 
-	if standardOutputWriter != os.Stdout {
-		t.Fatalf("standardOutputWriter not restored to os.Stdout")
+	if getStandardOutputWriter() != outputBuffer || getStandardErrorWriter() != errorBuffer {
+		t.Fatalf("standard writers not restored after the run")
+	}
+	if runLogWriter != nil {
+		t.Fatalf("runLogWriter not restored after the run")
 	}
-	if standardErrorWriter != os.Stderr {
-		t.Fatalf("standardErrorWriter not restored to os.Stderr")
+	if !strings.Contains(outputBuffer.String(), "log-line-out") || !strings.Contains(errorBuffer.String(), "log-line-err") {
+		t.Fatalf("output = %q, errors = %q", outputBuffer.String(), errorBuffer.String())
 	}
 
 	logBytes, readErr := os.ReadFile(logPath)
@@ -996,12 +973,7 @@ func TestBuildSSHConfigKnownHostsPathError(t *testing.T) {
 }
 
 func TestPromptTrustUnknownHostNonInteractive(t *testing.T) {
-	stubTrustPromptHooks(
-		t,
-		func(*os.File) bool { return false },
-		func(*bufio.Reader, string) (string, error) { return "", nil },
-		func(*bufio.Reader, string, time.Duration) (string, bool, error) { return "", false, nil },
-	)
+	stubPrompter(t, &scriptedPrompter{err: errors.New("unexpected trust prompt")})
 
 	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
 	trustHost, err := promptTrustUnknownHost("example.com:22", "/tmp/known_hosts", hostPublicKey)
@@ -1015,25 +987,8 @@ func TestPromptTrustUnknownHostNonInteractive(t *testing.T) {
 
 func TestPromptTrustUnknownHostInteractiveYesAfterRetry(t *testing.T) {
 	outputBuffer, _ := captureWriters(t)
-	answers := []string{"maybe", "yes"}
-	answerIndex := 0
-
-	stubTrustPromptHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(_ *bufio.Reader, label string) (string, error) {
-			if !strings.Contains(label, "Trust this host and add it to /tmp/known_hosts?") {
-				t.Fatalf("unexpected prompt label: %q", label)
-			}
-			answer := answers[answerIndex]
-			answerIndex++
-			return answer, nil
-		},
-		func(reader *bufio.Reader, label string, _ time.Duration) (string, bool, error) {
-			answer, err := promptLineForTrustPrompt(reader, label)
-			return answer, false, err
-		},
-	)
+	script := &scriptedPrompter{interactive: true, answers: []string{"maybe", "yes"}}
+	stubPrompter(t, script)
 
 	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
 	trustHost, err := promptTrustUnknownHost("example.com:22", "/tmp/known_hosts", hostPublicKey)
@@ -1043,8 +998,8 @@ func TestPromptTrustUnknownHostInteractiveYesAfterRetry(t *testing.T) {
 	if !trustHost {
 		t.Fatalf("expected trustHost=true")
 	}
-	if answerIndex != 2 {
-		t.Fatalf("prompt attempts = %d, want 2", answerIndex)
+	if len(script.labels) != 2 || !strings.Contains(script.labels[0], "Trust this host and add it to /tmp/known_hosts?") {
+		t.Fatalf("prompt labels = %q, want two trust prompts", script.labels)
 	}
 
 	output := outputBuffer.String()
@@ -1057,15 +1012,7 @@ func TestPromptTrustUnknownHostInteractiveYesAfterRetry(t *testing.T) {
 }
 
 func TestPromptTrustUnknownHostInteractiveNo(t *testing.T) {
-	stubTrustPromptHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(*bufio.Reader, string) (string, error) { return "n", nil },
-		func(reader *bufio.Reader, label string, _ time.Duration) (string, bool, error) {
-			answer, err := promptLineForTrustPrompt(reader, label)
-			return answer, false, err
-		},
-	)
+	stubPrompter(t, &scriptedPrompter{interactive: true, answers: []string{"n"}})
 
 	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
 	trustHost, err := promptTrustUnknownHost("example.com:22", "/tmp/known_hosts", hostPublicKey)
@@ -1080,12 +1027,7 @@ func TestPromptTrustUnknownHostInteractiveNo(t *testing.T) {
 func TestPromptTrustUnknownHostInteractiveTimeoutDefaultsYes(t *testing.T) {
 	outputBuffer, _ := captureWriters(t)
 
-	stubTrustPromptHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(*bufio.Reader, string) (string, error) { return "", nil },
-		func(*bufio.Reader, string, time.Duration) (string, bool, error) { return "", true, nil },
-	)
+	stubPrompter(t, &scriptedPrompter{interactive: true})
 
 	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
 	trustHost, err := promptTrustUnknownHost("example.com:22", "/tmp/known_hosts", hostPublicKey)
@@ -1101,15 +1043,7 @@ func TestPromptTrustUnknownHostInteractiveTimeoutDefaultsYes(t *testing.T) {
 }
 
 func TestPromptTrustUnknownHostPromptError(t *testing.T) {
-	stubTrustPromptHooks(
-		t,
-		func(*os.File) bool { return true },
-		func(*bufio.Reader, string) (string, error) { return "", errors.New("prompt failed") },
-		func(reader *bufio.Reader, label string, _ time.Duration) (string, bool, error) {
-			answer, err := promptLineForTrustPrompt(reader, label)
-			return answer, false, err
-		},
-	)
+	stubPrompter(t, &scriptedPrompter{interactive: true, err: errors.New("prompt failed")})
 
 	hostPublicKey := parsePublicKeyFromAuthorizedLine(t, generateTestKey(t))
 	_, err := promptTrustUnknownHost("example.com:22", "/tmp/known_hosts", hostPublicKey)
@@ -1309,7 +1243,7 @@ func TestAddAuthorizedKeyWithStatusSuccess(t *testing.T) {
 		client, cleanupClient := newInMemorySSHClient(t, config, func(command, stdin string) (string, string, uint32) {
 			capturedCommand = command
 			capturedStdin = stdin
-			return "", "", 0
+			return authorizedKeyAddedMarker + "\n", "", 0
 		})
 		t.Cleanup(cleanupClient)
 		return client, nil
@@ -1324,7 +1258,11 @@ func TestAddAuthorizedKeyWithStatusSuccess(t *testing.T) {
 		t.Fatalf("addAuthorizedKeyWithStatus() error = %v", err)
 	}
 
-	if capturedCommand != normalizeLF(addAuthorizedKeyScript) {
+	script, err := installKeyOperation{}.Script(remoteOperationInput{PublicKey: publicKey})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	if capturedCommand != withRemoteHome(normalizeLF(script.Command), false) {
 		t.Fatalf("unexpected remote command:\n%q", capturedCommand)
 	}
 	if capturedStdin != publicKey+"\n" {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// runtimeIO is everything a run reads from and writes to. main passes the
+// process's own streams and the run log; a program embedding the tool, or an
+// end-to-end test, passes buffers and a scripted prompter and runs the whole
+// program in-process. The interactive shell and hardware key PIN prompts
+// still use the process's terminal, since they hand it to another program.
+type runtimeIO struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// Prompter asks the operator; nil asks on Stdin when it is a terminal.
+	Prompter prompter
+	// RunLog receives a timestamped copy of Stdout and Stderr; nil keeps no log.
+	RunLog io.Writer
+}
+
+func processRuntimeIO() runtimeIO {
+	return runtimeIO{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+var (
+	activeRuntimeIOMu sync.RWMutex
+	activeRuntimeIO   = processRuntimeIO()
+)
+
+// configureRuntimeIO makes runtime the program's I/O and returns the function
+// that flushes its run log and puts the previous I/O back.
+func configureRuntimeIO(runtime runtimeIO) func() {
+	activeRuntimeIOMu.Lock()
+	previousRuntime := activeRuntimeIO
+	activeRuntimeIO = runtime
+	activeRuntimeIOMu.Unlock()
+	previousOutput, previousError := getStandardOutputWriter(), getStandardErrorWriter()
+	previousRunLog := runLogWriter
+
+	outputWriter, errorWriter := runtime.Stdout, runtime.Stderr
+	var timestampedLogWriter *timestampedLineWriter
+	runLogWriter = nil
+	if runtime.RunLog != nil {
+		timestampedLogWriter = newTimestampedLineWriter(runtime.RunLog)
+		outputWriter = io.MultiWriter(outputWriter, timestampedLogWriter)
+		errorWriter = io.MultiWriter(errorWriter, timestampedLogWriter)
+		runLogWriter = timestampedLogWriter
+	}
+	setStandardWriters(outputWriter, errorWriter)
+	resetTrustPromptReader()
+	restorePrompter := func() {}
+	if runtime.Prompter != nil {
+		restorePrompter = usePrompter(runtime.Prompter)
+	}
+
+	return func() {
+		restorePrompter()
+		resetTrustPromptReader()
+		setStandardWriters(previousOutput, previousError)
+		runLogWriter = previousRunLog
+		if timestampedLogWriter != nil {
+			_ = timestampedLogWriter.Close()
+		}
+		activeRuntimeIOMu.Lock()
+		activeRuntimeIO = previousRuntime
+		activeRuntimeIOMu.Unlock()
+	}
+}
+
+func standardInput() io.Reader {
+	activeRuntimeIOMu.RLock()
+	defer activeRuntimeIOMu.RUnlock()
+	return activeRuntimeIO.Stdin
+}
+
+// newStandardInputReader is a buffered reader over the run's stdin.
+func newStandardInputReader() *bufio.Reader {
+	return bufio.NewReader(standardInput())
+}
+
+// standardInputFile is the run's stdin when it is a file, for terminal
+// checks and password reads without echo, and nil otherwise.
+func standardInputFile() *os.File {
+	inputFile, _ := standardInput().(*os.File)
+	return inputFile
+}
+
+// standardOutputFile is the run's stdout when it is a file, and nil otherwise.
+func standardOutputFile() *os.File {
+	activeRuntimeIOMu.RLock()
+	defer activeRuntimeIOMu.RUnlock()
+	outputFile, _ := activeRuntimeIO.Stdout.(*os.File)
+	return outputFile
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestRunInProcessWithInjectedRuntimeIO(t *testing.T) {
+	stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("--plan must not connect to any host")
+		return nil, nil
+	})
+	processOutput, processErrors := getStandardOutputWriter(), getStandardErrorWriter()
+
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := "USER=deploy\nKEY='" + publicKey + "'\n"
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+
+	var outputBuffer, errorBuffer, runLog bytes.Buffer
+	script := &scriptedPrompter{answers: []string{"secret", "app01,app02"}}
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", dotEnvPath, "--plan", "json"})
+	err := run(runtimeIO{Stdin: strings.NewReader(""), Stdout: &outputBuffer, Stderr: &errorBuffer, Prompter: script, RunLog: &runLog})
+	if err != nil {
+		t.Fatalf("run() error = %v\n%s", err, errorBuffer.String())
+	}
+
+	var plan runPlan
+	if err := json.Unmarshal(outputBuffer.Bytes(), &plan); err != nil {
+		t.Fatalf("stdout is not a JSON plan: %v\n%s", err, outputBuffer.String())
+	}
+	if len(plan.Hosts) != 2 || plan.Hosts[0].Host != "app01:22" || plan.Hosts[1].Host != "app02:22" {
+		t.Fatalf("plan hosts = %+v, want the servers answered at the prompt", plan.Hosts)
+	}
+	if len(script.labels) == 0 {
+		t.Fatalf("the injected prompter was not asked for the servers")
+	}
+	if !strings.Contains(runLog.String(), "TASK [Resolve target hosts]") || !strings.Contains(runLog.String(), `"hosts"`) {
+		t.Fatalf("run log is missing the run's output: %q", runLog.String())
+	}
+	if getStandardOutputWriter() != processOutput || getStandardErrorWriter() != processErrors || currentPrompter() == prompter(script) {
+		t.Fatalf("run did not put the previous I/O back")
+	}
+}
+
+func TestRunPrintsErrorToInjectedStderr(t *testing.T) {
+	var outputBuffer, errorBuffer, runLog bytes.Buffer
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--port", "0"})
+	err := run(runtimeIO{Stdin: strings.NewReader(""), Stdout: &outputBuffer, Stderr: &errorBuffer, Prompter: &scriptedPrompter{}, RunLog: &runLog})
+	if err == nil || exitCodeOf(err) != exitConfigError {
+		t.Fatalf("run(--port 0) error = %v, want a config error", err)
+	}
+	if !strings.Contains(errorBuffer.String(), "Error: ") || !strings.Contains(runLog.String(), "Error: ") {
+		t.Fatalf("error was not printed to the injected stderr and run log: stderr %q, log %q", errorBuffer.String(), runLog.String())
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// scanXMLHost is the part of an nmap <host> element --nmap-xml reads.
+// masscan writes the same format, one <host> per open port and without
+// <status> or <hostnames>.
+type scanXMLHost struct {
+	Status struct {
+		State string `xml:"state,attr"`
+	} `xml:"status"`
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Hostnames []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"hostnames>hostname"`
+	Ports []scanXMLPort `xml:"ports>port"`
+}
+
+type scanXMLPort struct {
+	Protocol string `xml:"protocol,attr"`
+	PortID   string `xml:"portid,attr"`
+	State    struct {
+		State string `xml:"state,attr"`
+	} `xml:"state"`
+}
+
+// readScanXML reads an nmap or masscan XML report (--nmap-xml) and returns
+// every host that has the given TCP port open.
+func readScanXML(path string, port int) ([]string, error) {
+	expandedPath, err := expandHomePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolve scan report path: %w", err)
+	}
+	scanFile, err := os.Open(expandedPath) // #nosec G304 -- scan report path is explicit user input
+	if err != nil {
+		return nil, fmt.Errorf("open scan report: %w", err)
+	}
+	defer scanFile.Close()
+
+	entries, err := parseScanXML(scanFile, port)
+	if err != nil {
+		return nil, fmt.Errorf("read scan report %q: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseScanXML returns the hosts with the given TCP port open, in report
+// order and without repeats. A host is named as it was given to the scanner
+// (nmap's "user" hostname) when it has one, and by its IP address otherwise;
+// reverse DNS names are not used. The report is read host by host, so one cut
+// short by an interrupted scan still yields the hosts written so far.
+func parseScanXML(reader io.Reader, port int) ([]string, error) {
+	wantPort := strconv.Itoa(port)
+	decoder := xml.NewDecoder(reader)
+	var entries []string
+	sawRoot := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF || (sawRoot && scanXMLCutShort(err)) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !sawRoot {
+			if element.Name.Local != "nmaprun" {
+				return nil, fmt.Errorf("not an nmap or masscan XML report (root element <%s>)", element.Name.Local)
+			}
+			sawRoot = true
+			continue
+		}
+		if element.Name.Local != "host" {
+			continue
+		}
+		var host scanXMLHost
+		if err := decoder.DecodeElement(&host, &element); err != nil {
+			if scanXMLCutShort(err) {
+				break
+			}
+			return nil, err
+		}
+		if host.Status.State != "" && host.Status.State != "up" {
+			continue
+		}
+		if !slices.ContainsFunc(host.Ports, func(scanPort scanXMLPort) bool {
+			return scanPort.Protocol == "tcp" && scanPort.PortID == wantPort && scanPort.State.State == "open"
+		}) {
+			continue
+		}
+		if name := host.targetName(); name != "" && !slices.Contains(entries, name) {
+			entries = append(entries, name)
+		}
+	}
+	if !sawRoot {
+		return nil, errors.New("empty scan report")
+	}
+	return entries, nil
+}
+
+// scanXMLCutShort reports whether err means the report ends mid-document.
+func scanXMLCutShort(err error) bool {
+	if syntaxErr, ok := errors.AsType[*xml.SyntaxError](err); ok {
+		return syntaxErr.Msg == "unexpected EOF"
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (host scanXMLHost) targetName() string {
+	for _, hostname := range host.Hostnames {
+		if hostname.Type == "user" && strings.TrimSpace(hostname.Name) != "" {
+			return strings.TrimSpace(hostname.Name)
+		}
+	}
+	for _, address := range host.Addresses {
+		if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+			return address.Addr
+		}
+	}
+	return ""
+}
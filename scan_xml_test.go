@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const nmapScanReport = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap" args="nmap -p 22,2222 -oX scan.xml app01.example.com 10.0.0.0/24">
+<host><status state="up" reason="syn-ack"/>
+<address addr="10.0.0.11" addrtype="ipv4"/>
+<hostnames><hostname name="app01.example.com" type="user"/><hostname name="app01.example.com" type="PTR"/></hostnames>
+<ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/></port></ports>
+</host>
+<host><status state="up" reason="arp-response"/>
+<address addr="10.0.0.12" addrtype="ipv4"/><address addr="52:54:00:12:34:56" addrtype="mac"/>
+<hostnames><hostname name="printer.lan" type="PTR"/></hostnames>
+<ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/></port></ports>
+</host>
+<host><status state="up" reason="syn-ack"/>
+<address addr="10.0.0.13" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="22"><state state="closed" reason="reset"/></port><port protocol="tcp" portid="2222"><state state="open" reason="syn-ack"/></port></ports>
+</host>
+<host><status state="down" reason="no-response"/>
+<address addr="10.0.0.14" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="22"><state state="open"/></port></ports>
+</host>
+</nmaprun>
+`
+
+// masscan writes one <host> per open port, without <status> or <hostnames>.
+const masscanScanReport = `<?xml version="1.0"?>
+<nmaprun scanner="masscan" start="1760000000" version="1.0-BETA">
+<host endtime="1760000001"><address addr="10.0.1.5" addrtype="ipv4"/><ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1760000001"><address addr="fd00::6" addrtype="ipv6"/><ports><port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1760000002"><address addr="10.0.1.5" addrtype="ipv4"/><ports><port protocol="tcp" portid="80"><state state="open" reason="syn-ack" reason_ttl="64"/></port></ports></host>
+<host endtime="1760000002"><address addr="10.0.1.7" addrtype="ipv4"/><ports><port protocol="udp" portid="22"><state state="open" reason="udp-response" reason_ttl="64"/></port></ports></host>
+<runstats><finished time="1760000003" timestr="2025-10-09 10:00:03" elapsed="3"/></runstats>
+</nmaprun>
+`
+
+func TestParseScanXMLKeepsOpenSSHPorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		report string
+		port   int
+		want   []string
+	}{
+		{name: "nmap", report: nmapScanReport, port: 22, want: []string{"app01.example.com", "10.0.0.12"}},
+		{name: "nmap other port", report: nmapScanReport, port: 2222, want: []string{"10.0.0.13"}},
+		{name: "masscan", report: masscanScanReport, port: 22, want: []string{"10.0.1.5", "fd00::6"}},
+		{name: "interrupted scan", report: nmapScanReport[:strings.Index(nmapScanReport, "10.0.0.13")], port: 22, want: []string{"app01.example.com", "10.0.0.12"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := parseScanXML(strings.NewReader(test.report), test.port)
+			if err != nil {
+				t.Fatalf("parseScanXML() error = %v", err)
+			}
+			if !slices.Equal(entries, test.want) {
+				t.Fatalf("entries = %q, want %q", entries, test.want)
+			}
+		})
+	}
+}
+
+func TestParseScanXMLRejectsOtherDocuments(t *testing.T) {
+	for _, report := range []string{"", `<?xml version="1.0"?><config><host/></config>`, "10.0.0.1\n10.0.0.2\n"} {
+		if _, err := parseScanXML(strings.NewReader(report), 22); err == nil {
+			t.Fatalf("parseScanXML(%q) error = nil, want error", report)
+		}
+	}
+}
+
+func TestReadScanXMLTargetsResolveWithServers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.xml")
+	if err := os.WriteFile(path, []byte(masscanScanReport), 0o600); err != nil {
+		t.Fatalf("write scan report: %v", err)
+	}
+	entries, err := readScanXML(path, 22)
+	if err != nil {
+		t.Fatalf("readScanXML() error = %v", err)
+	}
+
+	programOptions := &options{Servers: "db01", NmapXML: path, Port: 22}
+	hosts, _, err := resolveTargetHosts(programOptions, entries)
+	if err != nil {
+		t.Fatalf("resolveTargetHosts() error = %v", err)
+	}
+	if want := []string{"10.0.1.5:22", "[fd00::6]:22", "db01:22"}; !slices.Equal(hosts, want) {
+		t.Fatalf("hosts = %q, want %q", hosts, want)
+	}
+}
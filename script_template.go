@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// remoteScriptData is what a remote script template can refer to. Values
+// that end up in the shell must go through shquote; key material is better
+// sent on stdin than rendered into the command line.
+type remoteScriptData struct {
+	Host              string
+	User              string
+	Key               string
+	Keys              []string
+	ReplaceKeyComment bool
+	// Vars holds operation-specific values, such as the result markers the
+	// script prints.
+	Vars map[string]string
+}
+
+// remoteScriptFuncs are the helper functions available to script templates.
+// Like sprig, the piped value is the last argument: {{ .User | default "root" }}.
+var remoteScriptFuncs = template.FuncMap{
+	"shquote": shellQuote,
+	"shquoteAll": func(values []string) string {
+		quoted := make([]string, len(values))
+		for index, value := range values {
+			quoted[index] = shellQuote(value)
+		}
+		return strings.Join(quoted, " ")
+	},
+	"default": func(fallback, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return fallback
+		}
+		return value
+	},
+	"join":      func(separator string, values []string) string { return strings.Join(values, separator) },
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, replacement, value string) string { return strings.ReplaceAll(value, old, replacement) },
+	"contains":  func(substring, value string) bool { return strings.Contains(value, substring) },
+	"hasPrefix": func(prefix, value string) bool { return strings.HasPrefix(value, prefix) },
+}
+
+// parseRemoteScriptTemplate parses a built-in script template; a broken one
+// is a programming error. Referring to a missing Vars entry fails rendering.
+func parseRemoteScriptTemplate(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(remoteScriptFuncs).Option("missingkey=error").Parse(text))
+}
+
+func remoteScriptDataFor(input remoteOperationInput, vars map[string]string) remoteScriptData {
+	keys := make([]string, 0, 1+len(input.ExtraPublicKeys))
+	if strings.TrimSpace(input.PublicKey) != "" {
+		keys = append(keys, input.PublicKey)
+	}
+	keys = append(keys, input.ExtraPublicKeys...)
+	return remoteScriptData{
+		Host:              input.Host,
+		User:              input.User,
+		Key:               input.PublicKey,
+		Keys:              keys,
+		ReplaceKeyComment: input.ReplaceKeyComment,
+		Vars:              vars,
+	}
+}
+
+func renderRemoteScript(scriptTemplate *template.Template, data remoteScriptData) (string, error) {
+	var script strings.Builder
+	if err := scriptTemplate.Execute(&script, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", scriptTemplate.Name(), err)
+	}
+	return script.String(), nil
+}
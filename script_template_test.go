@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderRemoteScriptHelpers(t *testing.T) {
+	scriptTemplate := parseRemoteScriptTemplate("test", `id {{ .User | default "root" | shquote }}; for k in {{ shquoteAll .Keys }}; do :; done # {{ .Host | upper }} {{ .Vars.note | replace " " "-" }}`)
+	data := remoteScriptDataFor(remoteOperationInput{Host: "app01:22", User: "o'neil", PublicKey: "ssh-ed25519 AAAA a", ExtraPublicKeys: []string{"ssh-ed25519 BBBB b"}}, map[string]string{"note": "two words"})
+	script, err := renderRemoteScript(scriptTemplate, data)
+	if err != nil {
+		t.Fatalf("renderRemoteScript() error = %v", err)
+	}
+	if want := `id 'o'\''neil'; for k in 'ssh-ed25519 AAAA a' 'ssh-ed25519 BBBB b'; do :; done # APP01:22 two-words`; script != want {
+		t.Fatalf("script = %q, want %q", script, want)
+	}
+
+	data.User = ""
+	if script, err = renderRemoteScript(scriptTemplate, data); err != nil || !strings.HasPrefix(script, "id 'root';") {
+		t.Fatalf("default user script = %q, %v", script, err)
+	}
+}
+
+func TestRenderRemoteScriptRejectsMissingVars(t *testing.T) {
+	scriptTemplate := parseRemoteScriptTemplate("test", `echo {{ .Vars.missing }}`)
+	if _, err := renderRemoteScript(scriptTemplate, remoteScriptDataFor(remoteOperationInput{}, map[string]string{})); err == nil || !strings.Contains(err.Error(), "render test") {
+		t.Fatalf("renderRemoteScript() error = %v", err)
+	}
+}
+
+func TestInstallKeyScriptRendersReplaceBranchOnlyWhenStamping(t *testing.T) {
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	plain, err := installKeyOperation{}.Script(remoteOperationInput{PublicKey: publicKey})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	stamped, err := installKeyOperation{}.Script(remoteOperationInput{PublicKey: publicKey, ReplaceKeyComment: true})
+	if err != nil {
+		t.Fatalf("Script(stamped) error = %v", err)
+	}
+	if strings.Contains(plain.Command, "elif") || !strings.Contains(stamped.Command, "elif") {
+		t.Fatalf("replace branch: plain=%v stamped=%v", strings.Contains(plain.Command, "elif"), strings.Contains(stamped.Command, "elif"))
+	}
+	for _, script := range []string{plain.Command, stamped.Command} {
+		if strings.Contains(script, "{{") || !strings.Contains(script, "echo '"+authorizedKeyAddedMarker+"'\n") {
+			t.Fatalf("script not rendered:\n%s", script)
+		}
+	}
+}
+
+func TestInstallKeyScriptRunsLocally(t *testing.T) {
+	home := t.TempDir()
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	fields := strings.Fields(publicKey)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	keysPath := filepath.Join(home, ".ssh", "authorized_keys")
+	if err := os.WriteFile(keysPath, []byte(fields[0]+" "+fields[1]+" old\n"), 0o600); err != nil {
+		t.Fatalf("write authorized_keys: %v", err)
+	}
+
+	stamped := fields[0] + " " + fields[1] + " new"
+	script, err := installKeyOperation{}.Script(remoteOperationInput{PublicKey: stamped, ReplaceKeyComment: true})
+	if err != nil {
+		t.Fatalf("Script() error = %v", err)
+	}
+	command := exec.Command("sh", "-c", script.Command) // #nosec G204 -- test runs the rendered built-in script
+	command.Env = append(os.Environ(), "HOME="+home)
+	command.Stdin = strings.NewReader(script.Stdin)
+	output, err := command.CombinedOutput()
+	if err != nil || strings.TrimSpace(string(output)) != authorizedKeyCommentUpdatedMarker {
+		t.Fatalf("script output = %q, %v", output, err)
+	}
+	content, err := os.ReadFile(keysPath) // #nosec G304 -- test temp file
+	if err != nil || string(content) != stamped+"\n" {
+		t.Fatalf("authorized_keys = %q, %v", content, err)
+	}
+}
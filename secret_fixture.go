@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ssh-key-bootstrap/providers"
+)
+
+var (
+	secretProvidersMu sync.Mutex
+	// wrapSecretProviders is set by --record-secrets and --replay-secrets.
+	wrapSecretProviders func([]providers.Provider) []providers.Provider
+)
+
+// secretProviders returns the providers secret refs are resolved with: the
+// registered ones, recording or replaying when a secret fixture is set.
+func secretProviders() []providers.Provider {
+	secretProvidersMu.Lock()
+	wrap := wrapSecretProviders
+	secretProvidersMu.Unlock()
+
+	registered := providers.DefaultProviders()
+	if wrap == nil {
+		return registered
+	}
+	return wrap(registered)
+}
+
+// configureSecretFixture sets up --record-secrets, which saves every
+// provider answer to a fixture file, or --replay-secrets, which answers
+// from one without contacting Bitwarden, Infisical or another backend.
+func configureSecretFixture(recordPath, replayPath string) (func(), error) {
+	recordPath, replayPath = strings.TrimSpace(recordPath), strings.TrimSpace(replayPath)
+	if recordPath != "" && replayPath != "" {
+		return nil, errors.New("--record-secrets and --replay-secrets cannot be combined")
+	}
+	if recordPath == "" && replayPath == "" {
+		return func() {}, nil
+	}
+
+	fixturePath, recording := replayPath, false
+	if recordPath != "" {
+		fixturePath, recording = recordPath, true
+	}
+	expandedPath, err := expandHomePath(fixturePath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve secret fixture path: %w", err)
+	}
+	fixture, err := providers.LoadFixture(expandedPath, recording)
+	if err != nil {
+		return nil, err
+	}
+	wrap := func(registered []providers.Provider) []providers.Provider {
+		return providers.ReplayProviders(registered, fixture)
+	}
+	if recording {
+		wrap = func(registered []providers.Provider) []providers.Provider {
+			return providers.RecordingProviders(registered, fixture)
+		}
+	}
+
+	secretProvidersMu.Lock()
+	previousWrap := wrapSecretProviders
+	wrapSecretProviders = wrap
+	secretProvidersMu.Unlock()
+	return func() {
+		secretProvidersMu.Lock()
+		wrapSecretProviders = previousWrap
+		secretProvidersMu.Unlock()
+	}, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaySecretsAnswersFromTheFixture(t *testing.T) {
+	fixturePath := filepath.Join(t.TempDir(), "secrets.json")
+	fixture := `{"version": 1, "answers": [
+  {"provider": "bitwarden", "ref": "bw://ssh-prod", "value": "replayed-password"},
+  {"provider": "infisical", "ref": "inf://ssh?env=prod", "error": "access token expired"}
+]}`
+	if err := os.WriteFile(fixturePath, []byte(fixture), 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	restoreSecretFixture, err := configureSecretFixture("", fixturePath)
+	if err != nil {
+		t.Fatalf("configureSecretFixture() error = %v", err)
+	}
+	t.Cleanup(restoreSecretFixture)
+
+	if password, err := resolvePasswordFromSecretRef("bw://ssh-prod"); err != nil || password != "replayed-password" {
+		t.Fatalf("resolvePasswordFromSecretRef(bw://ssh-prod) = %q, %v", password, err)
+	}
+	if _, err := resolvePasswordFromNamedProvider("infisical", "inf://ssh?env=prod"); err == nil || !strings.Contains(err.Error(), "access token expired") {
+		t.Fatalf("replayed failure error = %v", err)
+	}
+	if _, err := resolvePasswordFromSecretRef("bw://not-recorded"); err == nil || !strings.Contains(err.Error(), "no recorded answer") {
+		t.Fatalf("unrecorded ref error = %v", err)
+	}
+}
+
+func TestConfigureSecretFixtureRejectsBadInput(t *testing.T) {
+	if _, err := configureSecretFixture("record.json", "replay.json"); err == nil {
+		t.Fatalf("configureSecretFixture(record, replay) error = nil")
+	}
+	if _, err := configureSecretFixture("", filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatalf("configureSecretFixture(replay missing file) error = nil")
+	}
+	restoreSecretFixture, err := configureSecretFixture(filepath.Join(t.TempDir(), "new.json"), "")
+	if err != nil {
+		t.Fatalf("configureSecretFixture(record new file) error = %v", err)
+	}
+	restoreSecretFixture()
+}
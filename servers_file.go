@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	stdinServersFile    = "-"
+	serversFileIncludes = "#include"
+	serversFileGroup    = "#group"
+)
+
+// readServersFile reads host entries one per line from path, or from stdin
+// when path is "-" so inventories can be piped in. Blank lines and lines
+// starting with '#' are ignored. Stdin is read through inputReader so no
+// buffered input is lost.
+//
+// A "#include <path>" line reads another servers file in its place, so an
+// inventory can be split by team or datacenter and composed. Relative paths
+// are resolved against the including file (the working directory for stdin)
+// and may be globs; matches are read in lexical order.
+//
+// A "#group <name>" line puts the hosts after it, up to the next "#group"
+// line, in a group such as a datacenter; a bare "#group" ends the group.
+// Included files start in the group of the include line.
+func readServersFile(path string, inputReader *bufio.Reader) ([]string, error) {
+	entries, _, err := readServersFileWithNotes(path, inputReader)
+	return entries, err
+}
+
+// serverEntryNotes is the context a servers file gives a host: the comment
+// block directly above it (up to a blank line), its trailing comment, e.g. a
+// rack or owner, and its #group. --failed-hosts-out writes it back out.
+type serverEntryNotes struct {
+	section []string
+	inline  string
+	group   string
+}
+
+// readServersFileWithNotes reads like readServersFile and also returns the
+// notes of every entry, keyed by the entry as written.
+func readServersFileWithNotes(path string, inputReader *bufio.Reader) ([]string, map[string]serverEntryNotes, error) {
+	var entries []string
+	notes := map[string]serverEntryNotes{}
+	err := walkServersFile(path, inputReader, func(entry string, entryNotes serverEntryNotes) error {
+		if _, seen := notes[entry]; !seen {
+			notes[entry] = entryNotes
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, notes, nil
+}
+
+// serverEntryVisitor receives each entry of a servers file with its notes,
+// in file order. An error stops the walk and is returned from it.
+type serverEntryVisitor func(entry string, entryNotes serverEntryNotes) error
+
+// walkServersFile reads path like readServersFile but hands each entry to
+// visit as soon as its line is read instead of collecting them, so a caller
+// can act on the first hosts of a huge inventory before the rest is read.
+func walkServersFile(path string, inputReader *bufio.Reader, visit serverEntryVisitor) error {
+	trimmedPath := strings.TrimSpace(path)
+	if trimmedPath == stdinServersFile {
+		if inputReader == nil {
+			inputReader = newStandardInputReader()
+		}
+		if err := scanServerLines(inputReader, ".", nil, "", visit); err != nil {
+			return fmt.Errorf("read servers from stdin: %w", err)
+		}
+		return nil
+	}
+
+	expandedPath, err := expandHomePath(trimmedPath)
+	if err != nil {
+		return fmt.Errorf("resolve servers file path: %w", err)
+	}
+	absolutePath, err := filepath.Abs(expandedPath)
+	if err != nil {
+		return fmt.Errorf("resolve servers file path: %w", err)
+	}
+	serversFile, err := os.Open(absolutePath) // #nosec G304 -- servers file path is explicit user input
+	if err != nil {
+		return fmt.Errorf("open servers file: %w", err)
+	}
+	defer serversFile.Close()
+
+	if err := scanServerLines(serversFile, filepath.Dir(absolutePath), []string{absolutePath}, "", visit); err != nil {
+		return fmt.Errorf("read servers file %q: %w", trimmedPath, err)
+	}
+	return nil
+}
+
+// scanServerLines hands the entries read from reader to visit.
+// includeChain lists the files being read, outermost first, to detect include
+// cycles. group is the #group in effect where reading starts.
+func scanServerLines(reader io.Reader, baseDirectory string, includeChain []string, group string, visit serverEntryVisitor) error {
+	var section []string
+	sectionHasEntries := false
+	lineScanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for lineScanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(lineScanner.Text())
+		if groupName, ok := serversFileGroupName(line); ok {
+			group = groupName
+			continue
+		}
+		if includePattern, ok := serversFileInclude(line); ok {
+			if err := readServersFileIncludes(includePattern, baseDirectory, includeChain, group, visit); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			sectionHasEntries = true
+			continue
+		}
+		switch {
+		case line == "":
+			section, sectionHasEntries = nil, false
+			continue
+		case strings.HasPrefix(line, "#"):
+			// A comment after hosts starts the next section.
+			if sectionHasEntries {
+				section, sectionHasEntries = nil, false
+			}
+			section = append(section, line)
+			continue
+		}
+
+		hostPart, inlineComment := splitInlineComment(line)
+		for _, entry := range splitServerEntries(hostPart) {
+			if err := visit(entry, serverEntryNotes{section: section, inline: inlineComment, group: group}); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+		sectionHasEntries = true
+	}
+	return lineScanner.Err()
+}
+
+// splitInlineComment splits "app01  # rack A12" into the hosts and the
+// comment. Host names cannot contain '#', so any whitespace before one starts
+// a comment.
+func splitInlineComment(line string) (string, string) {
+	for index := 1; index < len(line); index++ {
+		if line[index] == '#' && (line[index-1] == ' ' || line[index-1] == '\t') {
+			return strings.TrimSpace(line[:index]), line[index:]
+		}
+	}
+	return line, ""
+}
+
+// serverNotesByHost re-keys notes by normalized host, as the run reports
+// hosts.
+func serverNotesByHost(notes map[string]serverEntryNotes, defaultPort int) map[string]serverEntryNotes {
+	notesByHost := make(map[string]serverEntryNotes, len(notes))
+	for entry, entryNotes := range notes {
+		if !entryNotes.hasNotes() {
+			continue
+		}
+		if host, err := normalizeHost(entry, defaultPort); err == nil {
+			notesByHost[host] = entryNotes
+		}
+	}
+	return notesByHost
+}
+
+func (entryNotes serverEntryNotes) hasNotes() bool {
+	return len(entryNotes.section) > 0 || entryNotes.inline != "" || entryNotes.group != ""
+}
+
+// serversFileGroupName returns the name of a "#group <name>" line, and ""
+// for a bare "#group".
+func serversFileGroupName(line string) (string, bool) {
+	directiveArgument, ok := strings.CutPrefix(line, serversFileGroup)
+	if !ok || (directiveArgument != "" && directiveArgument[0] != ' ' && directiveArgument[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(directiveArgument), true
+}
+
+// serversFileInclude returns the path of an "#include <path>" line.
+func serversFileInclude(line string) (string, bool) {
+	directiveArgument, ok := strings.CutPrefix(line, serversFileIncludes)
+	if !ok || directiveArgument == "" || (directiveArgument[0] != ' ' && directiveArgument[0] != '\t') {
+		return "", false
+	}
+	return strings.TrimSpace(directiveArgument), true
+}
+
+func readServersFileIncludes(pattern, baseDirectory string, includeChain []string, group string, visit serverEntryVisitor) error {
+	if pattern == "" {
+		return fmt.Errorf("%s needs a path", serversFileIncludes)
+	}
+	expandedPattern, err := expandHomePath(pattern)
+	if err != nil {
+		return fmt.Errorf("include %q: %w", pattern, err)
+	}
+	if !filepath.IsAbs(expandedPattern) {
+		expandedPattern = filepath.Join(baseDirectory, expandedPattern)
+	}
+
+	includedPaths := []string{expandedPattern}
+	if strings.ContainsAny(expandedPattern, "*?[") {
+		if includedPaths, err = filepath.Glob(expandedPattern); err != nil {
+			return fmt.Errorf("include %q: %w", pattern, err)
+		}
+		// A pattern that matches nothing would silently shrink the run.
+		if len(includedPaths) == 0 {
+			return fmt.Errorf("include %q matches no files", pattern)
+		}
+	}
+
+	for _, includedPath := range includedPaths {
+		if err := readIncludedServersFile(includedPath, includeChain, group, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readIncludedServersFile(path string, includeChain []string, group string, visit serverEntryVisitor) error {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("include %q: %w", path, err)
+	}
+	if slices.Contains(includeChain, absolutePath) {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(slices.Clone(includeChain), absolutePath), " -> "))
+	}
+	serversFile, err := os.Open(absolutePath) // #nosec G304 -- included path comes from the operator's servers file
+	if err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	defer serversFile.Close()
+
+	if err := scanServerLines(serversFile, filepath.Dir(absolutePath), append(slices.Clone(includeChain), absolutePath), group, visit); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func serversFileLabel(path string) string {
+	if strings.TrimSpace(path) == stdinServersFile {
+		return "stdin"
+	}
+	return path
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadServersFileFromPath(t *testing.T) {
+	serversPath := filepath.Join(t.TempDir(), "servers.txt")
+	content := "# inventory\napp01\n\n  app02:2222  \r\ndb01,db02\n"
+	if err := os.WriteFile(serversPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write servers file: %v", err)
+	}
+
+	entries, err := readServersFile(serversPath, nil)
+	if err != nil {
+		t.Fatalf("readServersFile() error = %v", err)
+	}
+	if strings.Join(entries, ",") != "app01,app02:2222,db01,db02" {
+		t.Fatalf("entries = %v", entries)
+	}
+}
+
+func TestReadServersFileFromStdin(t *testing.T) {
+	inputReader := bufio.NewReader(strings.NewReader("web1\nweb2\n"))
+
+	entries, err := readServersFile(" - ", inputReader)
+	if err != nil {
+		t.Fatalf("readServersFile(-) error = %v", err)
+	}
+	if strings.Join(entries, ",") != "web1,web2" {
+		t.Fatalf("entries = %v", entries)
+	}
+	if serversFileLabel("-") != "stdin" {
+		t.Fatalf("serversFileLabel(-) = %q", serversFileLabel("-"))
+	}
+}
+
+func TestReadServersFileMissingFile(t *testing.T) {
+	if _, err := readServersFile(filepath.Join(t.TempDir(), "missing.txt"), nil); err == nil {
+		t.Fatalf("expected missing servers file error")
+	}
+}
+
+func TestReadServersFileIncludes(t *testing.T) {
+	directory := t.TempDir()
+	writeServersFiles(t, directory, map[string]string{
+		"all.txt":            "#include teams/*.txt\n#includes are not directives without a space\nbastion01\n#include\tdc2/hosts.txt\n",
+		"teams/payments.txt": "pay01\npay02\n",
+		"teams/search.txt":   "# search team\nsearch01\n",
+		"dc2/hosts.txt":      "#include ../teams/search.txt\ndc2-web01\n",
+	})
+
+	entries, err := readServersFile(filepath.Join(directory, "all.txt"), nil)
+	if err != nil {
+		t.Fatalf("readServersFile() error = %v", err)
+	}
+	if got := strings.Join(entries, ","); got != "pay01,pay02,search01,bastion01,search01,dc2-web01" {
+		t.Fatalf("entries = %s", got)
+	}
+}
+
+func TestReadServersFileIncludeErrors(t *testing.T) {
+	directory := t.TempDir()
+	writeServersFiles(t, directory, map[string]string{
+		"a.txt":     "app01\n#include b.txt\n",
+		"b.txt":     "#include a.txt\n",
+		"empty.txt": "#include nothing/*.txt\n",
+	})
+
+	_, err := readServersFile(filepath.Join(directory, "a.txt"), nil)
+	if err == nil || !strings.Contains(err.Error(), "include cycle: ") || !strings.HasSuffix(err.Error(), filepath.Join(directory, "a.txt")) {
+		t.Fatalf("cycle error = %v", err)
+	}
+	if _, err := readServersFile(filepath.Join(directory, "empty.txt"), nil); err == nil || !strings.Contains(err.Error(), `line 1: include "nothing/*.txt" matches no files`) {
+		t.Fatalf("empty glob error = %v", err)
+	}
+}
+
+func writeServersFiles(t *testing.T, directory string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(directory, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// serviceCredential is the credential an inventory source or key directory
+// is reached with: the secret secretRef points to, or envName from the
+// environment. credential names it in errors, e.g. "API token".
+func serviceCredential(service, credential, secretRef, refFlag, envName string) (string, error) {
+	if secretRef = strings.TrimSpace(secretRef); secretRef != "" {
+		value, err := resolvePasswordFromSecretRef(secretRef)
+		if err != nil {
+			return "", fmt.Errorf("resolve %s %s: %w", service, credential, err)
+		}
+		return strings.TrimSpace(value), nil
+	}
+	if value := strings.TrimSpace(os.Getenv(envName)); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("%s %s is not set: pass %s <secret ref> or set %s", service, credential, refFlag, envName)
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP version 3 packet types and flags (draft-ietf-secsh-filexfer-02), the
+// version every OpenSSH sftp-server speaks.
+const (
+	sftpPacketInit     = 1
+	sftpPacketVersion  = 2
+	sftpPacketOpen     = 3
+	sftpPacketClose    = 4
+	sftpPacketRead     = 5
+	sftpPacketWrite    = 6
+	sftpPacketSetstat  = 9
+	sftpPacketMkdir    = 14
+	sftpPacketRealpath = 16
+	sftpPacketStat     = 17
+	sftpPacketStatus   = 101
+	sftpPacketHandle   = 102
+	sftpPacketData     = 103
+	sftpPacketName     = 104
+	sftpPacketAttrs    = 105
+
+	sftpOpenRead     = 0x01
+	sftpOpenWrite    = 0x02
+	sftpOpenCreate   = 0x08
+	sftpOpenTruncate = 0x10
+
+	sftpAttrSize        = 0x01
+	sftpAttrUIDGID      = 0x02
+	sftpAttrPermissions = 0x04
+
+	sftpStatusOK     = 0
+	sftpStatusEOF    = 1
+	sftpStatusNoFile = 2
+
+	sftpProtocolVersion = 3
+	sftpChunkSize       = 32 * 1024
+	sftpMaxPacketSize   = 256 * 1024
+)
+
+// sftpClient is the small part of an SFTP client that installing a key
+// needs. Requests are sent one at a time.
+type sftpClient struct {
+	session *ssh.Session
+	writer  io.WriteCloser
+	reader  io.Reader
+	nextID  uint32
+}
+
+// sftpStatusError is a failed request. A missing file matches fs.ErrNotExist.
+type sftpStatusError struct {
+	code    uint32
+	message string
+}
+
+func (err *sftpStatusError) Error() string {
+	if err.message != "" {
+		return fmt.Sprintf("sftp: %s (status %d)", err.message, err.code)
+	}
+	return fmt.Sprintf("sftp: status %d", err.code)
+}
+
+func (err *sftpStatusError) Is(target error) bool {
+	return target == fs.ErrNotExist && err.code == sftpStatusNoFile
+}
+
+// openSFTP starts the sftp subsystem in a new session on client.
+func openSFTP(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, &sessionError{op: "create session", err: err}
+	}
+	writer, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		_ = session.Close()
+		return nil, fmt.Errorf("start sftp subsystem: %w", err)
+	}
+	sftp, err := newSFTPClient(reader, writer)
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	sftp.session = session
+	return sftp, nil
+}
+
+func newSFTPClient(reader io.Reader, writer io.WriteCloser) (*sftpClient, error) {
+	sftp := &sftpClient{reader: reader, writer: writer}
+	if err := sftp.send(sftpPacketInit, binary.BigEndian.AppendUint32(nil, sftpProtocolVersion)); err != nil {
+		return nil, err
+	}
+	packetType, payload, err := sftp.receive()
+	if err != nil {
+		return nil, err
+	}
+	if packetType != sftpPacketVersion || len(payload) < 4 {
+		return nil, fmt.Errorf("sftp: unexpected reply %d to init", packetType)
+	}
+	if serverVersion := binary.BigEndian.Uint32(payload); serverVersion < sftpProtocolVersion {
+		return nil, fmt.Errorf("sftp: server speaks version %d, need %d", serverVersion, sftpProtocolVersion)
+	}
+	return sftp, nil
+}
+
+func (sftp *sftpClient) Close() error {
+	err := sftp.writer.Close()
+	if sftp.session != nil {
+		_ = sftp.session.Close()
+	}
+	return err
+}
+
+// realPath resolves remotePath on the server; "." is the directory the
+// session starts in, which is the user's home (inside any chroot).
+func (sftp *sftpClient) realPath(remotePath string) (string, error) {
+	packetType, reply, err := sftp.request(sftpPacketRealpath, sftpString(nil, remotePath))
+	if err != nil {
+		return "", err
+	}
+	if packetType != sftpPacketName {
+		return "", fmt.Errorf("sftp: unexpected reply %d to realpath", packetType)
+	}
+	if count := reply.uint32(); count < 1 {
+		return "", errors.New("sftp: empty realpath reply")
+	}
+	resolved := reply.string()
+	return resolved, reply.err
+}
+
+// stat returns the permission bits of remotePath.
+func (sftp *sftpClient) stat(remotePath string) (fs.FileMode, error) {
+	packetType, reply, err := sftp.request(sftpPacketStat, sftpString(nil, remotePath))
+	if err != nil {
+		return 0, err
+	}
+	if packetType != sftpPacketAttrs {
+		return 0, fmt.Errorf("sftp: unexpected reply %d to stat", packetType)
+	}
+	mode := reply.attrsPermissions()
+	return mode, reply.err
+}
+
+func (sftp *sftpClient) mkdir(remotePath string, mode fs.FileMode) error {
+	return sftp.requestStatus(sftpPacketMkdir, sftpPermissions(sftpString(nil, remotePath), mode))
+}
+
+func (sftp *sftpClient) chmod(remotePath string, mode fs.FileMode) error {
+	return sftp.requestStatus(sftpPacketSetstat, sftpPermissions(sftpString(nil, remotePath), mode))
+}
+
+func (sftp *sftpClient) readFile(remotePath string) ([]byte, error) {
+	handle, err := sftp.open(remotePath, sftpOpenRead, 0)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	for {
+		payload := sftpString(nil, handle)
+		payload = binary.BigEndian.AppendUint64(payload, uint64(len(content)))
+		payload = binary.BigEndian.AppendUint32(payload, sftpChunkSize)
+		packetType, reply, err := sftp.request(sftpPacketRead, payload)
+		if err != nil {
+			_ = sftp.closeHandle(handle)
+			return nil, err
+		}
+		if packetType == sftpPacketStatus {
+			statusErr := reply.status()
+			if errors.Is(statusErr, io.EOF) {
+				break
+			}
+			_ = sftp.closeHandle(handle)
+			if statusErr == nil {
+				statusErr = errors.New("sftp: read returned no data")
+			}
+			return nil, statusErr
+		}
+		if packetType != sftpPacketData {
+			_ = sftp.closeHandle(handle)
+			return nil, fmt.Errorf("sftp: unexpected reply %d to read", packetType)
+		}
+		chunk := reply.string()
+		if reply.err != nil {
+			_ = sftp.closeHandle(handle)
+			return nil, reply.err
+		}
+		if chunk == "" {
+			break
+		}
+		content = append(content, chunk...)
+	}
+	return content, sftp.closeHandle(handle)
+}
+
+// writeFile replaces the content of remotePath, creating it with mode when
+// it does not exist.
+func (sftp *sftpClient) writeFile(remotePath string, content []byte, mode fs.FileMode) error {
+	handle, err := sftp.open(remotePath, sftpOpenWrite|sftpOpenCreate|sftpOpenTruncate, mode)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < len(content); offset += sftpChunkSize {
+		chunk := content[offset:min(offset+sftpChunkSize, len(content))]
+		payload := sftpString(nil, handle)
+		payload = binary.BigEndian.AppendUint64(payload, uint64(offset))
+		payload = sftpString(payload, string(chunk))
+		if err := sftp.requestStatus(sftpPacketWrite, payload); err != nil {
+			_ = sftp.closeHandle(handle)
+			return err
+		}
+	}
+	return sftp.closeHandle(handle)
+}
+
+func (sftp *sftpClient) open(remotePath string, flags uint32, mode fs.FileMode) (string, error) {
+	payload := binary.BigEndian.AppendUint32(sftpString(nil, remotePath), flags)
+	if flags&sftpOpenCreate != 0 {
+		payload = sftpPermissions(payload, mode)
+	} else {
+		payload = binary.BigEndian.AppendUint32(payload, 0)
+	}
+	packetType, reply, err := sftp.request(sftpPacketOpen, payload)
+	if err != nil {
+		return "", err
+	}
+	if packetType != sftpPacketHandle {
+		return "", fmt.Errorf("sftp: unexpected reply %d to open", packetType)
+	}
+	handle := reply.string()
+	return handle, reply.err
+}
+
+func (sftp *sftpClient) closeHandle(handle string) error {
+	return sftp.requestStatus(sftpPacketClose, sftpString(nil, handle))
+}
+
+// request sends one request and returns the reply with its id checked and
+// stripped. A failure status is returned as an error.
+func (sftp *sftpClient) request(packetType byte, payload []byte) (byte, *sftpReader, error) {
+	sftp.nextID++
+	id := sftp.nextID
+	if err := sftp.send(packetType, append(binary.BigEndian.AppendUint32(nil, id), payload...)); err != nil {
+		return 0, nil, err
+	}
+	replyType, replyPayload, err := sftp.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	reply := &sftpReader{data: replyPayload}
+	if replyID := reply.uint32(); reply.err != nil || replyID != id {
+		return 0, nil, fmt.Errorf("sftp: reply id %d does not match request %d", replyID, id)
+	}
+	if replyType == sftpPacketStatus && packetType != sftpPacketRead {
+		return replyType, reply, reply.status()
+	}
+	return replyType, reply, nil
+}
+
+func (sftp *sftpClient) requestStatus(packetType byte, payload []byte) error {
+	replyType, _, err := sftp.request(packetType, payload)
+	if err != nil {
+		return err
+	}
+	if replyType != sftpPacketStatus {
+		return fmt.Errorf("sftp: unexpected reply %d", replyType)
+	}
+	return nil
+}
+
+func (sftp *sftpClient) send(packetType byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(make([]byte, 0, 5+len(payload)), uint32(1+len(payload)))
+	packet = append(packet, packetType)
+	packet = append(packet, payload...)
+	_, err := sftp.writer.Write(packet)
+	return err
+}
+
+func (sftp *sftpClient) receive() (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(sftp.reader, header[:]); err != nil {
+		return 0, nil, fmt.Errorf("sftp: read reply: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 1 || length > sftpMaxPacketSize {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(sftp.reader, packet); err != nil {
+		return 0, nil, fmt.Errorf("sftp: read reply: %w", err)
+	}
+	return packet[0], packet[1:], nil
+}
+
+func sftpString(buffer []byte, value string) []byte {
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(value))) // #nosec G115 -- SFTP strings are bounded by the packet size
+	return append(buffer, value...)
+}
+
+func sftpPermissions(buffer []byte, mode fs.FileMode) []byte {
+	buffer = binary.BigEndian.AppendUint32(buffer, sftpAttrPermissions)
+	return binary.BigEndian.AppendUint32(buffer, uint32(mode.Perm()))
+}
+
+// sftpReader decodes reply fields; the first decoding error sticks.
+type sftpReader struct {
+	data []byte
+	err  error
+}
+
+func (reader *sftpReader) uint32() uint32 {
+	if reader.err != nil || len(reader.data) < 4 {
+		reader.fail()
+		return 0
+	}
+	value := binary.BigEndian.Uint32(reader.data)
+	reader.data = reader.data[4:]
+	return value
+}
+
+func (reader *sftpReader) skip(count int) {
+	if reader.err != nil || len(reader.data) < count {
+		reader.fail()
+		return
+	}
+	reader.data = reader.data[count:]
+}
+
+func (reader *sftpReader) string() string {
+	length := reader.uint32()
+	if reader.err != nil || uint64(len(reader.data)) < uint64(length) {
+		reader.fail()
+		return ""
+	}
+	value := string(reader.data[:length])
+	reader.data = reader.data[length:]
+	return value
+}
+
+func (reader *sftpReader) fail() {
+	if reader.err == nil {
+		reader.err = errors.New("sftp: truncated reply")
+	}
+}
+
+func (reader *sftpReader) attrsPermissions() fs.FileMode {
+	flags := reader.uint32()
+	if flags&sftpAttrSize != 0 {
+		reader.skip(8)
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		reader.skip(8)
+	}
+	if flags&sftpAttrPermissions == 0 {
+		return 0
+	}
+	return fs.FileMode(reader.uint32()).Perm()
+}
+
+func (reader *sftpReader) status() error {
+	code := reader.uint32()
+	message := reader.string()
+	if reader.err != nil {
+		return reader.err
+	}
+	switch code {
+	case sftpStatusOK:
+		return nil
+	case sftpStatusEOF:
+		return io.EOF
+	}
+	return &sftpStatusError{code: code, message: message}
+}
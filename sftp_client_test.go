@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+type fakeSFTPEntry struct {
+	data []byte
+	mode fs.FileMode
+	dir  bool
+}
+
+// fakeSFTPServer answers the requests sftpClient sends from an in-memory
+// file tree rooted at /home/upload.
+type fakeSFTPServer struct {
+	entries map[string]*fakeSFTPEntry
+	handles map[string]string
+}
+
+func newFakeSFTP(t *testing.T, entries map[string]*fakeSFTPEntry) *sftpClient {
+	t.Helper()
+	server := &fakeSFTPServer{entries: entries, handles: map[string]string{}}
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	go server.serve(serverReader, serverWriter)
+	client, err := newSFTPClient(clientReader, clientWriter)
+	if err != nil {
+		t.Fatalf("newSFTPClient() error = %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func (server *fakeSFTPServer) serve(reader io.Reader, writer *io.PipeWriter) {
+	defer writer.Close()
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return
+		}
+		packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(reader, packet); err != nil {
+			return
+		}
+		replyType, reply := server.handle(packet[0], &sftpReader{data: packet[1:]})
+		response := binary.BigEndian.AppendUint32(nil, uint32(1+len(reply)))
+		response = append(response, replyType)
+		if _, err := writer.Write(append(response, reply...)); err != nil {
+			return
+		}
+	}
+}
+
+func (server *fakeSFTPServer) handle(packetType byte, request *sftpReader) (byte, []byte) {
+	if packetType == sftpPacketInit {
+		return sftpPacketVersion, binary.BigEndian.AppendUint32(nil, sftpProtocolVersion)
+	}
+	id := request.uint32()
+	reply := binary.BigEndian.AppendUint32(nil, id)
+	status := func(code uint32) (byte, []byte) {
+		return sftpPacketStatus, sftpString(sftpString(binary.BigEndian.AppendUint32(reply, code), ""), "")
+	}
+	switch packetType {
+	case sftpPacketRealpath:
+		_ = request.string()
+		reply = binary.BigEndian.AppendUint32(reply, 1)
+		reply = sftpString(sftpString(reply, "/home/upload"), "")
+		return sftpPacketName, binary.BigEndian.AppendUint32(reply, 0)
+	case sftpPacketStat:
+		entry, ok := server.entries[request.string()]
+		if !ok {
+			return status(sftpStatusNoFile)
+		}
+		return sftpPacketAttrs, sftpPermissions(reply, entry.mode)
+	case sftpPacketMkdir:
+		remotePath := request.string()
+		server.entries[remotePath] = &fakeSFTPEntry{dir: true, mode: request.attrsPermissions()}
+		return status(sftpStatusOK)
+	case sftpPacketSetstat:
+		entry, ok := server.entries[request.string()]
+		if !ok {
+			return status(sftpStatusNoFile)
+		}
+		entry.mode = request.attrsPermissions()
+		return status(sftpStatusOK)
+	case sftpPacketOpen:
+		remotePath := request.string()
+		flags := request.uint32()
+		entry, ok := server.entries[remotePath]
+		switch {
+		case !ok && flags&sftpOpenCreate == 0:
+			return status(sftpStatusNoFile)
+		case !ok:
+			server.entries[remotePath] = &fakeSFTPEntry{mode: request.attrsPermissions()}
+		case flags&sftpOpenTruncate != 0:
+			entry.data = nil
+		}
+		server.handles[remotePath] = remotePath
+		return sftpPacketHandle, sftpString(reply, remotePath)
+	case sftpPacketRead:
+		entry := server.entries[server.handles[request.string()]]
+		offset := binary.BigEndian.Uint64(request.data)
+		request.skip(8)
+		length := uint64(request.uint32())
+		if offset >= uint64(len(entry.data)) {
+			return status(sftpStatusEOF)
+		}
+		return sftpPacketData, sftpString(reply, string(entry.data[offset:min(offset+length, uint64(len(entry.data)))]))
+	case sftpPacketWrite:
+		entry := server.entries[server.handles[request.string()]]
+		offset := binary.BigEndian.Uint64(request.data)
+		request.skip(8)
+		data := request.string()
+		entry.data = append(entry.data[:offset], data...)
+		return status(sftpStatusOK)
+	case sftpPacketClose:
+		delete(server.handles, request.string())
+		return status(sftpStatusOK)
+	}
+	return status(8) // SSH_FX_OP_UNSUPPORTED
+}
+
+func TestSFTPClientReadsMissingFileAsNotExist(t *testing.T) {
+	client := newFakeSFTP(t, map[string]*fakeSFTPEntry{})
+	if _, err := client.readFile("/home/upload/.ssh/authorized_keys"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("readFile() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestSFTPClientWritesAndReadsLargeFiles(t *testing.T) {
+	entries := map[string]*fakeSFTPEntry{}
+	client := newFakeSFTP(t, entries)
+	content := []byte(strings.Repeat("ssh-ed25519 AAAA test\n", 4000))
+	if err := client.writeFile("/home/upload/keys", content, 0o600); err != nil {
+		t.Fatalf("writeFile() error = %v", err)
+	}
+	read, err := client.readFile("/home/upload/keys")
+	if err != nil || string(read) != string(content) {
+		t.Fatalf("readFile() = %d bytes, %v; want %d bytes", len(read), err, len(content))
+	}
+	if entries["/home/upload/keys"].mode != 0o600 {
+		t.Fatalf("mode = %v", entries["/home/upload/keys"].mode)
+	}
+}
+
+func TestInstallKeyRunSFTPCreatesAuthorizedKeys(t *testing.T) {
+	entries := map[string]*fakeSFTPEntry{"/home/upload": {dir: true, mode: 0o755}}
+	client := newFakeSFTP(t, entries)
+	publicKey := strings.TrimSpace(generateTestKey(t))
+
+	result, err := installKeyOperation{}.RunSFTP(client, remoteOperationInput{PublicKey: publicKey})
+	if err != nil || !result.Changed {
+		t.Fatalf("RunSFTP() = %+v, %v", result, err)
+	}
+	sshDir, keys := entries["/home/upload/.ssh"], entries["/home/upload/.ssh/authorized_keys"]
+	if sshDir == nil || !sshDir.dir || sshDir.mode != 0o700 {
+		t.Fatalf(".ssh = %+v", sshDir)
+	}
+	if keys == nil || string(keys.data) != publicKey+"\n" || keys.mode != 0o600 {
+		t.Fatalf("authorized_keys = %+v", keys)
+	}
+
+	result, err = installKeyOperation{}.RunSFTP(client, remoteOperationInput{PublicKey: publicKey})
+	if err != nil || result.Changed || result.Message != authorizedKeyPresentMarker {
+		t.Fatalf("second RunSFTP() = %+v, %v", result, err)
+	}
+}
+
+func TestInstallKeyRunSFTPReplacesCommentAndKeepsOtherLines(t *testing.T) {
+	publicKey := strings.TrimSpace(generateTestKey(t))
+	blob := strings.Fields(publicKey)[1]
+	existing := "# managed by hand\nssh-ed25519 " + blob + " old-comment\n"
+	entries := map[string]*fakeSFTPEntry{
+		"/home/upload/.ssh":                 {dir: true, mode: 0o755},
+		"/home/upload/.ssh/authorized_keys": {data: []byte(existing), mode: 0o644},
+	}
+	client := newFakeSFTP(t, entries)
+
+	stamped := strings.Fields(publicKey)[0] + " " + blob + " alice CHG-1"
+	result, err := installKeyOperation{}.RunSFTP(client, remoteOperationInput{PublicKey: stamped, ReplaceKeyComment: true})
+	if err != nil || !result.Changed || result.Message != authorizedKeyCommentUpdatedMarker {
+		t.Fatalf("RunSFTP() = %+v, %v", result, err)
+	}
+	keys := entries["/home/upload/.ssh/authorized_keys"]
+	if want := "# managed by hand\n" + stamped + "\n"; string(keys.data) != want || keys.mode != 0o600 {
+		t.Fatalf("authorized_keys = %q (%v), want %q", keys.data, keys.mode, want)
+	}
+	if entries["/home/upload/.ssh"].mode != 0o700 {
+		t.Fatalf(".ssh mode = %v", entries["/home/upload/.ssh"].mode)
+	}
+}
+
+func TestInstallKeyScriptRanRequiresMarker(t *testing.T) {
+	if (installKeyOperation{}).ScriptRan("This account is currently not available.\n") {
+		t.Fatalf("ScriptRan() = true for nologin output")
+	}
+	if !(installKeyOperation{}).ScriptRan(authorizedKeyAddedMarker + "\n") {
+		t.Fatalf("ScriptRan() = false for script output")
+	}
+}
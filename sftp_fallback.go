@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const shellProbeMarker = "ssh-key-bootstrap shell probe"
+
+// remoteOperationSFTPFallback is implemented by operations that can do their
+// work over SFTP for accounts that never run the script: ForceCommand
+// internal-sftp, chrooted SFTP users, or a nologin/false login shell.
+// ScriptRan reports whether the script's output shows that it ran.
+type remoteOperationSFTPFallback interface {
+	ScriptRan(output string) bool
+	RunSFTP(client *sftpClient, input remoteOperationInput) (remoteOperationResult, error)
+}
+
+// runWithoutShell is called when an operation's script did not run. If the
+// account cannot run commands but offers SFTP, it does the work over SFTP
+// and reports handled; otherwise the script's own result stands.
+func runWithoutShell(client *ssh.Client, fallback remoteOperationSFTPFallback, input remoteOperationInput, logf func(format string, args ...any)) (remoteOperationResult, bool, error) {
+	reason := probeShell(client)
+	if reason == "" {
+		return remoteOperationResult{}, false, nil
+	}
+	sftp, err := openSFTP(client)
+	if err != nil {
+		return remoteOperationResult{}, false, nil
+	}
+	defer sftp.Close()
+
+	reportSSHBanner(input.Host, "account", "no usable shell ("+reason+"); using SFTP")
+	if logf != nil {
+		logf("No usable shell (%s); continuing through SFTP...", reason)
+	}
+	result, err := fallback.RunSFTP(sftp, input)
+	return result, true, err
+}
+
+// probeShell runs a trivial command and returns why the account did not run
+// it, or "" when it did.
+func probeShell(client *ssh.Client) string {
+	session, err := client.NewSession()
+	if err != nil {
+		return ""
+	}
+	defer session.Close()
+
+	output, err := runLimitedSession(session, "echo '"+shellProbeMarker+"'")
+	text := strings.TrimSpace(string(output))
+	switch {
+	case strings.Contains(text, shellProbeMarker):
+		return ""
+	case text != "":
+		firstLine, _, _ := strings.Cut(text, "\n")
+		return "commands print " + strings.TrimSpace(firstLine)
+	case err != nil:
+		return "commands fail: " + err.Error()
+	default:
+		return "commands print nothing"
+	}
+}
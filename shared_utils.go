@@ -41,16 +41,18 @@ func setStandardWriters(outputWriter, errorWriter io.Writer) {
 }
 
 type timestampedLineWriter struct {
-	mu      sync.Mutex
-	writer  io.Writer
-	pending []byte
-	nowFunc func() time.Time
+	mu        sync.Mutex
+	writer    io.Writer
+	pending   []byte
+	nowFunc   func() time.Time
+	runIDFunc func() string
 }
 
 func newTimestampedLineWriter(writer io.Writer) *timestampedLineWriter {
 	return &timestampedLineWriter{
-		writer:  writer,
-		nowFunc: time.Now,
+		writer:    writer,
+		nowFunc:   time.Now,
+		runIDFunc: currentRunID,
 	}
 }
 
@@ -89,6 +91,9 @@ func (timestampWriter *timestampedLineWriter) Close() error {
 
 func (timestampWriter *timestampedLineWriter) writeLineLocked(line []byte, appendNewline bool) error {
 	timestampPrefix := timestampWriter.nowFunc().UTC().Format(time.RFC3339)
+	if runID := timestampWriter.runIDFunc(); runID != "" {
+		timestampPrefix += "] [run " + runID
+	}
 	if _, err := fmt.Fprintf(timestampWriter.writer, "[%s] %s", timestampPrefix, string(line)); err != nil {
 		return err
 	}
@@ -105,16 +110,7 @@ func promptLine(reader *bufio.Reader, label string) (string, error) {
 		return "", errors.New("input reader is nil")
 	}
 
-	outputPrint(label)
-	line, err := reader.ReadString('\n')
-	if err != nil && !errors.Is(err, io.EOF) {
-		return "", err
-	}
-	trimmedLine := strings.TrimSpace(line)
-	if errors.Is(err, io.EOF) && trimmedLine == "" {
-		return "", io.EOF
-	}
-	return trimmedLine, nil
+	return currentPrompter().Line(reader, label)
 }
 
 func outputPrint(arguments ...any) {
@@ -137,31 +133,22 @@ func commandOutputWriter() io.Writer {
 	return getStandardErrorWriter()
 }
 
-func setupRunLogFile(applicationName string) (func(), error) {
-	executablePath, err := os.Executable()
-	if err != nil {
-		return nil, fmt.Errorf("get executable path: %w", err)
-	}
+// runLogWriter is the timestamped run log while one is open, for output that
+// belongs in the log but not on the terminal.
+var runLogWriter io.Writer
 
-	logDirectory := filepath.Dir(executablePath)
-	logPath := filepath.Join(logDirectory, applicationName+".log")
-	logFileHandle, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304 -- log path is fixed to binary directory
+// openRunLogFile opens the run log in the state directory for appending;
+// run timestamps what it writes there.
+func openRunLogFile(applicationName string) (io.Writer, func(), error) {
+	logPath, err := stateFilePath(applicationName + ".log")
 	if err != nil {
-		return nil, fmt.Errorf("open run log %q: %w", logPath, err)
+		return nil, nil, fmt.Errorf("resolve run log path: %w", err)
 	}
-	timestampedLogWriter := newTimestampedLineWriter(logFileHandle)
-
-	setStandardWriters(
-		io.MultiWriter(os.Stdout, timestampedLogWriter),
-		io.MultiWriter(os.Stderr, timestampedLogWriter),
-	)
-
-	cleanupRunLog := func() {
-		setStandardWriters(os.Stdout, os.Stderr)
-		_ = timestampedLogWriter.Close()
-		_ = logFileHandle.Close()
+	logFileHandle, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304 -- log path is fixed to the state directory or the binary directory
+	if err != nil {
+		return nil, nil, fmt.Errorf("open run log %q: %w", logPath, err)
 	}
-	return cleanupRunLog, nil
+	return logFileHandle, func() { _ = logFileHandle.Close() }, nil
 }
 
 func expandHomePath(path string) (string, error) {
@@ -182,6 +169,10 @@ func expandHomePath(path string) (string, error) {
 	return filepath.Join(home, path[2:]), nil
 }
 
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
 func normalizeLF(value string) string {
 	value = strings.ReplaceAll(value, "\r\n", "\n")
 	return strings.ReplaceAll(value, "\r", "\n")
@@ -204,6 +195,20 @@ func isTerminal(file *os.File) bool {
 	return ok && term.IsTerminal(terminalFileDescriptor)
 }
 
+// saveTerminalState returns a function that puts the terminal back into its
+// current mode, or nil when file is not a terminal.
+func saveTerminalState(file *os.File) func() {
+	terminalFileDescriptor, ok := terminalFD(file)
+	if !ok {
+		return nil
+	}
+	state, err := term.GetState(terminalFileDescriptor)
+	if err != nil {
+		return nil
+	}
+	return func() { _ = term.Restore(terminalFileDescriptor, state) }
+}
+
 func readPassword(file *os.File) ([]byte, error) {
 	terminalFileDescriptor, ok := terminalFD(file)
 	if !ok {
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "golang.org/x/crypto/ssh"
+
+// forwardTerminalResize is a no-op where there is no SIGWINCH; the session
+// keeps the size it started with.
+func forwardTerminalResize(int, *ssh.Session) func() {
+	return func() {}
+}
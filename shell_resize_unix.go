@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// forwardTerminalResize sends the new terminal size to the session on every
+// SIGWINCH until the returned function is called.
+func forwardTerminalResize(fileDescriptor int, session *ssh.Session) func() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-resized:
+				if width, height, err := term.GetSize(fileDescriptor); err == nil {
+					_ = session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	appconfig "ssh-key-bootstrap/config"
+)
+
+// resolveSingleHost loads the config and collects the credentials for one
+// host named on the command line, as a run would: the host's entry in the
+// hosts list (user, password reference) wins over USER and the password.
+// Subcommands that work on one host (shell, tunnel) start with it.
+func resolveSingleHost(programOptions *options, hostArg string) (string, hostSettings, error) {
+	inputReader := newStandardInputReader()
+
+	outputAnsibleTask("Load configuration")
+	if err := applyConfigFiles(programOptions, inputReader); err != nil {
+		return "", hostSettings{}, fail(2, "%w", err)
+	}
+	if err := checkFilePermissions(programOptions); err != nil {
+		return "", hostSettings{}, fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	outputAnsibleTask("Validate options")
+	if err := validateOptions(programOptions); err != nil {
+		return "", hostSettings{}, fail(2, "%w", err)
+	}
+	host, err := normalizeHost(strings.TrimSpace(hostArg), programOptions.Port)
+	if err != nil {
+		return "", hostSettings{}, fail(2, "invalid host %q: %w", hostArg, err)
+	}
+	hostSpecs, err := singleHostSpecs(programOptions, host)
+	if err != nil {
+		return "", hostSettings{}, fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	hostPasswords := map[string]string{}
+	if hasHostPasswordSecretRefs(programOptions) {
+		outputAnsibleTask("Resolve host secrets")
+		hostPasswords, err = resolveHostPasswords(programOptions, []string{host}, hostSpecs)
+		if err != nil {
+			return "", hostSettings{}, fail(2, "%w", err)
+		}
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host password(s) resolved", len(hostPasswords)))
+	}
+
+	outputAnsibleTask("Collect missing inputs")
+	if strings.TrimSpace(hostSpecs[host].User) == "" {
+		if err := fillMissingUser(inputReader, programOptions); err != nil {
+			return "", hostSettings{}, fail(2, "%w", err)
+		}
+	}
+	if needsFallbackPassword([]string{host}, hostPasswords) {
+		if err := fillMissingPassword(inputReader, programOptions); err != nil {
+			return "", hostSettings{}, fail(2, "%w", err)
+		}
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+	return host, buildHostSettings(programOptions, []string{host}, hostSpecs, hostPasswords, nil, nil)[host], nil
+}
+
+// singleHostSpecs returns the hosts entry of the config for host, if any.
+func singleHostSpecs(programOptions *options, host string) (map[string]appconfig.HostSpec, error) {
+	hostSpecs := map[string]appconfig.HostSpec{}
+	for _, hostSpec := range programOptions.Hosts {
+		port := hostSpec.Port
+		if port == 0 {
+			port = programOptions.Port
+		}
+		specHost, err := normalizeHost(strings.TrimSpace(hostSpec.Address), port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host %q: %w", hostSpec.Address, err)
+		}
+		if specHost == host {
+			hostSpecs[host] = hostSpec
+		}
+	}
+	return hostSpecs, nil
+}
+
+// dialSingleHost connects to host with AUTH_METHODS, --transport and the host
+// key policy of a run, and reports the result under the current task.
+func dialSingleHost(programOptions *options, host string, setting hostSettings) (*ssh.Client, error) {
+	clientConfig, err := buildSSHConfig(programOptions)
+	if err != nil {
+		return nil, fail(2, "%w", err)
+	}
+	client, err := dialSSH("tcp", host, clientConfigForLogin(clientConfig, authMethodOrder(programOptions), setting.User, setting.Password))
+	if err != nil {
+		err = fmt.Errorf("ssh dial: %w", err)
+		outputAnsibleHostStatus("failed", host, err.Error())
+		outputFailureHint(err)
+		return nil, fail(classifyHostError(err).exitCode(), "cannot connect to %s", host)
+	}
+	outputAnsibleHostStatus("ok", host, "connected as "+setting.User)
+	return client, nil
+}
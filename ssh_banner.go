@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var verboseOutput atomic.Bool
+
+// configureVerbose makes per-host connection details, such as the SSH
+// banner, part of the normal output instead of only the run log. The returned
+// function turns it off again.
+func configureVerbose(enabled bool) func() {
+	verboseOutput.Store(enabled)
+	return func() { verboseOutput.Store(false) }
+}
+
+// withBannerCapture returns a copy of clientConfig that reports the pre-auth
+// banner sent by hostAddress, keeping any banner callback already set.
+func withBannerCapture(hostAddress string, clientConfig *ssh.ClientConfig) *ssh.ClientConfig {
+	capturingConfig := *clientConfig
+	nextCallback := clientConfig.BannerCallback
+	capturingConfig.BannerCallback = func(message string) error {
+		reportSSHBanner(hostAddress, "banner", message)
+		if nextCallback != nil {
+			return nextCallback(message)
+		}
+		return nil
+	}
+	return &capturingConfig
+}
+
+// reportSSHBanner records what a host announced about itself, one line per
+// banner line. It always reaches the run log and, with --verbose, the output
+// too. Hosts are untrusted, so control characters are dropped.
+func reportSSHBanner(hostAddress, label, text string) {
+	for line := range strings.SplitSeq(normalizeLF(text), "\n") {
+		line = strings.TrimRightFunc(sanitizeBannerLine(line), unicode.IsSpace)
+		if line == "" {
+			continue
+		}
+		message := fmt.Sprintf("<%s> %s: %s\n", hostAddress, label, line)
+		if verboseOutput.Load() {
+			outputPrint(message)
+			continue
+		}
+		if runLogWriter != nil {
+			_, _ = fmt.Fprint(runLogWriter, message)
+		}
+	}
+}
+
+func sanitizeBannerLine(line string) string {
+	return strings.Map(func(character rune) rune {
+		if character == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(character) {
+			return -1
+		}
+		return character
+	}, line)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func stubSSHDialWithBanner(t *testing.T, banner string) {
+	t.Helper()
+
+	stubSSHDialHook(t, func(_, _ string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+		if err := clientConfig.BannerCallback(banner); err != nil {
+			return nil, err
+		}
+		client, cleanup := newInMemorySSHClient(t, clientConfig, func(string, string) (string, string, uint32) { return "", "", 0 })
+		t.Cleanup(cleanup)
+		return client, nil
+	})
+}
+
+func TestDialSSHPrintsBannerWithVerbose(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	t.Cleanup(configureVerbose(true))
+	stubSSHDialWithBanner(t, "Authorized use only\r\n\x1b[31mRouter OS\x1b[0m\n")
+
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("x")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	if _, err := dialSSH("tcp", "app01:22", clientConfig); err != nil {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+
+	output := outputBuffer.String()
+	for _, want := range []string{
+		"<app01:22> banner: Authorized use only\n",
+		"<app01:22> banner: [31mRouter OS[0m\n",
+		"<app01:22> server version: SSH-2.0-Go\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("output missing %q:\n%q", want, output)
+		}
+	}
+}
+
+func TestDialSSHLogsBannerWithoutVerbose(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	logBuffer := &bytes.Buffer{}
+	previousLogWriter := runLogWriter
+	runLogWriter = logBuffer
+	t.Cleanup(func() { runLogWriter = previousLogWriter })
+	stubSSHDialWithBanner(t, "Welcome\n")
+
+	clientConfig := &ssh.ClientConfig{User: "deploy", Auth: []ssh.AuthMethod{ssh.Password("x")}, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+	if _, err := dialSSH("tcp", "app01:22", clientConfig); err != nil {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+
+	if strings.Contains(outputBuffer.String(), "banner") {
+		t.Fatalf("banner printed without --verbose: %q", outputBuffer.String())
+	}
+	if !strings.Contains(logBuffer.String(), "<app01:22> banner: Welcome\n") {
+		t.Fatalf("run log = %q, want banner line", logBuffer.String())
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+var (
+	lookPathForSSM   = exec.LookPath
+	ssmTargetPattern = regexp.MustCompile(`^m?i-[0-9a-f]{8,17}$`)
+)
+
+// ssmTransport reaches hosts through AWS Systems Manager Session Manager
+// with the AWS-StartSSHSession document, like the ProxyCommand AWS documents
+// for OpenSSH. Hosts are instance or managed node IDs (i-0123456789abcdef0,
+// mi-...); the aws CLI and its session-manager-plugin must be installed and
+// take credentials and region from the usual AWS environment and profile.
+type ssmTransport struct{}
+
+func (ssmTransport) Name() string {
+	return "ssm"
+}
+
+func (ssmTransport) Dial(_, address string, _ time.Duration) (net.Conn, error) {
+	target, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !ssmTargetPattern.MatchString(target) {
+		return nil, fmt.Errorf("host must be an EC2 instance or managed node ID (i-... or mi-...), got %q", target)
+	}
+	awsPath, err := lookPathForSSM("aws")
+	if err != nil {
+		return nil, fmt.Errorf("aws CLI not found: %w", err)
+	}
+	command := exec.Command(awsPath, "ssm", "start-session", // #nosec G204 -- binary is resolved from PATH; target is validated above
+		"--target", target,
+		"--document-name", "AWS-StartSSHSession",
+		"--parameters", "portNumber="+port)
+	return startCommandConn(command, "aws ssm start-session")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stateDir is where runs leave files for later runs (run log, ledger, last
+// run): $XDG_STATE_HOME/ssh-key-bootstrap, or ~/.local/state/ssh-key-bootstrap
+// when XDG_STATE_HOME is unset.
+func stateDir() (string, error) {
+	if base := strings.TrimSpace(os.Getenv("XDG_STATE_HOME")); filepath.IsAbs(base) {
+		return filepath.Join(base, appName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", appName), nil
+}
+
+// stateFilePath returns where the state file name lives and creates its
+// directory. A file that earlier versions kept next to the binary stays
+// there, so an existing run log or ledger is not split in two; new files go
+// to stateDir, since the binary often sits in a directory such as
+// /usr/local/bin that the operator cannot write to. Container mode never
+// looks next to the binary.
+func stateFilePath(name string) (string, error) {
+	if executablePath, err := os.Executable(); err == nil && !containerModeEnabled() {
+		legacyPath := filepath.Join(filepath.Dir(executablePath), name)
+		if info, err := os.Stat(legacyPath); err == nil && info.Mode().IsRegular() {
+			return legacyPath, nil
+		}
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create state directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
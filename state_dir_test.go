@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateFilePathPrefersExistingFileNextToBinary(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	name := "state-dir-test.json"
+
+	path, err := stateFilePath(name)
+	if err != nil {
+		t.Fatalf("stateFilePath() error = %v", err)
+	}
+	if want := filepath.Join(stateHome, appName, name); path != want {
+		t.Fatalf("stateFilePath() = %q, want %q", path, want)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Fatalf("state directory not created: %v", err)
+	}
+
+	executablePath, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() error = %v", err)
+	}
+	legacyPath := filepath.Join(filepath.Dir(executablePath), name)
+	if err := os.WriteFile(legacyPath, []byte("{}"), 0o600); err != nil {
+		t.Skipf("cannot write next to the test binary: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Remove(legacyPath) })
+	if path, err := stateFilePath(name); err != nil || path != legacyPath {
+		t.Fatalf("stateFilePath() = %q, %v; want the existing %q", path, err, legacyPath)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const (
+	statusLineRefresh = time.Second
+	// statusLineWidth is used when the terminal does not report its width.
+	statusLineWidth = 80
+)
+
+// hostStatus is what the run is doing on the host it works on: the
+// operation and the phase of it, and since when.
+type hostStatus struct {
+	host      string
+	operation string
+	phase     string
+	since     time.Time
+}
+
+// statusLine is the status area at the bottom of an interactive run: one
+// line for the host being worked on and one with the run's progress, redrawn
+// in place every second so a slow host shows what it is waiting on. Output
+// is written above it; the area is cleared before every write and drawn
+// again once the cursor is back at the start of a line, so it never ends up
+// in the middle of a prompt.
+type statusLine struct {
+	mu          sync.Mutex
+	terminal    *os.File
+	current     *hostStatus
+	progress    string
+	drawnLines  int
+	atLineStart bool
+	now         func() time.Time
+}
+
+var (
+	activeStatusLineMu sync.Mutex
+	activeStatusLine   *statusLine
+)
+
+// startStatusLine shows the status area while the operations run, when
+// stdin and stdout are a terminal and stdout carries no event stream. The
+// returned function clears it.
+func startStatusLine(programOptions *options) func() {
+	terminal := standardOutputFile()
+	if programOptions.StreamHosts || programOptions.Events != "" || !isTerminal(terminal) || !currentPrompter().Interactive(standardInputFile()) {
+		return func() {}
+	}
+	line := &statusLine{terminal: terminal, atLineStart: true, now: time.Now}
+	outputWriter, errorWriter := getStandardOutputWriter(), getStandardErrorWriter()
+	setStandardWriters(&statusLineWriter{next: outputWriter, line: line}, &statusLineWriter{next: errorWriter, line: line})
+	activeStatusLineMu.Lock()
+	activeStatusLine = line
+	activeStatusLineMu.Unlock()
+
+	stopRefresh := make(chan struct{})
+	refreshDone := make(chan struct{})
+	go func() {
+		defer close(refreshDone)
+		ticker := time.NewTicker(statusLineRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				line.redraw()
+			case <-stopRefresh:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stopRefresh)
+		<-refreshDone
+		activeStatusLineMu.Lock()
+		activeStatusLine = nil
+		activeStatusLineMu.Unlock()
+		line.mu.Lock()
+		line.clearLocked()
+		line.mu.Unlock()
+		setStandardWriters(outputWriter, errorWriter)
+	}
+}
+
+func currentStatusLine() *statusLine {
+	activeStatusLineMu.Lock()
+	defer activeStatusLineMu.Unlock()
+	return activeStatusLine
+}
+
+// beginHostStatus shows host as busy with operation until the returned
+// function is called. Hosts run one at a time, so it replaces any host shown
+// before.
+func beginHostStatus(host, operation string) func() {
+	line := currentStatusLine()
+	if line == nil {
+		return func() {}
+	}
+	status := &hostStatus{host: host, operation: operation, phase: "applying", since: line.now()}
+	line.mu.Lock()
+	line.current = status
+	line.drawLocked()
+	line.mu.Unlock()
+	return func() {
+		line.mu.Lock()
+		if line.current == status {
+			line.current = nil
+		}
+		line.drawLocked()
+		line.mu.Unlock()
+	}
+}
+
+// reportHostPhase moves host to phase when it is the host being worked on;
+// other hosts, such as the --validate-auth check, are ignored.
+func reportHostPhase(host, phase string) {
+	line := currentStatusLine()
+	if line == nil {
+		return
+	}
+	line.mu.Lock()
+	defer line.mu.Unlock()
+	if status := line.current; status != nil && status.host == host && status.phase != phase {
+		status.phase = phase
+		status.since = line.now()
+		line.drawLocked()
+	}
+}
+
+// withPhaseReport reports the authenticating phase once hostAddress's host
+// key is accepted, when the status area is shown.
+func withPhaseReport(hostAddress string, clientConfig *ssh.ClientConfig) *ssh.ClientConfig {
+	if currentStatusLine() == nil || clientConfig.HostKeyCallback == nil {
+		return clientConfig
+	}
+	reportingConfig := *clientConfig
+	nextCallback := clientConfig.HostKeyCallback
+	reportingConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := nextCallback(hostname, remote, key); err != nil {
+			return err
+		}
+		reportHostPhase(hostAddress, "authenticating")
+		return nil
+	}
+	return &reportingConfig
+}
+
+// reportStatusProgress shows text, the run's progress, below the host;
+// an empty text removes it.
+func reportStatusProgress(text string) {
+	line := currentStatusLine()
+	if line == nil {
+		return
+	}
+	line.mu.Lock()
+	defer line.mu.Unlock()
+	line.progress = text
+	line.drawLocked()
+}
+
+// noteEchoedLine accounts for a line the operator typed, such as a run key:
+// the terminal echoed it below the status area, so clearing starts one line
+// further up.
+func noteEchoedLine() {
+	line := currentStatusLine()
+	if line == nil {
+		return
+	}
+	line.mu.Lock()
+	defer line.mu.Unlock()
+	if line.drawnLines > 0 {
+		line.drawnLines++
+	}
+}
+
+func (line *statusLine) redraw() {
+	line.mu.Lock()
+	defer line.mu.Unlock()
+	line.drawLocked()
+}
+
+// drawLocked replaces the status area with the current host. It draws
+// nothing while a prompt or other partial line is on screen.
+func (line *statusLine) drawLocked() {
+	if !line.atLineStart {
+		return
+	}
+	line.clearLocked()
+	texts := make([]string, 0, 2)
+	if status := line.current; status != nil {
+		texts = append(texts, fmt.Sprintf("  %s: %s (%s, %s)", status.host, status.phase, status.operation, line.now().Sub(status.since).Round(time.Second)))
+	}
+	if line.progress != "" {
+		texts = append(texts, "  "+line.progress)
+	}
+	if len(texts) == 0 {
+		return
+	}
+	width := statusLineWidth
+	if fileDescriptor, ok := terminalFD(line.terminal); ok {
+		if columns, _, err := term.GetSize(fileDescriptor); err == nil && columns > 0 {
+			width = columns
+		}
+	}
+	var area bytes.Buffer
+	for index, text := range texts {
+		if index > 0 {
+			area.WriteString("\n")
+		}
+		// A wrapped line would throw off clearing the area. Cutting whole
+		// runes keeps a multi-byte host name or phase intact.
+		if runes := []rune(text); len(runes) > width-1 {
+			text = string(runes[:width-1])
+		}
+		area.WriteString(text)
+	}
+	_, _ = line.terminal.Write(area.Bytes())
+	line.drawnLines = len(texts)
+}
+
+func (line *statusLine) clearLocked() {
+	if line.drawnLines == 0 {
+		return
+	}
+	sequence := "\r\x1b[K"
+	if line.drawnLines > 1 {
+		sequence = fmt.Sprintf("\x1b[%dA\r\x1b[J", line.drawnLines-1)
+	}
+	_, _ = io.WriteString(line.terminal, sequence)
+	line.drawnLines = 0
+}
+
+// statusLineWriter writes run output above the status area.
+type statusLineWriter struct {
+	next io.Writer
+	line *statusLine
+}
+
+func (writer *statusLineWriter) Write(data []byte) (int, error) {
+	writer.line.mu.Lock()
+	defer writer.line.mu.Unlock()
+	writer.line.clearLocked()
+	written, err := writer.next.Write(data)
+	if len(data) > 0 {
+		writer.line.atLineStart = data[len(data)-1] == '\n'
+	}
+	writer.line.drawLocked()
+	return written, err
+}
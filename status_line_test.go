@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func useStatusLineForTest(t *testing.T) (*statusLine, func() string) {
+	t.Helper()
+	terminal, err := os.Create(filepath.Join(t.TempDir(), "terminal"))
+	if err != nil {
+		t.Fatalf("create terminal file: %v", err)
+	}
+	t.Cleanup(func() { _ = terminal.Close() })
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	line := &statusLine{terminal: terminal, atLineStart: true, now: func() time.Time { return now }}
+	activeStatusLineMu.Lock()
+	activeStatusLine = line
+	activeStatusLineMu.Unlock()
+	t.Cleanup(func() {
+		activeStatusLineMu.Lock()
+		activeStatusLine = nil
+		activeStatusLineMu.Unlock()
+	})
+	return line, func() string {
+		content, err := os.ReadFile(terminal.Name())
+		if err != nil {
+			t.Fatalf("read terminal file: %v", err)
+		}
+		return string(content)
+	}
+}
+
+func TestStatusLineShowsHostPhases(t *testing.T) {
+	line, screen := useStatusLineForTest(t)
+
+	endHostStatus := beginHostStatus("app01:22", "install-key")
+	reportHostPhase("app01:22", "dialing")
+	reportHostPhase("app02:22", "dialing")
+	reportHostPhase("app01:22", "authenticating")
+	endHostStatus()
+
+	want := "  app01:22: applying (install-key, 0s)" +
+		"\r\x1b[K  app01:22: dialing (install-key, 0s)" +
+		"\r\x1b[K  app01:22: authenticating (install-key, 0s)" +
+		"\r\x1b[K"
+	if got := screen(); got != want {
+		t.Fatalf("terminal = %q, want %q", got, want)
+	}
+	if line.drawnLines != 0 {
+		t.Fatalf("drawnLines = %d after the host ended", line.drawnLines)
+	}
+}
+
+func TestStatusLineTruncatesWholeRunes(t *testing.T) {
+	_, screen := useStatusLineForTest(t)
+
+	beginHostStatus(strings.Repeat("é", 100)+":22", "install-key")
+
+	got := screen()
+	if !utf8.ValidString(got) {
+		t.Fatalf("status line cut a rune: %q", got)
+	}
+	if runes := utf8.RuneCountInString(got); runes != statusLineWidth-1 {
+		t.Fatalf("status line has %d runes, want %d", runes, statusLineWidth-1)
+	}
+}
+
+func TestStatusLineWriterKeepsAreaBelowOutputAndOutOfPrompts(t *testing.T) {
+	line, screen := useStatusLineForTest(t)
+	var output bytes.Buffer
+	writer := &statusLineWriter{next: &output, line: line}
+	beginHostStatus("app01:22", "install-key")
+	reportStatusProgress("1/2 host tasks done")
+
+	_, _ = writer.Write([]byte("Trust host? [y/N]: "))
+	line.redraw()
+	if line.drawnLines != 0 {
+		t.Fatalf("status area drawn over a prompt: %q", screen())
+	}
+	_, _ = writer.Write([]byte("ok: [app01:22]\n"))
+
+	want := "  app01:22: applying (install-key, 0s)" +
+		"\r\x1b[K  app01:22: applying (install-key, 0s)\n  1/2 host tasks done" +
+		"\x1b[1A\r\x1b[J" +
+		"  app01:22: applying (install-key, 0s)\n  1/2 host tasks done"
+	if got := screen(); got != want {
+		t.Fatalf("terminal = %q, want %q", got, want)
+	}
+	if output.String() != "Trust host? [y/N]: ok: [app01:22]\n" {
+		t.Fatalf("output = %q", output.String())
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ssh-key-bootstrap/messages"
+)
+
+// --stream-hosts runs each host as soon as its servers-file line is read,
+// instead of reading, sorting and de-duplicating the whole inventory first,
+// so a run over millions of lines starts connecting right away and does not
+// hold the file in memory. Hosts run in file order, each through all of its
+// operations before the next one is read; a host listed twice runs once.
+
+// streamedRun is what runOperations has prepared before it hands the hosts
+// over to runStreamedHosts.
+type streamedRun struct {
+	operationList string
+	runID         string
+	startedAt     time.Time
+	inputReader   *bufio.Reader
+	operations    []remoteOperation
+	usesPublicKey bool
+	fileCopy      remoteFileCopy
+	remoteCommand string
+	keyExpiry     string
+}
+
+// validateStreamHosts rejects the options that need every host before the
+// first connection.
+func validateStreamHosts(programOptions *options) error {
+	if strings.TrimSpace(programOptions.ServersFile) == "" {
+		return errors.New("--stream-hosts needs --servers-file")
+	}
+	conflicts := []struct {
+		set  bool
+		name string
+	}{
+		{strings.TrimSpace(programOptions.Server) != "" || strings.TrimSpace(programOptions.Servers) != "", "SERVER/SERVERS"},
+		{len(programOptions.Hosts) > 0, "a JSON hosts array"},
+		{strings.TrimSpace(programOptions.HostsFile) != "", "--hosts-file"},
+		{strings.TrimSpace(programOptions.Discover) != "", "--discover"},
+		{strings.TrimSpace(programOptions.NmapXML) != "", "--nmap-xml"},
+		{strings.TrimSpace(programOptions.NetBoxURL) != "", "--netbox-url"},
+		{strings.TrimSpace(programOptions.ZabbixURL) != "", "--zabbix-url"},
+		{strings.TrimSpace(programOptions.NagiosCfg) != "", "--nagios-cfg"},
+		{strings.TrimSpace(programOptions.LDAPURL) != "", "--ldap-url"},
+		{len(programOptions.RepeatHosts) > 0, "--again"},
+		{strings.TrimSpace(programOptions.Sample) != "", "--sample"},
+		{programOptions.DedupeIP, "--dedupe-ip"},
+		{strings.TrimSpace(programOptions.PlanFormat) != "", "--plan"},
+		{strings.TrimSpace(programOptions.ApproveCmd) != "", "--approve-cmd"},
+		{programOptions.WaitUp > 0, "--wait-up"},
+		{programOptions.Watch > 0, "--watch"},
+		{strings.TrimSpace(programOptions.ValidateAuth) != "", "--validate-auth"},
+		{programOptions.MaxHostsPerPassword > 0, "--require-per-host-credentials"},
+		{!isInputHostOrder(programOptions.Order), "--order " + strings.TrimSpace(programOptions.Order)},
+	}
+	for _, conflict := range conflicts {
+		if conflict.set {
+			return fmt.Errorf("--stream-hosts cannot be combined with %s, which needs every host before the first connection", conflict.name)
+		}
+	}
+	// The host count is unknown until the file is read, so the large-run
+	// confirmation cannot be asked.
+	if !programOptions.AssumeYes {
+		return errors.New("--stream-hosts cannot confirm a run whose size is unknown; pass --yes")
+	}
+	return nil
+}
+
+// isInputHostOrder reports whether --order leaves hosts in file order, the
+// only order a streamed run can have. Unset counts too, since streaming
+// replaces the default sorting.
+func isInputHostOrder(value string) bool {
+	order := strings.TrimSpace(value)
+	return order == "" || strings.EqualFold(order, hostOrderInput)
+}
+
+// runStreamedHosts collects the remaining inputs, then reads the servers file
+// line by line and runs every operation on each new host as it is read. An
+// invalid entry stops the run after the hosts before it, which still get
+// their recap and reports.
+func runStreamedHosts(programOptions *options, run streamedRun) error {
+	if err := validateStreamHosts(programOptions); err != nil {
+		return fail(2, "%w", err)
+	}
+	// Prompts must not read host lines piped on stdin; they see end of input.
+	promptReader := run.inputReader
+	if strings.TrimSpace(programOptions.ServersFile) == stdinServersFile {
+		promptReader = bufio.NewReader(strings.NewReader(""))
+	}
+	if strings.TrimSpace(programOptions.KeysDir) != "" {
+		outputAnsibleTask("Review team keys")
+		if err := reviewKeysDir(promptReader, programOptions); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+
+	outputAnsibleTask(messages.Get(messages.TaskCollectMissingInputs))
+	if err := fillMissingInputs(promptReader, programOptions, run.usesPublicKey); err != nil {
+		return fail(2, "%w", err)
+	}
+	// Which hosts lack a secret ref of their own is only known once they are
+	// read, so the shared password is asked for now unless a template covers
+	// every host.
+	if hasHostPasswordSecretRefs(programOptions) && strings.TrimSpace(programOptions.PasswordSecretRefTemplate) == "" {
+		if err := fillMissingPassword(promptReader, programOptions); err != nil {
+			return fail(2, "%w", err)
+		}
+	}
+	hostLimit, err := parseHostLimit(programOptions.Limit)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	unlockRun, err := lockRun(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer unlockRun()
+
+	outputAnsibleTask(messages.Get(messages.TaskBuildSSHConfiguration))
+	clientConfig, err := buildSSHConfig(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	outputAnsibleHostStatus("ok", "localhost", "")
+
+	executor, err := newRemoteExecutor(programOptions)
+	if err != nil {
+		return fail(2, "%w", err)
+	}
+	defer executor.closeAll()
+	authMethods := authMethodOrder(programOptions)
+
+	emitEvent(runEvent{Event: "run_started"})
+	outputAnsibleTask(messages.Get(messages.TaskReadServersFile))
+	outputAnsibleHostStatus("ok", "localhost", "streaming hosts from "+serversFileLabel(programOptions.ServersFile))
+
+	var (
+		hosts         []string
+		seenHosts     = map[string]struct{}{}
+		skippedHosts  int
+		hostRecaps    = map[string]hostRunRecap{}
+		failedHosts   = map[string]bool{}
+		notesByHost   = map[string]serverEntryNotes{}
+		hostGroups    = map[string]string{}
+		publicKeys    []string
+		keyInput      string
+		taskOperation string
+		pacer         = &hostPacer{}
+	)
+	visit := func(entry string, entryNotes serverEntryNotes) error {
+		host, err := normalizeHost(strings.TrimSpace(entry), programOptions.Port)
+		if err != nil {
+			return fmt.Errorf("invalid server %q: %w", entry, err)
+		}
+		if _, seen := seenHosts[host]; seen {
+			return nil
+		}
+		seenHosts[host] = struct{}{}
+		if !hostLimit.allows(host) {
+			skippedHosts++
+			return nil
+		}
+
+		// Every host shares the key, so it is resolved once, for the first.
+		if run.usesPublicKey && publicKeys == nil {
+			hostKeys, keyInputs, err := resolveHostPublicKeys(programOptions, []string{host}, nil)
+			if err != nil {
+				return err
+			}
+			publicKeys, keyInput = hostKeys[host], keyInputs[host]
+		}
+		hostPasswords := map[string]string{}
+		if hasHostPasswordSecretRefs(programOptions) {
+			if hostPasswords, err = resolveHostPasswords(programOptions, []string{host}, nil); err != nil {
+				return fmt.Errorf("%s: %w", host, err)
+			}
+		}
+		hostSetting := buildHostSettings(programOptions, []string{host}, nil, hostPasswords,
+			map[string][]string{host: publicKeys}, map[string]string{host: keyInput})[host]
+
+		hosts = append(hosts, host)
+		if entryNotes.group != "" {
+			hostGroups[host] = entryNotes.group
+		}
+		pacer.pause()
+		recap := hostRecaps[host]
+		clientConfigForHost := clientConfigForLogin(clientConfig, authMethods, hostSetting.User, hostSetting.Password)
+		input := remoteOperationInputFor(programOptions, host, hostSetting, run.fileCopy, run.remoteCommand)
+		for _, operation := range run.operations {
+			// Consecutive hosts share a task header while the operation is the same.
+			if operation.Name() != taskOperation {
+				outputAnsibleTask(operation.Title())
+				taskOperation = operation.Name()
+			}
+			if !runOperationOnHost(executor, host, operation, input, clientConfigForHost, &recap) {
+				failedHosts[host] = true
+				if entryNotes.hasNotes() {
+					notesByHost[host] = entryNotes
+				}
+				break
+			}
+		}
+		hostRecaps[host] = recap
+		// Connections are not reused across hosts, so each is closed once its
+		// host is done instead of piling up until the end of the run.
+		executor.release(host)
+		return nil
+	}
+	streamErr := walkServersFile(programOptions.ServersFile, run.inputReader, visit)
+	if len(hosts) == 0 {
+		switch {
+		case streamErr != nil:
+		case skippedHosts > 0:
+			streamErr = fmt.Errorf("--limit %q matched none of %d host(s)", programOptions.Limit, skippedHosts)
+		default:
+			streamErr = errors.New("no servers provided")
+		}
+		return fail(2, "%w", streamErr)
+	}
+	if streamErr != nil {
+		outputAnsibleTask(messages.Get(messages.TaskReadServersFile))
+		outputAnsibleHostStatus("failed", "localhost", streamErr.Error())
+	}
+
+	err = finishRun(programOptions, runOutcome{
+		operationList: run.operationList,
+		runID:         run.runID,
+		startedAt:     run.startedAt,
+		operations:    run.operations,
+		keyExpiry:     run.keyExpiry,
+		hosts:         hosts,
+		hostRecaps:    hostRecaps,
+		failedHosts:   failedHosts,
+		notesByHost:   notesByHost,
+		hostGroups:    hostGroups,
+		installedKeys: func(host string) (string, []string) {
+			return loginUser(executor, host, programOptions.User), publicKeys
+		},
+	})
+	if streamErr != nil {
+		return fail(2, "%w", streamErr)
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func writeStreamHostsEnv(t *testing.T) string {
+	t.Helper()
+
+	dotEnvPath := filepath.Join(t.TempDir(), ".env")
+	dotEnvContent := strings.Join([]string{
+		"USER=deploy",
+		"PASSWORD=password",
+		"KEY='" + strings.TrimSpace(generateTestKey(t)) + "'",
+		"INSECURE_IGNORE_HOST_KEY=true",
+		"TIMEOUT=1",
+		"",
+	}, "\n")
+	if err := os.WriteFile(dotEnvPath, []byte(dotEnvContent), 0o600); err != nil {
+		t.Fatalf("write .env file: %v", err)
+	}
+	return dotEnvPath
+}
+
+func TestStreamHostsConnectsBeforeTheServersFileIsRead(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	var dialedMu sync.Mutex
+	var dialed []string
+	firstDial := make(chan string, 1)
+	stubSSHDialHook(t, func(_ string, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		dialedMu.Lock()
+		dialed = append(dialed, address)
+		dialedMu.Unlock()
+		select {
+		case firstDial <- address:
+		default:
+		}
+		return nil, errors.New("handshake refused")
+	})
+
+	serversReader, serversWriter := io.Pipe()
+	failedHostsPath := filepath.Join(t.TempDir(), "failed.txt")
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", writeStreamHostsEnv(t),
+		"--servers-file", "-", "--stream-hosts", "--yes", "--failed-hosts-out", failedHostsPath})
+	var outputBuffer, errorBuffer bytes.Buffer
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(runtimeIO{Stdin: serversReader, Stdout: &outputBuffer, Stderr: &errorBuffer, Prompter: &scriptedPrompter{}})
+	}()
+
+	if _, err := io.WriteString(serversWriter, "app01\n"); err != nil {
+		t.Fatalf("write first host: %v", err)
+	}
+	select {
+	case address := <-firstDial:
+		if address != "app01:22" {
+			t.Fatalf("first dial = %q, want app01:22", address)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("app01 was not contacted before the rest of the servers file was written")
+	}
+	if _, err := io.WriteString(serversWriter, "# rack B\napp02\napp01\n"); err != nil {
+		t.Fatalf("write remaining hosts: %v", err)
+	}
+	_ = serversWriter.Close()
+
+	err := <-runErr
+	if err == nil || !strings.Contains(err.Error(), "2 host(s) failed") {
+		t.Fatalf("run() error = %v, want both hosts failed\n%s", err, outputBuffer.String())
+	}
+	dialedMu.Lock()
+	defer dialedMu.Unlock()
+	if strings.Join(dialed, ",") != "app01:22,app02:22" {
+		t.Fatalf("dialed %v, want each host once in file order", dialed)
+	}
+	if !strings.Contains(outputBuffer.String(), "PLAY RECAP") {
+		t.Fatalf("run output missing recap: %q", outputBuffer.String())
+	}
+	failedHosts, err := os.ReadFile(failedHostsPath)
+	if err != nil {
+		t.Fatalf("read failed hosts: %v", err)
+	}
+	if !strings.Contains(string(failedHosts), "# rack B\napp02:22") {
+		t.Fatalf("failed hosts file lost the comment of app02:\n%s", failedHosts)
+	}
+}
+
+func TestStreamHostsStopsAtAnInvalidEntry(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	var dialed []string
+	stubSSHDialHook(t, func(_ string, address string, _ *ssh.ClientConfig) (*ssh.Client, error) {
+		dialed = append(dialed, address)
+		return nil, errors.New("handshake refused")
+	})
+	serversPath := filepath.Join(t.TempDir(), "servers.txt")
+	if err := os.WriteFile(serversPath, []byte("app01\n[app02\napp03\n"), 0o600); err != nil {
+		t.Fatalf("write servers file: %v", err)
+	}
+
+	outputBuffer, _ := captureWriters(t)
+	setCommandLineForTest(t, []string{"ssh-key-bootstrap", "--env", writeStreamHostsEnv(t), "--servers-file", serversPath, "--stream-hosts", "--yes"})
+	err := run(capturedRuntimeIO())
+	if err == nil || exitCodeOf(err) != exitConfigError || !strings.Contains(err.Error(), `line 2: invalid server "[app02"`) {
+		t.Fatalf("run() error = %v, want a config error for line 2", err)
+	}
+	if strings.Join(dialed, ",") != "app01:22" {
+		t.Fatalf("dialed %v, want only the host before the invalid entry", dialed)
+	}
+	if !strings.Contains(outputBuffer.String(), "PLAY RECAP") {
+		t.Fatalf("hosts run before the invalid entry got no recap: %q", outputBuffer.String())
+	}
+}
+
+func TestValidateStreamHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		options options
+		wantErr string
+	}{
+		{"valid", options{ServersFile: "hosts.txt", AssumeYes: true}, ""},
+		{"noServersFile", options{AssumeYes: true}, "needs --servers-file"},
+		{"plan", options{ServersFile: "hosts.txt", AssumeYes: true, PlanFormat: "json"}, "combined with --plan"},
+		{"servers", options{ServersFile: "hosts.txt", AssumeYes: true, Servers: "app01"}, "combined with SERVER/SERVERS"},
+		{"dedupe", options{ServersFile: "hosts.txt", AssumeYes: true, DedupeIP: true}, "combined with --dedupe-ip"},
+		{"noYes", options{ServersFile: "hosts.txt"}, "pass --yes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateStreamHosts(&test.options)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateStreamHosts() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("validateStreamHosts() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
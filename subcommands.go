@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// subcommand is an alternative entrypoint selected by the first CLI argument
+// (for example `ssh-key-bootstrap expire --env ./.env`). Subcommands share the
+// global flag set, so config and credential flags work the same everywhere.
+type subcommand struct {
+	name      string
+	usage     string
+	summary   string
+	takesArgs bool
+	run       func(programOptions *options, args []string) error
+}
+
+func registeredSubcommands() []subcommand {
+	return []subcommand{
+		{name: "apply", usage: "apply <manifest.json>", summary: "Converge hosts to the keys declared in a manifest", takesArgs: true, run: runApplyCommand},
+		{name: "copy", usage: "copy --src <f> --dest <p>", summary: "Copy a file to every host, e.g. a sudoers drop-in (--mode sets its mode)", run: runCopyCommand},
+		{name: "doctor", usage: "doctor", summary: "Check known_hosts, ssh-agent, provider CLIs and the terminal, and suggest fixes", run: runDoctorCommand},
+		{name: "drift", usage: "drift [manifest.json]", summary: "Report hosts whose authorized_keys differ from the ledger or a manifest", takesArgs: true, run: runDriftCommand},
+		{name: "exec", usage: "exec --cmd <command>", summary: "Run a command on every host and show its output", run: runExecCommand},
+		{name: "expire", usage: "expire", summary: "Remove ledger-recorded keys whose expiry date has passed", run: runExpireCommand},
+		{name: "history", usage: "history [host]", summary: "List recorded installations, optionally for one host", takesArgs: true, run: runHistoryCommand},
+		{name: "init", usage: "init [path]", summary: "Interactively write a first .env (or .json) config", takesArgs: true, run: runInitCommand},
+		{name: "install-service", usage: "install-service <check|apply>", summary: "Write a systemd timer (or print a cron line) that runs drift or apply on a schedule", takesArgs: true, run: runInstallServiceCommand},
+		{name: "shell", usage: "shell <host>", summary: "Open an interactive SSH session with the configured credentials and host key policy", takesArgs: true, run: runShellCommand},
+		{name: "tunnel", usage: "tunnel <host> [bind:]port:target:port", summary: "Forward a local port to a service reachable from a host", takesArgs: true, run: runTunnelCommand},
+		{name: "version", usage: "version [--json]", summary: "Print version, build and supported features", run: runVersionCommand},
+		{name: "where-is-key", usage: "where-is-key <fingerprint>", summary: "List hosts where a key is currently installed", takesArgs: true, run: runWhereIsKeyCommand},
+	}
+}
+
+func subcommandByName(name string) (subcommand, bool) {
+	trimmedName := strings.TrimSpace(name)
+	for _, command := range registeredSubcommands() {
+		if command.name == trimmedName {
+			return command, true
+		}
+	}
+	return subcommand{}, false
+}
+
+// extractSubcommand removes a leading subcommand name from os.Args so the
+// remaining arguments can be parsed by the shared flag set.
+func extractSubcommand() (subcommand, bool) {
+	if len(os.Args) < 2 {
+		return subcommand{}, false
+	}
+	command, ok := subcommandByName(os.Args[1])
+	if !ok {
+		return subcommand{}, false
+	}
+	os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	return command, true
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"time"
+)
+
+var lookPathForTeleport = exec.LookPath
+
+// teleportTransport reaches hosts through a Teleport proxy with
+// `tsh proxy ssh`, the ProxyCommand Teleport documents for OpenSSH. Hosts are
+// Teleport node names. tsh must be logged in (`tsh login`); the proxy and
+// cluster come from its profile or TELEPORT_PROXY and TELEPORT_CLUSTER.
+type teleportTransport struct{}
+
+func (teleportTransport) Name() string {
+	return "teleport"
+}
+
+func (teleportTransport) Dial(user, address string, _ time.Duration) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, err
+	}
+	if user == "" {
+		return nil, errors.New("a login user is required to open a Teleport session")
+	}
+	tshPath, err := lookPathForTeleport("tsh")
+	if err != nil {
+		return nil, errors.New("tsh not found: install the Teleport client and run tsh login")
+	}
+	command := exec.Command(tshPath, "proxy", "ssh", user+"@"+address) // #nosec G204 -- binary is resolved from PATH; arguments are not passed to a shell
+	return startCommandConn(command, "tsh proxy ssh")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultTransportName = "tcp"
+
+// helperWaitDelay bounds how long closing a transport helper waits for
+// processes it started that still hold its output open.
+const helperWaitDelay = time.Second
+
+// transportDialer opens the byte stream an SSH connection runs over, for
+// hosts without a routable SSH port (--transport). The SSH handshake, host
+// key check and login run over it unchanged. user is the login user, which
+// brokers such as Teleport need to authorize the session.
+type transportDialer interface {
+	Name() string
+	Dial(user, address string, timeout time.Duration) (net.Conn, error)
+}
+
+var (
+	transportRegistryMu sync.RWMutex
+	transportRegistry   []transportDialer
+
+	activeTransportMu sync.Mutex
+	// activeTransport is nil for plain TCP, which dials through sshDial.
+	activeTransport transportDialer
+)
+
+func init() {
+	registerTransport(ssmTransport{})
+	registerTransport(teleportTransport{})
+	registerTransport(boundaryTransport{})
+}
+
+// registerTransport adds a transport, replacing one with the same name.
+func registerTransport(transport transportDialer) {
+	transportRegistryMu.Lock()
+	defer transportRegistryMu.Unlock()
+
+	for index, registeredTransport := range transportRegistry {
+		if strings.EqualFold(registeredTransport.Name(), transport.Name()) {
+			transportRegistry[index] = transport
+			return
+		}
+	}
+	transportRegistry = append(transportRegistry, transport)
+}
+
+func transportNames() []string {
+	transportRegistryMu.RLock()
+	defer transportRegistryMu.RUnlock()
+
+	names := []string{defaultTransportName}
+	for _, transport := range transportRegistry {
+		names = append(names, transport.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+// configureTransport selects the transport every built-in SSH connection
+// uses. The returned function switches back to TCP.
+func configureTransport(name string) (func(), error) {
+	trimmedName := strings.ToLower(strings.TrimSpace(name))
+	if trimmedName == "" || trimmedName == defaultTransportName {
+		return func() {}, nil
+	}
+
+	transportRegistryMu.RLock()
+	index := slices.IndexFunc(transportRegistry, func(transport transportDialer) bool {
+		return strings.EqualFold(transport.Name(), trimmedName)
+	})
+	var transport transportDialer
+	if index >= 0 {
+		transport = transportRegistry[index]
+	}
+	transportRegistryMu.RUnlock()
+	if transport == nil {
+		return nil, fmt.Errorf("unknown transport %q (valid: %s)", name, strings.Join(transportNames(), ", "))
+	}
+
+	activeTransportMu.Lock()
+	activeTransport = transport
+	activeTransportMu.Unlock()
+	return func() {
+		activeTransportMu.Lock()
+		activeTransport = nil
+		activeTransportMu.Unlock()
+	}, nil
+}
+
+// dialSSHOverTransport dials like sshDial, through the --jump host or over
+// the configured transport when one is set.
+func dialSSHOverTransport(network, address string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	activeTransportMu.Lock()
+	transport := activeTransport
+	activeTransportMu.Unlock()
+	jumpPool := currentJumpPool()
+	if transport == nil && jumpPool == nil {
+		return sshDial(network, address, clientConfig)
+	}
+
+	var connection net.Conn
+	var err error
+	if jumpPool != nil {
+		connection, err = jumpPool.Dial(address, clientConfig)
+	} else {
+		connection, err = transport.Dial(clientConfig.User, address, clientConfig.Timeout)
+		if err != nil {
+			err = fmt.Errorf("%s transport: %w", transport.Name(), err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	clientConnection, channels, requests, err := ssh.NewClientConn(connection, address, clientConfig)
+	if err != nil {
+		_ = connection.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConnection, channels, requests), nil
+}
+
+// commandConn is a net.Conn over a helper process's stdin and stdout, the way
+// OpenSSH's ProxyCommand carries a connection.
+type commandConn struct {
+	command  *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   io.ReadCloser
+	stderr   *lockedBuffer
+	label    string
+	received bool
+	closing  sync.Once
+}
+
+// startCommandConn starts command and returns its stdio as a connection.
+func startCommandConn(command *exec.Cmd, label string) (*commandConn, error) {
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &lockedBuffer{}
+	command.Stderr = stderr
+	command.WaitDelay = helperWaitDelay
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", label, err)
+	}
+	return &commandConn{command: command, stdin: stdin, stdout: stdout, stderr: stderr, label: label}, nil
+}
+
+// Read returns the helper's error output in place of an EOF that arrives
+// before any data, so a session that never started explains why.
+func (connection *commandConn) Read(buffer []byte) (int, error) {
+	count, err := connection.stdout.Read(buffer)
+	if count > 0 {
+		connection.received = true
+	}
+	if errors.Is(err, io.EOF) && !connection.received {
+		// The helper has exited; wait for it so its error output is complete.
+		_ = connection.Close()
+		if message := strings.TrimSpace(connection.stderr.String()); message != "" {
+			return count, fmt.Errorf("%s: %s", connection.label, message)
+		}
+	}
+	return count, err
+}
+
+func (connection *commandConn) Write(buffer []byte) (int, error) {
+	return connection.stdin.Write(buffer)
+}
+
+func (connection *commandConn) Close() error {
+	connection.closing.Do(func() {
+		_ = connection.stdin.Close()
+		if connection.command.Process != nil {
+			_ = connection.command.Process.Kill()
+		}
+		_ = connection.command.Wait()
+	})
+	return nil
+}
+
+func (connection *commandConn) LocalAddr() net.Addr  { return commandAddr(connection.label) }
+func (connection *commandConn) RemoteAddr() net.Addr { return commandAddr(connection.label) }
+
+// Deadlines are not supported on pipes; the SSH client does not rely on them.
+func (connection *commandConn) SetDeadline(time.Time) error      { return nil }
+func (connection *commandConn) SetReadDeadline(time.Time) error  { return nil }
+func (connection *commandConn) SetWriteDeadline(time.Time) error { return nil }
+
+type commandAddr string
+
+func (address commandAddr) Network() string { return "command" }
+func (address commandAddr) String() string  { return string(address) }
+
+// lockedBuffer collects a helper's stderr while the connection reads it.
+type lockedBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *lockedBuffer) Write(data []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	// Keep the start of the output; it names the failure.
+	if remaining := 4096 - buffer.buffer.Len(); remaining > 0 {
+		buffer.buffer.Write(data[:min(len(data), remaining)])
+	}
+	return len(data), nil
+}
+
+func (buffer *lockedBuffer) String() string {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	return buffer.buffer.String()
+}
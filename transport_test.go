@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// pipeTransport hands out one end of a socket pair whose other end runs an
+// SSH server, standing in for a tunnel such as SSM.
+type pipeTransport struct {
+	t       *testing.T
+	dialled []string
+}
+
+func (transport *pipeTransport) Name() string { return "pipe" }
+
+func (transport *pipeTransport) Dial(_, address string, _ time.Duration) (net.Conn, error) {
+	transport.dialled = append(transport.dialled, address)
+	clientConn, serverConn, _ := newSocketPair(transport.t)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(newTestHostSigner(transport.t))
+	go func() {
+		connection, channels, requests, err := ssh.NewServerConn(serverConn, serverConfig)
+		if err != nil {
+			return
+		}
+		defer connection.Close()
+		go ssh.DiscardRequests(requests)
+		for newChannel := range channels {
+			_ = newChannel.Reject(ssh.Prohibited, "test server")
+		}
+	}()
+	return clientConn, nil
+}
+
+func newTestHostSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+	return signer
+}
+
+func TestDialSSHUsesConfiguredTransport(t *testing.T) {
+	transport := &pipeTransport{t: t}
+	registerTransport(transport)
+	stubSSHDialHook(t, func(string, string, *ssh.ClientConfig) (*ssh.Client, error) {
+		t.Fatalf("a configured transport must replace the TCP dial")
+		return nil, nil
+	})
+	restoreTransport, err := configureTransport("pipe")
+	if err != nil {
+		t.Fatalf("configureTransport() error = %v", err)
+	}
+	defer restoreTransport()
+
+	client, err := dialSSH("tcp", "i-0123456789abcdef0:22", &ssh.ClientConfig{User: "ec2-user", HostKeyCallback: ssh.InsecureIgnoreHostKey()}) // #nosec G106 -- test server
+	if err != nil {
+		t.Fatalf("dialSSH() error = %v", err)
+	}
+	defer client.Close()
+	if !slices.Equal(transport.dialled, []string{"i-0123456789abcdef0:22"}) {
+		t.Fatalf("dialled = %q", transport.dialled)
+	}
+}
+
+func TestConfigureTransportRejectsUnknownName(t *testing.T) {
+	if _, err := configureTransport("carrier-pigeon"); err == nil || !strings.Contains(err.Error(), "valid: ") || !strings.Contains(err.Error(), "ssm") {
+		t.Fatalf("configureTransport() error = %v", err)
+	}
+	restore, err := configureTransport("TCP")
+	if err != nil {
+		t.Fatalf("configureTransport(TCP) error = %v", err)
+	}
+	restore()
+}
+
+func TestSSMTransportStartsSSHSession(t *testing.T) {
+	originalLookPath := lookPathForSSM
+	t.Cleanup(func() { lookPathForSSM = originalLookPath })
+
+	scriptPath := filepath.Join(t.TempDir(), "aws")
+	// The fake aws CLI prints its arguments, like a session that echoes data.
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho \"$@\"\n"), 0o700); err != nil { // #nosec G306 -- test helper script
+		t.Fatalf("write fake aws: %v", err)
+	}
+	lookPathForSSM = func(string) (string, error) { return scriptPath, nil }
+
+	connection, err := (ssmTransport{}).Dial("ec2-user", "i-0123456789abcdef0:2222", time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer connection.Close()
+	output, err := io.ReadAll(connection)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	if want := "ssm start-session --target i-0123456789abcdef0 --document-name AWS-StartSSHSession --parameters portNumber=2222\n"; string(output) != want {
+		t.Fatalf("aws args = %q, want %q", output, want)
+	}
+
+	if _, err := (ssmTransport{}).Dial("ec2-user", "app01.example.com:22", time.Second); err == nil || !strings.Contains(err.Error(), "instance or managed node ID") {
+		t.Fatalf("Dial(hostname) error = %v", err)
+	}
+}
+
+func TestCommandConnReportsHelperErrorInsteadOfEOF(t *testing.T) {
+	connection, err := startCommandConn(exec.Command("sh", "-c", "echo 'TargetNotConnected: i-0123 is not connected' >&2; exit 254"), "aws ssm start-session")
+	if err != nil {
+		t.Fatalf("startCommandConn() error = %v", err)
+	}
+	defer connection.Close()
+
+	_, err = io.ReadAll(connection)
+	if err == nil || err.Error() != "aws ssm start-session: TargetNotConnected: i-0123 is not connected" {
+		t.Fatalf("read error = %v", err)
+	}
+}
+
+func TestTeleportTransportProxiesThroughTsh(t *testing.T) {
+	originalLookPath := lookPathForTeleport
+	t.Cleanup(func() { lookPathForTeleport = originalLookPath })
+
+	scriptPath := filepath.Join(t.TempDir(), "tsh")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho \"$@\"\n"), 0o700); err != nil { // #nosec G306 -- test helper script
+		t.Fatalf("write fake tsh: %v", err)
+	}
+	lookPathForTeleport = func(string) (string, error) { return scriptPath, nil }
+
+	connection, err := (teleportTransport{}).Dial("deploy", "app01:22", time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer connection.Close()
+	output, err := io.ReadAll(connection)
+	if err != nil {
+		t.Fatalf("read session: %v", err)
+	}
+	if want := "proxy ssh deploy@app01:22\n"; string(output) != want {
+		t.Fatalf("tsh args = %q, want %q", output, want)
+	}
+}
+
+func TestBoundaryTransportConnectsThroughSessionProxy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = connection.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		_ = connection.Close()
+	}()
+
+	originalLookPath := lookPathForBoundary
+	t.Cleanup(func() { lookPathForBoundary = originalLookPath })
+	directory := t.TempDir()
+	argsPath := filepath.Join(directory, "args")
+	scriptPath := filepath.Join(directory, "boundary")
+	port := listener.Addr().(*net.TCPAddr).Port
+	script := "#!/bin/sh\necho \"$@\" > " + argsPath + "\n" +
+		"echo '{\"address\":\"127.0.0.1\",\"port\":" + strconv.Itoa(port) + ",\"session_id\":\"s_1234567890\"}'\nexec sleep 30\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0o700); err != nil { // #nosec G306 -- test helper script
+		t.Fatalf("write fake boundary: %v", err)
+	}
+	lookPathForBoundary = func(string) (string, error) { return scriptPath, nil }
+
+	connection, err := (boundaryTransport{}).Dial("deploy", "ttcp_1234567890:22", time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	banner, err := io.ReadAll(connection)
+	if err != nil || string(banner) != "SSH-2.0-OpenSSH_9.6\r\n" {
+		t.Fatalf("read = %q, %v", banner, err)
+	}
+	if err := connection.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	args, err := os.ReadFile(argsPath) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("read boundary args: %v", err)
+	}
+	if want := "connect -target-id ttcp_1234567890 -format json\n"; string(args) != want {
+		t.Fatalf("boundary args = %q, want %q", args, want)
+	}
+}
+
+func TestBoundaryTransportReportsConnectError(t *testing.T) {
+	originalLookPath := lookPathForBoundary
+	t.Cleanup(func() { lookPathForBoundary = originalLookPath })
+	scriptPath := filepath.Join(t.TempDir(), "boundary")
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\necho 'Error from controller: PermissionDenied' >&2\nexit 1\n"), 0o700); err != nil { // #nosec G306 -- test helper script
+		t.Fatalf("write fake boundary: %v", err)
+	}
+	lookPathForBoundary = func(string) (string, error) { return scriptPath, nil }
+
+	_, err := (boundaryTransport{}).Dial("deploy", "db-primary:22", time.Second)
+	if err == nil || err.Error() != "boundary connect: Error from controller: PermissionDenied" {
+		t.Fatalf("Dial() error = %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"ssh-key-bootstrap/messages"
+	"ssh-key-bootstrap/providers"
+)
+
+// Build metadata, set by release builds:
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the values come from the module and VCS stamps of go build.
+var (
+	version   = ""
+	commit    = ""
+	buildDate = ""
+)
+
+var readBuildInfo = debug.ReadBuildInfo
+
+// versionInfo is what the version command reports, so support requests and
+// scripts can check what a binary supports before relying on it.
+type versionInfo struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Commit    string          `json:"commit,omitempty"`
+	BuildDate string          `json:"buildDate,omitempty"`
+	GoVersion string          `json:"goVersion"`
+	Platform  string          `json:"platform"`
+	Providers []string        `json:"providers"`
+	Features  versionFeatures `json:"features"`
+}
+
+type versionFeatures struct {
+	Subcommands   []string `json:"subcommands"`
+	Operations    []string `json:"operations"`
+	Transports    []string `json:"transports"`
+	AuthMethods   []string `json:"authMethods"`
+	Locales       []string `json:"locales"`
+	EventFormats  []string `json:"eventFormats"`
+	ReportFormats []string `json:"reportFormats"`
+	Flags         []string `json:"flags"`
+}
+
+func collectVersionInfo() versionInfo {
+	info := versionInfo{
+		Name:      appName,
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Providers: providers.ProviderNames(providers.DefaultProviders()),
+	}
+	if buildInfo, ok := readBuildInfo(); ok {
+		if info.Version == "" && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		modified := false
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	slices.Sort(info.Providers)
+
+	for _, command := range registeredSubcommands() {
+		info.Features.Subcommands = append(info.Features.Subcommands, command.name)
+	}
+	info.Features.Operations = remoteOperationNames()
+	info.Features.Transports = transportNames()
+	info.Features.AuthMethods = []string{authMethodGSSAPI, authMethodPassword, authMethodPublicKey}
+	info.Features.Locales = messages.Locales()
+	info.Features.EventFormats = []string{eventsFormatNDJSON}
+	info.Features.ReportFormats = []string{reportFormatHTML, reportFormatMarkdown}
+	flag.VisitAll(func(registeredFlag *flag.Flag) {
+		info.Features.Flags = append(info.Features.Flags, registeredFlag.Name)
+	})
+	return info
+}
+
+func runVersionCommand(programOptions *options, args []string) error {
+	if len(args) > 0 {
+		return fail(2, "version takes no arguments")
+	}
+	info := collectVersionInfo()
+	if programOptions.JSONOutput {
+		encoder := json.NewEncoder(getStandardOutputWriter())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	output := getStandardOutputWriter()
+	fmt.Fprintf(output, "%s %s\n", info.Name, info.Version)
+	if info.Commit != "" {
+		fmt.Fprintf(output, "commit:      %s\n", info.Commit)
+	}
+	if info.BuildDate != "" {
+		fmt.Fprintf(output, "built:       %s\n", info.BuildDate)
+	}
+	fmt.Fprintf(output, "go:          %s %s\n", info.GoVersion, info.Platform)
+	fmt.Fprintf(output, "providers:   %s\n", strings.Join(info.Providers, ", "))
+	fmt.Fprintf(output, "operations:  %s\n", strings.Join(info.Features.Operations, ", "))
+	fmt.Fprintf(output, "transports:  %s\n", strings.Join(info.Features.Transports, ", "))
+	fmt.Fprintf(output, "locales:     %s\n", strings.Join(info.Features.Locales, ", "))
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVersionCommandJSONReportsBuildAndFeatures(t *testing.T) {
+	setCommandLineForTest(t, []string{appName, "--json"})
+	programOptions, _, err := parseCommandLine(false)
+	if err != nil {
+		t.Fatalf("parseCommandLine() error = %v", err)
+	}
+	originalReadBuildInfo := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = originalReadBuildInfo })
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main: debug.Module{Version: "v1.4.0"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "0123abcd"},
+				{Key: "vcs.time", Value: "2026-05-04T09:30:00Z"},
+				{Key: "vcs.modified", Value: "true"},
+			},
+		}, true
+	}
+	outputBuffer, _ := captureWriters(t)
+
+	if err := runVersionCommand(programOptions, nil); err != nil {
+		t.Fatalf("runVersionCommand() error = %v", err)
+	}
+	var info versionInfo
+	if err := json.Unmarshal(outputBuffer.Bytes(), &info); err != nil {
+		t.Fatalf("decode version JSON: %v\n%s", err, outputBuffer.String())
+	}
+	if info.Name != appName || info.Version != "v1.4.0" || info.Commit != "0123abcd-dirty" || info.BuildDate != "2026-05-04T09:30:00Z" {
+		t.Fatalf("build info = %+v", info)
+	}
+	for name, list := range map[string][]string{
+		"install-key": info.Features.Operations,
+		"ssm":         info.Features.Transports,
+		"version":     info.Features.Subcommands,
+		"ndjson":      info.Features.EventFormats,
+		"json":        info.Features.Flags,
+		"local":       info.Providers,
+	} {
+		if !slices.Contains(list, name) {
+			t.Fatalf("%q missing from %v", name, list)
+		}
+	}
+}
+
+func TestVersionCommandTextDefaultsToDev(t *testing.T) {
+	originalReadBuildInfo := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = originalReadBuildInfo })
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+	outputBuffer, _ := captureWriters(t)
+
+	if err := runVersionCommand(&options{}, nil); err != nil {
+		t.Fatalf("runVersionCommand() error = %v", err)
+	}
+	if output := outputBuffer.String(); !strings.HasPrefix(output, appName+" dev\n") || !strings.Contains(output, "transports:  ") {
+		t.Fatalf("output = %q", output)
+	}
+}
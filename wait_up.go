@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const waitUpWorkers = 16
+
+var (
+	waitUpPollInterval = 2 * time.Second
+	dialWaitUpProbe    = net.DialTimeout
+)
+
+// hostNotUpError is returned for a host whose SSH port did not answer with an
+// SSH identification line within --wait-up. It wraps the last probe error so
+// the failure is still classified as a connect problem.
+type hostNotUpError struct {
+	host    string
+	waited  time.Duration
+	lastErr error
+}
+
+func (notUpErr *hostNotUpError) Error() string {
+	return fmt.Sprintf("SSH on %s did not come up within %s: %v", notUpErr.host, notUpErr.waited, notUpErr.lastErr)
+}
+
+func (notUpErr *hostNotUpError) Unwrap() error {
+	return notUpErr.lastErr
+}
+
+// probeSSHBanner connects to host and reads until the server's SSH
+// identification line. Servers may send other lines first (RFC 4253 4.2).
+func probeSSHBanner(host string, timeout time.Duration) (string, error) {
+	connection, err := dialWaitUpProbe("tcp", host, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer connection.Close()
+
+	if err := connection.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(connection)
+	for range 32 {
+		line, err := reader.ReadString('\n')
+		if trimmedLine := strings.TrimSpace(line); strings.HasPrefix(trimmedLine, "SSH-") {
+			return sanitizeBannerLine(trimmedLine), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("port open but no SSH identification: %w", err)
+		}
+	}
+	return "", errors.New("port open but no SSH identification")
+}
+
+// waitForSSH polls every host until its SSH port answers with an
+// identification line or waitUp has passed, for machines that are still
+// booting after provisioning. Hosts are polled concurrently against one
+// deadline and reported in order; the returned map holds the hosts that
+// never came up.
+func waitForSSH(hosts []string, waitUp, probeTimeout time.Duration) map[string]error {
+	type waitResult struct {
+		version string
+		waited  time.Duration
+		err     error
+	}
+
+	started := time.Now()
+	deadline := started.Add(waitUp)
+	results := make([]waitResult, len(hosts))
+	workerSlots := make(chan struct{}, waitUpWorkers)
+	var waitGroup sync.WaitGroup
+	for index, host := range hosts {
+		waitGroup.Go(func() {
+			workerSlots <- struct{}{}
+			defer func() { <-workerSlots }()
+
+			for {
+				timeout := min(probeTimeout, max(time.Until(deadline), time.Second))
+				version, err := probeSSHBanner(host, timeout)
+				if err == nil {
+					results[index] = waitResult{version: version, waited: time.Since(started)}
+					return
+				}
+				if time.Now().Add(waitUpPollInterval).After(deadline) {
+					results[index] = waitResult{err: &hostNotUpError{host: host, waited: waitUp, lastErr: err}}
+					return
+				}
+				time.Sleep(waitUpPollInterval)
+			}
+		})
+	}
+	waitGroup.Wait()
+
+	notUp := map[string]error{}
+	for index, host := range hosts {
+		result := results[index]
+		if result.err != nil {
+			notUp[host] = result.err
+			outputAnsibleHostStatus("failed", host, result.err.Error())
+			outputFailureHint(result.err)
+			emitEvent(runEvent{Event: "host_failed", Host: host, Operation: "wait-up", Error: result.err.Error()})
+			continue
+		}
+		outputAnsibleHostStatus("ok", host, fmt.Sprintf("up after %s (%s)", result.waited.Round(time.Second), result.version))
+	}
+	return notUp
+}
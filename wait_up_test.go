@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForSSHPollsUntilBannerAppears(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = connection.Write([]byte("booting, please wait\r\nSSH-2.0-OpenSSH_9.6\r\n"))
+			_ = connection.Close()
+		}
+	}()
+
+	originalInterval, originalDial := waitUpPollInterval, dialWaitUpProbe
+	t.Cleanup(func() { waitUpPollInterval, dialWaitUpProbe = originalInterval, originalDial })
+	waitUpPollInterval = 10 * time.Millisecond
+	var attempts atomic.Int32
+	dialWaitUpProbe = func(network, address string, timeout time.Duration) (net.Conn, error) {
+		// The first probes find the port closed, as on a machine still booting.
+		if attempts.Add(1) < 3 {
+			return nil, errors.New("connect: connection refused")
+		}
+		return net.DialTimeout(network, listener.Addr().String(), timeout)
+	}
+
+	notUp := waitForSSH([]string{"app01:22"}, time.Second, time.Second)
+	if len(notUp) != 0 {
+		t.Fatalf("waitForSSH() not up = %v", notUp)
+	}
+	if attempts.Load() != 3 {
+		t.Fatalf("probe attempts = %d, want 3", attempts.Load())
+	}
+	if output := outputBuffer.String(); !strings.Contains(output, "(SSH-2.0-OpenSSH_9.6)") {
+		t.Fatalf("output = %q, want the server version", output)
+	}
+}
+
+func TestWaitForSSHReportsHostsThatNeverComeUp(t *testing.T) {
+	captureWriters(t)
+	originalInterval, originalDial := waitUpPollInterval, dialWaitUpProbe
+	t.Cleanup(func() { waitUpPollInterval, dialWaitUpProbe = originalInterval, originalDial })
+	waitUpPollInterval = 10 * time.Millisecond
+	dialWaitUpProbe = func(string, string, time.Duration) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+
+	notUp := waitForSSH([]string{"app01:22", "app02:22"}, 50*time.Millisecond, time.Second)
+	if len(notUp) != 2 {
+		t.Fatalf("waitForSSH() not up = %v, want both hosts", notUp)
+	}
+	var notUpErr *hostNotUpError
+	if !errors.As(notUp["app01:22"], &notUpErr) || !strings.Contains(notUp["app01:22"].Error(), "did not come up within 50ms") {
+		t.Fatalf("error = %v", notUp["app01:22"])
+	}
+	if category := classifyHostError(notUp["app01:22"]); category != hostErrorConnect {
+		t.Fatalf("classifyHostError() = %v, want connect", category)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultWatchInterval = time.Minute
+
+var watchSleep = time.Sleep
+
+// retryableHostFailure reports whether a failed host may succeed later
+// without operator action, e.g. because it is still powering on. Auth and
+// host key failures are final so --watch never hammers a login.
+func retryableHostFailure(err error) bool {
+	switch classifyHostError(err) {
+	case hostErrorDNS, hostErrorConnectTimeout, hostErrorConnect, hostErrorSession:
+		return true
+	default:
+		return false
+	}
+}
+
+// watchFailedHosts retries hosts that failed for a retryable reason every
+// interval until they all succeed or watchFor has passed (--watch). retry
+// runs every operation again for the given hosts; a host's recap is replaced
+// by its latest attempt, so a host that comes online counts as a success.
+func watchFailedHosts(
+	watchFor, interval time.Duration,
+	hosts []string,
+	hostRecaps map[string]hostRunRecap,
+	failedHosts map[string]bool,
+	retry func(hosts []string) (map[string]hostRunRecap, map[string]bool),
+) {
+	deadline := time.Now().Add(watchFor)
+	for round := 1; ; round++ {
+		var pendingHosts []string
+		for _, host := range hosts {
+			if failedHosts[host] && retryableHostFailure(hostRecaps[host].lastErr) {
+				pendingHosts = append(pendingHosts, host)
+			}
+		}
+		if len(pendingHosts) == 0 {
+			return
+		}
+		if time.Now().Add(interval).After(deadline) {
+			outputPrintf("[WARNING]: --watch %s ended with %d host(s) still failing\n", watchFor, len(pendingHosts))
+			return
+		}
+		outputPrintf("Watching %d failed host(s); next retry in %s.\n", len(pendingHosts), interval)
+		watchSleep(interval)
+
+		outputAnsibleTask(fmt.Sprintf("Retry failed hosts (watch round %d)", round))
+		outputAnsibleHostStatus("ok", "localhost", fmt.Sprintf("%d host(s) to retry", len(pendingHosts)))
+		roundRecaps, roundFailed := retry(pendingHosts)
+		recovered := 0
+		for _, host := range pendingHosts {
+			hostRecaps[host] = roundRecaps[host]
+			if roundFailed[host] {
+				continue
+			}
+			delete(failedHosts, host)
+			recovered++
+		}
+		outputPrintf("Watch round %d: %d host(s) came online, %d still failing.\n", round, recovered, len(pendingHosts)-recovered)
+		emitEvent(runEvent{Event: "watch_round", Hosts: len(pendingHosts), Failed: len(pendingHosts) - recovered})
+	}
+}
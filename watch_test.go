@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchFailedHostsRetriesUntilHostsComeOnline(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	originalSleep := watchSleep
+	t.Cleanup(func() { watchSleep = originalSleep })
+	var slept []time.Duration
+	watchSleep = func(interval time.Duration) { slept = append(slept, interval) }
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	hosts := []string{"rack01:22", "rack02:22", "auth:22", "ok:22"}
+	hostRecaps := map[string]hostRunRecap{
+		"rack01:22": {failed: 1, lastErr: refused},
+		"rack02:22": {failed: 1, lastErr: refused},
+		"auth:22":   {failed: 1, lastErr: errors.New("ssh: handshake failed: ssh: unable to authenticate")},
+		"ok:22":     {ok: 1, changed: 1},
+	}
+	failedHosts := map[string]bool{"rack01:22": true, "rack02:22": true, "auth:22": true}
+
+	var retried [][]string
+	watchFailedHosts(time.Hour, time.Minute, hosts, hostRecaps, failedHosts, func(retryHosts []string) (map[string]hostRunRecap, map[string]bool) {
+		retried = append(retried, retryHosts)
+		recaps := map[string]hostRunRecap{}
+		failed := map[string]bool{}
+		for _, host := range retryHosts {
+			// rack01 powers on before the first retry, rack02 before the second.
+			if host == "rack02:22" && len(retried) == 1 {
+				recaps[host] = hostRunRecap{failed: 1, lastErr: refused}
+				failed[host] = true
+				continue
+			}
+			recaps[host] = hostRunRecap{ok: 1, changed: 1}
+		}
+		return recaps, failed
+	})
+
+	if len(retried) != 2 || strings.Join(retried[0], ",") != "rack01:22,rack02:22" || strings.Join(retried[1], ",") != "rack02:22" {
+		t.Fatalf("retried = %q, want auth failures left alone", retried)
+	}
+	if len(slept) != 2 || slept[0] != time.Minute {
+		t.Fatalf("slept = %v", slept)
+	}
+	if len(failedHosts) != 1 || !failedHosts["auth:22"] || hostRecaps["rack02:22"].failed != 0 {
+		t.Fatalf("failedHosts = %v, recaps = %v", failedHosts, hostRecaps)
+	}
+	output := outputBuffer.String()
+	if !strings.Contains(output, "Watch round 1: 1 host(s) came online, 1 still failing.") || !strings.Contains(output, "Watch round 2: 1 host(s) came online, 0 still failing.") {
+		t.Fatalf("output = %q", output)
+	}
+}
+
+func TestWatchFailedHostsStopsAtDeadline(t *testing.T) {
+	outputBuffer, _ := captureWriters(t)
+	originalSleep := watchSleep
+	t.Cleanup(func() { watchSleep = originalSleep })
+	watchSleep = func(time.Duration) { t.Fatalf("no retry fits before the deadline") }
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	failedHosts := map[string]bool{"rack01:22": true}
+	watchFailedHosts(time.Minute, 2*time.Minute, []string{"rack01:22"}, map[string]hostRunRecap{"rack01:22": {failed: 1, lastErr: refused}}, failedHosts, nil)
+	if !failedHosts["rack01:22"] || !strings.Contains(outputBuffer.String(), "ended with 1 host(s) still failing") {
+		t.Fatalf("failedHosts = %v, output = %q", failedHosts, outputBuffer.String())
+	}
+}
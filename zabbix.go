@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	zabbixTokenEnv      = "ZABBIX_TOKEN"
+	zabbixAPIPath       = "/api_jsonrpc.php"
+	zabbixErrorBodySize = 512
+	// zabbixAgentInterface is the interface type of the Zabbix agent; SNMP,
+	// IPMI and JMX interfaces belong to devices that are not SSH targets.
+	zabbixAgentInterface = "1"
+)
+
+// zabbixHTTPClient talks to the Zabbix API; tests point it at a local server.
+var zabbixHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// zabbixHost is the part of a Zabbix host --zabbix-url reads. The API returns
+// numbers and flags as strings.
+type zabbixHost struct {
+	Host       string `json:"host"`
+	Interfaces []struct {
+		Type  string `json:"type"`
+		Main  string `json:"main"`
+		UseIP string `json:"useip"`
+		IP    string `json:"ip"`
+		DNS   string `json:"dns"`
+	} `json:"interfaces"`
+}
+
+type zabbixResponse struct {
+	Result []zabbixHost `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+// readZabbixInventory returns the main agent interface address of every
+// monitored Zabbix host, in Zabbix's order and without repeats, plus how many
+// monitored hosts had no agent interface and were skipped.
+func readZabbixInventory(programOptions *options) ([]string, int, error) {
+	apiURL, err := zabbixAPIURL(programOptions.ZabbixURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	token, err := serviceCredential("Zabbix", "API token", programOptions.ZabbixTokenRef, "--zabbix-token-ref", zabbixTokenEnv)
+	if err != nil {
+		return nil, 0, err
+	}
+	hosts, err := fetchZabbixHosts(apiURL, token)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []string
+	skipped := 0
+	for _, host := range hosts {
+		address := zabbixHostAddress(host)
+		if address == "" {
+			skipped++
+			continue
+		}
+		if !slices.Contains(entries, address) {
+			entries = append(entries, address)
+		}
+	}
+	return entries, skipped, nil
+}
+
+// zabbixAPIURL is the JSON-RPC endpoint of the Zabbix frontend at baseURL.
+func zabbixAPIURL(baseURL string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return "", fmt.Errorf("--zabbix-url %q must be an http(s) URL such as https://zabbix.example.com", baseURL)
+	}
+	if !strings.HasSuffix(parsedURL.Path, zabbixAPIPath) {
+		parsedURL.Path = strings.TrimRight(parsedURL.Path, "/") + zabbixAPIPath
+	}
+	return parsedURL.String(), nil
+}
+
+func fetchZabbixHosts(apiURL, token string) ([]zabbixHost, error) {
+	requestBody, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "host.get",
+		"params": map[string]any{
+			"output":           []string{"host"},
+			"selectInterfaces": []string{"type", "main", "useip", "ip", "dns"},
+			"monitored_hosts":  true,
+		},
+		"id": 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build Zabbix request: %w", err)
+	}
+	request, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("build Zabbix request: %w", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json-rpc")
+	response, err := zabbixHTTPClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("query Zabbix: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, zabbixErrorBodySize))
+		return nil, fmt.Errorf("Zabbix returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	var result zabbixResponse
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("parse Zabbix host list: %w", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("Zabbix host.get failed: %s %s", result.Error.Message, result.Error.Data)
+	}
+	return result.Result, nil
+}
+
+// zabbixHostAddress is the IP or DNS name of the host's main agent
+// interface, whichever the interface is set to connect to.
+func zabbixHostAddress(host zabbixHost) string {
+	for _, hostInterface := range host.Interfaces {
+		if hostInterface.Type != zabbixAgentInterface || hostInterface.Main != "1" {
+			continue
+		}
+		if hostInterface.UseIP == "1" {
+			return strings.TrimSpace(hostInterface.IP)
+		}
+		return strings.TrimSpace(hostInterface.DNS)
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadZabbixInventoryTargetsMainAgentInterfaces(t *testing.T) {
+	t.Setenv(zabbixTokenEnv, "env-token")
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var call struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.NewDecoder(request.Body).Decode(&call); err != nil || request.URL.Path != "/zabbix/api_jsonrpc.php" ||
+			call.Method != "host.get" || call.Params["monitored_hosts"] != true {
+			http.Error(writer, "unexpected call "+request.URL.String(), http.StatusBadRequest)
+			return
+		}
+		if got := request.Header.Get("Authorization"); got != "Bearer secret-token" {
+			fmt.Fprint(writer, `{"jsonrpc": "2.0", "error": {"code": -32602, "message": "Invalid params.", "data": "Not authorized."}, "id": 1}`)
+			return
+		}
+		fmt.Fprint(writer, `{"jsonrpc": "2.0", "id": 1, "result": [
+			{"host": "app01", "interfaces": [
+				{"type": "2", "main": "1", "useip": "1", "ip": "10.0.9.1", "dns": ""},
+				{"type": "1", "main": "1", "useip": "1", "ip": "10.0.0.5", "dns": "app01.example.com"}]},
+			{"host": "app02", "interfaces": [{"type": "1", "main": "1", "useip": "0", "ip": "", "dns": "app02.example.com"}]},
+			{"host": "switch01", "interfaces": [{"type": "2", "main": "1", "useip": "1", "ip": "10.0.9.2", "dns": ""}]},
+			{"host": "app01-clone", "interfaces": [{"type": "1", "main": "1", "useip": "1", "ip": "10.0.0.5", "dns": ""}]}]}`)
+	}))
+	defer server.Close()
+
+	original := resolvePasswordFromSecretRef
+	resolvePasswordFromSecretRef = func(secretRef string) (string, error) {
+		if secretRef != "bw://zabbix-token" {
+			return "", fmt.Errorf("unexpected ref %q", secretRef)
+		}
+		return "secret-token\n", nil
+	}
+	t.Cleanup(func() { resolvePasswordFromSecretRef = original })
+
+	programOptions := &options{ZabbixURL: server.URL + "/zabbix/", ZabbixTokenRef: "bw://zabbix-token"}
+	entries, skipped, err := readZabbixInventory(programOptions)
+	if err != nil {
+		t.Fatalf("readZabbixInventory() error = %v", err)
+	}
+	if want := []string{"10.0.0.5", "app02.example.com"}; !slices.Equal(entries, want) || skipped != 1 {
+		t.Fatalf("readZabbixInventory() = %v, skipped %d; want %v, skipped 1", entries, skipped, want)
+	}
+
+	programOptions.ZabbixTokenRef = ""
+	if _, _, err := readZabbixInventory(programOptions); err == nil || !strings.Contains(err.Error(), "Invalid params. Not authorized.") {
+		t.Fatalf("readZabbixInventory() with ZABBIX_TOKEN error = %v", err)
+	}
+}
+
+func TestZabbixAPIURL(t *testing.T) {
+	for baseURL, want := range map[string]string{
+		"https://zabbix.example.com":                 "https://zabbix.example.com/api_jsonrpc.php",
+		"https://example.com/zabbix/api_jsonrpc.php": "https://example.com/zabbix/api_jsonrpc.php",
+	} {
+		if got, err := zabbixAPIURL(baseURL); err != nil || got != want {
+			t.Fatalf("zabbixAPIURL(%q) = %q, %v; want %q", baseURL, got, err, want)
+		}
+	}
+	if _, err := zabbixAPIURL("zabbix.example.com"); err == nil || !strings.Contains(err.Error(), "must be an http(s) URL") {
+		t.Fatalf("zabbixAPIURL() without a scheme error = %v", err)
+	}
+}